@@ -0,0 +1,450 @@
+// Package amethyst is the public API of the amethyst storage engine, an
+// embedded LSM-tree key-value store. It re-exports the engine's entry
+// points so other modules can embed it as a library:
+//
+//	d, err := amethyst.Open(amethyst.WithDBPath("/var/lib/app"))
+//	if err != nil {
+//		return err
+//	}
+//	defer d.Close()
+//	err = d.Put([]byte("key"), []byte("value"))
+//
+// # Stability
+//
+// Everything exported here follows semantic versioning: within a major
+// version, identifiers are not removed or renamed and functions keep their
+// signatures, though new methods, options, and struct fields may be added.
+// Error values keep their identity, so errors.Is checks stay valid.
+//
+// Packages under internal/ carry no such promise and cannot be imported from
+// other modules. Types re-exported here are aliases for internal ones; use
+// them only through the names in this package. Methods on DB that mention
+// internal types not re-exported here are not covered by this contract.
+package amethyst
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/compression"
+	"amethyst/internal/db"
+	"amethyst/internal/filter"
+	"amethyst/internal/iterator"
+	"amethyst/internal/ratelimit"
+	"amethyst/internal/scheduler"
+)
+
+// DB is an open database. It is safe for concurrent use.
+type DB = db.DB
+
+// Open opens the database configured by opts, creating it if needed.
+func Open(opts ...Option) (*DB, error) {
+	return db.Open(opts...)
+}
+
+// OpenSecondary opens the database at primaryPath as a read-only secondary
+// that keeps up with the primary writing to it.
+func OpenSecondary(primaryPath string, opts ...Option) (*DB, error) {
+	return db.OpenSecondary(primaryPath, opts...)
+}
+
+type (
+	// Options holds the configuration Open starts from DefaultOptions and
+	// applies each Option to.
+	Options = db.Options
+	// Option sets one or more fields of Options.
+	Option = db.Option
+	// ReadOptions control how a read treats the blocks it loads.
+	ReadOptions = db.ReadOptions
+	// WriteOptions control how a write is committed.
+	WriteOptions = db.WriteOptions
+	// WriteBatch collects puts and deletes to commit atomically.
+	WriteBatch = db.WriteBatch
+	// ReadTier limits where a read may look for data.
+	ReadTier = db.ReadTier
+	// Env holds resources that many DB instances in a process can share.
+	Env = db.Env
+	// WriteBufferManager caps the memtable memory of the DBs sharing it.
+	WriteBufferManager = db.WriteBufferManager
+	// CompactionFilter removes entries while compaction rewrites them.
+	CompactionFilter = db.CompactionFilter
+	// EventListener is told about flushes, compactions, WAL rotations and
+	// table files.
+	EventListener = db.EventListener
+	// BaseEventListener implements every EventListener callback as a no-op.
+	BaseEventListener = db.BaseEventListener
+	// FlushInfo describes a flush of one memtable.
+	FlushInfo = db.FlushInfo
+	// CompactionInfo describes a completed compaction.
+	CompactionInfo = db.CompactionInfo
+	// WALRotationInfo describes the move of writes to a new WAL.
+	WALRotationInfo = db.WALRotationInfo
+	// TableFileInfo identifies a table file.
+	TableFileInfo = db.TableFileInfo
+	// Stats is a snapshot of the shape and activity of a DB.
+	Stats = db.Stats
+	// ArchivedWAL describes a WAL kept in the archive.
+	ArchivedWAL = db.ArchivedWAL
+	// Transaction is a pessimistic transaction, locking the keys it touches.
+	Transaction = db.Transaction
+	// TransactionOptions configure a transaction.
+	TransactionOptions = db.TransactionOptions
+)
+
+type (
+	// Entry is a key-value pair as returned by iterators and scans.
+	Entry = common.Entry
+	// EntryIterator yields entries in key order, then nil at the end.
+	EntryIterator = common.EntryIterator
+	// Iterator is an EntryIterator that must be closed when done with.
+	Iterator = iterator.Iterator
+	// PrefixExtractor maps keys to the prefixes bloom filters index.
+	PrefixExtractor = common.PrefixExtractor
+	// Codec compresses SSTable data blocks.
+	Codec = compression.Codec
+	// FilterPolicy chooses the filter SSTables build over their keys.
+	FilterPolicy = filter.Policy
+	// BlockCachePolicy chooses which blocks a full block cache evicts.
+	BlockCachePolicy = block_cache.Policy
+	// Logger receives the engine's log records.
+	Logger = common.Logger
+	// Level is the severity of a log record.
+	Level = common.Level
+	// Scheduler runs the background jobs of the instances sharing an Env.
+	Scheduler = scheduler.Scheduler
+	// RateLimiter paces the background writes of the instances sharing an
+	// Env.
+	RateLimiter = ratelimit.Limiter
+)
+
+// Read tiers.
+const (
+	ReadAllTier    = db.ReadAllTier
+	BlockCacheTier = db.BlockCacheTier
+)
+
+var (
+	// DefaultOptions is the configuration Open starts from.
+	DefaultOptions = db.DefaultOptions
+	// DefaultReadOptions caches and verifies every block read, and pins the
+	// blocks under open iterators.
+	DefaultReadOptions = db.DefaultReadOptions
+	// DefaultWriteOptions syncs every write.
+	DefaultWriteOptions = db.DefaultWriteOptions
+	// DefaultTransactionOptions wait for locks indefinitely and sync the
+	// commit.
+	DefaultTransactionOptions = db.DefaultTransactionOptions
+)
+
+// Compression codecs for WithCompression.
+var (
+	NoCompression     Codec = compression.None
+	SnappyCompression Codec = compression.Snappy
+	ZlibCompression   Codec = compression.Zlib
+)
+
+// Block cache policies for WithBlockCachePolicy.
+const (
+	LRUCache     = block_cache.PolicyLRU
+	ClockCache   = block_cache.PolicyClock
+	TinyLFUCache = block_cache.PolicyTinyLFU
+)
+
+// NoFilter builds no SSTable filters, for WithFilterPolicy.
+var NoFilter FilterPolicy = filter.None
+
+// Log levels.
+const (
+	LevelDebug = common.LevelDebug
+	LevelInfo  = common.LevelInfo
+	LevelWarn  = common.LevelWarn
+	LevelError = common.LevelError
+)
+
+// DiscardLogger drops every record, for WithLogger.
+var DiscardLogger Logger = common.DiscardLogger
+
+// Errors returned by DB methods. Check for them with errors.Is.
+var (
+	ErrNotFound        = db.ErrNotFound
+	ErrReadOnly        = db.ErrReadOnly
+	ErrClosed          = db.ErrClosed
+	ErrWouldBlock      = db.ErrWouldBlock
+	ErrCorruption      = db.ErrCorruption
+	ErrBulkLoadOverlap = db.ErrBulkLoadOverlap
+	ErrLockTimeout     = db.ErrLockTimeout
+	ErrNotInteger      = db.ErrNotInteger
+	ErrWriteStalled    = db.ErrWriteStalled
+	ErrDeadlock        = db.ErrDeadlock
+	ErrTxnDone         = db.ErrTxnDone
+)
+
+// NewEnv returns an Env with a shared block cache and table cache on the
+// local filesystem.
+func NewEnv() *Env {
+	return db.NewEnv()
+}
+
+// NewScheduler returns a pool of jobs background workers, for Env.Scheduler,
+// of which at most compactions may run compactions at once.
+func NewScheduler(jobs, compactions int) Scheduler {
+	return db.NewScheduler(jobs, compactions)
+}
+
+// NewRateLimiter returns a limiter of bytesPerSec bytes per second, for
+// Env.RateLimiter.
+func NewRateLimiter(bytesPerSec int64) RateLimiter {
+	return db.NewRateLimiter(bytesPerSec)
+}
+
+// NewWriteBufferManager returns a manager capping the combined memtable
+// memory of the DBs sharing it at limit bytes.
+func NewWriteBufferManager(limit int) *WriteBufferManager {
+	return db.NewWriteBufferManager(limit)
+}
+
+// NewTTLFilter returns a CompactionFilter dropping entries committed more
+// than maxAge ago.
+func NewTTLFilter(maxAge time.Duration) CompactionFilter {
+	return db.NewTTLFilter(maxAge)
+}
+
+// NewTextLogger returns a Logger writing the records at min and above to w,
+// one line each.
+func NewTextLogger(w io.Writer, min Level) Logger {
+	return common.NewTextLogger(w, min)
+}
+
+// NewSlogLogger returns a Logger passing records on to l.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return common.NewSlogLogger(l)
+}
+
+// NewFixedPrefixExtractor returns a PrefixExtractor taking the first n bytes
+// of keys at least n bytes long.
+func NewFixedPrefixExtractor(n int) PrefixExtractor {
+	return common.NewFixedPrefixExtractor(n)
+}
+
+// NewDelimitedPrefixExtractor returns a PrefixExtractor taking keys up to
+// and including the first delim.
+func NewDelimitedPrefixExtractor(delim byte) PrefixExtractor {
+	return common.NewDelimitedPrefixExtractor(delim)
+}
+
+// NewBloomFilterPolicy returns a FilterPolicy building bloom filters of
+// bitsPerKey bits per key; 10 gives about a 1% false positive rate.
+func NewBloomFilterPolicy(bitsPerKey float64) FilterPolicy {
+	return filter.NewBloomPolicy(bitsPerKey)
+}
+
+// NewRibbonFilterPolicy returns a FilterPolicy building ribbon filters of
+// about bitsPerKey bits per key, which are about 30% smaller than bloom
+// filters of the same false positive rate but slower to build.
+func NewRibbonFilterPolicy(bitsPerKey float64) FilterPolicy {
+	return filter.NewRibbonPolicy(bitsPerKey)
+}
+
+// WithDBPath sets Options.DBPath.
+func WithDBPath(path string) Option {
+	return db.WithDBPath(path)
+}
+
+// WithMemtableFlushThreshold sets Options.MemtableFlushThreshold.
+func WithMemtableFlushThreshold(n int) Option {
+	return db.WithMemtableFlushThreshold(n)
+}
+
+// WithMaxSSTableLevel sets Options.MaxSSTableLevel.
+func WithMaxSSTableLevel(n int) Option {
+	return db.WithMaxSSTableLevel(n)
+}
+
+// WithMaxBatchSize sets Options.MaxBatchSize.
+func WithMaxBatchSize(n int) Option {
+	return db.WithMaxBatchSize(n)
+}
+
+// WithBatchTimeout sets Options.BatchTimeout.
+func WithBatchTimeout(d time.Duration) Option {
+	return db.WithBatchTimeout(d)
+}
+
+// WithMaxWriteQueueDepth sets Options.MaxWriteQueueDepth.
+func WithMaxWriteQueueDepth(n int) Option {
+	return db.WithMaxWriteQueueDepth(n)
+}
+
+// WithWriteTimeout sets Options.WriteTimeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return db.WithWriteTimeout(d)
+}
+
+// WithBloomFilterFPR sets Options.BloomFilterFPR.
+func WithBloomFilterFPR(fpr float64) Option {
+	return db.WithBloomFilterFPR(fpr)
+}
+
+// WithFilterPolicy sets Options.FilterPolicy.
+func WithFilterPolicy(p FilterPolicy) Option {
+	return db.WithFilterPolicy(p)
+}
+
+// WithPrefixExtractor sets Options.PrefixExtractor.
+func WithPrefixExtractor(p PrefixExtractor) Option {
+	return db.WithPrefixExtractor(p)
+}
+
+// WithCompression sets Options.Compression.
+func WithCompression(c Codec) Option {
+	return db.WithCompression(c)
+}
+
+// WithMaxImmutableMemtables sets Options.MaxImmutableMemtables.
+func WithMaxImmutableMemtables(n int) Option {
+	return db.WithMaxImmutableMemtables(n)
+}
+
+// WithMemtableBloomBitsPerKey sets Options.MemtableBloomBitsPerKey.
+func WithMemtableBloomBitsPerKey(bitsPerKey float64) Option {
+	return db.WithMemtableBloomBitsPerKey(bitsPerKey)
+}
+
+// WithL0StopWritesTrigger sets Options.L0StopWritesTrigger.
+func WithL0StopWritesTrigger(n int) Option {
+	return db.WithL0StopWritesTrigger(n)
+}
+
+// WithTombstoneCompaction sets Options.TombstoneCompactionRatio.
+func WithTombstoneCompaction(ratio float64) Option {
+	return db.WithTombstoneCompaction(ratio)
+}
+
+// WithBlobThreshold sets Options.BlobThreshold.
+func WithBlobThreshold(n int) Option {
+	return db.WithBlobThreshold(n)
+}
+
+// WithBlobGCCutoff sets Options.BlobGCCutoff.
+func WithBlobGCCutoff(cutoff float64) Option {
+	return db.WithBlobGCCutoff(cutoff)
+}
+
+// WithBytesPerSync sets Options.BytesPerSync and Options.WALBytesPerSync.
+func WithBytesPerSync(sstable, wal int64) Option {
+	return db.WithBytesPerSync(sstable, wal)
+}
+
+// WithWALArchive sets Options.ArchiveWALs, Options.WALArchiveTTL and
+// Options.WALArchiveSizeLimit.
+func WithWALArchive(ttl time.Duration, sizeLimit int64) Option {
+	return db.WithWALArchive(ttl, sizeLimit)
+}
+
+// WithReplicationBacklog sets Options.ReplicationBacklog.
+func WithReplicationBacklog(n int) Option {
+	return db.WithReplicationBacklog(n)
+}
+
+// WithCompactionRateLimit sets Options.CompactionRateLimit.
+func WithCompactionRateLimit(bytesPerSec int64) Option {
+	return db.WithCompactionRateLimit(bytesPerSec)
+}
+
+// WithL0CompactionTrigger sets Options.L0CompactionTrigger.
+func WithL0CompactionTrigger(n int) Option {
+	return db.WithL0CompactionTrigger(n)
+}
+
+// WithLevelSizeMultiplier sets Options.LevelSizeMultiplier.
+func WithLevelSizeMultiplier(n int) Option {
+	return db.WithLevelSizeMultiplier(n)
+}
+
+// WithBackgroundJobs sets Options.MaxBackgroundJobs and Options.MaxBackgroundCompactions.
+func WithBackgroundJobs(jobs, compactions int) Option {
+	return db.WithBackgroundJobs(jobs, compactions)
+}
+
+// WithCompactionsPerLevel sets Options.MaxCompactionsPerLevel.
+func WithCompactionsPerLevel(n int) Option {
+	return db.WithCompactionsPerLevel(n)
+}
+
+// WithIteratorLeakWarnings sets Options.WarnIteratorLeaks.
+func WithIteratorLeakWarnings() Option {
+	return db.WithIteratorLeakWarnings()
+}
+
+// WithCompactionAutoTune sets Options.AutoTuneCompaction and Options.MinL0CompactionTrigger and Options.MaxL0CompactionTrigger.
+func WithCompactionAutoTune(minTrigger, maxTrigger int) Option {
+	return db.WithCompactionAutoTune(minTrigger, maxTrigger)
+}
+
+// WithPeriodicCheckpoints sets Options.CheckpointInterval and Options.CheckpointRetention.
+func WithPeriodicCheckpoints(interval time.Duration, retain int) Option {
+	return db.WithPeriodicCheckpoints(interval, retain)
+}
+
+// WithTableChecksumVerification sets Options.VerifyTableChecksums.
+func WithTableChecksumVerification() Option {
+	return db.WithTableChecksumVerification()
+}
+
+// WithCorruptFileQuarantine sets Options.QuarantineCorruptFiles.
+func WithCorruptFileQuarantine() Option {
+	return db.WithCorruptFileQuarantine()
+}
+
+// WithShapeHistory sets Options.RecordShapeHistory.
+func WithShapeHistory() Option {
+	return db.WithShapeHistory()
+}
+
+// WithCompactionFilter sets Options.CompactionFilter.
+func WithCompactionFilter(f CompactionFilter) Option {
+	return db.WithCompactionFilter(f)
+}
+
+// WithLogger sets Options.Logger.
+func WithLogger(l Logger) Option {
+	return db.WithLogger(l)
+}
+
+// WithEventListener adds l to Options.EventListeners.
+func WithEventListener(l EventListener) Option {
+	return db.WithEventListener(l)
+}
+
+// WithReadOnly sets Options.ReadOnly.
+func WithReadOnly() Option {
+	return db.WithReadOnly()
+}
+
+// WithSecondaryCatchUpInterval sets Options.SecondaryCatchUpInterval.
+func WithSecondaryCatchUpInterval(interval time.Duration) Option {
+	return db.WithSecondaryCatchUpInterval(interval)
+}
+
+// WithBlockCacheSize sets Options.BlockCacheSize.
+func WithBlockCacheSize(bytes int64) Option {
+	return db.WithBlockCacheSize(bytes)
+}
+
+// WithBlockCachePolicy sets Options.BlockCachePolicy.
+func WithBlockCachePolicy(p BlockCachePolicy) Option {
+	return db.WithBlockCachePolicy(p)
+}
+
+// WithMaxOpenFiles sets Options.MaxOpenFiles.
+func WithMaxOpenFiles(n int) Option {
+	return db.WithMaxOpenFiles(n)
+}
+
+// WithEnv sets Options.Env.
+func WithEnv(env *Env) Option {
+	return db.WithEnv(env)
+}
@@ -0,0 +1,47 @@
+package amethyst_test
+
+import (
+	"testing"
+
+	"amethyst"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicAPI(t *testing.T) {
+	d, err := amethyst.Open(
+		amethyst.WithDBPath(t.TempDir()),
+		amethyst.WithCompression(amethyst.SnappyCompression),
+		amethyst.WithPrefixExtractor(amethyst.NewDelimitedPrefixExtractor(':')),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	tests := []struct {
+		key, value string
+	}{
+		{"user:1", "alice"},
+		{"user:2", "bob"},
+		{"group:1", "admins"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, d.Put([]byte(tt.key), []byte(tt.value)))
+	}
+
+	_, err = d.Get([]byte("user:3"))
+	require.ErrorIs(t, err, amethyst.ErrNotFound)
+
+	var iter amethyst.Iterator
+	iter, err = d.NewPrefixIterator([]byte("user:"))
+	require.NoError(t, err)
+	defer iter.Close()
+	var keys []string
+	for {
+		entry, err := iter.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			break
+		}
+		keys = append(keys, string(entry.Key))
+	}
+	require.Equal(t, []string{"user:1", "user:2"}, keys)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"amethyst/internal/db"
+)
+
+func printAdminHelp() {
+	fmt.Println("admin commands (database opened read-only):")
+	fmt.Println("  get   <key>           - read a value")
+	fmt.Println("  scan  [start [end]]   - print live entries in [start, end)")
+	fmt.Println("  count [start [end]]   - count live keys in [start, end)")
+	fmt.Println("  size  [start [end]]   - approximate on-disk bytes for [start, end)")
+	fmt.Println("  verify                - check every table and WAL for damage")
+}
+
+// keyRangeArgs parses optional [start [end]] arguments. Missing bounds are nil.
+func keyRangeArgs(args []string) (start, end []byte, ok bool) {
+	if len(args) > 2 {
+		return nil, nil, false
+	}
+	if len(args) > 0 {
+		start = []byte(args[0])
+	}
+	if len(args) > 1 {
+		end = []byte(args[1])
+	}
+	return start, end, true
+}
+
+// runAdmin answers a single query against a closed database without starting
+// the write pipeline. It returns the process exit code.
+func runAdmin(dbPath string, args []string) int {
+	if len(args) == 0 {
+		printAdminHelp()
+		return 2
+	}
+
+	engine, err := db.Open(db.WithDBPath(dbPath), db.WithReadOnly(), db.WithLogger(logger))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		return 1
+	}
+	defer engine.Close()
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "get":
+		if len(rest) != 1 {
+			fmt.Println("usage: admin get <key>")
+			return 2
+		}
+		value, err := engine.Get([]byte(rest[0]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "get error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%s\n", string(value))
+	case "scan", "count", "size":
+		start, end, ok := keyRangeArgs(rest)
+		if !ok {
+			fmt.Printf("usage: admin %s [start [end]]\n", cmd)
+			return 2
+		}
+
+		if cmd == "size" {
+			fmt.Printf("%d bytes\n", engine.ApproximateSize(start, end))
+			return 0
+		}
+
+		entries, err := engine.ScanRange(start, end, nil, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s error: %v\n", cmd, err)
+			return 1
+		}
+		if cmd == "count" {
+			fmt.Printf("%d keys\n", len(entries))
+			return 0
+		}
+
+		fmt.Printf("%-8s %-20s  %s\n", "SEQ", "KEY", "VALUE")
+		fmt.Println()
+		for _, entry := range entries {
+			fmt.Printf("%-8d %-20s  %s\n", entry.Seq, string(entry.Key), string(entry.Value))
+		}
+		fmt.Println()
+		fmt.Printf("Total entries: %d\n", len(entries))
+	case "verify":
+		if len(rest) != 0 {
+			fmt.Println("usage: admin verify")
+			return 2
+		}
+		if verify(engine) > 0 {
+			return 1
+		}
+	default:
+		fmt.Printf("unknown admin command: %s\n", cmd)
+		printAdminHelp()
+		return 2
+	}
+
+	return 0
+}
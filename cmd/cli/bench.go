@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"amethyst/internal/bench"
+	"amethyst/internal/db"
+)
+
+// runBench loads a YCSB workload into the database and runs it.
+// usage: bench <A-F> [ops] [records]
+func runBench(parts []string, engine *db.DB) {
+	if len(parts) < 2 || len(parts) > 4 {
+		fmt.Println("usage: bench <A-F> [ops] [records]")
+		return
+	}
+
+	ops, records := 10000, 1000
+	for i, dst := range []*int{&ops, &records} {
+		if len(parts) <= i+2 {
+			break
+		}
+		n, err := strconv.Atoi(parts[i+2])
+		if err != nil || n < 1 {
+			fmt.Println("bench: ops and records must be positive integers")
+			return
+		}
+		*dst = n
+	}
+
+	w, err := bench.Standard(parts[1], records)
+	if err != nil {
+		fmt.Printf("bench: %v\n", err)
+		return
+	}
+
+	// Per-operation logging would swamp the output
+	logger.enabled.Store(false)
+	defer logger.enabled.Store(true)
+
+	store := bench.NewDBStore(engine)
+	g := bench.NewGenerator(w, time.Now().UnixNano())
+
+	start := time.Now()
+	if err := bench.Load(store, g); err != nil {
+		fmt.Printf("bench load error: %v\n", err)
+		return
+	}
+	fmt.Printf("loaded %d records in %v\n", records, time.Since(start))
+
+	result, err := bench.Run(store, g, ops)
+	if err != nil {
+		fmt.Printf("bench run error: %v\n", err)
+		return
+	}
+	fmt.Printf("workload %s: %s", w.Name, result)
+}
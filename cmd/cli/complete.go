@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+)
+
+// maxKeyCompletions caps how many key suggestions a single tab press returns.
+const maxKeyCompletions = 20
+
+// completer dispatches tab completion: file paths for inspect/dump, keys for
+// get/delete/scan.
+func completer(engine *db.DB, line string) []string {
+	if matches := fileCompleter(engine, line); matches != nil {
+		return matches
+	}
+	return keyCompleter(engine, line)
+}
+
+// keyCompleter completes the key argument of get and delete, and the start
+// key of scan.
+// Candidates are sampled rather than enumerated: every memtable key plus the
+// first key of each SSTable block and each table's smallest/largest key. That
+// keeps a tab press cheap on large databases while still covering every block.
+func keyCompleter(engine *db.DB, line string) []string {
+	var prefix string
+	for _, cmd := range []string{"get ", "delete ", "scan "} {
+		if strings.HasPrefix(line, cmd) {
+			prefix = cmd
+			break
+		}
+	}
+	if prefix == "" || engine == nil {
+		return nil
+	}
+
+	partial := strings.TrimPrefix(line, prefix)
+	if strings.Contains(partial, " ") {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	add := func(key []byte) {
+		if strings.HasPrefix(string(key), partial) {
+			seen[string(key)] = struct{}{}
+		}
+	}
+
+	iter := engine.Memtable().Iterator()
+	for {
+		entry, err := iter.Next()
+		if err != nil || entry == nil {
+			break
+		}
+		if entry.Type == common.EntryTypePut {
+			add(entry.Key)
+		}
+	}
+
+	version := engine.Manifest().Current()
+	for level, fileMetas := range version.Levels {
+		for _, fm := range fileMetas {
+			add(fm.SmallestKey)
+			add(fm.LargestKey)
+
+			table, err := engine.Manifest().GetTable(fm.FileNo, level)
+			if err != nil {
+				continue
+			}
+			for _, indexEntry := range table.GetIndex().Entries {
+				add(indexEntry.Key)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxKeyCompletions {
+		keys = keys[:maxKeyCompletions]
+	}
+
+	matches := make([]string, len(keys))
+	for i, key := range keys {
+		matches[i] = prefix + key
+	}
+	return matches
+}
@@ -8,10 +8,11 @@ import (
 	"amethyst/internal/common"
 	"amethyst/internal/db"
 	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
 	"amethyst/internal/wal"
 )
 
-func dumpIterator(iter common.EntryIterator) {
+func dumpIterator(iter common.EntryIterator, p *pager) {
 	// Print header
 	fmt.Printf("%-6s %-8s %-20s  %s\n", "OP", "SEQ", "KEY", "VALUE")
 	fmt.Println()
@@ -26,11 +27,18 @@ func dumpIterator(iter common.EntryIterator) {
 		if entry == nil {
 			break
 		}
+		if !p.next() {
+			fmt.Println("(aborted)")
+			break
+		}
 
 		count++
 		typeStr := "PUT"
-		if entry.Type == common.EntryTypeDelete {
+		switch entry.Type {
+		case common.EntryTypeDelete:
 			typeStr = "DEL"
+		case common.EntryTypeBlobRef:
+			typeStr = "BLOB"
 		}
 
 		// Truncate key if longer than 20 chars
@@ -51,17 +59,17 @@ func dumpIterator(iter common.EntryIterator) {
 	fmt.Printf("Total entries: %d\n", count)
 }
 
-func dumpMemtable(engine *db.DB) {
+func dumpMemtable(engine *db.DB, p *pager) {
 	fmt.Println("Dumping Memtable")
 	fmt.Println()
-	dumpIterator(engine.Memtable().Iterator())
+	dumpIterator(engine.Memtable().Iterator(), p)
 }
 
-func dumpWAL(path string) {
+func dumpWAL(path string, p *pager) {
 	fmt.Printf("Dumping WAL: %s\n", path)
 	fmt.Println()
 
-	w, err := wal.OpenWAL(path)
+	w, err := wal.OpenWALReadOnly(vfs.Default, path)
 	if err != nil {
 		fmt.Printf("failed to open WAL: %v\n", err)
 		return
@@ -74,10 +82,10 @@ func dumpWAL(path string) {
 		return
 	}
 
-	dumpIterator(iter)
+	dumpIterator(iter, p)
 }
 
-func dumpSSTable(path string) {
+func dumpSSTable(path string, p *pager) {
 	fmt.Printf("Dumping SSTable: %s\n", path)
 	fmt.Println()
 
@@ -90,37 +98,40 @@ func dumpSSTable(path string) {
 		return
 	}
 
-	table, err := sstable.OpenSSTable(path, fileNo, nil)
+	table, err := sstable.OpenSSTable(vfs.Default, path, fileNo, nil)
 	if err != nil {
 		fmt.Printf("failed to open SSTable: %v\n", err)
 		return
 	}
 	defer table.Close()
 
-	dumpIterator(table.Iterator())
+	dumpIterator(table.Iterator(), p)
 }
 
-func dumpFile(path string) {
+func dumpFile(path string, p *pager) {
 	ext := strings.ToLower(filepath.Ext(path))
 
 	switch ext {
 	case ".log":
-		dumpWAL(path)
+		dumpWAL(path, p)
 	case ".sst":
-		dumpSSTable(path)
+		dumpSSTable(path, p)
 	default:
 		fmt.Printf("unknown file type: %s (expected .log or .sst)\n", ext)
 	}
 }
 
-func dump(parts []string, engine *db.DB) {
-	if len(parts) != 2 {
-		fmt.Println("usage: dump <memtable|file.log|file.sst>")
+func dump(parts []string, engine *db.DB, prompt func(string) (string, error)) {
+	pageSize, args, err := parsePageFlag(parts[1:])
+	if err != nil || len(args) != 1 {
+		fmt.Println("usage: dump [--page N] <memtable|file.log|file.sst>")
 		return
 	}
-	if parts[1] == "memtable" {
-		dumpMemtable(engine)
+
+	p := &pager{pageSize: pageSize, prompt: prompt}
+	if args[0] == "memtable" {
+		dumpMemtable(engine, p)
 	} else {
-		dumpFile(parts[1])
+		dumpFile(args[0], p)
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"amethyst/internal/sstable"
+)
+
+// printSizeHistogram renders h as one bar per bucket from the smallest to
+// the largest non-empty one, scaled to the fullest bucket.
+// Example output:
+//
+//	Value sizes (1200 entries):
+//	     64..127    ########## 800
+//	    128..255    #####      400
+func printSizeHistogram(title string, h sstable.SizeHistogram) {
+	const barWidth = 10
+
+	fmt.Printf("%s (%d entries):\n", title, h.Count())
+	first, peak := -1, uint32(0)
+	for i, n := range h {
+		if n > 0 && first < 0 {
+			first = i
+		}
+		peak = max(peak, n)
+	}
+	if first < 0 {
+		fmt.Println("  (none recorded)")
+		return
+	}
+
+	for i := first; i < len(h); i++ {
+		lo, hi := sstable.BucketBounds(i)
+		bar := strings.Repeat("#", int(h[i]*barWidth/peak))
+		if h[i] > 0 && bar == "" {
+			bar = "#"
+		}
+		fmt.Printf("  %12s  %-*s %d\n", fmt.Sprintf("%d..%d", lo, hi), barWidth, bar, h[i])
+	}
+}
@@ -5,16 +5,18 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"amethyst/internal/common"
 	"amethyst/internal/db"
+	"amethyst/internal/manifest"
 	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
 	"amethyst/internal/wal"
 )
 
 // fileCompleter provides tab completion for inspect and dump commands
-// This is the global completer for liner
-// Runs on every tab press, using ReadDir for performance
+// Called from completer on every tab press, using ReadDir for performance
 func fileCompleter(engine *db.DB, line string) []string {
 	var prefix, partial string
 
@@ -36,11 +38,14 @@ func fileCompleter(engine *db.DB, line string) []string {
 	paths := engine.Paths()
 	var matches []string
 
-	// Case 1: Starting completion - suggest memtable and top-level directories
+	// Case 1: Starting completion - suggest memtable, MANIFEST and top-level directories
 	if partial == "" || !strings.Contains(partial, "/") {
 		if strings.HasPrefix("memtable", partial) {
 			matches = append(matches, prefix+"memtable")
 		}
+		if prefix == "inspect " && strings.HasPrefix("MANIFEST", partial) {
+			matches = append(matches, prefix+"MANIFEST")
+		}
 		if strings.HasPrefix("wal/", partial) {
 			matches = append(matches, prefix+"wal/")
 		}
@@ -112,6 +117,11 @@ func fileCompleter(engine *db.DB, line string) []string {
 }
 
 func inspectFile(path string) {
+	if filepath.Base(path) == "MANIFEST" {
+		inspectManifest(path)
+		return
+	}
+
 	ext := strings.ToLower(filepath.Ext(path))
 
 	switch ext {
@@ -120,15 +130,67 @@ func inspectFile(path string) {
 	case ".sst":
 		inspectSSTable(path)
 	default:
-		fmt.Printf("unknown file type: %s (expected .log or .sst)\n", ext)
+		fmt.Printf("unknown file type: %s (expected MANIFEST, .log or .sst)\n", ext)
 	}
 }
 
+func inspectManifest(path string) {
+	fmt.Printf("Inspecting MANIFEST: %s\n", path)
+	fmt.Println()
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("failed to open MANIFEST: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	version, err := manifest.ReadManifest(f)
+	if err != nil {
+		fmt.Printf("failed to decode MANIFEST: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Current WAL: %d.log\n", version.CurrentWAL)
+	fmt.Printf("Next WAL number: %d\n", version.NextWALNumber)
+	fmt.Printf("Next SSTable number: %d\n", version.NextSSTableNumber)
+	fmt.Println()
+
+	for level, fileMetas := range version.Levels {
+		if len(fileMetas) == 0 {
+			fmt.Printf("L%d: (empty)\n", level)
+			continue
+		}
+
+		var totalSize uint64
+		for _, fm := range fileMetas {
+			totalSize += fm.Size
+		}
+		fmt.Printf("L%d: %d files, %d bytes\n", level, len(fileMetas), totalSize)
+		for _, fm := range fileMetas {
+			fmt.Printf("  %-10s %8d bytes  [%q .. %q]\n", fmt.Sprintf("%d.sst", fm.FileNo), fm.Size, fm.SmallestKey, fm.LargestKey)
+		}
+	}
+	fmt.Println()
+
+	// Size distributions across every table that recorded them
+	var keySizes, valueSizes sstable.SizeHistogram
+	for _, fileMetas := range version.Levels {
+		for _, fm := range fileMetas {
+			keySizes.Merge(fm.KeySizes)
+			valueSizes.Merge(fm.ValueSizes)
+		}
+	}
+	printSizeHistogram("Key sizes", keySizes)
+	printSizeHistogram("Value sizes", valueSizes)
+	fmt.Println()
+}
+
 func inspectWAL(path string) {
 	fmt.Printf("Inspecting WAL: %s\n", path)
 	fmt.Println()
 
-	w, err := wal.OpenWAL(path)
+	w, err := wal.OpenWALReadOnly(vfs.Default, path)
 	if err != nil {
 		fmt.Printf("failed to open WAL: %v\n", err)
 		return
@@ -152,7 +214,7 @@ func inspectSSTable(path string) {
 		return
 	}
 
-	table, err := sstable.OpenSSTable(path, fileNo, nil)
+	table, err := sstable.OpenSSTable(vfs.Default, path, fileNo, nil)
 	if err != nil {
 		fmt.Printf("failed to open SSTable: %v\n", err)
 		return
@@ -164,6 +226,12 @@ func inspectSSTable(path string) {
 
 	fmt.Printf("Total blocks: %d\n", len(index.Entries))
 	fmt.Printf("Total entries: %d\n", entryCount)
+	if props := table.Properties(); props != nil {
+		fmt.Printf("Tombstones: %d (%d range deletions)\n", props.TombstoneCount, props.RangeDelCount)
+		fmt.Printf("Data size: %d bytes (%d uncompressed, %s)\n", props.DataSize, props.RawDataSize, props.CodecName())
+		fmt.Printf("Seq range: %d .. %d\n", props.MinSeq, props.MaxSeq)
+		fmt.Printf("Created: %s\n", time.Unix(0, props.CreatedAt).Format(time.RFC3339))
+	}
 	fmt.Println("Index entries:")
 
 	for i, entry := range index.Entries {
@@ -316,11 +384,13 @@ func inspect(parts []string, engine *db.DB) {
 	}
 
 	if len(parts) != 2 {
-		fmt.Println("usage: inspect [memtable|file.log|file.sst]")
+		fmt.Println("usage: inspect [--history|memtable|MANIFEST|file.log|file.sst]")
 		return
 	}
 
-	if parts[1] == "memtable" {
+	if parts[1] == "--history" {
+		inspectHistory(engine)
+	} else if parts[1] == "memtable" {
 		inspectMemtable(engine)
 	} else {
 		// Try path as-is first, then try with basePath prepended
@@ -331,3 +401,74 @@ func inspect(parts []string, engine *db.DB) {
 		inspectFile(path)
 	}
 }
+
+// inspectHistory renders the SHAPE_HISTORY sidecar as a timeline, one row per
+// flush or compaction. Each level column is a bar scaled to that level's
+// largest file count across the history, followed by files and bytes.
+// Example output:
+//
+//	TIME          EVENT       L0                    L1
+//	12:00:01.120  flush       #####      1/2.8K     .          0/0
+//	12:00:01.480  compaction  .          0/0        ########## 3/8.4K
+func inspectHistory(engine *db.DB) {
+	const barWidth = 10
+
+	records, err := db.ReadShapeHistory(engine.FS(), engine.Paths().ShapeHistoryPath())
+	if err != nil {
+		fmt.Printf("failed to read shape history: %v\n", err)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("no shape history recorded yet")
+		return
+	}
+
+	numLevels := 0
+	for _, record := range records {
+		numLevels = max(numLevels, len(record.Levels))
+	}
+	maxFiles := make([]int, numLevels)
+	for _, record := range records {
+		for level, shape := range record.Levels {
+			maxFiles[level] = max(maxFiles[level], shape.Files)
+		}
+	}
+
+	fmt.Printf("%-13s %-11s", "TIME", "EVENT")
+	for level := 0; level < numLevels; level++ {
+		fmt.Printf(" %-21s", fmt.Sprintf("L%d", level))
+	}
+	fmt.Println()
+
+	for _, record := range records {
+		fmt.Printf("%-13s %-11s", record.Time.Format("15:04:05.000"), record.Event)
+		for level := 0; level < numLevels; level++ {
+			var shape db.LevelShape
+			if level < len(record.Levels) {
+				shape = record.Levels[level]
+			}
+
+			bar := "."
+			if shape.Files > 0 {
+				bar = strings.Repeat("#", max(1, shape.Files*barWidth/maxFiles[level]))
+			}
+			fmt.Printf(" %-*s %-10s", barWidth, bar, fmt.Sprintf("%d/%s", shape.Files, humanBytes(shape.Bytes)))
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+}
+
+// humanBytes formats n compactly, e.g. 512, 2.8K, 1.5M.
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
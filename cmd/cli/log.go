@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"amethyst/internal/common"
+)
+
+// switchLogger passes records on to its Logger while enabled.
+type switchLogger struct {
+	common.Logger
+	enabled atomic.Bool
+}
+
+func (l *switchLogger) Log(level common.Level, msg string, kv ...any) {
+	if l.enabled.Load() {
+		l.Logger.Log(level, msg, kv...)
+	}
+}
+
+func (l *switchLogger) Enabled(level common.Level) bool {
+	return l.enabled.Load() && l.Logger.Enabled(level)
+}
+
+// logger shows the engine's records, lookup traces included, once startup
+// is done.
+var logger = &switchLogger{Logger: common.NewTextLogger(os.Stdout, common.LevelDebug)}
+
+// logDuration prints a message with the elapsed time since start while the
+// logger is enabled. The duration is formatted with tight parens and
+// right-padded to align messages.
+func logDuration(start time.Time, format string, args ...interface{}) {
+	if !logger.enabled.Load() {
+		return
+	}
+	durStr := fmt.Sprintf("(%s)", common.FormatDuration(time.Since(start)))
+	fmt.Printf("%-10s%s\n", durStr, fmt.Sprintf(format, args...))
+}
@@ -4,11 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"amethyst/internal/common"
 	"amethyst/internal/db"
 
 	"github.com/peterh/liner"
@@ -24,10 +22,15 @@ func printHelp() {
 	fmt.Println("  put     <key> <value> - write a key-value pair")
 	fmt.Println("  get     <key>         - read a value")
 	fmt.Println("  delete  <key>         - delete a key")
+	fmt.Println("  scan    <start> <end> [limit] - print pairs in [start, end) (default limit 100, 0 = all)")
 	fmt.Println("")
-	fmt.Println("  seed    <x>                          - load 26*x fruit/vegetable pairs")
-	fmt.Println("  inspect [memtable|file.log|file.sst] - inspect table")
-	fmt.Println("  dump    [memtable|file.log|file.sst] - dump table")
+	fmt.Println("  seed    [--count N] [--key-size K] [--value-size V] [--distribution zipf|uniform|sequential]")
+	fmt.Println("                                                  - load generated pairs (default 1000 sequential)")
+	fmt.Println("  bench   <A-F> [ops] [records]                   - run a YCSB workload")
+	fmt.Println("  inspect [memtable|MANIFEST|file.log|file.sst]   - inspect table or manifest")
+	fmt.Println("  inspect --history                               - timeline of level shapes")
+	fmt.Println("  dump    [--page N] <memtable|file.log|file.sst> - dump table, pausing every N rows (0 = off)")
+	fmt.Println("  verify                                          - check every table and WAL for damage")
 	fmt.Println("")
 	fmt.Println("  clear      - clear and reset the database")
 	fmt.Println("  help       - show this help")
@@ -50,7 +53,7 @@ func clearDatabase(ctx *cmdContext) error {
 	}
 
 	// Reopen engine (will recreate everything)
-	newEngine, err := db.Open(db.WithDBPath(dbPath))
+	newEngine, err := db.Open(db.WithDBPath(dbPath), db.WithShapeHistory(), db.WithLogger(logger))
 	if err != nil {
 		return fmt.Errorf("failed to reopen database: %w", err)
 	}
@@ -63,17 +66,19 @@ func clearDatabase(ctx *cmdContext) error {
 }
 
 func main() {
-	// Disable logging initially to prevent noise during startup
-	common.LoggingEnabled = false
-
 	// Get database path from command line args
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s <db-path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "usage: %s <db-path> [admin <command> [args...]]\n", os.Args[0])
 		os.Exit(1)
 	}
 	dbPath := os.Args[1]
 
-	engine, err := db.Open(db.WithDBPath(dbPath))
+	// Offline mode: answer one read-only query and exit
+	if len(os.Args) > 2 && os.Args[2] == "admin" {
+		os.Exit(runAdmin(dbPath, os.Args[3:]))
+	}
+
+	engine, err := db.Open(db.WithDBPath(dbPath), db.WithShapeHistory(), db.WithLogger(logger))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
 		os.Exit(1)
@@ -82,8 +87,8 @@ func main() {
 	// Load seed index from file
 	seedIndex := loadSeedIndex(engine.Paths())
 
-	// Enable logging after startup
-	common.LoggingEnabled = true
+	// Enable logging after startup, which would otherwise be noisy
+	logger.enabled.Store(true)
 
 	fmt.Println("adb - amethyst database")
 	fmt.Printf("config: memtable_flush_threshold=%d max_levels=%d\n", engine.Opts.MemtableFlushThreshold, engine.Opts.MaxSSTableLevel)
@@ -102,7 +107,7 @@ func main() {
 
 	line.SetCtrlCAborts(false)
 	line.SetCompleter(func(line string) []string {
-		return fileCompleter(engine, line)
+		return completer(ctx.engine, line)
 	})
 
 	// Load history from file
@@ -152,7 +157,7 @@ func main() {
 				fmt.Printf("put error: %v\n", err)
 				continue
 			}
-			common.LogDuration(start, "put key=%q", parts[1])
+			logDuration(start, "put key=%q", parts[1])
 			fmt.Println("ok")
 		case "get":
 			if len(parts) != 2 {
@@ -162,11 +167,11 @@ func main() {
 			start := time.Now()
 			value, err := ctx.engine.Get([]byte(parts[1]))
 			if err != nil {
-				common.LogDuration(start, "get key=%q", parts[1])
+				logDuration(start, "get key=%q", parts[1])
 				fmt.Printf("get error: %v\n", err)
 				continue
 			}
-			common.LogDuration(start, "get key=%q", parts[1])
+			logDuration(start, "get key=%q", parts[1])
 			fmt.Printf("%s\n", string(value))
 		case "delete":
 			if len(parts) != 2 {
@@ -178,23 +183,26 @@ func main() {
 				fmt.Printf("delete error: %v\n", err)
 				continue
 			}
-			common.LogDuration(start, "delete key=%q", parts[1])
+			logDuration(start, "delete key=%q", parts[1])
 			fmt.Println("ok")
+		case "scan":
+			scan(parts, ctx.engine)
 		case "seed":
-			if len(parts) != 2 {
-				fmt.Println("usage: seed <x>")
-				continue
-			}
-			x, err := strconv.Atoi(parts[1])
-			if err != nil || x < 1 {
-				fmt.Println("seed: x must be a positive integer")
+			cfg, err := parseSeedArgs(parts[1:])
+			if err != nil {
+				fmt.Printf("seed: %v\n", err)
+				fmt.Println("usage: seed [--count N] [--key-size K] [--value-size V] [--distribution zipf|uniform|sequential]")
 				continue
 			}
-			runSeed(ctx.engine, x, &ctx.seedIndex)
+			runSeed(ctx.engine, cfg, &ctx.seedIndex)
+		case "bench":
+			runBench(parts, ctx.engine)
 		case "inspect":
 			inspect(parts, ctx.engine)
 		case "dump":
-			dump(parts, ctx.engine)
+			dump(parts, ctx.engine, line.Prompt)
+		case "verify":
+			verify(ctx.engine)
 		case "clear":
 			if err := clearDatabase(ctx); err != nil {
 				fmt.Printf("clear error: %v\n", err)
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultPageSize is how many rows dump prints before pausing.
+const defaultPageSize = 100
+
+// pager pauses long listings every pageSize rows and asks whether to go on.
+// A pageSize of 0 disables paging.
+type pager struct {
+	pageSize int
+	prompt   func(string) (string, error)
+	rows     int
+}
+
+// next is called before printing each row. It returns false once the user
+// aborts (or input fails), after which the caller should stop printing.
+func (p *pager) next() bool {
+	if p == nil || p.pageSize <= 0 || p.prompt == nil {
+		return true
+	}
+	if p.rows > 0 && p.rows%p.pageSize == 0 {
+		answer, err := p.prompt("-- more (enter to continue, q to quit) -- ")
+		if err != nil || strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "q") {
+			return false
+		}
+	}
+	p.rows++
+	return true
+}
+
+// parsePageFlag strips a leading "--page N" from args, returning the page size
+// (defaultPageSize when absent) and the remaining arguments.
+func parsePageFlag(args []string) (int, []string, error) {
+	if len(args) == 0 || args[0] != "--page" {
+		return defaultPageSize, args, nil
+	}
+	if len(args) < 2 {
+		return 0, nil, fmt.Errorf("--page requires a row count")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return 0, nil, fmt.Errorf("--page must be a non-negative integer")
+	}
+	return n, args[2:], nil
+}
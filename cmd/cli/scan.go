@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"amethyst/internal/db"
+)
+
+// defaultScanLimit is how many pairs scan prints without a limit.
+const defaultScanLimit = 100
+
+// scan prints the live pairs with keys in [start, end), in key order, up to
+// limit of them; limit 0 prints the whole range.
+func scan(parts []string, engine *db.DB) {
+	if len(parts) < 3 || len(parts) > 4 {
+		fmt.Println("usage: scan <start> <end> [limit]")
+		return
+	}
+	start, end := []byte(parts[1]), []byte(parts[2])
+	if bytes.Compare(start, end) >= 0 {
+		fmt.Println("scan: start must sort before end")
+		return
+	}
+	limit := defaultScanLimit
+	if len(parts) == 4 {
+		n, err := strconv.Atoi(parts[3])
+		if err != nil || n < 0 {
+			fmt.Println("scan: limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	begin := time.Now()
+	opts := db.DefaultReadOptions
+	opts.LowerBound, opts.UpperBound = start, end
+	iter, err := engine.NewIteratorWithOptions(opts)
+	if err != nil {
+		fmt.Printf("scan error: %v\n", err)
+		return
+	}
+	defer iter.Close()
+
+	fmt.Printf("%-20s  %s\n", "KEY", "VALUE")
+	fmt.Println()
+	count := 0
+	for limit == 0 || count < limit {
+		entry, err := iter.Next()
+		if err != nil {
+			fmt.Printf("scan error: %v\n", err)
+			return
+		}
+		if entry == nil {
+			break
+		}
+		fmt.Printf("%-20s  %s\n", string(entry.Key), string(entry.Value))
+		count++
+	}
+	logDuration(begin, "scan start=%q end=%q", parts[1], parts[2])
+	fmt.Println()
+	fmt.Printf("Total entries: %d\n", count)
+}
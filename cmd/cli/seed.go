@@ -1,12 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"amethyst/internal/bench"
 	"amethyst/internal/common"
 	"amethyst/internal/db"
 	"golang.org/x/sync/errgroup"
@@ -28,52 +32,81 @@ func saveSeedIndex(paths *common.PathManager, idx int) error {
 	return os.WriteFile(paths.SeedIndexPath(), []byte(fmt.Sprint(idx)), 0644)
 }
 
-var kvPairs = [][2]string{
-	{"apple", "artichoke"},
-	{"banana", "broccoli"},
-	{"cherry", "cabbage"},
-	{"durian", "daikon"},
-	{"elderberry", "eggplant"},
-	{"fig", "fennel"},
-	{"grapefruit", "ginger"},
-	{"honeydew", "horseradish"},
-	{"imbe", "ivygourd"},
-	{"jackfruit", "jicama"},
-	{"kiwi", "kale"},
-	{"lime", "leek"},
-	{"mango", "mushroom"},
-	{"nectarine", "nopale"},
-	{"orange", "okra"},
-	{"peach", "peas"},
-	{"quince", "quinoa"},
-	{"raspberry", "radish"},
-	{"strawberry", "spinach"},
-	{"tangerine", "tomato"},
-	{"ugni", "ube"},
-	{"voavanga", "vanilla"},
-	{"watermelon", "watercress"},
-	{"ximenia", "xanthan"},
-	{"yuzu", "yam"},
-	{"zarzamora", "zucchini"},
+// seedConfig describes the dataset a seed command generates.
+type seedConfig struct {
+	count        int
+	keySize      int
+	valueSize    int
+	distribution bench.Distribution
 }
 
-func runSeed(engine *db.DB, x int, seedIndex *int) {
+func parseSeedArgs(args []string) (*seedConfig, error) {
+	cfg := &seedConfig{}
+	var distribution string
+
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.IntVar(&cfg.count, "count", 1000, "number of writes")
+	fs.IntVar(&cfg.keySize, "key-size", 16, "key length in bytes")
+	fs.IntVar(&cfg.valueSize, "value-size", 100, "value length in bytes")
+	fs.StringVar(&distribution, "distribution", "sequential", "zipf|uniform|sequential")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if cfg.count < 1 || cfg.keySize < 1 || cfg.valueSize < 0 {
+		return nil, fmt.Errorf("count and key-size must be positive, value-size non-negative")
+	}
+	d, err := bench.ParseDistribution(distribution)
+	if err != nil {
+		return nil, err
+	}
+	cfg.distribution = d
+	return cfg, nil
+}
+
+// seedKey renders item i as a zero-padded key of exactly keySize bytes, or
+// longer if i needs more digits.
+func seedKey(i, keySize int) []byte {
+	return []byte(fmt.Sprintf("%0*d", keySize, i))
+}
+
+// runSeed writes cfg.count generated pairs.
+// Sequential seeding writes fresh items starting at seedIndex, so repeated
+// seeds keep growing the dataset. Zipfian and uniform seeding draw items from
+// everything written so far plus the new items, producing overwrites (hot
+// keys, for zipf) the way a real workload would.
+func runSeed(engine *db.DB, cfg *seedConfig, seedIndex *int) {
 	start := time.Now()
 	startIndex := *seedIndex
+	keyspace := uint64(*seedIndex + cfg.count)
+
+	r := rand.New(rand.NewSource(start.UnixNano()))
+	chooser := bench.NewKeyChooser(cfg.distribution, r)
+
+	keys := make([][]byte, cfg.count)
+	for i := range keys {
+		item := *seedIndex + i
+		if cfg.distribution != bench.Sequential {
+			item = int(chooser.Next(keyspace))
+		}
+		keys[i] = seedKey(item, cfg.keySize)
+	}
 
-	// Write concurrently with 26 goroutines (one per key pair)
-	// to leverage group commit batching
+	// Write concurrently to leverage group commit batching
 	var g errgroup.Group
-	for i := 0; i < x; i++ {
-		currentIndex := *seedIndex + i
-		for _, pair := range kvPairs {
-			pair := pair // capture loop variable
-			g.Go(func() error {
-				key := fmt.Sprintf("%s%d", pair[0], currentIndex)
-				value := fmt.Sprintf("%s%d", pair[1], currentIndex)
-				return engine.Put([]byte(key), []byte(value))
-			})
+	g.SetLimit(max(engine.Opts.MaxBatchSize, 1))
+	for _, key := range keys {
+		value := make([]byte, cfg.valueSize)
+		for j := range value {
+			value[j] = 'a' + byte(r.Intn(26))
 		}
+		g.Go(func() error {
+			return engine.Put(key, value)
+		})
 	}
 
 	// Wait for all writes to complete
@@ -82,15 +115,14 @@ func runSeed(engine *db.DB, x int, seedIndex *int) {
 		return
 	}
 
-	*seedIndex += x
-	count := 26 * x
+	*seedIndex += cfg.count
 
 	// Persist seed index to file
 	if err := saveSeedIndex(engine.Paths(), *seedIndex); err != nil {
 		fmt.Printf("warning: failed to persist seed index: %v\n", err)
 	}
 
-	avgPerEntry := time.Since(start) / time.Duration(count)
-	common.LogDuration(start, "  seeded %d entries (26 * %d, index %d-%d) - %v/entry",
-		count, x, startIndex, *seedIndex-1, avgPerEntry)
+	avgPerEntry := time.Since(start) / time.Duration(cfg.count)
+	logDuration(start, "  seeded %d entries (%s, index %d-%d) - %v/entry",
+		cfg.count, cfg.distribution, startIndex, *seedIndex-1, avgPerEntry)
 }
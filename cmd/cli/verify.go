@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"amethyst/internal/db"
+)
+
+// verify checks every table and WAL the manifest references and prints each
+// problem found followed by a summary. Returns the number of problems.
+func verify(engine *db.DB) int {
+	version := engine.Manifest().Current()
+	tables := 0
+	for _, fileMetas := range version.Levels {
+		tables += len(fileMetas)
+	}
+	wals := len(version.LiveWALs())
+
+	start := time.Now()
+	problems := engine.VerifyChecksums()
+	logDuration(start, "verify")
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("checked %d tables and %d WALs: %d problems\n", tables, wals, len(problems))
+	return len(problems)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"amethyst/internal/db"
+	"amethyst/internal/sstable"
+	"amethyst/pkg/kvpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// service implements the KV service on top of a database. Most database
+// calls don't take a context, so deadlines and cancellation are checked
+// before each of them and between the entries a Scan streams; a call that
+// has started runs to completion. Batch hands its context to the write.
+type service struct {
+	kvpb.UnimplementedKVServer
+	engine *db.DB
+}
+
+func (s *service) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, rpcError(err)
+	}
+	value, err := s.engine.Get(req.Key)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &kvpb.GetResponse{Value: value}, nil
+}
+
+func (s *service) Put(ctx context.Context, req *kvpb.PutRequest) (*kvpb.PutResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, rpcError(err)
+	}
+	if err := s.put(req); err != nil {
+		return nil, rpcError(err)
+	}
+	return &kvpb.PutResponse{}, nil
+}
+
+func (s *service) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if err := checkKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, rpcError(err)
+	}
+	if err := s.engine.Delete(req.Key); err != nil {
+		return nil, rpcError(err)
+	}
+	return &kvpb.DeleteResponse{}, nil
+}
+
+func (s *service) Scan(req *kvpb.ScanRequest, stream grpc.ServerStreamingServer[kvpb.ScanResponse]) error {
+	if len(req.End) > 0 && bytes.Compare(req.Start, req.End) >= 0 {
+		return status.Error(codes.InvalidArgument, "scan start must sort before its end")
+	}
+	ctx := stream.Context()
+	if err := ctx.Err(); err != nil {
+		return rpcError(err)
+	}
+
+	opts := db.DefaultReadOptions
+	opts.LowerBound = req.Start
+	if len(req.End) > 0 {
+		opts.UpperBound = req.End
+	}
+	iter, err := s.engine.NewIteratorWithOptions(opts)
+	if err != nil {
+		return rpcError(err)
+	}
+	defer iter.Close()
+
+	sent := uint32(0)
+	for req.Limit == 0 || sent < req.Limit {
+		if err := ctx.Err(); err != nil {
+			return rpcError(err)
+		}
+		entry, err := iter.Next()
+		if err != nil {
+			return rpcError(err)
+		}
+		if entry == nil {
+			break
+		}
+		if err := stream.Send(&kvpb.ScanResponse{Key: entry.Key, Value: entry.Value}); err != nil {
+			return err
+		}
+		sent++
+	}
+	return nil
+}
+
+// Batch commits the mutations as one WriteBatch, after checking them all,
+// so a malformed batch fails without changing anything.
+func (s *service) Batch(ctx context.Context, req *kvpb.BatchRequest) (*kvpb.BatchResponse, error) {
+	var batch db.WriteBatch
+	for i, m := range req.Mutations {
+		switch op := m.Op.(type) {
+		case *kvpb.Mutation_Put:
+			if err := checkMutationKey(i, op.Put.GetKey()); err != nil {
+				return nil, err
+			}
+			if op.Put.TtlMs > 0 {
+				batch.PutWithTTL(op.Put.Key, op.Put.Value, time.Duration(op.Put.TtlMs)*time.Millisecond)
+			} else {
+				batch.Put(op.Put.Key, op.Put.Value)
+			}
+		case *kvpb.Mutation_Delete:
+			if err := checkMutationKey(i, op.Delete.GetKey()); err != nil {
+				return nil, err
+			}
+			batch.Delete(op.Delete.Key)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "mutation %d has no operation", i)
+		}
+	}
+
+	if err := s.engine.WriteContext(ctx, &batch); err != nil {
+		return nil, rpcError(err)
+	}
+	return &kvpb.BatchResponse{}, nil
+}
+
+// put writes req, with an expiry if it has a TTL.
+func (s *service) put(req *kvpb.PutRequest) error {
+	if req.TtlMs > 0 {
+		return s.engine.PutWithTTL(req.Key, req.Value, time.Duration(req.TtlMs)*time.Millisecond)
+	}
+	return s.engine.Put(req.Key, req.Value)
+}
+
+func checkKey(key []byte) error {
+	if len(key) == 0 {
+		return status.Error(codes.InvalidArgument, "key must not be empty")
+	}
+	return nil
+}
+
+func checkMutationKey(i int, key []byte) error {
+	if len(key) == 0 {
+		return status.Errorf(codes.InvalidArgument, "mutation %d has an empty key", i)
+	}
+	return nil
+}
+
+// rpcError maps a database or context error to the gRPC status a client can
+// act on; anything unrecognized is INTERNAL.
+func rpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, db.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, db.ErrReadOnly):
+		code = codes.FailedPrecondition
+	case errors.Is(err, db.ErrCorruption), errors.Is(err, sstable.ErrCorruption):
+		code = codes.DataLoss
+	}
+	return status.Error(code, err.Error())
+}
+
+// defaultDeadline gives calls that arrive without a deadline one of timeout,
+// so a stuck client can't hold a scan's snapshot open forever.
+func defaultDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func unaryDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := defaultDeadline(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+func streamDeadline(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := defaultDeadline(ss.Context(), timeout)
+		defer cancel()
+		return handler(srv, &deadlineStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// deadlineStream is a ServerStream whose context carries the default
+// deadline.
+type deadlineStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *deadlineStream) Context() context.Context {
+	return s.ctx
+}
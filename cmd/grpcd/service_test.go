@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/pkg/kvpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newClient serves engine over an in-memory listener, with the interceptors
+// main installs, and returns a client connected to it.
+func newClient(t *testing.T, engine *db.DB) kvpb.KVClient {
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryDeadline(time.Minute)),
+		grpc.StreamInterceptor(streamDeadline(time.Minute)),
+	)
+	kvpb.RegisterKVServer(srv, &service{engine: engine})
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return kvpb.NewKVClient(conn)
+}
+
+func openEngine(t *testing.T, opts ...db.Option) *db.DB {
+	engine, err := db.Open(append([]db.Option{db.WithDBPath(t.TempDir()), db.WithLogger(common.DiscardLogger)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// get returns the value of key, or the status code the call failed with.
+func get(t *testing.T, c kvpb.KVClient, key string) (string, codes.Code) {
+	t.Helper()
+	resp, err := c.Get(context.Background(), &kvpb.GetRequest{Key: []byte(key)})
+	if err != nil {
+		return "", status.Code(err)
+	}
+	return string(resp.Value), codes.OK
+}
+
+func TestGetPutDelete(t *testing.T) {
+	c := newClient(t, openEngine(t))
+	ctx := context.Background()
+
+	_, err := c.Put(ctx, &kvpb.PutRequest{Key: []byte("k"), Value: []byte("v")})
+	require.NoError(t, err)
+	_, err = c.Put(ctx, &kvpb.PutRequest{Key: []byte("short"), Value: []byte("v"), TtlMs: 1})
+	require.NoError(t, err)
+	_, err = c.Put(ctx, &kvpb.PutRequest{Key: []byte("long"), Value: []byte("v"), TtlMs: 60000})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	tests := []struct {
+		key   string
+		value string
+		code  codes.Code
+	}{
+		{"k", "v", codes.OK},
+		{"long", "v", codes.OK},
+		{"short", "", codes.NotFound},
+		{"missing", "", codes.NotFound},
+		{"", "", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		value, code := get(t, c, tt.key)
+		require.Equal(t, tt.code, code, tt.key)
+		require.Equal(t, tt.value, value, tt.key)
+	}
+
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: []byte("k")})
+	require.NoError(t, err)
+	_, code := get(t, c, "k")
+	require.Equal(t, codes.NotFound, code)
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: []byte("missing")})
+	require.NoError(t, err)
+
+	_, err = c.Put(ctx, &kvpb.PutRequest{Value: []byte("v")})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// A call whose deadline has passed is refused before it starts
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = c.Put(expired, &kvpb.PutRequest{Key: []byte("late"), Value: []byte("v")})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	_, code = get(t, c, "late")
+	require.Equal(t, codes.NotFound, code)
+}
+
+func TestScan(t *testing.T) {
+	engine := openEngine(t)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, engine.Put([]byte(key), []byte("v"+key)))
+	}
+	c := newClient(t, engine)
+
+	tests := []struct {
+		name string
+		req  *kvpb.ScanRequest
+		keys []string
+		code codes.Code
+	}{
+		{"everything", &kvpb.ScanRequest{}, []string{"a", "b", "c", "d", "e"}, codes.OK},
+		{"from start", &kvpb.ScanRequest{Start: []byte("c")}, []string{"c", "d", "e"}, codes.OK},
+		{"up to end", &kvpb.ScanRequest{End: []byte("c")}, []string{"a", "b"}, codes.OK},
+		{"range", &kvpb.ScanRequest{Start: []byte("bb"), End: []byte("d")}, []string{"c"}, codes.OK},
+		{"limit", &kvpb.ScanRequest{Start: []byte("b"), Limit: 2}, []string{"b", "c"}, codes.OK},
+		{"empty range", &kvpb.ScanRequest{Start: []byte("x")}, nil, codes.OK},
+		{"end before start", &kvpb.ScanRequest{Start: []byte("c"), End: []byte("b")}, nil, codes.InvalidArgument},
+		{"end at start", &kvpb.ScanRequest{Start: []byte("c"), End: []byte("c")}, nil, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := c.Scan(context.Background(), tt.req)
+			require.NoError(t, err)
+			var keys []string
+			for {
+				resp, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					require.Equal(t, tt.code, status.Code(err))
+					return
+				}
+				require.Equal(t, "v"+string(resp.Key), string(resp.Value))
+				keys = append(keys, string(resp.Key))
+			}
+			require.Equal(t, codes.OK, tt.code)
+			require.Equal(t, tt.keys, keys)
+		})
+	}
+}
+
+func put(key, value string, ttlMs uint64) *kvpb.Mutation {
+	return &kvpb.Mutation{Op: &kvpb.Mutation_Put{Put: &kvpb.PutRequest{Key: []byte(key), Value: []byte(value), TtlMs: ttlMs}}}
+}
+
+func del(key string) *kvpb.Mutation {
+	return &kvpb.Mutation{Op: &kvpb.Mutation_Delete{Delete: &kvpb.DeleteRequest{Key: []byte(key)}}}
+}
+
+func TestBatch(t *testing.T) {
+	engine := openEngine(t)
+	require.NoError(t, engine.Put([]byte("gone"), []byte("v")))
+	c := newClient(t, engine)
+	ctx := context.Background()
+
+	_, err := c.Batch(ctx, &kvpb.BatchRequest{Mutations: []*kvpb.Mutation{
+		put("a", "1", 0),
+		put("b", "1", 0),
+		put("a", "2", 0),
+		del("gone"),
+		put("short", "v", 1),
+	}})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	// Later mutations of a key win
+	expect := func(want map[string]string) {
+		t.Helper()
+		for _, key := range []string{"a", "b", "c", "gone", "short"} {
+			value, code := get(t, c, key)
+			if v, ok := want[key]; ok {
+				require.Equal(t, codes.OK, code, key)
+				require.Equal(t, v, value, key)
+			} else {
+				require.Equal(t, codes.NotFound, code, key)
+			}
+		}
+	}
+	expect(map[string]string{"a": "2", "b": "1"})
+
+	// A malformed batch is refused whole
+	tests := []struct {
+		name      string
+		mutations []*kvpb.Mutation
+	}{
+		{"empty put key", []*kvpb.Mutation{put("c", "1", 0), put("", "1", 0)}},
+		{"empty delete key", []*kvpb.Mutation{put("c", "1", 0), del("")}},
+		{"no operation", []*kvpb.Mutation{put("c", "1", 0), {}}},
+	}
+	for _, tt := range tests {
+		_, err := c.Batch(ctx, &kvpb.BatchRequest{Mutations: tt.mutations})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), tt.name)
+		expect(map[string]string{"a": "2", "b": "1"})
+	}
+
+	_, err = c.Batch(ctx, &kvpb.BatchRequest{})
+	require.NoError(t, err)
+}
+
+func TestReadOnlyService(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := db.Open(db.WithDBPath(dir), db.WithLogger(common.DiscardLogger))
+	require.NoError(t, err)
+	require.NoError(t, engine.Put([]byte("k"), []byte("v")))
+	require.NoError(t, engine.Close())
+	c := newClient(t, openEngine(t, db.WithDBPath(dir), db.WithReadOnly()))
+	ctx := context.Background()
+
+	value, code := get(t, c, "k")
+	require.Equal(t, codes.OK, code)
+	require.Equal(t, "v", value)
+	_, err = c.Put(ctx, &kvpb.PutRequest{Key: []byte("k"), Value: []byte("v2")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = c.Delete(ctx, &kvpb.DeleteRequest{Key: []byte("k")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = c.Batch(ctx, &kvpb.BatchRequest{Mutations: []*kvpb.Mutation{del("k")}})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
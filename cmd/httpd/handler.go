@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"amethyst/internal/db"
+)
+
+// defaultScanLimit is how many keys /scan returns without a limit.
+const defaultScanLimit = 100
+
+// maxValueSize bounds a PUT body so one request can't exhaust memory.
+const maxValueSize = 64 << 20
+
+// scanEntry is one key/value pair in a /scan response. Keys and values are
+// returned as strings since this is mostly read by people with curl; bytes
+// that aren't valid UTF-8 come back replaced.
+type scanEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type handler struct {
+	engine *db.DB
+}
+
+func newHandler(engine *db.DB) http.Handler {
+	h := &handler{engine: engine}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /kv/{key...}", h.get)
+	mux.HandleFunc("PUT /kv/{key...}", h.put)
+	mux.HandleFunc("DELETE /kv/{key...}", h.delete)
+	mux.HandleFunc("GET /scan", h.scan)
+	mux.HandleFunc("GET /stats", h.stats)
+	return mux
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	value, err := h.engine.Get(key)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(value)
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	var ttl time.Duration
+	if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "ttl must be a positive duration such as 30s", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read value: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if ttl > 0 {
+		err = h.engine.PutWithTTL(key, value, ttl)
+	} else {
+		err = h.engine.Put(key, value)
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	if err := h.engine.Delete(key); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) scan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, end := []byte(q.Get("start")), []byte(q.Get("end"))
+	if len(end) > 0 && bytes.Compare(start, end) >= 0 {
+		http.Error(w, "scan start must sort before its end", http.StatusBadRequest)
+		return
+	}
+	limit := defaultScanLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	opts := db.DefaultReadOptions
+	opts.LowerBound = start
+	if len(end) > 0 {
+		opts.UpperBound = end
+	}
+	iter, err := h.engine.NewIteratorWithOptions(opts)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer iter.Close()
+
+	entries := []scanEntry{}
+	for limit == 0 || len(entries) < limit {
+		if err := r.Context().Err(); err != nil {
+			return
+		}
+		entry, err := iter.Next()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		if entry == nil {
+			break
+		}
+		entries = append(entries, scanEntry{Key: string(entry.Key), Value: string(entry.Value)})
+	}
+	writeJSON(w, entries)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.engine.Stats())
+}
+
+// pathKey returns the key named by the request path, replying with an error
+// and reporting false if it is empty.
+func pathKey(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, "key must not be empty", http.StatusBadRequest)
+		return nil, false
+	}
+	return []byte(key), true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// httpError replies with the status a client can act on for a database
+// error; anything unrecognized is a 500.
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, db.ErrReadOnly):
+		code = http.StatusConflict
+	case errors.Is(err, db.ErrWriteStalled):
+		// The write queue is backed up; the client may retry later
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func openEngine(t *testing.T, opts ...db.Option) *db.DB {
+	engine, err := db.Open(append([]db.Option{db.WithDBPath(t.TempDir()), db.WithLogger(common.DiscardLogger)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// do serves one request and returns the response status and body.
+func do(t *testing.T, h http.Handler, method, target, body string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	data, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	return rec.Code, string(data)
+}
+
+func TestKV(t *testing.T) {
+	h := newHandler(openEngine(t))
+
+	tests := []struct {
+		method, target, body string
+		code                 int
+		reply                string
+	}{
+		{"GET", "/kv/k", "", http.StatusNotFound, db.ErrNotFound.Error() + "\n"},
+		{"PUT", "/kv/k", "v1", http.StatusNoContent, ""},
+		{"GET", "/kv/k", "", http.StatusOK, "v1"},
+		{"PUT", "/kv/k", "", http.StatusNoContent, ""},
+		{"GET", "/kv/k", "", http.StatusOK, ""},
+		{"PUT", "/kv/a/b%20c", "nested", http.StatusNoContent, ""},
+		{"GET", "/kv/a/b%20c", "", http.StatusOK, "nested"},
+		{"DELETE", "/kv/k", "", http.StatusNoContent, ""},
+		{"GET", "/kv/k", "", http.StatusNotFound, db.ErrNotFound.Error() + "\n"},
+		{"DELETE", "/kv/missing", "", http.StatusNoContent, ""},
+		{"GET", "/kv/", "", http.StatusBadRequest, "key must not be empty\n"},
+		{"PUT", "/kv/", "v", http.StatusBadRequest, "key must not be empty\n"},
+		{"POST", "/kv/k", "v", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		code, reply := do(t, h, tt.method, tt.target, tt.body)
+		require.Equal(t, tt.code, code, "%s %s", tt.method, tt.target)
+		if tt.code != http.StatusMethodNotAllowed {
+			require.Equal(t, tt.reply, reply, "%s %s", tt.method, tt.target)
+		}
+	}
+}
+
+func TestPutTTL(t *testing.T) {
+	h := newHandler(openEngine(t))
+
+	tests := []struct {
+		ttl  string
+		code int
+		live bool
+	}{
+		{"", http.StatusNoContent, true},
+		{"1h", http.StatusNoContent, true},
+		{"1500ms", http.StatusNoContent, true},
+		{"1ns", http.StatusNoContent, false},
+		{"0s", http.StatusBadRequest, false},
+		{"-5s", http.StatusBadRequest, false},
+		{"30", http.StatusBadRequest, false},
+		{"soon", http.StatusBadRequest, false},
+	}
+	for i, tt := range tests {
+		key := fmt.Sprintf("/kv/k%d", i)
+		code, _ := do(t, h, "PUT", key+"?ttl="+tt.ttl, "v")
+		require.Equal(t, tt.code, code, tt.ttl)
+		time.Sleep(time.Millisecond)
+		code, _ = do(t, h, "GET", key, "")
+		if tt.live {
+			require.Equal(t, http.StatusOK, code, tt.ttl)
+		} else {
+			require.Equal(t, http.StatusNotFound, code, tt.ttl)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	engine := openEngine(t)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, engine.Put([]byte(key), []byte("v"+key)))
+	}
+	h := newHandler(engine)
+
+	tests := []struct {
+		query string
+		code  int
+		keys  []string
+	}{
+		{"", http.StatusOK, []string{"a", "b", "c", "d", "e"}},
+		{"?start=c", http.StatusOK, []string{"c", "d", "e"}},
+		{"?end=c", http.StatusOK, []string{"a", "b"}},
+		{"?start=bb&end=d", http.StatusOK, []string{"c"}},
+		{"?start=b&limit=2", http.StatusOK, []string{"b", "c"}},
+		{"?limit=0", http.StatusOK, []string{"a", "b", "c", "d", "e"}},
+		{"?start=x", http.StatusOK, []string{}},
+		{"?start=c&end=b", http.StatusBadRequest, nil},
+		{"?start=c&end=c", http.StatusBadRequest, nil},
+		{"?limit=-1", http.StatusBadRequest, nil},
+		{"?limit=ten", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		code, reply := do(t, h, "GET", "/scan"+tt.query, "")
+		require.Equal(t, tt.code, code, tt.query)
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var entries []scanEntry
+		require.NoError(t, json.Unmarshal([]byte(reply), &entries), tt.query)
+		keys := []string{}
+		for _, e := range entries {
+			require.Equal(t, "v"+e.Key, e.Value)
+			keys = append(keys, e.Key)
+		}
+		require.Equal(t, tt.keys, keys, tt.query)
+	}
+}
+
+func TestScanDefaultLimit(t *testing.T) {
+	engine := openEngine(t)
+	for i := range defaultScanLimit + 1 {
+		require.NoError(t, engine.PutWithOptions([]byte(fmt.Sprintf("k%03d", i)), []byte("v"), db.WriteOptions{}))
+	}
+	code, reply := do(t, newHandler(engine), "GET", "/scan", "")
+	require.Equal(t, http.StatusOK, code)
+	var entries []scanEntry
+	require.NoError(t, json.Unmarshal([]byte(reply), &entries))
+	require.Len(t, entries, defaultScanLimit)
+}
+
+func TestHTTPError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{db.ErrNotFound, http.StatusNotFound},
+		{fmt.Errorf("get: %w", db.ErrNotFound), http.StatusNotFound},
+		{db.ErrReadOnly, http.StatusConflict},
+		{db.ErrWriteStalled, http.StatusServiceUnavailable},
+		{db.ErrCorruption, http.StatusInternalServerError},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		httpError(rec, tt.err)
+		require.Equal(t, tt.code, rec.Code, tt.err.Error())
+		require.Equal(t, tt.err.Error()+"\n", rec.Body.String())
+	}
+}
+
+func TestReadOnlyHandler(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := db.Open(db.WithDBPath(dir), db.WithLogger(common.DiscardLogger))
+	require.NoError(t, err)
+	require.NoError(t, engine.Put([]byte("k"), []byte("v")))
+	require.NoError(t, engine.Close())
+	h := newHandler(openEngine(t, db.WithDBPath(dir), db.WithReadOnly()))
+
+	code, reply := do(t, h, "GET", "/kv/k", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "v", reply)
+	code, _ = do(t, h, "PUT", "/kv/k", "v2")
+	require.Equal(t, http.StatusConflict, code)
+	code, _ = do(t, h, "DELETE", "/kv/k", "")
+	require.Equal(t, http.StatusConflict, code)
+}
@@ -0,0 +1,96 @@
+// httpd serves a database over plain HTTP, for quick integrations and for
+// poking at a database with curl.
+//
+// Usage:
+//
+//	httpd [-addr :8080] -db path
+//
+// Endpoints:
+//
+//	GET    /kv/{key}                    the key's value, or 404
+//	PUT    /kv/{key}[?ttl=duration]     set the key to the request body
+//	DELETE /kv/{key}                    delete the key
+//	GET    /scan?start=&end=&limit=     live keys in [start, end) as JSON
+//	GET    /stats                       db.Stats as JSON
+//
+// Keys are the rest of the path after /kv/, so they may contain slashes;
+// other bytes must be percent-encoded. Scan bounds default to the first and
+// last key and limit to 100; limit=0 returns every key in the range.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+)
+
+// shutdownTimeout bounds how long shutdown waits for requests in flight.
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	var addr, dbPath string
+	flag.StringVar(&addr, "addr", ":8080", "address to listen on")
+	flag.StringVar(&dbPath, "db", "", "database to serve")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-addr host:port] -db path\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if dbPath == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	engine, err := db.Open(db.WithDBPath(dbPath), db.WithLogger(common.DiscardLogger))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to listen on %s: %v\n", addr, err)
+		engine.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("serving %s on %s\n", dbPath, ln.Addr())
+
+	srv := &http.Server{Handler: newHandler(engine)}
+	stopped := make(chan struct{})
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+		close(stopped)
+	}()
+
+	err = srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns as soon as shutdown starts; requests in flight still
+		// need the database
+		<-stopped
+		err = nil
+	}
+	if closeErr := engine.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to close database: %v\n", closeErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve failed: %v\n", err)
+		os.Exit(1)
+	}
+}
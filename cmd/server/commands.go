@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/resp"
+)
+
+// defaultScanCount is how many keys SCAN examines per call without COUNT,
+// as in Redis.
+const defaultScanCount = 10
+
+// arity holds the minimum and maximum number of arguments each command
+// takes after its name; -1 means no maximum.
+var arity = map[string][2]int{
+	"PING":    {0, 1},
+	"ECHO":    {1, 1},
+	"GET":     {1, 1},
+	"SET":     {2, 4},
+	"DEL":     {1, -1},
+	"EXISTS":  {1, -1},
+	"TTL":     {1, 1},
+	"PTTL":    {1, 1},
+	"SCAN":    {1, 5},
+	"COMMAND": {0, -1},
+	"QUIT":    {0, 0},
+}
+
+// handle runs the commands of one client until it quits, disconnects, or
+// sends something that isn't RESP.
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := resp.NewReader(conn)
+	w := resp.NewWriter(conn)
+
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			if errors.Is(err, resp.ErrProtocol) {
+				w.WriteError("ERR Protocol error: " + err.Error())
+				w.Flush()
+			}
+			return
+		}
+		quit := s.exec(w, args)
+		if err := w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// exec runs one command, writing its reply to w. Reports whether the client
+// asked to close the connection.
+func (s *server) exec(w *resp.Writer, args [][]byte) bool {
+	name := strings.ToUpper(string(args[0]))
+	args = args[1:]
+
+	bounds, ok := arity[name]
+	if !ok {
+		w.WriteError("ERR unknown command '" + name + "'")
+		return false
+	}
+	if len(args) < bounds[0] || (bounds[1] >= 0 && len(args) > bounds[1]) {
+		w.WriteError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return false
+	}
+
+	switch name {
+	case "PING":
+		if len(args) == 1 {
+			w.WriteBulk(args[0])
+		} else {
+			w.WriteSimpleString("PONG")
+		}
+	case "ECHO":
+		w.WriteBulk(args[0])
+	case "GET":
+		s.get(w, args[0])
+	case "SET":
+		s.set(w, args)
+	case "DEL":
+		s.del(w, args)
+	case "EXISTS":
+		s.exists(w, args)
+	case "TTL", "PTTL":
+		s.ttl(w, args[0], name == "PTTL")
+	case "SCAN":
+		s.scan(w, args)
+	case "COMMAND":
+		// redis-cli asks for command docs on startup; it copes without them
+		w.WriteArray(0)
+	case "QUIT":
+		w.WriteSimpleString("OK")
+		return true
+	}
+	return false
+}
+
+func (s *server) get(w *resp.Writer, key []byte) {
+	value, err := s.engine.Get(key)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		w.WriteBulk(nil)
+	case err != nil:
+		writeError(w, err)
+	default:
+		w.WriteBulk(value)
+	}
+}
+
+// set handles SET key value [EX seconds | PX milliseconds].
+func (s *server) set(w *resp.Writer, args [][]byte) {
+	key, value := args[0], args[1]
+	var ttl time.Duration
+	switch len(args) {
+	case 2:
+	case 4:
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+		switch strings.ToUpper(string(args[2])) {
+		case "EX":
+			ttl = time.Duration(n) * time.Second
+		case "PX":
+			ttl = time.Duration(n) * time.Millisecond
+		default:
+			w.WriteError("ERR syntax error")
+			return
+		}
+	default:
+		w.WriteError("ERR syntax error")
+		return
+	}
+
+	var err error
+	if ttl > 0 {
+		err = s.engine.PutWithTTL(key, value, ttl)
+	} else {
+		err = s.engine.Put(key, value)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteSimpleString("OK")
+}
+
+// del deletes keys and replies with how many of them existed.
+func (s *server) del(w *resp.Writer, keys [][]byte) {
+	var deleted int64
+	for _, key := range keys {
+		_, err := s.engine.Get(key)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := s.engine.Delete(key); err != nil {
+			writeError(w, err)
+			return
+		}
+		deleted++
+	}
+	w.WriteInteger(deleted)
+}
+
+// exists replies with how many of keys exist, counting repeats each time.
+func (s *server) exists(w *resp.Writer, keys [][]byte) {
+	values, err := s.engine.MultiGet(keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var n int64
+	for _, value := range values {
+		if value != nil {
+			n++
+		}
+	}
+	w.WriteInteger(n)
+}
+
+// ttl replies with the time key has left to live, in seconds or with millis
+// in milliseconds: -2 if it doesn't exist and -1 if it never expires.
+func (s *server) ttl(w *resp.Writer, key []byte, millis bool) {
+	entry, err := s.engine.GetEntry(key)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && entry.Type == common.EntryTypeDelete) {
+		w.WriteInteger(-2)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if entry.ExpiresAt == 0 {
+		w.WriteInteger(-1)
+		return
+	}
+
+	left := time.Duration(max(entry.ExpiresAt-time.Now().UnixNano(), 0))
+	if millis {
+		w.WriteInteger(left.Milliseconds())
+	} else {
+		// Round like Redis, so a key set with EX 10 reports 10 at first
+		w.WriteInteger(int64((left + time.Second/2) / time.Second))
+	}
+}
+
+// scan handles SCAN cursor [MATCH pattern] [COUNT count]. Cursor 0 starts
+// at the first key, and every other cursor at the key the call that
+// returned it stopped before, looked up in s.cursors. COUNT keys are
+// examined per call, of which only those matching the pattern are returned.
+func (s *server) scan(w *resp.Writer, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	var resume []byte
+	if err == nil && cursor != 0 {
+		var ok bool
+		if resume, ok = s.cursors.get(cursor); !ok {
+			err = errors.New("unknown cursor")
+		}
+	}
+	if err != nil {
+		w.WriteError("ERR invalid cursor")
+		return
+	}
+	pattern, count := "", defaultScanCount
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			w.WriteError("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+			if _, err := path.Match(pattern, ""); err != nil {
+				w.WriteError("ERR invalid pattern")
+				return
+			}
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				w.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			w.WriteError("ERR syntax error")
+			return
+		}
+	}
+
+	opts := db.DefaultReadOptions
+	opts.LowerBound = resume
+	iter, err := s.engine.NewIteratorWithOptions(opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer iter.Close()
+
+	var keys [][]byte
+	next := uint64(0)
+	for examined := 0; ; examined++ {
+		entry, err := iter.Next()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if entry == nil {
+			break
+		}
+		if examined == count {
+			next = s.cursors.add(entry.Key)
+			break
+		}
+		if matched, _ := path.Match(pattern, string(entry.Key)); pattern == "" || matched {
+			keys = append(keys, entry.Key)
+		}
+	}
+
+	w.WriteArray(2)
+	w.WriteBulk([]byte(strconv.FormatUint(next, 10)))
+	w.WriteArray(len(keys))
+	for _, key := range keys {
+		w.WriteBulk(key)
+	}
+}
+
+// writeError replies with a database error, reporting a read-only database
+// the way a Redis replica does.
+func writeError(w *resp.Writer, err error) {
+	if errors.Is(err, db.ErrReadOnly) {
+		w.WriteError("READONLY " + err.Error())
+		return
+	}
+	w.WriteError("ERR " + err.Error())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxScanCursors is how many SCAN cursors the server remembers. Older ones
+// are forgotten first, and continuing a forgotten scan fails.
+const maxScanCursors = 4096
+
+// cursorTable maps the SCAN cursors handed out to the keys their scans
+// resume at, so a call starts where the last one stopped instead of
+// skipping the keys before it. Clients expect cursors to be integers, and
+// keys make long ones, hence the table. Cursors are shared by every
+// connection, as in Redis. The zero value is an empty table.
+type cursorTable struct {
+	mu    sync.Mutex
+	last  uint64 // the last cursor handed out; 0 is never one
+	keys  map[uint64][]byte
+	order []uint64 // cursors in keys, oldest first
+}
+
+// add returns a new cursor resuming at key.
+func (t *cursorTable) add(key []byte) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.keys == nil {
+		t.keys = make(map[uint64][]byte)
+	}
+	t.last++
+	t.keys[t.last] = bytes.Clone(key)
+	t.order = append(t.order, t.last)
+	if len(t.order) > maxScanCursors {
+		delete(t.keys, t.order[0])
+		t.order = t.order[1:]
+	}
+	return t.last
+}
+
+// get returns the key cursor resumes at, or false if it was never handed
+// out or has been forgotten. A cursor stays valid after use, so a client
+// may retry a call.
+func (t *cursorTable) get(cursor uint64) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok := t.keys[cursor]
+	return key, ok
+}
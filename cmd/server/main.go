@@ -0,0 +1,134 @@
+// server serves a database over the Redis protocol (RESP2), so existing
+// Redis clients and tools can use amethyst as a persistent store.
+//
+// Usage:
+//
+//	server [-addr :6379] -db path
+//
+// It speaks the subset of Redis commands that maps onto a key-value store:
+//
+//	PING [message]                       ECHO message
+//	GET key                              SET key value [EX seconds | PX milliseconds]
+//	DEL key [key ...]                    EXISTS key [key ...]
+//	TTL key                              PTTL key
+//	SCAN cursor [MATCH pattern] [COUNT count]
+//	COMMAND                              QUIT
+//
+// Every key lives in a single keyspace of strings; there are no databases to
+// SELECT and no other data types. Writes are synced before they are
+// acknowledged. A SCAN cursor resumes at the key the previous call stopped
+// before, so a full scan reads each key once. Keys written or deleted
+// between calls may be missed, which Redis allows as well, but never
+// returned twice. The server remembers the last 4096 cursors it handed
+// out; continuing an older scan fails with an invalid cursor error.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+)
+
+func main() {
+	var addr, dbPath string
+	flag.StringVar(&addr, "addr", ":6379", "address to listen on")
+	flag.StringVar(&dbPath, "db", "", "database to serve")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-addr host:port] -db path\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if dbPath == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	engine, err := db.Open(db.WithDBPath(dbPath), db.WithLogger(common.DiscardLogger))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to listen on %s: %v\n", addr, err)
+		engine.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("serving %s on %s\n", dbPath, ln.Addr())
+
+	s := &server{engine: engine, conns: make(map[net.Conn]struct{})}
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		ln.Close()
+	}()
+
+	err = s.serve(ln)
+	s.shutdown()
+	if closeErr := engine.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to close database: %v\n", closeErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// server tracks client connections so that shutdown can close them before
+// the database.
+type server struct {
+	engine  *db.DB
+	cursors cursorTable
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// serve accepts connections until ln is closed, handling each on its own
+// goroutine.
+func (s *server) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// shutdown closes every client connection and waits for their handlers.
+func (s *server) shutdown() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// status and errorReply are the simple string and error replies, told apart
+// from bulk strings, which decode as string.
+type (
+	status     string
+	errorReply string
+)
+
+// client drives a server over one end of a net.Pipe.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newClient serves engine on a pipe and returns the client end. The server
+// side stops when the client closes its end.
+func newClient(t *testing.T, engine *db.DB) *client {
+	s := &server{engine: engine, conns: make(map[net.Conn]struct{})}
+	conn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handle(serverConn)
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func openEngine(t *testing.T, opts ...db.Option) *db.DB {
+	engine, err := db.Open(append([]db.Option{db.WithDBPath(t.TempDir()), db.WithLogger(common.DiscardLogger)}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// do sends args as a RESP array of bulk strings and returns the reply.
+func (c *client) do(t *testing.T, args ...string) any {
+	t.Helper()
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.conn, cmd)
+	require.NoError(t, err)
+	reply, err := c.readReply()
+	require.NoError(t, err)
+	return reply
+}
+
+// readReply decodes one reply: a status, errorReply, int64, string, nil
+// for the null bulk string, or []any for an array.
+func (c *client) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply line %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return status(body), nil
+	case '-':
+		return errorReply(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		elems := []any{}
+		for range n {
+			elem, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", kind)
+}
+
+func TestCommands(t *testing.T) {
+	c := newClient(t, openEngine(t))
+
+	tests := []struct {
+		args  []string
+		reply any
+	}{
+		{[]string{"PING"}, status("PONG")},
+		{[]string{"ping", "hi"}, "hi"},
+		{[]string{"ECHO", "a\r\nb"}, "a\r\nb"},
+		{[]string{"GET", "k"}, nil},
+		{[]string{"SET", "k", "v1"}, status("OK")},
+		{[]string{"SET", "k", "v2"}, status("OK")},
+		{[]string{"GET", "k"}, "v2"},
+		{[]string{"SET", "empty", ""}, status("OK")},
+		{[]string{"GET", "empty"}, ""},
+		{[]string{"EXISTS", "k", "k", "missing"}, int64(2)},
+		{[]string{"TTL", "k"}, int64(-1)},
+		{[]string{"TTL", "missing"}, int64(-2)},
+		{[]string{"SET", "temp", "v", "EX", "100"}, status("OK")},
+		{[]string{"TTL", "temp"}, int64(100)},
+		{[]string{"SET", "temp", "v", "px", "5000"}, status("OK")},
+		{[]string{"TTL", "temp"}, int64(5)},
+		{[]string{"DEL", "k", "missing", "empty"}, int64(2)},
+		{[]string{"GET", "k"}, nil},
+		{[]string{"DEL", "k"}, int64(0)},
+		{[]string{"COMMAND", "DOCS"}, []any{}},
+
+		// Errors leave the connection open
+		{[]string{"NOPE"}, errorReply("ERR unknown command 'NOPE'")},
+		{[]string{"GET"}, errorReply("ERR wrong number of arguments for 'get' command")},
+		{[]string{"GET", "a", "b"}, errorReply("ERR wrong number of arguments for 'get' command")},
+		{[]string{"SET", "k", "v", "EX"}, errorReply("ERR syntax error")},
+		{[]string{"SET", "k", "v", "EX", "0"}, errorReply("ERR invalid expire time in 'set' command")},
+		{[]string{"SET", "k", "v", "EX", "ten"}, errorReply("ERR invalid expire time in 'set' command")},
+		{[]string{"SET", "k", "v", "XX", "10"}, errorReply("ERR syntax error")},
+		{[]string{"SCAN", "x"}, errorReply("ERR invalid cursor")},
+		{[]string{"SCAN", "0", "COUNT"}, errorReply("ERR syntax error")},
+		{[]string{"SCAN", "0", "COUNT", "0"}, errorReply("ERR value is not an integer or out of range")},
+		{[]string{"SCAN", "0", "MATCH", "["}, errorReply("ERR invalid pattern")},
+		{[]string{"SCAN", "0", "LIMIT", "1"}, errorReply("ERR syntax error")},
+		{[]string{"PING"}, status("PONG")},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, c.do(t, tt.args...), "%q", tt.args)
+	}
+}
+
+func TestScanCommand(t *testing.T) {
+	c := newClient(t, openEngine(t))
+	for _, key := range []string{"user:1", "user:2", "order:1", "user:3"} {
+		require.Equal(t, status("OK"), c.do(t, "SET", key, "v"))
+	}
+
+	// scan follows the cursors from 0 back to 0, returning the keys of each
+	// call
+	scan := func(args ...string) [][]any {
+		t.Helper()
+		var calls [][]any
+		cursor := "0"
+		for {
+			reply := c.do(t, append([]string{"SCAN", cursor}, args...)...).([]any)
+			calls = append(calls, reply[1].([]any))
+			if cursor = reply[0].(string); cursor == "0" {
+				return calls
+			}
+		}
+	}
+
+	tests := []struct {
+		args  []string
+		calls [][]any
+	}{
+		{nil, [][]any{{"order:1", "user:1", "user:2", "user:3"}}},
+		{[]string{"COUNT", "3"}, [][]any{{"order:1", "user:1", "user:2"}, {"user:3"}}},
+		{[]string{"COUNT", "4"}, [][]any{{"order:1", "user:1", "user:2", "user:3"}}},
+		{[]string{"MATCH", "user:*", "COUNT", "2"}, [][]any{{"user:1"}, {"user:2", "user:3"}}},
+		{[]string{"MATCH", "none:*"}, [][]any{{}}},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.calls, scan(tt.args...), "%q", tt.args)
+	}
+
+	// The cursor resumes at a key, so writes behind it don't shift the scan
+	reply := c.do(t, "SCAN", "0", "COUNT", "2").([]any)
+	require.Equal(t, []any{"order:1", "user:1"}, reply[1])
+	cursor := reply[0].(string)
+	require.Equal(t, status("OK"), c.do(t, "SET", "a", "v"))
+	require.Equal(t, []any{"0", []any{"user:2", "user:3"}}, c.do(t, "SCAN", cursor, "COUNT", "2"))
+
+	// A cursor stays valid for a retry, but one never handed out isn't
+	require.Equal(t, []any{"0", []any{"user:2", "user:3"}}, c.do(t, "SCAN", cursor, "COUNT", "2"))
+	require.Equal(t, errorReply("ERR invalid cursor"), c.do(t, "SCAN", "999999"))
+}
+
+func TestReadOnlyReplies(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := db.Open(db.WithDBPath(dir), db.WithLogger(common.DiscardLogger))
+	require.NoError(t, err)
+	require.NoError(t, engine.Put([]byte("k"), []byte("v")))
+	require.NoError(t, engine.Close())
+
+	readOnly, err := db.Open(db.WithDBPath(dir), db.WithLogger(common.DiscardLogger), db.WithReadOnly())
+	require.NoError(t, err)
+	defer readOnly.Close()
+	c := newClient(t, readOnly)
+
+	// Writes are refused as a Redis replica refuses them
+	require.Equal(t, "v", c.do(t, "GET", "k"))
+	require.Equal(t, errorReply("READONLY "+db.ErrReadOnly.Error()), c.do(t, "SET", "k", "v2"))
+	require.Equal(t, errorReply("READONLY "+db.ErrReadOnly.Error()), c.do(t, "DEL", "k"))
+	require.Equal(t, "v", c.do(t, "GET", "k"))
+}
+
+func TestConnectionEnds(t *testing.T) {
+	engine := openEngine(t)
+
+	// QUIT is acknowledged, then the server hangs up
+	c := newClient(t, engine)
+	require.Equal(t, status("OK"), c.do(t, "QUIT"))
+	_, err := c.readReply()
+	require.ErrorIs(t, err, io.EOF)
+
+	// As it does after replying to a protocol error
+	c = newClient(t, engine)
+	_, err = io.WriteString(c.conn, "*1\r\n$x\r\n")
+	require.NoError(t, err)
+	reply, err := c.readReply()
+	require.NoError(t, err)
+	require.IsType(t, errorReply(""), reply)
+	require.Contains(t, string(reply.(errorReply)), "ERR Protocol error")
+	_, err = c.readReply()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Inline commands, as typed into telnet, work too
+	c = newClient(t, engine)
+	_, err = io.WriteString(c.conn, "SET greeting hello\r\nGET greeting\r\n")
+	require.NoError(t, err)
+	for _, want := range []any{status("OK"), "hello"} {
+		reply, err := c.readReply()
+		require.NoError(t, err)
+		require.Equal(t, want, reply)
+	}
+}
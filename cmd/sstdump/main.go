@@ -0,0 +1,321 @@
+// sstdump examines amethyst SSTable files without opening a database.
+//
+// Usage:
+//
+//	sstdump [flags] file.sst...
+//
+// By default every entry is printed. -props prints only table properties,
+// including key and value size distributions, -start/-end restrict the dump
+// to a key range, -verify checks the table's internal consistency, and -json
+// emits machine-readable output.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"amethyst/internal/block"
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+)
+
+// properties summarizes a table, gathered from its footer, properties block,
+// index, and a full scan.
+type properties struct {
+	FileSize     int64  `json:"file_size"`
+	Entries      uint32 `json:"entries"`
+	Tombstones   int    `json:"tombstones"`
+	RangeDels    int    `json:"range_dels"`
+	Blocks       int    `json:"blocks"`
+	DataSize     uint32 `json:"data_size"`
+	RangeDelSize uint32 `json:"range_del_size"`
+	FilterSize   uint32 `json:"filter_size"`
+	IndexSize    int64  `json:"index_size"`
+	SmallestKey  string `json:"smallest_key"`
+	LargestKey   string `json:"largest_key"`
+	MinSeq       uint64 `json:"min_seq"`
+	MaxSeq       uint64 `json:"max_seq"`
+
+	// Recorded when the table was written; absent for tables that predate
+	// the properties block.
+	RawDataSize uint64 `json:"raw_data_size,omitempty"`
+	Codec       string `json:"codec,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+
+	KeySizes   sstable.SizeHistogram `json:"key_sizes"`
+	ValueSizes sstable.SizeHistogram `json:"value_sizes"`
+}
+
+type jsonEntry struct {
+	Type      string `json:"type"`
+	Seq       uint64 `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+}
+
+type report struct {
+	Path       string      `json:"path"`
+	Properties *properties `json:"properties"`
+	Entries    []jsonEntry `json:"entries,omitempty"`
+	Problems   []string    `json:"problems,omitempty"`
+}
+
+type config struct {
+	propsOnly bool
+	start     []byte
+	end       []byte
+	verify    bool
+	json      bool
+}
+
+func main() {
+	var cfg config
+	var start, end string
+	flag.BoolVar(&cfg.propsOnly, "props", false, "print table properties only")
+	flag.StringVar(&start, "start", "", "first key to dump (inclusive)")
+	flag.StringVar(&end, "end", "", "last key to dump (exclusive)")
+	flag.BoolVar(&cfg.verify, "verify", false, "verify key order, entry count, and index consistency")
+	flag.BoolVar(&cfg.json, "json", false, "emit JSON instead of text")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] file.sst...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if start != "" {
+		cfg.start = []byte(start)
+	}
+	if end != "" {
+		cfg.end = []byte(end)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		r, err := examine(path, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if len(r.Problems) > 0 {
+			failed = true
+		}
+
+		if cfg.json {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(r)
+		} else {
+			printReport(r, cfg)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// examine scans the table at path once, collecting properties, the entries in
+// the requested range, and (when verifying) any consistency problems.
+func examine(path string, cfg config) (*report, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	footer, err := readFooter(path, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := sstable.OpenSSTable(vfs.Default, path, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+
+	indexEnd := stat.Size() - int64(footer.Size())
+	if footer.Version >= sstable.FormatProperties {
+		indexEnd = int64(footer.PropertiesOffset)
+	}
+	index := table.GetIndex()
+	props := &properties{
+		FileSize:     stat.Size(),
+		Entries:      footer.EntryCount,
+		RangeDels:    len(table.RangeTombstones()),
+		Blocks:       len(index.Entries),
+		DataSize:     footer.RangeDelOffset,
+		RangeDelSize: footer.FilterOffset - footer.RangeDelOffset,
+		FilterSize:   footer.IndexOffset - footer.FilterOffset,
+		IndexSize:    indexEnd - int64(footer.IndexOffset),
+	}
+	if tp := table.Properties(); tp != nil {
+		props.RawDataSize = tp.RawDataSize
+		props.Codec = tp.CodecName()
+		props.CreatedAt = time.Unix(0, tp.CreatedAt).UTC().Format(time.RFC3339)
+	}
+	r := &report{Path: path, Properties: props}
+
+	iter := table.Iterator()
+	var prevKey []byte
+	count := 0
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			r.Problems = append(r.Problems, fmt.Sprintf("entry %d: %v", count, err))
+			break
+		}
+		if entry == nil {
+			break
+		}
+
+		if count == 0 {
+			props.SmallestKey = string(entry.Key)
+			props.MinSeq = entry.Seq
+		}
+		props.LargestKey = string(entry.Key)
+		props.MinSeq = min(props.MinSeq, entry.Seq)
+		props.MaxSeq = max(props.MaxSeq, entry.Seq)
+		props.KeySizes.Add(len(entry.Key))
+		if entry.Type == common.EntryTypeDelete {
+			props.Tombstones++
+		} else {
+			props.ValueSizes.Add(len(entry.Value))
+		}
+
+		if cfg.verify {
+			if prevKey != nil && bytes.Compare(prevKey, entry.Key) >= 0 {
+				r.Problems = append(r.Problems, fmt.Sprintf("entry %d: key %q not greater than previous key %q", count, entry.Key, prevKey))
+			}
+			if count%block.BLOCK_SIZE == 0 {
+				blockIdx := count / block.BLOCK_SIZE
+				if blockIdx >= len(index.Entries) {
+					r.Problems = append(r.Problems, fmt.Sprintf("entry %d: block %d missing from index", count, blockIdx))
+				} else if !bytes.Equal(index.Entries[blockIdx].Key, entry.Key) {
+					r.Problems = append(r.Problems, fmt.Sprintf("block %d: index key %q does not match first key %q", blockIdx, index.Entries[blockIdx].Key, entry.Key))
+				}
+			}
+		}
+		prevKey = entry.Key
+		count++
+
+		if !cfg.propsOnly && inRange(entry.Key, cfg.start, cfg.end) {
+			r.Entries = append(r.Entries, toJSONEntry(entry))
+		}
+	}
+
+	if cfg.verify && uint32(count) != footer.EntryCount {
+		r.Problems = append(r.Problems, fmt.Sprintf("footer records %d entries, found %d", footer.EntryCount, count))
+	}
+
+	return r, nil
+}
+
+func readFooter(path string, size int64) (*sstable.Footer, error) {
+	if size < sstable.LEGACY_FOOTER_SIZE {
+		return nil, fmt.Errorf("file too small for footer (%d bytes)", size)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sstable.ReadFooterAt(f, size)
+}
+
+// inRange reports whether start <= key < end; nil bounds are unbounded.
+func inRange(key, start, end []byte) bool {
+	if start != nil && bytes.Compare(key, start) < 0 {
+		return false
+	}
+	if end != nil && bytes.Compare(key, end) >= 0 {
+		return false
+	}
+	return true
+}
+
+func toJSONEntry(e *common.Entry) jsonEntry {
+	typeStr := "PUT"
+	switch e.Type {
+	case common.EntryTypeDelete:
+		typeStr = "DEL"
+	case common.EntryTypeBlobRef:
+		typeStr = "BLOB"
+	}
+	return jsonEntry{
+		Type:      typeStr,
+		Seq:       e.Seq,
+		Timestamp: e.Timestamp,
+		ExpiresAt: e.ExpiresAt,
+		Key:       string(e.Key),
+		Value:     string(e.Value),
+	}
+}
+
+// printSizes prints the non-empty buckets of h, one per line.
+func printSizes(label string, h sstable.SizeHistogram) {
+	fmt.Printf("  %-13s %d\n", label+":", h.Count())
+	for i, n := range h {
+		if n == 0 {
+			continue
+		}
+		lo, hi := sstable.BucketBounds(i)
+		fmt.Printf("    %14s  %d\n", fmt.Sprintf("%d..%d", lo, hi), n)
+	}
+}
+
+func printReport(r *report, cfg config) {
+	p := r.Properties
+	fmt.Printf("SSTable: %s\n", r.Path)
+	fmt.Println()
+	fmt.Printf("  file size:    %d bytes\n", p.FileSize)
+	fmt.Printf("  entries:      %d (%d tombstones, %d range deletions)\n", p.Entries, p.Tombstones, p.RangeDels)
+	fmt.Printf("  blocks:       %d\n", p.Blocks)
+	fmt.Printf("  data size:    %d bytes\n", p.DataSize)
+	if p.Codec != "" {
+		fmt.Printf("  raw size:     %d bytes (%s)\n", p.RawDataSize, p.Codec)
+		fmt.Printf("  created:      %s\n", p.CreatedAt)
+	}
+	fmt.Printf("  range dels:   %d bytes\n", p.RangeDelSize)
+	fmt.Printf("  filter size:  %d bytes\n", p.FilterSize)
+	fmt.Printf("  index size:   %d bytes\n", p.IndexSize)
+	fmt.Printf("  key range:    %q .. %q\n", p.SmallestKey, p.LargestKey)
+	fmt.Printf("  seq range:    %d .. %d\n", p.MinSeq, p.MaxSeq)
+	printSizes("key sizes", p.KeySizes)
+	printSizes("value sizes", p.ValueSizes)
+	fmt.Println()
+
+	if !cfg.propsOnly {
+		fmt.Printf("%-6s %-8s %-20s  %s\n", "OP", "SEQ", "KEY", "VALUE")
+		fmt.Println()
+		for _, e := range r.Entries {
+			fmt.Printf("%-6s %-8d %-20s  %s\n", e.Type, e.Seq, e.Key, e.Value)
+		}
+		fmt.Println()
+		fmt.Printf("Total entries: %d\n", len(r.Entries))
+		fmt.Println()
+	}
+
+	if cfg.verify {
+		if len(r.Problems) == 0 {
+			fmt.Println("verify: ok")
+		} else {
+			fmt.Printf("verify: %d problems\n", len(r.Problems))
+			for _, problem := range r.Problems {
+				fmt.Printf("  %s\n", problem)
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,151 @@
+// sstimport migrates LevelDB and RocksDB tables into amethyst.
+//
+// Usage:
+//
+//	sstimport -out dir file.ldb...
+//	sstimport -db path file.ldb...
+//
+// With -out, each table is transcoded into an amethyst SSTable of the same
+// base name in dir, keeping sequence numbers. With -db, every entry is
+// written into the database through the normal write path; list files oldest
+// first, since a key's last write wins.
+//
+// Tables must be uncompressed or snappy-compressed, and RocksDB tables must
+// use format_version 2 or older with CRC32C checksums.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/leveldb"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func main() {
+	var outDir, dbPath string
+	var fpr float64
+	flag.StringVar(&outDir, "out", "", "directory to write transcoded SSTables to")
+	flag.StringVar(&dbPath, "db", "", "database to write entries into")
+	flag.Float64Var(&fpr, "fpr", db.DefaultOptions.BloomFilterFPR, "bloom filter false positive rate for transcoded tables")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s (-out dir | -db path) file.ldb...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (outDir == "") == (dbPath == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var engine *db.DB
+	if dbPath != "" {
+		var err error
+		if engine, err = db.Open(db.WithDBPath(dbPath), db.WithLogger(common.DiscardLogger)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open database: %v\n", err)
+			os.Exit(1)
+		}
+		defer engine.Close()
+	} else if err := os.MkdirAll(outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", outDir, err)
+		os.Exit(1)
+	}
+
+	for _, path := range flag.Args() {
+		var err error
+		if engine != nil {
+			err = ingest(engine, path)
+		} else {
+			err = transcode(path, outDir, fpr)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			if engine != nil {
+				engine.Close()
+			}
+			os.Exit(1)
+		}
+	}
+}
+
+// transcode converts the table at path into an SSTable in outDir. The output
+// is written under a temporary name so a failure never leaves a partial
+// table behind.
+func transcode(path, outDir string, fpr float64) error {
+	table, err := leveldb.OpenTable(path)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	dst := filepath.Join(outDir, base+".sst")
+	f, err := os.Create(dst + ".tmp")
+	if err != nil {
+		return err
+	}
+	result, err := leveldb.Transcode(table, f, fpr)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst + ".tmp")
+		return err
+	}
+	if err := os.Rename(dst+".tmp", dst); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s -> %s (%d entries, %d bytes)\n", path, dst, result.EntryCount, result.BytesWritten)
+	return nil
+}
+
+// ingest writes every entry of the table at path into engine. Keys within a
+// table are unique, so writes can be batched concurrently.
+func ingest(engine *db.DB, path string) error {
+	table, err := leveldb.OpenTable(path)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+
+	var g errgroup.Group
+	g.SetLimit(max(engine.Opts.MaxBatchSize, 1))
+
+	iter := table.Iterator()
+	puts, deletes := 0, 0
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			g.Wait()
+			return err
+		}
+		if entry == nil {
+			break
+		}
+
+		if entry.Type == common.EntryTypeDelete {
+			deletes++
+			g.Go(func() error { return engine.Delete(entry.Key) })
+		} else {
+			puts++
+			g.Go(func() error { return engine.Put(entry.Key, entry.Value) })
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d puts, %d deletes\n", path, puts, deletes)
+	return nil
+}
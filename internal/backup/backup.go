@@ -0,0 +1,153 @@
+// Package backup restores databases from backups. A backup directory holds
+// one restore point per subdirectory, each a checkpoint as written by
+// DB.Checkpoint or by WithPeriodicCheckpoints, named so that newer restore
+// points sort after older ones.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+)
+
+// ErrNoRestorePoint is returned when the backup directory holds no restore
+// point by the requested name, or none at all.
+var ErrNoRestorePoint = errors.New("backup: no such restore point")
+
+// Restore rebuilds the database directory dbDir, which must not exist yet,
+// from the restore point named restorePoint in backupDir, or from the newest
+// one if restorePoint is empty. The files are copied into a staging
+// directory next to dbDir, which is opened read-only and checked with
+// VerifyChecksums; only if every table, blob file, and WAL passes is it
+// renamed to dbDir. Nothing is left behind on failure.
+func Restore(backupDir, dbDir, restorePoint string) error {
+	fsys := vfs.Default
+	if _, err := fsys.Stat(dbDir); err == nil {
+		return fmt.Errorf("backup: %s already exists", dbDir)
+	}
+
+	src, err := findRestorePoint(fsys, backupDir, restorePoint)
+	if err != nil {
+		return err
+	}
+	if _, err := fsys.Stat(common.NewPathManager(src).ManifestPath()); err != nil {
+		return fmt.Errorf("backup: %s is not a checkpoint: %w", src, err)
+	}
+
+	staging := dbDir + ".restoring"
+	if err := fsys.RemoveAll(staging); err != nil {
+		return err
+	}
+	restored := false
+	defer func() {
+		if !restored {
+			fsys.RemoveAll(staging)
+		}
+	}()
+
+	if err := copyTree(fsys, src, staging); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := verify(staging); err != nil {
+		return err
+	}
+
+	if err := fsys.Rename(staging, dbDir); err != nil {
+		return err
+	}
+	restored = true
+	return vfs.SyncDir(fsys, filepath.Dir(dbDir))
+}
+
+// findRestorePoint returns the path of the restore point named name in
+// backupDir, or of the newest one if name is empty.
+func findRestorePoint(fsys vfs.FS, backupDir, name string) (string, error) {
+	entries, err := fsys.ReadDir(backupDir)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	if name == "" && len(names) > 0 {
+		name = names[len(names)-1]
+	}
+	if i := sort.SearchStrings(names, name); i == len(names) || names[i] != name {
+		return "", fmt.Errorf("%w: %q in %s", ErrNoRestorePoint, name, backupDir)
+	}
+	return filepath.Join(backupDir, name), nil
+}
+
+// verify opens the database in dir read-only and checks every file its
+// manifest references.
+func verify(dir string) error {
+	d, err := db.Open(db.WithDBPath(dir), db.WithReadOnly())
+	if err != nil {
+		return fmt.Errorf("backup: restored database does not open: %w", err)
+	}
+	defer d.Close()
+
+	if problems := d.VerifyChecksums(); len(problems) > 0 {
+		return fmt.Errorf("backup: %d problems in restored database, first in %s: %w", len(problems), problems[0].File, problems[0].Err)
+	}
+	return nil
+}
+
+// copyTree copies the directory src to dst recursively, syncing every file
+// and directory it creates.
+func copyTree(fsys vfs.FS, src, dst string) error {
+	if err := fsys.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := fsys.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from, to := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		if entry.IsDir() {
+			err = copyTree(fsys, from, to)
+		} else {
+			err = copyFile(fsys, from, to)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return vfs.SyncDir(fsys, dst)
+}
+
+// copyFile copies src to dst and syncs dst.
+func copyFile(fsys vfs.FS, src, dst string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fsys.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,83 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/backup"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestore(t *testing.T) {
+	backupDir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+	require.NoError(t, d.Put([]byte("b"), []byte("1")))
+	require.NoError(t, d.Checkpoint(filepath.Join(backupDir, "0001")))
+	require.NoError(t, d.Put([]byte("a"), []byte("2")))
+	require.NoError(t, d.Delete([]byte("b")))
+	require.NoError(t, d.Checkpoint(filepath.Join(backupDir, "0002")))
+	require.NoError(t, d.Close())
+
+	tests := []struct {
+		name         string
+		restorePoint string
+		want         map[string]string
+		err          error
+	}{
+		{"newest", "", map[string]string{"a": "2"}, nil},
+		{"older", "0001", map[string]string{"a": "1", "b": "1"}, nil},
+		{"missing", "0003", nil, backup.ErrNoRestorePoint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbDir := filepath.Join(t.TempDir(), "db")
+			err := backup.Restore(backupDir, dbDir, tt.restorePoint)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				require.NoDirExists(t, dbDir)
+				return
+			}
+			require.NoError(t, err)
+
+			restored, err := db.Open(db.WithDBPath(dbDir))
+			require.NoError(t, err)
+			defer restored.Close()
+			entries, err := restored.Scan(nil, 0)
+			require.NoError(t, err)
+			got := make(map[string]string)
+			for _, entry := range entries {
+				got[string(entry.Key)] = string(entry.Value)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	// An existing directory is never overwritten
+	require.Error(t, backup.Restore(backupDir, t.TempDir(), ""))
+}
+
+func TestRestoreCorrupt(t *testing.T) {
+	backupDir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+	require.NoError(t, d.Checkpoint(filepath.Join(backupDir, "0001")))
+	require.NoError(t, d.Close())
+
+	tables, err := filepath.Glob(filepath.Join(backupDir, "0001", "sstable", "*", "*.sst"))
+	require.NoError(t, err)
+	require.NotEmpty(t, tables)
+	data, err := os.ReadFile(tables[0])
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(tables[0], data, 0644))
+
+	dbDir := filepath.Join(t.TempDir(), "db")
+	require.Error(t, backup.Restore(backupDir, dbDir, ""))
+	require.NoDirExists(t, dbDir)
+	require.NoDirExists(t, dbDir+".restoring")
+}
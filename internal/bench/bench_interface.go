@@ -0,0 +1,10 @@
+package bench
+
+// Store is the minimal key-value surface a workload drives. Reads of missing
+// keys are not errors.
+type Store interface {
+	Read(key []byte) error
+	Write(key, value []byte) error
+	// Scan reads up to count live entries starting at start.
+	Scan(start []byte, count int) error
+}
@@ -0,0 +1,144 @@
+package bench
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// memStore is a map-backed Store for exercising generators without a database.
+type memStore map[string][]byte
+
+func (m memStore) Read(key []byte) error         { _ = m[string(key)]; return nil }
+func (m memStore) Write(key, value []byte) error { m[string(key)] = value; return nil }
+func (m memStore) Scan(start []byte, count int) error {
+	return nil
+}
+
+func TestStandardWorkloadMix(t *testing.T) {
+	const ops = 20000
+	tests := []struct {
+		name string
+		want map[OpType]float64
+	}{
+		{"A", map[OpType]float64{OpRead: 0.5, OpUpdate: 0.5}},
+		{"B", map[OpType]float64{OpRead: 0.95, OpUpdate: 0.05}},
+		{"C", map[OpType]float64{OpRead: 1}},
+		{"D", map[OpType]float64{OpRead: 0.95, OpInsert: 0.05}},
+		{"E", map[OpType]float64{OpScan: 0.95, OpInsert: 0.05}},
+		{"F", map[OpType]float64{OpRead: 0.5, OpReadModifyWrite: 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := Standard(tt.name, 100)
+			require.NoError(t, err)
+
+			store := memStore{}
+			g := NewGenerator(w, 1)
+			require.NoError(t, Load(store, g))
+			require.Len(t, store, 100)
+
+			result, err := Run(store, g, ops)
+			require.NoError(t, err)
+			require.Equal(t, ops, result.Total())
+
+			for opType := OpType(0); opType < numOpTypes; opType++ {
+				got := float64(result.Ops[opType]) / ops
+				require.InDelta(t, tt.want[opType], got, 0.02, "%s proportion", opType)
+			}
+			require.Len(t, store, 100+result.Ops[OpInsert], "inserts use fresh keys")
+		})
+	}
+
+	_, err := Standard("G", 100)
+	require.Error(t, err)
+}
+
+func TestKeyChoosers(t *testing.T) {
+	const n, draws = 1000, 100000
+
+	tests := []struct {
+		dist     Distribution
+		hottest  uint64
+		minShare float64 // lower bound on the hottest item's share of draws
+		maxShare float64
+	}{
+		{Uniform, 0, 0, 0.01},
+		{Zipfian, 0, 0.05, 1},
+		{Latest, n - 1, 0.05, 1},
+		{Sequential, 0, 0, 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dist.String(), func(t *testing.T) {
+			chooser := NewKeyChooser(tt.dist, rand.New(rand.NewSource(1)))
+			counts := make([]int, n)
+			for i := 0; i < draws; i++ {
+				idx := chooser.Next(n)
+				require.Less(t, idx, uint64(n))
+				counts[idx]++
+			}
+			share := float64(counts[tt.hottest]) / draws
+			require.GreaterOrEqual(t, share, tt.minShare)
+			require.LessOrEqual(t, share, tt.maxShare)
+		})
+	}
+}
+
+func TestZipfianGrows(t *testing.T) {
+	chooser := NewKeyChooser(Zipfian, rand.New(rand.NewSource(1)))
+	for n := uint64(1); n < 500; n++ {
+		require.Less(t, chooser.Next(n), n)
+	}
+}
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Distribution
+		err  bool
+	}{
+		{"uniform", Uniform, false},
+		{"zipf", Zipfian, false},
+		{"zipfian", Zipfian, false},
+		{"latest", Latest, false},
+		{"sequential", Sequential, false},
+		{"gaussian", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDistribution(tt.in)
+		if tt.err {
+			require.Error(t, err, tt.in)
+			continue
+		}
+		require.NoError(t, err, tt.in)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+func BenchmarkYCSB(b *testing.B) {
+	for _, name := range []string{"A", "B", "C", "D", "E", "F"} {
+		b.Run(name, func(b *testing.B) {
+			// A single client never fills a batch, so keep the group commit
+			// wait short to measure the engine rather than the timer.
+			d, err := db.Open(db.WithDBPath(b.TempDir()), db.WithBatchTimeout(100*time.Microsecond), db.WithLogger(common.DiscardLogger))
+			require.NoError(b, err)
+			defer d.Close()
+
+			w, err := Standard(name, 1000)
+			require.NoError(b, err)
+			store := NewDBStore(d)
+			g := NewGenerator(w, 1)
+			require.NoError(b, Load(store, g))
+
+			b.ResetTimer()
+			_, err = Run(store, g, b.N)
+			require.NoError(b, err)
+		})
+	}
+}
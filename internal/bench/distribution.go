@@ -0,0 +1,166 @@
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Distribution selects how item indexes are drawn.
+type Distribution int
+
+const (
+	// Uniform draws every item with equal probability.
+	Uniform Distribution = iota
+	// Zipfian favours low item indexes, following YCSB's zipfian constant.
+	Zipfian
+	// Latest is zipfian skewed towards the most recently inserted items.
+	Latest
+	// Sequential walks items in order, wrapping around.
+	Sequential
+)
+
+// zipfianConstant is YCSB's default skew.
+const zipfianConstant = 0.99
+
+func (d Distribution) String() string {
+	switch d {
+	case Uniform:
+		return "uniform"
+	case Zipfian:
+		return "zipfian"
+	case Latest:
+		return "latest"
+	case Sequential:
+		return "sequential"
+	default:
+		return fmt.Sprintf("Distribution(%d)", int(d))
+	}
+}
+
+// ParseDistribution parses a distribution name as printed by String.
+// "zipf" is accepted as shorthand for zipfian.
+func ParseDistribution(s string) (Distribution, error) {
+	switch s {
+	case "uniform":
+		return Uniform, nil
+	case "zipf", "zipfian":
+		return Zipfian, nil
+	case "latest":
+		return Latest, nil
+	case "sequential":
+		return Sequential, nil
+	default:
+		return 0, fmt.Errorf("unknown distribution %q (want uniform, zipfian, latest or sequential)", s)
+	}
+}
+
+// KeyChooser draws item indexes in [0, n). n may grow between calls as items
+// are inserted.
+type KeyChooser interface {
+	Next(n uint64) uint64
+}
+
+// NewKeyChooser returns a chooser for d drawing randomness from r.
+func NewKeyChooser(d Distribution, r *rand.Rand) KeyChooser {
+	switch d {
+	case Zipfian:
+		return newZipfian(r, zipfianConstant)
+	case Latest:
+		return &latest{zipf: newZipfian(r, zipfianConstant)}
+	case Sequential:
+		return &sequential{}
+	default:
+		return &uniform{r: r}
+	}
+}
+
+type uniform struct {
+	r *rand.Rand
+}
+
+func (u *uniform) Next(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return uint64(u.r.Int63n(int64(n)))
+}
+
+type sequential struct {
+	next uint64
+}
+
+func (s *sequential) Next(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	i := s.next % n
+	s.next++
+	return i
+}
+
+// latest mirrors a zipfian draw so that the newest items are the hottest.
+type latest struct {
+	zipf *zipfian
+}
+
+func (l *latest) Next(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return n - 1 - l.zipf.Next(n)
+}
+
+// zipfian implements the rejection-free generator from Gray et al., "Quickly
+// Generating Billion-Record Synthetic Databases", as used by YCSB. zeta(n) is
+// extended incrementally as n grows so inserts stay cheap.
+type zipfian struct {
+	r     *rand.Rand
+	theta float64
+	alpha float64
+	zeta2 float64
+
+	n     uint64  // item count zetaN was computed for
+	zetaN float64 // sum of 1/i^theta for i in [1, n]
+	eta   float64
+}
+
+func newZipfian(r *rand.Rand, theta float64) *zipfian {
+	return &zipfian{
+		r:     r,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zeta2: 1 + math.Pow(0.5, theta),
+	}
+}
+
+func (z *zipfian) resize(n uint64) {
+	if n < z.n {
+		z.n, z.zetaN = 0, 0
+	}
+	for i := z.n + 1; i <= n; i++ {
+		z.zetaN += 1 / math.Pow(float64(i), z.theta)
+	}
+	z.n = n
+	z.eta = (1 - math.Pow(2/float64(n), 1-z.theta)) / (1 - z.zeta2/z.zetaN)
+}
+
+func (z *zipfian) Next(n uint64) uint64 {
+	if n <= 1 {
+		return 0
+	}
+	if n != z.n {
+		z.resize(n)
+	}
+
+	u := z.r.Float64()
+	uz := u * z.zetaN
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	i := uint64(float64(n) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	return min(i, n-1)
+}
@@ -0,0 +1,106 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"amethyst/internal/db"
+)
+
+// Result summarizes a run.
+type Result struct {
+	Ops      [numOpTypes]int
+	Latency  [numOpTypes]time.Duration // total time spent per op type
+	Duration time.Duration
+}
+
+// Total returns the number of operations executed.
+func (r *Result) Total() int {
+	total := 0
+	for _, n := range r.Ops {
+		total += n
+	}
+	return total
+}
+
+// String renders throughput and mean latency per op type.
+func (r *Result) String() string {
+	s := fmt.Sprintf("%d ops in %v (%.0f ops/sec)\n", r.Total(), r.Duration, float64(r.Total())/r.Duration.Seconds())
+	for t, n := range r.Ops {
+		if n == 0 {
+			continue
+		}
+		s += fmt.Sprintf("  %-7s %8d ops  avg %v\n", OpType(t), n, r.Latency[t]/time.Duration(n))
+	}
+	return s
+}
+
+// Load executes the generator's load phase against s.
+func Load(s Store, g *Generator) error {
+	for _, op := range g.LoadOps() {
+		if err := s.Write(op.Key, op.Value); err != nil {
+			return fmt.Errorf("failed to load %s: %w", op.Key, err)
+		}
+	}
+	return nil
+}
+
+// Run executes ops operations from g against s.
+func Run(s Store, g *Generator, ops int) (*Result, error) {
+	result := &Result{}
+	start := time.Now()
+	for i := 0; i < ops; i++ {
+		op := g.Next()
+		opStart := time.Now()
+		if err := apply(s, op); err != nil {
+			return nil, fmt.Errorf("failed to %s %s: %w", op.Type, op.Key, err)
+		}
+		result.Latency[op.Type] += time.Since(opStart)
+		result.Ops[op.Type]++
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+func apply(s Store, op Op) error {
+	switch op.Type {
+	case OpRead:
+		return s.Read(op.Key)
+	case OpScan:
+		return s.Scan(op.Key, op.ScanLength)
+	case OpReadModifyWrite:
+		if err := s.Read(op.Key); err != nil {
+			return err
+		}
+		return s.Write(op.Key, op.Value)
+	default:
+		return s.Write(op.Key, op.Value)
+	}
+}
+
+type dbStore struct {
+	db *db.DB
+}
+
+// NewDBStore adapts a database to the Store interface.
+func NewDBStore(d *db.DB) Store {
+	return &dbStore{db: d}
+}
+
+func (s *dbStore) Read(key []byte) error {
+	_, err := s.db.Get(key)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *dbStore) Write(key, value []byte) error {
+	return s.db.Put(key, value)
+}
+
+func (s *dbStore) Scan(start []byte, count int) error {
+	_, err := s.db.ScanRange(start, nil, nil, count)
+	return err
+}
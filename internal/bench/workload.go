@@ -0,0 +1,190 @@
+package bench
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+)
+
+// OpType is the kind of operation a workload issues.
+type OpType int
+
+const (
+	OpRead OpType = iota
+	OpUpdate
+	OpInsert
+	OpScan
+	OpReadModifyWrite
+	numOpTypes
+)
+
+func (t OpType) String() string {
+	switch t {
+	case OpRead:
+		return "read"
+	case OpUpdate:
+		return "update"
+	case OpInsert:
+		return "insert"
+	case OpScan:
+		return "scan"
+	case OpReadModifyWrite:
+		return "rmw"
+	default:
+		return fmt.Sprintf("OpType(%d)", int(t))
+	}
+}
+
+// Op is a single generated operation. Value is set for writes and ScanLength
+// for scans.
+type Op struct {
+	Type       OpType
+	Key        []byte
+	Value      []byte
+	ScanLength int
+}
+
+// Workload describes an operation mix in the style of YCSB core workloads.
+// Proportions are relative weights and need not sum to one.
+type Workload struct {
+	Name string
+
+	ReadProportion            float64
+	UpdateProportion          float64
+	InsertProportion          float64
+	ScanProportion            float64
+	ReadModifyWriteProportion float64
+
+	Distribution  Distribution
+	RecordCount   int // items written by the load phase
+	ValueSize     int
+	MaxScanLength int
+}
+
+// Standard returns YCSB core workload A through F (case-insensitive) with
+// the given record count, 100-byte values, and scans of up to 100 entries.
+func Standard(name string, recordCount int) (Workload, error) {
+	w := Workload{
+		Name:          strings.ToUpper(name),
+		Distribution:  Zipfian,
+		RecordCount:   recordCount,
+		ValueSize:     100,
+		MaxScanLength: 100,
+	}
+
+	switch w.Name {
+	case "A": // update heavy
+		w.ReadProportion, w.UpdateProportion = 0.5, 0.5
+	case "B": // read mostly
+		w.ReadProportion, w.UpdateProportion = 0.95, 0.05
+	case "C": // read only
+		w.ReadProportion = 1
+	case "D": // read latest
+		w.ReadProportion, w.InsertProportion = 0.95, 0.05
+		w.Distribution = Latest
+	case "E": // short ranges
+		w.ScanProportion, w.InsertProportion = 0.95, 0.05
+	case "F": // read-modify-write
+		w.ReadProportion, w.ReadModifyWriteProportion = 0.5, 0.5
+	default:
+		return Workload{}, fmt.Errorf("unknown workload %q (want A-F)", name)
+	}
+	return w, nil
+}
+
+// KeyName returns the key for item i. Item numbers are hashed so that keys,
+// and therefore hot items, are spread across the key space.
+func KeyName(i uint64) []byte {
+	h := fnv.New64a()
+	var buf [8]byte
+	for j := range buf {
+		buf[j] = byte(i >> (8 * j))
+	}
+	h.Write(buf[:])
+	return []byte(fmt.Sprintf("user%016x", h.Sum64()))
+}
+
+// Generator produces the operations of a workload. It is not safe for
+// concurrent use.
+type Generator struct {
+	w       Workload
+	r       *rand.Rand
+	chooser KeyChooser
+	weights [numOpTypes]float64
+	total   float64
+	items   uint64 // items inserted so far, including the load phase
+}
+
+// NewGenerator returns a generator for w seeded with seed.
+func NewGenerator(w Workload, seed int64) *Generator {
+	r := rand.New(rand.NewSource(seed))
+	g := &Generator{
+		w:       w,
+		r:       r,
+		chooser: NewKeyChooser(w.Distribution, r),
+		items:   uint64(w.RecordCount),
+	}
+	g.weights = [numOpTypes]float64{
+		OpRead:            w.ReadProportion,
+		OpUpdate:          w.UpdateProportion,
+		OpInsert:          w.InsertProportion,
+		OpScan:            w.ScanProportion,
+		OpReadModifyWrite: w.ReadModifyWriteProportion,
+	}
+	for _, weight := range g.weights {
+		g.total += weight
+	}
+	return g
+}
+
+// LoadOps returns the insert operations that populate the initial records.
+func (g *Generator) LoadOps() []Op {
+	ops := make([]Op, g.w.RecordCount)
+	for i := range ops {
+		ops[i] = Op{Type: OpInsert, Key: KeyName(uint64(i)), Value: g.value()}
+	}
+	return ops
+}
+
+// Next returns the next operation of the run phase.
+func (g *Generator) Next() Op {
+	op := Op{Type: g.pickType()}
+
+	if op.Type == OpInsert {
+		op.Key = KeyName(g.items)
+		g.items++
+	} else {
+		op.Key = KeyName(g.chooser.Next(g.items))
+	}
+
+	switch op.Type {
+	case OpUpdate, OpInsert, OpReadModifyWrite:
+		op.Value = g.value()
+	case OpScan:
+		op.ScanLength = 1 + g.r.Intn(max(g.w.MaxScanLength, 1))
+	}
+	return op
+}
+
+func (g *Generator) pickType() OpType {
+	if g.total == 0 {
+		return OpRead
+	}
+	x := g.r.Float64() * g.total
+	for t, weight := range g.weights {
+		if x < weight {
+			return OpType(t)
+		}
+		x -= weight
+	}
+	return OpRead
+}
+
+func (g *Generator) value() []byte {
+	v := make([]byte, g.w.ValueSize)
+	for i := range v {
+		v[i] = 'a' + byte(g.r.Intn(26))
+	}
+	return v
+}
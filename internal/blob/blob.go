@@ -0,0 +1,149 @@
+package blob
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sync"
+
+	"amethyst/internal/common"
+	"amethyst/internal/vfs"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type writerImpl struct {
+	fs     vfs.FS
+	path   string
+	fileNo common.FileNo
+	file   vfs.File
+	buf    *bufio.Writer
+	offset uint64
+}
+
+var _ Writer = (*writerImpl)(nil)
+
+// NewWriter creates the blob file fileNo at path.
+func NewWriter(fsys vfs.FS, path string, fileNo common.FileNo) (Writer, error) {
+	f, err := fsys.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	return &writerImpl{
+		fs:     fsys,
+		path:   path,
+		fileNo: fileNo,
+		file:   f,
+		buf:    bufio.NewWriter(f),
+	}, nil
+}
+
+func (w *writerImpl) Add(value []byte) (Handle, error) {
+	h := Handle{FileNo: w.fileNo, Offset: w.offset, Size: uint32(len(value))}
+	if _, err := common.WriteUint32(w.buf, crc32.Checksum(value, castagnoli)); err != nil {
+		return Handle{}, err
+	}
+	if _, err := w.buf.Write(value); err != nil {
+		return Handle{}, err
+	}
+	w.offset += 4 + uint64(len(value))
+	return h, nil
+}
+
+func (w *writerImpl) FileNo() common.FileNo {
+	return w.fileNo
+}
+
+func (w *writerImpl) Finish() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *writerImpl) Abort() error {
+	w.file.Close()
+	return w.fs.Remove(w.path)
+}
+
+type readerImpl struct {
+	mu    sync.Mutex
+	fs    vfs.FS
+	paths *common.PathManager
+	files map[common.FileNo]vfs.File
+}
+
+var _ Reader = (*readerImpl)(nil)
+
+// NewReader creates a reader for the blob files under paths.
+func NewReader(fsys vfs.FS, paths *common.PathManager) Reader {
+	return &readerImpl{
+		fs:    fsys,
+		paths: paths,
+		files: make(map[common.FileNo]vfs.File),
+	}
+}
+
+func (r *readerImpl) Get(h Handle) ([]byte, error) {
+	f, err := r.open(h.FileNo)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 4+int(h.Size))
+	if _, err := f.ReadAt(record, int64(h.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read %d.blob@%d: %w", h.FileNo, h.Offset, err)
+	}
+	value := record[4:]
+	if crc32.Checksum(value, castagnoli) != binary.LittleEndian.Uint32(record) {
+		return nil, fmt.Errorf("%w: %d.blob@%d", ErrCorrupt, h.FileNo, h.Offset)
+	}
+	return value, nil
+}
+
+func (r *readerImpl) open(fileNo common.FileNo) (vfs.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.files[fileNo]; ok {
+		return f, nil
+	}
+	f, err := r.fs.Open(r.paths.BlobPath(fileNo))
+	if err != nil {
+		return nil, err
+	}
+	r.files[fileNo] = f
+	return f, nil
+}
+
+func (r *readerImpl) Evict(fileNo common.FileNo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.files[fileNo]
+	if !ok {
+		return nil
+	}
+	delete(r.files, fileNo)
+	return f.Close()
+}
+
+func (r *readerImpl) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for fileNo, f := range r.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, fileNo)
+	}
+	return firstErr
+}
@@ -0,0 +1,82 @@
+package blob
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"amethyst/internal/common"
+)
+
+// ErrCorrupt is returned when a blob record fails its checksum or a handle
+// does not decode.
+var ErrCorrupt = errors.New("blob: corrupt record")
+
+// HandleSize is the encoded size of a Handle.
+const HandleSize = 20
+
+// Handle locates one value inside a blob file. Tables store the encoded
+// handle in place of values that were separated out.
+type Handle struct {
+	FileNo common.FileNo
+	Offset uint64 // offset of the record, not the value
+	Size   uint32 // length of the value
+}
+
+// Encode returns the handle's HandleSize-byte encoding.
+func (h Handle) Encode() []byte {
+	buf := make([]byte, HandleSize)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(h.FileNo))
+	binary.LittleEndian.PutUint64(buf[8:], h.Offset)
+	binary.LittleEndian.PutUint32(buf[16:], h.Size)
+	return buf
+}
+
+// DecodeHandle parses a handle produced by Encode.
+func DecodeHandle(data []byte) (Handle, error) {
+	if len(data) != HandleSize {
+		return Handle{}, ErrCorrupt
+	}
+	return Handle{
+		FileNo: common.FileNo(binary.LittleEndian.Uint64(data[0:])),
+		Offset: binary.LittleEndian.Uint64(data[8:]),
+		Size:   binary.LittleEndian.Uint32(data[16:]),
+	}, nil
+}
+
+// Writer appends values to a new blob file.
+type Writer interface {
+	// Add appends value and returns its handle.
+	Add(value []byte) (Handle, error)
+
+	// FileNo returns the number of the file being written.
+	FileNo() common.FileNo
+
+	// Finish flushes, syncs, and closes the file. Handles returned by Add
+	// are only durable once Finish succeeds.
+	Finish() error
+
+	// Abort closes and removes the file.
+	Abort() error
+}
+
+// Reader reads values from blob files, keeping files open between reads.
+type Reader interface {
+	// Get returns the value h points at, verifying its checksum.
+	Get(h Handle) ([]byte, error)
+
+	// Evict closes the file fileNo if it is open, ahead of its removal.
+	Evict(fileNo common.FileNo) error
+
+	// Close closes every open file.
+	Close() error
+}
+
+// Blob File Layout:
+//
+// ┌──────────────────┐
+// │     checksum     │  uint32 - CRC32C of value
+// ├──────────────────┤
+// │      value       │  []byte - length recorded in the handle
+// ├──────────────────┤
+// │       ...        │  one record per value
+// └──────────────────┘
@@ -0,0 +1,63 @@
+package blob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"amethyst/internal/common"
+	"amethyst/internal/vfs"
+)
+
+func TestWriterReader(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	paths := common.NewPathManager(t.TempDir())
+	require.NoError(t, fsys.MkdirAll(paths.BlobDir(), 0755))
+
+	w, err := NewWriter(fsys, paths.BlobPath(7), 7)
+	require.NoError(t, err)
+	values := [][]byte{[]byte("first"), {}, []byte("third value")}
+	var handles []Handle
+	for _, v := range values {
+		h, err := w.Add(v)
+		require.NoError(t, err)
+		handles = append(handles, h)
+	}
+	require.NoError(t, w.Finish())
+
+	r := NewReader(fsys, paths)
+	defer r.Close()
+	for i, h := range handles {
+		require.Equal(t, common.FileNo(7), h.FileNo)
+		decoded, err := DecodeHandle(h.Encode())
+		require.NoError(t, err)
+		require.Equal(t, h, decoded)
+
+		got, err := r.Get(decoded)
+		require.NoError(t, err)
+		require.Equal(t, string(values[i]), string(got))
+	}
+
+	_, err = DecodeHandle([]byte("short"))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// A handle that is off by a byte fails its checksum
+	bad := handles[2]
+	bad.Offset++
+	bad.Size--
+	_, err = r.Get(bad)
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// Evicted files are reopened on demand; aborted files are gone
+	require.NoError(t, r.Evict(7))
+	_, err = r.Get(handles[0])
+	require.NoError(t, err)
+
+	w, err = NewWriter(fsys, paths.BlobPath(8), 8)
+	require.NoError(t, err)
+	_, err = w.Add([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, w.Abort())
+	_, err = fsys.Stat(paths.BlobPath(8))
+	require.Error(t, err)
+}
@@ -6,20 +6,27 @@ import (
 	"amethyst/internal/common"
 )
 
+// entryOverhead approximates the memory a parsed entry holds beyond its key
+// and value: the Entry struct and its pointer in the block.
+const entryOverhead = 64
+
 // blockImpl parses and stores all entries from a data block for fast lookups.
+// It reads the plain blocks of tables written before restart blocks.
 type blockImpl struct {
 	entries []*common.Entry // sorted by key
+	size    int
 }
 
 var _ Block = (*blockImpl)(nil)
 
-// NewBlock parses a raw data block into memory.
-func NewBlock(data []byte) (Block, error) {
+// NewBlock parses a raw plain data block of entries in format into memory.
+func NewBlock(data []byte, format common.EntryFormat) (Block, error) {
 	var entries []*common.Entry
+	size := 0
 	reader := bytes.NewReader(data)
 
 	for {
-		entry, err := common.ReadEntry(reader)
+		entry, err := common.ReadEntryFormat(reader, format)
 		if err != nil {
 			return nil, err
 		}
@@ -27,9 +34,10 @@ func NewBlock(data []byte) (Block, error) {
 			break // Clean end of stream
 		}
 		entries = append(entries, entry)
+		size += entryOverhead + len(entry.Key) + len(entry.Value)
 	}
 
-	return &blockImpl{entries: entries}, nil
+	return &blockImpl{entries: entries, size: size}, nil
 }
 
 // Get performs binary search to find the entry for the given key.
@@ -49,7 +57,33 @@ func (b *blockImpl) Get(key []byte) (*common.Entry, bool) {
 	return nil, false
 }
 
+// Iterator returns copies of the block's entries in order.
+func (b *blockImpl) Iterator() common.EntryIterator {
+	return &sliceIterator{entries: b.entries}
+}
+
 // Len returns the number of entries in this block.
 func (b *blockImpl) Len() int {
 	return len(b.entries)
 }
+
+// Size returns the approximate memory held by this block.
+func (b *blockImpl) Size() int {
+	return b.size
+}
+
+// sliceIterator returns a copy of each of entries in turn, so callers can't
+// disturb the block's own.
+type sliceIterator struct {
+	entries []*common.Entry
+}
+
+func (it *sliceIterator) Next() (*common.Entry, error) {
+	if len(it.entries) == 0 {
+		return nil, nil
+	}
+	entry := *it.entries[0]
+	entry.Key, entry.Value = bytes.Clone(entry.Key), bytes.Clone(entry.Value)
+	it.entries = it.entries[1:]
+	return &entry, nil
+}
@@ -14,4 +14,11 @@ type Block interface {
 
 	// Len returns the number of entries in this block.
 	Len() int
+
+	// Iterator returns the block's entries in order. Each is a copy, so it
+	// is the caller's to modify.
+	Iterator() common.EntryIterator
+
+	// Size returns the approximate memory held by the parsed block, in bytes.
+	Size() int
 }
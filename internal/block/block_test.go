@@ -20,7 +20,7 @@ func testBlockWithEntries(t *testing.T, n int) {
 		key := fmt.Sprintf("key_%02d", i)
 		entries[i] = &common.Entry{
 			Type:  common.EntryTypePut,
-			Seq:   uint32(i + 1),
+			Seq:   uint64(i + 1),
 			Key:   []byte(key),
 			Value: []byte(fmt.Sprintf("value_%02d", i)),
 		}
@@ -34,7 +34,7 @@ func testBlockWithEntries(t *testing.T, n int) {
 	}
 
 	// Parse the block
-	block, err := NewBlock(buf.Bytes())
+	block, err := NewBlock(buf.Bytes(), common.CurrentEntryFormat)
 	require.NoError(t, err)
 
 	// Verify all entries can be found
@@ -76,7 +76,7 @@ func TestBlockPartialSize(t *testing.T) {
 }
 
 func TestBlockEmpty(t *testing.T) {
-	block, err := NewBlock([]byte{})
+	block, err := NewBlock([]byte{}, common.CurrentEntryFormat)
 	require.NoError(t, err)
 
 	found, ok := block.Get([]byte("any"))
@@ -97,7 +97,7 @@ func TestBlockWithTombstone(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	block, err := NewBlock(buf.Bytes())
+	block, err := NewBlock(buf.Bytes(), common.CurrentEntryFormat)
 	require.NoError(t, err)
 
 	// Verify tombstone is found
@@ -105,5 +105,96 @@ func TestBlockWithTombstone(t *testing.T) {
 	require.True(t, ok)
 	require.NotNil(t, found)
 	require.Equal(t, common.EntryTypeDelete, found.Type)
-	require.Equal(t, uint32(2), found.Seq)
+	require.Equal(t, uint64(2), found.Seq)
+}
+
+func TestBlockIterator(t *testing.T) {
+	var buf bytes.Buffer
+	entries := make([]*common.Entry, 3)
+	for i := range entries {
+		entries[i] = &common.Entry{Type: common.EntryTypePut, Seq: uint64(i + 1), Key: []byte{'a' + byte(i)}, Value: []byte{'1' + byte(i)}}
+		_, err := common.WriteEntry(&buf, entries[i])
+		require.NoError(t, err)
+	}
+	block, err := NewBlock(buf.Bytes(), common.CurrentEntryFormat)
+	require.NoError(t, err)
+
+	iter := block.Iterator()
+	first, err := iter.Next()
+	require.NoError(t, err)
+	first.Seq, first.Value[0] = 99, 'x'
+	found, ok := block.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, uint64(1), found.Seq, "iterator entries are copies")
+	require.Equal(t, []byte("1"), found.Value)
+
+	common.RequireMatchesIterator(t, block.Iterator(), entries)
+}
+
+func TestRestartBlock(t *testing.T) {
+	for _, n := range []int{0, 1, RESTART_INTERVAL, RESTART_INTERVAL + 1, BLOCK_SIZE} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			var b Builder
+			entries := make([]*common.Entry, n)
+			for i := range entries {
+				entries[i] = &common.Entry{
+					Type:      common.EntryTypePut,
+					Seq:       uint64(i + 1),
+					Timestamp: int64(1700000000000000000 + i),
+					ExpiresAt: int64(i % 2),
+					Key:       []byte(fmt.Sprintf("key_%02d", i)),
+					Value:     []byte(fmt.Sprintf("value_%02d", i)),
+				}
+				if i%5 == 0 {
+					entries[i].Type, entries[i].Value = common.EntryTypeDelete, nil
+				}
+				b.Add(entries[i])
+			}
+			data := bytes.Clone(b.Finish())
+			require.Zero(t, b.Len())
+
+			block, err := NewRestartBlock(data)
+			require.NoError(t, err)
+			require.Equal(t, n, block.Len())
+			for _, want := range entries {
+				found, ok := block.Get(want.Key)
+				require.True(t, ok, "key %s should be found", want.Key)
+				require.Equal(t, want, found)
+			}
+			for _, neg := range []string{"", "aaa", "key_00_extra", "key_99", "missing"} {
+				found, ok := block.Get([]byte(neg))
+				require.False(t, ok, "key %s should not be found", neg)
+				require.Nil(t, found)
+			}
+
+			iter, err := NewRestartIterator(data)
+			require.NoError(t, err)
+			common.RequireMatchesIterator(t, iter, entries)
+			common.RequireMatchesIterator(t, block.Iterator(), entries)
+		})
+	}
+}
+
+func TestRestartBlockCorrupt(t *testing.T) {
+	var b Builder
+	for i := range 2 * RESTART_INTERVAL {
+		b.Add(&common.Entry{Type: common.EntryTypePut, Key: []byte(fmt.Sprintf("key_%02d", i))})
+	}
+	data := b.Finish()
+
+	_, err := NewRestartBlock(data[:4])
+	require.ErrorIs(t, err, ErrCorruptBlock)
+
+	// A restart count larger than the block
+	bad := bytes.Clone(data)
+	bad[len(bad)-4] = 0xff
+	_, err = NewRestartBlock(bad)
+	require.ErrorIs(t, err, ErrCorruptBlock)
+
+	// Restart offsets out of order
+	bad = bytes.Clone(data)
+	restarts := len(bad) - 8 - 8
+	copy(bad[restarts+4:restarts+8], []byte{0, 0, 0, 0})
+	_, err = NewRestartBlock(bad)
+	require.ErrorIs(t, err, ErrCorruptBlock)
 }
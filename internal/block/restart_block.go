@@ -0,0 +1,295 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"amethyst/internal/common"
+)
+
+// Restart Block Layout:
+//
+// ┌──────────────────┐
+// │     Entry 0      │  restart point: key stored in full
+// ├──────────────────┤
+// │     Entry 1      │  key stored as a suffix of the previous key
+// ├──────────────────┤
+// │       ...        │
+// ├──────────────────┤
+// │     Entry N      │
+// ├──────────────────┤
+// │     Restarts     │  uint32 offset of each restart point
+// ├──────────────────┤
+// │   Entry Count    │  uint32
+// ├──────────────────┤
+// │  Restart Count   │  uint32
+// └──────────────────┘
+//
+// Entry Layout:
+//
+// ┌──────────────────┐
+// │      shared      │  uvarint - bytes of key shared with the previous key; 0 at restarts
+// ├──────────────────┤
+// │     unshared     │  uvarint - bytes of key that follow
+// ├──────────────────┤
+// │     valueLen     │  uvarint
+// ├──────────────────┤
+// │    entryType     │  uint8
+// ├──────────────────┤
+// │       seq        │  uvarint
+// ├──────────────────┤
+// │    timestamp     │  uint64
+// ├──────────────────┤
+// │    expiresAt     │  uvarint
+// ├──────────────────┤
+// │   key suffix     │  []byte
+// ├──────────────────┤
+// │      value       │  []byte
+// └──────────────────┘
+
+// RESTART_INTERVAL is how many entries share a restart point.
+const RESTART_INTERVAL = 16
+
+// restartTrailerSize is the size of the entry and restart counts ending a
+// restart block.
+const restartTrailerSize = 8
+
+// restartBlockOverhead approximates the memory a restart block holds beyond
+// its raw bytes.
+const restartBlockOverhead = 64
+
+// ErrCorruptBlock is returned for a restart block that can't be decoded.
+var ErrCorruptBlock = errors.New("block: corrupt restart block")
+
+// Builder encodes sorted entries into a restart block.
+type Builder struct {
+	buf      []byte
+	restarts []uint32
+	count    int
+	lastKey  []byte
+}
+
+// Add appends entry, which must sort after every entry added before it.
+func (b *Builder) Add(entry *common.Entry) {
+	shared := 0
+	if b.count%RESTART_INTERVAL == 0 {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+	} else {
+		for shared < len(entry.Key) && shared < len(b.lastKey) && entry.Key[shared] == b.lastKey[shared] {
+			shared++
+		}
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Value)))
+	b.buf = append(b.buf, uint8(entry.Type))
+	b.buf = binary.AppendUvarint(b.buf, entry.Seq)
+	b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(entry.Timestamp))
+	b.buf = binary.AppendUvarint(b.buf, uint64(entry.ExpiresAt))
+	b.buf = append(b.buf, entry.Key[shared:]...)
+	b.buf = append(b.buf, entry.Value...)
+	b.lastKey = append(b.lastKey[:0], entry.Key...)
+	b.count++
+}
+
+// Len returns the number of entries added since the last Finish.
+func (b *Builder) Len() int {
+	return b.count
+}
+
+// Finish appends the restart array and counts and returns the block, which
+// stays valid until the next Add. The builder is then empty.
+func (b *Builder) Finish() []byte {
+	block := b.buf
+	for _, r := range b.restarts {
+		block = binary.LittleEndian.AppendUint32(block, r)
+	}
+	block = binary.LittleEndian.AppendUint32(block, uint32(b.count))
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(b.restarts)))
+
+	b.buf, b.restarts, b.count, b.lastKey = block[:0], b.restarts[:0], 0, b.lastKey[:0]
+	return block
+}
+
+// restartBlock looks entries up in the raw bytes of a restart block,
+// decoding only the restart keys a binary search visits and the entries
+// after the restart point it lands on.
+type restartBlock struct {
+	data     []byte // entries, without the restart array and counts
+	restarts []byte // restart offsets, 4 bytes each
+	count    int
+}
+
+var _ Block = (*restartBlock)(nil)
+
+// NewRestartBlock wraps the raw bytes of a restart block for lookups,
+// checking only its restart array. data must not be modified afterwards.
+func NewRestartBlock(data []byte) (Block, error) {
+	return parseRestartBlock(data)
+}
+
+// NewRestartIterator returns the entries of the raw restart block data in
+// order. Each is decoded as it is returned, so they are the caller's to
+// modify.
+func NewRestartIterator(data []byte) (common.EntryIterator, error) {
+	b, err := parseRestartBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	return &decoder{data: b.data}, nil
+}
+
+func parseRestartBlock(data []byte) (*restartBlock, error) {
+	if len(data) < restartTrailerSize {
+		return nil, fmt.Errorf("%w: %d bytes is too short", ErrCorruptBlock, len(data))
+	}
+	count := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	numRestarts := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	end := len(data) - restartTrailerSize - 4*numRestarts
+	if numRestarts < 0 || end < 0 || (numRestarts == 0) != (count == 0) {
+		return nil, fmt.Errorf("%w: bad restart count %d", ErrCorruptBlock, numRestarts)
+	}
+	b := &restartBlock{data: data[:end], restarts: data[end : end+4*numRestarts], count: count}
+	for i := range numRestarts {
+		if off := b.restart(i); off >= end || (i == 0 && off != 0) || (i > 0 && off <= b.restart(i-1)) {
+			return nil, fmt.Errorf("%w: bad restart offset %d", ErrCorruptBlock, off)
+		}
+	}
+	return b, nil
+}
+
+func (b *restartBlock) restart(i int) int {
+	return int(binary.LittleEndian.Uint32(b.restarts[4*i:]))
+}
+
+// Get binary searches the restart points for the last one whose key is at
+// most key, then scans forward from it.
+func (b *restartBlock) Get(key []byte) (*common.Entry, bool) {
+	numRestarts := len(b.restarts) / 4
+	left, right := 0, numRestarts
+	for left < right {
+		mid := (left + right) / 2
+		d := decoder{data: b.data, pos: b.restart(mid)}
+		entry, err := d.next()
+		if err != nil {
+			return nil, false
+		}
+		if bytes.Compare(entry.Key, key) <= 0 {
+			left = mid + 1
+		} else {
+			right = mid
+		}
+	}
+	if left == 0 {
+		return nil, false
+	}
+
+	d := decoder{data: b.data, pos: b.restart(left - 1)}
+	end := len(b.data)
+	if left < numRestarts {
+		end = b.restart(left)
+	}
+	for d.pos < end {
+		entry, err := d.next()
+		if err != nil {
+			return nil, false
+		}
+		switch cmp := bytes.Compare(entry.Key, key); {
+		case cmp == 0:
+			return entry, true
+		case cmp > 0:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// Iterator decodes the block's entries in order, each afresh.
+func (b *restartBlock) Iterator() common.EntryIterator {
+	return &decoder{data: b.data}
+}
+
+// Len returns the number of entries in this block.
+func (b *restartBlock) Len() int {
+	return b.count
+}
+
+// Size returns the approximate memory held by this block.
+func (b *restartBlock) Size() int {
+	return restartBlockOverhead + len(b.data) + len(b.restarts) + restartTrailerSize
+}
+
+// decoder decodes the entries of a restart block in order from pos, which
+// must be a restart point.
+type decoder struct {
+	data []byte
+	pos  int
+	key  []byte
+}
+
+var _ common.EntryIterator = (*decoder)(nil)
+
+// Next returns the next entry, or nil at the end of the block.
+func (d *decoder) Next() (*common.Entry, error) {
+	if d.pos >= len(d.data) {
+		return nil, nil
+	}
+	return d.next()
+}
+
+func (d *decoder) next() (*common.Entry, error) {
+	start := d.pos
+	shared, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	unshared, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	valueLen, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("%w: entry at %d is truncated", ErrCorruptBlock, start)
+	}
+	entry := &common.Entry{Type: common.EntryType(d.data[d.pos])}
+	d.pos++
+	if entry.Seq, err = d.uvarint(); err != nil {
+		return nil, err
+	}
+	if len(d.data)-d.pos < 8 {
+		return nil, fmt.Errorf("%w: entry at %d is truncated", ErrCorruptBlock, start)
+	}
+	entry.Timestamp = int64(binary.LittleEndian.Uint64(d.data[d.pos:]))
+	d.pos += 8
+	expiresAt, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	entry.ExpiresAt = int64(expiresAt)
+
+	if shared > uint64(len(d.key)) || uint64(len(d.data)-d.pos) < unshared+valueLen {
+		return nil, fmt.Errorf("%w: entry at %d overruns the block", ErrCorruptBlock, start)
+	}
+	d.key = append(d.key[:shared], d.data[d.pos:d.pos+int(unshared)]...)
+	d.pos += int(unshared)
+	entry.Key = bytes.Clone(d.key)
+	if valueLen > 0 {
+		entry.Value = bytes.Clone(d.data[d.pos : d.pos+int(valueLen)])
+		d.pos += int(valueLen)
+	}
+	return entry, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: bad varint at %d", ErrCorruptBlock, d.pos)
+	}
+	d.pos += n
+	return v, nil
+}
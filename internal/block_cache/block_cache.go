@@ -1,24 +1,179 @@
 package block_cache
 
 import (
-	"amethyst/internal/block"
+	"container/list"
+	"sync"
+
 	"amethyst/internal/common"
 )
 
-// lruCache is a placeholder LRU cache implementation.
-type lruCache struct{}
+// DefaultCapacity is the block cache size used when none is configured.
+const DefaultCapacity = 8 << 20
+
+type cacheKey struct {
+	fileNo  common.FileNo
+	blockNo common.BlockNo
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	block Value
+	size  int64
+	pins  int
+}
+
+// lruCache evicts the least recently used blocks once the blocks it holds
+// exceed its capacity in bytes.
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int64
+	usage    int64
+	order    *list.List // front is most recently used
+	entries  map[cacheKey]*list.Element
+	stats    Stats
+}
 
 var _ BlockCache = (*lruCache)(nil)
 
-// NewBlockCache creates a new block cache.
-func NewBlockCache() BlockCache {
-	return &lruCache{}
+// NewBlockCache creates an LRU block cache holding up to capacity bytes of
+// blocks. A capacity of 0 or less caches nothing.
+func NewBlockCache(capacity int64) BlockCache {
+	return NewBlockCacheWithPolicy(capacity, PolicyLRU)
+}
+
+// NewBlockCacheWithPolicy is like NewBlockCache but evicts blocks by
+// policy. The cache is split into as many as MAX_SHARDS shards of at least
+// MIN_SHARD_CAPACITY bytes.
+func NewBlockCacheWithPolicy(capacity int64, policy Policy) BlockCache {
+	shards := 1
+	for shards < MAX_SHARDS && capacity/int64(2*shards) >= MIN_SHARD_CAPACITY {
+		shards *= 2
+	}
+	return NewShardedBlockCache(capacity, shards, policy)
+}
+
+// newShard creates a single-shard cache evicting by policy.
+func newShard(capacity int64, policy Policy) BlockCache {
+	switch policy {
+	case PolicyClock:
+		return newClockCache(capacity)
+	case PolicyTinyLFU:
+		return newTinyLFUCache(capacity)
+	default:
+		return newLRUCache(capacity)
+	}
+}
+
+// hashKey mixes a block's file and offset into 64 well-spread bits.
+func hashKey(key cacheKey) uint64 {
+	h := uint64(key.fileNo)*0x9e3779b97f4a7c15 ^ uint64(key.blockNo)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
+
+func newLRUCache(capacity int64) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).block, true
+}
+
+func (c *lruCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b Value) {
+	size := int64(b.Size())
+	// A block larger than the whole cache would only evict everything else
+	if size > c.capacity {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A replaced block's pins carry over to its replacement
+	key := cacheKey{fileNo, blockNo}
+	pins := 0
+	if elem, ok := c.entries[key]; ok {
+		pins = elem.Value.(*cacheEntry).pins
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, block: b, size: size, pins: pins})
+	c.usage += size
+	c.stats.Inserts++
+	c.evict()
+}
+
+func (c *lruCache) Pin(fileNo common.FileNo, blockNo common.BlockNo) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if ok {
+		elem.Value.(*cacheEntry).pins++
+	}
+	return ok
+}
+
+func (c *lruCache) Unpin(fileNo common.FileNo, blockNo common.BlockNo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if !ok {
+		return
+	}
+	if entry := elem.Value.(*cacheEntry); entry.pins > 0 {
+		if entry.pins--; entry.pins == 0 {
+			c.evict()
+		}
+	}
+}
+
+// evict drops unpinned blocks, least recently used first, until the cache
+// is within its capacity or only pinned blocks are left.
+// Must be called with c.mu held.
+func (c *lruCache) evict() {
+	for elem := c.order.Back(); elem != nil && c.usage > c.capacity; {
+		prev := elem.Prev()
+		if elem.Value.(*cacheEntry).pins == 0 {
+			c.remove(elem)
+			c.stats.Evictions++
+		}
+		elem = prev
+	}
+}
+
+func (c *lruCache) Usage() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage
 }
 
-func (c *lruCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (block.Block, bool) {
-	return nil, false
+func (c *lruCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
 }
 
-func (c *lruCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b block.Block) {
-	// No-op
+// remove drops elem from the cache.
+// Must be called with c.mu held.
+func (c *lruCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.usage -= entry.size
 }
@@ -1,15 +1,103 @@
 package block_cache
 
 import (
-	"amethyst/internal/block"
+	"fmt"
+
 	"amethyst/internal/common"
 )
 
-// BlockCache provides shared LRU block caching across multiple SSTables.
+// Value is what the cache holds for a block: a parsed data block, or the
+// index partition of a table with a partitioned index.
+type Value interface {
+	// Size returns the approximate memory held by the value, in bytes.
+	Size() int
+}
+
+// BlockCache provides shared block caching across multiple SSTables.
+// Implementations must be safe for concurrent use.
 type BlockCache interface {
 	// Get retrieves a block from the cache. Returns (block, true) if found, (nil, false) if not.
-	Get(fileNo common.FileNo, blockNo common.BlockNo) (block.Block, bool)
+	Get(fileNo common.FileNo, blockNo common.BlockNo) (Value, bool)
+
+	// Put stores a block in the cache, evicting blocks chosen by the
+	// cache's Policy if it no longer fits.
+	Put(fileNo common.FileNo, blockNo common.BlockNo, b Value)
+
+	// Pin keeps the block in the cache, if it is there, until Unpin is
+	// called for it as many times as Pin reported true. Pinned blocks count
+	// toward Usage, which may exceed the capacity while they are held. Pin
+	// isn't counted as a lookup.
+	Pin(fileNo common.FileNo, blockNo common.BlockNo) bool
+
+	// Unpin releases a pin taken by Pin.
+	Unpin(fileNo common.FileNo, blockNo common.BlockNo)
+
+	// Usage returns the combined size of the cached blocks, in bytes.
+	Usage() int64
+
+	// Stats returns the cache's counters since it was created.
+	Stats() Stats
+}
+
+// Policy chooses which blocks a full cache evicts.
+type Policy uint8
+
+const (
+	// PolicyLRU evicts the least recently used block.
+	PolicyLRU Policy = iota
+	// PolicyClock approximates LRU with a reference bit per block, which a
+	// hit sets under a shared lock, so concurrent hits don't serialize.
+	// Blocks read only once are evicted before ones read again.
+	PolicyClock
+	// PolicyTinyLFU (W-TinyLFU) passes new blocks through a small LRU
+	// window and admits them to the main cache only if they've been read
+	// more often recently than the block they would evict. A long scan of
+	// blocks read once can't flush the working set, as it does under LRU.
+	PolicyTinyLFU
+)
+
+// String returns the policy's name, e.g. "lru".
+func (p Policy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyClock:
+		return "clock"
+	case PolicyTinyLFU:
+		return "tinylfu"
+	default:
+		return fmt.Sprintf("policy(%d)", uint8(p))
+	}
+}
+
+// Stats counts block cache lookups and changes.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+
+	// Inserts counts the blocks stored by Put, and Evictions the blocks
+	// dropped to make room for others. Evictions close behind Inserts mean
+	// the working set doesn't fit. Blocks too large for the cache count as
+	// neither.
+	Inserts   uint64
+	Evictions uint64
+}
+
+// add returns the sum of s and other.
+func (s Stats) add(other Stats) Stats {
+	return Stats{
+		Hits:      s.Hits + other.Hits,
+		Misses:    s.Misses + other.Misses,
+		Inserts:   s.Inserts + other.Inserts,
+		Evictions: s.Evictions + other.Evictions,
+	}
+}
 
-	// Put stores a block in the cache.
-	Put(fileNo common.FileNo, blockNo common.BlockNo, b block.Block)
+// HitRate returns the share of lookups that found their block, or 0 before
+// any lookup.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
@@ -0,0 +1,108 @@
+package block_cache
+
+import (
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+// sizedBlock is an empty block that reports a fixed size.
+type sizedBlock int
+
+func (sizedBlock) Get(key []byte) (*common.Entry, bool) { return nil, false }
+func (sizedBlock) Len() int                             { return 0 }
+func (b sizedBlock) Size() int                          { return int(b) }
+
+func TestLRUEviction(t *testing.T) {
+	cache := NewBlockCache(300)
+	cache.Put(1, 0, sizedBlock(100))
+	cache.Put(1, 1, sizedBlock(100))
+	cache.Put(2, 0, sizedBlock(100))
+	require.Equal(t, int64(300), cache.Usage())
+
+	// Touching block 1/0 leaves 1/1 as the least recently used
+	_, ok := cache.Get(1, 0)
+	require.True(t, ok)
+	cache.Put(2, 1, sizedBlock(150))
+
+	tests := []struct {
+		fileNo  common.FileNo
+		blockNo common.BlockNo
+		cached  bool
+	}{
+		{1, 0, true},
+		{1, 1, false},
+		{2, 0, false},
+		{2, 1, true},
+	}
+	for _, tt := range tests {
+		_, ok := cache.Get(tt.fileNo, tt.blockNo)
+		require.Equal(t, tt.cached, ok, "block %d/%d", tt.fileNo, tt.blockNo)
+	}
+	require.Equal(t, int64(250), cache.Usage())
+	require.Equal(t, uint64(4), cache.Stats().Inserts)
+	require.Equal(t, uint64(2), cache.Stats().Evictions)
+}
+
+func TestBlockCacheSizeAccounting(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int64
+		puts     []int
+		usage    int64
+	}{
+		{"replacing a block frees the old one", 100, []int{60, 40}, 40},
+		{"block larger than the cache is not cached", 100, []int{150}, 0},
+		{"zero capacity caches nothing", 0, []int{1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewBlockCache(tt.capacity)
+			for _, size := range tt.puts {
+				cache.Put(1, 0, sizedBlock(size))
+			}
+			require.Equal(t, tt.usage, cache.Usage())
+		})
+	}
+}
+
+func TestBlockCachePinning(t *testing.T) {
+	for _, policy := range []Policy{PolicyLRU, PolicyClock, PolicyTinyLFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			cache := newShard(300, policy)
+			cached := func() bool {
+				if !cache.Pin(1, 0) {
+					return false
+				}
+				cache.Unpin(1, 0)
+				return true
+			}
+			// Blocks read more often than 1/0, which would displace it
+			fill := func(fileNo common.FileNo) {
+				for i := range common.BlockNo(5) {
+					cache.Get(fileNo, i)
+					cache.Get(fileNo, i)
+					cache.Put(fileNo, i, sizedBlock(100))
+				}
+			}
+
+			require.False(t, cache.Pin(1, 0), "uncached blocks can't be pinned")
+			cache.Put(1, 0, sizedBlock(100))
+			require.True(t, cache.Pin(1, 0))
+			require.True(t, cache.Pin(1, 0))
+			fill(2)
+			require.True(t, cached(), "pinned block should stay cached")
+
+			// Pins nest, so the block stays until every one is released
+			cache.Unpin(1, 0)
+			fill(3)
+			require.True(t, cached())
+
+			cache.Unpin(1, 0)
+			fill(4)
+			require.False(t, cached(), "unpinned block should be evictable")
+			require.LessOrEqual(t, cache.Usage(), int64(300))
+		})
+	}
+}
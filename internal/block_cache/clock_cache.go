@@ -0,0 +1,175 @@
+package block_cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"amethyst/internal/common"
+)
+
+type clockEntry struct {
+	key        cacheKey
+	block      Value
+	size       int64
+	referenced atomic.Bool
+	pins       int // guarded by mu held exclusively
+}
+
+// clockCache keeps blocks on a ring swept by a clock hand. A hit only sets
+// the block's reference bit; when the cache is over capacity the hand
+// clears set bits as it passes and evicts the first block whose bit is
+// already clear. New blocks join the ring just behind the hand with their
+// bit clear, so a block read once is evicted on the hand's next pass.
+type clockCache struct {
+	mu        sync.RWMutex // exclusive for changes to the ring; shared for hits
+	capacity  int64
+	usage     int64
+	ring      *list.List
+	hand      *list.Element // next block to consider; nil if the ring is empty
+	entries   map[cacheKey]*list.Element
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	inserts   uint64 // guarded by mu, like evictions
+	evictions uint64
+}
+
+var _ BlockCache = (*clockCache)(nil)
+
+func newClockCache(capacity int64) *clockCache {
+	return &clockCache{
+		capacity: capacity,
+		ring:     list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *clockCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (Value, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	entry := elem.Value.(*clockEntry)
+	entry.referenced.Store(true)
+	return entry.block, true
+}
+
+func (c *clockCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b Value) {
+	size := int64(b.Size())
+	// A block larger than the whole cache would only evict everything else
+	if size > c.capacity {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A replaced block's pins carry over to its replacement
+	key := cacheKey{fileNo, blockNo}
+	entry := &clockEntry{key: key, block: b, size: size}
+	if elem, ok := c.entries[key]; ok {
+		entry.pins = elem.Value.(*clockEntry).pins
+		c.remove(elem)
+	}
+	var elem *list.Element
+	if c.hand == nil {
+		elem = c.ring.PushBack(entry)
+	} else {
+		elem = c.ring.InsertBefore(entry, c.hand)
+	}
+	c.entries[key] = elem
+	c.usage += size
+	c.inserts++
+	c.evict(elem)
+}
+
+func (c *clockCache) Pin(fileNo common.FileNo, blockNo common.BlockNo) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if ok {
+		elem.Value.(*clockEntry).pins++
+	}
+	return ok
+}
+
+func (c *clockCache) Unpin(fileNo common.FileNo, blockNo common.BlockNo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if !ok {
+		return
+	}
+	if entry := elem.Value.(*clockEntry); entry.pins > 0 {
+		if entry.pins--; entry.pins == 0 {
+			c.evict(nil)
+		}
+	}
+}
+
+// evict sweeps the hand until the cache is within its capacity. keep, the
+// block being added if any, is passed over so it isn't evicted to make room
+// for itself, as are pinned blocks. The sweep gives up once it has gone
+// twice around the ring without evicting, which only happens when every
+// remaining block is pinned or kept.
+// Must be called with c.mu held exclusively.
+func (c *clockCache) evict(keep *list.Element) {
+	for passed := 0; c.usage > c.capacity && passed < 2*c.ring.Len(); {
+		if c.hand == nil {
+			c.hand = c.ring.Front()
+		}
+		if e := c.hand.Value.(*clockEntry); c.hand == keep || e.pins > 0 {
+			c.hand = c.next(c.hand)
+			passed++
+		} else if e.referenced.Load() {
+			e.referenced.Store(false)
+			c.hand = c.next(c.hand)
+			passed++
+		} else {
+			c.remove(c.hand)
+			c.evictions++
+			passed = 0
+		}
+	}
+}
+
+func (c *clockCache) Usage() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.usage
+}
+
+func (c *clockCache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Inserts: c.inserts, Evictions: c.evictions}
+}
+
+// next returns the element after elem on the ring.
+func (c *clockCache) next(elem *list.Element) *list.Element {
+	if n := elem.Next(); n != nil {
+		return n
+	}
+	return c.ring.Front()
+}
+
+// remove drops elem from the cache, advancing the hand past it.
+// Must be called with c.mu held exclusively.
+func (c *clockCache) remove(elem *list.Element) {
+	if elem == c.hand {
+		c.hand = c.next(elem)
+		if c.hand == elem {
+			c.hand = nil
+		}
+	}
+	entry := c.ring.Remove(elem).(*clockEntry)
+	delete(c.entries, entry.key)
+	c.usage -= entry.size
+}
@@ -0,0 +1,55 @@
+package block_cache
+
+import (
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockEvictsUnreferencedBlocks(t *testing.T) {
+	cache := newClockCache(300)
+	cache.Put(1, 0, sizedBlock(100))
+	cache.Put(1, 1, sizedBlock(100))
+	cache.Put(1, 2, sizedBlock(100))
+
+	// Blocks 1/0 and 1/2 are read again, so the hand passes over them
+	_, ok := cache.Get(1, 0)
+	require.True(t, ok)
+	_, ok = cache.Get(1, 2)
+	require.True(t, ok)
+	cache.Put(2, 0, sizedBlock(100))
+
+	tests := []struct {
+		fileNo  common.FileNo
+		blockNo common.BlockNo
+		cached  bool
+	}{
+		{1, 0, true},
+		{1, 1, false},
+		{1, 2, true},
+		{2, 0, true},
+	}
+	for _, tt := range tests {
+		_, ok := cache.Get(tt.fileNo, tt.blockNo)
+		require.Equal(t, tt.cached, ok, "block %d/%d", tt.fileNo, tt.blockNo)
+	}
+	require.Equal(t, int64(300), cache.Usage())
+	require.Equal(t, Stats{Hits: 5, Misses: 1, Inserts: 4, Evictions: 1}, cache.Stats())
+}
+
+func TestClockReplaceAndEvictAll(t *testing.T) {
+	cache := newClockCache(100)
+	cache.Put(1, 0, sizedBlock(60))
+	cache.Put(1, 0, sizedBlock(40))
+	require.Equal(t, int64(40), cache.Usage())
+
+	// A referenced block still goes once the hand has cleared its bit
+	cache.Get(1, 0)
+	cache.Put(1, 1, sizedBlock(100))
+	require.Equal(t, int64(100), cache.Usage())
+	_, ok := cache.Get(1, 0)
+	require.False(t, ok)
+	_, ok = cache.Get(1, 1)
+	require.True(t, ok)
+}
@@ -0,0 +1,80 @@
+package block_cache
+
+import (
+	"math/bits"
+
+	"amethyst/internal/common"
+)
+
+const (
+	// MAX_SHARDS bounds how many shards NewBlockCache splits a cache into.
+	MAX_SHARDS = 16
+
+	// MIN_SHARD_CAPACITY is the smallest shard NewBlockCache makes, so
+	// small caches aren't split so finely that a few large blocks each fill
+	// a shard.
+	MIN_SHARD_CAPACITY = 512 << 10
+)
+
+// shardedCache spreads blocks over independently locked caches by the
+// hash of their (FileNo, BlockNo), so concurrent reads of different blocks
+// rarely wait on the same mutex. Each shard evicts on its own, from an
+// equal share of the capacity.
+type shardedCache struct {
+	shards []BlockCache
+	mask   uint64
+}
+
+var _ BlockCache = (*shardedCache)(nil)
+
+// NewShardedBlockCache creates a block cache holding up to capacity bytes
+// of blocks, split into shards shards, rounded up to a power of two, each
+// evicting by policy. A single shard is returned unwrapped.
+func NewShardedBlockCache(capacity int64, shards int, policy Policy) BlockCache {
+	if shards <= 1 {
+		return newShard(capacity, policy)
+	}
+	n := 1 << bits.Len(uint(shards-1))
+	c := &shardedCache{shards: make([]BlockCache, n), mask: uint64(n - 1)}
+	for i := range c.shards {
+		c.shards[i] = newShard(capacity/int64(n), policy)
+	}
+	return c
+}
+
+func (c *shardedCache) shard(fileNo common.FileNo, blockNo common.BlockNo) BlockCache {
+	// Blocks are keyed by offset, so both halves are mixed before masking
+	return c.shards[hashKey(cacheKey{fileNo, blockNo})&c.mask]
+}
+
+func (c *shardedCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (Value, bool) {
+	return c.shard(fileNo, blockNo).Get(fileNo, blockNo)
+}
+
+func (c *shardedCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b Value) {
+	c.shard(fileNo, blockNo).Put(fileNo, blockNo, b)
+}
+
+func (c *shardedCache) Pin(fileNo common.FileNo, blockNo common.BlockNo) bool {
+	return c.shard(fileNo, blockNo).Pin(fileNo, blockNo)
+}
+
+func (c *shardedCache) Unpin(fileNo common.FileNo, blockNo common.BlockNo) {
+	c.shard(fileNo, blockNo).Unpin(fileNo, blockNo)
+}
+
+func (c *shardedCache) Usage() int64 {
+	var usage int64
+	for _, s := range c.shards {
+		usage += s.Usage()
+	}
+	return usage
+}
+
+func (c *shardedCache) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats = stats.add(s.Stats())
+	}
+	return stats
+}
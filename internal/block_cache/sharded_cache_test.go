@@ -0,0 +1,79 @@
+package block_cache
+
+import (
+	"sync"
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBlockCacheShards(t *testing.T) {
+	tests := []struct {
+		capacity int64
+		shards   int
+	}{
+		{300, 1},
+		{MIN_SHARD_CAPACITY, 1},
+		{2 * MIN_SHARD_CAPACITY, 2},
+		{DefaultCapacity, 16},
+		{1 << 30, MAX_SHARDS},
+	}
+	for _, tt := range tests {
+		cache := NewBlockCache(tt.capacity)
+		sharded, ok := cache.(*shardedCache)
+		if tt.shards == 1 {
+			require.False(t, ok, "capacity %d", tt.capacity)
+			continue
+		}
+		require.True(t, ok, "capacity %d", tt.capacity)
+		require.Len(t, sharded.shards, tt.shards, "capacity %d", tt.capacity)
+	}
+}
+
+func TestShardedCacheSpreadsBlocks(t *testing.T) {
+	cache := NewShardedBlockCache(8000, 5, PolicyLRU).(*shardedCache)
+	require.Len(t, cache.shards, 8, "shards round up to a power of two")
+
+	for fileNo := range common.FileNo(4) {
+		for blockNo := range 10 {
+			cache.Put(fileNo, common.BlockNo(blockNo*4096), sizedBlock(10))
+		}
+	}
+	require.Equal(t, int64(400), cache.Usage())
+	for _, s := range cache.shards {
+		require.Equal(t, int64(1000), s.(*lruCache).capacity)
+		require.NotZero(t, s.Usage(), "every shard should hold some blocks")
+	}
+
+	_, ok := cache.Get(2, 4096)
+	require.True(t, ok)
+	_, ok = cache.Get(2, 1)
+	require.False(t, ok)
+	require.Equal(t, Stats{Hits: 1, Misses: 1, Inserts: 40}, cache.Stats())
+
+	require.True(t, cache.Pin(2, 4096))
+	require.False(t, cache.Pin(2, 1))
+	cache.Unpin(2, 4096)
+	require.Equal(t, Stats{Hits: 1, Misses: 1, Inserts: 40}, cache.Stats(), "pins aren't lookups")
+}
+
+func TestShardedCacheConcurrentAccess(t *testing.T) {
+	cache := NewShardedBlockCache(1<<20, 8, PolicyLRU)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				fileNo, blockNo := common.FileNo(g), common.BlockNo(i%100)
+				if _, ok := cache.Get(fileNo, blockNo); !ok {
+					cache.Put(fileNo, blockNo, sizedBlock(100))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(8*100*100), cache.Usage())
+	require.Equal(t, uint64(8*1000), cache.Stats().Hits+cache.Stats().Misses)
+}
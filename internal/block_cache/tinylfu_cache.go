@@ -0,0 +1,294 @@
+package block_cache
+
+import (
+	"container/list"
+	"math/bits"
+	"sync"
+
+	"amethyst/internal/common"
+)
+
+const (
+	// tinyLFUWindowShare is the share of a W-TinyLFU cache given to the
+	// window that every new block enters through.
+	tinyLFUWindowShare = 0.01
+
+	// tinyLFUProtectedShare is the share of the main cache kept for blocks
+	// read again since they were admitted.
+	tinyLFUProtectedShare = 0.8
+
+	// sketchBlockSize is the block size assumed in sizing the frequency
+	// sketch from a cache's capacity in bytes.
+	sketchBlockSize = 4 << 10
+)
+
+// Segments of a W-TinyLFU cache.
+const (
+	windowSegment = iota
+	probationSegment
+	protectedSegment
+)
+
+type lfuEntry struct {
+	key     cacheKey
+	block   Value
+	size    int64
+	segment int
+	pins    int
+}
+
+type lfuSegment struct {
+	order *list.List // front is most recently used
+	usage int64
+}
+
+// tinyLFUCache implements W-TinyLFU (Einziger et al., "TinyLFU: A Highly
+// Efficient Cache Admission Policy"). New blocks enter an LRU window; a
+// block pushed out of the window is admitted to the main cache only if the
+// frequency sketch has seen it read more often than the main cache's next
+// victim. The main cache is a segmented LRU: admitted blocks start on
+// probation and move to the protected segment when read again.
+type tinyLFUCache struct {
+	mu           sync.Mutex
+	capacity     int64
+	windowCap    int64
+	protectedCap int64
+	segments     [3]lfuSegment
+	entries      map[cacheKey]*list.Element
+	sketch       *frequencySketch
+	stats        Stats
+}
+
+var _ BlockCache = (*tinyLFUCache)(nil)
+
+func newTinyLFUCache(capacity int64) *tinyLFUCache {
+	windowCap := max(int64(float64(capacity)*tinyLFUWindowShare), 1)
+	c := &tinyLFUCache{
+		capacity:     capacity,
+		windowCap:    windowCap,
+		protectedCap: int64(float64(capacity-windowCap) * tinyLFUProtectedShare),
+		entries:      make(map[cacheKey]*list.Element),
+		sketch:       newFrequencySketch(int(capacity / sketchBlockSize)),
+	}
+	for i := range c.segments {
+		c.segments[i].order = list.New()
+	}
+	return c
+}
+
+func (c *tinyLFUCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey{fileNo, blockNo}
+	c.sketch.increment(hashKey(key))
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+
+	entry := elem.Value.(*lfuEntry)
+	switch entry.segment {
+	case probationSegment:
+		c.move(elem, protectedSegment)
+		for c.segments[protectedSegment].usage > c.protectedCap {
+			c.move(c.segments[protectedSegment].order.Back(), probationSegment)
+		}
+	default:
+		c.segments[entry.segment].order.MoveToFront(elem)
+	}
+	return entry.block, true
+}
+
+func (c *tinyLFUCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b Value) {
+	size := int64(b.Size())
+	// A block larger than the whole cache would only evict everything else
+	if size > c.capacity {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A replaced block's pins carry over to its replacement
+	key := cacheKey{fileNo, blockNo}
+	pins := 0
+	if elem, ok := c.entries[key]; ok {
+		pins = elem.Value.(*lfuEntry).pins
+		c.remove(elem)
+	}
+	c.entries[key] = c.segments[windowSegment].order.PushFront(&lfuEntry{key: key, block: b, size: size, pins: pins})
+	c.segments[windowSegment].usage += size
+	c.stats.Inserts++
+	c.shrinkWindow()
+}
+
+func (c *tinyLFUCache) Pin(fileNo common.FileNo, blockNo common.BlockNo) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if ok {
+		elem.Value.(*lfuEntry).pins++
+	}
+	return ok
+}
+
+func (c *tinyLFUCache) Unpin(fileNo common.FileNo, blockNo common.BlockNo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[cacheKey{fileNo, blockNo}]
+	if !ok {
+		return
+	}
+	if entry := elem.Value.(*lfuEntry); entry.pins > 0 {
+		if entry.pins--; entry.pins == 0 {
+			c.shrinkWindow()
+		}
+	}
+}
+
+// shrinkWindow offers the window's least recently used unpinned blocks to
+// the main cache until the window is within its share. Pinned blocks stay
+// in the window until they are unpinned.
+// Must be called with c.mu held.
+func (c *tinyLFUCache) shrinkWindow() {
+	window := &c.segments[windowSegment]
+	for elem := window.order.Back(); elem != nil && window.usage > c.windowCap; {
+		prev := elem.Prev()
+		if elem.Value.(*lfuEntry).pins == 0 {
+			c.admit(elem)
+		}
+		elem = prev
+	}
+}
+
+// admit moves the window's candidate into the main cache if it is read
+// more often than the victims it would evict, and drops it otherwise.
+// Must be called with c.mu held.
+func (c *tinyLFUCache) admit(candidate *list.Element) {
+	entry := candidate.Value.(*lfuEntry)
+	mainCap := c.capacity - c.windowCap
+	freq := c.sketch.estimate(hashKey(entry.key))
+	for c.segments[probationSegment].usage+c.segments[protectedSegment].usage+entry.size > mainCap {
+		victim := c.victim()
+		if victim == nil || freq <= c.sketch.estimate(hashKey(victim.Value.(*lfuEntry).key)) {
+			c.remove(candidate)
+			c.stats.Evictions++
+			return
+		}
+		c.remove(victim)
+		c.stats.Evictions++
+	}
+	c.move(candidate, probationSegment)
+}
+
+// victim returns the main cache's next block to evict: the least recently
+// used unpinned block on probation, or failing that in the protected
+// segment. It returns nil if every block in the main cache is pinned.
+// Must be called with c.mu held.
+func (c *tinyLFUCache) victim() *list.Element {
+	for _, segment := range []int{probationSegment, protectedSegment} {
+		for elem := c.segments[segment].order.Back(); elem != nil; elem = elem.Prev() {
+			if elem.Value.(*lfuEntry).pins == 0 {
+				return elem
+			}
+		}
+	}
+	return nil
+}
+
+func (c *tinyLFUCache) Usage() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var usage int64
+	for _, s := range c.segments {
+		usage += s.usage
+	}
+	return usage
+}
+
+func (c *tinyLFUCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// move puts elem at the front of segment.
+// Must be called with c.mu held.
+func (c *tinyLFUCache) move(elem *list.Element, segment int) {
+	entry := elem.Value.(*lfuEntry)
+	from := &c.segments[entry.segment]
+	from.order.Remove(elem)
+	from.usage -= entry.size
+
+	entry.segment = segment
+	c.entries[entry.key] = c.segments[segment].order.PushFront(entry)
+	c.segments[segment].usage += entry.size
+}
+
+// remove drops elem from the cache.
+// Must be called with c.mu held.
+func (c *tinyLFUCache) remove(elem *list.Element) {
+	entry := elem.Value.(*lfuEntry)
+	c.segments[entry.segment].order.Remove(elem)
+	c.segments[entry.segment].usage -= entry.size
+	delete(c.entries, entry.key)
+}
+
+// sketchDepth is the number of counter rows in a frequencySketch.
+const sketchDepth = 4
+
+// frequencySketch is a count-min sketch of 4-bit counters estimating how
+// often each block was read recently. Counters are halved every
+// 10 * width reads so the estimates follow a changing working set.
+type frequencySketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(entries int) *frequencySketch {
+	width := 1 << bits.Len(uint(max(entries, 64)-1))
+	s := &frequencySketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// sketchSeeds give each row of a frequencySketch its own hash of a key.
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func (s *frequencySketch) index(h uint64, row int) uint64 {
+	h = (h ^ sketchSeeds[row]) * 0xff51afd7ed558ccd
+	return (h ^ h>>32) & s.mask
+}
+
+func (s *frequencySketch) increment(h uint64) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < 15 {
+			*c++
+		}
+	}
+	if s.additions++; s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(h uint64) uint8 {
+	est := uint8(15)
+	for i := range s.rows {
+		est = min(est, s.rows[i][s.index(h, i)])
+	}
+	return est
+}
@@ -0,0 +1,84 @@
+package block_cache
+
+import (
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+// scanHitRate reads a hot set of blocks repeatedly while a scan streams
+// through many blocks read once, and returns the hit rate of the hot set
+// after the scan.
+func scanHitRate(cache BlockCache) float64 {
+	const hot = 50
+	read := func(fileNo common.FileNo, blockNo int) bool {
+		if _, ok := cache.Get(fileNo, common.BlockNo(blockNo)); ok {
+			return true
+		}
+		cache.Put(fileNo, common.BlockNo(blockNo), sizedBlock(100))
+		return false
+	}
+	for range 10 {
+		for i := range hot {
+			read(1, i)
+		}
+	}
+	for i := range 1000 {
+		read(2, i)
+		read(1, i%hot)
+	}
+	hits := 0
+	for i := range hot {
+		if read(1, i) {
+			hits++
+		}
+	}
+	return float64(hits) / hot
+}
+
+func TestTinyLFUResistsScans(t *testing.T) {
+	// The cache holds 60 blocks: the hot set fits, but not alongside a scan
+	lfu := scanHitRate(newTinyLFUCache(6000))
+	lru := scanHitRate(newLRUCache(6000))
+	require.Greater(t, lfu, 0.9, "tinylfu should keep the hot set")
+	require.Less(t, lru, lfu)
+	t.Logf("hot set hit rate after scan: tinylfu %.2f, lru %.2f", lfu, lru)
+}
+
+func TestTinyLFUAccounting(t *testing.T) {
+	cache := newTinyLFUCache(1000)
+	for i := range 30 {
+		cache.Put(1, common.BlockNo(i), sizedBlock(100))
+		require.LessOrEqual(t, cache.Usage(), int64(1000))
+	}
+
+	// Replacing a block frees the old one
+	cache = newTinyLFUCache(1000)
+	cache.Put(1, 0, sizedBlock(60))
+	cache.Put(1, 0, sizedBlock(40))
+	require.Equal(t, int64(40), cache.Usage())
+	_, ok := cache.Get(1, 0)
+	require.True(t, ok)
+
+	// Larger than the whole cache
+	cache.Put(1, 1, sizedBlock(1500))
+	_, ok = cache.Get(1, 1)
+	require.False(t, ok)
+	require.Equal(t, Stats{Hits: 1, Misses: 1, Inserts: 2}, cache.Stats())
+}
+
+func TestFrequencySketchAges(t *testing.T) {
+	s := newFrequencySketch(64)
+	for range 20 {
+		s.increment(1)
+	}
+	require.Equal(t, uint8(15), s.estimate(1), "counters saturate")
+	require.Zero(t, s.estimate(2))
+
+	// Enough other reads halve the counters
+	for i := range s.resetAt {
+		s.increment(uint64(i + 100))
+	}
+	require.Less(t, s.estimate(1), uint8(15))
+}
@@ -0,0 +1,8 @@
+package codec
+
+// Codec converts values of type T to and from the bytes stored in the
+// database.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
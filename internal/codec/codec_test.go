@@ -0,0 +1,50 @@
+package codec_test
+
+import (
+	"testing"
+
+	"amethyst/internal/codec"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Name   string
+	Age    int
+	Avatar []byte
+}
+
+func TestStructCodecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec codec.Codec[user]
+	}{
+		{"JSON", codec.JSON[user]()},
+		{"Msgpack", codec.Msgpack[user]()},
+	}
+
+	in := user{Name: "ada", Age: 36, Avatar: []byte{0x00, 0xff}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Marshal(in)
+			require.NoError(t, err)
+			out, err := tt.codec.Unmarshal(data)
+			require.NoError(t, err)
+			require.Equal(t, in, out)
+
+			_, err = tt.codec.Unmarshal([]byte{0xc1})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestProtoCodec(t *testing.T) {
+	c := codec.Proto[*wrapperspb.StringValue]()
+
+	data, err := c.Marshal(wrapperspb.String("hello"))
+	require.NoError(t, err)
+	out, err := c.Unmarshal(data)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.String("hello"), out))
+}
@@ -0,0 +1,20 @@
+package codec
+
+import "encoding/json"
+
+type jsonCodec[T any] struct{}
+
+// JSON encodes values with encoding/json.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,21 @@
+package codec
+
+import "github.com/vmihailenco/msgpack/v5"
+
+type msgpackCodec[T any] struct{}
+
+// Msgpack encodes values as MessagePack, which is more compact than JSON
+// and round-trips binary fields without base64.
+func Msgpack[T any]() Codec[T] {
+	return msgpackCodec[T]{}
+}
+
+func (msgpackCodec[T]) Marshal(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,23 @@
+package codec
+
+import "google.golang.org/protobuf/proto"
+
+type protoCodec[T proto.Message] struct{}
+
+// Proto encodes generated protobuf messages in their binary wire format.
+// T is the message's pointer type, e.g. Proto[*pb.User]().
+func Proto[T proto.Message]() Codec[T] {
+	return protoCodec[T]{}
+}
+
+func (protoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (protoCodec[T]) Unmarshal(data []byte) (T, error) {
+	// Generated messages can build a fresh instance from a nil pointer
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"amethyst/internal/vfs"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// NewChecksum returns a CRC32C hash, the checksum used for on-disk files.
+func NewChecksum() hash.Hash32 {
+	return crc32.New(castagnoli)
+}
+
+// ChecksumFile returns the CRC32C of the file at path in fsys.
+func ChecksumFile(fsys vfs.FS, path string) (uint32, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return Checksum(f)
+}
+
+// Checksum returns the CRC32C of everything read from r.
+func Checksum(r io.Reader) (uint32, error) {
+	h := NewChecksum()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint32
+	}{
+		{"empty", "", 0},
+		{"check value", "123456789", 0xe3069283}, // standard CRC32C check value
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0644))
+
+			got, err := ChecksumFile(vfs.Default, path)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := ChecksumFile(vfs.Default, filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
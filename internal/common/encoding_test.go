@@ -59,6 +59,32 @@ func TestWriteReadUint32(t *testing.T) {
 	}
 }
 
+func TestWriteReadUint64(t *testing.T) {
+	tests := []struct {
+		name  string
+		value uint64
+	}{
+		{"Zero", 0},
+		{"One", 1},
+		{"Max", 0xFFFFFFFFFFFFFFFF},
+		{"Above32Bits", 0x100000000},
+		{"Large", 1234567890123456789},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := WriteUint64(&buf, tt.value)
+			require.NoError(t, err)
+			require.Equal(t, 8, n)
+
+			result, err := ReadUint64(&buf)
+			require.NoError(t, err)
+			require.Equal(t, tt.value, result)
+		})
+	}
+}
+
 func TestWriteReadBytes(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1,23 +1,180 @@
 package common
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// LoggingEnabled controls whether Logf produces output.
-var LoggingEnabled = true
+// Level is the severity of a log record.
+type Level int8
 
-// Logf prints a formatted message if logging is enabled.
-func Logf(format string, args ...interface{}) {
-	if LoggingEnabled {
-		fmt.Printf(format, args...)
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int8(l))
 	}
 }
 
-// formatDuration formats a duration with 2 decimal places.
+// Logger receives the engine's log records: a message and fields given as
+// alternating keys and values. Implementations must be safe for concurrent
+// use.
+type Logger interface {
+	// Log records msg at level with the fields kv.
+	Log(level Level, msg string, kv ...any)
+
+	// Enabled reports whether records at level are kept, so callers can
+	// skip building the ones that aren't.
+	Enabled(level Level) bool
+}
+
+// DefaultLogger writes records at LevelInfo and above to standard output.
+var DefaultLogger Logger = NewTextLogger(os.Stdout, LevelInfo)
+
+// DiscardLogger drops every record.
+var DiscardLogger Logger = discardLogger{}
+
+type discardLogger struct{}
+
+func (discardLogger) Log(Level, string, ...any) {}
+func (discardLogger) Enabled(Level) bool        { return false }
+
+// textLogger writes each record as a line of text.
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+// NewTextLogger returns a Logger writing the records at min and above to w,
+// one line each: the level, the message, then the fields as key=value.
+func NewTextLogger(w io.Writer, min Level) Logger {
+	return &textLogger{w: w, min: min}
+}
+
+func (l *textLogger) Enabled(level Level) bool {
+	return level >= l.min
+}
+
+func (l *textLogger) Log(level Level, msg string, kv ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-5s %s", level, msg)
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		value := "MISSING"
+		if i+1 < len(kv) {
+			value = formatValue(kv[i+1])
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// formatValue formats a field value, quoting it unless it's a single word.
+func formatValue(v any) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case error:
+		s = v.Error()
+	case time.Duration:
+		s = v.Round(time.Microsecond).String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r > '~'
+	}) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// slogLogger passes records on to a slog.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger passing records on to l.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (l slogLogger) Log(level Level, msg string, kv ...any) {
+	l.l.Log(context.Background(), slogLevel(level), msg, kv...)
+}
+
+func (l slogLogger) Enabled(level Level) bool {
+	return l.l.Enabled(context.Background(), slogLevel(level))
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// prefixLogger prefixes the messages of the records it passes on.
+type prefixLogger struct {
+	l      Logger
+	prefix string
+}
+
+// WithPrefix returns a Logger passing records on to l with their messages
+// prefixed by "prefix: ", naming the component they come from.
+func WithPrefix(l Logger, prefix string) Logger {
+	return prefixLogger{l: l, prefix: prefix + ": "}
+}
+
+func (l prefixLogger) Log(level Level, msg string, kv ...any) {
+	l.l.Log(level, l.prefix+msg, kv...)
+}
+
+func (l prefixLogger) Enabled(level Level) bool {
+	return l.l.Enabled(level)
+}
+
+// FormatDuration formats a duration with 2 decimal places.
 // Returns a string like "1.23 ms" (no padding).
-func formatDuration(d time.Duration) string {
+func FormatDuration(d time.Duration) string {
 	ms := float64(d) / float64(time.Millisecond)
 
 	// Handle durations >= 1 second
@@ -32,12 +189,3 @@ func formatDuration(d time.Duration) string {
 	// Everything else in milliseconds with 2 decimal places
 	return fmt.Sprintf("%.2f ms", ms)
 }
-
-// LogDuration prints a message with the elapsed time since start.
-// The duration is formatted with tight parens and right-padded to align messages.
-func LogDuration(start time.Time, format string, args ...interface{}) {
-	elapsed := time.Since(start)
-	msg := fmt.Sprintf(format, args...)
-	durStr := fmt.Sprintf("(%s)", formatDuration(elapsed))
-	Logf("%-10s%s\n", durStr, msg)
-}
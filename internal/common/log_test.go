@@ -1,6 +1,9 @@
 package common
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -47,8 +50,40 @@ func TestFormatDuration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatDuration(tt.duration)
+			result := FormatDuration(tt.duration)
 			require.Equal(t, tt.expected, result, "duration %v", tt.duration)
 		})
 	}
 }
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf, LevelInfo)
+	require.False(t, l.Enabled(LevelDebug))
+	require.True(t, l.Enabled(LevelWarn))
+
+	l.Log(LevelDebug, "dropped")
+	l.Log(LevelInfo, "flushed memtable", "file", FileNo(3), "entries", 10, "duration", 1234567*time.Nanosecond)
+	WithPrefix(WithPrefix(l, "db"), "wal").Log(LevelError, "failed to sync", "err", errors.New("disk full"), "key", []byte("a b"), "odd")
+	require.Equal(t, "INFO  flushed memtable file=3 entries=10 duration=1.235ms\n"+
+		`ERROR db: wal: failed to sync err="disk full" key="a b" odd=MISSING`+"\n", buf.String())
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+	require.False(t, l.Enabled(LevelInfo))
+	require.True(t, l.Enabled(LevelWarn))
+
+	l.Log(LevelInfo, "dropped")
+	WithPrefix(l, "flush").Log(LevelWarn, "failed", "file", 3)
+	require.Equal(t, `level=WARN msg="flush: failed" file=3`+"\n", buf.String())
+}
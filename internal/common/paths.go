@@ -17,6 +17,17 @@ func (pm *PathManager) WALPath(fileNo FileNo) string {
 	return filepath.Join(pm.BasePath, "wal", fmt.Sprintf("%d.log", fileNo))
 }
 
+// RecycledWALPath is where an obsolete WAL waits to be reused. The name
+// doesn't parse as a WAL number, so it is never replayed.
+func (pm *PathManager) RecycledWALPath(fileNo FileNo) string {
+	return filepath.Join(pm.BasePath, "wal", fmt.Sprintf("recycle-%d.log", fileNo))
+}
+
+// ArchivedWALPath is where an obsolete WAL is kept when WALs are archived.
+func (pm *PathManager) ArchivedWALPath(fileNo FileNo) string {
+	return filepath.Join(pm.BasePath, "archive", fmt.Sprintf("%d.log", fileNo))
+}
+
 func (pm *PathManager) SSTablePath(level int, fileNo FileNo) string {
 	return filepath.Join(pm.BasePath, "sstable", fmt.Sprintf("%d/%d.sst", level, fileNo))
 }
@@ -29,10 +40,40 @@ func (pm *PathManager) WALDir() string {
 	return filepath.Join(pm.BasePath, "wal")
 }
 
+func (pm *PathManager) ArchiveDir() string {
+	return filepath.Join(pm.BasePath, "archive")
+}
+
 func (pm *PathManager) SSTableDir() string {
 	return filepath.Join(pm.BasePath, "sstable")
 }
 
+func (pm *PathManager) CheckpointDir() string {
+	return filepath.Join(pm.BasePath, "checkpoint")
+}
+
+// SnapshotDir holds the checkpoints a replication primary takes to
+// bootstrap replicas, while it sends them.
+func (pm *PathManager) SnapshotDir() string {
+	return filepath.Join(pm.BasePath, "snapshot")
+}
+
+func (pm *PathManager) LostDir() string {
+	return filepath.Join(pm.BasePath, "lost")
+}
+
+func (pm *PathManager) ShapeHistoryPath() string {
+	return filepath.Join(pm.BasePath, "SHAPE_HISTORY")
+}
+
 func (pm *PathManager) SeedIndexPath() string {
 	return filepath.Join(pm.BasePath, "CLI_SEED_INDEX")
 }
+
+func (pm *PathManager) BlobDir() string {
+	return filepath.Join(pm.BasePath, "blob")
+}
+
+func (pm *PathManager) BlobPath(fileNo FileNo) string {
+	return filepath.Join(pm.BasePath, "blob", fmt.Sprintf("%d.blob", fileNo))
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PrefixExtractor maps keys to the prefix that prefix-scoped operations group
+// them under, e.g. the "user:" in "user:42:name". Keys sharing a prefix are
+// contiguous in key order.
+type PrefixExtractor interface {
+	// Name identifies the extractor. Tables record it so that prefix filters
+	// built by a different extractor are never consulted.
+	Name() string
+
+	// Prefix returns key's prefix, or false if key has none.
+	Prefix(key []byte) ([]byte, bool)
+}
+
+type fixedPrefix struct {
+	n int
+}
+
+// NewFixedPrefixExtractor takes the first n bytes of each key as its prefix.
+// Shorter keys have no prefix.
+func NewFixedPrefixExtractor(n int) PrefixExtractor {
+	return fixedPrefix{n: n}
+}
+
+func (p fixedPrefix) Name() string {
+	return fmt.Sprintf("fixed:%d", p.n)
+}
+
+func (p fixedPrefix) Prefix(key []byte) ([]byte, bool) {
+	if len(key) < p.n {
+		return nil, false
+	}
+	return key[:p.n], true
+}
+
+type delimitedPrefix struct {
+	delim byte
+}
+
+// NewDelimitedPrefixExtractor takes everything up to and including the first
+// delim as a key's prefix, so "user:" never matches "users:1". Keys without
+// delim have no prefix.
+func NewDelimitedPrefixExtractor(delim byte) PrefixExtractor {
+	return delimitedPrefix{delim: delim}
+}
+
+func (p delimitedPrefix) Name() string {
+	return fmt.Sprintf("delimited:%q", p.delim)
+}
+
+func (p delimitedPrefix) Prefix(key []byte) ([]byte, bool) {
+	i := bytes.IndexByte(key, p.delim)
+	if i < 0 {
+		return nil, false
+	}
+	return key[:i+1], true
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixExtractor(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor PrefixExtractor
+		key       string
+		prefix    string
+		ok        bool
+	}{
+		{"Fixed", NewFixedPrefixExtractor(3), "user42", "use", true},
+		{"FixedExact", NewFixedPrefixExtractor(3), "abc", "abc", true},
+		{"FixedShort", NewFixedPrefixExtractor(3), "ab", "", false},
+		{"Delimited", NewDelimitedPrefixExtractor(':'), "user:42:name", "user:", true},
+		{"DelimitedLeading", NewDelimitedPrefixExtractor(':'), ":42", ":", true},
+		{"DelimitedMissing", NewDelimitedPrefixExtractor(':'), "user42", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, ok := tt.extractor.Prefix([]byte(tt.key))
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.prefix, string(prefix))
+		})
+	}
+
+	require.Equal(t, "fixed:3", NewFixedPrefixExtractor(3).Name())
+	require.Equal(t, `delimited:':'`, NewDelimitedPrefixExtractor(':').Name())
+}
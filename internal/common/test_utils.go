@@ -30,5 +30,5 @@ func RequireMatchesIterator(t *testing.T, iter EntryIterator, expected []*Entry)
 }
 
 func entriesEqual(a, b *Entry) bool {
-	return a.Type == b.Type && a.Seq == b.Seq && string(a.Key) == string(b.Key) && string(a.Value) == string(b.Value)
+	return a.Type == b.Type && a.Seq == b.Seq && a.Timestamp == b.Timestamp && string(a.Key) == string(b.Key) && string(a.Value) == string(b.Value)
 }
@@ -1,12 +1,23 @@
 package common
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 )
 
 var ErrIncompleteEntry = errors.New("incomplete entry: unexpected end of data")
 
+// ErrMalformedEntry is returned for an entry whose fields can't be decoded.
+var ErrMalformedEntry = errors.New("malformed entry")
+
+// ErrSeqOverflow is returned when writing an entry in EntryFormatFixed whose
+// sequence number is too large for its 32-bit field.
+var ErrSeqOverflow = errors.New("entry sequence number does not fit in 32 bits")
+
 // FileNo identifies a file (SSTable or WAL).
 type FileNo uint64
 
@@ -20,15 +31,38 @@ type EntryType uint8
 const (
 	EntryTypePut EntryType = iota
 	EntryTypeDelete
+	// EntryTypeBlobRef is a put whose value was moved to a blob file; Value
+	// holds the encoded blob handle. It appears only in SSTables.
+	EntryTypeBlobRef
+	// EntryTypeRangeDelete deletes every key in [Key, Value) written before
+	// it. Range tombstones are kept apart from point entries, in the
+	// memtable and in their own SSTable block.
+	EntryTypeRangeDelete
 )
 
 // Entry represents a single key-value pair in the database.
 // It supports serialization and deserialization to/from a byte stream.
 type Entry struct {
-	Type  EntryType
-	Seq   uint32
-	Key   []byte
-	Value []byte
+	Type      EntryType
+	Seq       uint64
+	Timestamp int64 // commit time in Unix nanoseconds
+	ExpiresAt int64 // expiry time in Unix nanoseconds; 0 if the entry never expires
+	Key       []byte
+	Value     []byte
+}
+
+// RangeTombstones is a set of EntryTypeRangeDelete entries.
+type RangeTombstones []*Entry
+
+// Covering returns a tombstone that deletes the version of key written at
+// seq, or nil if none does.
+func (ts RangeTombstones) Covering(key []byte, seq uint64) *Entry {
+	for _, t := range ts {
+		if t.Seq > seq && bytes.Compare(t.Key, key) <= 0 && bytes.Compare(key, t.Value) < 0 {
+			return t
+		}
+	}
+	return nil
 }
 
 // EntryIterator produces a stream of entries. Next returns nil when the stream
@@ -37,53 +71,85 @@ type EntryIterator interface {
 	Next() (*Entry, error)
 }
 
-// Entry Layout:
+// EntryFormat identifies how WriteEntryFormat encodes entries. Every file
+// format that stores entries records which one it used, so files written
+// before a format change stay readable.
+type EntryFormat uint8
+
+const (
+	// EntryFormatFixed stores seq and the key and value lengths as
+	// fixed-width uint32s. Files written before EntryFormatVarint use it.
+	EntryFormatFixed EntryFormat = 1
+	// EntryFormatVarint stores seq, expiresAt, and the key and value
+	// lengths as varints, which halves the 29 bytes EntryFormatFixed adds
+	// to each small entry.
+	EntryFormatVarint EntryFormat = 2
+
+	// CurrentEntryFormat is the format WriteEntry uses.
+	CurrentEntryFormat = EntryFormatVarint
+)
+
+// Entry Layout (EntryFormatVarint):
 //
 // ┌──────────────────┐
-// │    entryType     │  uint8 - 0=Put, 1=Delete
+// │    entryType     │  uint8 - 0=Put, 1=Delete, 2=BlobRef, 3=RangeDelete
+// ├──────────────────┤
+// │       seq        │  uvarint
+// ├──────────────────┤
+// │    timestamp     │  uint64 - commit time, Unix nanoseconds
 // ├──────────────────┤
-// │       seq        │  uint32
+// │    expiresAt     │  uvarint - expiry time, Unix nanoseconds; 0 if never
 // ├──────────────────┤
-// │      keyLen      │  uint32 - len(key)
+// │      keyLen      │  uvarint - len(key)
 // ├──────────────────┤
-// │     valueLen     │  uint32 - len(value), 0 for tombstones
+// │     valueLen     │  uvarint - len(value), 0 for tombstones
 // ├──────────────────┤
 // │       key        │  []byte
 // ├──────────────────┤
 // │      value       │  []byte
 // └──────────────────┘
+//
+// EntryFormatFixed has the same fields, with seq, keyLen and valueLen as
+// uint32s and expiresAt as a uint64.
 
-// WriteEntry writes an entry to the given writer.
+// WriteEntry writes an entry to the given writer in CurrentEntryFormat.
 // Returns the number of bytes written.
 func WriteEntry(w io.Writer, e *Entry) (int, error) {
-	total := 0
-
-	n, err := WriteUint8(w, uint8(e.Type))
-	total += n
-	if err != nil {
-		return total, err
-	}
-
-	n, err = WriteUint32(w, e.Seq)
-	total += n
-	if err != nil {
-		return total, err
-	}
+	return WriteEntryFormat(w, e, CurrentEntryFormat)
+}
 
-	n, err = WriteUint32(w, uint32(len(e.Key)))
-	total += n
-	if err != nil {
-		return total, err
+// WriteEntryFormat writes an entry to the given writer in format.
+// Returns the number of bytes written.
+func WriteEntryFormat(w io.Writer, e *Entry, format EntryFormat) (int, error) {
+	var header [1 + 4*binary.MaxVarintLen64]byte
+	buf := append(header[:0], uint8(e.Type))
+	switch format {
+	case EntryFormatFixed:
+		if e.Seq > math.MaxUint32 {
+			return 0, ErrSeqOverflow
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(e.Seq))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Timestamp))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.ExpiresAt))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.Key)))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.Value)))
+	case EntryFormatVarint:
+		buf = binary.AppendUvarint(buf, e.Seq)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Timestamp))
+		buf = binary.AppendUvarint(buf, uint64(e.ExpiresAt))
+		buf = binary.AppendUvarint(buf, uint64(len(e.Key)))
+		buf = binary.AppendUvarint(buf, uint64(len(e.Value)))
+	default:
+		return 0, fmt.Errorf("unknown entry format %d", format)
 	}
 
-	n, err = WriteUint32(w, uint32(len(e.Value)))
-	total += n
+	total, err := WriteBytes(w, buf)
 	if err != nil {
 		return total, err
 	}
 
 	if len(e.Key) > 0 {
-		n, err = WriteBytes(w, e.Key)
+		n, err := WriteBytes(w, e.Key)
 		total += n
 		if err != nil {
 			return total, err
@@ -91,7 +157,7 @@ func WriteEntry(w io.Writer, e *Entry) (int, error) {
 	}
 
 	if len(e.Value) > 0 {
-		n, err = WriteBytes(w, e.Value)
+		n, err := WriteBytes(w, e.Value)
 		total += n
 		if err != nil {
 			return total, err
@@ -101,10 +167,15 @@ func WriteEntry(w io.Writer, e *Entry) (int, error) {
 	return total, nil
 }
 
-// ReadEntry reads a single entry from the reader.
+// ReadEntry reads a single entry in CurrentEntryFormat from the reader.
 // Returns (nil, nil) when stream is exhausted (clean EOF).
 // Returns (nil, ErrIncompleteEntry) for incomplete entries (malformed data).
 func ReadEntry(r io.ByteReader) (*Entry, error) {
+	return ReadEntryFormat(r, CurrentEntryFormat)
+}
+
+// ReadEntryFormat is like ReadEntry but reads an entry written in format.
+func ReadEntryFormat(r io.ByteReader, format EntryFormat) (*Entry, error) {
 	firstByte, err := r.ReadByte()
 	if err != nil {
 		if err == io.EOF {
@@ -114,36 +185,74 @@ func ReadEntry(r io.ByteReader) (*Entry, error) {
 	}
 
 	reader := r.(io.Reader)
-
-	seq, err := ReadUint32(reader)
-	if err != nil {
-		return nil, ErrIncompleteEntry
+	entry := &Entry{Type: EntryType(firstByte)}
+	var keyLen, valueLen uint64
+	switch format {
+	case EntryFormatFixed:
+		var seq, kl, vl uint32
+		var timestamp, expiresAt uint64
+		if seq, err = ReadUint32(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		if timestamp, err = ReadUint64(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		if expiresAt, err = ReadUint64(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		if kl, err = ReadUint32(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		if vl, err = ReadUint32(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		entry.Seq, entry.Timestamp, entry.ExpiresAt = uint64(seq), int64(timestamp), int64(expiresAt)
+		keyLen, valueLen = uint64(kl), uint64(vl)
+	case EntryFormatVarint:
+		var timestamp, expiresAt uint64
+		if entry.Seq, err = readUvarint(r); err != nil {
+			return nil, err
+		}
+		if timestamp, err = ReadUint64(reader); err != nil {
+			return nil, ErrIncompleteEntry
+		}
+		if expiresAt, err = readUvarint(r); err != nil {
+			return nil, err
+		}
+		if keyLen, err = readUvarint(r); err != nil {
+			return nil, err
+		}
+		if valueLen, err = readUvarint(r); err != nil {
+			return nil, err
+		}
+		if keyLen > math.MaxUint32 || valueLen > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: key or value length out of range", ErrMalformedEntry)
+		}
+		entry.Timestamp, entry.ExpiresAt = int64(timestamp), int64(expiresAt)
+	default:
+		return nil, fmt.Errorf("unknown entry format %d", format)
 	}
 
-	keyLen, err := ReadUint32(reader)
+	entry.Key, err = ReadBytes(reader, keyLen)
 	if err != nil {
 		return nil, ErrIncompleteEntry
 	}
 
-	valueLen, err := ReadUint32(reader)
+	entry.Value, err = ReadBytes(reader, valueLen)
 	if err != nil {
 		return nil, ErrIncompleteEntry
 	}
 
-	entry := &Entry{
-		Type: EntryType(firstByte),
-		Seq:  seq,
-	}
-
-	entry.Key, err = ReadBytes(reader, uint64(keyLen))
-	if err != nil {
-		return nil, ErrIncompleteEntry
-	}
+	return entry, nil
+}
 
-	entry.Value, err = ReadBytes(reader, uint64(valueLen))
-	if err != nil {
-		return nil, ErrIncompleteEntry
+// readUvarint reads one of an entry's varint fields.
+func readUvarint(r io.ByteReader) (uint64, error) {
+	v, err := binary.ReadUvarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, ErrIncompleteEntry
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrMalformedEntry, err)
 	}
-
-	return entry, nil
+	return v, nil
 }
@@ -2,6 +2,8 @@ package common
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -15,10 +17,11 @@ func TestEntryEncodeDecode(t *testing.T) {
 		{
 			name: "Put entry with value",
 			entry: &Entry{
-				Type:  EntryTypePut,
-				Seq:   42,
-				Key:   []byte("test-key"),
-				Value: []byte("test-value"),
+				Type:      EntryTypePut,
+				Seq:       42,
+				Timestamp: 1700000000123456789,
+				Key:       []byte("test-key"),
+				Value:     []byte("test-value"),
 			},
 		},
 		{
@@ -30,6 +33,17 @@ func TestEntryEncodeDecode(t *testing.T) {
 				Value: nil,
 			},
 		},
+		{
+			name: "Put entry with expiry",
+			entry: &Entry{
+				Type:      EntryTypePut,
+				Seq:       43,
+				Timestamp: 1700000000123456789,
+				ExpiresAt: 1700000060123456789,
+				Key:       []byte("session"),
+				Value:     []byte("token"),
+			},
+		},
 		{
 			name: "Nil key and value",
 			entry: &Entry{
@@ -50,28 +64,58 @@ func TestEntryEncodeDecode(t *testing.T) {
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Encode
-			var buf bytes.Buffer
-			n, err := WriteEntry(&buf, tt.entry)
-			require.NoError(t, err)
-			require.Equal(t, n, buf.Len(), "returned byte count should match buffer size")
+	for _, format := range []EntryFormat{EntryFormatFixed, EntryFormatVarint} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/format=%d", tt.name, format), func(t *testing.T) {
+				// Encode
+				var buf bytes.Buffer
+				n, err := WriteEntryFormat(&buf, tt.entry, format)
+				require.NoError(t, err)
+				require.Equal(t, n, buf.Len(), "returned byte count should match buffer size")
 
-			// Decode
-			decoded, err := ReadEntry(&buf)
-			require.NoError(t, err)
-			require.NotNil(t, decoded)
+				// Decode
+				decoded, err := ReadEntryFormat(&buf, format)
+				require.NoError(t, err)
+				require.NotNil(t, decoded)
 
-			// Verify
-			require.Equal(t, tt.entry.Type, decoded.Type)
-			require.Equal(t, tt.entry.Seq, decoded.Seq)
-			require.Equal(t, tt.entry.Key, decoded.Key)
-			require.Equal(t, tt.entry.Value, decoded.Value)
-		})
+				// Verify
+				require.Equal(t, tt.entry.Type, decoded.Type)
+				require.Equal(t, tt.entry.Seq, decoded.Seq)
+				require.Equal(t, tt.entry.Timestamp, decoded.Timestamp)
+				require.Equal(t, tt.entry.ExpiresAt, decoded.ExpiresAt)
+				require.Equal(t, tt.entry.Key, decoded.Key)
+				require.Equal(t, tt.entry.Value, decoded.Value)
+			})
+		}
 	}
 }
 
+func TestVarintEntryIsSmaller(t *testing.T) {
+	entry := &Entry{Type: EntryTypePut, Seq: 12345, Timestamp: 1700000000123456789, Key: []byte("k"), Value: []byte("v")}
+	fixed, err := WriteEntryFormat(io.Discard, entry, EntryFormatFixed)
+	require.NoError(t, err)
+	varint, err := WriteEntry(io.Discard, entry)
+	require.NoError(t, err)
+	require.Equal(t, 31, fixed)
+	require.Equal(t, 16, varint)
+
+	// Sequence numbers past 32 bits only fit the varint format
+	entry.Seq = 1 << 40
+	var buf bytes.Buffer
+	_, err = WriteEntry(&buf, entry)
+	require.NoError(t, err)
+	decoded, err := ReadEntry(&buf)
+	require.NoError(t, err)
+	require.Equal(t, entry.Seq, decoded.Seq)
+}
+
+func TestWriteEntrySeqOverflow(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := WriteEntryFormat(&buf, &Entry{Seq: 1 << 32, Key: []byte("k")}, EntryFormatFixed)
+	require.ErrorIs(t, err, ErrSeqOverflow)
+	require.Zero(t, buf.Len())
+}
+
 func TestReadEntryEOF(t *testing.T) {
 	// Empty buffer should return (nil, nil)
 	var buf bytes.Buffer
@@ -82,40 +126,66 @@ func TestReadEntryEOF(t *testing.T) {
 
 func TestReadEntryIncomplete(t *testing.T) {
 	tests := []struct {
-		name string
-		data []byte
+		name   string
+		format EntryFormat
+		data   []byte
 	}{
 		{
-			name: "Incomplete header",
-			data: []byte{0x00, 0x01, 0x02}, // Only 3 bytes of 13-byte header
+			name:   "Incomplete header",
+			format: EntryFormatFixed,
+			data:   []byte{0x00, 0x01, 0x02}, // Only 3 bytes of 29-byte header
 		},
 		{
-			name: "Missing key data",
+			name:   "Missing key data",
+			format: EntryFormatFixed,
 			data: []byte{
 				0x00,          // type
 				0x2A, 0, 0, 0, // seq (uint32)
+				0, 0, 0, 0, 0, 0, 0, 0, // timestamp (uint64)
+				0, 0, 0, 0, 0, 0, 0, 0, // expiresAt (uint64)
 				0x05, 0, 0, 0, // keyLen = 5
 				0x00, 0, 0, 0, // valueLen = 0
 				0x01, 0x02, // Only 2 of 5 key bytes
 			},
 		},
 		{
-			name: "Missing value data",
+			name:   "Missing value data",
+			format: EntryFormatFixed,
 			data: []byte{
 				0x00,          // type
 				0x2A, 0, 0, 0, // seq (uint32)
+				0, 0, 0, 0, 0, 0, 0, 0, // timestamp (uint64)
+				0, 0, 0, 0, 0, 0, 0, 0, // expiresAt (uint64)
 				0x03, 0, 0, 0, // keyLen = 3
 				0x05, 0, 0, 0, // valueLen = 5
 				0x61, 0x62, 0x63, // key: "abc"
 				0x01, 0x02, // Only 2 of 5 value bytes
 			},
 		},
+		{
+			name:   "Truncated varint",
+			format: EntryFormatVarint,
+			data:   []byte{0x00, 0x80}, // seq's varint continues past the end
+		},
+		{
+			name:   "Missing varint key data",
+			format: EntryFormatVarint,
+			data: []byte{
+				0x00,                   // type
+				0x2A,                   // seq
+				0, 0, 0, 0, 0, 0, 0, 0, // timestamp (uint64)
+				0x00,       // expiresAt
+				0x05,       // keyLen = 5
+				0x00,       // valueLen = 0
+				0x01, 0x02, // Only 2 of 5 key bytes
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buf := bytes.NewBuffer(tt.data)
-			entry, err := ReadEntry(buf)
+			entry, err := ReadEntryFormat(buf, tt.format)
 			require.ErrorIs(t, err, ErrIncompleteEntry)
 			require.Nil(t, entry)
 		})
@@ -0,0 +1,61 @@
+package compression
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+var (
+	// None stores blocks as they are.
+	None Codec = noneCodec{}
+	// Snappy favors speed over ratio; it suits data that is read often.
+	Snappy Codec = snappyCodec{}
+	// Zlib compresses better but more slowly; it suits cold data.
+	Zlib Codec = zlibCodec{}
+)
+
+type noneCodec struct{}
+
+func (noneCodec) Type() Type                        { return NoneType }
+func (noneCodec) Name() string                      { return "none" }
+func (noneCodec) Encode(src []byte) ([]byte, error) { return src, nil }
+func (noneCodec) Decode(src []byte) ([]byte, error) { return src, nil }
+
+type snappyCodec struct{}
+
+func (snappyCodec) Type() Type                        { return SnappyType }
+func (snappyCodec) Name() string                      { return "snappy" }
+func (snappyCodec) Encode(src []byte) ([]byte, error) { return snappyEncode(src), nil }
+func (snappyCodec) Decode(src []byte) ([]byte, error) { return snappyDecode(src) }
+
+type zlibCodec struct{}
+
+func (zlibCodec) Type() Type   { return ZlibType }
+func (zlibCodec) Name() string { return "zlib" }
+
+func (zlibCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (zlibCodec) Decode(src []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return data, nil
+}
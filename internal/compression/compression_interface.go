@@ -0,0 +1,76 @@
+package compression
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrCorrupt is returned when compressed data fails to decode.
+	ErrCorrupt = errors.New("compression: corrupt data")
+	// ErrUnknownCodec is returned for a codec type that isn't registered.
+	ErrUnknownCodec = errors.New("compression: unknown codec")
+)
+
+// Type identifies a codec on disk. Values follow RocksDB's numbering so the
+// same byte means the same codec in both formats.
+type Type uint8
+
+const (
+	NoneType   Type = 0
+	SnappyType Type = 1
+	ZlibType   Type = 2
+)
+
+// Codec compresses and decompresses blocks. Implementations must be safe for
+// concurrent use.
+type Codec interface {
+	// Type is recorded with every block the codec encodes.
+	Type() Type
+	// Name is the codec's human-readable name, e.g. "snappy".
+	Name() string
+	// Encode returns src compressed.
+	Encode(src []byte) ([]byte, error)
+	// Decode returns the data src was compressed from.
+	Decode(src []byte) ([]byte, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[Type]Codec{}
+)
+
+// Register makes c available to Lookup, replacing any codec of the same
+// type. The built-in codecs are registered already.
+func Register(c Codec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[c.Type()] = c
+}
+
+// Lookup returns the registered codec for t.
+func Lookup(t Type) (Codec, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: type %d", ErrUnknownCodec, t)
+	}
+	return c, nil
+}
+
+// Decode decompresses src with the codec registered for t.
+func Decode(t Type, src []byte) ([]byte, error) {
+	c, err := Lookup(t)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(src)
+}
+
+func init() {
+	for _, c := range []Codec{None, Snappy, Zlib} {
+		Register(c)
+	}
+}
@@ -0,0 +1,161 @@
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxFragment bounds the input each encoder pass works on, keeping every
+// back-reference within the 16-bit offsets the encoder emits.
+const maxFragment = 1 << 16
+
+// minMatch is the shortest back-reference worth emitting.
+const minMatch = 4
+
+// snappyEncode compresses src into the snappy block format: the length as a
+// varint, then literal runs and copies found by hashing 4-byte sequences.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	for len(src) > 0 {
+		fragment := src[:min(len(src), maxFragment)]
+		dst = encodeFragment(dst, fragment)
+		src = src[len(fragment):]
+	}
+	return dst
+}
+
+func encodeFragment(dst, src []byte) []byte {
+	const tableBits = 14
+	var table [1 << tableBits]int32
+
+	literal := 0 // start of the bytes not yet emitted
+	for s := 0; s+minMatch <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[s:])
+		h := (cur * 0x1e35a7bd) >> (32 - tableBits)
+		candidate := int(table[h])
+		table[h] = int32(s)
+
+		if candidate >= s || binary.LittleEndian.Uint32(src[candidate:]) != cur {
+			s++
+			continue
+		}
+
+		n := minMatch
+		for s+n < len(src) && src[candidate+n] == src[s+n] {
+			n++
+		}
+		dst = emitLiteral(dst, src[literal:s])
+		dst = emitCopy(dst, s-candidate, n)
+		s += n
+		literal = s
+	}
+	return emitLiteral(dst, src[literal:])
+}
+
+// emitLiteral appends a literal run. Lengths up to 60 fit in the tag; longer
+// ones store length-1 in the 1-4 bytes that follow.
+func emitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// emitCopy appends copies of up to 64 bytes each with 16-bit offsets.
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := min(length, 64)
+		dst = append(dst, byte(n-1)<<2|0x02, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
+
+// snappyDecode decompresses a snappy block: the decoded length as a varint,
+// then a sequence of literal runs and back-references into the output.
+func snappyDecode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > uint64(1<<32-1) {
+		return nil, fmt.Errorf("%w: bad snappy length", ErrCorrupt)
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var size, offset int
+
+		switch tag & 0x03 {
+		case 0x00: // literal
+			size = int(tag >> 2)
+			src = src[1:]
+			// Lengths of 60 and up store length-1 in the next 1-4 bytes
+			if size >= 60 {
+				extra := size - 59
+				if len(src) < extra {
+					return nil, fmt.Errorf("%w: truncated snappy literal", ErrCorrupt)
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			size++
+			if len(src) < size {
+				return nil, fmt.Errorf("%w: truncated snappy literal", ErrCorrupt)
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case 0x01: // copy with 11-bit offset
+			if len(src) < 2 {
+				return nil, fmt.Errorf("%w: truncated snappy copy", ErrCorrupt)
+			}
+			size = 4 + int(tag>>2&0x07)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 0x02: // copy with 16-bit offset
+			if len(src) < 3 {
+				return nil, fmt.Errorf("%w: truncated snappy copy", ErrCorrupt)
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 0x03: // copy with 32-bit offset
+			if len(src) < 5 {
+				return nil, fmt.Errorf("%w: truncated snappy copy", ErrCorrupt)
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) {
+			return nil, fmt.Errorf("%w: bad snappy copy offset %d", ErrCorrupt, offset)
+		}
+		// Copies may overlap their own output, so go byte by byte
+		start := len(dst) - offset
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, fmt.Errorf("%w: snappy length %d, want %d", ErrCorrupt, len(dst), length)
+	}
+	return dst, nil
+}
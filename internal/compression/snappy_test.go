@@ -0,0 +1,72 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnappyDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", []byte{0x00}, "", false},
+		{"Literal", []byte{0x03, 0x08, 'a', 'b', 'c'}, "abc", false},
+		// A 6-byte copy at offset 3 overlaps the bytes it produces
+		{"OverlappingCopy", []byte{0x09, 0x08, 'a', 'b', 'c', 0x09, 0x03}, "abcabcabc", false},
+		{"TwoByteOffsetCopy", []byte{0x05, 0x00, 'x', 0x0e, 0x01, 0x00}, "xxxxx", false},
+		{"OffsetBeforeStart", []byte{0x07, 0x08, 'a', 'b', 'c', 0x01, 0x04}, "", true},
+		{"TruncatedLiteral", []byte{0x03, 0x08, 'a'}, "", true},
+		{"LengthMismatch", []byte{0x04, 0x08, 'a', 'b', 'c'}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := snappyDecode(tt.input)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrCorrupt)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(got))
+		})
+	}
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	var repetitive bytes.Buffer
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&repetitive, "key%05d=value%d;", i, i%7)
+	}
+	random := make([]byte, 3000)
+	for i := range random {
+		random[i] = byte(i * 2654435761 >> 13)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"Empty", nil},
+		{"Short", []byte("abc")},
+		{"Run", bytes.Repeat([]byte{'z'}, 1000)},
+		{"LongLiteral", random},
+		{"SpansFragments", repetitive.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := snappyEncode(tt.input)
+			decoded, err := snappyDecode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, string(tt.input), string(decoded))
+		})
+	}
+
+	require.Less(t, len(snappyEncode(repetitive.Bytes())), repetitive.Len()/2)
+}
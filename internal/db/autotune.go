@@ -0,0 +1,148 @@
+package db
+
+import (
+	"sync/atomic"
+	"time"
+
+	"amethyst/internal/common"
+)
+
+// maxStallFraction is the share of wall time writers may spend blocked on
+// flush and compaction before the tuner defers compaction work.
+const maxStallFraction = 0.25
+
+// compactionTuner is a feedback controller that adjusts the L0 compaction
+// trigger and compaction parallelism from observed amplification. Each flush
+// closes a measurement window:
+//
+//   - writers stalled too long  -> raise the trigger (compact less often)
+//   - reads probe more than one table per level -> lower it (keep L0 shallow)
+//   - bytes rewritten per user byte exceed the leveled ideal -> raise it
+//
+// Independently, writers stalled too long add a concurrent compaction so
+// compaction catches up, and a window without stalls gives one back to
+// leave I/O to the foreground. Each moves by one step per window, the
+// trigger within [min, max] and the compactions within [1, maxCompactions].
+type compactionTuner struct {
+	min, max int
+	trigger  int
+
+	maxCompactions int
+	compactions    int
+
+	// Read-side counters, updated concurrently by lock-free reads
+	gets   atomic.Int64
+	probes atomic.Int64
+
+	// Write-side counters, updated under d.mu
+	userBytes    int64
+	writtenBytes int64
+	stall        time.Duration
+	windowStart  time.Time
+
+	logger common.Logger
+}
+
+func newCompactionTuner(min, max, initial, maxCompactions int, logger common.Logger) *compactionTuner {
+	if maxCompactions < 1 {
+		maxCompactions = 1
+	}
+	return &compactionTuner{
+		min:            min,
+		max:            max,
+		trigger:        clamp(initial, min, max),
+		maxCompactions: maxCompactions,
+		compactions:    maxCompactions,
+		windowStart:    time.Now(),
+		logger:         logger,
+	}
+}
+
+// recordGet notes a point lookup that consulted probes SSTables.
+func (t *compactionTuner) recordGet(probes int) {
+	t.gets.Add(1)
+	t.probes.Add(int64(probes))
+}
+
+// adjust closes the current window and moves the trigger and parallelism
+// one step if the window's metrics call for it. numLevels and multiplier define the ideal
+// amplification bounds. Must be called with d.mu held.
+func (t *compactionTuner) adjust(numLevels, multiplier int) {
+	elapsed := time.Since(t.windowStart)
+	gets := t.gets.Swap(0)
+	probes := t.probes.Swap(0)
+
+	var readAmp, writeAmp, stallFraction float64
+	if gets > 0 {
+		readAmp = float64(probes) / float64(gets)
+	}
+	if t.userBytes > 0 {
+		writeAmp = float64(t.writtenBytes) / float64(t.userBytes)
+	}
+	if elapsed > 0 {
+		stallFraction = float64(t.stall) / float64(elapsed)
+	}
+
+	previous := t.trigger
+	switch {
+	case stallFraction > maxStallFraction:
+		t.trigger++
+	case readAmp > float64(numLevels):
+		t.trigger--
+	case writeAmp > float64(multiplier*numLevels):
+		t.trigger++
+	}
+	t.trigger = clamp(t.trigger, t.min, t.max)
+
+	previousCompactions := t.compactions
+	switch {
+	case stallFraction > maxStallFraction:
+		t.compactions++
+	case t.stall == 0:
+		t.compactions--
+	}
+	t.compactions = clamp(t.compactions, 1, t.maxCompactions)
+
+	if t.trigger != previous {
+		t.logger.Log(common.LevelInfo, "changed L0 compaction trigger", "from", previous, "to", t.trigger,
+			"read_amp", readAmp, "write_amp", writeAmp, "stall_fraction", stallFraction)
+	}
+	if t.compactions != previousCompactions {
+		t.logger.Log(common.LevelInfo, "changed compaction parallelism", "from", previousCompactions, "to", t.compactions,
+			"stall_fraction", stallFraction)
+	}
+
+	t.userBytes = 0
+	t.writtenBytes = 0
+	t.stall = 0
+	t.windowStart = time.Now()
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// maxCompactions returns how many compactions may run at once, as set by
+// the tuner when auto-tuning is enabled.
+// Must be called with d.mu held.
+func (d *DB) maxCompactions() int {
+	if d.tuner != nil {
+		return d.tuner.compactions
+	}
+	return d.Opts.MaxBackgroundCompactions
+}
+
+// l0CompactionTrigger returns the L0 file count that triggers compaction,
+// as set by the tuner when auto-tuning is enabled.
+func (d *DB) l0CompactionTrigger() int {
+	if d.tuner != nil {
+		return d.tuner.trigger
+	}
+	return d.Opts.L0CompactionTrigger
+}
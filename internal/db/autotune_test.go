@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionTunerAdjust(t *testing.T) {
+	const numLevels, multiplier = 4, 10
+
+	tests := []struct {
+		name         string
+		trigger      int
+		gets, probes int64
+		userBytes    int64
+		writtenBytes int64
+		stall        time.Duration
+		compactions  int // before the window, of at most 4
+		expected     int
+		expectedJobs int
+	}{
+		{"Balanced", 4, 100, 200, 1000, 5000, 0, 2, 4, 1},
+		{"WriteStall", 4, 0, 0, 1000, 1000, time.Hour, 2, 5, 3},
+		{"HighReadAmp", 4, 100, 800, 1000, 1000, 0, 2, 3, 1},
+		{"HighWriteAmp", 4, 100, 100, 1000, 50000, 0, 2, 5, 1},
+		{"StallBeatsReadAmp", 4, 100, 800, 1000, 1000, time.Hour, 2, 5, 3},
+		{"ClampedAtMax", 8, 0, 0, 1000, 1000, time.Hour, 4, 8, 4},
+		{"ClampedAtMin", 2, 100, 800, 1000, 1000, 0, 1, 2, 1},
+		{"BriefStall", 4, 0, 0, 1000, 1000, time.Second, 2, 4, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner := newCompactionTuner(2, 8, tt.trigger, 4, common.DiscardLogger)
+			tuner.compactions = tt.compactions
+			tuner.windowStart = time.Now().Add(-time.Minute)
+			tuner.gets.Store(tt.gets)
+			tuner.probes.Store(tt.probes)
+			tuner.userBytes = tt.userBytes
+			tuner.writtenBytes = tt.writtenBytes
+			tuner.stall = tt.stall
+
+			tuner.adjust(numLevels, multiplier)
+			require.Equal(t, tt.expected, tuner.trigger)
+			require.Equal(t, tt.expectedJobs, tuner.compactions)
+
+			// Every window starts from scratch
+			require.Zero(t, tuner.gets.Load())
+			require.Zero(t, tuner.userBytes)
+			require.Zero(t, tuner.stall)
+		})
+	}
+}
+
+func TestCompactionTunerInitialClamp(t *testing.T) {
+	require.Equal(t, 2, newCompactionTuner(2, 8, 1, 1, common.DiscardLogger).trigger)
+	require.Equal(t, 8, newCompactionTuner(2, 8, 20, 1, common.DiscardLogger).trigger)
+	require.Equal(t, 3, newCompactionTuner(2, 8, 4, 3, common.DiscardLogger).compactions)
+	require.Equal(t, 1, newCompactionTuner(2, 8, 4, 0, common.DiscardLogger).compactions)
+}
+
+func TestAutoTuneBoundsValidated(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+	}{
+		{"ZeroMin", 0, 4},
+		{"NegativeMin", -1, 4},
+		{"MaxBelowMin", 4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(WithDBPath(t.TempDir()), WithCompactionAutoTune(tt.min, tt.max))
+			require.ErrorContains(t, err, "L0CompactionTrigger")
+		})
+	}
+}
+
+func TestAutoTuneKeepsTriggerInBounds(t *testing.T) {
+	d, err := Open(
+		WithDBPath(t.TempDir()),
+		WithMemtableFlushThreshold(4),
+		WithCompactionAutoTune(2, 6),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i%50))
+		require.NoError(t, d.Put(key, []byte("v")))
+		_, err := d.Get(key)
+		require.NoError(t, err)
+
+		trigger := d.l0CompactionTrigger()
+		require.GreaterOrEqual(t, trigger, 2)
+		require.LessOrEqual(t, trigger, 6)
+	}
+}
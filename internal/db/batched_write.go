@@ -1,61 +1,232 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"time"
 
 	"amethyst/internal/common"
 )
 
+// ErrWriteStalled is returned by a write that found the write queue full or
+// waited longer than Options.WriteTimeout to be committed.
+var ErrWriteStalled = errors.New("db: write stalled")
+
 // writeRequest represents a pending write operation waiting for group commit.
 type writeRequest struct {
-	entry    *common.Entry
+	ctx context.Context // a request whose ctx is done before it commits is dropped
+	// entries are committed together, in one WAL record
+	entries  []*common.Entry
+	sync     bool            // sync the WAL before acknowledging the write
+	ttls     []time.Duration // expire entries[i] ttls[i] after they commit; 0 or missing never
 	resultCh chan error
+
+	// merge, if set, computes the Value of the request's one entry at commit
+	// time from the key's current value. A merge that fails sets err and
+	// drops the request from the batch without failing the others.
+	merge func(current []byte, found bool) ([]byte, error)
+	// check, if set, is run at commit time on the current value of the key
+	// of the request's one entry. An error drops the request as a failed
+	// merge does.
+	check func(current []byte, found bool) error
+	err   error
+}
+
+// submit hands req to the group commit loop and waits for its result. If
+// ctx is done or Options.WriteTimeout passes first, submit returns at once;
+// the loop drops the request unless it is already being committed, so the
+// write may or may not have happened. Once the DB is closed, requests the
+// loop didn't take fail with ErrClosed.
+func (d *DB) submit(ctx context.Context, req *writeRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-d.closeCh:
+		return ErrClosed
+	default:
+	}
+	if err := d.enqueueWrite(); err != nil {
+		return err
+	}
+	if d.Opts.WriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d.Opts.WriteTimeout, ErrWriteStalled)
+		defer cancel()
+	}
+	req.ctx = ctx
+	req.resultCh = make(chan error, 1)
+	select {
+	case d.writeChan <- req:
+	case <-d.closeCh:
+		d.queuedWrites.Add(-1)
+		return ErrClosed
+	case <-ctx.Done():
+		d.queuedWrites.Add(-1)
+		return d.abandonWrite(ctx)
+	}
+	select {
+	case err := <-req.resultCh:
+		if err == ErrWriteStalled {
+			d.stalledWrites.Add(1)
+		}
+		return err
+	case <-d.commitDone:
+		// The loop answered every request it took before exiting
+		select {
+		case err := <-req.resultCh:
+			return err
+		default:
+			return ErrClosed
+		}
+	case <-ctx.Done():
+		return d.abandonWrite(ctx)
+	}
+}
+
+// enqueueWrite counts a write into the queue, failing it if the queue is
+// already Options.MaxWriteQueueDepth deep. The group commit loop counts it
+// out once it is acknowledged.
+func (d *DB) enqueueWrite() error {
+	depth := d.queuedWrites.Add(1)
+	if limit := d.Opts.MaxWriteQueueDepth; limit > 0 && depth > int64(limit) {
+		d.queuedWrites.Add(-1)
+		d.stalledWrites.Add(1)
+		return ErrWriteStalled
+	}
+	for peak := d.peakQueuedWrites.Load(); depth > peak; peak = d.peakQueuedWrites.Load() {
+		if d.peakQueuedWrites.CompareAndSwap(peak, depth) {
+			break
+		}
+	}
+	return nil
+}
+
+// abandonWrite returns the error of a write given up on because ctx is
+// done: ErrWriteStalled if it timed out, or ctx's error.
+func (d *DB) abandonWrite(ctx context.Context) error {
+	if context.Cause(ctx) == ErrWriteStalled {
+		d.stalledWrites.Add(1)
+		return ErrWriteStalled
+	}
+	return ctx.Err()
 }
 
 // processBatch processes a batch of write requests under the DB lock.
-// It handles flushing, sequence assignment, WAL writes, and memtable updates.
-// Returns an error if any step fails.
+// It handles memtable rotation, sequence assignment, WAL writes, and
+// memtable updates. Returns an error if any step fails.
 func (d *DB) processBatch(batch []*writeRequest) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// Check if flush needed (synchronous, under lock)
-	if d.memtable.Len() >= d.Opts.MemtableFlushThreshold {
-		if err := d.flushMemtable(); err != nil {
-			return err
+	if err := d.makeRoomForWrite(); err != nil {
+		return err
+	}
+
+	// Writers that gave up while the batch waited are dropped, as failed
+	// merges are
+	for _, req := range batch {
+		if req.ctx.Err() != nil {
+			req.err = context.Cause(req.ctx)
 		}
 	}
 
-	// Assign sequence numbers to all entries in batch
+	if err := d.applyReads(batch); err != nil {
+		return err
+	}
+
+	// Assign sequence numbers and the commit timestamp to all entries in batch
+	now := time.Now().UnixNano()
 	entries := make([]*common.Entry, 0, len(batch))
 	for _, req := range batch {
-		d.nextSeq++
-		req.entry.Seq = d.nextSeq
-		entries = append(entries, req.entry)
+		if req.err != nil {
+			continue
+		}
+		for i, entry := range req.entries {
+			d.nextSeq++
+			entry.Seq = d.nextSeq
+			entry.Timestamp = now
+			if i < len(req.ttls) && req.ttls[i] > 0 {
+				entry.ExpiresAt = now + int64(req.ttls[i])
+			}
+			entries = append(entries, entry)
+		}
 	}
+	d.manifest.SetLastSeq(d.nextSeq)
 
-	// Write entire batch to WAL with single sync
-	if err := d.wal.WriteEntry(entries); err != nil {
+	var userBytes int64
+	for _, e := range entries {
+		userBytes += int64(len(e.Key) + len(e.Value))
+	}
+	if d.tuner != nil {
+		d.tuner.userBytes += userBytes
+	}
+
+	// Write entire batch to WAL, with a single sync if any writer asked for
+	// one. The sync also covers unsynced batches before it.
+	if err := d.wal.Append(entries); err != nil {
 		return err
 	}
+	if slices.ContainsFunc(batch, func(req *writeRequest) bool { return req.sync && req.err == nil }) {
+		if err := d.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	d.keysWritten.Add(uint64(len(entries)))
+	d.bytesWritten.Add(uint64(userBytes))
+	if d.backlog != nil {
+		d.backlog.add(entries)
+	}
 
 	// Update memtable
 	for _, req := range batch {
-		switch req.entry.Type {
-		case common.EntryTypePut:
-			d.memtable.Put(req.entry.Key, req.entry.Value)
-		case common.EntryTypeDelete:
-			d.memtable.Delete(req.entry.Key)
+		if req.err == nil {
+			for _, entry := range req.entries {
+				d.memtable.Apply(entry)
+			}
 		}
 	}
+	d.reportWriteBuffer()
 
 	return nil
 }
 
+// makeRoomForWrite swaps in a fresh memtable once the current one is full,
+// leaving the flush to the background unless too many are already waiting
+// for one.
+// Must be called with d.mu held.
+func (d *DB) makeRoomForWrite() error {
+	if d.memtable.Len() < d.Opts.MemtableFlushThreshold {
+		return nil
+	}
+	stallStart := time.Now()
+	d.waitForL0()
+	// Once the DB is closing, the last batches commit past the queue limit
+	// rather than fail; their WALs are replayed on open
+	err := d.waitForFlushes(max(d.Opts.MaxImmutableMemtables, 1) - 1)
+	if err != nil && err != ErrClosed {
+		return err
+	}
+	if err := d.rotateMemtable(); err != nil {
+		return err
+	}
+	d.scheduleFlush()
+	if d.tuner != nil {
+		d.tuner.stall += time.Since(stallStart)
+		d.tuner.adjust(len(d.manifest.Current().Levels), d.Opts.LevelSizeMultiplier)
+	}
+	return nil
+}
+
 // groupCommitLoop is the main batching coordinator.
 // It runs in a background goroutine, collecting batches of write requests
-// and committing them together with a single WAL sync.
+// and committing them together with a single WAL sync, until the DB is
+// closed.
 func (d *DB) groupCommitLoop() {
+	defer d.bgWG.Done()
+	defer close(d.commitDone)
+
 	maxBatchSize := d.Opts.MaxBatchSize
 	batchTimeout := d.Opts.BatchTimeout
 	timer := time.NewTimer(batchTimeout)
@@ -69,7 +240,12 @@ func (d *DB) groupCommitLoop() {
 		for len(batch) < maxBatchSize && !done {
 			if len(batch) == 0 {
 				// Block waiting for first request
-				batch = append(batch, <-d.writeChan)
+				select {
+				case req := <-d.writeChan:
+					batch = append(batch, req)
+				case <-d.closeCh:
+					return
+				}
 			} else {
 				// Have at least one request, collect more with timeout
 				select {
@@ -77,6 +253,9 @@ func (d *DB) groupCommitLoop() {
 					batch = append(batch, req)
 				case <-timer.C:
 					done = true
+				case <-d.closeCh:
+					// Commit what was collected, then stop
+					done = true
 				}
 			}
 		}
@@ -84,9 +263,20 @@ func (d *DB) groupCommitLoop() {
 		// Process the batch
 		err := d.processBatch(batch)
 
+		// Publish committed mutations before acknowledging writers, so a
+		// writer that returns has already been observed by every watcher
+		if err == nil {
+			d.notifyWatchers(batch)
+		}
+
 		// Notify all writers in batch
 		for _, req := range batch {
-			req.resultCh <- err
+			if req.err != nil {
+				req.resultCh <- req.err
+			} else {
+				req.resultCh <- err
+			}
 		}
+		d.queuedWrites.Add(-int64(len(batch)))
 	}
 }
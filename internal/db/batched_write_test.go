@@ -1,8 +1,10 @@
 package db_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"amethyst/internal/db"
 	"github.com/stretchr/testify/require"
@@ -49,3 +51,70 @@ func TestConcurrentWritesWithFlush(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteContext(t *testing.T) {
+	// Batches wait for a second write, so a first one can give up queued
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMaxBatchSize(2), db.WithBatchTimeout(time.Hour))
+	require.NoError(t, err)
+	defer d.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, d.PutContext(ctx, []byte("a"), []byte("v")), context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, d.PutContext(ctx, []byte("b"), []byte("v")), context.DeadlineExceeded)
+	require.NoError(t, d.PutContext(context.Background(), []byte("c"), []byte("v")))
+
+	// The abandoned write was dropped from the batch that committed the next
+	for _, key := range []string{"a", "b"} {
+		_, err = d.Get([]byte(key))
+		require.ErrorIs(t, err, db.ErrNotFound, key)
+	}
+	value, err := d.GetContext(context.Background(), []byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, "v", string(value))
+}
+
+func TestGetContext(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.Put([]byte("flushed"), []byte("v")))
+	require.NoError(t, d.Compact())
+	require.NoError(t, d.Put([]byte("buffered"), []byte("v")))
+
+	// A done context stops the read before it reaches a table
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.GetContext(ctx, []byte("flushed"))
+	require.ErrorIs(t, err, context.Canceled)
+	value, err := d.GetContext(ctx, []byte("buffered"))
+	require.NoError(t, err)
+	require.Equal(t, "v", string(value))
+}
+
+func TestWriteStalls(t *testing.T) {
+	// Batches wait for a second write, so the first stays queued
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMaxBatchSize(2),
+		db.WithBatchTimeout(time.Hour),
+		db.WithMaxWriteQueueDepth(1),
+		db.WithWriteTimeout(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// The first write times out waiting for its batch, and the second finds
+	// the queue full because the loop still holds the first
+	require.ErrorIs(t, d.Put([]byte("a"), []byte("v")), db.ErrWriteStalled)
+	require.ErrorIs(t, d.Put([]byte("b"), []byte("v")), db.ErrWriteStalled)
+
+	stats := d.Stats()
+	require.Equal(t, 1, stats.WriteQueueDepth)
+	require.Equal(t, 1, stats.PeakWriteQueueDepth)
+	require.EqualValues(t, 2, stats.StalledWrites)
+	require.Zero(t, stats.KeysWritten)
+}
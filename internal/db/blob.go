@@ -0,0 +1,254 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"amethyst/internal/blob"
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/manifest"
+	"amethyst/internal/vfs"
+)
+
+// blobSeparator moves values of at least BlobThreshold bytes from the entries
+// it passes through into a new blob file, created on first use, and replaces
+// them with blob references. References into files in gc are relocated the
+// same way so those files stop being referenced. It records which blob files
+// the entries since the last takeRefs point into.
+type blobSeparator struct {
+	d      *DB
+	source common.EntryIterator
+	gc     map[common.FileNo]struct{}
+	writer blob.Writer
+	refs   map[common.FileNo]struct{}
+}
+
+func (d *DB) newBlobSeparator(source common.EntryIterator, gc map[common.FileNo]struct{}) *blobSeparator {
+	return &blobSeparator{
+		d:      d,
+		source: source,
+		gc:     gc,
+		refs:   make(map[common.FileNo]struct{}),
+	}
+}
+
+func (s *blobSeparator) Next() (*common.Entry, error) {
+	entry, err := s.source.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	switch entry.Type {
+	case common.EntryTypeBlobRef:
+		h, err := blob.DecodeHandle(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("bad blob reference for %q: %w", entry.Key, err)
+		}
+		if _, ok := s.gc[h.FileNo]; !ok {
+			s.refs[h.FileNo] = struct{}{}
+			return entry, nil
+		}
+		value, err := s.d.blobs.Get(h)
+		if err != nil {
+			return nil, err
+		}
+		return s.separate(entry, value)
+
+	case common.EntryTypePut:
+		return s.separate(entry, entry.Value)
+	}
+	return entry, nil
+}
+
+// separate returns entry as a put of value, with value moved to the blob
+// file if it reaches the threshold.
+func (s *blobSeparator) separate(entry *common.Entry, value []byte) (*common.Entry, error) {
+	threshold := s.d.Opts.BlobThreshold
+	if threshold <= 0 || len(value) < threshold {
+		if entry.Type == common.EntryTypePut {
+			return entry, nil
+		}
+		return &common.Entry{
+			Type:      common.EntryTypePut,
+			Seq:       entry.Seq,
+			Timestamp: entry.Timestamp,
+			ExpiresAt: entry.ExpiresAt,
+			Key:       entry.Key,
+			Value:     value,
+		}, nil
+	}
+
+	if s.writer == nil {
+		fileNo := s.d.manifest.NewSSTableNumber()
+		w, err := blob.NewWriter(s.d.tableFS(), s.d.paths.BlobPath(fileNo), fileNo)
+		if err != nil {
+			return nil, err
+		}
+		s.writer = w
+	}
+	h, err := s.writer.Add(value)
+	if err != nil {
+		return nil, err
+	}
+	s.refs[h.FileNo] = struct{}{}
+
+	return &common.Entry{
+		Type:      common.EntryTypeBlobRef,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Key:       entry.Key,
+		Value:     h.Encode(),
+	}, nil
+}
+
+// takeRefs returns the blob files referenced since the last call, in order.
+func (s *blobSeparator) takeRefs() []common.FileNo {
+	if len(s.refs) == 0 {
+		return nil
+	}
+	refs := make([]common.FileNo, 0, len(s.refs))
+	for fileNo := range s.refs {
+		refs = append(refs, fileNo)
+	}
+	slices.Sort(refs)
+	clear(s.refs)
+	return refs
+}
+
+// finish makes the blob file durable and returns it for the manifest edit,
+// or nothing if no value was separated.
+func (s *blobSeparator) finish() ([]common.FileNo, error) {
+	if s.writer == nil {
+		return nil, nil
+	}
+	if err := s.writer.Finish(); err != nil {
+		return nil, err
+	}
+	if err := vfs.SyncDir(s.d.fs, s.d.paths.BlobDir()); err != nil {
+		return nil, err
+	}
+	return []common.FileNo{s.writer.FileNo()}, nil
+}
+
+// abort removes the blob file, if one was started.
+func (s *blobSeparator) abort() {
+	if s.writer != nil {
+		s.writer.Abort()
+	}
+}
+
+// blobGCSet returns the oldest BlobGCCutoff share of v's blob files, whose
+// values compaction relocates.
+func (d *DB) blobGCSet(v *manifest.Version) map[common.FileNo]struct{} {
+	n := int(float64(len(v.BlobFiles)) * d.Opts.BlobGCCutoff)
+	gc := make(map[common.FileNo]struct{}, n)
+	for _, fileNo := range v.BlobFiles[:min(n, len(v.BlobFiles))] {
+		gc[fileNo] = struct{}{}
+	}
+	return gc
+}
+
+// resolveBlob returns the put that a blob reference stands for. Other
+// entries are returned unchanged. At BlockCacheTier blob reads fail with
+// ErrWouldBlock, since blob files have no cache.
+func (d *DB) resolveBlob(entry *common.Entry, tier ReadTier) (*common.Entry, error) {
+	if entry.Type != common.EntryTypeBlobRef {
+		return entry, nil
+	}
+	if tier == BlockCacheTier {
+		return nil, ErrWouldBlock
+	}
+
+	h, err := blob.DecodeHandle(entry.Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad blob reference for %q: %w", entry.Key, err)
+	}
+	value, err := d.blobs.Get(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value of %q: %w", entry.Key, err)
+	}
+	return &common.Entry{
+		Type:      common.EntryTypePut,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Key:       entry.Key,
+		Value:     value,
+	}, nil
+}
+
+// blobResolvingIterator replaces blob references with the puts they stand for.
+type blobResolvingIterator struct {
+	iterator.Iterator
+	d *DB
+}
+
+func (it *blobResolvingIterator) Next() (*common.Entry, error) {
+	entry, err := it.Iterator.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return it.d.resolveBlob(entry, ReadAllTier)
+}
+
+// deleteObsoleteBlobFiles drops blob files that no table references any
+// more from the manifest, then removes them. Files still referenced by a
+// pinned version, and all files while deletions are disabled, are left for a
+// later call.
+// Must be called with d.mu held.
+func (d *DB) deleteObsoleteBlobFiles() error {
+	if d.manifest.FileDeletionsDisabled() {
+		return nil
+	}
+	obsolete := d.manifest.UnreferencedBlobFiles()
+	if len(obsolete) == 0 {
+		return nil
+	}
+
+	deleted := make(map[common.FileNo]struct{}, len(obsolete))
+	for _, fileNo := range obsolete {
+		deleted[fileNo] = struct{}{}
+	}
+	d.manifest.Apply(&manifest.CompactionEdit{DeleteBlobFiles: deleted})
+	if err := d.manifest.Flush(); err != nil {
+		return err
+	}
+
+	for _, fileNo := range obsolete {
+		if err := d.blobs.Evict(fileNo); err != nil {
+			d.logger("blob").Log(common.LevelWarn, "failed to close blob file", "file", fileNo, "err", err)
+		}
+		if err := d.fs.Remove(d.paths.BlobPath(fileNo)); err != nil {
+			d.logger("blob").Log(common.LevelError, "failed to delete blob file", "file", fileNo, "err", err)
+		}
+	}
+	d.logger("blob").Log(common.LevelInfo, "deleted blob files", "count", len(obsolete))
+	return nil
+}
+
+// removeOrphanBlobFiles removes blob files that the manifest doesn't list,
+// left behind by flushes and compactions interrupted before their commit.
+func removeOrphanBlobFiles(fsys vfs.FS, paths *common.PathManager, v *manifest.Version) error {
+	entries, err := fsys.ReadDir(paths.BlobDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		n, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".blob"), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".blob") {
+			continue
+		}
+		if slices.Contains(v.BlobFiles, common.FileNo(n)) {
+			continue
+		}
+		if err := fsys.Remove(filepath.Join(paths.BlobDir(), entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
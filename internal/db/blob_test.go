@@ -0,0 +1,105 @@
+package db_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobSeparation(t *testing.T) {
+	dir := t.TempDir()
+	opts := []db.Option{
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(10),
+		db.WithBlobThreshold(64),
+		db.WithBlobGCCutoff(0),
+	}
+	d, err := db.Open(opts...)
+	require.NoError(t, err)
+
+	large := func(i int, gen string) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%s-%03d.", gen, i)), 16)
+	}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("big%03d", i)), large(i, "a")))
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("small%03d", i)), []byte("tiny")))
+	}
+	require.NoError(t, d.Compact())
+
+	blobFiles := d.Manifest().Current().BlobFiles
+	require.NotEmpty(t, blobFiles)
+	for _, fileNo := range blobFiles {
+		require.FileExists(t, d.Paths().BlobPath(fileNo))
+	}
+
+	// Overwriting every large value leaves the old blob files unreferenced
+	// once compaction drops the shadowed versions
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("big%03d", i)), large(i, "b")))
+	}
+	require.NoError(t, d.Compact())
+	for _, fileNo := range blobFiles {
+		require.NotContains(t, d.Manifest().Current().BlobFiles, fileNo)
+		require.NoFileExists(t, d.Paths().BlobPath(fileNo))
+	}
+	require.NoError(t, d.Close())
+
+	// Values read back through blob references after reopening
+	d, err = db.Open(opts...)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 20; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("big%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, large(i, "b"), value)
+	}
+	entries, err := d.Scan(db.KeyPrefix([]byte("big")), 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 20)
+	for i, entry := range entries {
+		require.Equal(t, common.EntryTypePut, entry.Type)
+		require.Equal(t, large(i, "b"), entry.Value)
+	}
+	value, err := d.Get([]byte("small007"))
+	require.NoError(t, err)
+	require.Equal(t, "tiny", string(value))
+
+	_, err = d.GetFromTier([]byte("big007"), db.BlockCacheTier)
+	require.ErrorIs(t, err, db.ErrWouldBlock)
+}
+
+func TestBlobGarbageCollection(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(10),
+		db.WithBlobThreshold(8),
+		db.WithBlobGCCutoff(1),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value-%03d", i))))
+	}
+	require.NoError(t, d.Compact())
+
+	// Compaction relocated every live value out of the flushed blob file
+	blobFiles := d.Manifest().Current().BlobFiles
+	require.Len(t, blobFiles, 1)
+	require.NoError(t, d.Put([]byte("key000"), []byte("overwritten")))
+	require.NoError(t, d.Compact())
+	require.Len(t, d.Manifest().Current().BlobFiles, 1)
+	require.NotEqual(t, blobFiles, d.Manifest().Current().BlobFiles)
+	require.NoFileExists(t, d.Paths().BlobPath(blobFiles[0]))
+
+	for i := 1; i < 10; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("value-%03d", i), string(value))
+	}
+}
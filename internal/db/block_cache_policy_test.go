@@ -0,0 +1,45 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCachePolicies(t *testing.T) {
+	for _, policy := range []block_cache.Policy{block_cache.PolicyLRU, block_cache.PolicyClock, block_cache.PolicyTinyLFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(10))
+			require.NoError(t, err)
+			for i := range 50 {
+				key := fmt.Sprintf("key%02d", i)
+				require.NoError(t, d.Put([]byte(key), []byte("value of "+key)))
+			}
+			require.NoError(t, d.Close())
+
+			d, err = db.Open(db.WithDBPath(dir), db.WithBlockCachePolicy(policy))
+			require.NoError(t, err)
+			defer d.Close()
+
+			// The second pass is served from the cache
+			for pass := range 2 {
+				before := d.Stats().BlockCache
+				for i := range 50 {
+					key := fmt.Sprintf("key%02d", i)
+					value, err := d.Get([]byte(key))
+					require.NoError(t, err)
+					require.Equal(t, "value of "+key, string(value))
+				}
+				after := d.Stats().BlockCache
+				if pass == 1 {
+					require.Equal(t, before.Misses, after.Misses)
+					require.Greater(t, after.Hits, before.Hits)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+)
+
+// ErrBulkLoadOverlap is returned when bulk-loaded keys overlap keys the
+// database already holds.
+var ErrBulkLoadOverlap = errors.New("db: bulk load overlaps existing keys")
+
+// BulkLoad writes the puts from entries straight into SSTables in the bottom
+// level and commits them with a single manifest edit, skipping the WAL,
+// memtable, and every compaction in between. It is meant for initial imports.
+//
+// Keys must be strictly increasing and must not overlap any key already in
+// the database, since bottom-level data could not shadow older versions above
+// it; ErrBulkLoadOverlap is returned otherwise and nothing is committed.
+// Loaded entries get sequence number 0 so every later write supersedes them.
+// Returns the number of entries loaded.
+func (d *DB) BulkLoad(entries common.EntryIterator) (int, error) {
+	if d.Opts.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	start := time.Now()
+
+	level := len(d.manifest.Current().Levels) - 1
+	var outputs []manifest.FileMetadata
+	var n int
+	source := &bulkLoadIterator{source: entries, timestamp: start.UnixNano()}
+	blobs := d.newBlobSeparator(source, nil)
+	committed := false
+	defer func() {
+		if !committed {
+			for _, fm := range outputs {
+				d.fs.Remove(d.paths.SSTablePath(level, fm.FileNo))
+			}
+			blobs.abort()
+		}
+	}()
+
+	for {
+		more, err := source.hasNext()
+		if err != nil {
+			return 0, err
+		}
+		if !more {
+			break
+		}
+
+		limited := &limitIterator{source: blobs, limit: d.Opts.MemtableFlushThreshold}
+		fm, result, err := d.buildTable(level, d.manifest.NewSSTableNumber(), limited, nil, d.Opts.MemtableFlushThreshold)
+		if err != nil {
+			return 0, err
+		}
+		fm.BlobFiles = blobs.takeRefs()
+		outputs = append(outputs, *fm)
+		n += int(result.EntryCount)
+	}
+	if len(outputs) == 0 {
+		return 0, nil
+	}
+	blobFiles, err := blobs.finish()
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	smallest, largest := outputs[0].SmallestKey, outputs[len(outputs)-1].LargestKey
+	if err := d.checkBulkLoadRange(smallest, largest); err != nil {
+		return 0, err
+	}
+
+	edit := &manifest.CompactionEdit{
+		AddSSTables:  map[int][]manifest.FileMetadata{level: outputs},
+		AddBlobFiles: blobFiles,
+	}
+	d.manifest.Apply(edit)
+	committed = true
+	if err := d.manifest.Flush(); err != nil {
+		return 0, err
+	}
+	d.notifyTablesCreated(edit)
+
+	d.recordShape("bulk load")
+
+	d.logger("bulkload").Log(common.LevelInfo, "bulk loaded tables", "entries", n, "files", len(outputs), "level", level, "duration", time.Since(start))
+	return n, nil
+}
+
+// checkBulkLoadRange fails with ErrBulkLoadOverlap if any table or memtable
+// entry falls in [smallest, largest], or any range tombstone overlaps it:
+// the loaded entries would be older than the tombstone, so it would delete
+// them. Must be called with d.mu held.
+func (d *DB) checkBulkLoadRange(smallest, largest []byte) error {
+	for level, fileMetas := range d.manifest.Current().Levels {
+		for _, fm := range fileMetas {
+			if bytes.Compare(fm.SmallestKey, largest) <= 0 && bytes.Compare(fm.LargestKey, smallest) >= 0 {
+				return fmt.Errorf("%w: L%d/%d.sst holds [%q, %q]", ErrBulkLoadOverlap, level, fm.FileNo, fm.SmallestKey, fm.LargestKey)
+			}
+		}
+	}
+
+	key, err := d.memtableKeyInRange(smallest, largest)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		return fmt.Errorf("%w: memtable holds %q", ErrBulkLoadOverlap, key)
+	}
+
+	// Memtable iterators skip range tombstones, so check them apart, along
+	// with those of tables, whose bounds needn't span theirs
+	rangeDels, err := d.rangeTombstones(d.memtables(), d.manifest.Current(), ReadAllTier)
+	if err != nil {
+		return err
+	}
+	for _, t := range rangeDels {
+		if bytes.Compare(t.Key, largest) <= 0 && bytes.Compare(t.Value, smallest) > 0 {
+			return fmt.Errorf("%w: range tombstone deletes [%q, %q)", ErrBulkLoadOverlap, t.Key, t.Value)
+		}
+	}
+	return nil
+}
+
+// memtableKeyInRange returns a key in [smallest, largest] held by the
+// memtable or the immutable queue, or nil if there is none.
+// Must be called with d.mu held.
+func (d *DB) memtableKeyInRange(smallest, largest []byte) ([]byte, error) {
+	for _, mem := range d.memtables() {
+		iter := mem.Iterator()
+		for {
+			entry, err := iter.Next()
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				break
+			}
+			if bytes.Compare(entry.Key, smallest) >= 0 && bytes.Compare(entry.Key, largest) <= 0 {
+				return entry.Key, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// bulkLoadIterator checks that input keys are strictly increasing puts and
+// stamps them as the oldest version. It buffers one entry so callers can
+// check whether another output file is needed.
+type bulkLoadIterator struct {
+	source    common.EntryIterator
+	timestamp int64
+	lastKey   []byte
+	peeked    *common.Entry
+}
+
+func (it *bulkLoadIterator) hasNext() (bool, error) {
+	if it.peeked != nil {
+		return true, nil
+	}
+	entry, err := it.next()
+	if err != nil {
+		return false, err
+	}
+	it.peeked = entry
+	return entry != nil, nil
+}
+
+func (it *bulkLoadIterator) Next() (*common.Entry, error) {
+	if it.peeked != nil {
+		entry := it.peeked
+		it.peeked = nil
+		return entry, nil
+	}
+	return it.next()
+}
+
+func (it *bulkLoadIterator) next() (*common.Entry, error) {
+	entry, err := it.source.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if entry.Type != common.EntryTypePut {
+		return nil, fmt.Errorf("bulk load: %q is not a put", entry.Key)
+	}
+	if it.lastKey != nil && bytes.Compare(entry.Key, it.lastKey) <= 0 {
+		return nil, fmt.Errorf("bulk load: key %q does not follow %q", entry.Key, it.lastKey)
+	}
+	it.lastKey = bytes.Clone(entry.Key)
+
+	return &common.Entry{
+		Type:      common.EntryTypePut,
+		Timestamp: it.timestamp,
+		Key:       entry.Key,
+		Value:     entry.Value,
+	}, nil
+}
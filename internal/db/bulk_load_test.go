@@ -0,0 +1,146 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceIterator struct {
+	entries []*common.Entry
+}
+
+func (it *sliceIterator) Next() (*common.Entry, error) {
+	if len(it.entries) == 0 {
+		return nil, nil
+	}
+	entry := it.entries[0]
+	it.entries = it.entries[1:]
+	return entry, nil
+}
+
+func puts(keys ...string) *sliceIterator {
+	it := &sliceIterator{}
+	for _, key := range keys {
+		it.entries = append(it.entries, &common.Entry{Type: common.EntryTypePut, Key: []byte(key), Value: []byte("v-" + key)})
+	}
+	return it
+}
+
+func TestBulkLoad(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(10))
+	require.NoError(t, err)
+	defer d.Close()
+
+	var keys []string
+	for i := 0; i < 35; i++ {
+		keys = append(keys, fmt.Sprintf("key%03d", i))
+	}
+	n, err := d.BulkLoad(puts(keys...))
+	require.NoError(t, err)
+	require.Equal(t, 35, n)
+
+	// Everything lands in the bottom level, nothing in the memtable
+	levels := d.Manifest().Current().Levels
+	require.Len(t, levels[len(levels)-1], 4)
+	require.Zero(t, d.Memtable().Len())
+
+	for _, key := range keys {
+		value, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v-"+key), value)
+	}
+
+	// Later writes supersede loaded entries
+	require.NoError(t, d.Put([]byte("key000"), []byte("new")))
+	value, err := d.Get([]byte("key000"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), value)
+}
+
+func TestBulkLoadRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *sliceIterator
+		err   error
+	}{
+		{"Overlap", puts("a", "m", "z"), db.ErrBulkLoadOverlap},
+		{"Unsorted", puts("x", "w"), nil},
+		{"Duplicate", puts("x", "x"), nil},
+		{"Delete", &sliceIterator{entries: []*common.Entry{{Type: common.EntryTypeDelete, Key: []byte("x")}}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(10))
+			require.NoError(t, err)
+			defer d.Close()
+			require.NoError(t, d.Put([]byte("m"), []byte("existing")))
+
+			_, err = d.BulkLoad(tt.input)
+			require.Error(t, err)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			}
+
+			// Nothing was committed and no tables were left behind
+			levels := d.Manifest().Current().Levels
+			for _, files := range levels {
+				require.Empty(t, files)
+			}
+			entries, err := os.ReadDir(filepath.Join(d.Paths().SSTableDir(), fmt.Sprint(len(levels)-1)))
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestBulkLoadRejectsRangeTombstones(t *testing.T) {
+	tests := []struct {
+		name    string
+		flushed bool
+	}{
+		{"Memtable", false},
+		{"Table", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(4))
+			require.NoError(t, err)
+			defer d.Close()
+
+			// The tombstone covers no key written, so only it overlaps the load
+			require.NoError(t, d.DeleteRange([]byte("m"), []byte("p")))
+			if tt.flushed {
+				for _, key := range []string{"a", "b", "c", "d", "e"} {
+					require.NoError(t, d.Put([]byte(key), []byte("v")))
+				}
+				d.WaitForCompactions()
+				rangeDels := 0
+				for _, files := range d.Manifest().Current().Levels {
+					for _, fm := range files {
+						rangeDels += int(fm.RangeDels)
+					}
+				}
+				require.Equal(t, 1, rangeDels)
+			}
+
+			_, err = d.BulkLoad(puts("n"))
+			require.ErrorIs(t, err, db.ErrBulkLoadOverlap)
+
+			// Loads beside the tombstone are fine
+			n, err := d.BulkLoad(puts("q", "r"))
+			require.NoError(t, err)
+			require.Equal(t, 2, n)
+			value, err := d.Get([]byte("q"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("v-q"), value)
+		})
+	}
+}
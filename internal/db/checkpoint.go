@@ -0,0 +1,277 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/vfs"
+	"amethyst/internal/wal"
+)
+
+// Checkpoint writes a consistent copy of the database as of the call into
+// dir, which must not exist yet. The copy opens like any other database. The
+// memtable is flushed first, so the copy needs no WAL. SSTables and blob
+// files are hard-linked where the filesystem allows, so the copy takes
+// little extra space until compaction replaces the originals. Writes carry
+// on while the files are linked.
+func (d *DB) Checkpoint(dir string) error {
+	if d.Opts.ReadOnly {
+		return d.checkpoint(dir)
+	}
+	if _, err := d.fs.Stat(dir); err == nil {
+		return fmt.Errorf("checkpoint: %s already exists", dir)
+	}
+	start := time.Now()
+
+	d.mu.Lock()
+	if err := d.flushMemtable(); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	v := d.manifest.Ref()
+	d.mu.Unlock()
+	defer d.manifest.Unref(v)
+
+	if err := d.writeCheckpoint(dir, v, nil); err != nil {
+		d.fs.RemoveAll(dir)
+		return err
+	}
+	d.logger("checkpoint").Log(common.LevelInfo, "created checkpoint", "dir", dir, "duration", time.Since(start))
+	return nil
+}
+
+// checkpoint writes a consistent, openable copy of the database into dir,
+// copying the live WALs rather than flushing the memtable. Writers are held
+// off only while the version is pinned and the WALs' lengths are noted; the
+// files are linked and copied afterwards, the WALs up to those lengths. File
+// deletions stay disabled meanwhile so a flush can't retire the WALs.
+func (d *DB) checkpoint(dir string) error {
+	d.mu.RLock()
+	v := d.manifest.Ref()
+	d.manifest.DisableFileDeletions()
+	walSizes := make(map[common.FileNo]int64)
+	var err error
+	for _, num := range v.LiveWALs() {
+		info, statErr := d.fs.Stat(d.paths.WALPath(num))
+		if statErr != nil {
+			err = statErr
+			break
+		}
+		walSizes[num] = info.Size()
+	}
+	d.mu.RUnlock()
+	defer d.manifest.Unref(v)
+	defer func() {
+		if err := d.EnableFileDeletions(); err != nil {
+			d.logger("checkpoint").Log(common.LevelError, "failed to delete obsolete files", "err", err)
+		}
+	}()
+
+	if err != nil {
+		return err
+	}
+	return d.writeCheckpoint(dir, v, walSizes)
+}
+
+// writeCheckpoint writes a copy of version v into dir. SSTables and blob
+// files are immutable, so they are hard-linked (copied if linking fails).
+// With walSizes, v's live WALs are copied too, each up to its size there,
+// and the caller must keep them from being retired meanwhile; otherwise the
+// copy gets an empty WAL in their place. A MANIFEST describing exactly those files is written last.
+func (d *DB) writeCheckpoint(dir string, v *manifest.Version, walSizes map[common.FileNo]int64) error {
+	if _, err := d.fs.Stat(dir); err == nil {
+		return fmt.Errorf("checkpoint: %s already exists", dir)
+	}
+
+	target := common.NewPathManager(dir)
+
+	if err := d.fs.MkdirAll(target.WALDir(), 0755); err != nil {
+		return err
+	}
+	for level := range v.Levels {
+		if err := d.fs.MkdirAll(filepath.Join(target.SSTableDir(), fmt.Sprint(level)), 0755); err != nil {
+			return err
+		}
+	}
+
+	for level, fileMetas := range v.Levels {
+		for _, fm := range fileMetas {
+			src := d.paths.SSTablePath(level, fm.FileNo)
+			if err := linkOrCopy(d.fs, src, target.SSTablePath(level, fm.FileNo)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Blob files are immutable once committed, like tables
+	if len(v.BlobFiles) > 0 {
+		if err := d.fs.MkdirAll(target.BlobDir(), 0755); err != nil {
+			return err
+		}
+	}
+	for _, fileNo := range v.BlobFiles {
+		if err := linkOrCopy(d.fs, d.paths.BlobPath(fileNo), target.BlobPath(fileNo)); err != nil {
+			return err
+		}
+	}
+
+	// The WALs of memtables not yet flushed are copied too; the newest is
+	// still being appended to, so they must be copied, not linked, and only
+	// as far as v's writes reach
+	if walSizes != nil {
+		for _, num := range v.LiveWALs() {
+			if err := copyFileN(d.fs, d.paths.WALPath(num), target.WALPath(num), walSizes[num]); err != nil {
+				return err
+			}
+		}
+	} else {
+		log, err := wal.CreateWAL(d.fs, target.WALPath(v.CurrentWAL))
+		if err != nil {
+			return err
+		}
+		if err := log.Close(); err != nil {
+			return err
+		}
+		withoutWALs := *v
+		withoutWALs.NextWALNumber = v.CurrentWAL + 1
+		v = &withoutWALs
+	}
+
+	// Persist the links and copies before the manifest can reference them
+	for _, sub := range checkpointDirs(target, v) {
+		if err := vfs.SyncDir(d.fs, sub); err != nil {
+			return err
+		}
+	}
+
+	f, err := d.fs.Create(target.ManifestPath())
+	if err != nil {
+		return err
+	}
+	if err := manifest.WriteManifest(f, v); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return vfs.SyncDir(d.fs, dir)
+}
+
+// checkpointDirs returns the directories of a checkpoint of v laid out by
+// target.
+func checkpointDirs(target *common.PathManager, v *manifest.Version) []string {
+	dirs := []string{target.WALDir()}
+	for level := range v.Levels {
+		dirs = append(dirs, filepath.Join(target.SSTableDir(), fmt.Sprint(level)))
+	}
+	if len(v.BlobFiles) > 0 {
+		dirs = append(dirs, target.BlobDir())
+	}
+	return dirs
+}
+
+// checkpointLoop takes a checkpoint every interval until the DB is closed,
+// keeping only the newest retain checkpoints.
+func (d *DB) checkpointLoop(interval time.Duration, retain int) {
+	defer d.bgWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.closeCh:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			// Names sort chronologically, which pruneCheckpoints relies on
+			dir := filepath.Join(d.paths.CheckpointDir(), fmt.Sprintf("%019d", start.UnixNano()))
+			if err := d.checkpoint(dir); err != nil {
+				d.logger("checkpoint").Log(common.LevelError, "periodic checkpoint failed", "err", err)
+				d.fs.RemoveAll(dir)
+				continue
+			}
+			if err := pruneCheckpoints(d.fs, d.paths.CheckpointDir(), retain); err != nil {
+				d.logger("checkpoint").Log(common.LevelError, "failed to prune checkpoints", "err", err)
+			}
+			d.logger("checkpoint").Log(common.LevelInfo, "created checkpoint", "dir", filepath.Base(dir), "duration", time.Since(start))
+		}
+	}
+}
+
+// pruneCheckpoints removes all but the newest retain checkpoints in dir.
+func pruneCheckpoints(fsys vfs.FS, dir string, retain int) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > retain {
+		if err := fsys.RemoveAll(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// linkOrCopy hard-links src to dst, falling back to a copy when linking is
+// not possible (e.g. dst is on another filesystem, or fsys has no links).
+func linkOrCopy(fsys vfs.FS, src, dst string) error {
+	if err := fsys.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(fsys, src, dst)
+}
+
+// copyFile copies src to dst and syncs dst.
+func copyFile(fsys vfs.FS, src, dst string) error {
+	return copyFileN(fsys, src, dst, -1)
+}
+
+// copyFileN copies the first n bytes of src, or all of it if n is negative,
+// to dst and syncs dst.
+func copyFileN(fsys vfs.FS, src, dst string, n int64) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fsys.Create(dst)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = in
+	if n >= 0 {
+		r = io.LimitReader(in, n)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
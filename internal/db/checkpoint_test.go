@@ -0,0 +1,169 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodicCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(2),
+		db.WithPeriodicCheckpoints(10*time.Millisecond, 2),
+	)
+	require.NoError(t, err)
+
+	// Data spans both an SSTable and the live WAL
+	require.NoError(t, d.Put([]byte("flushed"), []byte("1")))
+	require.NoError(t, d.Put([]byte("filler"), []byte("2")))
+	require.NoError(t, d.Put([]byte("in-wal"), []byte("3")))
+
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(checkpointDir)
+		return err == nil && len(entries) >= 2
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Let a few more ticks pass to exercise retention
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, d.Close())
+
+	entries, err := os.ReadDir(checkpointDir)
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(entries), 2, "only the newest checkpoints are retained")
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	// The newest checkpoint opens as a standalone database
+	restored, err := db.Open(db.WithDBPath(filepath.Join(checkpointDir, names[len(names)-1])))
+	require.NoError(t, err)
+	for key, want := range map[string]string{"flushed": "1", "filler": "2", "in-wal": "3"} {
+		value, err := restored.Get([]byte(key))
+		require.NoError(t, err, key)
+		require.Equal(t, []byte(want), value)
+	}
+}
+
+func TestPeriodicCheckpointsDuringWrites(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(8),
+		db.WithPeriodicCheckpoints(time.Millisecond, 1000),
+	)
+	require.NoError(t, err)
+
+	// Writes carry on while checkpoints copy the WALs
+	const n = 300
+	for i := range n {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("v")))
+	}
+	require.NoError(t, d.Close())
+
+	// Each checkpoint holds exactly the writes made before it, with no torn
+	// or later records from WALs that kept growing while they were copied
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	entries, err := os.ReadDir(checkpointDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		restored, err := db.Open(db.WithDBPath(filepath.Join(checkpointDir, entry.Name())))
+		require.NoError(t, err, entry.Name())
+		found := true
+		for i := range n {
+			_, err := restored.Get([]byte(fmt.Sprintf("key%04d", i)))
+			if found && errors.Is(err, db.ErrNotFound) {
+				found = false
+				continue
+			}
+			if found {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, db.ErrNotFound, "checkpoint %s has key%04d but not an earlier key", entry.Name(), i)
+			}
+		}
+		require.NoError(t, restored.Close())
+	}
+}
+
+func TestPeriodicCheckpointsRetainAtLeastOne(t *testing.T) {
+	_, err := db.Open(db.WithDBPath(t.TempDir()), db.WithPeriodicCheckpoints(time.Second, 0))
+	require.Error(t, err)
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Data spans tables and the memtable
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	checkpointDir := filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, d.Checkpoint(checkpointDir))
+	require.Error(t, d.Checkpoint(checkpointDir))
+
+	// Later writes to the source don't reach the copy
+	require.NoError(t, d.Put([]byte("key00"), []byte("new")))
+	require.NoError(t, d.Delete([]byte("key01")))
+	require.NoError(t, d.Compact())
+
+	copied, err := db.Open(db.WithDBPath(checkpointDir))
+	require.NoError(t, err)
+	defer copied.Close()
+
+	want := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		want[fmt.Sprintf("key%02d", i)] = "v"
+	}
+	requireContents(t, copied, want)
+	require.Empty(t, copied.VerifyChecksums())
+
+	// The copy is independent of the source
+	require.NoError(t, copied.Put([]byte("key02"), []byte("copy")))
+	value, err := d.Get([]byte("key02"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), value)
+}
+
+func TestCheckpointDuringClose(t *testing.T) {
+	l := &blockingFlushListener{begun: make(chan struct{}), release: make(chan struct{})}
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithEventListener(l))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("k"), []byte("v")))
+
+	// Close stops the flush the checkpoint waits for, which must fail
+	// rather than write a checkpoint missing the memtable's writes
+	dir := filepath.Join(t.TempDir(), "checkpoint")
+	checkpointErr := make(chan error, 1)
+	go func() { checkpointErr <- d.Checkpoint(dir) }()
+	<-l.begun
+	closeErr := make(chan error, 1)
+	go func() { closeErr <- d.Close() }()
+
+	select {
+	case err := <-checkpointErr:
+		require.ErrorIs(t, err, db.ErrClosed)
+	case <-time.After(10 * time.Second):
+		t.Fatal("checkpoint didn't give up when the DB closed")
+	}
+	close(l.release)
+	require.NoError(t, <-closeErr)
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
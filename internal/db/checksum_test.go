@@ -0,0 +1,69 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/table_cache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableChecksums(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+
+	// The manifest records each table's whole-file checksum
+	fm := d.Manifest().Current().Levels[0][0]
+	path := d.Paths().SSTablePath(0, fm.FileNo)
+	actual, err := common.ChecksumFile(d.FS(), path)
+	require.NoError(t, err)
+	require.NotZero(t, fm.Checksum)
+	require.Equal(t, actual, fm.Checksum)
+	require.NoError(t, d.Close())
+
+	// Swap in a different, well-formed table under the same name
+	other := t.TempDir()
+	o, err := db.Open(db.WithDBPath(other), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, o.Put([]byte(fmt.Sprintf("key%d", i)), []byte("other")))
+	}
+	o.WaitForCompactions()
+	require.NoError(t, o.Close())
+	data, err := os.ReadFile(filepath.Join(other, "sstable", "0", "0.sst"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	tests := []struct {
+		name    string
+		options []db.Option
+		wantErr bool
+	}{
+		{"unverified", nil, false},
+		{"verified", []db.Option{db.WithTableChecksumVerification()}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(append([]db.Option{db.WithDBPath(dir)}, tt.options...)...)
+			require.NoError(t, err)
+			defer d.Close()
+
+			_, err = d.Get([]byte("key0"))
+			if tt.wantErr {
+				require.ErrorIs(t, err, table_cache.ErrChecksumMismatch)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,618 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/manifest"
+	"amethyst/internal/scheduler"
+	"amethyst/internal/sstable"
+)
+
+// compaction merges input files from one level with the overlapping files of
+// the next level, writing the result as new files in the next level.
+type compaction struct {
+	level   int
+	inputs  []manifest.FileMetadata // files from level, newest first
+	overlap []manifest.FileMetadata // files from level+1 overlapping inputs
+}
+
+// levelCapacity returns the number of files level (>= 1) may hold before it
+// needs to be compacted into the next level.
+func (d *DB) levelCapacity(level int) int {
+	capacity := d.Opts.L0CompactionTrigger
+	for i := 1; i < level; i++ {
+		capacity *= d.Opts.LevelSizeMultiplier
+	}
+	return capacity
+}
+
+// pickCompaction returns the next compaction to run for v, or nil if every
+// level is within its limits. Levels with the fewest compactions already
+// running go first so one busy level cannot starve the rest; among equals,
+// L0 takes priority because its overlapping files slow down every read.
+// Levels at MaxCompactionsPerLevel and compactions whose files are already
+// being compacted are skipped.
+// Must be called with d.mu held.
+func (d *DB) pickCompaction(v *manifest.Version) *compaction {
+	var levels []int
+	if len(v.Levels[0]) > 0 && len(v.Levels[0]) >= d.l0CompactionTrigger() {
+		levels = append(levels, 0)
+	}
+	// The last level has no level below it to compact into
+	for level := 1; level < len(v.Levels)-1; level++ {
+		if len(v.Levels[level]) > d.levelCapacity(level) {
+			levels = append(levels, level)
+		}
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		return d.levelCompactions[levels[i]] < d.levelCompactions[levels[j]]
+	})
+
+	for _, level := range levels {
+		if d.levelCompactions[level] >= d.Opts.MaxCompactionsPerLevel {
+			continue
+		}
+		inputs := newestFirst(0, v.Levels[0])
+		if level > 0 {
+			inputs = []manifest.FileMetadata{d.pickFile(level, v.Levels[level])}
+		}
+		if c := newCompaction(v, level, inputs); c != nil && !d.isCompacting(c) {
+			return c
+		}
+	}
+	return d.pickTombstoneCompaction(v)
+}
+
+// pickTombstoneCompaction returns a compaction of the file with the largest
+// share of tombstones above TombstoneCompactionRatio, or nil if there is
+// none. An L0 file takes all of L0 with it, since newer L0 files may shadow
+// it. The last level is never picked: compactions into it drop tombstones.
+// Must be called with d.mu held.
+func (d *DB) pickTombstoneCompaction(v *manifest.Version) *compaction {
+	if d.Opts.TombstoneCompactionRatio <= 0 {
+		return nil
+	}
+
+	var best *compaction
+	bestRatio := d.Opts.TombstoneCompactionRatio
+	for level := 0; level < len(v.Levels)-1; level++ {
+		if d.levelCompactions[level] >= d.Opts.MaxCompactionsPerLevel {
+			continue
+		}
+		for _, fm := range v.Levels[level] {
+			ratio := fm.TombstoneRatio()
+			if ratio <= bestRatio {
+				continue
+			}
+			inputs := []manifest.FileMetadata{fm}
+			if level == 0 {
+				inputs = newestFirst(0, v.Levels[0])
+			}
+			if c := newCompaction(v, level, inputs); c != nil && !d.isCompacting(c) {
+				best, bestRatio = c, ratio
+			}
+		}
+	}
+	return best
+}
+
+// isCompacting reports whether any file of c is part of a running compaction.
+// Must be called with d.mu held.
+func (d *DB) isCompacting(c *compaction) bool {
+	for _, files := range [][]manifest.FileMetadata{c.inputs, c.overlap} {
+		for _, fm := range files {
+			if _, ok := d.compacting[fm.FileNo]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setCompacting marks or clears every file of c as being compacted.
+// Must be called with d.mu held.
+func (d *DB) setCompacting(c *compaction, compacting bool) {
+	if compacting {
+		d.levelCompactions[c.level]++
+	} else {
+		d.levelCompactions[c.level]--
+	}
+	for _, files := range [][]manifest.FileMetadata{c.inputs, c.overlap} {
+		for _, fm := range files {
+			if compacting {
+				d.compacting[fm.FileNo] = struct{}{}
+			} else {
+				delete(d.compacting, fm.FileNo)
+			}
+		}
+	}
+}
+
+// pickFile chooses the next file to compact out of an L1+ level, rotating
+// through the key space so every file eventually moves down.
+func (d *DB) pickFile(level int, files []manifest.FileMetadata) manifest.FileMetadata {
+	pointer := d.compactPointers[level]
+
+	var next, first *manifest.FileMetadata
+	for i := range files {
+		fm := &files[i]
+		if first == nil || bytes.Compare(fm.SmallestKey, first.SmallestKey) < 0 {
+			first = fm
+		}
+		if pointer != nil && bytes.Compare(fm.SmallestKey, pointer) <= 0 {
+			continue
+		}
+		if next == nil || bytes.Compare(fm.SmallestKey, next.SmallestKey) < 0 {
+			next = fm
+		}
+	}
+
+	// Wrap around once the pointer passes the end of the level
+	if next == nil {
+		next = first
+	}
+	d.compactPointers[level] = next.LargestKey
+	return *next
+}
+
+// newCompaction builds a compaction of inputs from level, pulling in every
+// file of the next level whose key range overlaps the inputs. It returns nil
+// if there are no inputs.
+func newCompaction(v *manifest.Version, level int, inputs []manifest.FileMetadata) *compaction {
+	if len(inputs) == 0 {
+		return nil
+	}
+	smallest, largest := inputs[0].SmallestKey, inputs[0].LargestKey
+	for _, fm := range inputs[1:] {
+		if bytes.Compare(fm.SmallestKey, smallest) < 0 {
+			smallest = fm.SmallestKey
+		}
+		if bytes.Compare(fm.LargestKey, largest) > 0 {
+			largest = fm.LargestKey
+		}
+	}
+
+	var overlap []manifest.FileMetadata
+	for _, fm := range v.Levels[level+1] {
+		if bytes.Compare(fm.LargestKey, smallest) >= 0 && bytes.Compare(fm.SmallestKey, largest) <= 0 {
+			overlap = append(overlap, fm)
+		}
+	}
+
+	return &compaction{level: level, inputs: inputs, overlap: overlap}
+}
+
+// scheduleCompaction queues a background job that compacts until every level
+// is within its limits. Each job that finds work queues another while
+// compaction slots remain, so independent compactions run in parallel.
+func (d *DB) scheduleCompaction() {
+	err := d.scheduler.Schedule(scheduler.JobCompaction, d.backgroundCompaction)
+	if err != nil && err != scheduler.ErrClosed {
+		d.logger("compaction").Log(common.LevelError, "failed to schedule compaction", "err", err)
+	}
+}
+
+func (d *DB) backgroundCompaction(ctx context.Context) error {
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		c := d.pickCompaction(d.manifest.Current())
+		if c != nil {
+			d.setCompacting(c, true)
+			if d.runningCompactions() < d.maxCompactions() {
+				d.scheduleCompaction()
+			}
+		}
+		d.mu.Unlock()
+
+		if c == nil {
+			return nil
+		}
+		if err := d.runCompaction(ctx, c); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// waitForL0 blocks while L0 is at L0StopWritesTrigger files, so flushes
+// don't pile up overlapping files faster than compaction can merge them.
+// Returns early once the database is closing.
+// Must be called with d.mu held.
+func (d *DB) waitForL0() {
+	if d.Opts.L0StopWritesTrigger <= 0 {
+		return
+	}
+	// L0 must be eligible for compaction, or nothing would wake us
+	limit := max(d.Opts.L0StopWritesTrigger, d.l0CompactionTrigger())
+
+	for {
+		files := len(d.manifest.Current().Levels[0])
+		if files < limit {
+			return
+		}
+		select {
+		case <-d.closeCh:
+			return
+		default:
+		}
+		d.logger("compaction").Log(common.LevelWarn, "stalling writes", "l0_files", files)
+		d.scheduleCompaction()
+		d.compacted.Wait()
+	}
+}
+
+// runningCompactions returns the number of compactions in progress.
+// Must be called with d.mu held.
+func (d *DB) runningCompactions() int {
+	n := 0
+	for _, running := range d.levelCompactions {
+		n += running
+	}
+	return n
+}
+
+// WaitForCompactions blocks until no background flush or compaction is
+// queued or running.
+func (d *DB) WaitForCompactions() {
+	if d.scheduler != nil {
+		d.scheduler.Wait()
+	}
+}
+
+// Compact flushes the memtable and merges every level down into the last
+// level, dropping shadowed versions, tombstones, and filtered entries.
+func (d *DB) Compact() error {
+	return d.CompactContext(context.Background())
+}
+
+// CompactContext is like Compact but stops once ctx is done, returning its
+// error. A compaction stopped part way leaves its level as it was; those
+// finished before it stay done.
+func (d *DB) CompactContext(ctx context.Context) error {
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	d.mu.Lock()
+	if err := d.flushMemtable(); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	d.mu.Unlock()
+
+	for level := 0; level < len(d.manifest.Current().Levels)-1; level++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d.WaitForCompactions()
+
+		d.mu.Lock()
+		v := d.manifest.Current()
+		if len(v.Levels[level]) == 0 {
+			d.mu.Unlock()
+			continue
+		}
+		c := newCompaction(v, level, newestFirst(level, v.Levels[level]))
+		if d.isCompacting(c) {
+			// A background compaction started in the meantime; retry the level
+			d.mu.Unlock()
+			level--
+			continue
+		}
+		d.setCompacting(c, true)
+		d.mu.Unlock()
+
+		if err := d.runCompaction(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCompaction executes c: merge, write outputs, commit the manifest edit,
+// then delete the obsolete input files. The merge runs without d.mu so reads
+// and writes continue meanwhile; only the commit takes the lock. The caller
+// must have marked c's files with setCompacting, which this clears.
+func (d *DB) runCompaction(ctx context.Context, c *compaction) (err error) {
+	start := time.Now()
+
+	var outputs []manifest.FileMetadata
+	var blobs *blobSeparator
+	committed := false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if !committed {
+			for _, fm := range outputs {
+				d.fs.Remove(d.paths.SSTablePath(c.level+1, fm.FileNo))
+			}
+			if blobs != nil {
+				blobs.abort()
+			}
+		}
+		d.mu.Lock()
+		d.setCompacting(c, false)
+		d.compacted.Broadcast()
+		d.mu.Unlock()
+	}()
+
+	v := d.manifest.Current()
+	outputLevel := c.level + 1
+
+	// Tombstones and filtered entries can only be dropped outright when no
+	// deeper level could hold an older version they need to shadow
+	bottommost := true
+	for level := outputLevel + 1; level < len(v.Levels); level++ {
+		if len(v.Levels[level]) > 0 {
+			bottommost = false
+		}
+	}
+
+	// Children are ordered newest first so the merge keeps the latest version
+	var children []common.EntryIterator
+	var rangeDels common.RangeTombstones
+	inputEntries := 0
+	for _, group := range []struct {
+		level int
+		files []manifest.FileMetadata
+	}{{c.level, c.inputs}, {outputLevel, c.overlap}} {
+		for _, fm := range group.files {
+			table, err := d.manifest.GetTable(fm.FileNo, group.level)
+			if err != nil {
+				iterator.NewMergingIterator(children...).Close()
+				return fmt.Errorf("failed to open L%d/%d.sst: %w", group.level, fm.FileNo, err)
+			}
+			children = append(children, table.IteratorWithOptions(sstable.ReadOptions{
+				VerifyChecksums: true,
+				ReadaheadSize:   d.Opts.CompactionReadaheadSize,
+			}))
+			rangeDels = append(rangeDels, table.RangeTombstones()...)
+			inputEntries += int(fm.Entries)
+		}
+	}
+	merged := iterator.NewMergingIterator(children...)
+	defer merged.Close()
+
+	// Range tombstones must keep shadowing older versions below until they
+	// reach the bottom. Splitting the output around them would leave files
+	// with overlapping key ranges, so while any are kept the output is a
+	// single file.
+	var kept common.RangeTombstones
+	limit := d.Opts.MemtableFlushThreshold
+	if !bottommost && len(rangeDels) > 0 {
+		kept = rangeDels
+		limit = max(limit, inputEntries)
+	}
+
+	source := &compactionIterator{
+		ctx:        ctx,
+		source:     merged,
+		filter:     d.Opts.CompactionFilter,
+		rangeDels:  rangeDels,
+		now:        time.Now().UnixNano(),
+		bottommost: bottommost,
+		resolve: func(entry *common.Entry) (*common.Entry, error) {
+			return d.resolveBlob(entry, ReadAllTier)
+		},
+	}
+	blobs = d.newBlobSeparator(source, d.blobGCSet(v))
+
+	// Split output into files of roughly one memtable each
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		more, err := source.hasNext()
+		if err != nil {
+			return err
+		}
+		if !more && (len(kept) == 0 || len(outputs) > 0) {
+			break
+		}
+
+		limited := &limitIterator{source: blobs, limit: limit}
+		fm, _, err := d.buildTable(outputLevel, d.manifest.NewSSTableNumber(), limited, kept, limit)
+		if err != nil {
+			return err
+		}
+		fm.BlobFiles = blobs.takeRefs()
+		outputs = append(outputs, *fm)
+	}
+	blobFiles, err := blobs.finish()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Commit: the manifest edit is the atomic switch to the new files
+	edit := &manifest.CompactionEdit{
+		AddSSTables: map[int][]manifest.FileMetadata{
+			outputLevel: outputs,
+		},
+		DeleteSSTables: map[int]map[common.FileNo]struct{}{
+			c.level:     fileSet(c.inputs),
+			outputLevel: fileSet(c.overlap),
+		},
+		AddBlobFiles: blobFiles,
+	}
+	d.manifest.Apply(edit)
+	committed = true
+	if err := d.manifest.Flush(); err != nil {
+		return err
+	}
+	d.setCompacting(c, false)
+	d.compactions.Add(1)
+	d.compacted.Broadcast()
+
+	if d.tuner != nil {
+		for _, fm := range outputs {
+			d.tuner.writtenBytes += int64(fm.Size)
+		}
+	}
+
+	// Clean up: inputs are no longer referenced by the persisted manifest
+	for _, group := range []struct {
+		level int
+		files []manifest.FileMetadata
+	}{{c.level, c.inputs}, {outputLevel, c.overlap}} {
+		for _, fm := range group.files {
+			if err := d.manifest.DeleteTable(fm.FileNo, group.level); err != nil {
+				d.logger("compaction").Log(common.LevelError, "failed to delete table", "level", group.level, "file", fm.FileNo, "err", err)
+			}
+		}
+	}
+
+	// Blob files whose last references were just rewritten or dropped
+	if err := d.deleteObsoleteBlobFiles(); err != nil {
+		d.logger("compaction").Log(common.LevelError, "failed to delete blob files", "err", err)
+	}
+
+	d.recordShape("compaction")
+
+	d.notifyTablesCreated(edit)
+	if len(d.Opts.EventListeners) > 0 {
+		info := CompactionInfo{
+			Level:       c.level,
+			OutputLevel: outputLevel,
+			Inputs:      append(d.tableFileInfos(c.level, c.inputs), d.tableFileInfos(outputLevel, c.overlap)...),
+			Outputs:     d.tableFileInfos(outputLevel, outputs),
+			Duration:    time.Since(start),
+		}
+		for _, l := range d.Opts.EventListeners {
+			l.OnCompactionCompleted(info)
+		}
+	}
+
+	d.logger("compaction").Log(common.LevelInfo, "compacted tables", "level", c.level, "inputs", len(c.inputs),
+		"overlapping", len(c.overlap), "output_level", outputLevel, "outputs", len(outputs), "duration", time.Since(start))
+	return nil
+}
+
+// ctxCheckInterval is how many entries a compaction merges between checks
+// for cancellation.
+const ctxCheckInterval = 1024
+
+func fileSet(files []manifest.FileMetadata) map[common.FileNo]struct{} {
+	set := make(map[common.FileNo]struct{}, len(files))
+	for _, fm := range files {
+		set[fm.FileNo] = struct{}{}
+	}
+	return set
+}
+
+// compactionIterator applies tombstone elision, expiry, and the compaction
+// filter to the merged input stream, and drops the entries the inputs' range
+// tombstones delete. It buffers one entry so callers can check whether
+// another output file is needed. resolve reads the values of blob references
+// for the filter.
+type compactionIterator struct {
+	ctx        context.Context // checked every ctxCheckInterval entries
+	read       int
+	source     common.EntryIterator
+	filter     CompactionFilter
+	rangeDels  common.RangeTombstones
+	now        int64 // expires entries, in Unix nanoseconds
+	bottommost bool
+	resolve    func(*common.Entry) (*common.Entry, error)
+	peeked     *common.Entry
+}
+
+func (it *compactionIterator) hasNext() (bool, error) {
+	if it.peeked != nil {
+		return true, nil
+	}
+	entry, err := it.next()
+	if err != nil {
+		return false, err
+	}
+	it.peeked = entry
+	return entry != nil, nil
+}
+
+func (it *compactionIterator) Next() (*common.Entry, error) {
+	if it.peeked != nil {
+		entry := it.peeked
+		it.peeked = nil
+		return entry, nil
+	}
+	return it.next()
+}
+
+func (it *compactionIterator) next() (*common.Entry, error) {
+	for {
+		if it.read++; it.read%ctxCheckInterval == 0 {
+			if err := it.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		entry, err := it.source.Next()
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		if it.rangeDels.Covering(entry.Key, entry.Seq) != nil {
+			continue
+		}
+		// An expired put becomes a tombstone, just as a filtered one does below
+		entry = expireEntry(entry, it.now)
+
+		if entry.Type != common.EntryTypeDelete && it.filter != nil {
+			drop, err := it.drop(entry)
+			if err != nil {
+				return nil, err
+			}
+			if drop {
+				// Above the bottom, a dropped put must still shadow older
+				// versions in deeper levels, so it becomes a tombstone
+				entry = &common.Entry{
+					Type:      common.EntryTypeDelete,
+					Seq:       entry.Seq,
+					Timestamp: entry.Timestamp,
+					Key:       entry.Key,
+				}
+			}
+		}
+
+		if entry.Type == common.EntryTypeDelete && it.bottommost {
+			continue
+		}
+		return entry, nil
+	}
+}
+
+// drop asks the filter about a put, showing it the value rather than a blob
+// reference.
+func (it *compactionIterator) drop(entry *common.Entry) (bool, error) {
+	if entry.Type == common.EntryTypeBlobRef {
+		resolved, err := it.resolve(entry)
+		if err != nil {
+			return false, err
+		}
+		entry = resolved
+	}
+	return it.filter.Drop(entry), nil
+}
+
+// limitIterator yields at most limit entries from source.
+type limitIterator struct {
+	source common.EntryIterator
+	limit  int
+	count  int
+}
+
+func (it *limitIterator) Next() (*common.Entry, error) {
+	if it.count >= it.limit {
+		return nil, nil
+	}
+	it.count++
+	return it.source.Next()
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"time"
+
+	"amethyst/internal/common"
+)
+
+// CompactionFilter lets applications remove entries while compaction rewrites
+// them. Only live puts are offered to the filter; tombstones are handled by
+// compaction itself.
+type CompactionFilter interface {
+	// Drop reports whether entry should be removed from the compaction output.
+	Drop(entry *common.Entry) bool
+}
+
+// ttlFilter expires entries whose commit timestamp is older than maxAge.
+type ttlFilter struct {
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+var _ CompactionFilter = (*ttlFilter)(nil)
+
+// NewTTLFilter returns a CompactionFilter that drops entries committed more
+// than maxAge ago, so log- or metrics-style data expires without explicit
+// deletes. Expired entries remain readable until compaction reaches them.
+func NewTTLFilter(maxAge time.Duration) CompactionFilter {
+	return &ttlFilter{maxAge: maxAge, now: time.Now}
+}
+
+func (f *ttlFilter) Drop(entry *common.Entry) bool {
+	cutoff := f.now().Add(-f.maxAge).UnixNano()
+	return entry.Timestamp < cutoff
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLFilter(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	f := &ttlFilter{maxAge: time.Hour, now: func() time.Time { return now }}
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		drop bool
+	}{
+		{"Fresh", 0, false},
+		{"JustUnderTTL", time.Hour - time.Second, false},
+		{"ExactlyTTL", time.Hour, false},
+		{"Expired", time.Hour + time.Second, true},
+		{"LongExpired", 48 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &common.Entry{
+				Type:      common.EntryTypePut,
+				Key:       []byte("k"),
+				Timestamp: now.Add(-tt.age).UnixNano(),
+			}
+			require.Equal(t, tt.drop, f.Drop(entry))
+		})
+	}
+}
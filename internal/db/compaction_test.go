@@ -0,0 +1,295 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// levelEntries returns every entry stored in the SSTables of a level.
+func levelEntries(t *testing.T, d *db.DB, level int) []*common.Entry {
+	t.Helper()
+	var entries []*common.Entry
+	for _, fm := range d.Manifest().Current().Levels[level] {
+		table, err := d.Manifest().GetTable(fm.FileNo, level)
+		require.NoError(t, err)
+		iter := table.Iterator()
+		for {
+			entry, err := iter.Next()
+			require.NoError(t, err)
+			if entry == nil {
+				break
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestAutomaticL0Compaction(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(4),
+		db.WithL0CompactionTrigger(2),
+	)
+	require.NoError(t, err)
+
+	// Rewrite the same keys repeatedly so compaction must pick the newest
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 4; i++ {
+			key := []byte(fmt.Sprintf("key%d", i))
+			require.NoError(t, d.Put(key, []byte(fmt.Sprintf("r%d", round))))
+		}
+	}
+
+	d.WaitForCompactions()
+	v := d.Manifest().Current()
+	require.Less(t, len(v.Levels[0]), 2, "L0 should have been compacted")
+	require.NotEmpty(t, v.Levels[1], "compaction output should land in L1")
+
+	// L1 files must not overlap
+	for i, a := range v.Levels[1] {
+		for _, b := range v.Levels[1][i+1:] {
+			disjoint := bytes.Compare(a.LargestKey, b.SmallestKey) < 0 || bytes.Compare(b.LargestKey, a.SmallestKey) < 0
+			require.True(t, disjoint, "L1 files %d and %d overlap", a.FileNo, b.FileNo)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte("r4"), value)
+	}
+}
+
+func TestCompactDropsTombstonesAtBottom(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Delete([]byte(fmt.Sprintf("key%02d", i))))
+	}
+
+	require.NoError(t, d.Compact())
+
+	v := d.Manifest().Current()
+	bottom := len(v.Levels) - 1
+	for level := 0; level < bottom; level++ {
+		require.Empty(t, v.Levels[level], "L%d should be empty after full compaction", level)
+	}
+
+	entries := levelEntries(t, d, bottom)
+	require.Len(t, entries, 5, "shadowed versions and tombstones should be gone")
+	for _, e := range entries {
+		require.Equal(t, common.EntryTypePut, e.Type)
+	}
+
+	_, err = d.Get([]byte("key00"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	value, err := d.Get([]byte("key09"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), value)
+}
+
+// prefixFilter drops every entry whose key starts with prefix.
+type prefixFilter struct {
+	prefix []byte
+}
+
+func (f prefixFilter) Drop(entry *common.Entry) bool {
+	return bytes.HasPrefix(entry.Key, f.prefix)
+}
+
+func TestCompactionFilter(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(4),
+		db.WithCompactionFilter(prefixFilter{prefix: []byte("tmp:")}),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Put([]byte("keep:1"), []byte("v")))
+	require.NoError(t, d.Put([]byte("tmp:1"), []byte("v")))
+	require.NoError(t, d.Compact())
+
+	// A second generation above the bottom turns filtered puts into tombstones
+	// so the older copy in the last level stays hidden
+	require.NoError(t, d.Put([]byte("keep:2"), []byte("v")))
+	require.NoError(t, d.Put([]byte("tmp:2"), []byte("v")))
+
+	_, err = d.Get([]byte("tmp:1"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	value, err := d.Get([]byte("keep:1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), value)
+
+	require.NoError(t, d.Compact())
+	_, err = d.Get([]byte("tmp:2"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	value, err = d.Get([]byte("keep:2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), value)
+}
+
+// gateFilter holds every compaction until released.
+type gateFilter struct {
+	release chan struct{}
+}
+
+func (f *gateFilter) Drop(*common.Entry) bool {
+	<-f.release
+	return false
+}
+
+func TestL0StallsWrites(t *testing.T) {
+	filter := &gateFilter{release: make(chan struct{})}
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(1),
+		db.WithL0CompactionTrigger(2),
+		db.WithL0StopWritesTrigger(3),
+		db.WithCompactionFilter(filter),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Each put flushes the previous one; compaction is stuck once L0 hits 2
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("v")))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.Put([]byte("key4"), []byte("v")) }()
+	select {
+	case <-done:
+		t.Fatal("write should stall while L0 is at the stop trigger")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Len(t, d.Manifest().Current().Levels[0], 3)
+
+	close(filter.release)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("write still stalled after compaction")
+	}
+	d.WaitForCompactions()
+	require.Less(t, len(d.Manifest().Current().Levels[0]), 3)
+}
+
+func TestCompactionRateLimit(t *testing.T) {
+	const rate = 50 << 10
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(1000),
+		db.WithCompactionRateLimit(rate),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 8; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), bytes.Repeat([]byte("v"), 1<<10)))
+	}
+
+	// Beyond the first tenth of a second's burst, writing the table and
+	// compacting it again proceed at no more than the limit
+	start := time.Now()
+	require.NoError(t, d.Compact())
+	var written uint64
+	for _, files := range d.Manifest().Current().Levels {
+		for _, fm := range files {
+			written += fm.Size
+		}
+	}
+	minimum := time.Duration(float64(2*written-rate/10) / rate * float64(time.Second))
+	require.GreaterOrEqual(t, time.Since(start), minimum)
+}
+
+func TestDirectIOWrites(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(4),
+		db.WithL0CompactionTrigger(2),
+		db.WithDirectIOWrites(),
+		db.WithTableChecksumVerification(),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 4; i++ {
+			key := []byte(fmt.Sprintf("key%d", i))
+			require.NoError(t, d.Put(key, bytes.Repeat([]byte{byte('a' + round)}, 5000)))
+		}
+	}
+	require.NoError(t, d.Compact())
+
+	// Flushed and compacted tables read back whole despite the aligned writes
+	require.Empty(t, d.VerifyChecksums())
+	for i := 0; i < 4; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte("e"), 5000), value)
+	}
+}
+
+// cancelFilter cancels a context once it has seen n entries.
+type cancelFilter struct {
+	n      atomic.Int64
+	cancel context.CancelFunc
+}
+
+func (f *cancelFilter) Drop(*common.Entry) bool {
+	if f.n.Add(-1) == 0 {
+		f.cancel()
+	}
+	return false
+}
+
+func TestCompactContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filter := &cancelFilter{cancel: cancel}
+	filter.n.Store(1500)
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(1000),
+		db.WithL0CompactionTrigger(100),
+		db.WithCompactionFilter(filter),
+		db.WithMaxBatchSize(1),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+	for i := range 3000 {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("v")))
+	}
+
+	// Cancelled part way through its merge, the compaction leaves L0 as it was
+	require.ErrorIs(t, d.CompactContext(ctx), context.Canceled)
+	require.Len(t, d.Manifest().Current().Levels[0], 3)
+	require.Zero(t, d.Stats().Compactions)
+	value, err := d.Get([]byte("key2999"))
+	require.NoError(t, err)
+	require.Equal(t, "v", string(value))
+
+	require.NoError(t, d.CompactContext(context.Background()))
+	require.Empty(t, d.Manifest().Current().Levels[0])
+}
+
+func TestL0CompactionTriggerBelowOne(t *testing.T) {
+	for _, trigger := range []int{0, -1} {
+		_, err := db.Open(db.WithDBPath(t.TempDir()), db.WithL0CompactionTrigger(trigger))
+		require.ErrorContains(t, err, "L0CompactionTrigger")
+	}
+}
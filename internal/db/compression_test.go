@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/compression"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionChangeKeepsTablesReadable(t *testing.T) {
+	dir := t.TempDir()
+	codecs := []compression.Codec{compression.Snappy, compression.Zlib, nil}
+
+	// Each reopen writes a new table with a different codec
+	for i, codec := range codecs {
+		d, err := db.Open(
+			db.WithDBPath(dir),
+			db.WithMemtableFlushThreshold(10),
+			db.WithCompression(codec),
+		)
+		require.NoError(t, err)
+		for j := 0; j < 10; j++ {
+			key := fmt.Sprintf("key%d-%02d", i, j)
+			require.NoError(t, d.Put([]byte(key), []byte("value of "+key)))
+		}
+		require.NoError(t, d.Close())
+	}
+
+	d, err := db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	require.Empty(t, d.VerifyChecksums())
+	for i := range codecs {
+		for j := 0; j < 10; j++ {
+			key := fmt.Sprintf("key%d-%02d", i, j)
+			value, err := d.Get([]byte(key))
+			require.NoError(t, err)
+			require.Equal(t, "value of "+key, string(value))
+		}
+	}
+}
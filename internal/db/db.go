@@ -2,30 +2,183 @@ package db
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"amethyst/internal/blob"
+	"amethyst/internal/block_cache"
 	"amethyst/internal/common"
+	"amethyst/internal/iterator"
 	"amethyst/internal/manifest"
 	"amethyst/internal/memtable"
+	"amethyst/internal/ratelimit"
+	"amethyst/internal/scheduler"
 	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/vfs"
 	"amethyst/internal/wal"
 )
 
-var ErrNotFound = errors.New("key not found")
+var (
+	ErrNotFound = errors.New("key not found")
+	ErrReadOnly = errors.New("db: database is open read-only")
+	// ErrClosed is returned by writes to a closed database.
+	ErrClosed = errors.New("db: database is closed")
+	// ErrWouldBlock is returned by a BlockCacheTier read that needs disk I/O.
+	ErrWouldBlock = errors.New("db: read would block on I/O")
+)
+
+// ReadTier limits where a read may look for data.
+type ReadTier int
+
+const (
+	// ReadAllTier reads from disk when the caches can't answer.
+	ReadAllTier ReadTier = iota
+	// BlockCacheTier answers only from the memtable, open tables' filters
+	// and indexes, and the block cache. Anything else fails with
+	// ErrWouldBlock, so callers can retry at ReadAllTier off the hot path.
+	BlockCacheTier
+)
+
+// ReadOptions control how a read treats the blocks it loads from disk.
+type ReadOptions struct {
+	// FillCache adds the blocks the read loads to the block cache. Large
+	// scans should leave it unset so they don't evict the hot working set.
+	FillCache bool
+	// VerifyChecksums checks every block loaded against its checksum.
+	VerifyChecksums bool
+	// ReadaheadSize, when positive, has iterators read SSTables this many
+	// bytes at a time, which speeds up long scans; see
+	// sstable.ReadOptions.ReadaheadSize.
+	ReadaheadSize int
+	// PinBlocks has iterators pin the cached block they are positioned on in
+	// each table until they move past it or are closed, so a slow scan
+	// doesn't read the same block twice; see sstable.ReadOptions.PinBlocks.
+	PinBlocks bool
+	// LowerBound and UpperBound, when set, limit iterators to the keys in
+	// [LowerBound, UpperBound). Tables outside the bounds aren't read, and
+	// the rest are sought to LowerBound and read no further than
+	// UpperBound. Point lookups ignore them.
+	LowerBound []byte
+	UpperBound []byte
+}
+
+// DefaultReadOptions caches and verifies every block read, and pins the
+// blocks under open iterators.
+var DefaultReadOptions = ReadOptions{FillCache: true, VerifyChecksums: true, PinBlocks: true}
+
+func (o ReadOptions) table() sstable.ReadOptions {
+	return sstable.ReadOptions{FillCache: o.FillCache, VerifyChecksums: o.VerifyChecksums, ReadaheadSize: o.ReadaheadSize, PinBlocks: o.PinBlocks, UpperBound: o.UpperBound}
+}
 
 type DB struct {
-	mu        sync.RWMutex
-	nextSeq   uint32
-	memtable  memtable.Memtable
-	wal       wal.WAL
-	manifest  *manifest.Manifest
-	Opts      Options
-	paths     *common.PathManager
-	writeChan chan *writeRequest
+	mu       sync.RWMutex
+	nextSeq  uint64
+	memtable memtable.Memtable
+	wal      wal.WAL
+	walNum   common.FileNo // WAL the memtable's writes go to
+	// recycledWALs holds obsolete WALs set aside for reuse, oldest first
+	recycledWALs []common.FileNo
+	manifest     *manifest.Manifest
+	blobs        blob.Reader
+	fs           vfs.FS
+	Opts         Options
+	log          common.Logger // Opts.Logger, or the default
+	paths        *common.PathManager
+	writeChan    chan *writeRequest
+	commitDone   chan struct{} // closed once the group commit loop has exited
+	closeCh      chan struct{}
+	bgWG         sync.WaitGroup // background loops that stop on closeCh
+	closeOnce    sync.Once
+	closeErr     error
+
+	watchMu     sync.Mutex
+	watchers    map[*watcher]struct{}
+	subscribers map[*subscriber]struct{}
+
+	// backlog holds the latest commits for replicas; nil unless
+	// ReplicationBacklog is set
+	backlog *commitBacklog
+
+	// secondary tracks what a secondary has read of its primary's files;
+	// nil unless opened with OpenSecondary
+	secondary *secondaryState
+
+	// locks holds the advisory range locks taken with LockRange and the key
+	// locks of transactions
+	locks *rangeLockManager
+
+	// scheduler runs flushes and compactions in the background, on the
+	// Env's pool or else on pool, the instance's own; nil when read-only.
+	// compacting holds the files of running compactions and
+	// levelCompactions how many of them read from each level.
+	scheduler        scheduler.Scheduler
+	pool             scheduler.Scheduler
+	compacting       map[common.FileNo]struct{}
+	levelCompactions map[int]int
+
+	// compacted is signalled, with d.mu held, after every compaction commit
+	// and on Close, waking writers stalled on L0.
+	compacted *sync.Cond
+
+	// immutable holds full memtables waiting to be flushed, oldest first.
+	// flushing is set while a flush job drains the queue, and flushErr holds
+	// the error the last one stopped with. flushed is signalled, with d.mu
+	// held, after each memtable is flushed, when a flush job stops, and on
+	// Close.
+	immutable []*immutableMemtable
+	flushing  bool
+	flushErr  error
+	flushed   *sync.Cond
+
+	// mems holds the memtable and the immutable ones, as memtables returns
+	// them, for point reads that don't take d.mu. It is republished, with
+	// d.mu held, whenever either changes.
+	mems atomic.Pointer[[]memtable.Memtable]
+
+	// openIterators and pinnedTables count live iterators and the table
+	// handles they hold, and the rest count activity since Open, for Stats.
+	openIterators atomic.Int64
+	pinnedTables  atomic.Int64
+	flushes       atomic.Uint64
+	compactions   atomic.Uint64
+	gets          atomic.Uint64
+	keysWritten   atomic.Uint64
+	bytesWritten  atomic.Uint64
+
+	// queuedWrites counts writes submitted and not yet acknowledged by the
+	// group commit loop, peakQueuedWrites the most there have been, and
+	// stalledWrites the writes failed with ErrWriteStalled.
+	queuedWrites     atomic.Int64
+	peakQueuedWrites atomic.Int64
+	stalledWrites    atomic.Uint64
+
+	// blockCache and tableCache are the Env's caches, possibly shared
+	blockCache block_cache.BlockCache
+	tableCache table_cache.TableCache
+
+	// rateLimiter paces the table and blob file writes of flushes and
+	// compactions, the Env's or the instance's own; nil when unlimited.
+	rateLimiter ratelimit.Limiter
+
+	// writeBuffer caps memtable memory across instances sharing an Env;
+	// nil when unlimited or read-only.
+	writeBuffer *WriteBufferManager
+
+	// compactPointers records, per level, the largest key of the last file
+	// compacted out of it so successive compactions rotate through the level.
+	compactPointers map[int][]byte
+
+	// tuner adjusts the L0 compaction trigger and compaction parallelism; nil
+	// unless auto-tuning is enabled
+	tuner *compactionTuner
 }
 
 func Open(optFns ...Option) (*DB, error) {
@@ -33,28 +186,99 @@ func Open(optFns ...Option) (*DB, error) {
 	for _, fn := range optFns {
 		fn(&opts)
 	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 
 	paths := common.NewPathManager(opts.DBPath)
 
+	env := opts.env()
+	if opts.ReadOnly {
+		return openReadOnly(opts, paths, env)
+	}
+
 	// Create directories
-	if err := os.MkdirAll(paths.WALDir(), 0755); err != nil {
+	fsys := env.FS
+	if err := fsys.MkdirAll(paths.WALDir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := fsys.MkdirAll(paths.BlobDir(), 0755); err != nil {
 		return nil, err
 	}
 	for i := 0; i <= opts.MaxSSTableLevel; i++ {
 		sstableDir := fmt.Sprintf("%s/%d", paths.SSTableDir(), i)
-		if err := os.MkdirAll(sstableDir, 0755); err != nil {
+		if err := fsys.MkdirAll(sstableDir, 0755); err != nil {
 			return nil, err
 		}
+
+		// Tables interrupted mid-write were never referenced by the manifest
+		entries, err := fsys.ReadDir(sstableDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".sst.tmp") {
+				continue
+			}
+			if err := fsys.Remove(filepath.Join(sstableDir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// Try to load existing manifest
-	var m *manifest.Manifest
-	var log wal.WAL
-	var mt memtable.Memtable
-	var nextSeq uint32
+	m := manifest.NewManifestWithTableCache(fsys, paths, opts.MaxSSTableLevel+1, env.TableCache)
+	m.SetVerifyChecksums(opts.VerifyTableChecksums)
+	m.SetLogger(common.WithPrefix(opts.logger(), "manifest"))
+
+	db := &DB{
+		manifest:    m,
+		blobs:       blob.NewReader(fsys, paths),
+		fs:          fsys,
+		Opts:        opts,
+		log:         opts.logger(),
+		paths:       paths,
+		writeChan:   make(chan *writeRequest, max(opts.MaxWriteQueueDepth, 100)),
+		commitDone:  make(chan struct{}),
+		closeCh:     make(chan struct{}),
+		watchers:    make(map[*watcher]struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+		locks:       newRangeLockManager(),
+
+		writeBuffer:      env.WriteBuffer,
+		blockCache:       env.BlockCache,
+		tableCache:       env.TableCache,
+		compacting:       make(map[common.FileNo]struct{}),
+		levelCompactions: make(map[int]int),
+		compactPointers:  make(map[int][]byte),
+	}
+
+	db.memtable = db.newMemtable()
+	db.publishMemtables()
+	db.compacted = sync.NewCond(&db.mu)
+	db.flushed = sync.NewCond(&db.mu)
+	if len(opts.EventListeners) > 0 {
+		m.SetTableDeletedHook(db.notifyTableDeleted)
+	}
+	db.rateLimiter = env.RateLimiter
+	if db.rateLimiter == nil && opts.CompactionRateLimit > 0 {
+		db.rateLimiter = ratelimit.NewLimiter(opts.CompactionRateLimit)
+	}
 
+	if err := db.loadRecycledWALs(); err != nil {
+		return nil, err
+	}
+	if opts.ArchiveWALs {
+		if err := fsys.MkdirAll(paths.ArchiveDir(), 0755); err != nil {
+			return nil, err
+		}
+		if err := db.pruneWALArchive(); err != nil {
+			return nil, fmt.Errorf("failed to prune WAL archive: %w", err)
+		}
+	}
+
+	// Try to load existing manifest
 	manifestPath := paths.ManifestPath()
-	if manifestFile, err := os.Open(manifestPath); err == nil {
+	if manifestFile, err := fsys.Open(manifestPath); err == nil {
 		// Recovery path: manifest exists
 		defer manifestFile.Close()
 
@@ -62,77 +286,175 @@ func Open(optFns ...Option) (*DB, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to read manifest: %w", err)
 		}
-
-		m = manifest.NewManifest(paths, opts.MaxSSTableLevel+1)
 		m.LoadVersion(version)
 
-		// Open existing WAL for recovery
-		walPath := paths.WALPath(version.CurrentWAL)
-		log, err = wal.OpenWAL(walPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open WAL: %w", err)
+		if opts.QuarantineCorruptFiles {
+			if err := quarantineTables(fsys, m, paths, db.logger("recovery")); err != nil {
+				return nil, err
+			}
 		}
 
-		// Replay WAL into memtable
-		mt = memtable.NewMapMemtable()
-		nextSeq, err = replayWAL(log, mt)
+		if err := removeOrphanTables(fsys, paths, m.Current()); err != nil {
+			return nil, fmt.Errorf("failed to remove orphan tables: %w", err)
+		}
+		if err := removeOrphanBlobFiles(fsys, paths, version); err != nil {
+			return nil, fmt.Errorf("failed to remove orphan blob files: %w", err)
+		}
+
+		// Replay the live WALs into the memtable
+		db.nextSeq, err = db.replayWALs()
 		if err != nil {
-			log.Close()
-			return nil, fmt.Errorf("failed to replay WAL: %w", err)
+			return nil, err
 		}
+		db.nextSeq = max(db.nextSeq, m.Current().MaxSeq(), m.LastSeq())
 
-		common.Logf("recovered from manifest: wal=%d seq=%d\n", version.CurrentWAL, nextSeq)
+		db.logger("recovery").Log(common.LevelInfo, "recovered from manifest", "wal", db.walNum, "seq", db.nextSeq)
 	} else {
 		// Fresh DB path: no manifest
-		m = manifest.NewManifest(paths, opts.MaxSSTableLevel+1)
 
 		// Create initial WAL
-		walPath := paths.WALPath(m.Current().NextWALNumber)
-		log, err = wal.CreateWAL(walPath)
+		db.walNum = m.Current().NextWALNumber
+		db.wal, err = db.createWAL(db.walNum)
 		if err != nil {
 			return nil, err
 		}
 
-		m.SetWAL(m.Current().NextWALNumber)
+		m.SetWAL(db.walNum)
 
 		// Persist initial manifest to disk
 		if err = m.Flush(); err != nil {
 			return nil, fmt.Errorf("failed to write initial manifest: %w", err)
 		}
+	}
 
-		mt = memtable.NewMapMemtable()
-		nextSeq = 0
+	if err := db.deleteObsoleteBlobFiles(); err != nil {
+		return nil, fmt.Errorf("failed to delete obsolete blob files: %w", err)
 	}
 
-	db := &DB{
-		nextSeq:   nextSeq,
-		memtable:  mt,
-		wal:       log,
-		manifest:  m,
-		Opts:      opts,
-		paths:     paths,
-		writeChan: make(chan *writeRequest, 100),
+	if opts.ReplicationBacklog > 0 {
+		db.backlog = newCommitBacklog(opts.ReplicationBacklog, db.nextSeq)
+	}
+
+	if opts.AutoTuneCompaction {
+		db.tuner = newCompactionTuner(opts.MinL0CompactionTrigger, opts.MaxL0CompactionTrigger, opts.L0CompactionTrigger, opts.MaxBackgroundCompactions, db.logger("autotune"))
 	}
 
+	pool := env.Scheduler
+	if pool == nil {
+		db.pool = scheduler.NewScheduler(opts.MaxBackgroundJobs, map[scheduler.JobType]int{
+			scheduler.JobCompaction: opts.MaxBackgroundCompactions,
+		}, db.logger("scheduler"))
+		pool = db.pool
+	}
+	db.scheduler = scheduler.NewGroup(pool, db.logger("scheduler"))
+
 	// Start background group commit loop
+	db.bgWG.Add(1)
 	go db.groupCommitLoop()
 
+	// Catch up on compactions left pending by the previous run
+	db.scheduleCompaction()
+
+	if opts.CheckpointInterval > 0 {
+		db.bgWG.Add(1)
+		go db.checkpointLoop(opts.CheckpointInterval, opts.CheckpointRetention)
+	}
+
 	return db, nil
 }
 
-// replayWAL replays all entries from the WAL into the memtable.
-// Returns the highest sequence number seen.
-func replayWAL(w wal.WAL, mt memtable.Memtable) (uint32, error) {
-	iter, err := w.Iterator()
+// replayWALs replays the live WALs, oldest first, into d.memtable and leaves
+// d.wal open on the newest. Returns the highest sequence number seen.
+//
+// A crash with memtables still waiting to be flushed leaves several live
+// WALs. Their entries are moved to one fresh WAL, as are those of an
+// oversized log flushed in pieces, so a single WAL is live afterwards. With
+// QuarantineCorruptFiles, a WAL that fails to replay is quarantined along
+// with the ones after it, keeping the entries read before the corruption.
+func (d *DB) replayWALs() (uint64, error) {
+	nums := d.manifest.Current().LiveWALs()
+	var maxSeq uint64
+	flushed := false
+	for i, num := range nums {
+		log, err := d.openWAL(num)
+		if err != nil {
+			if d.wal != nil {
+				d.wal.Close()
+			}
+			return 0, fmt.Errorf("failed to open WAL: %w", err)
+		}
+		if d.wal != nil {
+			d.wal.Close()
+		}
+		d.wal, d.walNum = log, num
+
+		seq, logFlushed, err := d.replayWAL()
+		maxSeq = max(maxSeq, seq)
+		flushed = flushed || logFlushed
+		if err != nil && d.Opts.QuarantineCorruptFiles && !d.Opts.ReadOnly {
+			d.logger("recovery").Log(common.LevelError, "WAL is corrupt", "wal", num, "err", err)
+			if err := d.quarantineWALs(nums[i:]); err != nil {
+				d.wal.Close()
+				return 0, fmt.Errorf("failed to quarantine WAL: %w", err)
+			}
+			return maxSeq, nil
+		} else if err != nil {
+			d.wal.Close()
+			return 0, fmt.Errorf("failed to replay WAL: %w", err)
+		}
+	}
+
+	if !d.Opts.ReadOnly && (flushed || len(nums) > 1) {
+		if err := d.rewriteWAL(); err != nil {
+			d.wal.Close()
+			return 0, fmt.Errorf("failed to replay WAL: %w", err)
+		}
+	}
+	return maxSeq, nil
+}
+
+// openWAL opens WAL num for replay, read-only if the database is.
+func (d *DB) openWAL(num common.FileNo) (wal.WAL, error) {
+	if d.Opts.ReadOnly {
+		return wal.OpenWALReadOnly(d.fs, d.paths.WALPath(num))
+	}
+	return wal.OpenWAL(d.walFS(), d.paths.WALPath(num), d.logger("wal"))
+}
+
+// replayFlushFactor bounds memory during recovery: replay flushes the memtable
+// to L0 whenever it reaches this multiple of the flush threshold. Logs written
+// under the current threshold never get that large, so this only kicks in
+// when the threshold was lowered or a flush was missed.
+const replayFlushFactor = 2
+
+// replayWAL replays all entries from d.wal into d.memtable.
+// Returns the highest sequence number seen, even on error, where the entries
+// before the failure have already been applied, and whether any were
+// flushed.
+//
+// An oversized log is flushed to L0 in pieces as it replays instead of being
+// held in memory at once. The caller must then move the unflushed tail to a
+// fresh WAL so the flushed prefix isn't replayed again on the next open.
+func (d *DB) replayWAL() (uint64, bool, error) {
+	iter, err := d.wal.Iterator()
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
+	defer iterator.Close(iter)
 
-	var maxSeq uint32
+	flushAt := replayFlushFactor * d.Opts.MemtableFlushThreshold
+	flushed := false
+
+	var maxSeq uint64
 	for {
 		entry, err := iter.Next()
+		if errors.Is(err, wal.ErrTornWrite) {
+			// Only a read-only open sees this; OpenWAL truncates torn writes
+			d.logger("recovery").Log(common.LevelWarn, "ignoring torn write at end of WAL", "err", err)
+			break
+		}
 		if err != nil {
-			return 0, err
+			return maxSeq, flushed, err
 		}
 		if entry == nil {
 			break
@@ -142,21 +464,101 @@ func replayWAL(w wal.WAL, mt memtable.Memtable) (uint32, error) {
 			maxSeq = entry.Seq
 		}
 
-		switch entry.Type {
-		case common.EntryTypePut:
-			mt.Put(entry.Key, entry.Value)
-		case common.EntryTypeDelete:
-			mt.Delete(entry.Key)
+		d.memtable.Apply(entry)
+
+		if !d.Opts.ReadOnly && d.memtable.Len() >= flushAt {
+			edit, err := d.writeSSTable(d.memtable)
+			if err != nil {
+				return maxSeq, flushed, err
+			}
+			d.manifest.Apply(edit)
+			d.notifyTablesCreated(edit)
+			d.memtable = d.newMemtable()
+			d.publishMemtables()
+			flushed = true
 		}
 	}
 
-	return maxSeq, nil
+	return maxSeq, flushed, nil
 }
 
+// rewriteWAL replaces the current WAL with a new one holding only the
+// memtable's entries and range tombstones and persists the switch, along with any pending table
+// additions, to the manifest. The replayed logs are then deleted.
+func (d *DB) rewriteWAL() error {
+	newWALNum := d.manifest.Current().NextWALNumber
+	newWAL, err := d.createWAL(newWALNum)
+	if err != nil {
+		return err
+	}
+
+	var entries []*common.Entry
+	iter := d.memtable.Iterator()
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			newWAL.Close()
+			return err
+		}
+		if entry == nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	entries = append(entries, d.memtable.RangeTombstones()...)
+	if err := newWAL.WriteEntry(entries); err != nil {
+		newWAL.Close()
+		return err
+	}
+
+	d.manifest.SetWAL(newWALNum)
+	if err := d.manifest.Flush(); err != nil {
+		newWAL.Close()
+		return err
+	}
+
+	d.wal.Close()
+	d.wal, d.walNum = newWAL, newWALNum
+	d.deleteObsoleteWALs()
+	return nil
+}
+
+// WriteOptions control how a single write is committed.
+type WriteOptions struct {
+	// Sync syncs the WAL before the write returns. Without it the write is
+	// acknowledged once the OS holds it, and a machine crash may lose it
+	// along with the other writes since the last sync, though never a write
+	// without those committed before it.
+	Sync bool
+}
+
+// DefaultWriteOptions syncs every write.
+var DefaultWriteOptions = WriteOptions{Sync: true}
+
 func (d *DB) Put(key, value []byte) error {
+	return d.PutWithOptions(key, value, DefaultWriteOptions)
+}
+
+// PutWithOptions is like Put but commits as opts specify.
+func (d *DB) PutWithOptions(key, value []byte, opts WriteOptions) error {
+	return d.put(context.Background(), key, value, 0, opts)
+}
+
+// PutContext is like Put but gives up once ctx is done, returning its
+// error. A write given up on after it was queued may still commit.
+func (d *DB) PutContext(ctx context.Context, key, value []byte) error {
+	return d.put(ctx, key, value, 0, DefaultWriteOptions)
+}
+
+// put commits a put of key that expires ttl after it commits, or never if
+// ttl is 0.
+func (d *DB) put(ctx context.Context, key, value []byte, ttl time.Duration, opts WriteOptions) error {
 	if len(key) == 0 {
 		return errors.New("db: key must be non-empty")
 	}
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
 
 	entry := &common.Entry{
 		Type:  common.EntryTypePut,
@@ -165,19 +567,42 @@ func (d *DB) Put(key, value []byte) error {
 		// Seq assigned by group commit loop
 	}
 
-	req := &writeRequest{
-		entry:    entry,
-		resultCh: make(chan error, 1),
-	}
+	return d.submit(ctx, &writeRequest{entries: []*common.Entry{entry}, sync: opts.Sync, ttls: []time.Duration{ttl}})
+}
 
-	d.writeChan <- req
-	return <-req.resultCh
+// SyncWAL makes every write committed so far durable, including those
+// written without WriteOptions.Sync.
+func (d *DB) SyncWAL() error {
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.wal.Sync()
 }
 
 func (d *DB) Delete(key []byte) error {
+	return d.DeleteWithOptions(key, DefaultWriteOptions)
+}
+
+// DeleteWithOptions is like Delete but commits as opts specify.
+func (d *DB) DeleteWithOptions(key []byte, opts WriteOptions) error {
+	return d.delete(context.Background(), key, opts)
+}
+
+// DeleteContext is like Delete but gives up once ctx is done, returning its
+// error. A delete given up on after it was queued may still commit.
+func (d *DB) DeleteContext(ctx context.Context, key []byte) error {
+	return d.delete(ctx, key, DefaultWriteOptions)
+}
+
+func (d *DB) delete(ctx context.Context, key []byte, opts WriteOptions) error {
 	if len(key) == 0 {
 		return errors.New("db: key must be non-empty")
 	}
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
 
 	entry := &common.Entry{
 		Type: common.EntryTypeDelete,
@@ -185,159 +610,316 @@ func (d *DB) Delete(key []byte) error {
 		// Seq assigned by group commit loop
 	}
 
-	req := &writeRequest{
-		entry:    entry,
-		resultCh: make(chan error, 1),
+	return d.submit(ctx, &writeRequest{entries: []*common.Entry{entry}, sync: opts.Sync})
+}
+
+func (d *DB) Get(key []byte) ([]byte, error) {
+	return d.get(context.Background(), key, DefaultReadOptions, ReadAllTier)
+}
+
+// GetWithOptions is like Get but reads as opts specify.
+func (d *DB) GetWithOptions(key []byte, opts ReadOptions) ([]byte, error) {
+	return d.get(context.Background(), key, opts, ReadAllTier)
+}
+
+// GetContext is like Get but gives up once ctx is done, returning its
+// error. ctx is checked before each table is read.
+func (d *DB) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	return d.get(ctx, key, DefaultReadOptions, ReadAllTier)
+}
+
+// GetFromTier is like Get but reads no further than tier.
+func (d *DB) GetFromTier(key []byte, tier ReadTier) ([]byte, error) {
+	return d.get(context.Background(), key, DefaultReadOptions, tier)
+}
+
+// get doesn't take d.mu: the memtables are safe for concurrent reads, and
+// the version it reads from is pinned, so point reads don't wait on
+// writers, flushes, or compactions.
+func (d *DB) get(ctx context.Context, key []byte, opts ReadOptions, tier ReadTier) ([]byte, error) {
+	d.gets.Add(1)
+
+	entry, err := d.getEntry(ctx, key, opts, tier)
+	if err != nil {
+		return nil, err
 	}
+	if entry.Type == common.EntryTypeDelete {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(entry.Value), nil
+}
 
-	d.writeChan <- req
-	return <-req.resultCh
+// GetEntry returns the newest version of key with its sequence number, type,
+// and commit timestamp. Unlike Get, a deleted key yields its tombstone for as
+// long as the database still holds it. Returns ErrNotFound if no version is
+// held at all.
+func (d *DB) GetEntry(key []byte) (*common.Entry, error) {
+	d.gets.Add(1)
+
+	entry, err := d.getEntry(context.Background(), key, DefaultReadOptions, ReadAllTier)
+	if err != nil {
+		return nil, err
+	}
+	return cloneEntry(entry), nil
 }
 
-func (d *DB) Get(key []byte) ([]byte, error) {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+// getEntry finds the newest version of key, tombstones included. A version
+// that expired or was deleted by a range tombstone comes back as a point
+// tombstone. The entry is not copied. It may be called without d.mu.
+func (d *DB) getEntry(ctx context.Context, key []byte, opts ReadOptions, tier ReadTier) (*common.Entry, error) {
+	entry, err := d.findEntry(ctx, key, opts, tier)
+	if err != nil || entry.Type == common.EntryTypeDelete {
+		return entry, err
+	}
+	if entry = expireEntry(entry, time.Now().UnixNano()); entry.Type == common.EntryTypeDelete {
+		return entry, nil
+	}
 
-	common.Logf("get key=%q\n", string(key))
-	common.Logf("  checking memtable\n")
-	entry, ok := d.memtable.Get(key)
-	if ok {
-		if entry.Type == common.EntryTypeDelete {
-			common.Logf("  found tombstone in memtable\n")
-			return nil, ErrNotFound
+	mems := d.memtables()
+	version := d.manifest.Ref()
+	defer d.manifest.Unref(version)
+	rangeDels, err := d.rangeTombstones(mems, version, tier)
+	if err != nil {
+		return nil, err
+	}
+	return applyRangeDels(rangeDels, entry), nil
+}
+
+// findEntry finds the newest point entry for key, ignoring range tombstones.
+// It may be called without d.mu: a flush publishes the memtables without
+// the one it flushed only after committing the table holding its entries,
+// so the memtables, read first, and the version, pinned after them, miss
+// nothing between them. It gives up once ctx is done.
+func (d *DB) findEntry(ctx context.Context, key []byte, opts ReadOptions, tier ReadTier) (*common.Entry, error) {
+	// Lookups are traced at debug level, which is rarely enabled
+	trace := common.DiscardLogger
+	if d.log.Enabled(common.LevelDebug) {
+		trace = d.logger("get")
+	}
+	for _, mem := range d.memtables() {
+		if entry, ok := mem.Get(key); ok {
+			trace.Log(common.LevelDebug, "found in memtable", "key", key)
+			return entry, nil
 		}
-		common.Logf("  found in memtable\n")
-		return bytes.Clone(entry.Value), nil
 	}
 
-	version := d.manifest.Current()
+	probes := 0
+	if d.tuner != nil {
+		defer func() { d.tuner.recordGet(probes) }()
+	}
+
+	version := d.manifest.Ref()
+	defer d.manifest.Unref(version)
 	for level, fileMetas := range version.Levels {
-		common.Logf("  checking L%d (%d files)\n", level, len(fileMetas))
-
-		// L0 has overlapping ranges, check newest to oldest
-		// L1+ are non-overlapping, order doesn't matter (for now)
-		files := fileMetas
-		if level == 0 {
-			// Reverse iteration for L0 to check newest files first
-			files = make([]manifest.FileMetadata, len(fileMetas))
-			for i, fm := range fileMetas {
-				files[len(fileMetas)-1-i] = fm
+		trace.Log(common.LevelDebug, "checking level", "key", key, "level", level, "files", len(fileMetas))
+
+		// L0 files have overlapping ranges, so every one is checked, newest
+		// first. L1+ files don't overlap, so only one can hold the key.
+		files := newestFirst(level, fileMetas)
+		if level > 0 {
+			fm, ok := version.FileFor(level, key)
+			if !ok {
+				continue
 			}
+			files = []manifest.FileMetadata{fm}
 		}
-
-		// TODO: Optimize lookup for L1+
-		// L0 files have overlapping ranges, so we must check all files.
-		// L1+ files are non-overlapping within a level, so we can binary search
-		// by key range to find the single file that might contain the key.
 		for _, fm := range files {
-			table, err := d.manifest.GetTable(fm.FileNo, level)
-			if err != nil {
-				continue
+			if err := ctx.Err(); err != nil {
+				return nil, err
 			}
-
-			entry, err := table.Get(key)
+			probes++
+			entry, err := d.getFromTable(level, fm, key, opts, tier)
 			if err == sstable.ErrNotFound {
-				common.Logf("    not in L%d/%d.sst\n", level, fm.FileNo)
+				trace.Log(common.LevelDebug, "not in table", "key", key, "level", level, "file", fm.FileNo)
 				continue
 			}
 			if err != nil {
-				return nil, fmt.Errorf("failed to read from L%d/%d.sst: %w", level, fm.FileNo, err)
+				return nil, err
 			}
 
-			if entry.Type == common.EntryTypeDelete {
-				common.Logf("    found tombstone in L%d/%d.sst\n", level, fm.FileNo)
-				return nil, ErrNotFound
-			}
-			common.Logf("    found in L%d/%d.sst\n", level, fm.FileNo)
-			return bytes.Clone(entry.Value), nil
+			trace.Log(common.LevelDebug, "found in table", "key", key, "level", level, "file", fm.FileNo)
+			return d.resolveBlob(entry, tier)
 		}
 	}
 
 	return nil, ErrNotFound
 }
 
-// flushMemtable writes the current memtable to an SSTable and rotates the WAL.
-// Must be called with d.mu held.
-func (d *DB) flushMemtable() error {
-	v := d.manifest.Current()
-	newWALNum := v.NextWALNumber
-
-	// 1. Close old WAL (no more writes needed)
-	d.wal.Close()
+// getFromTable looks key up in one table. At BlockCacheTier, a table that
+// isn't open or a block that isn't cached fails with ErrWouldBlock.
+func (d *DB) getFromTable(level int, fm manifest.FileMetadata, key []byte, opts ReadOptions, tier ReadTier) (*common.Entry, error) {
+	if tier == BlockCacheTier {
+		table, ok := d.manifest.CachedTable(fm.FileNo, level)
+		if !ok {
+			return nil, ErrWouldBlock
+		}
+		entry, err := table.GetCached(key)
+		if err == sstable.ErrNotCached {
+			return nil, ErrWouldBlock
+		}
+		return entry, err
+	}
 
-	// 2. Create new WAL file
-	newWALPath := d.paths.WALPath(newWALNum)
-	newWAL, err := wal.CreateWAL(newWALPath)
+	table, err := d.manifest.GetTable(fm.FileNo, level)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err)
 	}
-
-	// 3. Write memtable to SSTable
-	if err := d.writeSSTable(); err != nil {
-		return err
+	entry, err := table.GetWithOptions(key, opts.table())
+	if err != nil && err != sstable.ErrNotFound {
+		return nil, fmt.Errorf("failed to read from L%d/%d.sst: %w", level, fm.FileNo, err)
 	}
+	return entry, err
+}
 
-	// 4. Update manifest (atomic commit point)
-	d.manifest.SetWAL(newWALNum)
-
-	// 5. Persist manifest to disk (makes new files visible)
-	if err := d.manifest.Flush(); err != nil {
-		return err
+// newestFirst returns the files of a level in the order reads must consult them.
+// L0 has overlapping ranges, so files are reversed to check newest to oldest.
+// L1+ are non-overlapping, so they are returned in key order.
+func newestFirst(level int, fileMetas []manifest.FileMetadata) []manifest.FileMetadata {
+	if level != 0 {
+		return fileMetas
 	}
-
-	// 6. Swap to new WAL and new memtable
-	d.wal = newWAL
-	d.memtable = memtable.NewMapMemtable()
-
-	return nil
+	files := make([]manifest.FileMetadata, len(fileMetas))
+	for i, fm := range fileMetas {
+		files[len(fileMetas)-1-i] = fm
+	}
+	return files
 }
 
-// writeSSTable writes the current memtable to an SSTable file.
-// Must be called with d.mu held.
-func (d *DB) writeSSTable() error {
-	start := time.Now()
-
+// writeSSTable writes a memtable to a new SSTable file and returns the
+// edit adding it to L0. The memtable must not change meanwhile.
+func (d *DB) writeSSTable(mem memtable.Memtable) (*manifest.CompactionEdit, error) {
 	// Get next SSTable number from manifest
-	v := d.manifest.Current()
-	fileNo := v.NextSSTableNumber
+	fileNo := d.manifest.NewSSTableNumber()
 
-	// Create SSTable file in L0
-	path := d.paths.SSTablePath(0, fileNo)
-	f, err := os.Create(path)
+	// Write all memtable entries (sorted) to a new SSTable in L0, with large
+	// values going to a blob file
+	blobs := d.newBlobSeparator(mem.Iterator(), nil)
+	fm, _, err := d.buildTable(0, fileNo, blobs, mem.RangeTombstones(), mem.Len())
+	if err != nil {
+		blobs.abort()
+		return nil, err
+	}
+	fm.BlobFiles = blobs.takeRefs()
+	blobFiles, err := blobs.finish()
 	if err != nil {
-		return fmt.Errorf("failed to create %s: %w", path, err)
+		d.fs.Remove(d.paths.SSTablePath(0, fileNo))
+		return nil, err
 	}
 
-	// Get sorted entries from memtable
-	iter := d.memtable.Iterator()
+	return &manifest.CompactionEdit{
+		AddSSTables: map[int][]manifest.FileMetadata{
+			0: {*fm},
+		},
+		AddBlobFiles: blobFiles,
+	}, nil
+}
 
-	// Write all entries to SSTable
-	result, err := sstable.WriteSSTable(f, iter, uint32(d.memtable.Len()), d.Opts.BloomFilterFPR)
+// buildTable writes the sorted entries from iter and the range tombstones
+// rangeDels to a new SSTable file at the given level and returns its
+// metadata. sizeHint sizes the filter.
+func (d *DB) buildTable(level int, fileNo common.FileNo, iter common.EntryIterator, rangeDels common.RangeTombstones, sizeHint int) (*manifest.FileMetadata, *sstable.WriteResult, error) {
+	// Crash-safe write: build under a temp name, sync, then rename so a
+	// partially written table never appears at a committed-looking path
+	path := d.paths.SSTablePath(level, fileNo)
+	tmpPath := path + ".tmp"
+	f, err := d.tableFS().Create(tmpPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+
+	checksum := common.NewChecksum()
+	result, err := sstable.WriteSSTableWithPolicy(io.MultiWriter(f, checksum), iter, uint32(sizeHint), d.Opts.filterPolicy(), d.Opts.PrefixExtractor, d.Opts.Compression, rangeDels)
 	if err != nil {
 		f.Close()
-		return err
+		d.fs.Remove(tmpPath)
+		return nil, nil, err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		d.fs.Remove(tmpPath)
+		return nil, nil, err
 	}
 
 	if err := f.Close(); err != nil {
-		return err
+		d.fs.Remove(tmpPath)
+		return nil, nil, err
 	}
 
-	// Update manifest to add new SSTable to L0
-	edit := &manifest.CompactionEdit{
-		AddSSTables: map[int][]manifest.FileMetadata{
-			0: {
-				{
-					FileNo:      fileNo,
-					SmallestKey: result.SmallestKey,
-					LargestKey:  result.LargestKey,
-				},
-			},
-		},
+	if err := d.fs.Rename(tmpPath, path); err != nil {
+		d.fs.Remove(tmpPath)
+		return nil, nil, err
 	}
-	d.manifest.Apply(edit)
 
-	common.LogDuration(start, "  flushed %d entries to %d.sst", result.EntryCount, fileNo)
-	return nil
+	// Persist the rename before the manifest edit can reference the file
+	if err := vfs.SyncDir(d.fs, filepath.Dir(path)); err != nil {
+		return nil, nil, err
+	}
+
+	fm := &manifest.FileMetadata{
+		FileNo:      fileNo,
+		SmallestKey: result.SmallestKey,
+		LargestKey:  result.LargestKey,
+		Size:        uint64(result.BytesWritten),
+		Checksum:    checksum.Sum32(),
+		Entries:     result.EntryCount,
+		Tombstones:  result.TombstoneCount,
+		RangeDels:   result.RangeDelCount,
+		MaxSeq:      result.MaxSeq,
+		KeySizes:    result.KeySizes,
+		ValueSizes:  result.ValueSizes,
+	}
+	if d.Opts.PrefixExtractor != nil {
+		fm.PrefixExtractor = d.Opts.PrefixExtractor.Name()
+	}
+	return fm, result, nil
+}
+
+// Logger returns the logger the DB's records go to.
+func (d *DB) Logger() common.Logger {
+	return d.log
+}
+
+// logger returns the logger for records about component.
+func (d *DB) logger(component string) common.Logger {
+	return common.WithPrefix(d.log, component)
+}
+
+// tableFS returns the filesystem tables and blob files are written through.
+func (d *DB) tableFS() vfs.FS {
+	fsys := d.fs
+	if d.Opts.DirectIOWrites {
+		fsys = vfs.NewDirectIOFS(fsys)
+	}
+	return vfs.NewSyncingFS(vfs.NewRateLimitedFS(fsys, d.rateLimiter), d.Opts.BytesPerSync)
+}
+
+// walFS returns the filesystem WALs are written through.
+func (d *DB) walFS() vfs.FS {
+	return vfs.NewSyncingFS(d.fs, d.Opts.WALBytesPerSync)
+}
+
+// memtables returns the memtable and the queued immutable memtables, newest
+// first, in the order reads must consult them. It may be called without
+// d.mu, returning the memtables as last published.
+func (d *DB) memtables() []memtable.Memtable {
+	return *d.mems.Load()
+}
+
+// newMemtable returns an empty memtable, with a bloom filter sized for
+// MemtableFlushThreshold keys unless Options.MemtableBloomBitsPerKey is 0.
+func (d *DB) newMemtable() memtable.Memtable {
+	return memtable.NewSkiplistMemtableWithBloom(d.Opts.MemtableFlushThreshold, d.Opts.MemtableBloomBitsPerKey)
+}
+
+// publishMemtables makes the current memtable and immutable queue the ones
+// memtables returns. Must be called with d.mu held, or before Open returns.
+func (d *DB) publishMemtables() {
+	mems := []memtable.Memtable{d.memtable}
+	for i := len(d.immutable) - 1; i >= 0; i-- {
+		mems = append(mems, d.immutable[i].memtable)
+	}
+	d.mems.Store(&mems)
 }
 
 func (d *DB) Memtable() memtable.Memtable {
@@ -362,16 +944,63 @@ func (d *DB) Paths() *common.PathManager {
 	return d.paths
 }
 
-// Close stops all database operations and releases resources.
-// Currently a stub for future cleanup (closing WAL, flushing buffers, etc.)
+func (d *DB) FS() vfs.FS {
+	return d.fs
+}
+
+// Close stops all database operations and releases resources: it stops
+// the background jobs and loops, fails writes not yet committed with
+// ErrClosed, syncs and closes the WAL, and releases this instance's tables
+// from the (possibly shared) table cache. Closing a closed database does
+// nothing and returns the first Close's error.
 func (d *DB) Close() error {
+	d.closeOnce.Do(func() {
+		d.closeErr = d.close()
+	})
+	return d.closeErr
+}
+
+func (d *DB) close() error {
+	close(d.closeCh)
+	if d.compacted != nil {
+		d.mu.Lock()
+		d.compacted.Broadcast()
+		d.flushed.Broadcast()
+		d.mu.Unlock()
+	}
+	if d.scheduler != nil {
+		d.scheduler.Close()
+	}
+	if d.pool != nil {
+		d.pool.Close()
+	}
+	d.bgWG.Wait()
+
+	// The commit loop has published its last batch, and Watch registers no
+	// more watchers now closeCh is closed
+	d.watchMu.Lock()
+	for w := range d.watchers {
+		d.removeWatcher(w)
+	}
+	d.watchMu.Unlock()
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// TODO: Close WAL
-	// TODO: Close manifest (which closes table cache)
-	// TODO: Flush any pending writes
+	if d.writeBuffer != nil {
+		d.writeBuffer.unregister(d)
+	}
 
-	return nil
-}
+	// Queued memtables need no flush: their WALs are replayed on open
+	if d.wal != nil {
+		if !d.Opts.ReadOnly {
+			if err := d.wal.Sync(); err != nil {
+				d.logger("wal").Log(common.LevelError, "failed to sync WAL", "err", err)
+			}
+		}
+		d.wal.Close()
+	}
 
+	d.blobs.Close()
+	return d.manifest.Close()
+}
@@ -2,10 +2,18 @@ package db_test
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"amethyst/internal/common"
 	"amethyst/internal/db"
+	"amethyst/internal/vfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,6 +80,7 @@ func TestSSTableReadAfterFlush(t *testing.T) {
 	// Write 4th entry - triggers flush to SSTable
 	err = d.Put([]byte("trigger"), []byte("flush"))
 	require.NoError(t, err)
+	d.WaitForCompactions()
 
 	// Verify SSTable file was created
 	_, err = os.Stat(fmt.Sprintf("%s/sstable/0/0.sst", testDir))
@@ -152,6 +161,7 @@ func TestL0IterationOrder(t *testing.T) {
 	// This triggers flush, creating 0.sst with apple=v1
 	err = d.Put([]byte("cherry"), []byte("filler2"))
 	require.NoError(t, err)
+	d.WaitForCompactions()
 
 	// Verify 0.sst exists
 	_, err = os.Stat(fmt.Sprintf("%s/sstable/0/0.sst", testDir))
@@ -166,6 +176,7 @@ func TestL0IterationOrder(t *testing.T) {
 	// This triggers second flush, creating 1.sst with apple=v2
 	err = d.Put([]byte("elderberry"), []byte("filler4"))
 	require.NoError(t, err)
+	d.WaitForCompactions()
 
 	// Verify 1.sst exists
 	_, err = os.Stat(fmt.Sprintf("%s/sstable/0/1.sst", testDir))
@@ -181,3 +192,385 @@ func TestL0IterationOrder(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("v2"), value, "Should return newest version from 1.sst, not stale version from 0.sst")
 }
+
+func TestSSTableTempFiles(t *testing.T) {
+	testDir := t.TempDir()
+
+	d, err := db.Open(db.WithDBPath(testDir), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("v")))
+	}
+	d.WaitForCompactions()
+	require.NoError(t, d.Close())
+
+	// Flushed tables are renamed into place; no temp files remain
+	tmpFiles, err := filepath.Glob(filepath.Join(testDir, "sstable", "*", "*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, tmpFiles)
+	tables, err := filepath.Glob(filepath.Join(testDir, "sstable", "0", "*.sst"))
+	require.NoError(t, err)
+	require.Len(t, tables, 2)
+
+	// A table interrupted mid-write is discarded on the next open
+	leftover := filepath.Join(testDir, "sstable", "0", "99.sst.tmp")
+	require.NoError(t, os.WriteFile(leftover, []byte("partial"), 0644))
+
+	d, err = db.Open(db.WithDBPath(testDir))
+	require.NoError(t, err)
+	defer d.Close()
+
+	_, err = os.Stat(leftover)
+	require.True(t, os.IsNotExist(err))
+	for i := 0; i < 5; i++ {
+		_, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+	}
+}
+
+func TestReplayFlushesOversizedWAL(t *testing.T) {
+	testDir := t.TempDir()
+
+	d, err := db.Open(db.WithDBPath(testDir), db.WithMemtableFlushThreshold(100))
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	require.NoError(t, d.Close())
+
+	// Reopen with a much smaller threshold: replay flushes every 8 entries
+	for round := 0; round < 2; round++ {
+		d, err = db.Open(db.WithDBPath(testDir), db.WithMemtableFlushThreshold(4), db.WithL0CompactionTrigger(100))
+		require.NoError(t, err)
+
+		require.Len(t, d.Manifest().Current().Levels[0], 2, "flushed prefix is not replayed again")
+		require.Equal(t, 4, d.Memtable().Len())
+		for i := 0; i < 20; i++ {
+			_, err := d.Get([]byte(fmt.Sprintf("key%02d", i)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, d.Close())
+	}
+}
+
+func TestRecoverFromTornWALWrite(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+	require.NoError(t, d.Put([]byte("b"), []byte("2")))
+	walPath := d.Paths().WALPath(d.Manifest().Current().CurrentWAL)
+	require.NoError(t, d.Close())
+
+	// Simulate a crash partway through appending a record
+	f, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 2, 3, 4, 200, 0, 0, 0, 5})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// A read-only open ignores the torn record without changing the log
+	r, err := db.Open(db.WithDBPath(dir), db.WithReadOnly())
+	require.NoError(t, err)
+	value, err := r.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(value))
+	require.NoError(t, r.Close())
+
+	// A normal open truncates it, and later writes replay after the rest
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("c"), []byte("3")))
+	require.NoError(t, d.Close())
+
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		value, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, want, string(value))
+	}
+}
+
+func TestPrefixExtractorRecordedPerTable(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(2),
+		db.WithPrefixExtractor(common.NewFixedPrefixExtractor(4)),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("user%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+
+	tables := d.Manifest().Current().Levels[0]
+	require.NotEmpty(t, tables)
+	for _, fm := range tables {
+		require.Equal(t, "fixed:4", fm.PrefixExtractor)
+		table, err := d.Manifest().GetTable(fm.FileNo, 0)
+		require.NoError(t, err)
+		require.True(t, table.MayContainPrefix([]byte("user")))
+	}
+}
+
+// walSyncCountingFS counts the syncs of WAL files.
+type walSyncCountingFS struct {
+	vfs.FS
+	syncs *atomic.Int64
+}
+
+type walSyncCountingFile struct {
+	vfs.File
+	syncs *atomic.Int64
+}
+
+func (f walSyncCountingFile) Sync() error {
+	f.syncs.Add(1)
+	return f.File.Sync()
+}
+
+func (c walSyncCountingFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	f, err := c.FS.OpenFile(name, flag, perm)
+	if err != nil || !strings.HasSuffix(name, ".log") {
+		return f, err
+	}
+	return walSyncCountingFile{File: f, syncs: c.syncs}, nil
+}
+
+func TestWriteOptionsSync(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      db.WriteOptions
+		wantSyncs int64
+	}{
+		{"synced", db.WriteOptions{Sync: true}, 3},
+		{"unsynced", db.WriteOptions{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFS := vfs.NewMemFS()
+			syncs := &atomic.Int64{}
+			path := filepath.Join(t.TempDir(), "db")
+			d, err := db.Open(db.WithDBPath(path), db.WithEnv(db.NewEnvWithFS(walSyncCountingFS{memFS, syncs})))
+			require.NoError(t, err)
+
+			syncs.Store(0)
+			require.NoError(t, d.PutWithOptions([]byte("a"), []byte("1"), tt.opts))
+			require.NoError(t, d.PutWithOptions([]byte("b"), []byte("2"), tt.opts))
+			require.NoError(t, d.DeleteWithOptions([]byte("a"), tt.opts))
+			require.Equal(t, tt.wantSyncs, syncs.Load())
+
+			require.NoError(t, d.SyncWAL())
+			require.Equal(t, tt.wantSyncs+1, syncs.Load())
+			require.NoError(t, d.Close())
+
+			// Either way the writes are in the WAL, in order
+			d, err = db.Open(db.WithDBPath(path), db.WithEnv(db.NewEnvWithFS(memFS)))
+			require.NoError(t, err)
+			defer d.Close()
+			_, err = d.Get([]byte("a"))
+			require.ErrorIs(t, err, db.ErrNotFound)
+			value, err := d.Get([]byte("b"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("2"), value)
+		})
+	}
+}
+
+func TestGetDuringWritesAndFlushes(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(20), db.WithBatchTimeout(time.Microsecond))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Gets don't wait on the writer, but must never miss a key whose write
+	// has returned, whether it is in a memtable, being flushed, or in a table
+	const n = 300
+	var written atomic.Int64
+	var missed atomic.Value
+	done := make(chan struct{})
+	readers := make(chan struct{})
+	for range 4 {
+		go func() {
+			defer func() { readers <- struct{}{} }()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				upTo := written.Load()
+				if upTo == 0 {
+					continue
+				}
+				key := fmt.Sprintf("key%04d", int64(i)%upTo)
+				if _, err := d.Get([]byte(key)); err != nil {
+					missed.Store(fmt.Sprintf("%s: %v", key, err))
+				}
+			}
+		}()
+	}
+
+	for i := range n {
+		require.NoError(t, d.PutWithOptions([]byte(fmt.Sprintf("key%04d", i)), []byte("value"), db.WriteOptions{}))
+		written.Store(int64(i + 1))
+	}
+	close(done)
+	for range 4 {
+		<-readers
+	}
+	require.Nil(t, missed.Load())
+}
+
+func TestLogger(t *testing.T) {
+	var logs syncBuffer
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(10),
+		db.WithLogger(common.NewTextLogger(&logs, common.LevelDebug)))
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := range 20 {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	d.WaitForCompactions()
+	require.NoError(t, d.Put([]byte("key20"), []byte("v")))
+	_, err = d.Get([]byte("key20"))
+	require.NoError(t, err)
+	_, err = d.Get([]byte("key05"))
+	require.NoError(t, err)
+
+	// Records carry their component and fields, and lookups are traced
+	require.Contains(t, logs.String(), "INFO  flush: flushed memtable entries=10 file=0 duration=")
+	require.Contains(t, logs.String(), "DEBUG get: found in memtable key=key20\n")
+	require.Contains(t, logs.String(), "DEBUG get: found in table key=key05 level=0 file=0\n")
+}
+
+// syncBuffer is a strings.Builder safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("before"), []byte("1")))
+
+	// Writers racing Close either commit or fail with ErrClosed
+	const writers = 4
+	committed := make([]atomic.Int64, writers)
+	errs := make(chan error, writers)
+	for w := range writers {
+		go func() {
+			for i := 0; ; i++ {
+				if err := d.Put([]byte(fmt.Sprintf("w%d-%05d", w, i)), []byte("v")); err != nil {
+					errs <- err
+					return
+				}
+				committed[w].Store(int64(i + 1))
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, d.Close())
+	for range writers {
+		require.ErrorIs(t, <-errs, db.ErrClosed)
+	}
+
+	// Closing again is harmless, and later writes are refused
+	require.NoError(t, d.Close())
+	require.ErrorIs(t, d.Put([]byte("after"), []byte("1")), db.ErrClosed)
+	require.ErrorIs(t, d.Delete([]byte("before")), db.ErrClosed)
+
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	value, err := d.Get([]byte("before"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+	_, err = d.Get([]byte("after"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	for w := range writers {
+		for i := range committed[w].Load() {
+			_, err := d.Get([]byte(fmt.Sprintf("w%d-%05d", w, i)))
+			require.NoError(t, err, "acknowledged write w%d-%05d was lost", w, i)
+		}
+	}
+}
+
+func TestConcurrentInstances(t *testing.T) {
+	names := func() []string {
+		entries, err := os.ReadDir(".")
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	before := names()
+
+	// Two instances flush and compact at the same time, each numbering its
+	// files from 0, so any path not taken from its own directory collides
+	dirs := []string{t.TempDir(), t.TempDir()}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(dirs))
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(10))
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j := range 200 {
+				if err := d.Put([]byte(fmt.Sprintf("key%03d", j)), []byte(fmt.Sprintf("db%d", i))); err != nil {
+					errs <- err
+					break
+				}
+			}
+			if err := d.Compact(); err != nil {
+				errs <- err
+			}
+			if err := d.Close(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Reopened, each has only its own data, and nothing was written outside
+	// their directories
+	for i, dir := range dirs {
+		d, err := db.Open(db.WithDBPath(dir))
+		require.NoError(t, err)
+		for j := range 200 {
+			value, err := d.Get([]byte(fmt.Sprintf("key%03d", j)))
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("db%d", i), string(value))
+		}
+		require.NoError(t, d.Close())
+	}
+	require.Equal(t, before, names())
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/ratelimit"
+	"amethyst/internal/scheduler"
+	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/vfs"
+)
+
+// Env holds process-wide resources that many DB instances can share.
+// Multi-tenant services running many small databases in one process should
+// create a single Env and pass it to every Open via WithEnv, so that cache
+// memory, open file handles, background workers and I/O budget are pooled
+// instead of multiplied per instance.
+type Env struct {
+	// FS holds every instance's files.
+	FS         vfs.FS
+	BlockCache block_cache.BlockCache
+	TableCache table_cache.TableCache
+
+	// WriteBuffer, if set, caps the combined memtable memory of the
+	// instances. NewEnv leaves it nil, which means no cap.
+	WriteBuffer *WriteBufferManager
+
+	// Scheduler, if set, runs the flushes and compactions of every instance
+	// on one worker pool, in place of a pool per instance sized by
+	// Options.MaxBackgroundJobs. It must outlive the instances. NewEnv sets
+	// one up.
+	Scheduler scheduler.Scheduler
+
+	// RateLimiter, if set, paces the background writes of every instance
+	// against one budget, in place of Options.CompactionRateLimit. NewEnv
+	// leaves it nil, which means each instance's own limit applies.
+	RateLimiter ratelimit.Limiter
+}
+
+// NewScheduler returns a pool of jobs workers for the flushes and
+// compactions of the instances sharing an Env, of which at most compactions
+// may be compactions at once.
+func NewScheduler(jobs, compactions int) scheduler.Scheduler {
+	return scheduler.NewScheduler(jobs, map[scheduler.JobType]int{
+		scheduler.JobCompaction: compactions,
+	}, common.WithPrefix(common.DefaultLogger, "scheduler"))
+}
+
+// NewRateLimiter returns a Limiter allowing bytesPerSec bytes per second,
+// which must be positive, for the instances sharing an Env.
+func NewRateLimiter(bytesPerSec int64) ratelimit.Limiter {
+	return ratelimit.NewLimiter(bytesPerSec)
+}
+
+// Close stops the shared scheduler's workers. Call it once every instance
+// using the Env is closed.
+func (e *Env) Close() {
+	if e.Scheduler != nil {
+		e.Scheduler.Close()
+	}
+}
+
+// NewEnv creates an Env on the OS filesystem with a fresh block cache of
+// block_cache.DefaultCapacity bytes, a table cache backed by it holding up
+// to table_cache.DefaultMaxOpenFiles tables open, and a scheduler with the
+// workers of DefaultOptions.
+func NewEnv() *Env {
+	return NewEnvWithFS(vfs.Default)
+}
+
+// NewEnvWithFS is like NewEnv but keeps files in fsys, e.g. vfs.NewMemFS()
+// for hermetic tests.
+func NewEnvWithFS(fsys vfs.FS) *Env {
+	env := newEnv(fsys, block_cache.NewBlockCache(block_cache.DefaultCapacity), table_cache.DefaultMaxOpenFiles, sstable.OpenOptions{})
+	env.Scheduler = NewScheduler(DefaultOptions.MaxBackgroundJobs, DefaultOptions.MaxBackgroundCompactions)
+	return env
+}
+
+func newEnv(fsys vfs.FS, blockCache block_cache.BlockCache, maxOpenFiles int, openOpts sstable.OpenOptions) *Env {
+	return &Env{
+		FS:         fsys,
+		BlockCache: blockCache,
+		TableCache: table_cache.NewTableCacheWithOptions(fsys, blockCache, maxOpenFiles, openOpts),
+	}
+}
+
+// env returns o.Env, or a private Env sized by o if it is nil.
+func (o Options) env() *Env {
+	if o.Env != nil {
+		return o.Env
+	}
+	return newEnv(vfs.Default, block_cache.NewBlockCacheWithPolicy(o.BlockCacheSize, o.BlockCachePolicy), o.MaxOpenFiles, sstable.OpenOptions{Mmap: o.MmapReads, Logger: o.logger()})
+}
@@ -0,0 +1,204 @@
+package db_test
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedEnvAcrossInstances(t *testing.T) {
+	env := db.NewEnv()
+
+	// Both instances flush a table with the same file number (0.sst)
+	var dbs []*db.DB
+	for i := 0; i < 2; i++ {
+		d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2), db.WithEnv(env))
+		require.NoError(t, err)
+		for j := 0; j < 3; j++ {
+			require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", j)), []byte(fmt.Sprintf("db%d", i))))
+		}
+		d.WaitForCompactions()
+		dbs = append(dbs, d)
+	}
+
+	// Reads from each instance must see its own data, not the other's table
+	for i, d := range dbs {
+		value, err := d.Get([]byte("key0"))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("db%d", i)), value)
+	}
+	require.Equal(t, 2, env.TableCache.Len())
+
+	// Closing one instance releases only its own tables
+	require.NoError(t, dbs[0].Close())
+	require.Equal(t, 1, env.TableCache.Len())
+
+	value, err := dbs[1].Get([]byte("key0"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("db1"), value)
+}
+
+func TestWriteBufferManagerFlushesLargestMemtable(t *testing.T) {
+	env := db.NewEnv()
+	env.WriteBuffer = db.NewWriteBufferManager(100)
+
+	open := func() *db.DB {
+		d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(1000), db.WithEnv(env))
+		require.NoError(t, err)
+		t.Cleanup(func() { d.Close() })
+		return d
+	}
+	busy, quiet := open(), open()
+	value := []byte("0123456789012345")
+
+	// 4 * 20 bytes stays under the cap
+	for i := 0; i < 4; i++ {
+		require.NoError(t, busy.Put([]byte(fmt.Sprintf("key%d", i)), value))
+	}
+	require.Equal(t, 80, env.WriteBuffer.Usage())
+
+	// Crossing the cap from the quiet instance flushes the busy one
+	for i := 0; i < 2; i++ {
+		require.NoError(t, quiet.Put([]byte(fmt.Sprintf("key%d", i)), value))
+	}
+	busy.WaitForCompactions()
+	quiet.WaitForCompactions()
+
+	require.Len(t, busy.Manifest().Current().Levels[0], 1)
+	require.Empty(t, quiet.Manifest().Current().Levels[0])
+	require.Equal(t, 40, env.WriteBuffer.Usage())
+
+	got, err := busy.Get([]byte("key0"))
+	require.NoError(t, err)
+	require.Equal(t, value, got)
+}
+
+func TestMemFSEnv(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	env := db.NewEnvWithFS(fsys)
+	path := filepath.Join(t.TempDir(), "db")
+
+	d, err := db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(2), db.WithEnv(env))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i))))
+	}
+	require.NoError(t, d.Close())
+
+	// Nothing reached the real filesystem
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	entries, err := fsys.ReadDir(filepath.Join(path, "sstable", "0"))
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+
+	// Reopening on the same FS recovers every key
+	d, err = db.Open(db.WithDBPath(path), db.WithEnv(db.NewEnvWithFS(fsys)))
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 5; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value%d", i)), value)
+	}
+}
+
+// linklessFS is a backend without hard links or directory syncs.
+type linklessFS struct {
+	vfs.FS
+}
+
+func (linklessFS) Link(oldname, newname string) error { return vfs.ErrUnsupported }
+func (linklessFS) SyncDir(path string) error          { return vfs.ErrUnsupported }
+
+func TestFSWithoutOptionalOperations(t *testing.T) {
+	fsys := linklessFS{vfs.NewMemFS()}
+	path := filepath.Join(t.TempDir(), "db")
+
+	d, err := db.Open(
+		db.WithDBPath(path),
+		db.WithMemtableFlushThreshold(2),
+		db.WithPeriodicCheckpoints(10*time.Millisecond, 1),
+		db.WithEnv(db.NewEnvWithFS(fsys)),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+
+	// Checkpoints copy tables instead of linking them
+	checkpointDir := filepath.Join(path, "checkpoint")
+	require.Eventually(t, func() bool {
+		entries, err := fsys.ReadDir(checkpointDir)
+		return err == nil && len(entries) > 0
+	}, 2*time.Second, 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, d.Close())
+
+	// Only the newest checkpoint, taken after every Put, is retained
+	entries, err := fsys.ReadDir(checkpointDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	d, err = db.Open(db.WithDBPath(filepath.Join(checkpointDir, entries[0].Name())), db.WithEnv(db.NewEnvWithFS(fsys)))
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 3; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+	}
+}
+
+// countingLimiter is a rate limiter that only counts the bytes it paces.
+type countingLimiter struct {
+	bytes atomic.Int64
+}
+
+func (l *countingLimiter) Wait(n int) {
+	l.bytes.Add(int64(n))
+}
+
+func TestSharedSchedulerAndRateLimiter(t *testing.T) {
+	env := db.NewEnv()
+	env.Scheduler.Close()
+	env.Scheduler = db.NewScheduler(1, 1)
+	limiter := &countingLimiter{}
+	env.RateLimiter = limiter
+	defer env.Close()
+
+	// Both instances flush on the one worker and write against one budget
+	var dbs []*db.DB
+	for range 2 {
+		d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2), db.WithEnv(env))
+		require.NoError(t, err)
+		dbs = append(dbs, d)
+	}
+	for i, d := range dbs {
+		before := limiter.bytes.Load()
+		for j := range 10 {
+			require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", j)), []byte(fmt.Sprintf("db%d", i))))
+		}
+		d.WaitForCompactions()
+		require.NotZero(t, d.Stats().Flushes)
+		require.Greater(t, limiter.bytes.Load(), before)
+	}
+
+	// Closing one instance leaves the pool to the other
+	require.NoError(t, dbs[0].Close())
+	flushes := dbs[1].Stats().Flushes
+	for j := range 10 {
+		require.NoError(t, dbs[1].Put([]byte(fmt.Sprintf("more%d", j)), []byte("v")))
+	}
+	dbs[1].WaitForCompactions()
+	require.Greater(t, dbs[1].Stats().Flushes, flushes)
+	require.NoError(t, dbs[1].Close())
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+)
+
+// EventListener is told about flushes, compactions, WAL rotations and the
+// table files they create and delete, so applications can hook in metrics,
+// alerting or their own retention logic. Callbacks run on the goroutine
+// doing the work, some with the database's locks held: they must return
+// quickly and must not call back into the DB.
+type EventListener interface {
+	// OnFlushBegin is called before a memtable is written to L0.
+	OnFlushBegin(FlushInfo)
+	// OnFlushCompleted is called once the flushed table is committed.
+	OnFlushCompleted(FlushInfo)
+	// OnCompactionCompleted is called once a compaction's outputs replace
+	// its inputs. The inputs may stay on disk until no reader needs them.
+	OnCompactionCompleted(CompactionInfo)
+	// OnWALRotated is called when writes move to a new WAL.
+	OnWALRotated(WALRotationInfo)
+	// OnTableFileCreated is called when a table file is committed to the
+	// manifest by a flush, compaction, bulk load or ingest.
+	OnTableFileCreated(TableFileInfo)
+	// OnTableFileDeleted is called after a table file is removed.
+	OnTableFileDeleted(TableFileInfo)
+}
+
+// BaseEventListener implements every EventListener callback as a no-op.
+// Embed it to implement only some.
+type BaseEventListener struct{}
+
+var _ EventListener = BaseEventListener{}
+
+func (BaseEventListener) OnFlushBegin(FlushInfo)               {}
+func (BaseEventListener) OnFlushCompleted(FlushInfo)           {}
+func (BaseEventListener) OnCompactionCompleted(CompactionInfo) {}
+func (BaseEventListener) OnWALRotated(WALRotationInfo)         {}
+func (BaseEventListener) OnTableFileCreated(TableFileInfo)     {}
+func (BaseEventListener) OnTableFileDeleted(TableFileInfo)     {}
+
+// FlushInfo describes a flush of one memtable.
+type FlushInfo struct {
+	WAL     common.FileNo // the WAL holding the memtable's writes
+	Entries int           // entries in the memtable
+
+	// Table and Duration are only set on completion.
+	Table    TableFileInfo
+	Duration time.Duration
+}
+
+// CompactionInfo describes a completed compaction of tables from Level
+// into OutputLevel.
+type CompactionInfo struct {
+	Level       int
+	OutputLevel int
+	Inputs      []TableFileInfo
+	Outputs     []TableFileInfo
+	Duration    time.Duration
+}
+
+// WALRotationInfo describes the move of writes from one WAL to the next.
+type WALRotationInfo struct {
+	OldFileNo common.FileNo
+	NewFileNo common.FileNo
+}
+
+// TableFileInfo identifies a table file.
+type TableFileInfo struct {
+	Level  int
+	FileNo common.FileNo
+	Path   string
+	Size   uint64
+}
+
+// tableFileInfo returns the TableFileInfo of the table fm describes.
+func (d *DB) tableFileInfo(level int, fm manifest.FileMetadata) TableFileInfo {
+	return TableFileInfo{
+		Level:  level,
+		FileNo: fm.FileNo,
+		Path:   d.paths.SSTablePath(level, fm.FileNo),
+		Size:   fm.Size,
+	}
+}
+
+// tableFileInfos returns the TableFileInfo of each of files, all in level.
+func (d *DB) tableFileInfos(level int, files []manifest.FileMetadata) []TableFileInfo {
+	infos := make([]TableFileInfo, len(files))
+	for i, fm := range files {
+		infos[i] = d.tableFileInfo(level, fm)
+	}
+	return infos
+}
+
+// notifyTablesCreated tells the event listeners about the tables edit adds.
+func (d *DB) notifyTablesCreated(edit *manifest.CompactionEdit) {
+	if len(d.Opts.EventListeners) == 0 {
+		return
+	}
+	for level, files := range edit.AddSSTables {
+		for _, fm := range files {
+			info := d.tableFileInfo(level, fm)
+			for _, l := range d.Opts.EventListeners {
+				l.OnTableFileCreated(info)
+			}
+		}
+	}
+}
+
+// notifyTableDeleted tells the event listeners that a table file was
+// removed. The manifest calls it, sometimes with its lock held.
+func (d *DB) notifyTableDeleted(level int, fileNo common.FileNo, size int64) {
+	info := TableFileInfo{
+		Level:  level,
+		FileNo: fileNo,
+		Path:   d.paths.SSTablePath(level, fileNo),
+		Size:   uint64(size),
+	}
+	for _, l := range d.Opts.EventListeners {
+		l.OnTableFileDeleted(info)
+	}
+}
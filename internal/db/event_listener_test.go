@@ -0,0 +1,131 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingListener records the events it is told about.
+type recordingListener struct {
+	db.BaseEventListener
+
+	mu           sync.Mutex
+	flushBegins  []db.FlushInfo
+	flushes      []db.FlushInfo
+	compactions  []db.CompactionInfo
+	rotations    []db.WALRotationInfo
+	created      map[common.FileNo]db.TableFileInfo
+	deleted      map[common.FileNo]db.TableFileInfo
+	deletedFiles int
+}
+
+func newRecordingListener() *recordingListener {
+	return &recordingListener{
+		created: make(map[common.FileNo]db.TableFileInfo),
+		deleted: make(map[common.FileNo]db.TableFileInfo),
+	}
+}
+
+func (l *recordingListener) OnFlushBegin(info db.FlushInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushBegins = append(l.flushBegins, info)
+}
+
+func (l *recordingListener) OnFlushCompleted(info db.FlushInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushes = append(l.flushes, info)
+}
+
+func (l *recordingListener) OnCompactionCompleted(info db.CompactionInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.compactions = append(l.compactions, info)
+}
+
+func (l *recordingListener) OnWALRotated(info db.WALRotationInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotations = append(l.rotations, info)
+}
+
+func (l *recordingListener) OnTableFileCreated(info db.TableFileInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.created[info.FileNo] = info
+}
+
+func (l *recordingListener) OnTableFileDeleted(info db.TableFileInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deleted[info.FileNo] = info
+	l.deletedFiles++
+}
+
+func TestEventListener(t *testing.T) {
+	l := newRecordingListener()
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(10), db.WithEventListener(l))
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := range 100 {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("v")))
+	}
+	require.NoError(t, d.Compact())
+	d.WaitForCompactions()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Every flush is reported before and after, and rotated the WAL it read
+	require.NotEmpty(t, l.flushes)
+	require.Len(t, l.flushBegins, len(l.flushes))
+	require.Len(t, l.rotations, len(l.flushes))
+	for i, flush := range l.flushes {
+		require.Equal(t, l.flushBegins[i].WAL, flush.WAL)
+		require.Equal(t, l.rotations[i].OldFileNo, flush.WAL)
+		require.Greater(t, l.rotations[i].NewFileNo, flush.WAL)
+		require.Equal(t, 10, flush.Entries)
+		require.Equal(t, 0, flush.Table.Level)
+		require.Equal(t, l.created[flush.Table.FileNo], flush.Table)
+	}
+
+	// Compactions report the tables they replaced, which are then deleted
+	require.NotEmpty(t, l.compactions)
+	for _, c := range l.compactions {
+		require.Equal(t, c.Level+1, c.OutputLevel)
+		require.NotEmpty(t, c.Inputs)
+		for _, in := range c.Inputs {
+			require.Equal(t, in, l.deleted[in.FileNo])
+			require.NoFileExists(t, in.Path)
+		}
+		for _, out := range c.Outputs {
+			require.Equal(t, l.created[out.FileNo], out)
+		}
+	}
+	require.Len(t, l.deleted, l.deletedFiles)
+
+	// What's left is exactly the tables created and not deleted
+	stats := d.Stats()
+	live := make([]db.LevelStats, len(stats.Levels))
+	for fileNo, info := range l.created {
+		if _, ok := l.deleted[fileNo]; ok {
+			continue
+		}
+		stat, err := os.Stat(info.Path)
+		require.NoError(t, err)
+		require.Equal(t, info.Size, uint64(stat.Size()))
+		live[info.Level].Files++
+		live[info.Level].Bytes += info.Size
+	}
+	require.Equal(t, stats.Levels, live)
+	require.EqualValues(t, len(l.flushes), stats.Flushes)
+	require.EqualValues(t, len(l.compactions), stats.Compactions)
+}
@@ -0,0 +1,17 @@
+package db
+
+import "amethyst/internal/export"
+
+// Export streams every live key/value pair into w in key order, then closes
+// w. It returns the number of pairs written. The version being read stays
+// pinned throughout, so writes and compactions carry on meanwhile. Blocks are
+// read without filling the block cache.
+func (d *DB) Export(w export.Writer) (int, error) {
+	iter, err := d.newMergedIterator(ReadOptions{VerifyChecksums: true}, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	return export.Export(&liveIterator{Iterator: iter}, w)
+}
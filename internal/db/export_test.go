@@ -0,0 +1,27 @@
+package db_test
+
+import (
+	"bytes"
+	"testing"
+
+	"amethyst/internal/db"
+	"amethyst/internal/export"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSkipsTombstones(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+	require.NoError(t, d.Put([]byte("b"), []byte("2")))
+	require.NoError(t, d.Put([]byte("c"), []byte("3")))
+	require.NoError(t, d.Delete([]byte("b")))
+
+	var buf bytes.Buffer
+	n, err := d.Export(export.NewCSVWriter(&buf))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, "key,value,seq,type\na,1,1,put\nc,3,3,put\n", buf.String())
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/vfs"
+)
+
+// DisableFileDeletions stops the database from removing SSTables, blob files,
+// and WALs that flushes and compactions make obsolete, so an external backup
+// can copy the directory while every file the MANIFEST references stays in
+// place. Writes and compactions carry on; their inputs just stay on disk.
+// Calls nest, and deletions resume once each has been matched by
+// EnableFileDeletions.
+func (d *DB) DisableFileDeletions() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.manifest.DisableFileDeletions()
+}
+
+// EnableFileDeletions undoes one DisableFileDeletions. When it undoes the
+// last, the files held back are removed.
+func (d *DB) EnableFileDeletions() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.manifest.EnableFileDeletions()
+	if d.Opts.ReadOnly {
+		return nil
+	}
+	d.deleteObsoleteWALs()
+	return d.deleteObsoleteBlobFiles()
+}
+
+// deleteObsoleteWALs removes the WALs older than the oldest live one, or
+// sets them aside for reuse. Their writes are all in tables the persisted
+// manifest lists, so recovery no longer reads them. Nothing is removed while deletions are disabled.
+// Must be called with d.mu held.
+func (d *DB) deleteObsoleteWALs() {
+	if d.manifest.FileDeletionsDisabled() {
+		return
+	}
+	oldest := d.manifest.Current().CurrentWAL
+	entries, err := d.fs.ReadDir(d.paths.WALDir())
+	if err != nil {
+		d.logger("wal").Log(common.LevelError, "failed to list WALs", "err", err)
+		return
+	}
+	for _, entry := range entries {
+		n, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".log"), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".log") || common.FileNo(n) >= oldest {
+			continue
+		}
+		if err := d.retireWAL(common.FileNo(n)); err != nil {
+			d.logger("wal").Log(common.LevelError, "failed to retire WAL", "wal", n, "err", err)
+		}
+	}
+}
+
+// removeOrphanTables removes tables that the manifest doesn't list at their
+// level: outputs of flushes and compactions interrupted before their commit,
+// and inputs whose deletion was still pending when the process stopped.
+func removeOrphanTables(fsys vfs.FS, paths *common.PathManager, v *manifest.Version) error {
+	for level, fileMetas := range v.Levels {
+		dir := filepath.Dir(paths.SSTablePath(level, 0))
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			n, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".sst"), 10, 64)
+			if err != nil || !strings.HasSuffix(entry.Name(), ".sst") {
+				continue
+			}
+			if slices.ContainsFunc(fileMetas, func(fm manifest.FileMetadata) bool { return fm.FileNo == common.FileNo(n) }) {
+				continue
+			}
+			if err := fsys.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// listFiles returns the paths of every table and blob file under dir.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); ext == ".sst" || ext == ".blob" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestDisableFileDeletions(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(10),
+		db.WithBlobThreshold(8),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	write := func(gen string) {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(gen+"-value")))
+		}
+		require.NoError(t, d.Compact())
+	}
+
+	write("a")
+	backup := listFiles(t, dir)
+	require.NotEmpty(t, backup)
+
+	// Nested disables: files survive until the last matching enable
+	d.DisableFileDeletions()
+	d.DisableFileDeletions()
+	write("b")
+	require.NoError(t, d.EnableFileDeletions())
+	for _, path := range backup {
+		require.FileExists(t, path)
+	}
+
+	require.NoError(t, d.EnableFileDeletions())
+	for _, path := range backup {
+		require.NoFileExists(t, path)
+	}
+
+	value, err := d.Get([]byte("key005"))
+	require.NoError(t, err)
+	require.Equal(t, "b-value", string(value))
+}
+
+func TestObsoleteWALsDeleted(t *testing.T) {
+	tests := []struct {
+		name          string
+		disable       bool
+		wantRemaining int
+	}{
+		{"flushed WALs are deleted", false, 1},
+		{"disabled deletions keep every WAL", true, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(2))
+			require.NoError(t, err)
+			defer d.Close()
+			if tt.disable {
+				d.DisableFileDeletions()
+			}
+
+			// Each pair of writes fills a memtable, which the next write
+			// rotates out along with its WAL
+			for i := 0; i < 9; i++ {
+				require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+			}
+			d.WaitForCompactions()
+
+			logs, err := filepath.Glob(filepath.Join(dir, "wal", "*.log"))
+			require.NoError(t, err)
+			require.Len(t, logs, tt.wantRemaining)
+
+			if tt.disable {
+				require.NoError(t, d.EnableFileDeletions())
+				logs, err = filepath.Glob(filepath.Join(dir, "wal", "*.log"))
+				require.NoError(t, err)
+				require.Len(t, logs, 1)
+			}
+		})
+	}
+}
+
+func TestOrphanTablesRemovedOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+	live := listFiles(t, dir)
+	require.NoError(t, d.Close())
+
+	// A table the manifest never recorded, as left by a crash mid-commit
+	orphan := filepath.Join(dir, "sstable", "0", "99.sst")
+	require.NoError(t, os.WriteFile(orphan, []byte("orphan"), 0644))
+
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoFileExists(t, orphan)
+	require.Equal(t, live, listFiles(t, dir))
+}
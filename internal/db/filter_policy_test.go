@@ -0,0 +1,46 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"amethyst/internal/filter"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterPolicyChangeKeepsTablesReadable(t *testing.T) {
+	dir := t.TempDir()
+	policies := []filter.Policy{filter.NewRibbonPolicy(8), filter.None, filter.NewBloomPolicy(12), nil}
+
+	// Each reopen writes a new table with a different filter
+	for i, policy := range policies {
+		d, err := db.Open(
+			db.WithDBPath(dir),
+			db.WithMemtableFlushThreshold(10),
+			db.WithFilterPolicy(policy),
+		)
+		require.NoError(t, err)
+		for j := 0; j < 10; j++ {
+			key := fmt.Sprintf("key%d-%02d", i, j)
+			require.NoError(t, d.Put([]byte(key), []byte("value of "+key)))
+		}
+		require.NoError(t, d.Close())
+	}
+
+	d, err := db.Open(db.WithDBPath(dir), db.WithFilterPolicy(filter.NewRibbonPolicy(10)))
+	require.NoError(t, err)
+	defer d.Close()
+	require.Empty(t, d.VerifyChecksums())
+	for i := range policies {
+		for j := 0; j < 10; j++ {
+			key := fmt.Sprintf("key%d-%02d", i, j)
+			value, err := d.Get([]byte(key))
+			require.NoError(t, err)
+			require.Equal(t, "value of "+key, string(value))
+		}
+		_, err := d.Get([]byte(fmt.Sprintf("key%d-absent", i)))
+		require.True(t, errors.Is(err, db.ErrNotFound))
+	}
+}
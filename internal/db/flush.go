@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/memtable"
+	"amethyst/internal/scheduler"
+)
+
+// immutableMemtable is a full memtable waiting to be flushed, along with the
+// WAL holding its writes, which stays live until the flush commits.
+type immutableMemtable struct {
+	memtable memtable.Memtable
+	walNum   common.FileNo
+}
+
+// rotateMemtable moves the memtable, if it holds anything, onto the
+// immutable queue and starts a fresh memtable and WAL. The new WAL is made
+// live in the manifest before any write reaches it, so recovery replays it.
+// Must be called with d.mu held.
+func (d *DB) rotateMemtable() error {
+	if d.memtable.Len() == 0 {
+		return nil
+	}
+
+	// Unsynced writes in the old WAL must not be lost while later ones in
+	// the new WAL survive
+	if err := d.wal.Sync(); err != nil {
+		return err
+	}
+
+	walNum := d.manifest.NewWALNumber()
+	newWAL, err := d.createWAL(walNum)
+	if err != nil {
+		return err
+	}
+	if err := d.manifest.Flush(); err != nil {
+		newWAL.Close()
+		return err
+	}
+
+	d.wal.Close()
+	d.immutable = append(d.immutable, &immutableMemtable{memtable: d.memtable, walNum: d.walNum})
+	info := WALRotationInfo{OldFileNo: d.walNum, NewFileNo: walNum}
+	d.wal, d.walNum = newWAL, walNum
+	d.memtable = d.newMemtable()
+	d.publishMemtables()
+	for _, l := range d.Opts.EventListeners {
+		l.OnWALRotated(info)
+	}
+	return nil
+}
+
+// scheduleFlush starts a background job draining the immutable queue unless
+// one is already running or there is nothing to flush.
+// Must be called with d.mu held.
+func (d *DB) scheduleFlush() {
+	if d.flushing || len(d.immutable) == 0 {
+		return
+	}
+	if err := d.scheduler.Schedule(scheduler.JobFlush, d.flushImmutables); err != nil {
+		if err != scheduler.ErrClosed {
+			d.logger("flush").Log(common.LevelError, "failed to schedule flush", "err", err)
+		}
+		return
+	}
+	d.flushing = true
+}
+
+// flushImmutables flushes queued memtables to L0, oldest first, until the
+// queue is empty. Only one runs at a time, so L0 receives tables in the
+// order their writes were committed. Each table is written without holding
+// d.mu; reads keep consulting the memtable until the table replaces it.
+func (d *DB) flushImmutables(ctx context.Context) error {
+	for {
+		d.mu.Lock()
+		if len(d.immutable) == 0 || ctx.Err() != nil {
+			d.flushing = false
+			d.flushed.Broadcast()
+			d.mu.Unlock()
+			return ctx.Err()
+		}
+		imm := d.immutable[0]
+		d.mu.Unlock()
+
+		info := FlushInfo{WAL: imm.walNum, Entries: imm.memtable.Len()}
+		for _, l := range d.Opts.EventListeners {
+			l.OnFlushBegin(info)
+		}
+
+		start := time.Now()
+		edit, err := d.writeSSTable(imm.memtable)
+
+		d.mu.Lock()
+		if err == nil {
+			d.manifest.Apply(edit)
+			d.immutable = d.immutable[1:]
+			d.publishMemtables()
+			d.manifest.SetWAL(d.oldestLiveWAL())
+			err = d.manifest.Flush()
+		}
+		if err != nil {
+			d.flushing = false
+			d.flushErr = err
+			d.flushed.Broadcast()
+			d.mu.Unlock()
+			return err
+		}
+
+		fm := edit.AddSSTables[0][0]
+		if d.tuner != nil {
+			d.tuner.writtenBytes += int64(fm.Size)
+		}
+		d.flushes.Add(1)
+		d.deleteObsoleteWALs()
+		d.reportWriteBuffer()
+		d.recordShape("flush")
+		d.flushed.Broadcast()
+		d.scheduleCompaction()
+		d.mu.Unlock()
+
+		d.notifyTablesCreated(edit)
+		info.Table, info.Duration = d.tableFileInfo(0, fm), time.Since(start)
+		for _, l := range d.Opts.EventListeners {
+			l.OnFlushCompleted(info)
+		}
+		d.logger("flush").Log(common.LevelInfo, "flushed memtable", "entries", fm.Entries, "file", fm.FileNo, "duration", info.Duration)
+	}
+}
+
+// oldestLiveWAL returns the oldest WAL holding writes not yet in a table.
+// Must be called with d.mu held.
+func (d *DB) oldestLiveWAL() common.FileNo {
+	if len(d.immutable) > 0 {
+		return d.immutable[0].walNum
+	}
+	return d.walNum
+}
+
+// waitForFlushes blocks until at most n memtables are waiting to be flushed,
+// starting a flush job if none is running. Returns the error of a flush
+// that fails meanwhile, or ErrClosed once the database is closing, since
+// the memtables still queued then are left for the WAL replay on open.
+// Must be called with d.mu held.
+func (d *DB) waitForFlushes(n int) error {
+	for len(d.immutable) > n {
+		select {
+		case <-d.closeCh:
+			return ErrClosed
+		default:
+		}
+		d.flushErr = nil
+		d.scheduleFlush()
+		d.flushed.Wait()
+		if d.flushErr != nil {
+			return d.flushErr
+		}
+	}
+	return nil
+}
+
+// flushMemtable flushes the memtable and every memtable queued before it,
+// returning once they are all in L0.
+// Must be called with d.mu held.
+func (d *DB) flushMemtable() error {
+	if err := d.rotateMemtable(); err != nil {
+		return err
+	}
+	return d.waitForFlushes(0)
+}
+
+// memtableSize returns the bytes held by the memtable and the queue.
+// Must be called with d.mu held.
+func (d *DB) memtableSize() int {
+	size := d.memtable.Size()
+	for _, imm := range d.immutable {
+		size += imm.memtable.Size()
+	}
+	return size
+}
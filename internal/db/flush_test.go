@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+var errFlushBlocked = errors.New("flush blocked")
+
+// gatedFS holds every table creation until release is closed, then fails it.
+type gatedFS struct {
+	vfs.FS
+	release chan struct{}
+}
+
+func (g gatedFS) wait(name string) error {
+	if strings.HasSuffix(name, ".sst.tmp") {
+		<-g.release
+		return errFlushBlocked
+	}
+	return nil
+}
+
+func (g gatedFS) Create(name string) (vfs.File, error) {
+	if err := g.wait(name); err != nil {
+		return nil, err
+	}
+	return g.FS.Create(name)
+}
+
+func (g gatedFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	if err := g.wait(name); err != nil {
+		return nil, err
+	}
+	return g.FS.OpenFile(name, flag, perm)
+}
+
+func TestWritesContinueDuringFlush(t *testing.T) {
+	memFS := vfs.NewMemFS()
+	fsys := gatedFS{FS: memFS, release: make(chan struct{})}
+	path := filepath.Join(t.TempDir(), "db")
+
+	d, err := db.Open(
+		db.WithDBPath(path),
+		db.WithMemtableFlushThreshold(2),
+		db.WithMaxImmutableMemtables(2),
+		db.WithEnv(db.NewEnvWithFS(fsys)),
+	)
+	require.NoError(t, err)
+
+	// The first flush never finishes, yet two full memtables fit in the queue
+	for i := 0; i < 6; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	for i := 0; i < 6; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+	}
+	require.Empty(t, d.Manifest().Current().Levels[0])
+	require.Len(t, d.Manifest().Current().LiveWALs(), 3)
+
+	close(fsys.release)
+	d.WaitForCompactions()
+	require.NoError(t, d.Close())
+
+	// Every live WAL is replayed, so nothing queued is lost
+	d, err = db.Open(db.WithDBPath(path), db.WithEnv(db.NewEnvWithFS(memFS)))
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 6; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+	}
+	require.Len(t, d.Manifest().Current().LiveWALs(), 1)
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+)
+
+// IngestSSTable adds the SSTable at path, built outside the database, as if
+// all of its entries had been written in one batch just now: they supersede
+// every earlier write to their keys and are superseded by every later one.
+//
+// The table is read through the database's filesystem and checked before
+// anything changes: its blocks must pass their checksums and its keys must
+// be strictly increasing puts and deletes. It is then rewritten under a new
+// file number with every entry stamped with a single fresh sequence number,
+// and added with one manifest edit to the deepest level where no table
+// overlaps it, so it skips the WAL, the memtable, and the compactions above
+// that level. The file at path is left in place.
+func (d *DB) IngestSSTable(path string) error {
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+	start := time.Now()
+
+	table, err := sstable.OpenSSTable(d.fs, path, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer table.Close()
+
+	smallest, largest, err := checkIngestTable(table)
+	if err != nil {
+		return fmt.Errorf("failed to ingest %s: %w", path, err)
+	}
+	if smallest == nil {
+		return nil
+	}
+
+	for {
+		level, fm, err := d.ingestTable(table, smallest, largest)
+		if err == errIngestRaced {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		d.logger("ingest").Log(common.LevelInfo, "ingested table", "path", path, "entries", fm.Entries,
+			"level", level, "file", fm.FileNo, "duration", time.Since(start))
+		return nil
+	}
+}
+
+// errIngestRaced is returned by ingestTable when writes newer than the
+// ingest reached a level it can't be placed above.
+var errIngestRaced = errors.New("db: ingest raced with newer writes")
+
+// ingestTable rewrites table, whose keys span [smallest, largest], under a
+// fresh sequence number and file number and commits it, returning the level
+// it joined.
+func (d *DB) ingestTable(table sstable.SSTable, smallest, largest []byte) (int, *manifest.FileMetadata, error) {
+	// Writes already committed to the range must reach a table first, since
+	// reads consult the memtable before any table. Later ones get higher
+	// sequence numbers and rightly shadow the ingested entries from there.
+	d.mu.Lock()
+	for {
+		// Flushes stop once the DB is closing, so the range never drains
+		select {
+		case <-d.closeCh:
+			d.mu.Unlock()
+			return 0, nil, ErrClosed
+		default:
+		}
+		key, err := d.memtableKeyInRange(smallest, largest)
+		if err == nil && key != nil {
+			err = d.flushMemtable()
+		}
+		if err != nil {
+			d.mu.Unlock()
+			return 0, nil, err
+		}
+		if key == nil {
+			break
+		}
+	}
+	d.nextSeq++
+	seq := d.nextSeq
+	d.manifest.SetLastSeq(seq)
+	d.mu.Unlock()
+
+	fileNo := d.manifest.NewSSTableNumber()
+	source := &ingestIterator{source: table.IteratorWithOptions(sstable.ReadOptions{VerifyChecksums: true}), seq: seq}
+	rangeDels := make(common.RangeTombstones, 0, len(table.RangeTombstones()))
+	for _, t := range table.RangeTombstones() {
+		t := *t
+		t.Seq = seq
+		rangeDels = append(rangeDels, &t)
+	}
+	blobs := d.newBlobSeparator(source, nil)
+	committed := false
+	defer func() {
+		if !committed {
+			blobs.abort()
+		}
+	}()
+
+	// Written as L0 and moved once the level is chosen
+	fm, _, err := d.buildTable(0, fileNo, blobs, rangeDels, table.Len())
+	if err != nil {
+		return 0, nil, err
+	}
+	fm.BlobFiles = blobs.takeRefs()
+	blobFiles, err := blobs.finish()
+	if err != nil {
+		d.fs.Remove(d.paths.SSTablePath(0, fileNo))
+		return 0, nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	level, ok := d.ingestLevel(seq, fm.SmallestKey, fm.LargestKey)
+	if !ok {
+		d.fs.Remove(d.paths.SSTablePath(0, fileNo))
+		return 0, nil, errIngestRaced
+	}
+	if level > 0 {
+		path := d.paths.SSTablePath(level, fileNo)
+		if err := d.fs.Rename(d.paths.SSTablePath(0, fileNo), path); err != nil {
+			d.fs.Remove(d.paths.SSTablePath(0, fileNo))
+			return 0, nil, err
+		}
+		if err := vfs.SyncDir(d.fs, filepath.Dir(path)); err != nil {
+			d.fs.Remove(path)
+			return 0, nil, err
+		}
+	}
+
+	edit := &manifest.CompactionEdit{
+		AddSSTables:  map[int][]manifest.FileMetadata{level: {*fm}},
+		AddBlobFiles: blobFiles,
+	}
+	d.manifest.Apply(edit)
+	committed = true
+	if err := d.manifest.Flush(); err != nil {
+		return 0, nil, err
+	}
+	d.notifyTablesCreated(edit)
+
+	d.recordShape("ingest")
+	d.scheduleCompaction()
+	return level, fm, nil
+}
+
+// checkIngestTable reads every entry of table, failing unless they are
+// strictly increasing puts and deletes, and returns the key range they and
+// the range tombstones span, or nil bounds for an empty table.
+func checkIngestTable(table sstable.SSTable) (smallest, largest []byte, err error) {
+	iter := &ingestIterator{source: table.IteratorWithOptions(sstable.ReadOptions{VerifyChecksums: true})}
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if smallest == nil {
+			smallest = bytes.Clone(entry.Key)
+		}
+		largest = bytes.Clone(entry.Key)
+	}
+
+	for _, t := range table.RangeTombstones() {
+		if bytes.Compare(t.Key, t.Value) >= 0 {
+			return nil, nil, fmt.Errorf("empty range tombstone [%q, %q)", t.Key, t.Value)
+		}
+		if smallest == nil || bytes.Compare(t.Key, smallest) < 0 {
+			smallest = t.Key
+		}
+		if largest == nil || bytes.Compare(t.Value, largest) > 0 {
+			largest = t.Value
+		}
+	}
+	return smallest, largest, nil
+}
+
+// ingestLevel returns the deepest level a table holding sequence number seq
+// and spanning [smallest, largest] can join: above the first level holding
+// an overlapping table, which holds older versions of its keys, and above
+// any level a running compaction is writing to, whose output could overlap
+// it. Since L0 is kept in sequence order, the table can sit below newer
+// overlapping L0 tables, but not below newer data anywhere else; it reports
+// false if there is some.
+// Must be called with d.mu held.
+func (d *DB) ingestLevel(seq uint64, smallest, largest []byte) (int, bool) {
+	target, placed := 0, false
+	for level, fileMetas := range d.manifest.Current().Levels {
+		if level > 0 && d.levelCompactions[level-1] > 0 {
+			placed = true
+		}
+		for _, fm := range fileMetas {
+			if bytes.Compare(fm.SmallestKey, largest) > 0 || bytes.Compare(fm.LargestKey, smallest) < 0 {
+				continue
+			}
+			if _, compacting := d.compacting[fm.FileNo]; fm.MaxSeq > seq && (level > 0 || compacting) {
+				return 0, false
+			}
+			placed = true
+		}
+		if !placed {
+			target = level
+		}
+	}
+	return target, true
+}
+
+// ingestIterator checks that ingested entries are strictly increasing puts
+// and deletes and stamps them with the ingest's sequence number.
+type ingestIterator struct {
+	source  common.EntryIterator
+	seq     uint64
+	lastKey []byte
+}
+
+func (it *ingestIterator) Next() (*common.Entry, error) {
+	entry, err := it.source.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if entry.Type != common.EntryTypePut && entry.Type != common.EntryTypeDelete {
+		return nil, fmt.Errorf("ingest: %q is neither a put nor a delete", entry.Key)
+	}
+	if it.lastKey != nil && bytes.Compare(entry.Key, it.lastKey) <= 0 {
+		return nil, fmt.Errorf("ingest: key %q does not follow %q", entry.Key, it.lastKey)
+	}
+	it.lastKey = bytes.Clone(entry.Key)
+
+	stamped := *entry
+	stamped.Seq = it.seq
+	return &stamped, nil
+}
@@ -0,0 +1,164 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/sstable"
+	"github.com/stretchr/testify/require"
+)
+
+// writeExternalTable writes entries and rangeDels to a new SSTable outside
+// any database and returns its path.
+func writeExternalTable(t *testing.T, entries []*common.Entry, rangeDels common.RangeTombstones) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "external.sst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = sstable.WriteSSTable(f, &sliceIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, rangeDels)
+	require.NoError(t, err)
+	return path
+}
+
+func TestIngestSSTable(t *testing.T) {
+	path := t.TempDir()
+	d, err := db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(8))
+	require.NoError(t, err)
+	defer func() { d.Close() }()
+
+	want := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		require.NoError(t, d.Put([]byte(key), []byte("old")))
+		want[key] = "old"
+	}
+	require.NoError(t, d.DeleteRange([]byte("key10"), []byte("key20")))
+	require.NoError(t, d.Compact())
+	require.NoError(t, d.Put([]byte("key03"), []byte("mem")))
+
+	external := writeExternalTable(t, []*common.Entry{
+		{Type: common.EntryTypePut, Key: []byte("key03"), Value: []byte("ingested")},
+		{Type: common.EntryTypePut, Key: []byte("key05"), Value: []byte("ingested")},
+		{Type: common.EntryTypeDelete, Key: []byte("key07")},
+		{Type: common.EntryTypePut, Key: []byte("key12"), Value: []byte("ingested")},
+	}, common.RangeTombstones{
+		{Type: common.EntryTypeRangeDelete, Key: []byte("key08"), Value: []byte("key10")},
+	})
+	require.NoError(t, d.IngestSSTable(external))
+
+	// Ingested entries supersede the memtable, older tables, and the older
+	// range tombstone, including the ingested table's own
+	want["key03"] = "ingested"
+	want["key05"] = "ingested"
+	want["key12"] = "ingested"
+	delete(want, "key07")
+	delete(want, "key08")
+	delete(want, "key09")
+	requireContents(t, d, want)
+
+	// Later writes supersede ingested entries
+	require.NoError(t, d.Put([]byte("key05"), []byte("new")))
+	want["key05"] = "new"
+	requireContents(t, d, want)
+
+	// A table overlapping nothing goes straight to the last level
+	external = writeExternalTable(t, []*common.Entry{
+		{Type: common.EntryTypePut, Key: []byte("key25"), Value: []byte("ingested")},
+	}, nil)
+	require.NoError(t, d.IngestSSTable(external))
+	want["key25"] = "ingested"
+	levels := d.Manifest().Current().Levels
+	last := levels[len(levels)-1]
+	require.Equal(t, []byte("key25"), last[len(last)-1].SmallestKey)
+	requireContents(t, d, want)
+
+	require.NoError(t, d.Close())
+	d, err = db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(8))
+	require.NoError(t, err)
+	requireContents(t, d, want)
+
+	require.NoError(t, d.Compact())
+	requireContents(t, d, want)
+	require.Empty(t, d.VerifyChecksums())
+}
+
+func TestIngestSSTableInvalid(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.Put([]byte("key00"), []byte("v")))
+
+	tests := []struct {
+		name    string
+		entries []*common.Entry
+	}{
+		{"unsorted keys", []*common.Entry{
+			{Type: common.EntryTypePut, Key: []byte("key02"), Value: []byte("v")},
+			{Type: common.EntryTypePut, Key: []byte("key01"), Value: []byte("v")},
+		}},
+		{"duplicate keys", []*common.Entry{
+			{Type: common.EntryTypePut, Key: []byte("key01"), Value: []byte("v")},
+			{Type: common.EntryTypePut, Key: []byte("key01"), Value: []byte("v")},
+		}},
+		{"blob reference", []*common.Entry{
+			{Type: common.EntryTypeBlobRef, Key: []byte("key01"), Value: []byte("ref")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, d.IngestSSTable(writeExternalTable(t, tt.entries, nil)))
+			requireContents(t, d, map[string]string{"key00": "v"})
+		})
+	}
+
+	require.Error(t, d.IngestSSTable(filepath.Join(t.TempDir(), "missing.sst")))
+}
+
+// blockingFlushListener holds up the first flush until release is closed.
+type blockingFlushListener struct {
+	db.BaseEventListener
+	once    sync.Once
+	begun   chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingFlushListener) OnFlushBegin(db.FlushInfo) {
+	l.once.Do(func() {
+		close(l.begun)
+		<-l.release
+	})
+}
+
+func TestIngestSSTableDuringClose(t *testing.T) {
+	l := &blockingFlushListener{begun: make(chan struct{}), release: make(chan struct{})}
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithEventListener(l))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("key01"), []byte("v")))
+
+	// The ingest waits for the memtable holding its range to be flushed,
+	// and Close arrives while it does
+	external := writeExternalTable(t, []*common.Entry{
+		{Type: common.EntryTypePut, Key: []byte("key01"), Value: []byte("ingested")},
+	}, nil)
+	ingestErr := make(chan error, 1)
+	go func() { ingestErr <- d.IngestSSTable(external) }()
+	<-l.begun
+	closeErr := make(chan error, 1)
+	go func() { closeErr <- d.Close() }()
+
+	select {
+	case err := <-ingestErr:
+		require.ErrorIs(t, err, db.ErrClosed)
+	case <-time.After(10 * time.Second):
+		t.Fatal("ingest didn't give up when the DB closed")
+	}
+	close(l.release)
+	require.NoError(t, <-closeErr)
+}
@@ -0,0 +1,46 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemtableBloom(t *testing.T) {
+	for _, bitsPerKey := range []float64{0, 10} {
+		t.Run(fmt.Sprintf("bits=%v", bitsPerKey), func(t *testing.T) {
+			dir := t.TempDir()
+			opts := []db.Option{db.WithDBPath(dir), db.WithMemtableFlushThreshold(20), db.WithMemtableBloomBitsPerKey(bitsPerKey)}
+			d, err := db.Open(opts...)
+			require.NoError(t, err)
+
+			// Enough keys that some sit in flushed tables, some in the
+			// memtable, and the memtable outgrows its filter's sizing
+			for i := range 90 {
+				require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("value")))
+			}
+			require.NoError(t, d.Delete([]byte("key89")))
+			check := func() {
+				for i := range 89 {
+					value, err := d.Get([]byte(fmt.Sprintf("key%02d", i)))
+					require.NoError(t, err, "key%02d", i)
+					require.Equal(t, []byte("value"), value)
+				}
+				for _, key := range []string{"key89", "key90", "other"} {
+					_, err := d.Get([]byte(key))
+					require.ErrorIs(t, err, db.ErrNotFound, key)
+				}
+			}
+			check()
+
+			// Replayed writes are added to the filter too
+			require.NoError(t, d.Close())
+			d, err = db.Open(opts...)
+			require.NoError(t, err)
+			defer d.Close()
+			check()
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMmapReads(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(10),
+		db.WithMmapReads(),
+	)
+	require.NoError(t, err)
+	for i := range 50 {
+		key := fmt.Sprintf("key%02d", i)
+		require.NoError(t, d.Put([]byte(key), []byte("value of "+key)))
+	}
+	require.NoError(t, d.Close())
+
+	// Reopened, the flushed tables are read back through mappings
+	d, err = db.Open(db.WithDBPath(dir), db.WithMmapReads())
+	require.NoError(t, err)
+	defer d.Close()
+	for i := range 50 {
+		key := fmt.Sprintf("key%02d", i)
+		value, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, "value of "+key, string(value))
+	}
+	require.Empty(t, d.VerifyChecksums())
+}
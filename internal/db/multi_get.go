@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+
+	"amethyst/internal/common"
+)
+
+// MultiGet looks up every key under a single version snapshot and returns
+// their values in the order of keys, with nil for keys that aren't found.
+// Keys are sorted and looked up in each table together, so keys sharing a
+// block pay for one block read and one index search per table rather than
+// one per key.
+func (d *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	return d.MultiGetWithOptions(keys, DefaultReadOptions)
+}
+
+// MultiGetWithOptions is like MultiGet but reads as opts specify.
+// Like Get, it doesn't take d.mu.
+func (d *DB) MultiGetWithOptions(keys [][]byte, opts ReadOptions) ([][]byte, error) {
+	d.gets.Add(uint64(len(keys)))
+
+	// pending holds the distinct keys not yet resolved, sorted
+	pending := slices.Clone(keys)
+	slices.SortFunc(pending, bytes.Compare)
+	pending = slices.CompactFunc(pending, bytes.Equal)
+
+	found := make(map[string]*common.Entry, len(pending))
+	mems := d.memtables()
+	for _, mem := range mems {
+		pending = slices.DeleteFunc(pending, func(key []byte) bool {
+			entry, ok := mem.Get(key)
+			if ok {
+				found[string(key)] = entry
+			}
+			return ok
+		})
+	}
+
+	version := d.manifest.Ref()
+	defer d.manifest.Unref(version)
+	for level, fileMetas := range version.Levels {
+		for _, fm := range newestFirst(level, fileMetas) {
+			if len(pending) == 0 {
+				break
+			}
+
+			// Only the pending keys in the table's range can be in it
+			lo, _ := slices.BinarySearchFunc(pending, fm.SmallestKey, bytes.Compare)
+			hi, inRange := slices.BinarySearchFunc(pending, fm.LargestKey, bytes.Compare)
+			if inRange {
+				hi++
+			}
+			if lo == hi {
+				continue
+			}
+
+			table, err := d.manifest.GetTable(fm.FileNo, level)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+			entries, err := table.MultiGet(pending[lo:hi], opts.table())
+			if err != nil {
+				return nil, fmt.Errorf("failed to read from L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+
+			remaining := pending[:lo]
+			for i, key := range pending[lo:hi] {
+				if entries[i] == nil {
+					remaining = append(remaining, key)
+					continue
+				}
+				entry, err := d.resolveBlob(entries[i], ReadAllTier)
+				if err != nil {
+					return nil, err
+				}
+				found[string(key)] = entry
+			}
+			pending = append(remaining, pending[hi:]...)
+		}
+	}
+
+	rangeDels, err := d.rangeTombstones(mems, version, ReadAllTier)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		entry, ok := found[string(key)]
+		if !ok || expired(entry, now) || applyRangeDels(rangeDels, entry).Type == common.EntryTypeDelete {
+			continue
+		}
+		values[i] = append([]byte{}, entry.Value...)
+	}
+	return values, nil
+}
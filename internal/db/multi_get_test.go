@@ -0,0 +1,59 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiGet(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(100),
+		db.WithBlobThreshold(32),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// key000-key098 and a blob value fill one table of two blocks; the next
+	// writes, to the memtable, overwrite or delete some of them
+	for i := 0; i < 99; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	require.NoError(t, d.Put([]byte("large"), make([]byte, 64)))
+	require.NoError(t, d.Put([]byte("key010"), []byte("new")))
+	require.NoError(t, d.Delete([]byte("key020")))
+	d.WaitForCompactions()
+	require.Len(t, d.Manifest().Current().Levels[0], 1)
+
+	tests := []struct {
+		key   string
+		value []byte
+	}{
+		{"key050", []byte("v50")},
+		{"key010", []byte("new")},
+		{"key020", nil},
+		{"missing", nil},
+		{"key001", []byte("v1")},
+		{"key050", []byte("v50")},
+		{"large", make([]byte, 64)},
+	}
+	var keys [][]byte
+	for _, tt := range tests {
+		keys = append(keys, []byte(tt.key))
+	}
+
+	before := d.Stats().BlockCache
+	values, err := d.MultiGet(keys)
+	require.NoError(t, err)
+	for i, tt := range tests {
+		require.Equal(t, tt.value, values[i], tt.key)
+	}
+
+	// The three keys read from the table cost one read per block
+	after := d.Stats().BlockCache
+	require.Equal(t, uint64(2), after.Misses-before.Misses)
+	require.Zero(t, after.Hits-before.Hits)
+}
@@ -1,6 +1,16 @@
 package db
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/compression"
+	"amethyst/internal/filter"
+	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+)
 
 type Options struct {
 	DBPath                 string
@@ -9,6 +19,209 @@ type Options struct {
 	MaxBatchSize           int
 	BatchTimeout           time.Duration
 	BloomFilterFPR         float64
+
+	// MaxWriteQueueDepth is how many writes may wait to be committed; a
+	// write arriving while that many wait fails at once with
+	// ErrWriteStalled. WriteTimeout fails a write with ErrWriteStalled if it
+	// isn't committed within that long, as when flushes stall behind L0. 0
+	// disables either limit.
+	MaxWriteQueueDepth int
+	WriteTimeout       time.Duration
+
+	// FilterPolicy chooses the filter new SSTables build over their keys,
+	// and how many bits per key it spends. Each table records its filter's
+	// type, so tables written under a different policy stay readable. nil
+	// builds bloom filters with a false positive rate of BloomFilterFPR.
+	FilterPolicy filter.Policy
+
+	// PrefixExtractor, if set, defines the key prefixes that prefix-scoped
+	// operations work in. SSTables add each key's prefix to their bloom
+	// filter so lookups by prefix can skip tables that lack it.
+	PrefixExtractor common.PrefixExtractor
+
+	// Compression is the codec SSTable data blocks are compressed with as
+	// they are written. Each block records its codec, so tables written
+	// under a different setting stay readable. nil leaves blocks
+	// uncompressed.
+	Compression compression.Codec
+
+	// MaxImmutableMemtables is how many full memtables may wait to be
+	// flushed in the background before writes stall until one is.
+	MaxImmutableMemtables int
+
+	// MemtableBloomBitsPerKey sizes a bloom filter kept with each memtable
+	// at this many bits per key for MemtableFlushThreshold keys, so reads
+	// of keys a memtable doesn't hold skip searching it. 0 keeps no filter.
+	MemtableBloomBitsPerKey float64
+
+	// L0CompactionTrigger is the number of L0 files that triggers an L0->L1
+	// compaction. Each deeper level Ln (n >= 1) holds up to
+	// L0CompactionTrigger * LevelSizeMultiplier^(n-1) files before it is
+	// compacted into the next level. The last level is unbounded.
+	L0CompactionTrigger int
+	LevelSizeMultiplier int
+
+	// L0StopWritesTrigger holds memtable flushes, and so writes, while L0
+	// has at least this many files, until compaction brings it back under.
+	// It never stalls below the L0 compaction trigger. 0 disables stalls.
+	L0StopWritesTrigger int
+
+	// BytesPerSync syncs SSTable and blob files every this many bytes while
+	// flushes and compactions write them, and WALBytesPerSync does the same
+	// for the WAL within a commit, so the final sync of a large file has
+	// little left to write back. 0 syncs only at the end.
+	BytesPerSync    int64
+	WALBytesPerSync int64
+
+	// WALPreallocateSize, when positive, fills each new WAL with that many
+	// bytes of zeros before writes reach it, so appends overwrite allocated
+	// space instead of growing the file and syncing them needn't commit
+	// allocation metadata. WALRecycleLimit is how many obsolete WALs are set
+	// aside, rather than deleted, to be reused as new ones, which saves
+	// allocating them again. Both cost a write of zeros over the file as each
+	// WAL is started.
+	WALPreallocateSize int64
+	WALRecycleLimit    int
+
+	// ArchiveWALs moves obsolete WALs into the archive directory instead of
+	// deleting or recycling them, so external tools can read the ordered
+	// history of writes; see DB.ArchivedWALs. WALArchiveTTL removes archived
+	// WALs last written longer ago than it, and WALArchiveSizeLimit removes
+	// the oldest while the archive holds more bytes than it. 0 leaves
+	// either unbounded.
+	ArchiveWALs         bool
+	WALArchiveTTL       time.Duration
+	WALArchiveSizeLimit int64
+
+	// ReplicationBacklog keeps at least this many of the latest committed
+	// entries in memory, for replicas to stream with DB.CommitsSince. A
+	// replica that falls further behind must bootstrap from a checkpoint
+	// again. 0 keeps no backlog.
+	ReplicationBacklog int
+
+	// CompactionRateLimit caps the bytes per second that flushes and
+	// compactions write to SSTable and blob files, together, so background
+	// I/O leaves disk bandwidth for foreground reads and WAL writes. 0 is
+	// unlimited. It is ignored with an Env whose RateLimiter is set.
+	CompactionRateLimit int64
+
+	// DirectIOWrites writes the SSTable and blob files of flushes and
+	// compactions with O_DIRECT, so large background writes don't evict the
+	// page cache foreground reads depend on. It has no effect on platforms
+	// and filesystems without direct I/O.
+	DirectIOWrites bool
+
+	// CompactionReadaheadSize is how many bytes at a time compactions read
+	// their input tables, which they scan sequentially; large reads keep
+	// them from being bound by a seek per block. 0 reads block by block.
+	CompactionReadaheadSize int
+
+	// MaxBackgroundJobs sizes the worker pool for background jobs, of which
+	// at most MaxBackgroundCompactions may be compactions at once. Flushes
+	// take priority over compactions for free workers. With an Env whose
+	// Scheduler is set the pool is the Env's, and MaxBackgroundCompactions
+	// only caps this instance's compactions.
+	MaxBackgroundJobs        int
+	MaxBackgroundCompactions int
+
+	// TombstoneCompactionRatio, when positive, compacts any file whose share
+	// of tombstones exceeds it once no level is over its size limit, so space
+	// held by deleted keys is reclaimed without waiting for size triggers.
+	TombstoneCompactionRatio float64
+
+	// BlobThreshold, when positive, moves values of at least this many bytes
+	// out of SSTables into blob files as they are flushed or compacted,
+	// leaving a small reference behind, so compaction rewrites keys without
+	// copying large values. BlobGCCutoff is the oldest share of blob files
+	// whose still-live values compaction relocates, letting those files be
+	// deleted once nothing references them.
+	BlobThreshold int
+	BlobGCCutoff  float64
+
+	// MaxCompactionsPerLevel caps the compactions running out of any single
+	// level, so a burst into one level leaves slots for the others. It must
+	// be at least 1.
+	MaxCompactionsPerLevel int
+
+	// AutoTuneCompaction lets a feedback controller move the L0 compaction
+	// trigger within [MinL0CompactionTrigger, MaxL0CompactionTrigger], and
+	// the compactions run at once within [1, MaxBackgroundCompactions], based
+	// on observed read/write amplification and write stalls. The minimum
+	// trigger must be at least 1.
+	AutoTuneCompaction     bool
+	MinL0CompactionTrigger int
+	MaxL0CompactionTrigger int
+
+	// CheckpointInterval, when non-zero, takes a checkpoint under the
+	// checkpoint/ directory on that schedule, keeping the newest
+	// CheckpointRetention of them, which must be at least 1.
+	CheckpointInterval  time.Duration
+	CheckpointRetention int
+
+	// VerifyTableChecksums checks every SSTable against the checksum recorded
+	// in the manifest when it is first opened, catching bit rot and swapped
+	// files at the cost of reading each table once in full.
+	VerifyTableChecksums bool
+
+	// QuarantineCorruptFiles keeps Open from failing on damaged files: tables
+	// that can't be opened or fail their checksum, and a WAL that can't be
+	// fully replayed, are moved into lost/ and the database opens with what
+	// remains. Every table is read in full on open to find corruption. Ignored
+	// in read-only mode.
+	QuarantineCorruptFiles bool
+
+	// RecordShapeHistory appends the per-level file counts and sizes to the
+	// SHAPE_HISTORY sidecar after every flush and compaction.
+	RecordShapeHistory bool
+
+	// CompactionFilter, if set, can drop entries as compaction rewrites them.
+	CompactionFilter CompactionFilter
+
+	// Logger receives the engine's log records; nil logs to
+	// common.DefaultLogger. Use common.DiscardLogger to silence it.
+	Logger common.Logger
+
+	// EventListeners are told, one after another, about flushes,
+	// compactions, WAL rotations and table file creation and deletion.
+	EventListeners []EventListener
+
+	// ReadOnly opens an existing database without the write pipeline: no
+	// directories or files are created, the WAL is replayed but never
+	// appended to, and writes fail with ErrReadOnly.
+	ReadOnly bool
+
+	// SecondaryCatchUpInterval is how often an instance opened with
+	// OpenSecondary catches up with its primary in the background. 0
+	// leaves catching up to DB.CatchUp.
+	SecondaryCatchUpInterval time.Duration
+
+	// WarnIteratorLeaks logs where each iterator garbage-collected without
+	// Close was opened, then closes it. Capturing the stack makes opening
+	// iterators slower, so it is meant for debugging embedders.
+	WarnIteratorLeaks bool
+
+	// BlockCacheSize caps the memory, in bytes, of the private block cache
+	// created when Env is nil, and MaxOpenFiles the number of tables its
+	// table cache keeps open. A shared Env brings its own caches.
+	BlockCacheSize int64
+	MaxOpenFiles   int
+
+	// BlockCachePolicy chooses which blocks the private block cache evicts.
+	// block_cache.PolicyTinyLFU keeps the working set cached through large
+	// scans and compactions, which flush an LRU cache. Like BlockCacheSize
+	// it is ignored with a shared Env.
+	BlockCachePolicy block_cache.Policy
+
+	// MmapReads memory-maps the SSTables the private table cache opens,
+	// saving a system call and a copy per block read on read-heavy workloads
+	// whose data fits in the page cache. Tables are read through their files
+	// where the platform can't map them. Like BlockCacheSize it is ignored
+	// with a shared Env, whose table cache is configured when it is made.
+	MmapReads bool
+
+	// Env supplies resources shared with other instances. A private Env is
+	// created when nil.
+	Env *Env
 }
 
 var DefaultOptions = Options{
@@ -18,6 +231,25 @@ var DefaultOptions = Options{
 	MaxBatchSize:           50,
 	BatchTimeout:           5 * time.Millisecond,
 	BloomFilterFPR:         0.01,
+	L0CompactionTrigger:    4,
+	LevelSizeMultiplier:    10,
+	L0StopWritesTrigger:    12,
+	MaxImmutableMemtables:  2,
+	BlockCacheSize:         block_cache.DefaultCapacity,
+	MaxOpenFiles:           table_cache.DefaultMaxOpenFiles,
+
+	MemtableBloomBitsPerKey: 10,
+
+	SecondaryCatchUpInterval: 100 * time.Millisecond,
+
+	CompactionReadaheadSize: sstable.DefaultReadaheadSize,
+
+	MaxBackgroundJobs:        2,
+	MaxBackgroundCompactions: 1,
+	MaxCompactionsPerLevel:   1,
+
+	TombstoneCompactionRatio: 0.5,
+	BlobGCCutoff:             0.25,
 }
 
 type Option func(*Options)
@@ -52,8 +284,287 @@ func WithBatchTimeout(d time.Duration) Option {
 	}
 }
 
+func WithMaxWriteQueueDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxWriteQueueDepth = n
+	}
+}
+
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.WriteTimeout = d
+	}
+}
+
 func WithBloomFilterFPR(fpr float64) Option {
 	return func(o *Options) {
 		o.BloomFilterFPR = fpr
 	}
 }
+
+func WithFilterPolicy(p filter.Policy) Option {
+	return func(o *Options) {
+		o.FilterPolicy = p
+	}
+}
+
+func WithPrefixExtractor(p common.PrefixExtractor) Option {
+	return func(o *Options) {
+		o.PrefixExtractor = p
+	}
+}
+
+func WithCompression(c compression.Codec) Option {
+	return func(o *Options) {
+		o.Compression = c
+	}
+}
+
+func WithMaxImmutableMemtables(n int) Option {
+	return func(o *Options) {
+		o.MaxImmutableMemtables = n
+	}
+}
+
+func WithMemtableBloomBitsPerKey(bitsPerKey float64) Option {
+	return func(o *Options) {
+		o.MemtableBloomBitsPerKey = bitsPerKey
+	}
+}
+
+func WithL0StopWritesTrigger(n int) Option {
+	return func(o *Options) {
+		o.L0StopWritesTrigger = n
+	}
+}
+
+func WithTombstoneCompaction(ratio float64) Option {
+	return func(o *Options) {
+		o.TombstoneCompactionRatio = ratio
+	}
+}
+
+func WithBlobThreshold(n int) Option {
+	return func(o *Options) {
+		o.BlobThreshold = n
+	}
+}
+
+func WithBlobGCCutoff(cutoff float64) Option {
+	return func(o *Options) {
+		o.BlobGCCutoff = cutoff
+	}
+}
+
+func WithBytesPerSync(sstable, wal int64) Option {
+	return func(o *Options) {
+		o.BytesPerSync = sstable
+		o.WALBytesPerSync = wal
+	}
+}
+
+func WithWALPreallocation(bytes int64) Option {
+	return func(o *Options) {
+		o.WALPreallocateSize = bytes
+	}
+}
+
+func WithWALRecycling(n int) Option {
+	return func(o *Options) {
+		o.WALRecycleLimit = n
+	}
+}
+
+func WithWALArchive(ttl time.Duration, sizeLimit int64) Option {
+	return func(o *Options) {
+		o.ArchiveWALs = true
+		o.WALArchiveTTL = ttl
+		o.WALArchiveSizeLimit = sizeLimit
+	}
+}
+
+func WithReplicationBacklog(n int) Option {
+	return func(o *Options) {
+		o.ReplicationBacklog = n
+	}
+}
+
+func WithCompactionRateLimit(bytesPerSec int64) Option {
+	return func(o *Options) {
+		o.CompactionRateLimit = bytesPerSec
+	}
+}
+
+func WithDirectIOWrites() Option {
+	return func(o *Options) {
+		o.DirectIOWrites = true
+	}
+}
+
+func WithCompactionReadahead(bytes int) Option {
+	return func(o *Options) {
+		o.CompactionReadaheadSize = bytes
+	}
+}
+
+func WithL0CompactionTrigger(n int) Option {
+	return func(o *Options) {
+		o.L0CompactionTrigger = n
+	}
+}
+
+func WithLevelSizeMultiplier(n int) Option {
+	return func(o *Options) {
+		o.LevelSizeMultiplier = n
+	}
+}
+
+func WithBackgroundJobs(jobs, compactions int) Option {
+	return func(o *Options) {
+		o.MaxBackgroundJobs = jobs
+		o.MaxBackgroundCompactions = compactions
+	}
+}
+
+func WithCompactionsPerLevel(n int) Option {
+	return func(o *Options) {
+		o.MaxCompactionsPerLevel = n
+	}
+}
+
+func WithIteratorLeakWarnings() Option {
+	return func(o *Options) {
+		o.WarnIteratorLeaks = true
+	}
+}
+
+func WithCompactionAutoTune(minTrigger, maxTrigger int) Option {
+	return func(o *Options) {
+		o.AutoTuneCompaction = true
+		o.MinL0CompactionTrigger = minTrigger
+		o.MaxL0CompactionTrigger = maxTrigger
+	}
+}
+
+func WithPeriodicCheckpoints(interval time.Duration, retain int) Option {
+	return func(o *Options) {
+		o.CheckpointInterval = interval
+		o.CheckpointRetention = retain
+	}
+}
+
+func WithTableChecksumVerification() Option {
+	return func(o *Options) {
+		o.VerifyTableChecksums = true
+	}
+}
+
+func WithCorruptFileQuarantine() Option {
+	return func(o *Options) {
+		o.QuarantineCorruptFiles = true
+	}
+}
+
+func WithShapeHistory() Option {
+	return func(o *Options) {
+		o.RecordShapeHistory = true
+	}
+}
+
+func WithCompactionFilter(f CompactionFilter) Option {
+	return func(o *Options) {
+		o.CompactionFilter = f
+	}
+}
+
+func WithLogger(l common.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+func WithEventListener(l EventListener) Option {
+	return func(o *Options) {
+		o.EventListeners = append(o.EventListeners, l)
+	}
+}
+
+func WithReadOnly() Option {
+	return func(o *Options) {
+		o.ReadOnly = true
+	}
+}
+
+func WithSecondaryCatchUpInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.SecondaryCatchUpInterval = interval
+	}
+}
+
+func WithBlockCacheSize(bytes int64) Option {
+	return func(o *Options) {
+		o.BlockCacheSize = bytes
+	}
+}
+
+func WithBlockCachePolicy(p block_cache.Policy) Option {
+	return func(o *Options) {
+		o.BlockCachePolicy = p
+	}
+}
+
+func WithMaxOpenFiles(n int) Option {
+	return func(o *Options) {
+		o.MaxOpenFiles = n
+	}
+}
+
+func WithMmapReads() Option {
+	return func(o *Options) {
+		o.MmapReads = true
+	}
+}
+
+func WithEnv(env *Env) Option {
+	return func(o *Options) {
+		o.Env = env
+	}
+}
+
+// logger returns the logger the engine's records go to.
+func (o *Options) logger() common.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return common.DefaultLogger
+}
+
+// filterPolicy returns the policy new SSTables build their filters with.
+func (o *Options) filterPolicy() filter.Policy {
+	if o.FilterPolicy != nil {
+		return o.FilterPolicy
+	}
+	return filter.NewBloomPolicy(filter.BloomBitsPerKey(o.BloomFilterFPR))
+}
+
+// validate rejects settings the engine can't run with.
+func (o *Options) validate() error {
+	if o.L0CompactionTrigger < 1 {
+		return fmt.Errorf("db: L0CompactionTrigger must be at least 1, got %d", o.L0CompactionTrigger)
+	}
+	if o.MaxCompactionsPerLevel < 1 {
+		return fmt.Errorf("db: MaxCompactionsPerLevel must be at least 1, got %d", o.MaxCompactionsPerLevel)
+	}
+	if o.CheckpointInterval > 0 && o.CheckpointRetention < 1 {
+		return fmt.Errorf("db: CheckpointRetention must be at least 1, got %d", o.CheckpointRetention)
+	}
+	if o.AutoTuneCompaction {
+		if o.MinL0CompactionTrigger < 1 {
+			return fmt.Errorf("db: MinL0CompactionTrigger must be at least 1, got %d", o.MinL0CompactionTrigger)
+		}
+		if o.MaxL0CompactionTrigger < o.MinL0CompactionTrigger {
+			return fmt.Errorf("db: MaxL0CompactionTrigger %d is below MinL0CompactionTrigger %d", o.MaxL0CompactionTrigger, o.MinL0CompactionTrigger)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickCompactionLevelLimits(t *testing.T) {
+	file := func(fileNo common.FileNo, smallest, largest string) manifest.FileMetadata {
+		return manifest.FileMetadata{FileNo: fileNo, SmallestKey: []byte(smallest), LargestKey: []byte(largest)}
+	}
+	// Both L0 (at its trigger) and L1 (over its capacity of 2) need compacting
+	v := &manifest.Version{Levels: [][]manifest.FileMetadata{
+		{file(1, "a", "z"), file(2, "a", "z")},
+		{file(3, "a", "c"), file(4, "d", "f"), file(5, "g", "i")},
+		{},
+		{},
+	}}
+
+	tests := []struct {
+		name     string
+		perLevel int
+		running  map[int]int
+		expected int // -1 for no compaction
+	}{
+		{"L0First", 1, map[int]int{}, 0},
+		{"L0AtLimit", 1, map[int]int{0: 1}, 1},
+		{"FewestRunningFirst", 2, map[int]int{0: 1}, 1},
+		{"TiesPreferL0", 2, map[int]int{0: 1, 1: 1}, 0},
+		{"AllAtLimit", 1, map[int]int{0: 1, 1: 1}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.L0CompactionTrigger = 2
+			opts.LevelSizeMultiplier = 2
+			opts.MaxCompactionsPerLevel = tt.perLevel
+			d := &DB{
+				Opts:             opts,
+				compacting:       make(map[common.FileNo]struct{}),
+				levelCompactions: tt.running,
+				compactPointers:  make(map[int][]byte),
+			}
+
+			c := d.pickCompaction(v)
+			if tt.expected < 0 {
+				require.Nil(t, c)
+				return
+			}
+			require.NotNil(t, c)
+			require.Equal(t, tt.expected, c.level)
+		})
+	}
+}
+
+func TestCompactionsPerLevelAtLeastOne(t *testing.T) {
+	// With no compaction allowed per level, writers would stall on L0 forever
+	_, err := Open(WithDBPath(t.TempDir()), WithCompactionsPerLevel(0))
+	require.Error(t, err)
+}
+
+func TestPickTombstoneCompaction(t *testing.T) {
+	file := func(fileNo common.FileNo, smallest, largest string, entries, tombstones uint32) manifest.FileMetadata {
+		return manifest.FileMetadata{
+			FileNo:      fileNo,
+			SmallestKey: []byte(smallest),
+			LargestKey:  []byte(largest),
+			Entries:     entries,
+			Tombstones:  tombstones,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		ratio    float64
+		levels   [][]manifest.FileMetadata
+		level    int // -1 for no compaction
+		expected []common.FileNo
+	}{
+		{
+			name:   "BelowRatio",
+			ratio:  0.5,
+			levels: [][]manifest.FileMetadata{{}, {file(1, "a", "c", 10, 5)}, {}},
+			level:  -1,
+		},
+		{
+			name:   "Disabled",
+			ratio:  0,
+			levels: [][]manifest.FileMetadata{{}, {file(1, "a", "c", 10, 9)}, {}},
+			level:  -1,
+		},
+		{
+			name:     "DensestFile",
+			ratio:    0.5,
+			levels:   [][]manifest.FileMetadata{{}, {file(1, "a", "c", 10, 6), file(2, "d", "f", 10, 9)}, {file(3, "e", "g", 10, 0)}},
+			level:    1,
+			expected: []common.FileNo{2},
+		},
+		{
+			name:     "L0TakesAllOfL0",
+			ratio:    0.5,
+			levels:   [][]manifest.FileMetadata{{file(1, "a", "c", 10, 0), file(2, "a", "c", 10, 8)}, {}, {}},
+			level:    0,
+			expected: []common.FileNo{2, 1},
+		},
+		{
+			name:   "LastLevelIgnored",
+			ratio:  0.5,
+			levels: [][]manifest.FileMetadata{{}, {}, {file(1, "a", "c", 10, 9)}},
+			level:  -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions
+			opts.TombstoneCompactionRatio = tt.ratio
+			d := &DB{
+				Opts:             opts,
+				compacting:       make(map[common.FileNo]struct{}),
+				levelCompactions: make(map[int]int),
+				compactPointers:  make(map[int][]byte),
+			}
+
+			c := d.pickCompaction(&manifest.Version{Levels: tt.levels})
+			if tt.level < 0 {
+				require.Nil(t, c)
+				return
+			}
+			require.NotNil(t, c)
+			require.Equal(t, tt.level, c.level)
+			var inputs []common.FileNo
+			for _, fm := range c.inputs {
+				inputs = append(inputs, fm.FileNo)
+			}
+			require.Equal(t, tt.expected, inputs)
+		})
+	}
+}
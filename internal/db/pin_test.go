@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorPinsVersionAcrossCompaction(t *testing.T) {
+	env := NewEnv()
+	d, err := Open(
+		WithDBPath(t.TempDir()),
+		WithMemtableFlushThreshold(4),
+		WithL0CompactionTrigger(8),
+		WithEnv(env),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	keys := 0
+	for len(d.manifest.Current().Levels[0]) < 2 {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", keys)), []byte("value")))
+		keys++
+	}
+
+	iter, err := d.newMergedIterator(DefaultReadOptions, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, env.TableCache.Len())
+	stats := d.Stats()
+	require.Equal(t, 1, stats.OpenIterators)
+	require.Equal(t, 2, stats.PinnedTables)
+	require.Zero(t, stats.ObsoleteTables)
+
+	var l0Paths []string
+	for _, fm := range d.manifest.Current().Levels[0] {
+		l0Paths = append(l0Paths, d.paths.SSTablePath(0, fm.FileNo))
+	}
+
+	// Compaction deletes the L0 files the iterator is reading from
+	require.NoError(t, d.Compact())
+	require.Empty(t, d.manifest.Current().Levels[0])
+	require.Equal(t, 2, env.TableCache.Len(), "pinned tables must stay open")
+	stats = d.Stats()
+	require.Equal(t, 1, stats.OpenIterators)
+	require.Equal(t, 2, stats.PinnedTables)
+	require.Equal(t, 2, stats.ObsoleteTables)
+	for _, path := range l0Paths {
+		require.FileExists(t, path, "pinned tables must stay on disk")
+	}
+
+	count := 0
+	for {
+		entry, err := iter.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			break
+		}
+		count++
+	}
+	require.Equal(t, keys, count)
+
+	require.NoError(t, iter.Close())
+	require.Equal(t, 0, env.TableCache.Len(), "releasing the version should close obsolete tables")
+	for _, path := range l0Paths {
+		require.NoFileExists(t, path, "releasing the version should delete obsolete tables")
+	}
+	require.NoError(t, iter.Close())
+	stats = d.Stats()
+	require.Zero(t, stats.OpenIterators)
+	require.Zero(t, stats.PinnedTables)
+	require.Zero(t, stats.ObsoleteTables)
+}
+
+func TestLeakedIteratorIsReleased(t *testing.T) {
+	d, err := Open(WithDBPath(t.TempDir()), WithMemtableFlushThreshold(2), WithIteratorLeakWarnings())
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+
+	func() {
+		_, err := d.newMergedIterator(DefaultReadOptions, nil)
+		require.NoError(t, err)
+	}()
+	require.Equal(t, 1, d.Stats().OpenIterators)
+
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		stats := d.Stats()
+		return stats.OpenIterators == 0 && stats.PinnedTables == 0
+	}, time.Second, 10*time.Millisecond)
+}
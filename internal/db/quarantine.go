@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/vfs"
+)
+
+// quarantineTables checks every table in the current version, moving any
+// that fail their checksum or can't be opened into lost/ and dropping them
+// from the manifest. The tables moved are logged to logger.
+func quarantineTables(fsys vfs.FS, m *manifest.Manifest, paths *common.PathManager, logger common.Logger) error {
+	edit := &manifest.CompactionEdit{
+		DeleteSSTables: make(map[int]map[common.FileNo]struct{}),
+	}
+
+	for level, fileMetas := range m.Current().Levels {
+		for _, fm := range fileMetas {
+			err := checkTable(fsys, m, paths, level, fm)
+			if err == nil {
+				continue
+			}
+
+			path := paths.SSTablePath(level, fm.FileNo)
+			logger.Log(common.LevelError, "table is corrupt, its keys are lost", "level", level, "file", fm.FileNo,
+				"smallest", fm.SmallestKey, "largest", fm.LargestKey, "err", err)
+			if err := moveToLost(fsys, paths, path, fmt.Sprintf("L%d-%d.sst", level, fm.FileNo)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if edit.DeleteSSTables[level] == nil {
+				edit.DeleteSSTables[level] = make(map[common.FileNo]struct{})
+			}
+			edit.DeleteSSTables[level][fm.FileNo] = struct{}{}
+		}
+	}
+
+	if len(edit.DeleteSSTables) == 0 {
+		return nil
+	}
+	m.Apply(edit)
+	return m.Flush()
+}
+
+func checkTable(fsys vfs.FS, m *manifest.Manifest, paths *common.PathManager, level int, fm manifest.FileMetadata) error {
+	if fm.Checksum != 0 {
+		f, err := fsys.Open(paths.SSTablePath(level, fm.FileNo))
+		if err != nil {
+			return err
+		}
+		actual, err := common.Checksum(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if actual != fm.Checksum {
+			return fmt.Errorf("checksum is %08x, expected %08x", actual, fm.Checksum)
+		}
+	}
+
+	_, err := m.GetTable(fm.FileNo, level)
+	return err
+}
+
+// quarantineWALs moves WALs that failed to replay, or follow one that did,
+// into lost/ and starts a new WAL holding the entries recovered before the
+// corruption, so later writes aren't appended after unreadable bytes.
+func (d *DB) quarantineWALs(nums []common.FileNo) error {
+	for _, num := range nums {
+		if err := moveToLost(d.fs, d.paths, d.paths.WALPath(num), fmt.Sprintf("%d.log", num)); err != nil {
+			return err
+		}
+	}
+
+	if err := d.rewriteWAL(); err != nil {
+		return err
+	}
+
+	d.logger("recovery").Log(common.LevelError, "quarantined WAL, writes after the corruption are lost",
+		"wal", nums[0], "kept", d.memtable.Len(), "new_wal", d.walNum)
+	return nil
+}
+
+// moveToLost renames path into the lost/ directory. Names are prefixed with
+// the time so repeated quarantines of the same file number don't collide.
+func moveToLost(fsys vfs.FS, paths *common.PathManager, path, name string) error {
+	if err := fsys.MkdirAll(paths.LostDir(), 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(paths.LostDir(), fmt.Sprintf("%d-%s", time.Now().UnixNano(), name))
+	return fsys.Rename(path, dst)
+}
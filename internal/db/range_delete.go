@@ -0,0 +1,106 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/manifest"
+	"amethyst/internal/memtable"
+)
+
+// DeleteRange deletes every key in [start, end) with a single range
+// tombstone, however many keys the range holds. Keys written to the range
+// afterwards are unaffected. Compaction drops the deleted entries as it
+// reaches them, and the tombstone itself once it reaches the last level.
+func (d *DB) DeleteRange(start, end []byte) error {
+	return d.DeleteRangeWithOptions(start, end, DefaultWriteOptions)
+}
+
+// DeleteRangeWithOptions is like DeleteRange but commits as opts specify.
+func (d *DB) DeleteRangeWithOptions(start, end []byte, opts WriteOptions) error {
+	if bytes.Compare(start, end) >= 0 {
+		return errors.New("db: range start must sort before its end")
+	}
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	entry := &common.Entry{
+		Type:  common.EntryTypeRangeDelete,
+		Key:   bytes.Clone(start),
+		Value: bytes.Clone(end),
+		// Seq assigned by group commit loop
+	}
+
+	return d.submit(context.Background(), &writeRequest{entries: []*common.Entry{entry}, sync: opts.Sync})
+}
+
+// rangeTombstones returns the range tombstones of mems and of every table
+// in v that holds any. At BlockCacheTier, such a table that isn't open fails
+// with ErrWouldBlock. It needs no lock, but mems must have been loaded before
+// v was pinned, so a flush committed in between can't take a tombstone out
+// of mems without it being in v.
+func (d *DB) rangeTombstones(mems []memtable.Memtable, v *manifest.Version, tier ReadTier) (common.RangeTombstones, error) {
+	var rangeDels common.RangeTombstones
+	for _, mem := range mems {
+		rangeDels = append(rangeDels, mem.RangeTombstones()...)
+	}
+	for level, fileMetas := range v.Levels {
+		for _, fm := range fileMetas {
+			if fm.RangeDels == 0 {
+				continue
+			}
+			if tier == BlockCacheTier {
+				table, ok := d.manifest.CachedTable(fm.FileNo, level)
+				if !ok {
+					return nil, ErrWouldBlock
+				}
+				rangeDels = append(rangeDels, table.RangeTombstones()...)
+				continue
+			}
+			table, err := d.manifest.GetTable(fm.FileNo, level)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+			rangeDels = append(rangeDels, table.RangeTombstones()...)
+		}
+	}
+	return rangeDels, nil
+}
+
+// applyRangeDels returns entry, or a point tombstone in its place if one of
+// rangeDels deletes it.
+func applyRangeDels(rangeDels common.RangeTombstones, entry *common.Entry) *common.Entry {
+	if entry.Type == common.EntryTypeDelete {
+		return entry
+	}
+	t := rangeDels.Covering(entry.Key, entry.Seq)
+	if t == nil {
+		return entry
+	}
+	return &common.Entry{
+		Type:      common.EntryTypeDelete,
+		Seq:       t.Seq,
+		Timestamp: t.Timestamp,
+		Key:       entry.Key,
+	}
+}
+
+// rangeDelIterator turns the entries that range tombstones delete into
+// point tombstones.
+type rangeDelIterator struct {
+	iterator.Iterator
+	rangeDels common.RangeTombstones
+}
+
+func (it *rangeDelIterator) Next() (*common.Entry, error) {
+	entry, err := it.Iterator.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return applyRangeDels(it.rangeDels, entry), nil
+}
@@ -0,0 +1,134 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+// requireContents checks that Get, MultiGet, and Scan all agree d holds
+// exactly want among keys key00-key29.
+func requireContents(t *testing.T, d *db.DB, want map[string]string) {
+	t.Helper()
+
+	var keys [][]byte
+	for i := 0; i < 30; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%02d", i)))
+	}
+	values, err := d.MultiGet(keys)
+	require.NoError(t, err)
+	for i, key := range keys {
+		value, err := d.Get(key)
+		if expected, ok := want[string(key)]; ok {
+			require.NoError(t, err, "%s", key)
+			require.Equal(t, []byte(expected), value, "%s", key)
+			require.Equal(t, []byte(expected), values[i], "%s", key)
+		} else {
+			require.ErrorIs(t, err, db.ErrNotFound, "%s", key)
+			require.Nil(t, values[i], "%s", key)
+		}
+	}
+
+	entries, err := d.Scan(nil, 0)
+	require.NoError(t, err)
+	scanned := make(map[string]string)
+	for _, entry := range entries {
+		scanned[string(entry.Key)] = string(entry.Value)
+	}
+	require.Equal(t, want, scanned)
+}
+
+func TestDeleteRange(t *testing.T) {
+	path := t.TempDir()
+	d, err := db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(8))
+	require.NoError(t, err)
+	defer func() { d.Close() }()
+
+	want := make(map[string]string)
+	put := func(key, value string) {
+		require.NoError(t, d.Put([]byte(key), []byte(value)))
+		want[key] = value
+	}
+	deleteRange := func(start, end string) {
+		require.NoError(t, d.DeleteRange([]byte(start), []byte(end)))
+		for key := range want {
+			if key >= start && key < end {
+				delete(want, key)
+			}
+		}
+	}
+
+	// The tombstone starts in the memtable, over keys already flushed
+	for i := 0; i < 20; i++ {
+		put(fmt.Sprintf("key%02d", i), "v")
+	}
+	deleteRange("key05", "key10")
+	put("key07", "new")
+	d.WaitForCompactions()
+	requireContents(t, d, want)
+
+	// Once flushed, the tombstone lives in a table's range deletion block
+	for i := 20; i < 30; i++ {
+		put(fmt.Sprintf("key%02d", i), "v")
+	}
+	d.WaitForCompactions()
+	rangeDels := 0
+	for _, files := range d.Manifest().Current().Levels {
+		for _, fm := range files {
+			rangeDels += int(fm.RangeDels)
+		}
+	}
+	require.Equal(t, 1, rangeDels)
+	requireContents(t, d, want)
+
+	require.NoError(t, d.Close())
+	d, err = db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(8))
+	require.NoError(t, err)
+	requireContents(t, d, want)
+
+	// Compacting to the last level drops the tombstone and what it deleted
+	require.NoError(t, d.Compact())
+	entries := 0
+	for _, files := range d.Manifest().Current().Levels {
+		for _, fm := range files {
+			require.Zero(t, fm.RangeDels)
+			entries += int(fm.Entries)
+		}
+	}
+	require.Equal(t, len(want), entries)
+	requireContents(t, d, want)
+	require.Empty(t, d.VerifyChecksums())
+
+	// With every write in a table, sequence numbers resume from the tables
+	require.NoError(t, d.Close())
+	d, err = db.Open(db.WithDBPath(path), db.WithMemtableFlushThreshold(8))
+	require.NoError(t, err)
+	deleteRange("key00", "key02")
+	requireContents(t, d, want)
+
+	// Above the last level the tombstone is carried down with the merge
+	require.NoError(t, d.Compact())
+	requireContents(t, d, want)
+	require.Empty(t, d.VerifyChecksums())
+}
+
+func TestDeleteRangeInvalid(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	tests := []struct {
+		name       string
+		start, end string
+	}{
+		{"empty range", "b", "b"},
+		{"reversed range", "c", "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, d.DeleteRange([]byte(tt.start), []byte(tt.end)))
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLockTimeout is returned when a range lock, or a transaction's key lock,
+// is not granted in time.
+var ErrLockTimeout = errors.New("db: timed out waiting for lock")
+
+// RangeLock is an exclusive advisory lock on the keys [start, end), held
+// until Unlock. It does not block reads or writes; it only excludes other
+// range locks that overlap it, including the key locks of transactions.
+type RangeLock struct {
+	start, end []byte
+	owner      *Transaction // the transaction holding the lock, if any
+	manager    *rangeLockManager
+	granted    chan struct{} // closed once the lock is held
+	once       sync.Once
+}
+
+// Unlock releases the lock. Safe to call more than once.
+func (l *RangeLock) Unlock() {
+	l.once.Do(func() { l.manager.release(l) })
+}
+
+// overlaps reports whether l and other cover a common key. A nil start or
+// end is unbounded on that side.
+func (l *RangeLock) overlaps(other *RangeLock) bool {
+	return before(l.start, other.end) && before(other.start, l.end)
+}
+
+// isGranted reports whether l is held.
+func (l *RangeLock) isGranted() bool {
+	select {
+	case <-l.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+// before reports whether start < end, treating nil as -inf and +inf.
+func before(start, end []byte) bool {
+	return start == nil || end == nil || bytes.Compare(start, end) < 0
+}
+
+// rangeLockManager grants range locks in arrival order: a request waits for
+// every overlapping request queued before it, whether granted or waiting,
+// so a stream of short locks cannot starve a wide one. Requests over
+// disjoint ranges never wait on each other.
+//
+// Transactions take their key locks here too. A transaction waits on one
+// lock at a time, which is released only once the requests ahead of it are,
+// so the manager can follow what each transaction waits for and refuse a
+// request that would close a cycle. Plain range locks are not tracked that
+// way; waits involving them are broken only by timeouts.
+type rangeLockManager struct {
+	mu      sync.Mutex
+	queue   []*RangeLock                // granted and waiting locks, oldest first
+	waiting map[*Transaction]*RangeLock // the lock each transaction waits for
+}
+
+func newRangeLockManager() *rangeLockManager {
+	return &rangeLockManager{waiting: make(map[*Transaction]*RangeLock)}
+}
+
+// LockRange acquires an advisory lock on the keys [start, end), blocking
+// behind earlier overlapping locks. A nil bound is unbounded on that side.
+// It fails with ErrLockTimeout if the lock isn't granted within timeout;
+// timeout <= 0 waits indefinitely.
+//
+// The locks coordinate callers that share the database, such as external
+// coordinators and transactions; plain reads and writes ignore them.
+func (d *DB) LockRange(start, end []byte, timeout time.Duration) (*RangeLock, error) {
+	return d.locks.acquire(bytes.Clone(start), bytes.Clone(end), nil, timeout)
+}
+
+// acquire queues a lock on [start, end) for owner, which is nil for plain
+// range locks, and waits for it to be granted. A transaction's request
+// fails with ErrDeadlock if it would wait on a lock the transaction holds.
+func (m *rangeLockManager) acquire(start, end []byte, owner *Transaction, timeout time.Duration) (*RangeLock, error) {
+	l := &RangeLock{start: start, end: end, owner: owner, manager: m, granted: make(chan struct{})}
+
+	m.mu.Lock()
+	m.queue = append(m.queue, l)
+	m.grant()
+	if owner != nil && !l.isGranted() {
+		if m.deadlocks(l) {
+			m.remove(l)
+			m.mu.Unlock()
+			return nil, ErrDeadlock
+		}
+		m.waiting[owner] = l
+	}
+	m.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-l.granted:
+		return l, nil
+	case <-expired:
+		// The grant may have raced the timer; releasing covers both cases
+		l.Unlock()
+		return nil, ErrLockTimeout
+	}
+}
+
+func (m *rangeLockManager) release(l *RangeLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(l)
+}
+
+// remove takes l out of the queue, granting the requests it held up. Must
+// be called with m.mu held.
+func (m *rangeLockManager) remove(l *RangeLock) {
+	if l.owner != nil && m.waiting[l.owner] == l {
+		delete(m.waiting, l.owner)
+	}
+	if i := m.index(l); i >= 0 {
+		m.queue = append(m.queue[:i], m.queue[i+1:]...)
+	}
+	m.grant()
+}
+
+func (m *rangeLockManager) index(l *RangeLock) int {
+	for i, queued := range m.queue {
+		if queued == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// deadlocks reports whether the waiting request l would never be granted
+// because what it waits for waits, directly or not, on l's owner: a waiting
+// request waits for the overlapping requests ahead of it, and a transaction's
+// granted lock for the request the transaction waits on. Must be called with
+// m.mu held.
+func (m *rangeLockManager) deadlocks(l *RangeLock) bool {
+	seen := make(map[*RangeLock]bool)
+	stack := []*RangeLock{l}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if next != l && next.owner == l.owner {
+			return true
+		}
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+
+		if !next.isGranted() {
+			i := m.index(next)
+			for _, ahead := range m.queue[:i] {
+				if next.overlaps(ahead) {
+					stack = append(stack, ahead)
+				}
+			}
+		} else if next.owner != nil {
+			if w := m.waiting[next.owner]; w != nil {
+				stack = append(stack, w)
+			}
+		}
+	}
+	return false
+}
+
+// grant hands the lock to every waiter with no overlapping request ahead of
+// it in the queue. Must be called with m.mu held.
+func (m *rangeLockManager) grant() {
+	for i, l := range m.queue {
+		if l.isGranted() {
+			continue
+		}
+
+		blocked := false
+		for _, ahead := range m.queue[:i] {
+			if l.overlaps(ahead) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			close(l.granted)
+			if l.owner != nil && m.waiting[l.owner] == l {
+				delete(m.waiting, l.owner)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockRange(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	const short = 20 * time.Millisecond
+
+	a, err := d.LockRange([]byte("a"), []byte("c"), 0)
+	require.NoError(t, err)
+
+	// Disjoint ranges are granted alongside; end bounds are exclusive
+	disjoint, err := d.LockRange([]byte("c"), []byte("d"), short)
+	require.NoError(t, err)
+	disjoint.Unlock()
+
+	tests := []struct {
+		name       string
+		start, end string
+	}{
+		{"Inside", "b", "bb"},
+		{"Straddling", "b", "z"},
+		{"UnboundedStart", "", "b"},
+		{"UnboundedEnd", "bz", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var start, end []byte
+			if tt.start != "" {
+				start = []byte(tt.start)
+			}
+			if tt.end != "" {
+				end = []byte(tt.end)
+			}
+			_, err := d.LockRange(start, end, short)
+			require.ErrorIs(t, err, db.ErrLockTimeout)
+		})
+	}
+
+	// b queues behind a; c doesn't overlap a but must queue behind b
+	bGranted := make(chan *db.RangeLock)
+	go func() {
+		b, err := d.LockRange([]byte("b"), []byte("d"), 0)
+		require.NoError(t, err)
+		bGranted <- b
+	}()
+	time.Sleep(short)
+	_, err = d.LockRange([]byte("c"), []byte("e"), short)
+	require.ErrorIs(t, err, db.ErrLockTimeout)
+
+	a.Unlock()
+	a.Unlock()
+	b := <-bGranted
+	_, err = d.LockRange([]byte("c"), []byte("e"), short)
+	require.ErrorIs(t, err, db.ErrLockTimeout)
+
+	b.Unlock()
+	c, err := d.LockRange([]byte("c"), []byte("e"), short)
+	require.NoError(t, err)
+	c.Unlock()
+}
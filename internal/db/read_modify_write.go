@@ -0,0 +1,191 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"amethyst/internal/common"
+)
+
+// ErrNotInteger is returned by Increment when the key's value is not a
+// decimal integer, or adding delta would overflow it.
+var ErrNotInteger = errors.New("db: value is not an integer")
+
+// Append atomically appends suffix to key's value, treating a missing key as
+// empty. The read and the write happen in one commit, so concurrent appends
+// are never lost.
+func (d *DB) Append(key, suffix []byte) error {
+	suffix = bytes.Clone(suffix)
+	_, err := d.readModifyWrite(key, func(current []byte, _ bool) ([]byte, error) {
+		return append(bytes.Clone(current), suffix...), nil
+	})
+	return err
+}
+
+// Increment atomically adds delta to key's value and returns the result.
+// Values are stored as decimal strings, and a missing key counts as 0.
+// Fails with ErrNotInteger if the value isn't one or the sum would overflow.
+func (d *DB) Increment(key []byte, delta int64) (int64, error) {
+	entry, err := d.readModifyWrite(key, func(current []byte, found bool) ([]byte, error) {
+		var n int64
+		if found {
+			var err error
+			if n, err = strconv.ParseInt(string(current), 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrNotInteger, current)
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, fmt.Errorf("%w: %d%+d overflows", ErrNotInteger, n, delta)
+		}
+		return strconv.AppendInt(nil, n+delta, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(entry.Value), 10, 64)
+}
+
+// errConditionFailed drops a conditional write whose check fails.
+var errConditionFailed = errors.New("db: condition failed")
+
+// CompareAndSwap atomically sets key to value if its current value is
+// expected, and reports whether it did. A nil expected matches only a
+// missing key; an empty one matches an empty value. The comparison happens
+// inside the commit, so no write can slip in between.
+func (d *DB) CompareAndSwap(key, expected, value []byte) (bool, error) {
+	expected = bytes.Clone(expected)
+	return d.conditionalPut(key, value, func(current []byte, found bool) error {
+		if (expected == nil && !found) || (expected != nil && found && bytes.Equal(current, expected)) {
+			return nil
+		}
+		return errConditionFailed
+	})
+}
+
+// PutIfAbsent atomically sets key to value if the key is missing, and
+// reports whether it did.
+func (d *DB) PutIfAbsent(key, value []byte) (bool, error) {
+	return d.CompareAndSwap(key, nil, value)
+}
+
+// conditionalPut commits a put of key if check, run on its current value
+// inside the group commit, passes, and reports whether it did.
+func (d *DB) conditionalPut(key, value []byte, check func(current []byte, found bool) error) (bool, error) {
+	if len(key) == 0 {
+		return false, errors.New("db: key must be non-empty")
+	}
+	if d.Opts.ReadOnly {
+		return false, ErrReadOnly
+	}
+
+	entry := &common.Entry{
+		Type:  common.EntryTypePut,
+		Key:   bytes.Clone(key),
+		Value: bytes.Clone(value),
+	}
+	req := &writeRequest{entries: []*common.Entry{entry}, check: check, sync: true}
+	switch err := d.submit(context.Background(), req); err {
+	case nil:
+		return true, nil
+	case errConditionFailed:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// readModifyWrite commits a put of key whose value merge computes from the
+// current value inside the group commit, and returns the committed entry.
+func (d *DB) readModifyWrite(key []byte, merge func(current []byte, found bool) ([]byte, error)) (*common.Entry, error) {
+	if len(key) == 0 {
+		return nil, errors.New("db: key must be non-empty")
+	}
+	if d.Opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	entry := &common.Entry{
+		Type: common.EntryTypePut,
+		Key:  bytes.Clone(key),
+	}
+	req := &writeRequest{entries: []*common.Entry{entry}, merge: merge, sync: true}
+	if err := d.submit(context.Background(), req); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// applyReads sets the value of every merge request in batch and runs the
+// check of every conditional one, reading each key as left by the requests
+// before it. Must be called with d.mu held.
+func (d *DB) applyReads(batch []*writeRequest) error {
+	// Plain puts and deletes need no reads
+	if !slices.ContainsFunc(batch, func(req *writeRequest) bool { return req.merge != nil || req.check != nil }) {
+		return nil
+	}
+
+	// pending holds the latest point write of each key in the batch so far,
+	// and rangeDels the range tombstones; a tombstone drops the writes it
+	// covers from pending, so those left there are newer than it
+	var pending map[string]*common.Entry
+	var rangeDels []*common.Entry
+	deleted := func(key []byte) bool {
+		return slices.ContainsFunc(rangeDels, func(t *common.Entry) bool {
+			return bytes.Compare(t.Key, key) <= 0 && bytes.Compare(key, t.Value) < 0
+		})
+	}
+	for _, req := range batch {
+		if req.err != nil {
+			continue
+		}
+		if req.merge != nil || req.check != nil {
+			entry := req.entries[0]
+			current, ok := pending[string(entry.Key)]
+			if !ok && !deleted(entry.Key) {
+				var err error
+				current, err = d.getEntry(context.Background(), entry.Key, DefaultReadOptions, ReadAllTier)
+				if err != nil && err != ErrNotFound {
+					return err
+				}
+			}
+
+			found := current != nil && current.Type == common.EntryTypePut
+			var value []byte
+			if found {
+				value = current.Value
+			}
+			if req.check != nil {
+				if req.err = req.check(value, found); req.err != nil {
+					continue
+				}
+			}
+			if req.merge != nil {
+				if entry.Value, req.err = req.merge(value, found); req.err != nil {
+					continue
+				}
+			}
+		}
+
+		if pending == nil {
+			pending = make(map[string]*common.Entry)
+		}
+		for _, entry := range req.entries {
+			if entry.Type != common.EntryTypeRangeDelete {
+				pending[string(entry.Key)] = entry
+				continue
+			}
+			for key := range pending {
+				if key >= string(entry.Key) && key < string(entry.Value) {
+					delete(pending, key)
+				}
+			}
+			rangeDels = append(rangeDels, entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package db_test
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrement(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  string // "" leaves the key missing
+		delete   bool
+		delta    int64
+		expected int64
+		err      error
+	}{
+		{"Missing", "", false, 5, 5, nil},
+		{"Existing", "40", false, 2, 42, nil},
+		{"Negative", "1", false, -3, -2, nil},
+		{"Deleted", "7", true, 1, 1, nil},
+		{"NotInteger", "abc", false, 1, 0, db.ErrNotInteger},
+		{"Overflow", "9223372036854775807", false, 1, 0, db.ErrNotInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(db.WithDBPath(t.TempDir()))
+			require.NoError(t, err)
+			defer d.Close()
+
+			key := []byte("counter")
+			if tt.initial != "" {
+				require.NoError(t, d.Put(key, []byte(tt.initial)))
+			}
+			if tt.delete {
+				require.NoError(t, d.Delete(key))
+			}
+
+			n, err := d.Increment(key, tt.delta)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				value, err := d.Get(key)
+				require.NoError(t, err)
+				require.Equal(t, tt.initial, string(value), "failed increments leave the value alone")
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, n)
+		})
+	}
+}
+
+func TestConcurrentReadModifyWrite(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(16))
+	require.NoError(t, err)
+	defer d.Close()
+
+	const writers, each = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				_, err := d.Increment([]byte("counter"), 1)
+				require.NoError(t, err)
+				require.NoError(t, d.Append([]byte("log"), []byte("x")))
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := d.Increment([]byte("counter"), 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(writers*each), n)
+
+	value, err := d.Get([]byte("log"))
+	require.NoError(t, err)
+	require.Len(t, value, writers*each)
+
+	_, err = d.Increment([]byte("log"), math.MaxInt64)
+	require.ErrorIs(t, err, db.ErrNotInteger)
+}
+
+func TestReadModifyWriteAfterDeleteRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   func(d *db.DB) [2]func() error
+		expected int64
+	}{
+		{"Covered", func(d *db.DB) [2]func() error {
+			return [2]func() error{
+				func() error { return d.Put([]byte("k"), []byte("10")) },
+				func() error { return d.DeleteRange([]byte("a"), []byte("z")) },
+			}
+		}, 1},
+		{"Rewritten", func(d *db.DB) [2]func() error {
+			return [2]func() error{
+				func() error { return d.DeleteRange([]byte("a"), []byte("z")) },
+				func() error { return d.Put([]byte("k"), []byte("10")) },
+			}
+		}, 11},
+		{"Outside", func(d *db.DB) [2]func() error {
+			return [2]func() error{
+				func() error { return d.DeleteRange([]byte("a"), []byte("c")) },
+				func() error { return d.Put([]byte("other"), []byte("10")) },
+			}
+		}, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			d, err := db.Open(db.WithDBPath(path))
+			require.NoError(t, err)
+			require.NoError(t, d.Put([]byte("k"), []byte("5")))
+			require.NoError(t, d.Close())
+
+			// Batches wait for a third write, so the two queued first share
+			// a batch with the increment, committed ahead of it
+			d, err = db.Open(db.WithDBPath(path), db.WithMaxBatchSize(3), db.WithBatchTimeout(time.Hour))
+			require.NoError(t, err)
+			defer d.Close()
+			errs := make(chan error, 2)
+			for i, write := range tt.writes(d) {
+				go func() { errs <- write() }()
+				require.Eventually(t, func() bool { return d.Stats().WriteQueueDepth == i+1 }, time.Second, time.Millisecond)
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			n, err := d.Increment([]byte("k"), 1)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, n)
+			require.NoError(t, <-errs)
+			require.NoError(t, <-errs)
+			value, err := d.Get([]byte("k"))
+			require.NoError(t, err)
+			require.Equal(t, strconv.FormatInt(tt.expected, 10), string(value))
+		})
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  []byte // nil leaves the key missing
+		delete   bool
+		expected []byte
+		swapped  bool
+	}{
+		{"MissingExpectingMissing", nil, false, nil, true},
+		{"MissingExpectingValue", nil, false, []byte("a"), false},
+		{"Matching", []byte("a"), false, []byte("a"), true},
+		{"Differing", []byte("a"), false, []byte("b"), false},
+		{"PresentExpectingMissing", []byte("a"), false, nil, false},
+		{"EmptyExpectingEmpty", []byte{}, false, []byte{}, true},
+		{"EmptyExpectingMissing", []byte{}, false, nil, false},
+		{"DeletedExpectingMissing", []byte("a"), true, nil, true},
+		{"DeletedExpectingValue", []byte("a"), true, []byte("a"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(db.WithDBPath(t.TempDir()))
+			require.NoError(t, err)
+			defer d.Close()
+
+			key := []byte("key")
+			if tt.initial != nil {
+				require.NoError(t, d.Put(key, tt.initial))
+			}
+			if tt.delete {
+				require.NoError(t, d.Delete(key))
+			}
+
+			swapped, err := d.CompareAndSwap(key, tt.expected, []byte("new"))
+			require.NoError(t, err)
+			require.Equal(t, tt.swapped, swapped)
+
+			value, err := d.Get(key)
+			switch {
+			case swapped:
+				require.NoError(t, err)
+				require.Equal(t, "new", string(value))
+			case tt.initial == nil || tt.delete:
+				require.ErrorIs(t, err, db.ErrNotFound, "failed swaps leave the key alone")
+			default:
+				require.NoError(t, err)
+				require.Equal(t, string(tt.initial), string(value), "failed swaps leave the key alone")
+			}
+		})
+	}
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	ok, err := d.PutIfAbsent([]byte("key"), []byte("first"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = d.PutIfAbsent([]byte("key"), []byte("second"))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	value, err := d.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(value))
+}
+
+func TestConcurrentCompareAndSwap(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(16))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Racing PutIfAbsents elect exactly one winner
+	const writers, each = 8, 10
+	var wg sync.WaitGroup
+	won := make(chan int, writers)
+	errs := make(chan error, 2*writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := d.PutIfAbsent([]byte("leader"), []byte(strconv.Itoa(i)))
+			if err != nil {
+				errs <- err
+			} else if ok {
+				won <- i
+			}
+		}()
+	}
+	wg.Wait()
+	close(won)
+	require.Len(t, won, 1)
+	value, err := d.Get([]byte("leader"))
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(<-won), string(value))
+
+	// Racing read-then-swap increments each retry until they win, and none
+	// is lost
+	require.NoError(t, d.Put([]byte("counter"), []byte("0")))
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range each {
+				for {
+					current, err := d.Get([]byte("counter"))
+					if err != nil {
+						errs <- err
+						return
+					}
+					n, _ := strconv.Atoi(string(current))
+					ok, err := d.CompareAndSwap([]byte("counter"), current, []byte(strconv.Itoa(n+1)))
+					if err != nil {
+						errs <- err
+						return
+					}
+					if ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	value, err = d.Get([]byte("counter"))
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(writers*each), string(value))
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"fmt"
+
+	"amethyst/internal/blob"
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/vfs"
+)
+
+// openReadOnly opens an existing database for reads. Unlike Open it never
+// creates files or directories and starts no background goroutines, so it is
+// safe to point at a closed production database for debugging.
+func openReadOnly(opts Options, paths *common.PathManager, env *Env) (*DB, error) {
+	db, err := newReadOnlyDB(opts, paths, env)
+	if err != nil {
+		return nil, err
+	}
+	db.nextSeq, err = db.replayWALs()
+	if err != nil {
+		return nil, err
+	}
+	db.nextSeq = max(db.nextSeq, db.manifest.Current().MaxSeq(), db.manifest.LastSeq())
+
+	db.logger("recovery").Log(common.LevelInfo, "opened read-only", "wal", db.walNum, "seq", db.nextSeq)
+	return db, nil
+}
+
+// newReadOnlyDB loads the manifest of the database at paths and returns a
+// DB over it with an empty memtable.
+func newReadOnlyDB(opts Options, paths *common.PathManager, env *Env) (*DB, error) {
+	version, err := loadManifest(env.FS, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	m := manifest.NewManifestWithTableCache(env.FS, paths, len(version.Levels), env.TableCache)
+	m.LoadVersion(version)
+	m.SetVerifyChecksums(opts.VerifyTableChecksums)
+	m.SetLogger(common.WithPrefix(opts.logger(), "manifest"))
+
+	db := &DB{
+		manifest:    m,
+		blobs:       blob.NewReader(env.FS, paths),
+		fs:          env.FS,
+		Opts:        opts,
+		log:         opts.logger(),
+		paths:       paths,
+		closeCh:     make(chan struct{}),
+		watchers:    make(map[*watcher]struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+		locks:       newRangeLockManager(),
+
+		blockCache:       env.BlockCache,
+		compacting:       make(map[common.FileNo]struct{}),
+		levelCompactions: make(map[int]int),
+		compactPointers:  make(map[int][]byte),
+	}
+
+	db.memtable = db.newMemtable()
+	db.publishMemtables()
+	return db, nil
+}
+
+// loadManifest reads the version the database at paths last persisted.
+func loadManifest(fsys vfs.FS, paths *common.PathManager) (*manifest.Version, error) {
+	manifestFile, err := fsys.Open(paths.ManifestPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer manifestFile.Close()
+
+	version, err := manifest.ReadManifest(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(10))
+	require.NoError(t, err)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	require.NoError(t, d.Delete([]byte("key03")))
+	require.NoError(t, d.Close())
+
+	walBefore, err := os.ReadDir(filepath.Join(dir, "wal"))
+	require.NoError(t, err)
+
+	ro, err := db.Open(db.WithDBPath(dir), db.WithReadOnly())
+	require.NoError(t, err)
+	defer ro.Close()
+
+	// Reads see both flushed tables and the replayed WAL
+	value, err := ro.Get([]byte("key00"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), value)
+	_, err = ro.Get([]byte("key03"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = ro.Get([]byte("key24"))
+	require.NoError(t, err)
+
+	entries, err := ro.Scan(db.KeyRange([]byte("key00"), []byte("key10")), 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 9)
+
+	require.Positive(t, ro.ApproximateSize(nil, nil))
+	require.Zero(t, ro.ApproximateSize([]byte("zzz"), nil))
+
+	// Writes are rejected and nothing new appears on disk
+	require.ErrorIs(t, ro.Put([]byte("new"), []byte("v")), db.ErrReadOnly)
+	require.ErrorIs(t, ro.Delete([]byte("key00")), db.ErrReadOnly)
+	require.ErrorIs(t, ro.Compact(), db.ErrReadOnly)
+
+	walAfter, err := os.ReadDir(filepath.Join(dir, "wal"))
+	require.NoError(t, err)
+	require.Equal(t, len(walBefore), len(walAfter))
+}
+
+func TestReadOnlyMissingDatabase(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	_, err := db.Open(db.WithDBPath(dir), db.WithReadOnly())
+	require.Error(t, err)
+
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err), "read-only open must not create the directory")
+}
@@ -0,0 +1,137 @@
+package db_test
+
+import (
+	"testing"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// mapBlockCache keeps every block it is given.
+type mapBlockCache map[[2]uint64]block_cache.Value
+
+func (c mapBlockCache) Get(fileNo common.FileNo, blockNo common.BlockNo) (block_cache.Value, bool) {
+	b, ok := c[[2]uint64{uint64(fileNo), uint64(blockNo)}]
+	return b, ok
+}
+
+func (c mapBlockCache) Put(fileNo common.FileNo, blockNo common.BlockNo, b block_cache.Value) {
+	c[[2]uint64{uint64(fileNo), uint64(blockNo)}] = b
+}
+
+func (c mapBlockCache) Pin(fileNo common.FileNo, blockNo common.BlockNo) bool {
+	_, ok := c[[2]uint64{uint64(fileNo), uint64(blockNo)}]
+	return ok
+}
+
+func (c mapBlockCache) Unpin(common.FileNo, common.BlockNo) {}
+
+func (c mapBlockCache) Stats() block_cache.Stats { return block_cache.Stats{} }
+
+func (c mapBlockCache) Usage() int64 {
+	var usage int64
+	for _, b := range c {
+		usage += int64(b.Size())
+	}
+	return usage
+}
+
+func TestBlockCacheTier(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+	require.NoError(t, d.Put([]byte("b"), []byte("2")))
+	require.NoError(t, d.Put([]byte("c"), []byte("3")))
+	d.WaitForCompactions()
+	require.NoError(t, d.Close())
+
+	// Reopening starts with no open tables and an empty block cache
+	blockCache := mapBlockCache{}
+	env := &db.Env{
+		FS:         vfs.Default,
+		BlockCache: blockCache,
+		TableCache: table_cache.NewTableCache(vfs.Default, blockCache, table_cache.DefaultMaxOpenFiles),
+	}
+	d, err = db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(100), db.WithEnv(env))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.Put([]byte("d"), []byte("4")))
+
+	value, err := d.GetFromTier([]byte("d"), db.BlockCacheTier)
+	require.NoError(t, err, "memtable reads never block")
+	require.Equal(t, []byte("4"), value)
+
+	_, err = d.GetFromTier([]byte("a"), db.BlockCacheTier)
+	require.ErrorIs(t, err, db.ErrWouldBlock)
+
+	// A full read warms the table and block caches
+	value, err = d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), value)
+
+	tests := []struct {
+		key      string
+		expected string
+		err      error
+	}{
+		{"a", "1", nil},
+		{"b", "2", nil},
+		{"missing", "", db.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, err := d.GetFromTier([]byte(tt.key), db.BlockCacheTier)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []byte(tt.expected), value)
+		})
+	}
+}
+
+func TestReadOptionsFillCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     db.ReadOptions
+		wantHits uint64
+	}{
+		{"FillCache", db.DefaultReadOptions, 2},
+		{"NoFillCache", db.ReadOptions{VerifyChecksums: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2))
+			require.NoError(t, err)
+			defer d.Close()
+			for _, key := range []string{"a", "b", "c"} {
+				require.NoError(t, d.Put([]byte(key), []byte(key)))
+			}
+			d.WaitForCompactions()
+
+			// A scan loads the flushed block, then two lookups read it again
+			iter, err := d.NewIteratorWithOptions(tt.opts)
+			require.NoError(t, err)
+			for {
+				entry, err := iter.Next()
+				require.NoError(t, err)
+				if entry == nil {
+					break
+				}
+			}
+			require.NoError(t, iter.Close())
+			for _, key := range []string{"a", "b"} {
+				value, err := d.GetWithOptions([]byte(key), tt.opts)
+				require.NoError(t, err)
+				require.Equal(t, []byte(key), value)
+			}
+			require.Equal(t, tt.wantHits, d.Stats().BlockCache.Hits)
+		})
+	}
+}
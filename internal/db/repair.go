@@ -0,0 +1,410 @@
+package db
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"amethyst/internal/blob"
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/manifest"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+	"amethyst/internal/wal"
+)
+
+// RepairResult summarizes what Repair did.
+type RepairResult struct {
+	// Tables is the number of tables the new manifest lists, of which
+	// Salvaged are rewrites of damaged tables keeping the entries read
+	// before the damage.
+	Tables   int
+	Salvaged int
+	// BlobFiles and WALs are the number of each the new manifest lists.
+	BlobFiles int
+	WALs      int
+	// Lost lists the files moved into lost/: the old MANIFEST, tables that
+	// couldn't be read at all or were salvaged, and tables a newer table
+	// of their level overlaps.
+	Lost []string
+}
+
+// Repair rebuilds the MANIFEST of a closed database from the files in its
+// directory, for when the manifest is missing or damaged. Only the path,
+// Env, level count, and table-writing options apply.
+//
+// Every table under sstable/ is read in full and listed at the level of its
+// directory with the key range, counts, and sequence numbers its entries
+// have. A table that fails to read part way is replaced with one holding the
+// entries before the failure. Since a compaction's outputs hold everything
+// of the tables they replace, where tables of L1+ overlap the newest is kept.
+// Every blob file is listed, and every WAL from the oldest present on, with
+// any missing from that run created empty. The database is then opened once
+// with WithCorruptFileQuarantine so the WALs replay, keeping the entries
+// before any corruption. Files set aside go to lost/ rather than being
+// deleted.
+//
+// Writes the repair can't place are lost: those in WALs already deleted and
+// those in the unreadable part of a table or WAL.
+func Repair(optFns ...Option) (*RepairResult, error) {
+	opts := DefaultOptions
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	paths := common.NewPathManager(opts.DBPath)
+	env := opts.Env
+	if env == nil {
+		env = newEnv(vfs.Default, block_cache.NewBlockCacheWithPolicy(opts.BlockCacheSize, opts.BlockCachePolicy), opts.MaxOpenFiles, sstable.OpenOptions{Mmap: opts.MmapReads, Logger: opts.logger()})
+	}
+	fsys := env.FS
+
+	if _, err := fsys.Stat(opts.DBPath); err != nil {
+		return nil, err
+	}
+	r := &repairer{env: env, paths: paths, opts: opts, result: &RepairResult{}, logger: common.WithPrefix(opts.logger(), "repair")}
+	if err := r.run(); err != nil {
+		return nil, fmt.Errorf("repair failed: %w", err)
+	}
+
+	// Replaying the WALs through a normal open checks them and moves their
+	// entries into a fresh WAL
+	d, err := Open(append(optFns, WithEnv(env), WithCorruptFileQuarantine())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repaired database: %w", err)
+	}
+	if err := d.Close(); err != nil {
+		return nil, err
+	}
+	return r.result, nil
+}
+
+type repairer struct {
+	env    *Env
+	paths  *common.PathManager
+	opts   Options
+	result *RepairResult
+	logger common.Logger
+
+	// nextFileNo is past every table and blob file number seen, so
+	// salvaged tables don't reuse one
+	nextFileNo common.FileNo
+}
+
+func (r *repairer) run() error {
+	manifestPath := r.paths.ManifestPath()
+	if err := r.lose(manifestPath, "MANIFEST"); err != nil {
+		return err
+	}
+	if err := r.env.FS.Remove(manifestPath + ".tmp"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	blobFiles, err := listFileNos(r.env.FS, r.paths.BlobDir(), ".blob")
+	if err != nil {
+		return err
+	}
+	for _, fileNo := range blobFiles {
+		r.nextFileNo = max(r.nextFileNo, fileNo+1)
+	}
+
+	levels := make([][]common.FileNo, r.opts.MaxSSTableLevel+1)
+	for level := range levels {
+		dir := filepath.Dir(r.paths.SSTablePath(level, 0))
+		if err := r.env.FS.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if levels[level], err = listFileNos(r.env.FS, dir, ".sst"); err != nil {
+			return err
+		}
+		for _, fileNo := range levels[level] {
+			r.nextFileNo = max(r.nextFileNo, fileNo+1)
+		}
+	}
+
+	edit := &manifest.CompactionEdit{
+		AddSSTables:  make(map[int][]manifest.FileMetadata),
+		AddBlobFiles: blobFiles,
+	}
+	for level, fileNos := range levels {
+		var found []manifest.FileMetadata
+		for _, fileNo := range fileNos {
+			fm, err := r.scanTable(level, fileNo)
+			if err != nil {
+				return err
+			}
+			if fm != nil {
+				found = append(found, *fm)
+			}
+		}
+		if level > 0 {
+			if found, err = r.dropOverlaps(level, found); err != nil {
+				return err
+			}
+		}
+		edit.AddSSTables[level] = found
+		r.result.Tables += len(found)
+	}
+	r.result.BlobFiles = len(blobFiles)
+
+	version := &manifest.Version{
+		Levels:            make([][]manifest.FileMetadata, len(levels)),
+		NextSSTableNumber: r.nextFileNo,
+	}
+	if version.CurrentWAL, version.NextWALNumber, err = r.repairWALs(); err != nil {
+		return err
+	}
+	r.result.WALs = len(version.LiveWALs())
+
+	m := manifest.NewManifestWithTableCache(r.env.FS, r.paths, len(levels), r.env.TableCache)
+	m.LoadVersion(version)
+	m.Apply(edit)
+	return m.Flush()
+}
+
+// scanTable reads the table at level and returns its metadata, or nil if
+// none of it could be read. A table damaged part way is salvaged into a new
+// table at the same level.
+func (r *repairer) scanTable(level int, fileNo common.FileNo) (*manifest.FileMetadata, error) {
+	path := r.paths.SSTablePath(level, fileNo)
+	name := fmt.Sprintf("L%d-%d.sst", level, fileNo)
+	table, err := sstable.OpenSSTableWithOptions(r.env.FS, path, fileNo, nil, sstable.OpenOptions{Logger: r.opts.logger()})
+	if err != nil {
+		r.logger.Log(common.LevelWarn, "table can't be opened, moving it to lost/", "level", level, "file", fileNo, "err", err)
+		return nil, r.lose(path, name)
+	}
+	defer table.Close()
+
+	// A dry run through a builder yields the metadata of the table as if
+	// it were being written
+	iter := newSalvageIterator(table)
+	result, err := sstable.WriteSSTable(io.Discard, iter, uint32(table.Len()), r.opts.BloomFilterFPR, nil, nil, table.RangeTombstones())
+	if err != nil {
+		return nil, err
+	}
+	if iter.err == nil {
+		info, err := r.env.FS.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := r.env.FS.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		checksum, err := common.Checksum(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		fm := tableMetadata(fileNo, result, iter.blobFiles)
+		fm.Size = uint64(info.Size())
+		fm.Checksum = checksum
+		return fm, nil
+	}
+
+	r.logger.Log(common.LevelWarn, "table is damaged", "level", level, "file", fileNo, "entries_before", result.EntryCount, "err", iter.err)
+	if result.EntryCount == 0 && result.RangeDelCount == 0 {
+		return nil, r.lose(path, name)
+	}
+	fm, err := r.salvageTable(level, table)
+	if err != nil {
+		return nil, err
+	}
+	r.result.Salvaged++
+	return fm, r.lose(path, name)
+}
+
+// salvageTable writes the readable entries of table to a new table at level.
+func (r *repairer) salvageTable(level int, table sstable.SSTable) (*manifest.FileMetadata, error) {
+	fileNo := r.nextFileNo
+	r.nextFileNo++
+	path := r.paths.SSTablePath(level, fileNo)
+	tmpPath := path + ".tmp"
+	f, err := r.env.FS.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	iter := newSalvageIterator(table)
+	checksum := common.NewChecksum()
+	result, err := sstable.WriteSSTableWithPolicy(io.MultiWriter(f, checksum), iter, uint32(table.Len()), r.opts.filterPolicy(), r.opts.PrefixExtractor, r.opts.Compression, table.RangeTombstones())
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = r.env.FS.Rename(tmpPath, path)
+	}
+	if err != nil {
+		r.env.FS.Remove(tmpPath)
+		return nil, err
+	}
+	if err := vfs.SyncDir(r.env.FS, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	fm := tableMetadata(fileNo, result, iter.blobFiles)
+	fm.Size = uint64(result.BytesWritten)
+	fm.Checksum = checksum.Sum32()
+	if r.opts.PrefixExtractor != nil {
+		fm.PrefixExtractor = r.opts.PrefixExtractor.Name()
+	}
+	r.logger.Log(common.LevelInfo, "salvaged table", "level", level, "file", fileNo, "entries", fm.Entries)
+	return fm, nil
+}
+
+// dropOverlaps keeps the tables of level that don't overlap a newer one,
+// moving the rest to lost/.
+func (r *repairer) dropOverlaps(level int, tables []manifest.FileMetadata) ([]manifest.FileMetadata, error) {
+	slices.SortFunc(tables, func(a, b manifest.FileMetadata) int {
+		return cmp.Compare(b.FileNo, a.FileNo)
+	})
+	var kept []manifest.FileMetadata
+	for _, fm := range tables {
+		overlapped := slices.ContainsFunc(kept, func(k manifest.FileMetadata) bool {
+			return bytes.Compare(fm.SmallestKey, k.LargestKey) <= 0 && bytes.Compare(k.SmallestKey, fm.LargestKey) <= 0
+		})
+		if !overlapped {
+			kept = append(kept, fm)
+			continue
+		}
+		r.logger.Log(common.LevelWarn, "table overlaps a newer one, moving it to lost/", "level", level, "file", fm.FileNo)
+		if err := r.lose(r.paths.SSTablePath(level, fm.FileNo), fmt.Sprintf("L%d-%d.sst", level, fm.FileNo)); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// repairWALs returns the range of live WALs: from the oldest WAL present
+// through the newest, creating empty logs for any missing between them, or
+// a single new empty log if there are none.
+func (r *repairer) repairWALs() (oldest, next common.FileNo, err error) {
+	if err := r.env.FS.MkdirAll(r.paths.WALDir(), 0755); err != nil {
+		return 0, 0, err
+	}
+	nums, err := listFileNos(r.env.FS, r.paths.WALDir(), ".log")
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(nums) == 0 {
+		nums = []common.FileNo{1}
+	}
+	oldest, next = nums[0], nums[len(nums)-1]+1
+	for num := oldest; num < next; num++ {
+		if slices.Contains(nums, num) {
+			continue
+		}
+		log, err := wal.CreateWAL(r.env.FS, r.paths.WALPath(num))
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := log.Close(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return oldest, next, nil
+}
+
+// lose moves path into lost/ as name, if it exists.
+func (r *repairer) lose(path, name string) error {
+	err := moveToLost(r.env.FS, r.paths, path, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err == nil {
+		r.result.Lost = append(r.result.Lost, name)
+	}
+	return err
+}
+
+func tableMetadata(fileNo common.FileNo, result *sstable.WriteResult, blobFiles []common.FileNo) *manifest.FileMetadata {
+	return &manifest.FileMetadata{
+		FileNo:      fileNo,
+		SmallestKey: result.SmallestKey,
+		LargestKey:  result.LargestKey,
+		Entries:     result.EntryCount,
+		Tombstones:  result.TombstoneCount,
+		RangeDels:   result.RangeDelCount,
+		MaxSeq:      result.MaxSeq,
+		BlobFiles:   blobFiles,
+		KeySizes:    result.KeySizes,
+		ValueSizes:  result.ValueSizes,
+	}
+}
+
+// salvageIterator reads a table's entries with checksums verified, ending
+// quietly at the first that fails to read or is out of order and keeping
+// the error. It collects the blob files the entries point into.
+type salvageIterator struct {
+	source    common.EntryIterator
+	lastKey   []byte
+	blobFiles []common.FileNo
+	err       error
+}
+
+func newSalvageIterator(table sstable.SSTable) *salvageIterator {
+	return &salvageIterator{source: table.IteratorWithOptions(sstable.ReadOptions{VerifyChecksums: true})}
+}
+
+func (it *salvageIterator) Next() (*common.Entry, error) {
+	if it.err != nil {
+		return nil, nil
+	}
+	entry, err := it.source.Next()
+	if err != nil {
+		it.err = err
+		return nil, nil
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	if it.lastKey != nil && bytes.Compare(entry.Key, it.lastKey) <= 0 {
+		it.err = fmt.Errorf("%w: key %q does not follow %q", ErrCorruption, entry.Key, it.lastKey)
+		return nil, nil
+	}
+	it.lastKey = bytes.Clone(entry.Key)
+
+	if entry.Type == common.EntryTypeBlobRef {
+		h, err := blob.DecodeHandle(entry.Value)
+		if err != nil {
+			it.err = fmt.Errorf("bad blob reference for %q: %w", entry.Key, err)
+			return nil, nil
+		}
+		if !slices.Contains(it.blobFiles, h.FileNo) {
+			it.blobFiles = append(it.blobFiles, h.FileNo)
+		}
+	}
+	return entry, nil
+}
+
+// listFileNos returns the numbers of the files in dir named <n><suffix>,
+// in increasing order.
+func listFileNos(fsys vfs.FS, dir, suffix string) ([]common.FileNo, error) {
+	entries, err := fsys.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nums []common.FileNo
+	for _, entry := range entries {
+		n, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), suffix), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+		nums = append(nums, common.FileNo(n))
+	}
+	slices.Sort(nums)
+	return nums, nil
+}
@@ -0,0 +1,84 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairRebuildsManifest(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(50))
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	require.NoError(t, d.Compact())
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("new")))
+	}
+	require.NoError(t, d.Delete([]byte("key100")))
+	require.NoError(t, d.Close())
+
+	require.NoError(t, os.Remove(dir+"/MANIFEST"))
+	result, err := db.Repair(db.WithDBPath(dir))
+	require.NoError(t, err)
+	require.NotZero(t, result.Tables)
+	require.Zero(t, result.Salvaged)
+
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	require.Empty(t, d.VerifyChecksums())
+	for i := 0; i < 200; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+		switch {
+		case i < 20:
+			require.Equal(t, "new", string(value))
+		case i == 100:
+			require.ErrorIs(t, err, db.ErrNotFound)
+		default:
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("v%d", i), string(value))
+		}
+	}
+}
+
+func TestRepairSalvagesDamagedTable(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(100), db.WithL0CompactionTrigger(100))
+	require.NoError(t, err)
+	for i := 0; i < 120; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("v")))
+	}
+	d.WaitForCompactions()
+	require.Len(t, d.Manifest().Current().Levels[0], 1)
+	fm := d.Manifest().Current().Levels[0][0]
+	tablePath := d.Paths().SSTablePath(0, fm.FileNo)
+	table, err := d.Manifest().GetTable(fm.FileNo, 0)
+	require.NoError(t, err)
+	secondBlock := int(table.GetIndex().Entries[1].BlockOffset)
+	require.NoError(t, d.Close())
+
+	// Damage the second block and drop the manifest
+	flipByte(t, tablePath, secondBlock+4)
+	require.NoError(t, os.WriteFile(dir+"/MANIFEST", []byte("{garbage"), 0644))
+
+	result, err := db.Repair(db.WithDBPath(dir))
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Tables)
+	require.Equal(t, 1, result.Salvaged)
+	require.ElementsMatch(t, []string{"MANIFEST", fmt.Sprintf("L0-%d.sst", fm.FileNo)}, result.Lost)
+
+	d, err = db.Open(db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer d.Close()
+	require.Empty(t, d.VerifyChecksums())
+	entries, err := d.Scan(nil, 0)
+	require.NoError(t, err)
+	// The first block of the table and the writes still in the WAL
+	require.Len(t, entries, 64+20)
+}
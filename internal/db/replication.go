@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+
+	"amethyst/internal/common"
+)
+
+var (
+	// ErrNoBacklog is returned by CommitsSince on a DB opened without a
+	// replication backlog.
+	ErrNoBacklog = errors.New("db: no replication backlog")
+	// ErrNotInBacklog is returned by CommitsSince when the commits after the
+	// requested sequence number are no longer all in the backlog, or the
+	// sequence number was never committed here.
+	ErrNotInBacklog = errors.New("db: commits are not in the replication backlog")
+)
+
+// commitBacklog holds the latest committed entries, in commit order, for
+// replicas to stream.
+type commitBacklog struct {
+	mu      sync.Mutex
+	limit   int
+	entries []*common.Entry // oldest first; between limit and 2*limit once full
+	start   uint64          // every commit after it is in entries
+	grown   chan struct{}   // closed, and replaced, when entries are added
+}
+
+func newCommitBacklog(limit int, seq uint64) *commitBacklog {
+	return &commitBacklog{limit: limit, start: seq, grown: make(chan struct{})}
+}
+
+// add appends committed entries and wakes the readers waiting on them.
+// Entries are dropped in bulk once twice the limit are held, so each add
+// stays cheap.
+func (b *commitBacklog) add(entries []*common.Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries = append(b.entries, entries...)
+	if drop := len(b.entries) - b.limit; drop > b.limit {
+		b.start = b.entries[drop-1].Seq
+		b.entries = slices.Clone(b.entries[drop:])
+	}
+	close(b.grown)
+	b.grown = make(chan struct{})
+}
+
+// since returns the entries committed after seq, and a channel closed once
+// more are added.
+func (b *commitBacklog) since(seq uint64) ([]*common.Entry, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if seq < b.start {
+		return nil, nil, ErrNotInBacklog
+	}
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Seq > seq })
+	return slices.Clone(b.entries[i:]), b.grown, nil
+}
+
+// CommitsSince returns the entries committed after sequence number seq, in
+// commit order, and a channel that is closed once more have been committed.
+// Range deletes are included; tables added by IngestSSTable and BulkLoad are
+// not. It fails with ErrNotInBacklog if some of those entries have already
+// left the backlog, or were committed before Open, and with ErrNoBacklog
+// unless Options.ReplicationBacklog is set. The entries must not be
+// modified.
+func (d *DB) CommitsSince(seq uint64) ([]*common.Entry, <-chan struct{}, error) {
+	if d.backlog == nil {
+		return nil, nil, ErrNoBacklog
+	}
+	if seq > d.LastSeq() {
+		return nil, nil, ErrNotInBacklog
+	}
+	return d.backlog.since(seq)
+}
+
+// LastSeq returns the sequence number of the latest commit.
+func (d *DB) LastSeq() uint64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.nextSeq
+}
+
+// ApplyReplicated commits entries streamed from a primary's CommitsSince,
+// keeping their sequence numbers and timestamps, so the database follows
+// the primary's history. Entries at or below LastSeq were applied already
+// and are skipped, which makes resending a batch harmless. A replica must
+// take no other writes, or their sequence numbers would collide with the
+// primary's.
+func (d *DB) ApplyReplicated(entries []*common.Entry, opts WriteOptions) error {
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Seq > d.nextSeq })
+	entries = entries[i:]
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := d.makeRoomForWrite(); err != nil {
+		return err
+	}
+
+	if err := d.wal.Append(entries); err != nil {
+		return err
+	}
+	if opts.Sync {
+		if err := d.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	d.nextSeq = entries[len(entries)-1].Seq
+	d.manifest.SetLastSeq(d.nextSeq)
+
+	var userBytes int64
+	for _, e := range entries {
+		d.memtable.Apply(e)
+		userBytes += int64(len(e.Key) + len(e.Value))
+	}
+	d.keysWritten.Add(uint64(len(entries)))
+	d.bytesWritten.Add(uint64(userBytes))
+	d.reportWriteBuffer()
+	d.notifyReplicated(entries)
+
+	// Replicas can in turn be streamed from
+	if d.backlog != nil {
+		d.backlog.add(entries)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitsSince(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := db.Open(db.WithDBPath(dir), db.WithReplicationBacklog(4))
+	require.NoError(t, err)
+
+	entries, more, err := primary.CommitsSince(0)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.NoError(t, primary.Put([]byte("a"), []byte("1")))
+	<-more
+	require.NoError(t, primary.DeleteRange([]byte("b"), []byte("c")))
+	require.NoError(t, primary.Delete([]byte("a")))
+
+	entries, _, err = primary.CommitsSince(1)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, common.EntryTypeRangeDelete, entries[0].Type)
+	require.Equal(t, uint64(3), entries[1].Seq)
+
+	// Old commits leave the backlog, and a sequence number from the future
+	// is never in it
+	for i := range 10 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%d", i)), []byte("v")))
+	}
+	_, _, err = primary.CommitsSince(0)
+	require.ErrorIs(t, err, db.ErrNotInBacklog)
+	_, _, err = primary.CommitsSince(primary.LastSeq() + 1)
+	require.ErrorIs(t, err, db.ErrNotInBacklog)
+	entries, _, err = primary.CommitsSince(primary.LastSeq() - 4)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.NoError(t, primary.Close())
+
+	plain, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer plain.Close()
+	_, _, err = plain.CommitsSince(0)
+	require.ErrorIs(t, err, db.ErrNoBacklog)
+}
+
+func TestApplyReplicated(t *testing.T) {
+	dir := t.TempDir()
+	opts := []db.Option{db.WithDBPath(dir), db.WithMemtableFlushThreshold(4)}
+	replica, err := db.Open(opts...)
+	require.NoError(t, err)
+
+	var entries []*common.Entry
+	for i := range 10 {
+		entries = append(entries, &common.Entry{
+			Type:      common.EntryTypePut,
+			Seq:       uint64(10 + i),
+			Timestamp: int64(i),
+			Key:       []byte(fmt.Sprintf("key%d", i)),
+			Value:     []byte("v"),
+		})
+	}
+	entries = append(entries, &common.Entry{Type: common.EntryTypeDelete, Seq: 20, Key: []byte("key0")})
+	for i := 0; i < len(entries); i += 3 {
+		require.NoError(t, replica.ApplyReplicated(entries[i:min(i+3, len(entries))], db.DefaultWriteOptions))
+	}
+	// Batches already applied are skipped
+	require.NoError(t, replica.ApplyReplicated(entries[:5], db.DefaultWriteOptions))
+	require.Equal(t, uint64(20), replica.LastSeq())
+
+	check := func(d *db.DB) {
+		_, err := d.Get([]byte("key0"))
+		require.ErrorIs(t, err, db.ErrNotFound)
+		entry, err := d.GetEntry([]byte("key5"))
+		require.NoError(t, err)
+		require.Equal(t, uint64(15), entry.Seq)
+		require.Equal(t, int64(5), entry.Timestamp)
+	}
+	check(replica)
+	require.NoError(t, replica.Close())
+
+	// Applied entries are as durable as any other write
+	replica, err = db.Open(opts...)
+	require.NoError(t, err)
+	defer replica.Close()
+	require.Equal(t, uint64(20), replica.LastSeq())
+	check(replica)
+}
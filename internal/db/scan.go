@@ -0,0 +1,307 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/manifest"
+	"amethyst/internal/sstable"
+)
+
+// Predicate decides whether a live key/value pair should be returned by Scan.
+// It is evaluated inside the iteration loop, so non-matching entries are never
+// copied out to the caller.
+type Predicate func(key, value []byte) bool
+
+// KeyPrefix matches keys that start with prefix.
+func KeyPrefix(prefix []byte) Predicate {
+	return func(key, _ []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	}
+}
+
+// KeyRange matches keys in [start, end). A nil bound is unbounded on that side.
+// ScanRange walks such a range without reading the rest of the keyspace.
+func KeyRange(start, end []byte) Predicate {
+	return func(key, _ []byte) bool {
+		if start != nil && bytes.Compare(key, start) < 0 {
+			return false
+		}
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			return false
+		}
+		return true
+	}
+}
+
+// ValueRange matches values in [lo, hi) using bytewise comparison.
+// A nil bound is unbounded on that side.
+func ValueRange(lo, hi []byte) Predicate {
+	return func(_, value []byte) bool {
+		if lo != nil && bytes.Compare(value, lo) < 0 {
+			return false
+		}
+		if hi != nil && bytes.Compare(value, hi) >= 0 {
+			return false
+		}
+		return true
+	}
+}
+
+// And matches when every predicate matches. An empty And matches everything.
+func And(preds ...Predicate) Predicate {
+	return func(key, value []byte) bool {
+		for _, p := range preds {
+			if !p(key, value) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// newMergedIterator builds a merging iterator over the memtables and every
+// SSTable in the current version, ordered newest first so the merge keeps
+// only the latest entry per key. A non-nil prefix limits it to the keys
+// starting with prefix and leaves out tables that can't hold any, and the
+// bounds in opts leave out the tables outside them. Entries that expired or were deleted by
+// range tombstones come back as point tombstones, and blob references are resolved to their
+// values. The version stays pinned until the iterator
+// is closed, so compactions committed meanwhile cannot close its tables.
+// Open iterators and their tables are counted in Stats.
+func (d *DB) newMergedIterator(opts ReadOptions, prefix []byte) (iterator.Iterator, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var children []common.EntryIterator
+	mems := d.memtables()
+	for _, mem := range mems {
+		children = append(children, mem.Iterator())
+	}
+	memtables := len(children)
+
+	version := d.manifest.Ref()
+	fail := func(err error) (iterator.Iterator, error) {
+		iterator.NewMergingIterator(children...).Close()
+		d.manifest.Unref(version)
+		return nil, err
+	}
+
+	// Tables left out may still hold range tombstones over the ones read
+	rangeDels, err := d.rangeTombstones(mems, version, ReadAllTier)
+	if err != nil {
+		return fail(err)
+	}
+	for level, fileMetas := range version.Levels {
+		for _, fm := range newestFirst(level, fileMetas) {
+			if prefix != nil && !prefixInRange(prefix, fm) {
+				continue
+			}
+			if !boundsOverlap(opts.LowerBound, opts.UpperBound, fm) {
+				continue
+			}
+			table, err := d.manifest.GetTable(fm.FileNo, level)
+			if err != nil {
+				return fail(fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err))
+			}
+			if prefix != nil && !d.mayContainPrefix(table, fm, prefix) {
+				continue
+			}
+			children = append(children, table.IteratorWithOptions(opts.table()))
+		}
+	}
+
+	tables := int64(len(children) - memtables)
+	d.openIterators.Add(1)
+	d.pinnedTables.Add(tables)
+
+	merged := iterator.NewBoundedMergingIterator(opts.LowerBound, opts.UpperBound, children...)
+	if prefix != nil {
+		merged = &prefixIterator{Iterator: merged, prefix: prefix}
+	}
+	merged = &rangeDelIterator{Iterator: merged, rangeDels: rangeDels}
+	merged = &expiryIterator{Iterator: merged, now: time.Now().UnixNano()}
+	it := &pinnedIterator{
+		Iterator: &blobResolvingIterator{Iterator: merged, d: d},
+		release: func() {
+			d.manifest.Unref(version)
+			d.openIterators.Add(-1)
+			d.pinnedTables.Add(-tables)
+		},
+	}
+	if d.Opts.WarnIteratorLeaks {
+		stack := debug.Stack()
+		runtime.SetFinalizer(it, func(it *pinnedIterator) {
+			d.logger("scan").Log(common.LevelWarn, "iterator garbage-collected without Close", "opened_at", stack)
+			it.Close()
+		})
+	}
+	return it, nil
+}
+
+// pinnedIterator releases the version it reads from once closed.
+type pinnedIterator struct {
+	iterator.Iterator
+	release func()
+	once    sync.Once
+}
+
+func (it *pinnedIterator) Close() error {
+	err := it.Iterator.Close()
+	it.once.Do(func() {
+		runtime.SetFinalizer(it, nil)
+		it.release()
+	})
+	return err
+}
+
+// NewIterator returns an iterator over every live key in order, merging the
+// memtable and all levels so each key appears once, at its newest version.
+// Tombstoned keys are skipped. Entries are copies the caller may keep.
+// Like Scan, it reads a pinned version: writes and compactions that commit
+// after it is created aren't seen, and the files it reads stay on disk
+// until it is closed.
+func (d *DB) NewIterator() (iterator.Iterator, error) {
+	return d.NewIteratorWithOptions(DefaultReadOptions)
+}
+
+// NewIteratorWithOptions is like NewIterator but reads as opts specify.
+func (d *DB) NewIteratorWithOptions(opts ReadOptions) (iterator.Iterator, error) {
+	iter, err := d.newMergedIterator(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &liveIterator{Iterator: iter}, nil
+}
+
+// NewPrefixIterator is like NewIterator but returns only the keys starting
+// with prefix. Tables whose key range excludes prefix are skipped, as are,
+// when prefix is a whole prefix of the PrefixExtractor, tables whose bloom
+// filter rules it out.
+func (d *DB) NewPrefixIterator(prefix []byte) (iterator.Iterator, error) {
+	iter, err := d.newMergedIterator(DefaultReadOptions, bytes.Clone(prefix))
+	if err != nil {
+		return nil, err
+	}
+	return &liveIterator{Iterator: iter}, nil
+}
+
+// boundsOverlap reports whether fm's key range overlaps [lower, upper), a
+// nil bound leaving that side open.
+func boundsOverlap(lower, upper []byte, fm manifest.FileMetadata) bool {
+	if lower != nil && bytes.Compare(fm.LargestKey, lower) < 0 {
+		return false
+	}
+	return upper == nil || bytes.Compare(fm.SmallestKey, upper) < 0
+}
+
+// prefixInRange reports whether fm's key range may hold keys starting with
+// prefix.
+func prefixInRange(prefix []byte, fm manifest.FileMetadata) bool {
+	if bytes.Compare(fm.LargestKey, prefix) < 0 {
+		return false
+	}
+	return bytes.Compare(fm.SmallestKey, prefix) < 0 || bytes.HasPrefix(fm.SmallestKey, prefix)
+}
+
+// mayContainPrefix consults table's bloom filter for prefix. The filter only
+// answers for keys whose extracted prefix is exactly prefix, so it is used
+// when table was written with the configured extractor and that extractor
+// maps prefix to itself; otherwise the table may hold the prefix.
+func (d *DB) mayContainPrefix(table sstable.SSTable, fm manifest.FileMetadata, prefix []byte) bool {
+	extractor := d.Opts.PrefixExtractor
+	if extractor == nil || fm.PrefixExtractor != extractor.Name() {
+		return true
+	}
+	if p, ok := extractor.Prefix(prefix); !ok || !bytes.Equal(p, prefix) {
+		return true
+	}
+	return table.MayContainPrefix(prefix)
+}
+
+// prefixIterator yields the entries whose keys start with prefix, stopping
+// at the first key past them.
+type prefixIterator struct {
+	iterator.Iterator
+	prefix []byte
+}
+
+func (it *prefixIterator) Next() (*common.Entry, error) {
+	for {
+		entry, err := it.Iterator.Next()
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(entry.Key, it.prefix) {
+			return entry, nil
+		}
+		if bytes.Compare(entry.Key, it.prefix) > 0 {
+			return nil, nil
+		}
+	}
+}
+
+// liveIterator skips tombstones and copies the entries it returns.
+type liveIterator struct {
+	iterator.Iterator
+}
+
+func (it *liveIterator) Next() (*common.Entry, error) {
+	for {
+		entry, err := it.Iterator.Next()
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		if entry.Type != common.EntryTypeDelete {
+			return cloneEntry(entry), nil
+		}
+	}
+}
+
+// Scan walks every live key in order and returns the entries for which pred
+// returns true. Tombstoned keys are skipped. A nil pred matches everything;
+// limit <= 0 means no limit. Scan reads every table; ScanRange reads only
+// the part of the keyspace a range of keys can be in.
+func (d *DB) Scan(pred Predicate, limit int) ([]*common.Entry, error) {
+	return d.ScanRange(nil, nil, pred, limit)
+}
+
+// ScanRange is like Scan but walks only the keys in [start, end), seeking
+// to start and stopping at end rather than filtering every key. A nil bound
+// is unbounded on that side.
+func (d *DB) ScanRange(start, end []byte, pred Predicate, limit int) ([]*common.Entry, error) {
+	opts := DefaultReadOptions
+	opts.LowerBound, opts.UpperBound = start, end
+	iter, err := d.newMergedIterator(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var results []*common.Entry
+	for limit <= 0 || len(results) < limit {
+		entry, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Type == common.EntryTypeDelete {
+			continue
+		}
+		if pred != nil && !pred(entry.Key, entry.Value) {
+			continue
+		}
+
+		results = append(results, cloneEntry(entry))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,217 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanAcrossMemtableAndSSTables(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+
+	// Spread writes over several flushes so keys live in L0 and the memtable
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("v%02d", i))))
+	}
+
+	// Overwrite and delete keys that already reached SSTables
+	require.NoError(t, d.Put([]byte("key01"), []byte("updated")))
+	require.NoError(t, d.Delete([]byte("key02")))
+
+	entries, err := d.Scan(nil, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 9)
+
+	for i := 1; i < len(entries); i++ {
+		require.Less(t, string(entries[i-1].Key), string(entries[i].Key), "scan must be ordered")
+	}
+	require.Equal(t, "key01", string(entries[1].Key))
+	require.Equal(t, "updated", string(entries[1].Value))
+	require.Equal(t, "key03", string(entries[2].Key), "deleted key02 must be skipped")
+}
+
+func TestNewIterator(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(4))
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 12; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("v%02d", i))))
+	}
+	require.NoError(t, d.Compact())
+	for i := 0; i < 12; i += 3 {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("new")))
+	}
+	require.NoError(t, d.Delete([]byte("key04")))
+	require.NoError(t, d.Delete([]byte("key05")))
+
+	iter, err := d.NewIterator()
+	require.NoError(t, err)
+
+	// Writes after creation aren't seen
+	require.NoError(t, d.Put([]byte("key99"), []byte("late")))
+
+	var got []string
+	for {
+		entry, err := iter.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			break
+		}
+		got = append(got, fmt.Sprintf("%s=%s", entry.Key, entry.Value))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{
+		"key00=new", "key01=v01", "key02=v02", "key03=new", "key06=new", "key07=v07",
+		"key08=v08", "key09=new", "key10=v10", "key11=v11",
+	}, got)
+}
+
+func TestScanRange(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(4), db.WithL0CompactionTrigger(100))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Keys written in order, so each table holds its own slice of them
+	for i := 0; i < 20; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("v%02d", i))))
+	}
+	require.NoError(t, d.Delete([]byte("key05")))
+	require.NoError(t, d.Put([]byte("key07"), []byte("new")))
+
+	entries, err := d.ScanRange([]byte("key04"), []byte("key10"), nil, 0)
+	require.NoError(t, err)
+	var got []string
+	for _, entry := range entries {
+		got = append(got, fmt.Sprintf("%s=%s", entry.Key, entry.Value))
+	}
+	require.Equal(t, []string{"key04=v04", "key06=v06", "key07=new", "key08=v08", "key09=v09"}, got)
+
+	entries, err = d.ScanRange([]byte("key18"), nil, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	entries, err = d.ScanRange(nil, []byte("key03"), nil, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// A bounded iterator only opens the tables overlapping its range
+	overlapping, tables := 0, 0
+	for _, fileMetas := range d.Manifest().Current().Levels {
+		for _, fm := range fileMetas {
+			tables++
+			if string(fm.LargestKey) >= "key04" && string(fm.SmallestKey) < "key10" {
+				overlapping++
+			}
+		}
+	}
+	require.Less(t, overlapping, tables)
+	opts := db.DefaultReadOptions
+	opts.LowerBound, opts.UpperBound = []byte("key04"), []byte("key10")
+	iter, err := d.NewIteratorWithOptions(opts)
+	require.NoError(t, err)
+	require.Equal(t, overlapping, d.Stats().PinnedTables)
+	entry, err := iter.Next()
+	require.NoError(t, err)
+	require.Equal(t, "key04", string(entry.Key))
+	require.NoError(t, iter.Close())
+}
+
+func TestScanPredicates(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(3))
+	require.NoError(t, err)
+
+	data := map[string]string{
+		"user:1":  "alice",
+		"user:2":  "bob",
+		"user:3":  "carol",
+		"order:1": "apples",
+		"order:2": "bananas",
+	}
+	for k, v := range data {
+		require.NoError(t, d.Put([]byte(k), []byte(v)))
+	}
+
+	tests := []struct {
+		name     string
+		pred     db.Predicate
+		limit    int
+		expected []string
+	}{
+		{"All", nil, 0, []string{"order:1", "order:2", "user:1", "user:2", "user:3"}},
+		{"KeyPrefix", db.KeyPrefix([]byte("user:")), 0, []string{"user:1", "user:2", "user:3"}},
+		{"ValueRange", db.ValueRange([]byte("b"), []byte("c")), 0, []string{"order:2", "user:2"}},
+		{"ValueRangeOpenEnded", db.ValueRange([]byte("bob"), nil), 0, []string{"user:2", "user:3"}},
+		{"And", db.And(db.KeyPrefix([]byte("user:")), db.ValueRange(nil, []byte("c"))), 0, []string{"user:1", "user:2"}},
+		{"Limit", db.KeyPrefix([]byte("user:")), 2, []string{"user:1", "user:2"}},
+		{"NoMatch", db.KeyPrefix([]byte("missing")), 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := d.Scan(tt.pred, tt.limit)
+			require.NoError(t, err)
+
+			var keys []string
+			for _, e := range entries {
+				keys = append(keys, string(e.Key))
+				require.Equal(t, data[string(e.Key)], string(e.Value))
+			}
+			require.Equal(t, tt.expected, keys)
+		})
+	}
+}
+
+func TestNewPrefixIterator(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor common.PrefixExtractor
+		prefix    string
+		keys      []string
+		tables    int
+	}{
+		{"no extractor", nil, "b:", []string{"b:1", "b:2"}, 2},
+		{"delimited extractor", common.NewDelimitedPrefixExtractor(':'), "b:", []string{"b:1", "b:2"}, 1},
+		{"fixed extractor", common.NewFixedPrefixExtractor(2), "b:", []string{"b:1", "b:2"}, 1},
+		{"partial prefix", common.NewDelimitedPrefixExtractor(':'), "b", []string{"b:1", "b:2"}, 2},
+		{"absent prefix", common.NewDelimitedPrefixExtractor(':'), "x:", nil, 0},
+		{"prefix in memtable", common.NewDelimitedPrefixExtractor(':'), "d:", []string{"d:1"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.Open(
+				db.WithDBPath(t.TempDir()),
+				db.WithMemtableFlushThreshold(2),
+				db.WithPrefixExtractor(tt.extractor),
+			)
+			require.NoError(t, err)
+			defer d.Close()
+
+			// Both tables span "b:", but only the second holds it
+			for _, key := range []string{"a:1", "c:1", "b:1", "b:2", "d:1"} {
+				require.NoError(t, d.Put([]byte(key), []byte("v")))
+			}
+			d.WaitForCompactions()
+			require.Len(t, d.Manifest().Current().Levels[0], 2)
+
+			iter, err := d.NewPrefixIterator([]byte(tt.prefix))
+			require.NoError(t, err)
+			defer iter.Close()
+			require.Equal(t, tt.tables, d.Stats().PinnedTables)
+
+			var keys []string
+			for {
+				entry, err := iter.Next()
+				require.NoError(t, err)
+				if entry == nil {
+					break
+				}
+				keys = append(keys, string(entry.Key))
+			}
+			require.Equal(t, tt.keys, keys)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/wal"
+)
+
+// ErrNotSecondary is returned by CatchUp on a DB not opened with
+// OpenSecondary.
+var ErrNotSecondary = errors.New("db: not a secondary instance")
+
+// secondaryState tracks how far a secondary has read its primary's files.
+type secondaryState struct {
+	mu      sync.Mutex      // serializes catch-ups
+	wals    []common.FileNo // the live WALs the memtable was read from
+	tailers []*wal.Tailer   // one per WAL in wals
+}
+
+// OpenSecondary opens the database at primaryPath, which a primary may have
+// open for writing in another process, as a read-only secondary. Unlike a
+// read-only open it keeps up with the primary: every
+// SecondaryCatchUpInterval it rereads the manifest and reads the records
+// appended to the live WALs since, so reads see the primary's writes once
+// its OS holds them, a little later. It suits read replicas on the same host,
+// which share the primary's files rather than copying them.
+//
+// A secondary never writes to the directory. The primary deletes the files
+// compactions replace without regard for it, so a read racing a catch-up may
+// fail to open a table just deleted; the tables of each version are opened
+// as it is loaded, so those the table cache keeps open stay readable. The
+// primary must not recycle WALs, which a secondary could read before they
+// are wiped.
+func OpenSecondary(primaryPath string, optFns ...Option) (*DB, error) {
+	opts := DefaultOptions
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	opts.DBPath = primaryPath
+	opts.ReadOnly = true
+
+	db, err := newReadOnlyDB(opts, common.NewPathManager(primaryPath), opts.env())
+	if err != nil {
+		return nil, err
+	}
+	db.secondary = &secondaryState{}
+	if err := db.CatchUp(); err != nil {
+		return nil, err
+	}
+	if opts.SecondaryCatchUpInterval > 0 {
+		db.bgWG.Add(1)
+		go db.catchUpLoop(opts.SecondaryCatchUpInterval)
+	}
+
+	db.logger("secondary").Log(common.LevelInfo, "opened secondary", "seq", db.nextSeq)
+	return db, nil
+}
+
+// CatchUp brings a secondary up to date with what its primary has
+// persisted: the latest manifest, and the WAL records written since the
+// last catch-up. When the primary has flushed or rotated its memtable, the
+// memtable is rebuilt from the WALs now live. If it fails the secondary
+// keeps serving its previous state, and a later catch-up can try again.
+func (d *DB) CatchUp() error {
+	s := d.secondary
+	if s == nil {
+		return ErrNotSecondary
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := loadManifest(d.fs, d.paths)
+	if err != nil {
+		return err
+	}
+
+	// The memtable is only replaced under s.mu, so reading it here is safe
+	mem, tailers := d.memtable, s.tailers
+	live := version.LiveWALs()
+	if !slices.Equal(live, s.wals) {
+		mem, tailers = d.newMemtable(), nil
+		for _, num := range live {
+			tailers = append(tailers, wal.NewTailer(d.fs, d.paths.WALPath(num)))
+		}
+	}
+	var maxSeq uint64
+	for _, t := range tailers {
+		entries, err := t.ReadNew()
+		for _, entry := range entries {
+			mem.Apply(entry)
+			maxSeq = max(maxSeq, entry.Seq)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read WAL: %w", err)
+		}
+	}
+
+	for level, fileMetas := range version.Levels {
+		for _, fm := range fileMetas {
+			if _, err := d.manifest.GetTable(fm.FileNo, level); err != nil {
+				return fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.manifest.LoadVersion(version)
+	d.memtable = mem
+	d.publishMemtables()
+	d.nextSeq = max(d.nextSeq, maxSeq, version.MaxSeq(), version.LastSeq)
+	d.mu.Unlock()
+
+	s.wals, s.tailers = live, tailers
+	return nil
+}
+
+// catchUpLoop catches up every interval until the DB is closed.
+func (d *DB) catchUpLoop(interval time.Duration) {
+	defer d.bgWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.closeCh:
+			return
+		case <-ticker.C:
+			if err := d.CatchUp(); err != nil {
+				d.logger("secondary").Log(common.LevelError, "catch-up failed", "err", err)
+			}
+		}
+	}
+}
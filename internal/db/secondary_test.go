@@ -0,0 +1,76 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecondaryCatchesUp(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(10))
+	require.NoError(t, err)
+	defer primary.Close()
+	for i := range 5 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v1")))
+	}
+
+	secondary, err := db.OpenSecondary(dir, db.WithSecondaryCatchUpInterval(0))
+	require.NoError(t, err)
+	defer secondary.Close()
+	value, err := secondary.Get([]byte("key04"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(value))
+
+	// Writes in the live WAL show up once the secondary catches up
+	require.NoError(t, primary.Put([]byte("key05"), []byte("v1")))
+	_, err = secondary.Get([]byte("key05"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	require.NoError(t, secondary.CatchUp())
+	value, err = secondary.Get([]byte("key05"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(value))
+
+	// So do flushes and compactions, which retire WALs and tables
+	for i := range 60 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v2")))
+	}
+	require.NoError(t, primary.Delete([]byte("key00")))
+	primary.WaitForCompactions()
+	require.NoError(t, secondary.CatchUp())
+	require.Equal(t, primary.LastSeq(), secondary.LastSeq())
+	_, err = secondary.Get([]byte("key00"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	for i := 1; i < 60; i++ {
+		value, err := secondary.Get([]byte(fmt.Sprintf("key%02d", i)))
+		require.NoError(t, err)
+		require.Equal(t, "v2", string(value))
+	}
+
+	require.ErrorIs(t, secondary.Put([]byte("key"), []byte("v")), db.ErrReadOnly)
+	require.ErrorIs(t, primary.CatchUp(), db.ErrNotSecondary)
+}
+
+func TestSecondaryCatchesUpInBackground(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := db.Open(db.WithDBPath(dir), db.WithMemtableFlushThreshold(10))
+	require.NoError(t, err)
+	defer primary.Close()
+
+	secondary, err := db.OpenSecondary(dir, db.WithSecondaryCatchUpInterval(time.Millisecond))
+	require.NoError(t, err)
+	defer secondary.Close()
+
+	for i := range 30 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("v")))
+	}
+	require.Eventually(t, func() bool {
+		return secondary.LastSeq() == primary.LastSeq()
+	}, 10*time.Second, time.Millisecond)
+	value, err := secondary.Get([]byte("key29"))
+	require.NoError(t, err)
+	require.Equal(t, "v", string(value))
+}
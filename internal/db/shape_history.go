@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/vfs"
+)
+
+// LevelShape is the size of one level at a point in time.
+type LevelShape struct {
+	Files int    `json:"files"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// ShapeRecord is one line of the SHAPE_HISTORY sidecar: the shape of every
+// level right after a flush or compaction.
+type ShapeRecord struct {
+	Time   time.Time    `json:"time"`
+	Event  string       `json:"event"`
+	Levels []LevelShape `json:"levels"`
+}
+
+// recordShape appends the current level shape to the history sidecar when
+// enabled. History is diagnostic only, so failures are logged, not returned.
+// Must be called with d.mu held.
+func (d *DB) recordShape(event string) {
+	if !d.Opts.RecordShapeHistory {
+		return
+	}
+
+	record := ShapeRecord{Time: time.Now(), Event: event}
+	for _, fileMetas := range d.manifest.Current().Levels {
+		shape := LevelShape{Files: len(fileMetas)}
+		for _, fm := range fileMetas {
+			shape.Bytes += fm.Size
+		}
+		record.Levels = append(record.Levels, shape)
+	}
+
+	if err := appendShapeRecord(d.fs, d.paths.ShapeHistoryPath(), &record); err != nil {
+		d.logger("shape").Log(common.LevelError, "failed to record shape history", "err", err)
+	}
+}
+
+func appendShapeRecord(fsys vfs.FS, path string, record *ShapeRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadShapeHistory reads every record from the SHAPE_HISTORY file at path in
+// fsys, oldest first.
+func ReadShapeHistory(fsys vfs.FS, path string) ([]ShapeRecord, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []ShapeRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var record ShapeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,64 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShapeHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []db.Option
+		enabled bool
+	}{
+		{"disabled", nil, false},
+		{"enabled", []db.Option{db.WithShapeHistory()}, true},
+		{"in memory", []db.Option{db.WithShapeHistory(), db.WithEnv(db.NewEnvWithFS(vfs.NewMemFS()))}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := append([]db.Option{
+				db.WithDBPath(dir),
+				db.WithMemtableFlushThreshold(2),
+				db.WithL0CompactionTrigger(100),
+			}, tt.options...)
+			d, err := db.Open(opts...)
+			require.NoError(t, err)
+			defer d.Close()
+
+			for i := 0; i < 5; i++ {
+				require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("v")))
+			}
+			require.NoError(t, d.Compact())
+
+			path := filepath.Join(dir, "SHAPE_HISTORY")
+			records, err := db.ReadShapeHistory(d.FS(), path)
+			if !tt.enabled {
+				require.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+
+			// Two flushes during writes, one from Compact, then the compactions
+			require.Equal(t, "flush", records[0].Event)
+			require.Equal(t, 1, records[0].Levels[0].Files)
+			require.Positive(t, records[0].Levels[0].Bytes)
+			require.Equal(t, "flush", records[2].Event)
+			require.Equal(t, 3, records[2].Levels[0].Files)
+
+			last := records[len(records)-1]
+			require.Equal(t, "compaction", last.Event)
+			require.Zero(t, last.Levels[0].Files)
+			bottom := last.Levels[len(last.Levels)-1]
+			require.Positive(t, bottom.Files)
+		})
+	}
+}
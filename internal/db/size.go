@@ -0,0 +1,26 @@
+package db
+
+import "bytes"
+
+// ApproximateSize returns the on-disk bytes of SSTables whose key range
+// overlaps [start, end). Files are counted whole and the memtable is ignored,
+// so the result is an upper bound on the flushed data in the range. A nil
+// bound is unbounded on that side.
+func (d *DB) ApproximateSize(start, end []byte) uint64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var size uint64
+	for _, fileMetas := range d.manifest.Current().Levels {
+		for _, fm := range fileMetas {
+			if start != nil && bytes.Compare(fm.LargestKey, start) < 0 {
+				continue
+			}
+			if end != nil && bytes.Compare(fm.SmallestKey, end) >= 0 {
+				continue
+			}
+			size += fm.Size
+		}
+	}
+	return size
+}
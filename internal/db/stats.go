@@ -0,0 +1,106 @@
+package db
+
+import (
+	"amethyst/internal/block_cache"
+	"amethyst/internal/table_cache"
+)
+
+// Stats reports resource usage and activity of a DB instance.
+type Stats struct {
+	// Levels holds the tables at each level, top first.
+	Levels []LevelStats
+
+	// MemtableBytes is the memory held by the memtable and the
+	// ImmutableMemtables full ones waiting to be flushed.
+	MemtableBytes      int
+	ImmutableMemtables int
+	// WALBytes is the combined size of the live WALs.
+	WALBytes int64
+
+	// Flushes and Compactions count the ones completed since Open.
+	Flushes     uint64
+	Compactions uint64
+
+	// Gets counts point lookups since Open, and KeysWritten and BytesWritten
+	// the entries committed and their key and value bytes.
+	Gets         uint64
+	KeysWritten  uint64
+	BytesWritten uint64
+
+	// WriteQueueDepth is the number of writes waiting to be committed, and
+	// PeakWriteQueueDepth the most there have been since Open.
+	// StalledWrites counts the writes failed with ErrWriteStalled.
+	WriteQueueDepth     int
+	PeakWriteQueueDepth int
+	StalledWrites       uint64
+
+	// BlockCache counts lookups in the block cache and the blocks it has
+	// stored and evicted, and BlockCacheUsage is the bytes it holds.
+	// TableCache and OpenTables do the same for the table cache. Caches
+	// shared through an Env count the activity of every instance using them.
+	BlockCache      block_cache.Stats
+	BlockCacheUsage int64
+	TableCache      table_cache.Stats
+	OpenTables      int
+
+	// OpenIterators is the number of iterators not yet closed.
+	OpenIterators int
+	// PinnedTables is the number of SSTable handles those iterators hold.
+	// Tables a compaction has since deleted stay open until released.
+	PinnedTables int
+	// ObsoleteTables is the number of compacted-away SSTables whose files
+	// are kept until the iterators reading them are closed.
+	ObsoleteTables int
+}
+
+// LevelStats describes the tables in one level.
+type LevelStats struct {
+	Files int
+	Bytes uint64
+}
+
+// Stats returns a snapshot of the instance's resource usage.
+func (d *DB) Stats() Stats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	v := d.manifest.Current()
+	stats := Stats{
+		Levels:             make([]LevelStats, len(v.Levels)),
+		MemtableBytes:      d.memtableSize(),
+		ImmutableMemtables: len(d.immutable),
+		Flushes:            d.flushes.Load(),
+		Compactions:        d.compactions.Load(),
+		Gets:               d.gets.Load(),
+		KeysWritten:        d.keysWritten.Load(),
+		BytesWritten:       d.bytesWritten.Load(),
+
+		WriteQueueDepth:     int(d.queuedWrites.Load()),
+		PeakWriteQueueDepth: int(d.peakQueuedWrites.Load()),
+		StalledWrites:       d.stalledWrites.Load(),
+
+		OpenIterators:  int(d.openIterators.Load()),
+		PinnedTables:   int(d.pinnedTables.Load()),
+		ObsoleteTables: d.manifest.ObsoleteTables(),
+	}
+	for level, fileMetas := range v.Levels {
+		stats.Levels[level].Files = len(fileMetas)
+		for _, fm := range fileMetas {
+			stats.Levels[level].Bytes += fm.Size
+		}
+	}
+	for _, num := range v.LiveWALs() {
+		if info, err := d.fs.Stat(d.paths.WALPath(num)); err == nil {
+			stats.WALBytes += info.Size()
+		}
+	}
+	if d.blockCache != nil {
+		stats.BlockCache = d.blockCache.Stats()
+		stats.BlockCacheUsage = d.blockCache.Usage()
+	}
+	if d.tableCache != nil {
+		stats.TableCache = d.tableCache.Stats()
+		stats.OpenTables = d.tableCache.Len()
+	}
+	return stats
+}
@@ -0,0 +1,55 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(2),
+		db.WithL0CompactionTrigger(100),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Two full memtables are flushed and the fifth write stays in the third
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+
+	// The first read of a flushed key misses the block cache, the second hits
+	for i := 0; i < 2; i++ {
+		_, err := d.Get([]byte("key0"))
+		require.NoError(t, err)
+	}
+
+	stats := d.Stats()
+	require.Equal(t, 2, stats.Levels[0].Files)
+	require.Equal(t, d.ApproximateSize(nil, nil), stats.Levels[0].Bytes)
+	require.Equal(t, uint64(2), stats.Flushes)
+	require.Zero(t, stats.Compactions)
+	require.Zero(t, stats.ImmutableMemtables)
+	require.Positive(t, stats.MemtableBytes)
+	require.Positive(t, stats.WALBytes)
+	require.Equal(t, uint64(2), stats.Gets)
+	require.Equal(t, uint64(5), stats.KeysWritten)
+	require.Equal(t, uint64(5*len("key0value")), stats.BytesWritten)
+	require.Equal(t, uint64(1), stats.BlockCache.Hits)
+	require.Equal(t, uint64(1), stats.BlockCache.Misses)
+	require.Equal(t, 0.5, stats.BlockCache.HitRate())
+	require.Equal(t, uint64(1), stats.BlockCache.Inserts)
+	require.Zero(t, stats.BlockCache.Evictions)
+	require.Positive(t, stats.BlockCacheUsage)
+	require.Equal(t, stats.OpenTables, int(stats.TableCache.Inserts))
+	require.Positive(t, stats.TableCache.Hits)
+	require.Zero(t, stats.TableCache.Evictions)
+
+	require.NoError(t, d.Compact())
+	require.Positive(t, d.Stats().Compactions)
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"amethyst/internal/common"
+)
+
+var (
+	// ErrDeadlock is returned when waiting for a key lock would close a
+	// cycle of transactions waiting on each other. The transaction keeps
+	// the locks it holds; roll it back so the others can proceed.
+	ErrDeadlock = errors.New("db: deadlock detected")
+	// ErrTxnDone is returned by operations on a committed or rolled back
+	// transaction.
+	ErrTxnDone = errors.New("db: transaction already committed or rolled back")
+)
+
+// TransactionOptions configure a transaction.
+type TransactionOptions struct {
+	// LockTimeout fails an operation with ErrLockTimeout if the key lock it
+	// needs isn't granted within that long. 0 waits until the lock is free
+	// or the wait is found to deadlock.
+	LockTimeout time.Duration
+
+	// WriteOptions control how the transaction's writes are committed.
+	WriteOptions WriteOptions
+}
+
+// DefaultTransactionOptions wait for locks indefinitely and sync the commit.
+var DefaultTransactionOptions = TransactionOptions{WriteOptions: DefaultWriteOptions}
+
+// Transaction is a pessimistic transaction: it locks each key it reads or
+// writes as it does so, and holds the locks until it commits or rolls back.
+// Transactions touching a common key thus run one after another, so their
+// commits are serializable. Writes are buffered and committed atomically.
+//
+// The key locks are range locks, so they also exclude overlapping locks
+// taken with LockRange; plain reads and writes ignore them. A Transaction
+// is not safe for concurrent use.
+type Transaction struct {
+	db     *DB
+	opts   TransactionOptions
+	writes map[string]*common.Entry // buffered writes, by key
+	order  []*common.Entry          // buffered writes, first written first
+	locks  map[string]*RangeLock    // key locks held, to release when done
+	done   bool
+}
+
+// BeginTransaction starts a pessimistic transaction.
+func (d *DB) BeginTransaction(opts TransactionOptions) *Transaction {
+	return &Transaction{
+		db:     d,
+		opts:   opts,
+		writes: make(map[string]*common.Entry),
+		locks:  make(map[string]*RangeLock),
+	}
+}
+
+// Get locks key and returns its value as the transaction sees it: its own
+// buffered write if it has one, else the latest committed value, which no
+// other transaction can change until this one ends.
+func (t *Transaction) Get(key []byte) ([]byte, error) {
+	if err := t.lock(key); err != nil {
+		return nil, err
+	}
+	if entry, ok := t.writes[string(key)]; ok {
+		if entry.Type == common.EntryTypeDelete {
+			return nil, ErrNotFound
+		}
+		return bytes.Clone(entry.Value), nil
+	}
+	return t.db.Get(key)
+}
+
+// Put locks key and buffers a write of value to it.
+func (t *Transaction) Put(key, value []byte) error {
+	return t.write(&common.Entry{
+		Type:  common.EntryTypePut,
+		Key:   bytes.Clone(key),
+		Value: bytes.Clone(value),
+	})
+}
+
+// Delete locks key and buffers its deletion.
+func (t *Transaction) Delete(key []byte) error {
+	return t.write(&common.Entry{
+		Type: common.EntryTypeDelete,
+		Key:  bytes.Clone(key),
+	})
+}
+
+func (t *Transaction) write(entry *common.Entry) error {
+	if len(entry.Key) == 0 {
+		return errors.New("db: key must be non-empty")
+	}
+	if t.db.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if err := t.lock(entry.Key); err != nil {
+		return err
+	}
+	// A later write of a key replaces the earlier one in place, so the
+	// commit applies each key's writes in the order they were first made
+	if prev, ok := t.writes[string(entry.Key)]; ok {
+		*prev = *entry
+		return nil
+	}
+	t.writes[string(entry.Key)] = entry
+	t.order = append(t.order, entry)
+	return nil
+}
+
+// lock acquires the lock on key for t, if it doesn't hold it already.
+func (t *Transaction) lock(key []byte) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if _, ok := t.locks[string(key)]; ok {
+		return nil
+	}
+	// The lock covers just key: [key, key+"\x00")
+	start := bytes.Clone(key)
+	end := append(bytes.Clone(key), 0)
+	l, err := t.db.locks.acquire(start, end, t, t.opts.LockTimeout)
+	if err != nil {
+		return err
+	}
+	t.locks[string(key)] = l
+	return nil
+}
+
+// Commit commits the buffered writes in one atomic batch, then releases the
+// transaction's locks. The locks are released even if the commit fails.
+func (t *Transaction) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.finish()
+
+	if len(t.order) == 0 {
+		return nil
+	}
+	return t.db.submit(context.Background(), &writeRequest{entries: t.order, sync: t.opts.WriteOptions.Sync})
+}
+
+// Rollback discards the buffered writes and releases the transaction's
+// locks. Rolling back a finished transaction does nothing.
+func (t *Transaction) Rollback() {
+	if !t.done {
+		t.finish()
+	}
+}
+
+func (t *Transaction) finish() {
+	t.done = true
+	for _, l := range t.locks {
+		l.Unlock()
+	}
+	t.writes, t.order, t.locks = nil, nil, nil
+}
@@ -0,0 +1,216 @@
+package db_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.Put([]byte("a"), []byte("1")))
+
+	// Writes are buffered, seen by the transaction but no one else
+	txn := d.BeginTransaction(db.DefaultTransactionOptions)
+	require.NoError(t, txn.Put([]byte("b"), []byte("1")))
+	require.NoError(t, txn.Put([]byte("b"), []byte("2")))
+	require.NoError(t, txn.Delete([]byte("a")))
+	value, err := txn.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(value))
+	_, err = txn.Get([]byte("a"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = d.Get([]byte("b"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	require.NoError(t, txn.Commit())
+	value, err = d.Get([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, "2", string(value))
+	_, err = d.Get([]byte("a"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	require.ErrorIs(t, txn.Commit(), db.ErrTxnDone)
+	require.ErrorIs(t, txn.Put([]byte("c"), []byte("1")), db.ErrTxnDone)
+
+	// Rolled back writes are discarded
+	txn = d.BeginTransaction(db.DefaultTransactionOptions)
+	require.NoError(t, txn.Put([]byte("c"), []byte("1")))
+	txn.Rollback()
+	txn.Rollback()
+	_, err = d.Get([]byte("c"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestTransactionLockTimeout(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	holder := d.BeginTransaction(db.DefaultTransactionOptions)
+	require.NoError(t, holder.Put([]byte("k"), []byte("1")))
+
+	// Reads lock as writes do, so a read waits for the writer to finish
+	waiter := d.BeginTransaction(db.TransactionOptions{LockTimeout: 20 * time.Millisecond})
+	_, err = waiter.Get([]byte("k"))
+	require.ErrorIs(t, err, db.ErrLockTimeout)
+
+	// Plain writes ignore the locks
+	require.NoError(t, d.Put([]byte("k"), []byte("0")))
+
+	require.NoError(t, holder.Commit())
+	value, err := waiter.Get([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+	waiter.Rollback()
+}
+
+func TestTransactionDeadlock(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	t1 := d.BeginTransaction(db.DefaultTransactionOptions)
+	t2 := d.BeginTransaction(db.DefaultTransactionOptions)
+	require.NoError(t, t1.Put([]byte("a"), []byte("t1")))
+	require.NoError(t, t2.Put([]byte("b"), []byte("t2")))
+
+	// Each now wants the other's key. Whichever waits second closes the
+	// cycle and fails; once it rolls back, the other gets its lock.
+	errCh := make(chan error, 1)
+	go func() {
+		err := t1.Put([]byte("b"), []byte("t1"))
+		if err != nil {
+			t1.Rollback()
+		}
+		errCh <- err
+	}()
+	err2 := t2.Put([]byte("a"), []byte("t2"))
+	if err2 != nil {
+		t2.Rollback()
+	}
+	err1 := <-errCh
+
+	winner := "t1"
+	if err1 != nil {
+		require.ErrorIs(t, err1, db.ErrDeadlock)
+		require.NoError(t, err2)
+		require.NoError(t, t2.Commit())
+		winner = "t2"
+	} else {
+		require.ErrorIs(t, err2, db.ErrDeadlock)
+		require.NoError(t, t1.Commit())
+	}
+	for _, key := range []string{"a", "b"} {
+		value, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, winner, string(value))
+	}
+}
+
+func TestTransactionsSerializable(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	const accounts, workers, transfers = 4, 4, 25
+	for i := range accounts {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("acct%d", i)), []byte("100")))
+	}
+
+	// Transfers between accounts in both directions deadlock now and then;
+	// the victims retry
+	opts := db.TransactionOptions{WriteOptions: db.WriteOptions{Sync: false}}
+	transfer := func(from, to string) error {
+		txn := d.BeginTransaction(opts)
+		defer txn.Rollback()
+		balances := make(map[string]int)
+		for _, key := range []string{from, to} {
+			value, err := txn.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if balances[key], err = strconv.Atoi(string(value)); err != nil {
+				return err
+			}
+		}
+		if err := txn.Put([]byte(from), []byte(strconv.Itoa(balances[from]-1))); err != nil {
+			return err
+		}
+		if err := txn.Put([]byte(to), []byte(strconv.Itoa(balances[to]+1))); err != nil {
+			return err
+		}
+		return txn.Commit()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range transfers {
+				from := fmt.Sprintf("acct%d", (w+i)%accounts)
+				to := fmt.Sprintf("acct%d", (w+i+1)%accounts)
+				if w%2 == 1 {
+					from, to = to, from
+				}
+				err := transfer(from, to)
+				for err == db.ErrDeadlock {
+					err = transfer(from, to)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	total := 0
+	for i := range accounts {
+		value, err := d.Get([]byte(fmt.Sprintf("acct%d", i)))
+		require.NoError(t, err)
+		n, err := strconv.Atoi(string(value))
+		require.NoError(t, err)
+		total += n
+	}
+	require.Equal(t, accounts*100, total)
+}
+
+func TestTransactionRangeLockConflict(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	const short = 20 * time.Millisecond
+	opts := db.TransactionOptions{LockTimeout: short}
+
+	// A range lock keeps transactions off the keys it covers
+	l, err := d.LockRange([]byte("a"), []byte("c"), 0)
+	require.NoError(t, err)
+	txn := d.BeginTransaction(opts)
+	require.ErrorIs(t, txn.Put([]byte("b"), []byte("v")), db.ErrLockTimeout)
+	require.NoError(t, txn.Put([]byte("c"), []byte("v")))
+	l.Unlock()
+	require.NoError(t, txn.Put([]byte("b"), []byte("v")))
+
+	// And a transaction's key locks keep range locks off them
+	_, err = d.LockRange([]byte("a"), []byte("bb"), short)
+	require.ErrorIs(t, err, db.ErrLockTimeout)
+	require.NoError(t, txn.Commit())
+	l, err = d.LockRange([]byte("a"), []byte("bb"), short)
+	require.NoError(t, err)
+	l.Unlock()
+}
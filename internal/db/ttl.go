@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+)
+
+// PutWithTTL is like Put, but the key expires ttl after the write commits.
+// Once expired, reads treat it as deleted, and compaction drops it from disk
+// as it reaches it. A later write to the key replaces the expiry with its own.
+func (d *DB) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("db: TTL must be positive")
+	}
+	return d.put(context.Background(), key, value, ttl, DefaultWriteOptions)
+}
+
+// expired reports whether entry has an expiry at or before now, in Unix
+// nanoseconds.
+func expired(entry *common.Entry, now int64) bool {
+	return entry.ExpiresAt != 0 && entry.ExpiresAt <= now
+}
+
+// expireEntry returns entry, or a point tombstone in its place if it has
+// expired by now.
+func expireEntry(entry *common.Entry, now int64) *common.Entry {
+	if entry.Type == common.EntryTypeDelete || !expired(entry, now) {
+		return entry
+	}
+	return &common.Entry{
+		Type:      common.EntryTypeDelete,
+		Seq:       entry.Seq,
+		Timestamp: entry.ExpiresAt,
+		Key:       entry.Key,
+	}
+}
+
+// expiryIterator turns the entries that expired by now into point
+// tombstones.
+type expiryIterator struct {
+	iterator.Iterator
+	now int64
+}
+
+func (it *expiryIterator) Next() (*common.Entry, error) {
+	entry, err := it.Iterator.Next()
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return expireEntry(entry, it.now), nil
+}
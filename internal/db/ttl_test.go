@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutWithTTL(t *testing.T) {
+	path := t.TempDir()
+	d, err := db.Open(db.WithDBPath(path))
+	require.NoError(t, err)
+	defer func() { d.Close() }()
+
+	require.NoError(t, d.Put([]byte("plain"), []byte("v")))
+	require.NoError(t, d.PutWithTTL([]byte("long"), []byte("v"), time.Hour))
+	require.NoError(t, d.PutWithTTL([]byte("short"), []byte("v"), time.Nanosecond))
+	require.NoError(t, d.Put([]byte("shadowed"), []byte("old")))
+	require.NoError(t, d.PutWithTTL([]byte("shadowed"), []byte("new"), time.Nanosecond))
+	require.Error(t, d.PutWithTTL([]byte("zero"), []byte("v"), 0))
+
+	tests := []struct {
+		key  string
+		live bool
+	}{
+		{"plain", true},
+		{"long", true},
+		{"short", false},
+		// An expired version doesn't uncover the one it replaced
+		{"shadowed", false},
+	}
+	check := func() {
+		var keys [][]byte
+		var live []string
+		for _, tt := range tests {
+			keys = append(keys, []byte(tt.key))
+			if tt.live {
+				live = append(live, tt.key)
+			}
+		}
+		values, err := d.MultiGet(keys)
+		require.NoError(t, err)
+
+		for i, tt := range tests {
+			value, err := d.Get([]byte(tt.key))
+			if tt.live {
+				require.NoError(t, err, tt.key)
+				require.Equal(t, []byte("v"), value, tt.key)
+				require.Equal(t, []byte("v"), values[i], tt.key)
+			} else {
+				require.ErrorIs(t, err, db.ErrNotFound, tt.key)
+				require.Nil(t, values[i], tt.key)
+			}
+		}
+
+		entries, err := d.Scan(nil, 0)
+		require.NoError(t, err)
+		var scanned []string
+		for _, entry := range entries {
+			scanned = append(scanned, string(entry.Key))
+		}
+		require.ElementsMatch(t, live, scanned)
+	}
+	check()
+
+	// The expiry survives a reopen
+	require.NoError(t, d.Close())
+	d, err = db.Open(db.WithDBPath(path))
+	require.NoError(t, err)
+	check()
+	entry, err := d.GetEntry([]byte("long"))
+	require.NoError(t, err)
+	require.Greater(t, entry.ExpiresAt, time.Now().UnixNano())
+
+	// Compaction removes expired entries from disk
+	require.NoError(t, d.Compact())
+	check()
+	entries := 0
+	for _, files := range d.Manifest().Current().Levels {
+		for _, fm := range files {
+			entries += int(fm.Entries)
+		}
+	}
+	require.Equal(t, 2, entries)
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"fmt"
+
+	"amethyst/internal/codec"
+)
+
+// GetAs reads key and decodes its value with c.
+func GetAs[T any](d *DB, key []byte, c codec.Codec[T]) (T, error) {
+	data, err := d.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := c.Unmarshal(data)
+	if err != nil {
+		return v, fmt.Errorf("failed to decode value of %q: %w", key, err)
+	}
+	return v, nil
+}
+
+// PutAs encodes v with c and writes it under key.
+func PutAs[T any](d *DB, key []byte, v T, c codec.Codec[T]) error {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode value of %q: %w", key, err)
+	}
+	return d.Put(key, data)
+}
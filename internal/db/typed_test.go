@@ -0,0 +1,35 @@
+package db_test
+
+import (
+	"testing"
+
+	"amethyst/internal/codec"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedGetPut(t *testing.T) {
+	type point struct{ X, Y int }
+
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	c := codec.JSON[point]()
+	require.NoError(t, db.PutAs(d, []byte("p"), point{1, 2}, c))
+
+	got, err := db.GetAs(d, []byte("p"), c)
+	require.NoError(t, err)
+	require.Equal(t, point{1, 2}, got)
+
+	raw, err := d.Get([]byte("p"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"X":1,"Y":2}`, string(raw))
+
+	_, err = db.GetAs(d, []byte("missing"), c)
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	require.NoError(t, d.Put([]byte("bad"), []byte("not json")))
+	_, err = db.GetAs(d, []byte("bad"), c)
+	require.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"amethyst/internal/blob"
+	"amethyst/internal/block"
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/manifest"
+	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/wal"
+)
+
+// ErrCorruption marks structural damage found by VerifyChecksums, such as
+// keys out of order or an index that disagrees with the data.
+var ErrCorruption = errors.New("db: corruption")
+
+// ChecksumProblem is one problem VerifyChecksums found in a file.
+type ChecksumProblem struct {
+	// File is the path of the damaged file.
+	File string
+	// Err describes the damage. It wraps ErrCorruption for structural
+	// problems, table_cache.ErrChecksumMismatch, sstable.ErrCorruption, or
+	// blob.ErrCorrupt for failed checksums, and the I/O or decoding error
+	// otherwise.
+	Err error
+}
+
+func (p ChecksumProblem) String() string {
+	return fmt.Sprintf("%s: %v", p.File, p.Err)
+}
+
+// VerifyChecksums reads every live SSTable and WAL in full, checking that
+// each table exists and matches its recorded checksum, the key order, entry
+// count, and key range of its entries, the order of its index and the index
+// against its blocks, and that every blob reference resolves to a value with
+// a valid checksum. The
+// database stays online: tables are read from a pinned version without
+// holding the lock, which is only taken, shared, while the WAL is read.
+// Returns every problem found, or nil if there are none.
+func (d *DB) VerifyChecksums() []ChecksumProblem {
+	version := d.manifest.Ref()
+	defer d.manifest.Unref(version)
+
+	var problems []ChecksumProblem
+	for level, fileMetas := range version.Levels {
+		for _, fm := range fileMetas {
+			path := d.paths.SSTablePath(level, fm.FileNo)
+			for _, err := range d.verifyTable(path, fm) {
+				problems = append(problems, ChecksumProblem{File: path, Err: err})
+			}
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, num := range d.manifest.Current().LiveWALs() {
+		path := d.paths.WALPath(num)
+		if err := d.verifyWAL(path); err != nil {
+			problems = append(problems, ChecksumProblem{File: path, Err: err})
+		}
+	}
+	return problems
+}
+
+// verifyTable returns the problems found in one table. Reading stops at the
+// first entry that fails to decode.
+func (d *DB) verifyTable(path string, fm manifest.FileMetadata) []error {
+	var problems []error
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf("%w: "+format, append([]any{ErrCorruption}, args...)...))
+	}
+
+	if _, err := d.fs.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		fail("table is in the manifest but its file is missing")
+		return problems
+	}
+
+	if fm.Checksum != 0 {
+		f, err := d.fs.Open(path)
+		if err != nil {
+			return []error{err}
+		}
+		actual, err := common.Checksum(f)
+		f.Close()
+		if err != nil {
+			return []error{err}
+		}
+		if actual != fm.Checksum {
+			problems = append(problems, fmt.Errorf("%w: file is %08x, expected %08x", table_cache.ErrChecksumMismatch, actual, fm.Checksum))
+		}
+	}
+
+	// Read through a private handle so the check doesn't disturb the caches
+	table, err := sstable.OpenSSTable(d.fs, path, fm.FileNo, nil)
+	if err != nil {
+		return append(problems, err)
+	}
+	defer table.Close()
+
+	index := table.GetIndex()
+	for i := 1; i < len(index.Entries); i++ {
+		if bytes.Compare(index.Entries[i-1].Key, index.Entries[i].Key) >= 0 {
+			fail("index entry %d: key %q not greater than previous key %q", i, index.Entries[i].Key, index.Entries[i-1].Key)
+		}
+	}
+	iter := table.Iterator()
+	defer iterator.Close(iter)
+
+	var prevKey, smallest, largest []byte
+	count := 0
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			problems = append(problems, fmt.Errorf("entry %d: %w", count, err))
+			break
+		}
+		if entry == nil {
+			break
+		}
+
+		if prevKey != nil && bytes.Compare(prevKey, entry.Key) >= 0 {
+			fail("entry %d: key %q not greater than previous key %q", count, entry.Key, prevKey)
+		}
+		if count%block.BLOCK_SIZE == 0 {
+			blockIdx := count / block.BLOCK_SIZE
+			if blockIdx >= len(index.Entries) {
+				fail("entry %d: block %d missing from index", count, blockIdx)
+			} else if !bytes.Equal(index.Entries[blockIdx].Key, entry.Key) {
+				fail("block %d: index key %q does not match first key %q", blockIdx, index.Entries[blockIdx].Key, entry.Key)
+			}
+		}
+		if count == 0 {
+			smallest = bytes.Clone(entry.Key)
+		}
+
+		switch entry.Type {
+		case common.EntryTypePut, common.EntryTypeDelete:
+		case common.EntryTypeBlobRef:
+			if err := d.verifyBlobRef(entry, fm); err != nil {
+				problems = append(problems, fmt.Errorf("entry %d: %w", count, err))
+			}
+		default:
+			fail("entry %d: unknown type %d", count, entry.Type)
+		}
+
+		prevKey = bytes.Clone(entry.Key)
+		count++
+	}
+
+	// Range tombstones widen the key range past the entries
+	largest = prevKey
+	for _, t := range table.RangeTombstones() {
+		if smallest == nil || bytes.Compare(t.Key, smallest) < 0 {
+			smallest = t.Key
+		}
+		if largest == nil || bytes.Compare(t.Value, largest) > 0 {
+			largest = t.Value
+		}
+	}
+	if smallest != nil && !bytes.Equal(smallest, fm.SmallestKey) {
+		fail("smallest key is %q, manifest records %q", smallest, fm.SmallestKey)
+	}
+	if largest != nil && !bytes.Equal(largest, fm.LargestKey) {
+		fail("largest key is %q, manifest records %q", largest, fm.LargestKey)
+	}
+	if count != table.Len() {
+		fail("footer records %d entries, found %d", table.Len(), count)
+	}
+	if blocks := (count + block.BLOCK_SIZE - 1) / block.BLOCK_SIZE; blocks != len(index.Entries) {
+		fail("index has %d blocks, found %d", len(index.Entries), blocks)
+	}
+	return problems
+}
+
+// verifyBlobRef checks that a blob reference is listed by its table and
+// points at a value with a valid checksum.
+func (d *DB) verifyBlobRef(entry *common.Entry, fm manifest.FileMetadata) error {
+	h, err := blob.DecodeHandle(entry.Value)
+	if err != nil {
+		return fmt.Errorf("bad blob reference for %q: %w", entry.Key, err)
+	}
+	listed := false
+	for _, fileNo := range fm.BlobFiles {
+		listed = listed || fileNo == h.FileNo
+	}
+	if !listed {
+		return fmt.Errorf("%w: %q points into %d.blob, which the table doesn't list", ErrCorruption, entry.Key, h.FileNo)
+	}
+	if _, err := d.blobs.Get(h); err != nil {
+		return fmt.Errorf("value of %q: %w", entry.Key, err)
+	}
+	return nil
+}
+
+// verifyWAL reads the WAL at path through to the end.
+// Must be called with d.mu held, so no append is in progress.
+func (d *DB) verifyWAL(path string) error {
+	log, err := wal.OpenWALReadOnly(d.fs, path)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	iter, err := log.Iterator()
+	if err != nil {
+		return err
+	}
+	defer iterator.Close(iter)
+
+	for count := 0; ; count++ {
+		entry, err := iter.Next()
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", count, err)
+		}
+		if entry == nil {
+			return nil
+		}
+		switch entry.Type {
+		case common.EntryTypePut, common.EntryTypeDelete, common.EntryTypeRangeDelete:
+		default:
+			return fmt.Errorf("%w: entry %d: unknown type %d", ErrCorruption, count, entry.Type)
+		}
+	}
+}
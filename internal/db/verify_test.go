@@ -0,0 +1,94 @@
+package db_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"amethyst/internal/blob"
+	"amethyst/internal/db"
+	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/wal"
+	"github.com/stretchr/testify/require"
+)
+
+// flipByte inverts the byte at offset in the file at path.
+func flipByte(t *testing.T, path string, offset int) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[offset] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	d, err := db.Open(
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(10),
+		db.WithBlobThreshold(16),
+	)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 15; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("a long value %03d", i))))
+	}
+	require.Empty(t, d.VerifyChecksums())
+
+	v := d.Manifest().Current()
+	tablePath := d.Paths().SSTablePath(0, v.Levels[0][0].FileNo)
+	blobPath := d.Paths().BlobPath(v.BlobFiles[0])
+	walPath := d.Paths().WALPath(v.CurrentWAL)
+
+	problemsByFile := func() map[string][]error {
+		byFile := make(map[string][]error)
+		for _, p := range d.VerifyChecksums() {
+			byFile[p.File] = append(byFile[p.File], p.Err)
+		}
+		return byFile
+	}
+
+	// Damage a value in the blob file and the WAL tail
+	flipByte(t, blobPath, 6)
+	f, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	byFile := problemsByFile()
+	require.Len(t, byFile, 2)
+	require.ErrorIs(t, byFile[walPath][0], wal.ErrTornWrite)
+
+	// The blob damage surfaces through the table that references it
+	require.Len(t, byFile[tablePath], 1)
+	require.ErrorIs(t, byFile[tablePath][0], blob.ErrCorrupt)
+
+	// Damage an entry of the table, which fails both its file and block checksums
+	flipByte(t, tablePath, 10)
+	byFile = problemsByFile()
+	require.ErrorIs(t, byFile[tablePath][0], table_cache.ErrChecksumMismatch)
+	require.True(t, slices.ContainsFunc(byFile[tablePath], func(err error) bool {
+		return errors.Is(err, sstable.ErrCorruption)
+	}))
+}
+
+func TestVerifyMissingTable(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(10))
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 15; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")))
+	}
+	v := d.Manifest().Current()
+	tablePath := d.Paths().SSTablePath(0, v.Levels[0][0].FileNo)
+	require.NoError(t, os.Remove(tablePath))
+
+	problems := d.VerifyChecksums()
+	require.Len(t, problems, 1)
+	require.Equal(t, tablePath, problems[0].File)
+	require.ErrorIs(t, problems[0].Err, db.ErrCorruption)
+}
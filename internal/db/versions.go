@@ -0,0 +1,73 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+)
+
+// GetVersions returns up to limit versions of key still held by the database,
+// newest first, including tombstones. Each memtable and SSTable holds at most
+// one version of a key, so older versions survive only until compaction
+// merges them away. limit <= 0 returns every version found.
+func (d *DB) GetVersions(key []byte, limit int) ([]*common.Entry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var versions []*common.Entry
+	full := func() bool {
+		return limit > 0 && len(versions) >= limit
+	}
+
+	for _, mem := range d.memtables() {
+		if entry, ok := mem.Get(key); ok {
+			versions = append(versions, cloneEntry(entry))
+		}
+	}
+
+	version := d.manifest.Ref()
+	defer d.manifest.Unref(version)
+	for level, fileMetas := range version.Levels {
+		for _, fm := range newestFirst(level, fileMetas) {
+			if full() {
+				return versions, nil
+			}
+
+			table, err := d.manifest.GetTable(fm.FileNo, level)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+
+			entry, err := table.Get(key)
+			if err == sstable.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read from L%d/%d.sst: %w", level, fm.FileNo, err)
+			}
+			if entry, err = d.resolveBlob(entry, ReadAllTier); err != nil {
+				return nil, err
+			}
+			versions = append(versions, cloneEntry(entry))
+		}
+	}
+
+	if full() {
+		versions = versions[:limit]
+	}
+	return versions, nil
+}
+
+// cloneEntry returns a deep copy of e that is safe to hand to callers.
+func cloneEntry(e *common.Entry) *common.Entry {
+	return &common.Entry{
+		Type:      e.Type,
+		Seq:       e.Seq,
+		Timestamp: e.Timestamp,
+		ExpiresAt: e.ExpiresAt,
+		Key:       bytes.Clone(e.Key),
+		Value:     bytes.Clone(e.Value),
+	}
+}
@@ -0,0 +1,82 @@
+package db_test
+
+import (
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVersions(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Each pair of writes lands in its own L0 table once the next write flushes it
+	require.NoError(t, d.Put([]byte("k"), []byte("v1")))
+	require.NoError(t, d.Put([]byte("filler1"), []byte("x")))
+	require.NoError(t, d.Put([]byte("k"), []byte("v2")))
+	require.NoError(t, d.Put([]byte("filler2"), []byte("x")))
+	require.NoError(t, d.Delete([]byte("k")))
+	d.WaitForCompactions()
+
+	versions, err := d.GetVersions([]byte("k"), 0)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+
+	require.Equal(t, common.EntryTypeDelete, versions[0].Type)
+	require.Equal(t, []byte("v2"), versions[1].Value)
+	require.Equal(t, []byte("v1"), versions[2].Value)
+
+	// Sequence numbers are global and strictly decreasing, newest first
+	require.Greater(t, versions[0].Seq, versions[1].Seq)
+	require.Greater(t, versions[1].Seq, versions[2].Seq)
+
+	limited, err := d.GetVersions([]byte("k"), 2)
+	require.NoError(t, err)
+	require.Len(t, limited, 2)
+	require.Equal(t, versions[:2], limited)
+
+	missing, err := d.GetVersions([]byte("missing"), 0)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+}
+
+func TestGetEntry(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(2))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// "flushed" and "gone" reach an SSTable; "live" and the tombstone stay in the memtable
+	require.NoError(t, d.Put([]byte("flushed"), []byte("v1")))
+	require.NoError(t, d.Put([]byte("gone"), []byte("v2")))
+	require.NoError(t, d.Put([]byte("live"), []byte("v3")))
+	require.NoError(t, d.Delete([]byte("gone")))
+
+	tests := []struct {
+		key   string
+		typ   common.EntryType
+		seq   uint64
+		value string
+	}{
+		{"flushed", common.EntryTypePut, 1, "v1"},
+		{"live", common.EntryTypePut, 3, "v3"},
+		{"gone", common.EntryTypeDelete, 4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			entry, err := d.GetEntry([]byte(tt.key))
+			require.NoError(t, err)
+			require.Equal(t, tt.typ, entry.Type)
+			require.Equal(t, tt.seq, entry.Seq)
+			require.Equal(t, tt.value, string(entry.Value))
+			require.NotZero(t, entry.Timestamp)
+		})
+	}
+
+	_, err = d.GetEntry([]byte("missing"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = d.Get([]byte("gone"))
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/iterator"
+	"amethyst/internal/wal"
+)
+
+// ArchivedWAL describes a WAL in the archive.
+type ArchivedWAL struct {
+	// FileNo orders archived WALs: a higher number holds later writes.
+	FileNo  common.FileNo
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ArchivedWALs lists the WALs in the archive, oldest first. Their writes
+// run on without gaps from one to the next, up to those of the WALs still
+// live, except where the archive's limits have removed older WALs. It is
+// empty unless Options.ArchiveWALs is set.
+func (d *DB) ArchivedWALs() ([]ArchivedWAL, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.archivedWALs()
+}
+
+// OpenArchivedWAL returns the entries of archived WAL num in the order they
+// were committed. A WAL can be pruned from the archive while it is read;
+// the open iterator keeps reading it regardless.
+func (d *DB) OpenArchivedWAL(num common.FileNo) (iterator.Iterator, error) {
+	log, err := wal.OpenWALReadOnly(d.fs, d.paths.ArchivedWALPath(num))
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+	iter, err := log.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	// WAL iterators hold their own file handle until closed
+	return iter.(iterator.Iterator), nil
+}
+
+// archiveWAL moves the obsolete WAL num into the archive, then removes any
+// archived WALs past the archive's limits.
+// Must be called with d.mu held.
+func (d *DB) archiveWAL(num common.FileNo) error {
+	if err := d.fs.Rename(d.paths.WALPath(num), d.paths.ArchivedWALPath(num)); err != nil {
+		return err
+	}
+	return d.pruneWALArchive()
+}
+
+// pruneWALArchive removes archived WALs older than WALArchiveTTL, then the
+// oldest while the archive is larger than WALArchiveSizeLimit.
+// Must be called with d.mu held, or before Open returns.
+func (d *DB) pruneWALArchive() error {
+	archived, err := d.archivedWALs()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, a := range archived {
+		total += a.Size
+	}
+	now := time.Now()
+	for _, a := range archived {
+		expired := d.Opts.WALArchiveTTL > 0 && now.Sub(a.ModTime) > d.Opts.WALArchiveTTL
+		oversized := d.Opts.WALArchiveSizeLimit > 0 && total > d.Opts.WALArchiveSizeLimit
+		if !expired && !oversized {
+			break
+		}
+		if err := d.fs.Remove(a.Path); err != nil {
+			return err
+		}
+		total -= a.Size
+	}
+	return nil
+}
+
+// archivedWALs lists the archive, oldest first.
+func (d *DB) archivedWALs() ([]ArchivedWAL, error) {
+	if !d.Opts.ArchiveWALs {
+		return nil, nil
+	}
+	entries, err := d.fs.ReadDir(d.paths.ArchiveDir())
+	if err != nil {
+		return nil, err
+	}
+	var archived []ArchivedWAL
+	for _, entry := range entries {
+		n, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), ".log"), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat archived WAL %s: %w", entry.Name(), err)
+		}
+		archived = append(archived, ArchivedWAL{
+			FileNo:  common.FileNo(n),
+			Path:    d.paths.ArchivedWALPath(common.FileNo(n)),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	slices.SortFunc(archived, func(a, b ArchivedWAL) int { return int(a.FileNo) - int(b.FileNo) })
+	return archived, nil
+}
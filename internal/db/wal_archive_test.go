@@ -0,0 +1,72 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALArchive(t *testing.T) {
+	dir := t.TempDir()
+	d, err := db.Open(
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(2),
+		db.WithWALArchive(0, 0),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 9; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+
+	// The archive holds the writes of every flushed WAL, in commit order
+	archived, err := d.ArchivedWALs()
+	require.NoError(t, err)
+	require.NotEmpty(t, archived)
+	var keys []string
+	var total int64
+	for i, a := range archived {
+		if i > 0 {
+			require.Greater(t, a.FileNo, archived[i-1].FileNo)
+		}
+		total += a.Size
+		it, err := d.OpenArchivedWAL(a.FileNo)
+		require.NoError(t, err)
+		for entry, err := it.Next(); entry != nil; entry, err = it.Next() {
+			require.NoError(t, err)
+			keys = append(keys, string(entry.Key))
+		}
+		require.NoError(t, it.Close())
+	}
+	require.NotEmpty(t, keys)
+	for i, key := range keys {
+		require.Equal(t, fmt.Sprintf("key%d", i), key)
+	}
+	require.NoError(t, d.Close())
+
+	// Reopening prunes the oldest WALs past the size limit
+	d, err = db.Open(db.WithDBPath(dir), db.WithWALArchive(0, total-1))
+	require.NoError(t, err)
+	pruned, err := d.ArchivedWALs()
+	require.NoError(t, err)
+	require.Less(t, len(pruned), len(archived))
+	require.Equal(t, archived[len(archived)-len(pruned):], pruned)
+	for i := 0; i < 9; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, "value", string(value))
+	}
+	require.NoError(t, d.Close())
+
+	// and every WAL past the TTL
+	time.Sleep(10 * time.Millisecond)
+	d, err = db.Open(db.WithDBPath(dir), db.WithWALArchive(time.Millisecond, 0))
+	require.NoError(t, err)
+	defer d.Close()
+	pruned, err = d.ArchivedWALs()
+	require.NoError(t, err)
+	require.Empty(t, pruned)
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"amethyst/internal/common"
+	"amethyst/internal/wal"
+)
+
+// createWAL starts WAL num, in the space of the oldest recycled WAL if any
+// is waiting, preallocated to WALPreallocateSize.
+// Must be called with d.mu held, or before Open returns.
+func (d *DB) createWAL(num common.FileNo) (wal.WAL, error) {
+	path := d.paths.WALPath(num)
+	if len(d.recycledWALs) > 0 {
+		old := d.recycledWALs[0]
+		d.recycledWALs = d.recycledWALs[1:]
+		log, err := wal.RecycleWAL(d.walFS(), d.paths.RecycledWALPath(old), path, d.Opts.WALPreallocateSize)
+		if err == nil {
+			return log, nil
+		}
+		d.logger("wal").Log(common.LevelWarn, "failed to recycle WAL", "wal", old, "err", err)
+	}
+	return wal.CreatePreallocatedWAL(d.walFS(), path, d.Opts.WALPreallocateSize)
+}
+
+// retireWAL archives the obsolete WAL num if WALs are archived, sets it
+// aside for reuse if fewer than WALRecycleLimit are waiting, or removes it.
+// Must be called with d.mu held.
+func (d *DB) retireWAL(num common.FileNo) error {
+	if d.Opts.ArchiveWALs {
+		return d.archiveWAL(num)
+	}
+	path := d.paths.WALPath(num)
+	if len(d.recycledWALs) >= d.Opts.WALRecycleLimit {
+		return d.fs.Remove(path)
+	}
+	if err := d.fs.Rename(path, d.paths.RecycledWALPath(num)); err != nil {
+		return err
+	}
+	d.recycledWALs = append(d.recycledWALs, num)
+	return nil
+}
+
+// loadRecycledWALs picks up the WALs a previous run set aside, removing any
+// past WALRecycleLimit.
+func (d *DB) loadRecycledWALs() error {
+	entries, err := d.fs.ReadDir(d.paths.WALDir())
+	if err != nil {
+		return err
+	}
+	var nums []common.FileNo
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "recycle-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "recycle-"), ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		nums = append(nums, common.FileNo(n))
+	}
+	slices.Sort(nums)
+
+	for len(nums) > d.Opts.WALRecycleLimit {
+		if err := d.fs.Remove(d.paths.RecycledWALPath(nums[0])); err != nil {
+			return err
+		}
+		nums = nums[1:]
+	}
+	d.recycledWALs = nums
+	return nil
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALRecycling(t *testing.T) {
+	dir := t.TempDir()
+	opts := []db.Option{
+		db.WithDBPath(dir),
+		db.WithMemtableFlushThreshold(2),
+		db.WithWALPreallocation(4096),
+		db.WithWALRecycling(2),
+	}
+	d, err := db.Open(opts...)
+	require.NoError(t, err)
+
+	// Each pair of writes fills a memtable, which the next write rotates out
+	// along with its WAL
+	for i := 0; i < 9; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+	}
+	d.WaitForCompactions()
+
+	// Rotations take back the logs flushes set aside, so how many are
+	// waiting depends on timing, but none is deleted
+	recycled, err := filepath.Glob(filepath.Join(dir, "wal", "recycle-*.log"))
+	require.NoError(t, err)
+	require.NotEmpty(t, recycled)
+	require.LessOrEqual(t, len(recycled), 2)
+	live := filepath.Join(dir, "wal", fmt.Sprintf("%d.log", d.Manifest().Current().CurrentWAL))
+	stat, err := os.Stat(live)
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), stat.Size())
+	require.Empty(t, d.VerifyChecksums())
+	require.NoError(t, d.Close())
+
+	// Recycled logs are picked up again, and their old records never replay
+	d, err = db.Open(opts...)
+	require.NoError(t, err)
+	defer d.Close()
+	for i := 0; i < 9; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, "value", string(value))
+	}
+	require.NoError(t, d.Put([]byte("key0"), []byte("new")))
+	require.NoError(t, d.Put([]byte("key1"), []byte("new")))
+	require.NoError(t, d.Put([]byte("key2"), []byte("new")))
+	d.WaitForCompactions()
+	recycled, err = filepath.Glob(filepath.Join(dir, "wal", "recycle-*.log"))
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(recycled), 2)
+	value, err := d.Get([]byte("key0"))
+	require.NoError(t, err)
+	require.Equal(t, "new", string(value))
+}
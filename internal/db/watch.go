@@ -0,0 +1,223 @@
+package db
+
+import (
+	"bytes"
+	"sync"
+
+	"amethyst/internal/common"
+)
+
+// watchBufferSize is the number of undelivered events a watcher may queue
+// before it is considered too slow and dropped.
+const watchBufferSize = 128
+
+// watcher receives committed mutations of keys that start with prefix.
+type watcher struct {
+	prefix []byte
+	ch     chan *common.Entry
+}
+
+// Watch returns a channel of committed mutations (puts and deletes) whose key
+// starts with prefix, in commit order. Events are delivered after the batch
+// is committed. An empty prefix watches every key. A DeleteRange
+// whose range holds any key starting with prefix is delivered too, as an
+// EntryTypeRangeDelete entry with the range's start in Key and its end in
+// Value.
+//
+// Delivery never blocks the write path: a watcher that falls more than
+// watchBufferSize events behind is dropped and its channel closed, so a
+// closed channel means events may have been missed and the consumer should
+// resynchronize (e.g. invalidate its whole cache).
+//
+// The returned cancel function stops the watch and closes the channel.
+// Closing the DB closes the channels of every watch, and Watch returns a
+// closed channel once the DB is closed.
+func (d *DB) Watch(prefix []byte) (<-chan *common.Entry, func()) {
+	w := &watcher{
+		prefix: bytes.Clone(prefix),
+		ch:     make(chan *common.Entry, watchBufferSize),
+	}
+
+	d.watchMu.Lock()
+	select {
+	case <-d.closeCh:
+		close(w.ch)
+	default:
+		d.watchers[w] = struct{}{}
+	}
+	d.watchMu.Unlock()
+
+	cancel := func() {
+		d.watchMu.Lock()
+		defer d.watchMu.Unlock()
+		d.removeWatcher(w)
+	}
+	return w.ch, cancel
+}
+
+// removeWatcher unregisters w and closes its channel. Must be called with d.watchMu held.
+func (d *DB) removeWatcher(w *watcher) {
+	if _, ok := d.watchers[w]; !ok {
+		return
+	}
+	delete(d.watchers, w)
+	close(w.ch)
+}
+
+// subscriber passes committed mutations of keys that start with prefix to
+// fn, in commit order, on a goroutine of its own.
+type subscriber struct {
+	prefix []byte
+	fn     func(*common.Entry)
+
+	mu      sync.Mutex
+	queue   []*common.Entry // events fn has yet to see
+	pending chan struct{}   // holds a token while queue is non-empty
+	stop    chan struct{}   // closed by cancel
+	done    chan struct{}   // closed when the goroutine exits
+}
+
+// Subscribe calls fn with every committed put and delete whose key starts
+// with prefix, in commit order, including those a replica applies with
+// ApplyReplicated. An empty prefix subscribes to every key. A DeleteRange
+// whose range holds any key starting with prefix is passed on as Watch
+// delivers it: one EntryTypeRangeDelete entry, with the range's start in
+// Key and its end in Value, rather than a delete per key.
+//
+// Unlike Watch it never drops an event: fn runs on a goroutine of its own,
+// so it doesn't hold up the write path, and events queue in memory while it
+// falls behind. Subscribers that can't keep up with the write rate should
+// use Watch instead.
+//
+// The returned cancel function stops the subscription, waiting for a call
+// to fn in progress to return, so fn is never called once it returns. It
+// must not be called from fn. Closing the DB also stops every subscription.
+func (d *DB) Subscribe(prefix []byte, fn func(*common.Entry)) func() {
+	s := &subscriber{
+		prefix:  bytes.Clone(prefix),
+		fn:      fn,
+		pending: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	d.watchMu.Lock()
+	d.subscribers[s] = struct{}{}
+	d.watchMu.Unlock()
+	go s.run(d.closeCh)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.watchMu.Lock()
+			delete(d.subscribers, s)
+			d.watchMu.Unlock()
+			close(s.stop)
+			<-s.done
+		})
+	}
+}
+
+// enqueue queues an event for fn.
+func (s *subscriber) enqueue(entry *common.Entry) {
+	s.mu.Lock()
+	s.queue = append(s.queue, entry)
+	s.mu.Unlock()
+	select {
+	case s.pending <- struct{}{}:
+	default:
+	}
+}
+
+// run passes queued events to fn until the subscription is cancelled or
+// the DB closed.
+func (s *subscriber) run(closeCh <-chan struct{}) {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-closeCh:
+			return
+		case <-s.pending:
+		}
+
+		s.mu.Lock()
+		events := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, event := range events {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			s.fn(event)
+		}
+	}
+}
+
+// notifyWatchers fans out a committed batch to every matching watcher and
+// subscriber. Called from the group commit loop after the batch has been
+// applied.
+func (d *DB) notifyWatchers(batch []*writeRequest) {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+
+	if len(d.watchers) == 0 && len(d.subscribers) == 0 {
+		return
+	}
+	for _, req := range batch {
+		if req.err == nil {
+			for _, entry := range req.entries {
+				d.publish(entry)
+			}
+		}
+	}
+}
+
+// notifyReplicated is notifyWatchers for entries applied by
+// ApplyReplicated. Must be called with d.mu held, so concurrent calls
+// publish in commit order.
+func (d *DB) notifyReplicated(entries []*common.Entry) {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+
+	for _, entry := range entries {
+		d.publish(entry)
+	}
+}
+
+// publish delivers a committed entry to every watcher and subscriber whose
+// prefix it matches. Must be called with d.watchMu held.
+func (d *DB) publish(entry *common.Entry) {
+	for w := range d.watchers {
+		if !touchesPrefix(entry, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- cloneEntry(entry):
+		default:
+			d.logger("watch").Log(common.LevelWarn, "dropping slow watcher", "prefix", w.prefix)
+			d.removeWatcher(w)
+		}
+	}
+	for s := range d.subscribers {
+		if touchesPrefix(entry, s.prefix) {
+			s.enqueue(cloneEntry(entry))
+		}
+	}
+}
+
+// touchesPrefix reports whether entry changes a key starting with prefix:
+// its key starts with prefix, or, for a range tombstone, its [start, end)
+// holds such a key.
+func touchesPrefix(entry *common.Entry, prefix []byte) bool {
+	if bytes.HasPrefix(entry.Key, prefix) {
+		return true
+	}
+	// A range starting before the prefix's keys reaches them if its end is
+	// past the first of them
+	return entry.Type == common.EntryTypeRangeDelete &&
+		bytes.Compare(entry.Key, prefix) < 0 && bytes.Compare(entry.Value, prefix) > 0
+}
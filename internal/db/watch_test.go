@@ -0,0 +1,212 @@
+package db_test
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchPrefix(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+
+	events, cancel := d.Watch([]byte("user:"))
+	defer cancel()
+
+	require.NoError(t, d.Put([]byte("user:1"), []byte("alice")))
+	require.NoError(t, d.Put([]byte("order:1"), []byte("apples")))
+	require.NoError(t, d.Delete([]byte("user:1")))
+
+	// Events are published before writers are acknowledged
+	require.Len(t, events, 2)
+
+	event := <-events
+	require.Equal(t, common.EntryTypePut, event.Type)
+	require.Equal(t, []byte("user:1"), event.Key)
+	require.Equal(t, []byte("alice"), event.Value)
+
+	event = <-events
+	require.Equal(t, common.EntryTypeDelete, event.Type)
+	require.Equal(t, []byte("user:1"), event.Key)
+	require.Greater(t, event.Seq, uint64(0))
+}
+
+func TestWatchRangeDelete(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	events, cancel := d.Watch([]byte("user:"))
+	defer cancel()
+
+	tests := []struct {
+		start, end string
+		overlaps   bool
+	}{
+		{"a", "b", false},
+		{"a", "user:", false}, // ends just before the first key with the prefix
+		{"a", "user:\x00", true},
+		{"a", "user:5", true},
+		{"user:1", "user:3", true},
+		{"user:9", "z", true},
+		{"user;", "z", false}, // starts past every key with the prefix
+	}
+	for _, tt := range tests {
+		require.NoError(t, d.DeleteRange([]byte(tt.start), []byte(tt.end)))
+		if !tt.overlaps {
+			require.Empty(t, events, "[%q, %q)", tt.start, tt.end)
+			continue
+		}
+		require.Len(t, events, 1, "[%q, %q)", tt.start, tt.end)
+		event := <-events
+		require.Equal(t, common.EntryTypeRangeDelete, event.Type)
+		require.Equal(t, tt.start, string(event.Key))
+		require.Equal(t, tt.end, string(event.Value))
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+
+	events, cancel := d.Watch(nil)
+	cancel()
+	cancel() // safe to call twice
+
+	require.NoError(t, d.Put([]byte("k"), []byte("v")))
+	_, ok := <-events
+	require.False(t, ok, "cancelled watch channel should be closed")
+}
+
+func TestWatchClose(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+
+	events, cancel := d.Watch(nil)
+	require.NoError(t, d.Put([]byte("k"), []byte("v")))
+	require.NoError(t, d.Close())
+
+	// Events committed before Close are still delivered, then the channel
+	// ends, so a range over it returns
+	var keys []string
+	for event := range events {
+		keys = append(keys, string(event.Key))
+	}
+	require.Equal(t, []string{"k"}, keys)
+	cancel()
+
+	// Watches started after Close end at once
+	events, cancel = d.Watch(nil)
+	defer cancel()
+	_, ok := <-events
+	require.False(t, ok, "watch of a closed DB should be closed")
+}
+
+func TestWatchDropsSlowWatcher(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(1000))
+	require.NoError(t, err)
+
+	events, cancel := d.Watch(nil)
+	defer cancel()
+
+	// Never drain the channel; overflowing the buffer drops the watcher
+	for i := 0; i < 200; i++ {
+		require.NoError(t, d.Put([]byte(fmt.Sprintf("k%d", i)), []byte("v")))
+	}
+
+	count := 0
+	for range events {
+		count++
+	}
+	require.Less(t, count, 200, "slow watcher should have been dropped and its channel closed")
+}
+
+func TestSubscribe(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	var mu sync.Mutex
+	var events []*common.Entry
+	cancel := d.Subscribe([]byte("user:"), func(e *common.Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	received := func() []*common.Entry {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(events)
+	}
+
+	require.NoError(t, d.Put([]byte("user:1"), []byte("alice")))
+	require.NoError(t, d.Put([]byte("order:1"), []byte("apples")))
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("b")))
+	require.NoError(t, d.DeleteRange([]byte("order:"), []byte("user:2")))
+	require.NoError(t, d.Delete([]byte("user:1")))
+	require.Eventually(t, func() bool { return len(received()) == 3 }, 5*time.Second, time.Millisecond)
+
+	// Range deletions reaching the prefix are delivered whole, in commit
+	// order with the rest
+	got := received()
+	require.Equal(t, common.EntryTypePut, got[0].Type)
+	require.Equal(t, []byte("alice"), got[0].Value)
+	require.Equal(t, common.EntryTypeRangeDelete, got[1].Type)
+	require.Equal(t, []byte("order:"), got[1].Key)
+	require.Equal(t, []byte("user:2"), got[1].Value)
+	require.Equal(t, common.EntryTypeDelete, got[2].Type)
+	require.Greater(t, got[1].Seq, got[0].Seq)
+	require.Greater(t, got[2].Seq, got[1].Seq)
+
+	cancel()
+	cancel() // safe to call twice
+	require.NoError(t, d.Put([]byte("user:2"), []byte("bob")))
+	time.Sleep(10 * time.Millisecond)
+	require.Len(t, received(), 3)
+}
+
+func TestSubscribeKeepsEveryEvent(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(1000), db.WithBatchTimeout(time.Microsecond))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// A subscriber far slower than the writes misses nothing
+	release := make(chan struct{})
+	var seqs []uint64
+	done := make(chan struct{})
+	cancel := d.Subscribe(nil, func(e *common.Entry) {
+		<-release
+		seqs = append(seqs, e.Seq)
+		if len(seqs) == 300 {
+			close(done)
+		}
+	})
+	defer cancel()
+	for i := 0; i < 300; i++ {
+		require.NoError(t, d.PutWithOptions([]byte(fmt.Sprintf("k%d", i)), []byte("v"), db.WriteOptions{}))
+	}
+	close(release)
+	<-done
+	require.True(t, slices.IsSorted(seqs))
+	require.Equal(t, uint64(300), seqs[299])
+}
+
+func TestSubscribeToReplicatedCommits(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	events := make(chan *common.Entry, 1)
+	cancel := d.Subscribe(nil, func(e *common.Entry) { events <- e })
+	defer cancel()
+	require.NoError(t, d.ApplyReplicated([]*common.Entry{{Type: common.EntryTypePut, Seq: 7, Key: []byte("k"), Value: []byte("v")}}, db.DefaultWriteOptions))
+	event := <-events
+	require.Equal(t, uint64(7), event.Seq)
+	require.Equal(t, []byte("k"), event.Key)
+}
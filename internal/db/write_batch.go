@@ -0,0 +1,98 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"amethyst/internal/common"
+)
+
+// WriteBatch collects puts and deletes for Write to commit atomically. The
+// zero value is an empty batch. A WriteBatch is not safe for concurrent
+// use.
+type WriteBatch struct {
+	entries []*common.Entry
+	ttls    []time.Duration // ttls[i] is the TTL of entries[i], 0 for none
+	err     error           // the first invalid write added
+}
+
+// Put adds a put of key to the batch.
+func (b *WriteBatch) Put(key, value []byte) {
+	b.add(common.EntryTypePut, key, value, 0)
+}
+
+// PutWithTTL adds a put of key that expires ttl after the batch commits.
+func (b *WriteBatch) PutWithTTL(key, value []byte, ttl time.Duration) {
+	if ttl <= 0 && b.err == nil {
+		b.err = errors.New("db: TTL must be positive")
+	}
+	b.add(common.EntryTypePut, key, value, ttl)
+}
+
+// Delete adds a deletion of key to the batch.
+func (b *WriteBatch) Delete(key []byte) {
+	b.add(common.EntryTypeDelete, key, nil, 0)
+}
+
+func (b *WriteBatch) add(typ common.EntryType, key, value []byte, ttl time.Duration) {
+	if len(key) == 0 && b.err == nil {
+		b.err = errors.New("db: key must be non-empty")
+	}
+	b.entries = append(b.entries, &common.Entry{
+		Type:  typ,
+		Key:   bytes.Clone(key),
+		Value: bytes.Clone(value),
+	})
+	b.ttls = append(b.ttls, ttl)
+}
+
+// Len returns the number of writes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.entries)
+}
+
+// Reset empties the batch for reuse.
+func (b *WriteBatch) Reset() {
+	b.entries, b.ttls, b.err = b.entries[:0], b.ttls[:0], nil
+}
+
+// Write commits the writes in b atomically, in one WAL record: after a
+// crash either all of them are recovered or none is, and readers never see
+// some without the others. Writes to the same key apply in the order they
+// were added. If any write added to b is invalid, such as one with an
+// empty key, Write returns its error and commits nothing. b is left
+// unchanged and may be written again.
+func (d *DB) Write(b *WriteBatch, opts WriteOptions) error {
+	return d.write(context.Background(), b, opts)
+}
+
+// WriteContext is like Write with DefaultWriteOptions, but gives up once
+// ctx is done, returning its error. A batch given up on after it was queued
+// may still commit.
+func (d *DB) WriteContext(ctx context.Context, b *WriteBatch) error {
+	return d.write(ctx, b, DefaultWriteOptions)
+}
+
+func (d *DB) write(ctx context.Context, b *WriteBatch, opts WriteOptions) error {
+	if d.Opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	// The commit stamps the entries it applies, so it gets copies, and the
+	// batch may be reused as soon as Write returns
+	entries := make([]*common.Entry, len(b.entries))
+	for i, entry := range b.entries {
+		copied := *entry
+		entries[i] = &copied
+	}
+	return d.submit(ctx, &writeRequest{entries: entries, sync: opts.Sync, ttls: slices.Clone(b.ttls)})
+}
@@ -0,0 +1,141 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBatch(t *testing.T) {
+	path := t.TempDir()
+	d, err := db.Open(db.WithDBPath(path))
+	require.NoError(t, err)
+	defer func() { d.Close() }()
+	require.NoError(t, d.Put([]byte("gone"), []byte("v")))
+
+	var b db.WriteBatch
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte("1"))
+	b.Put([]byte("a"), []byte("2"))
+	b.Delete([]byte("gone"))
+	b.PutWithTTL([]byte("short"), []byte("v"), time.Nanosecond)
+	b.PutWithTTL([]byte("long"), []byte("v"), time.Hour)
+	require.Equal(t, 6, b.Len())
+	require.NoError(t, d.Write(&b, db.DefaultWriteOptions))
+
+	// Later writes to a key win, and each put keeps its own TTL
+	check := func() {
+		entries, err := d.Scan(nil, 0)
+		require.NoError(t, err)
+		var got []string
+		for _, e := range entries {
+			got = append(got, string(e.Key)+"="+string(e.Value))
+		}
+		require.Equal(t, []string{"a=2", "b=1", "long=v"}, got)
+	}
+	check()
+	require.NoError(t, d.Close())
+	d, err = db.Open(db.WithDBPath(path))
+	require.NoError(t, err)
+	check()
+
+	// A reset batch starts over, and writing it again changes nothing
+	b.Reset()
+	require.Equal(t, 0, b.Len())
+	require.NoError(t, d.Write(&b, db.DefaultWriteOptions))
+	b.Put([]byte("c"), []byte("1"))
+	require.NoError(t, d.Write(&b, db.WriteOptions{}))
+	require.NoError(t, d.Write(&b, db.WriteOptions{}))
+	value, err := d.Get([]byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+}
+
+func TestWriteBatchInvalid(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+
+	tests := []struct {
+		name string
+		add  func(b *db.WriteBatch)
+	}{
+		{"empty put key", func(b *db.WriteBatch) { b.Put(nil, []byte("v")) }},
+		{"empty delete key", func(b *db.WriteBatch) { b.Delete([]byte{}) }},
+		{"zero TTL", func(b *db.WriteBatch) { b.PutWithTTL([]byte("k"), []byte("v"), 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One bad write fails the whole batch
+			var b db.WriteBatch
+			b.Put([]byte("before"), []byte("v"))
+			tt.add(&b)
+			b.Put([]byte("after"), []byte("v"))
+			require.Error(t, d.Write(&b, db.DefaultWriteOptions))
+			for _, key := range []string{"before", "after"} {
+				_, err := d.Get([]byte(key))
+				require.ErrorIs(t, err, db.ErrNotFound, key)
+			}
+		})
+	}
+}
+
+func TestWriteBatchAtomic(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()), db.WithMemtableFlushThreshold(64))
+	require.NoError(t, err)
+	defer d.Close()
+
+	// Each batch moves every key to the next generation; readers must
+	// never see keys from two generations at once, across memtable flushes
+	const keys, generations = 8, 100
+	done := make(chan error, 1)
+	go func() {
+		var b db.WriteBatch
+		for gen := range generations {
+			b.Reset()
+			for k := range keys {
+				b.Put([]byte(fmt.Sprintf("key%d", k)), []byte(fmt.Sprint(gen)))
+			}
+			if err := d.Write(&b, db.WriteOptions{}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			return
+		default:
+		}
+		entries, err := d.Scan(nil, 0)
+		require.NoError(t, err)
+		if len(entries) == 0 {
+			continue
+		}
+		require.Len(t, entries, keys)
+		for _, e := range entries {
+			require.Equal(t, string(entries[0].Value), string(e.Value), string(e.Key))
+		}
+	}
+}
+
+func TestWriteBatchReadOnly(t *testing.T) {
+	path := t.TempDir()
+	d, err := db.Open(db.WithDBPath(path))
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+
+	d, err = db.Open(db.WithDBPath(path), db.WithReadOnly())
+	require.NoError(t, err)
+	defer d.Close()
+	var b db.WriteBatch
+	b.Put([]byte("k"), []byte("v"))
+	require.ErrorIs(t, d.Write(&b, db.DefaultWriteOptions), db.ErrReadOnly)
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"amethyst/internal/common"
+	"amethyst/internal/scheduler"
+)
+
+// WriteBufferManager caps the combined memtable memory of every DB sharing
+// it through an Env. Whenever the total passes the limit it picks the
+// instance with the largest memtable and flushes it in the background, so
+// one busy tenant cannot grow its memtable at the expense of the others.
+type WriteBufferManager struct {
+	mu      sync.Mutex
+	limit   int
+	members map[*DB]*writeBufferMember
+}
+
+type writeBufferMember struct {
+	size     int  // memtable bytes last reported
+	flushing bool // a flush is scheduled or running
+}
+
+// NewWriteBufferManager returns a manager that keeps the memtables of its
+// instances under limit bytes in total.
+func NewWriteBufferManager(limit int) *WriteBufferManager {
+	return &WriteBufferManager{
+		limit:   limit,
+		members: make(map[*DB]*writeBufferMember),
+	}
+}
+
+// Usage returns the memtable bytes currently held across all instances.
+func (w *WriteBufferManager) Usage() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	total := 0
+	for _, member := range w.members {
+		total += member.size
+	}
+	return total
+}
+
+// update records d's memtable size and returns the instance that should
+// flush to bring usage back under the limit, or nil if none should. The
+// returned instance is marked as flushing until flushed is called for it.
+func (w *WriteBufferManager) update(d *DB, size int) *DB {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	member, ok := w.members[d]
+	if !ok {
+		member = &writeBufferMember{}
+		w.members[d] = member
+	}
+	member.size = size
+
+	// Memory already being flushed will be released without further help
+	total := 0
+	var victim *DB
+	for db, m := range w.members {
+		if m.flushing {
+			continue
+		}
+		total += m.size
+		if m.size > 0 && (victim == nil || m.size > w.members[victim].size) {
+			victim = db
+		}
+	}
+	if total <= w.limit || victim == nil {
+		return nil
+	}
+	w.members[victim].flushing = true
+	return victim
+}
+
+// flushed clears the flushing mark set by update.
+func (w *WriteBufferManager) flushed(d *DB) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if member, ok := w.members[d]; ok {
+		member.flushing = false
+	}
+}
+
+// unregister drops d from the manager once it is closed.
+func (w *WriteBufferManager) unregister(d *DB) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.members, d)
+}
+
+// reportWriteBuffer tells the shared write buffer manager, if any, how much
+// memory the memtables hold, and schedules a flush on whichever instance it picks.
+// Must be called with d.mu held.
+func (d *DB) reportWriteBuffer() {
+	if d.writeBuffer == nil {
+		return
+	}
+	victim := d.writeBuffer.update(d, d.memtableSize())
+	if victim == nil {
+		return
+	}
+
+	// The victim may be another instance whose lock we must not take while
+	// holding our own, so the flush always runs on the victim's scheduler
+	err := victim.scheduler.Schedule(scheduler.JobFlush, victim.backgroundFlush)
+	if err != nil {
+		victim.writeBuffer.flushed(victim)
+		if err != scheduler.ErrClosed {
+			victim.logger("flush").Log(common.LevelError, "failed to schedule flush", "err", err)
+		}
+	}
+}
+
+// backgroundFlush flushes the memtable on behalf of the write buffer manager.
+// It drains the immutable queue itself unless a flush job already is, since
+// waiting on another job could starve it of a worker.
+func (d *DB) backgroundFlush(ctx context.Context) error {
+	defer d.writeBuffer.flushed(d)
+
+	d.mu.Lock()
+	if err := d.rotateMemtable(); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	drain := !d.flushing && len(d.immutable) > 0
+	d.flushing = d.flushing || drain
+	d.mu.Unlock()
+
+	if !drain {
+		return nil
+	}
+	return d.flushImmutables(ctx)
+}
@@ -0,0 +1,48 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"amethyst/internal/common"
+)
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+var _ Writer = (*csvWriter)(nil)
+
+// NewCSVWriter returns a Writer emitting a header row followed by one row
+// per entry. Keys and values are written as raw bytes.
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(entry *common.Entry) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(Columns); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	return c.w.Write([]string{
+		string(entry.Key),
+		string(entry.Value),
+		strconv.FormatUint(uint64(entry.Seq), 10),
+		typeName(entry.Type),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if !c.wroteHeader {
+		if err := c.w.Write(Columns); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"amethyst/internal/common"
+	"amethyst/internal/leveldb"
+)
+
+// Columns are the fields every exported row carries, in order.
+var Columns = []string{"key", "value", "seq", "type"}
+
+// Writer streams entries into an export file. Close must be called to
+// finish the file; it does not close the underlying io.Writer.
+type Writer interface {
+	Write(entry *common.Entry) error
+	Close() error
+}
+
+// Format selects the file format of an export.
+type Format int
+
+const (
+	FormatCSV Format = iota
+	FormatParquet
+	// FormatLevelDB writes a single LevelDB-format table that LevelDB and
+	// RocksDB can open; cmd/sstimport converts such tables back.
+	FormatLevelDB
+)
+
+// ParseFormat maps a format name ("csv", "parquet", or "leveldb") to a
+// Format.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "csv":
+		return FormatCSV, nil
+	case "parquet":
+		return FormatParquet, nil
+	case "leveldb":
+		return FormatLevelDB, nil
+	default:
+		return 0, fmt.Errorf("unknown export format %q", name)
+	}
+}
+
+// NewWriter returns a Writer producing the given format on w.
+func NewWriter(format Format, w io.Writer) Writer {
+	switch format {
+	case FormatParquet:
+		return NewParquetWriter(w)
+	case FormatLevelDB:
+		return leveldb.NewTableWriter(w)
+	default:
+		return NewCSVWriter(w)
+	}
+}
+
+// Export writes every entry of iter to w, then closes w. It returns the
+// number of entries written.
+func Export(iter common.EntryIterator, w Writer) (int, error) {
+	count := 0
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			return count, err
+		}
+		if entry == nil {
+			break
+		}
+		if err := w.Write(entry); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, w.Close()
+}
+
+func typeName(t common.EntryType) string {
+	if t == common.EntryTypeDelete {
+		return "delete"
+	}
+	return "put"
+}
@@ -0,0 +1,178 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/leveldb"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceIterator struct {
+	entries []*common.Entry
+	index   int
+}
+
+func (it *sliceIterator) Next() (*common.Entry, error) {
+	if it.index >= len(it.entries) {
+		return nil, nil
+	}
+	entry := it.entries[it.index]
+	it.index++
+	return entry, nil
+}
+
+var testEntries = []*common.Entry{
+	{Type: common.EntryTypePut, Seq: 7, Key: []byte("apple"), Value: []byte("red, round")},
+	{Type: common.EntryTypeDelete, Seq: 9, Key: []byte("banana")},
+}
+
+func TestCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []*common.Entry
+		expected string
+	}{
+		{"Empty", nil, "key,value,seq,type\n"},
+		{"Entries", testEntries, "key,value,seq,type\napple,\"red, round\",7,put\nbanana,,9,delete\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := Export(&sliceIterator{entries: tt.entries}, NewCSVWriter(&buf))
+			require.NoError(t, err)
+			require.Equal(t, len(tt.entries), n)
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+// thriftReader decodes the compact protocol into maps keyed by field id.
+type thriftReader struct {
+	buf []byte
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n, m := binary.Uvarint(r.buf)
+		b := r.buf[m : m+int(n)]
+		r.buf = r.buf[m+int(n):]
+		return b
+	case thriftList:
+		header := r.buf[0]
+		r.buf = r.buf[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			size, m := binary.Uvarint(r.buf)
+			r.buf, n = r.buf[m:], int(size)
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]any{}
+		var last int16
+		for {
+			header := r.buf[0]
+			r.buf = r.buf[1:]
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				last += delta
+			} else {
+				last = int16(r.varint())
+			}
+			fields[last] = r.value(header & 0x0f)
+		}
+	}
+	panic("unexpected thrift type")
+}
+
+func TestParquet(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Export(&sliceIterator{entries: testEntries}, NewParquetWriter(&buf))
+	require.NoError(t, err)
+
+	file := buf.Bytes()
+	require.Equal(t, parquetMagic, file[:4])
+	require.Equal(t, parquetMagic, file[len(file)-4:])
+	metaLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := (&thriftReader{buf: file[len(file)-8-metaLen : len(file)-8]}).value(thriftStruct).(map[int16]any)
+
+	require.Equal(t, int64(2), meta[3], "num_rows")
+	schema := meta[2].([]any)
+	require.Len(t, schema, 1+len(Columns))
+	for i, name := range Columns {
+		require.Equal(t, []byte(name), schema[i+1].(map[int16]any)[4])
+	}
+
+	// Read each column chunk back through its page header
+	groups := meta[4].([]any)
+	require.Len(t, groups, 1)
+	var columns [][]byte
+	for _, chunk := range groups[0].(map[int16]any)[1].([]any) {
+		colMeta := chunk.(map[int16]any)[3].(map[int16]any)
+		offset := colMeta[9].(int64)
+		r := &thriftReader{buf: file[offset:]}
+		header := r.value(thriftStruct).(map[int16]any)
+		require.Equal(t, int64(2), header[5].(map[int16]any)[1], "num_values")
+		columns = append(columns, r.buf[:header[2].(int64)])
+	}
+
+	byteArrays := func(data []byte) []string {
+		var values []string
+		for len(data) > 0 {
+			n := binary.LittleEndian.Uint32(data)
+			values = append(values, string(data[4:4+n]))
+			data = data[4+n:]
+		}
+		return values
+	}
+	require.Equal(t, []string{"apple", "banana"}, byteArrays(columns[0]))
+	require.Equal(t, []string{"red, round", ""}, byteArrays(columns[1]))
+	require.Equal(t, uint64(7), binary.LittleEndian.Uint64(columns[2]))
+	require.Equal(t, uint64(9), binary.LittleEndian.Uint64(columns[2][8:]))
+	require.Equal(t, []string{"put", "delete"}, byteArrays(columns[3]))
+}
+
+func TestLevelDB(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := Export(&sliceIterator{entries: testEntries}, NewWriter(FormatLevelDB, &buf))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	path := filepath.Join(t.TempDir(), "000001.ldb")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	table, err := leveldb.OpenTable(path)
+	require.NoError(t, err)
+	defer table.Close()
+
+	var entries []*common.Entry
+	iter := table.Iterator()
+	for {
+		entry, err := iter.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	require.Equal(t, testEntries, entries)
+}
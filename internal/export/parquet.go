@@ -0,0 +1,312 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"amethyst/internal/common"
+)
+
+// parquetRowGroupBytes bounds the values buffered in memory before they are
+// written out as a row group.
+const parquetRowGroupBytes = 8 << 20
+
+var parquetMagic = []byte("PAR1")
+
+// Parquet enum values used by this writer
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired   = 0
+	parquetUTF8       = 0
+	parquetPlain      = 0
+	parquetRLE        = 3
+	parquetDataPage   = 0
+	parquetCompressed = 0 // UNCOMPRESSED codec
+)
+
+// parquetColumn describes one column of the schema, in Columns order.
+type parquetColumn struct {
+	name     string
+	physical int32
+	utf8     bool
+}
+
+var parquetColumns = []parquetColumn{
+	{Columns[0], parquetByteArray, false},
+	{Columns[1], parquetByteArray, false},
+	{Columns[2], parquetInt64, false},
+	{Columns[3], parquetByteArray, true},
+}
+
+type columnChunk struct {
+	offset int64 // of the page header
+	size   int64 // page header and data
+}
+
+type rowGroup struct {
+	chunks []columnChunk
+	rows   int64
+	size   int64
+}
+
+// parquetWriter writes every column as required and PLAIN-encoded, one
+// uncompressed data page per column per row group. Tombstones carry an
+// empty value.
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	values    [4]bytes.Buffer // current row group, one buffer per column
+	rows      int64
+	totalRows int64
+	groups    []rowGroup
+	err       error
+}
+
+var _ Writer = (*parquetWriter)(nil)
+
+// NewParquetWriter returns a Writer emitting a Parquet file with the
+// key/value/seq/type schema.
+func NewParquetWriter(w io.Writer) Writer {
+	return &parquetWriter{w: w}
+}
+
+func (p *parquetWriter) Write(entry *common.Entry) error {
+	if p.err != nil {
+		return p.err
+	}
+	appendByteArray(&p.values[0], entry.Key)
+	appendByteArray(&p.values[1], entry.Value)
+	binary.Write(&p.values[2], binary.LittleEndian, int64(entry.Seq))
+	appendByteArray(&p.values[3], []byte(typeName(entry.Type)))
+	p.rows++
+
+	size := 0
+	for i := range p.values {
+		size += p.values[i].Len()
+	}
+	if size >= parquetRowGroupBytes {
+		p.err = p.flushRowGroup()
+	}
+	return p.err
+}
+
+func appendByteArray(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// write appends b to the file, starting it with the magic number first.
+func (p *parquetWriter) write(b []byte) error {
+	if p.offset == 0 {
+		n, err := p.w.Write(parquetMagic)
+		p.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// flushRowGroup writes the buffered rows as one column chunk per column.
+func (p *parquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+
+	group := rowGroup{rows: p.rows}
+	for i := range p.values {
+		data := p.values[i].Bytes()
+		header := encodePageHeader(len(data), p.rows)
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(data); err != nil {
+			return err
+		}
+
+		chunk := columnChunk{size: int64(len(header) + len(data))}
+		chunk.offset = p.offset - chunk.size
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+		p.values[i].Reset()
+	}
+
+	p.groups = append(p.groups, group)
+	p.totalRows += p.rows
+	p.rows = 0
+	return nil
+}
+
+// Close writes the last row group and the file footer.
+func (p *parquetWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+
+	meta := p.encodeFileMetaData()
+	footer := binary.LittleEndian.AppendUint32(meta, uint32(len(meta)))
+	footer = append(footer, parquetMagic...)
+	return p.write(footer)
+}
+
+func encodePageHeader(size int, rows int64) []byte {
+	t := newThriftWriter()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(size)) // uncompressed
+	t.i32(3, int32(size)) // compressed
+	t.beginStruct(5)      // DataPageHeader
+	t.i32(1, int32(rows))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE) // definition levels, absent for required columns
+	t.i32(4, parquetRLE) // repetition levels, likewise
+	t.endStruct()
+	return t.finish()
+}
+
+func (p *parquetWriter) encodeFileMetaData() []byte {
+	t := newThriftWriter()
+	t.i32(1, 1) // version
+
+	t.beginList(2, thriftStruct, 1+len(parquetColumns))
+	t.beginElement()
+	t.binary(4, []byte("schema"))
+	t.i32(5, int32(len(parquetColumns)))
+	t.endStruct()
+	for _, col := range parquetColumns {
+		t.beginElement()
+		t.i32(1, col.physical)
+		t.i32(3, parquetRequired)
+		t.binary(4, []byte(col.name))
+		if col.utf8 {
+			t.i32(6, parquetUTF8)
+		}
+		t.endStruct()
+	}
+
+	t.i64(3, p.totalRows)
+
+	t.beginList(4, thriftStruct, len(p.groups))
+	for _, group := range p.groups {
+		t.beginElement()
+		t.beginList(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			col := parquetColumns[i]
+			t.beginElement()
+			t.i64(2, chunk.offset)
+			t.beginStruct(3) // ColumnMetaData
+			t.i32(1, col.physical)
+			t.beginList(2, thriftI32, 1)
+			t.elementI32(parquetPlain)
+			t.beginList(3, thriftBinary, 1)
+			t.elementBinary([]byte(col.name))
+			t.i32(4, parquetCompressed)
+			t.i64(5, group.rows)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.endStruct()
+	}
+
+	t.binary(6, []byte("amethyst"))
+	return t.finish()
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes Parquet's metadata structures with the Thrift
+// compact protocol. Field ids are delta-encoded against the previous field
+// of the enclosing struct, so it tracks one last id per nesting level.
+type thriftWriter struct {
+	buf    []byte
+	lastID []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{lastID: []int16{0}}
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.lastID[len(t.lastID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, b []byte) {
+	t.field(id, thriftBinary)
+	t.elementBinary(b)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElement()
+}
+
+// beginElement starts a struct that is a list element rather than a field.
+func (t *thriftWriter) beginElement() {
+	t.lastID = append(t.lastID, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf = append(t.buf, 0)
+	t.lastID = t.lastID[:len(t.lastID)-1]
+}
+
+func (t *thriftWriter) beginList(id int16, elemType byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thriftWriter) elementI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) elementBinary(b []byte) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(b)))
+	t.buf = append(t.buf, b...)
+}
+
+// finish terminates the top-level struct and returns the encoding.
+func (t *thriftWriter) finish() []byte {
+	t.buf = append(t.buf, 0)
+	return t.buf
+}
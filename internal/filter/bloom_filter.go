@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"bytes"
 	"hash/fnv"
 	"io"
 	"math"
@@ -154,3 +155,42 @@ func ReadBloomFilter(r io.Reader) (Filter, error) {
 
 	return NewBloomFilterFromBytes(k, m, data), nil
 }
+
+// bloomPolicy builds bloom filters of a fixed number of bits per key.
+type bloomPolicy struct {
+	bitsPerKey float64
+}
+
+// NewBloomPolicy returns a policy building bloom filters of bitsPerKey bits
+// per key; see BloomBitsPerKey for the false positive rate it buys.
+func NewBloomPolicy(bitsPerKey float64) Policy {
+	return bloomPolicy{bitsPerKey: bitsPerKey}
+}
+
+func (bloomPolicy) Type() Type   { return BloomType }
+func (bloomPolicy) Name() string { return "bloom" }
+
+// NewBuilder sizes the filter as OptimalBloomFilterParams does, from bits
+// per key rather than a false positive rate.
+func (p bloomPolicy) NewBuilder(n uint32) Builder {
+	n = max(n, 1)
+	m := uint32(math.Ceil(float64(n) * p.bitsPerKey))
+	k := max(uint32(math.Ceil(float64(m)/float64(n)*math.Ln2)), 1)
+	return &bloomBuilder{NewBloomFilter(k, max(m, 1))}
+}
+
+func (bloomPolicy) Read(data []byte) (Reader, error) {
+	return ReadBloomFilter(bytes.NewReader(data))
+}
+
+type bloomBuilder struct {
+	Filter
+}
+
+func (b *bloomBuilder) Finish() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := WriteBloomFilter(&buf, b.Filter); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,5 +1,17 @@
 package filter
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownPolicy is returned for a filter type that isn't registered.
+var ErrUnknownPolicy = errors.New("filter: unknown policy")
+
+// ErrCorrupt is returned for an encoded filter that can't be decoded.
+var ErrCorrupt = errors.New("filter: corrupt filter")
+
 // Filter provides fast negative lookups for set membership testing.
 // A filter can definitively say a key is NOT present, but can only
 // say a key MIGHT be present (false positives possible, false negatives not).
@@ -11,3 +23,87 @@ type Filter interface {
 	// Returns false if the key is definitely NOT in the set.
 	MayContain(key []byte) bool
 }
+
+// Reader answers membership queries against a filter read back from disk.
+// Filters that can't take more keys once built implement only this half of
+// Filter.
+type Reader interface {
+	// MayContain returns true if the key might be in the set.
+	// Returns false if the key is definitely NOT in the set.
+	MayContain(key []byte) bool
+}
+
+// Builder collects the keys of one filter and encodes it.
+type Builder interface {
+	// Add inserts a key into the filter being built. Adding a key twice is
+	// harmless.
+	Add(key []byte)
+	// Finish returns the encoded filter, which the policy's Read parses. An
+	// empty result means there is no filter to store.
+	Finish() ([]byte, error)
+}
+
+// Type identifies a filter policy on disk.
+type Type uint8
+
+const (
+	NoneType   Type = 0
+	BloomType  Type = 1
+	RibbonType Type = 2
+)
+
+// Policy decides how a table's keys are filtered. The policy's Type is
+// stored with each filter it builds, so a filter stays readable whatever
+// policy is configured when it is read. Implementations must be safe for
+// concurrent use.
+type Policy interface {
+	// Type is recorded with every filter the policy builds.
+	Type() Type
+	// Name is the policy's human-readable name, e.g. "bloom".
+	Name() string
+	// NewBuilder returns a builder for a filter of about n keys.
+	NewBuilder(n uint32) Builder
+	// Read parses a filter the policy's builders encoded. It must not
+	// depend on the policy's configuration, since a filter is read by the
+	// registered policy of its type.
+	Read(data []byte) (Reader, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[Type]Policy{}
+)
+
+// Register makes p available to Lookup, replacing any policy of the same
+// type. The built-in policies are registered already.
+func Register(p Policy) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Type()] = p
+}
+
+// Lookup returns the registered policy for t.
+func Lookup(t Type) (Policy, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: type %d", ErrUnknownPolicy, t)
+	}
+	return p, nil
+}
+
+// Read parses data with the policy registered for t.
+func Read(t Type, data []byte) (Reader, error) {
+	p, err := Lookup(t)
+	if err != nil {
+		return nil, err
+	}
+	return p.Read(data)
+}
+
+func init() {
+	for _, p := range []Policy{None, NewBloomPolicy(DefaultBitsPerKey), NewRibbonPolicy(DefaultBitsPerKey)} {
+		Register(p)
+	}
+}
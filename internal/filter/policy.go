@@ -0,0 +1,35 @@
+package filter
+
+import "math"
+
+// DefaultBitsPerKey is the space the registered bloom and ribbon policies
+// are configured with. It gives bloom filters about a 1% false positive
+// rate and ribbon filters about 0.2%.
+const DefaultBitsPerKey = 10
+
+// None builds no filter, so every lookup reads the table's index and data.
+// It suits workloads whose reads mostly find their keys.
+var None Policy = nonePolicy{}
+
+type nonePolicy struct{}
+
+func (nonePolicy) Type() Type                  { return NoneType }
+func (nonePolicy) Name() string                { return "none" }
+func (nonePolicy) NewBuilder(uint32) Builder   { return noneBuilder{} }
+func (nonePolicy) Read([]byte) (Reader, error) { return noneReader{}, nil }
+
+type noneBuilder struct{}
+
+func (noneBuilder) Add([]byte)              {}
+func (noneBuilder) Finish() ([]byte, error) { return nil, nil }
+
+type noneReader struct{}
+
+func (noneReader) MayContain([]byte) bool { return true }
+
+// BloomBitsPerKey returns the bits per key a bloom filter needs for a false
+// positive rate of fpr.
+func BloomBitsPerKey(fpr float64) float64 {
+	// bits/key = -ln(p) / (ln(2)^2)
+	return -math.Log(fpr) / (math.Ln2 * math.Ln2)
+}
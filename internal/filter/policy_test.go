@@ -0,0 +1,54 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoliciesRoundTrip(t *testing.T) {
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "key-%d", i)
+	}
+
+	for _, p := range []Policy{None, NewBloomPolicy(10), NewRibbonPolicy(10)} {
+		t.Run(p.Name(), func(t *testing.T) {
+			b := p.NewBuilder(uint32(len(keys)))
+			for _, key := range keys {
+				b.Add(key)
+			}
+			data, err := b.Finish()
+			require.NoError(t, err)
+
+			// Filters are read back by the registered policy of their type
+			f, err := Read(p.Type(), data)
+			require.NoError(t, err)
+			for _, key := range keys {
+				require.True(t, f.MayContain(key), "key %s should be found", key)
+			}
+		})
+	}
+}
+
+func TestNoneBuildsNothing(t *testing.T) {
+	b := None.NewBuilder(10)
+	b.Add([]byte("key"))
+	data, err := b.Finish()
+	require.NoError(t, err)
+	require.Empty(t, data)
+}
+
+func TestBloomPolicyMatchesFPR(t *testing.T) {
+	b := NewBloomPolicy(BloomBitsPerKey(0.01)).NewBuilder(1000).(*bloomBuilder)
+	k, m := OptimalBloomFilterParams(1000, 0.01)
+	bf := b.Filter.(*bloomFilter)
+	require.Equal(t, k, bf.k)
+	require.InDelta(t, m, bf.m, 1)
+}
+
+func TestLookupUnknownPolicy(t *testing.T) {
+	_, err := Lookup(Type(200))
+	require.ErrorIs(t, err, ErrUnknownPolicy)
+}
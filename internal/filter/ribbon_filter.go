@@ -0,0 +1,257 @@
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// A ribbon filter (Dillinger & Walzer, "Ribbon filter: practically smaller
+// than Bloom and Xor") stores an r-bit solution row per slot, chosen so
+// that every key's fingerprint is the XOR of the rows its 64-bit
+// coefficient selects from a window starting at the key's slot. A lookup
+// recomputes that XOR; other keys match their fingerprint with probability
+// 2^-r. For the same false positive rate it needs about 30% less space
+// than a bloom filter, at the cost of being built only once all keys are
+// known.
+//
+// Ribbon Filter Layout:
+//
+// ┌──────────────────┐
+// │       seed       │  uint32 - mixed into key hashes; retried until the rows solve
+// ├──────────────────┤
+// │      slots       │  uint32 - m; 0 for a filter of no keys
+// ├──────────────────┤
+// │   result bits    │  uint8 - r
+// ├──────────────────┤
+// │    column 0      │  ceil(m/64) uint64s - bit i is bit 0 of slot i's row
+// ├──────────────────┤
+// │       ...        │
+// ├──────────────────┤
+// │   column r-1     │
+// └──────────────────┘
+
+const (
+	// ribbonWidth is the number of slots a key's coefficient spans.
+	ribbonWidth = 64
+
+	// ribbonOverhead is the slots allocated per key. Standard ribbons of
+	// width 64 rarely fail to solve with 10% spare slots.
+	ribbonOverhead = 1.1
+
+	// ribbonSeeds is how many seeds are tried at one size before the
+	// filter grows.
+	ribbonSeeds = 4
+
+	ribbonHeaderSize = 9
+)
+
+// ribbonPolicy builds ribbon filters of about a fixed number of bits per key.
+type ribbonPolicy struct {
+	bitsPerKey float64
+}
+
+// NewRibbonPolicy returns a policy building ribbon filters of at most about
+// bitsPerKey bits per key. Every 1.1 bits per key halves the false positive
+// rate, up to 35 bits per key.
+func NewRibbonPolicy(bitsPerKey float64) Policy {
+	return ribbonPolicy{bitsPerKey: bitsPerKey}
+}
+
+func (ribbonPolicy) Type() Type   { return RibbonType }
+func (ribbonPolicy) Name() string { return "ribbon" }
+
+func (p ribbonPolicy) NewBuilder(n uint32) Builder {
+	r := math.Floor(p.bitsPerKey / ribbonOverhead)
+	return &ribbonBuilder{
+		resultBits: uint8(min(max(r, 1), 32)),
+		hashes:     make([]uint64, 0, n),
+	}
+}
+
+func (ribbonPolicy) Read(data []byte) (Reader, error) {
+	if len(data) < ribbonHeaderSize {
+		return nil, fmt.Errorf("%w: ribbon header is truncated", ErrCorrupt)
+	}
+	f := &ribbonFilter{
+		seed:       binary.LittleEndian.Uint32(data),
+		slots:      binary.LittleEndian.Uint32(data[4:]),
+		resultBits: data[8],
+	}
+	if f.resultBits < 1 || f.resultBits > 32 || (f.slots > 0 && f.slots < ribbonWidth) {
+		return nil, fmt.Errorf("%w: bad ribbon shape %d x %d", ErrCorrupt, f.slots, f.resultBits)
+	}
+	words := ribbonWords(f.slots)
+	data = data[ribbonHeaderSize:]
+	if len(data) != 8*words*int(f.resultBits) {
+		return nil, fmt.Errorf("%w: ribbon columns are %d bytes", ErrCorrupt, len(data))
+	}
+	f.columns = make([][]uint64, f.resultBits)
+	for j := range f.columns {
+		f.columns[j] = make([]uint64, words)
+		for i := range words {
+			f.columns[j][i] = binary.LittleEndian.Uint64(data[8*(j*words+i):])
+		}
+	}
+	return f, nil
+}
+
+// ribbonBuilder collects key hashes; the filter is solved in Finish.
+type ribbonBuilder struct {
+	resultBits uint8
+	hashes     []uint64
+}
+
+func (b *ribbonBuilder) Add(key []byte) {
+	b.hashes = append(b.hashes, ribbonHash(key))
+}
+
+func (b *ribbonBuilder) Finish() ([]byte, error) {
+	slices.Sort(b.hashes)
+	b.hashes = slices.Compact(b.hashes)
+
+	f := &ribbonFilter{resultBits: b.resultBits}
+	if len(b.hashes) > 0 {
+		f.slots = max(uint32(math.Ceil(float64(len(b.hashes))*ribbonOverhead)), ribbonWidth)
+		for !f.solve(b.hashes) {
+			if f.seed++; f.seed%ribbonSeeds == 0 {
+				f.slots += f.slots / 10
+			}
+		}
+	}
+
+	words := ribbonWords(f.slots)
+	buf := make([]byte, ribbonHeaderSize, ribbonHeaderSize+8*words*int(f.resultBits))
+	binary.LittleEndian.PutUint32(buf, f.seed)
+	binary.LittleEndian.PutUint32(buf[4:], f.slots)
+	buf[8] = f.resultBits
+	for _, column := range f.columns {
+		for _, w := range column {
+			buf = binary.LittleEndian.AppendUint64(buf, w)
+		}
+	}
+	return buf, nil
+}
+
+// ribbonFilter is a solved ribbon filter. columns[j] holds bit j of every
+// slot's row, so a key's window of a column is at most two words.
+type ribbonFilter struct {
+	seed       uint32
+	slots      uint32
+	resultBits uint8
+	columns    [][]uint64
+}
+
+var _ Reader = (*ribbonFilter)(nil)
+
+// MayContain returns true if the key might be in the set.
+// Returns false if the key is definitely NOT in the set.
+func (f *ribbonFilter) MayContain(key []byte) bool {
+	if f.slots == 0 {
+		return false
+	}
+	start, coeff, result := f.row(ribbonHash(key))
+	for j, column := range f.columns {
+		parity := bits.OnesCount64(window(column, start)&coeff) & 1
+		if uint32(parity) != (result>>j)&1 {
+			return false
+		}
+	}
+	return true
+}
+
+// solve fills the columns so every hash's row holds, reporting false if
+// two rows contradict each other under f.seed.
+func (f *ribbonFilter) solve(hashes []uint64) bool {
+	// Gaussian elimination into a banded matrix: each slot holds at most
+	// one row, whose coefficient's lowest bit is at the slot
+	coeffs := make([]uint64, f.slots)
+	results := make([]uint32, f.slots)
+	for _, h := range hashes {
+		start, coeff, result := f.row(h)
+		for {
+			if coeffs[start] == 0 {
+				coeffs[start], results[start] = coeff, result
+				break
+			}
+			coeff ^= coeffs[start]
+			result ^= results[start]
+			if coeff == 0 {
+				if result != 0 {
+					return false
+				}
+				break // implied by rows already added
+			}
+			shift := bits.TrailingZeros64(coeff)
+			start += uint32(shift)
+			coeff >>= shift
+		}
+	}
+
+	// Back substitution from the last slot, keeping the last 64 solved
+	// bits of each column in state; empty slots solve to 0
+	f.columns = make([][]uint64, f.resultBits)
+	words := ribbonWords(f.slots)
+	for j := range f.columns {
+		f.columns[j] = make([]uint64, words)
+	}
+	state := make([]uint64, f.resultBits)
+	for i := int(f.slots) - 1; i >= 0; i-- {
+		for j := range state {
+			state[j] <<= 1
+			if coeffs[i] == 0 {
+				continue
+			}
+			bit := uint64(bits.OnesCount64(state[j]&coeffs[i])&1) ^ uint64(results[i]>>j&1)
+			state[j] |= bit
+			f.columns[j][i/64] |= bit << (i % 64)
+		}
+	}
+	return true
+}
+
+// row derives a key's starting slot, coefficient, and fingerprint from its
+// hash under f.seed.
+func (f *ribbonFilter) row(h uint64) (start uint32, coeff uint64, result uint32) {
+	h = mix64(h + uint64(f.seed)*0x9e3779b97f4a7c15)
+	hi, _ := bits.Mul64(h, uint64(f.slots-ribbonWidth+1))
+	coeff = mix64(h) | 1
+	result = uint32(h)
+	if f.resultBits < 32 {
+		result &= 1<<f.resultBits - 1
+	}
+	return uint32(hi), coeff, result
+}
+
+// window returns the 64 bits of column starting at bit start.
+func window(column []uint64, start uint32) uint64 {
+	w, shift := start/64, start%64
+	if shift == 0 {
+		return column[w]
+	}
+	return column[w]>>shift | column[w+1]<<(64-shift)
+}
+
+func ribbonWords(slots uint32) int {
+	return int((slots + 63) / 64)
+}
+
+func ribbonHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// mix64 is the splitmix64 finalizer, spreading FNV's weak low bits over
+// the whole word.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func buildRibbon(t *testing.T, bitsPerKey float64, keys [][]byte) Reader {
+	t.Helper()
+	p := NewRibbonPolicy(bitsPerKey)
+	b := p.NewBuilder(uint32(len(keys)))
+	for _, key := range keys {
+		b.Add(key)
+	}
+	data, err := b.Finish()
+	require.NoError(t, err)
+	f, err := p.Read(data)
+	require.NoError(t, err)
+	return f
+}
+
+func TestRibbonFilterNoFalseNegatives(t *testing.T) {
+	for _, n := range []int{1, 10, 63, 64, 1000, 20000} {
+		keys := make([][]byte, n)
+		for i := range keys {
+			keys[i] = fmt.Appendf(nil, "key-%d", i)
+		}
+		f := buildRibbon(t, 10, keys)
+		for _, key := range keys {
+			require.True(t, f.MayContain(key), "n=%d: key %s should be found", n, key)
+		}
+	}
+}
+
+func TestRibbonFilterFalsePositiveRate(t *testing.T) {
+	n := 10000
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "key-%d", i)
+	}
+
+	for _, bitsPerKey := range []float64{5, 10, 16} {
+		f := buildRibbon(t, bitsPerKey, keys).(*ribbonFilter)
+		falsePositives := 0
+		testCount := 100000
+		for i := range testCount {
+			if f.MayContain(fmt.Appendf(nil, "other-%d", i)) {
+				falsePositives++
+			}
+		}
+		observedFP := float64(falsePositives) / float64(testCount)
+		target := 1 / float64(uint64(1)<<f.resultBits)
+		require.LessOrEqual(t, observedFP, target*2+10/float64(testCount), "bits/key %.0f: r=%d", bitsPerKey, f.resultBits)
+
+		// The filter stays within the bits per key it was configured with
+		bits := float64(f.slots) * float64(f.resultBits)
+		require.LessOrEqual(t, bits/float64(n), bitsPerKey*1.1)
+		t.Logf("bits/key %.0f: fp rate %.5f (target %.5f), %.2f bits/key",
+			bitsPerKey, observedFP, target, bits/float64(n))
+	}
+}
+
+func TestRibbonFilterDuplicateKeys(t *testing.T) {
+	var keys [][]byte
+	for i := range 500 {
+		keys = append(keys, fmt.Appendf(nil, "prefix-%d", i%7), fmt.Appendf(nil, "key-%d", i))
+	}
+	f := buildRibbon(t, 10, keys)
+	for _, key := range keys {
+		require.True(t, f.MayContain(key), "key %s should be found", key)
+	}
+}
+
+func TestRibbonFilterEmpty(t *testing.T) {
+	f := buildRibbon(t, 10, nil)
+	require.False(t, f.MayContain([]byte("anything")))
+}
+
+func TestRibbonFilterCorrupt(t *testing.T) {
+	p := NewRibbonPolicy(10)
+	b := p.NewBuilder(100)
+	for i := range 100 {
+		b.Add(fmt.Appendf(nil, "key-%d", i))
+	}
+	data, err := b.Finish()
+	require.NoError(t, err)
+
+	_, err = p.Read(data[:5])
+	require.ErrorIs(t, err, ErrCorrupt)
+	_, err = p.Read(data[:len(data)-1])
+	require.ErrorIs(t, err, ErrCorrupt)
+}
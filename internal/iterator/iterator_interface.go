@@ -0,0 +1,34 @@
+package iterator
+
+import (
+	"io"
+
+	"amethyst/internal/common"
+)
+
+// Iterator is an EntryIterator that may hold resources (file handles,
+// pinned tables) until it is closed.
+type Iterator interface {
+	common.EntryIterator
+
+	// Close releases resources held by the iterator. Safe to call multiple times.
+	Close() error
+}
+
+// Seeker is implemented by iterators that can skip ahead without reading
+// the entries they pass over.
+type Seeker interface {
+	// Seek positions the iterator so that Next returns the first entry not
+	// yet returned whose key is at least key. Entries already returned are
+	// not revisited.
+	Seek(key []byte) error
+}
+
+// Close releases it if the underlying implementation holds resources.
+// Iterators without a Close method are left untouched.
+func Close(it common.EntryIterator) error {
+	if c, ok := it.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
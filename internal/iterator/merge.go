@@ -0,0 +1,200 @@
+package iterator
+
+import (
+	"bytes"
+	"container/heap"
+
+	"amethyst/internal/common"
+)
+
+// mergingIterator performs a k-way merge over sorted child iterators.
+//
+// Children must be passed newest first (memtable, then L0 newest to oldest,
+// then L1, L2, ...). When several children hold the same key, only the entry
+// from the newest child is returned; older versions are skipped. Tombstones
+// are returned like any other entry so callers can decide how to treat them.
+type mergingIterator struct {
+	children []common.EntryIterator
+	heap     mergeHeap
+	started  bool
+	err      error
+	lower    []byte // first key returned, if not nil
+	upper    []byte // key iteration ends at, if not nil
+}
+
+var (
+	_ Iterator = (*mergingIterator)(nil)
+	_ Seeker   = (*mergingIterator)(nil)
+)
+
+// NewMergingIterator returns an iterator over the union of children in key
+// order, keeping only the newest entry for each key.
+func NewMergingIterator(children ...common.EntryIterator) Iterator {
+	return &mergingIterator{children: children}
+}
+
+// NewBoundedMergingIterator is like NewMergingIterator but returns only the
+// keys in [lower, upper); a nil bound leaves that side open. Children that
+// implement Seeker are sought to lower rather than read up to it, and none
+// is read past the first key at or after upper.
+func NewBoundedMergingIterator(lower, upper []byte, children ...common.EntryIterator) Iterator {
+	return &mergingIterator{children: children, lower: lower, upper: upper}
+}
+
+// heapItem is the current head of one child iterator.
+type heapItem struct {
+	entry *common.Entry
+	child int // index into children; lower is newer
+}
+
+// mergeHeap orders heads by key, breaking ties by child recency.
+type mergeHeap []heapItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	cmp := bytes.Compare(h[i].entry.Key, h[j].entry.Key)
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return h[i].child < h[j].child
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(heapItem)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// advance pulls the next entry from child i and pushes it onto the heap.
+func (it *mergingIterator) advance(i int) error {
+	entry, err := it.children[i].Next()
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		heap.Push(&it.heap, heapItem{entry: entry, child: i})
+	}
+	return nil
+}
+
+// Next returns the next entry in key order, or nil when all children are exhausted.
+func (it *mergingIterator) Next() (*common.Entry, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	// Prime the heap with the head of every child
+	if !it.started {
+		if it.lower != nil {
+			if err := it.Seek(it.lower); err != nil {
+				return nil, err
+			}
+		} else {
+			it.started = true
+			for i := range it.children {
+				if err := it.advance(i); err != nil {
+					it.err = err
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if it.heap.Len() == 0 {
+		return nil, nil
+	}
+	if it.upper != nil && bytes.Compare(it.heap[0].entry.Key, it.upper) >= 0 {
+		return nil, nil
+	}
+
+	top := heap.Pop(&it.heap).(heapItem)
+	if err := it.advance(top.child); err != nil {
+		it.err = err
+		return nil, err
+	}
+
+	// Skip older versions of the same key in other children
+	for it.heap.Len() > 0 && bytes.Equal(it.heap[0].entry.Key, top.entry.Key) {
+		dup := heap.Pop(&it.heap).(heapItem)
+		if err := it.advance(dup.child); err != nil {
+			it.err = err
+			return nil, err
+		}
+	}
+
+	return top.entry, nil
+}
+
+// Seek positions the iterator at the first key at or after key, or at its
+// lower bound if that is later. Children already there keep their place;
+// the rest are sought if they implement Seeker and read forward otherwise.
+func (it *mergingIterator) Seek(key []byte) error {
+	if it.err != nil {
+		return it.err
+	}
+	if it.lower != nil && bytes.Compare(key, it.lower) < 0 {
+		key = it.lower
+	}
+
+	heads := make([]*common.Entry, len(it.children))
+	for _, item := range it.heap {
+		heads[item.child] = item.entry
+	}
+	it.heap = it.heap[:0]
+	for i := range it.children {
+		switch {
+		case it.started && heads[i] == nil:
+			// Exhausted
+		case heads[i] != nil && bytes.Compare(heads[i].Key, key) >= 0:
+			it.heap = append(it.heap, heapItem{entry: heads[i], child: i})
+		default:
+			if err := it.seekChild(i, key); err != nil {
+				it.err = err
+				return err
+			}
+		}
+	}
+	it.started = true
+	heap.Init(&it.heap)
+	return nil
+}
+
+// seekChild adds child i's first entry at or after key to the heap, without
+// restoring the heap order.
+func (it *mergingIterator) seekChild(i int, key []byte) error {
+	child := it.children[i]
+	if s, ok := child.(Seeker); ok {
+		if err := s.Seek(key); err != nil {
+			return err
+		}
+	}
+	for {
+		entry, err := child.Next()
+		if err != nil || entry == nil {
+			return err
+		}
+		if bytes.Compare(entry.Key, key) >= 0 {
+			it.heap = append(it.heap, heapItem{entry: entry, child: i})
+			return nil
+		}
+	}
+}
+
+// Close closes every child iterator, returning the first error encountered.
+func (it *mergingIterator) Close() error {
+	var firstErr error
+	for _, child := range it.children {
+		if err := Close(child); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	it.children = nil
+	it.heap = nil
+	return firstErr
+}
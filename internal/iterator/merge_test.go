@@ -0,0 +1,216 @@
+package iterator
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceIterator yields a fixed list of entries and records whether it was closed.
+type sliceIterator struct {
+	entries []*common.Entry
+	index   int
+	closed  bool
+}
+
+func (it *sliceIterator) Next() (*common.Entry, error) {
+	if it.index >= len(it.entries) {
+		return nil, nil
+	}
+	entry := it.entries[it.index]
+	it.index++
+	return entry, nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+type failingIterator struct{}
+
+func (failingIterator) Next() (*common.Entry, error) {
+	return nil, errors.New("boom")
+}
+
+func put(key, value string) *common.Entry {
+	return &common.Entry{Type: common.EntryTypePut, Key: []byte(key), Value: []byte(value)}
+}
+
+func del(key string) *common.Entry {
+	return &common.Entry{Type: common.EntryTypeDelete, Key: []byte(key)}
+}
+
+func TestMergingIterator(t *testing.T) {
+	tests := []struct {
+		name     string
+		children [][]*common.Entry
+		expected []*common.Entry
+	}{
+		{
+			name:     "No children",
+			children: nil,
+			expected: nil,
+		},
+		{
+			name: "Single child",
+			children: [][]*common.Entry{
+				{put("a", "1"), put("b", "2")},
+			},
+			expected: []*common.Entry{put("a", "1"), put("b", "2")},
+		},
+		{
+			name: "Disjoint children interleave",
+			children: [][]*common.Entry{
+				{put("b", "2"), put("d", "4")},
+				{put("a", "1"), put("c", "3")},
+			},
+			expected: []*common.Entry{put("a", "1"), put("b", "2"), put("c", "3"), put("d", "4")},
+		},
+		{
+			name: "Newest child wins on duplicate key",
+			children: [][]*common.Entry{
+				{put("a", "new")},
+				{put("a", "mid"), put("b", "old")},
+				{put("a", "old")},
+			},
+			expected: []*common.Entry{put("a", "new"), put("b", "old")},
+		},
+		{
+			name: "Tombstones are surfaced",
+			children: [][]*common.Entry{
+				{del("a")},
+				{put("a", "old"), put("b", "2")},
+			},
+			expected: []*common.Entry{del("a"), put("b", "2")},
+		},
+		{
+			name: "Empty children are ignored",
+			children: [][]*common.Entry{
+				{},
+				{put("a", "1")},
+				{},
+			},
+			expected: []*common.Entry{put("a", "1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			children := make([]common.EntryIterator, len(tt.children))
+			for i, entries := range tt.children {
+				children[i] = &sliceIterator{entries: entries}
+			}
+
+			it := NewMergingIterator(children...)
+			common.RequireMatchesIterator(t, it, tt.expected)
+		})
+	}
+}
+
+func TestMergingIteratorClose(t *testing.T) {
+	a := &sliceIterator{entries: []*common.Entry{put("a", "1")}}
+	b := &sliceIterator{entries: []*common.Entry{put("b", "2")}}
+
+	it := NewMergingIterator(a, b)
+	require.NoError(t, it.Close())
+	require.True(t, a.closed)
+	require.True(t, b.closed)
+
+	entry, err := it.Next()
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+func TestMergingIteratorError(t *testing.T) {
+	it := NewMergingIterator(&sliceIterator{entries: []*common.Entry{put("a", "1")}}, failingIterator{})
+
+	_, err := it.Next()
+	require.Error(t, err)
+
+	// Errors are sticky
+	_, err = it.Next()
+	require.Error(t, err)
+}
+
+// seekingIterator is a sliceIterator that can seek, counting the entries
+// read through Next.
+type seekingIterator struct {
+	sliceIterator
+	reads int
+}
+
+func (it *seekingIterator) Next() (*common.Entry, error) {
+	entry, err := it.sliceIterator.Next()
+	if entry != nil {
+		it.reads++
+	}
+	return entry, err
+}
+
+func (it *seekingIterator) Seek(key []byte) error {
+	for it.index < len(it.entries) && bytes.Compare(it.entries[it.index].Key, key) < 0 {
+		it.index++
+	}
+	return nil
+}
+
+func TestBoundedMergingIterator(t *testing.T) {
+	tests := []struct {
+		name         string
+		lower, upper string
+		expected     []*common.Entry
+	}{
+		{"Unbounded", "", "", []*common.Entry{put("a", "1"), put("b", "new"), put("c", "3"), put("d", "4"), put("e", "5")}},
+		{"Lower bound", "b", "", []*common.Entry{put("b", "new"), put("c", "3"), put("d", "4"), put("e", "5")}},
+		{"Upper bound", "", "d", []*common.Entry{put("a", "1"), put("b", "new"), put("c", "3")}},
+		{"Both bounds", "bb", "e", []*common.Entry{put("c", "3"), put("d", "4")}},
+		{"Empty range", "x", "z", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lower, upper []byte
+			if tt.lower != "" {
+				lower = []byte(tt.lower)
+			}
+			if tt.upper != "" {
+				upper = []byte(tt.upper)
+			}
+			seeker := &seekingIterator{sliceIterator: sliceIterator{entries: []*common.Entry{put("a", "1"), put("b", "new"), put("d", "4")}}}
+			plain := &sliceIterator{entries: []*common.Entry{put("b", "old"), put("c", "3"), put("e", "5")}}
+
+			it := NewBoundedMergingIterator(lower, upper, seeker, plain)
+			common.RequireMatchesIterator(t, it, tt.expected)
+
+			// The seekable child is never read below the lower bound
+			for _, entry := range seeker.entries[:seeker.index-seeker.reads] {
+				require.Less(t, string(entry.Key), tt.lower)
+			}
+		})
+	}
+}
+
+func TestMergingIteratorSeek(t *testing.T) {
+	a := &seekingIterator{sliceIterator: sliceIterator{entries: []*common.Entry{put("a", "1"), put("c", "3"), put("e", "5"), put("g", "7")}}}
+	b := &sliceIterator{entries: []*common.Entry{put("b", "2"), put("d", "4"), put("f", "6")}}
+	it := NewMergingIterator(a, b)
+
+	// Seek before the first Next starts there
+	require.NoError(t, it.(Seeker).Seek([]byte("c")))
+	entry, err := it.Next()
+	require.NoError(t, err)
+	require.Equal(t, put("c", "3"), entry)
+	require.Equal(t, 2, a.reads, "a reads c and its next head, e, but skips a")
+
+	// Seek mid-iteration skips ahead, and seeking back doesn't revisit
+	require.NoError(t, it.(Seeker).Seek([]byte("ee")))
+	entry, err = it.Next()
+	require.NoError(t, err)
+	require.Equal(t, put("f", "6"), entry)
+	require.NoError(t, it.(Seeker).Seek([]byte("a")))
+	common.RequireMatchesIterator(t, it, []*common.Entry{put("g", "7")})
+}
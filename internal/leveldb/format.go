@@ -0,0 +1,200 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"amethyst/internal/common"
+	"amethyst/internal/compression"
+)
+
+const (
+	// levelDBMagic ends LevelDB tables and RocksDB tables written with the
+	// legacy footer.
+	levelDBMagic uint64 = 0xdb4775248b80fb57
+	// rocksDBMagic ends RocksDB block-based tables with the versioned footer.
+	rocksDBMagic uint64 = 0x88e241b785f4cff7
+
+	// legacyFooterSize holds two block handles padded to 40 bytes, then the
+	// magic number. The versioned footer adds a leading checksum type byte
+	// and a format version before the magic.
+	legacyFooterSize    = 48
+	versionedFooterSize = 53
+	maxHandlesSize      = 40
+
+	// blockTrailerSize follows every block: compression type, then a masked
+	// CRC32C of the block contents and the type byte.
+	blockTrailerSize = 5
+
+	noCompression     = 0
+	snappyCompression = 1
+
+	rocksDBChecksumCRC32C = 1
+	maxRocksDBVersion     = 2
+
+	// Internal key types stored in the low byte of the trailer
+	typeDeletion = 0
+	typeValue    = 1
+)
+
+// blockHandle locates a block within the file, excluding its trailer.
+type blockHandle struct {
+	offset uint64
+	size   uint64
+}
+
+// decodeBlockHandle parses a varint-encoded handle and returns the bytes read.
+func decodeBlockHandle(buf []byte) (blockHandle, int, error) {
+	offset, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return blockHandle{}, 0, fmt.Errorf("%w: bad block handle", ErrCorruptBlock)
+	}
+	size, m := binary.Uvarint(buf[n:])
+	if m <= 0 {
+		return blockHandle{}, 0, fmt.Errorf("%w: bad block handle", ErrCorruptBlock)
+	}
+	return blockHandle{offset: offset, size: size}, n + m, nil
+}
+
+// readFooter returns the handle of the index block from the end of a file
+// of the given size.
+func readFooter(r io.ReaderAt, size int64) (blockHandle, error) {
+	if size < legacyFooterSize {
+		return blockHandle{}, ErrBadMagic
+	}
+	buf := make([]byte, versionedFooterSize)
+	if size < versionedFooterSize {
+		buf = buf[versionedFooterSize-legacyFooterSize:]
+	}
+	if _, err := r.ReadAt(buf, size-int64(len(buf))); err != nil {
+		return blockHandle{}, fmt.Errorf("failed to read footer: %w", err)
+	}
+
+	var handles []byte
+	switch binary.LittleEndian.Uint64(buf[len(buf)-8:]) {
+	case levelDBMagic:
+		handles = buf[len(buf)-legacyFooterSize:]
+	case rocksDBMagic:
+		if len(buf) < versionedFooterSize {
+			return blockHandle{}, ErrBadMagic
+		}
+		if checksum := buf[0]; checksum != rocksDBChecksumCRC32C {
+			return blockHandle{}, fmt.Errorf("%w: checksum type %d", ErrUnsupported, checksum)
+		}
+		if version := binary.LittleEndian.Uint32(buf[len(buf)-12:]); version > maxRocksDBVersion {
+			return blockHandle{}, fmt.Errorf("%w: format_version %d", ErrUnsupported, version)
+		}
+		handles = buf[1:]
+	default:
+		return blockHandle{}, ErrBadMagic
+	}
+
+	// The metaindex handle comes first; only filters and properties live
+	// behind it, so it is skipped
+	_, n, err := decodeBlockHandle(handles[:maxHandlesSize])
+	if err != nil {
+		return blockHandle{}, err
+	}
+	index, _, err := decodeBlockHandle(handles[n:maxHandlesSize])
+	return index, err
+}
+
+// readBlock reads, verifies, and decompresses the block at h.
+func readBlock(r io.ReaderAt, h blockHandle) ([]byte, error) {
+	buf := make([]byte, h.size+blockTrailerSize)
+	if _, err := r.ReadAt(buf, int64(h.offset)); err != nil {
+		return nil, fmt.Errorf("failed to read block at %d: %w", h.offset, err)
+	}
+
+	data, trailer := buf[:h.size], buf[h.size:]
+	crc := common.NewChecksum()
+	crc.Write(buf[:h.size+1])
+	if unmaskCRC(binary.LittleEndian.Uint32(trailer[1:])) != crc.Sum32() {
+		return nil, fmt.Errorf("%w at offset %d", ErrChecksum, h.offset)
+	}
+
+	switch trailer[0] {
+	case noCompression:
+		return data, nil
+	case snappyCompression:
+		decoded, err := compression.Snappy.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("%w: compression type %d", ErrUnsupported, trailer[0])
+	}
+}
+
+// maskCRC rotates a checksum before it is stored, as LevelDB does, so that
+// checksumming data with embedded checksums stays well-behaved.
+func maskCRC(crc uint32) uint32 {
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// unmaskCRC reverses maskCRC.
+func unmaskCRC(masked uint32) uint32 {
+	rot := masked - 0xa282ead8
+	return rot>>17 | rot<<15
+}
+
+// blockIterator walks the entries of a block in order. Keys are
+// prefix-compressed against the previous key; restart points, which only
+// matter for seeking, are skipped over.
+type blockIterator struct {
+	data []byte // entries, without the restart array
+	pos  int
+	key  []byte
+}
+
+func newBlockIterator(block []byte) (*blockIterator, error) {
+	if len(block) < 4 {
+		return nil, fmt.Errorf("%w: block too short", ErrCorruptBlock)
+	}
+	restarts := int(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	end := len(block) - 4 - 4*restarts
+	if restarts < 0 || end < 0 {
+		return nil, fmt.Errorf("%w: bad restart count %d", ErrCorruptBlock, restarts)
+	}
+	return &blockIterator{data: block[:end]}, nil
+}
+
+// next returns the next key and value, or a nil key at the end of the block.
+// The key is only valid until the following call.
+func (it *blockIterator) next() ([]byte, []byte, error) {
+	if it.pos >= len(it.data) {
+		return nil, nil, nil
+	}
+
+	var header [3]uint64
+	for i := range header {
+		v, n := binary.Uvarint(it.data[it.pos:])
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("%w: bad entry header at %d", ErrCorruptBlock, it.pos)
+		}
+		header[i] = v
+		it.pos += n
+	}
+	shared, unshared, valueLen := header[0], header[1], header[2]
+	if shared > uint64(len(it.key)) || uint64(len(it.data)-it.pos) < unshared+valueLen {
+		return nil, nil, fmt.Errorf("%w: entry overruns block at %d", ErrCorruptBlock, it.pos)
+	}
+
+	it.key = append(it.key[:shared], it.data[it.pos:it.pos+int(unshared)]...)
+	it.pos += int(unshared)
+	value := it.data[it.pos : it.pos+int(valueLen)]
+	it.pos += int(valueLen)
+	return it.key, value, nil
+}
+
+// parseInternalKey splits an internal key into the user key, sequence
+// number, and value type packed into its 8-byte trailer.
+func parseInternalKey(key []byte) ([]byte, uint64, uint8, error) {
+	if len(key) < 8 {
+		return nil, 0, 0, fmt.Errorf("%w: internal key too short", ErrCorruptBlock)
+	}
+	trailer := binary.LittleEndian.Uint64(key[len(key)-8:])
+	return key[:len(key)-8], trailer >> 8, uint8(trailer), nil
+}
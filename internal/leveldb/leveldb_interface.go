@@ -0,0 +1,38 @@
+package leveldb
+
+import (
+	"errors"
+
+	"amethyst/internal/common"
+)
+
+var (
+	ErrBadMagic       = errors.New("not a LevelDB or RocksDB table")
+	ErrUnsupported    = errors.New("unsupported table feature")
+	ErrCorruptBlock   = errors.New("corrupt block")
+	ErrChecksum       = errors.New("block checksum mismatch")
+	ErrSeqOutOfRange  = errors.New("sequence number does not fit in 32 bits")
+	ErrUnknownKeyType = errors.New("unknown internal key type")
+)
+
+// Table reads a LevelDB-format table file: the format written by LevelDB
+// and by RocksDB's block-based tables up to format_version 2.
+type Table interface {
+	// Iterator returns the table's entries in key order, converted to
+	// amethyst entries. Internal keys carry their sequence number, so a table
+	// may hold several versions of a key; only the newest is returned.
+	Iterator() common.EntryIterator
+
+	// Close releases the underlying file.
+	Close() error
+}
+
+// TableWriter writes a LevelDB-format table that LevelDB and RocksDB can
+// open: snappy-compressed blocks where that pays off, CRC32C checksums, and
+// the legacy footer. Entries must arrive in strictly increasing key order
+// and be puts or deletes. Close must be called to finish the table; it does
+// not close the underlying io.Writer.
+type TableWriter interface {
+	Write(entry *common.Entry) error
+	Close() error
+}
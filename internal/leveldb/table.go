@@ -0,0 +1,158 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+)
+
+type tableImpl struct {
+	file  *os.File
+	path  string
+	index []byte // decoded index block
+}
+
+var _ Table = (*tableImpl)(nil)
+
+// OpenTable opens a LevelDB-format table and loads its index block.
+func OpenTable(path string) (Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	handle, err := readFooter(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read footer of %s: %w", path, err)
+	}
+	index, err := readBlock(f, handle)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read index of %s: %w", path, err)
+	}
+
+	return &tableImpl{file: f, path: path, index: index}, nil
+}
+
+func (t *tableImpl) Iterator() common.EntryIterator {
+	return &tableIterator{table: t}
+}
+
+func (t *tableImpl) Close() error {
+	return t.file.Close()
+}
+
+// tableIterator walks the index block, loading each data block in turn.
+type tableIterator struct {
+	table   *tableImpl
+	index   *blockIterator
+	block   *blockIterator
+	lastKey []byte
+	err     error
+}
+
+func (it *tableIterator) Next() (*common.Entry, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	entry, err := it.next()
+	if err != nil {
+		it.err = fmt.Errorf("%s: %w", it.table.path, err)
+		return nil, it.err
+	}
+	return entry, nil
+}
+
+func (it *tableIterator) next() (*common.Entry, error) {
+	if it.index == nil {
+		index, err := newBlockIterator(it.table.index)
+		if err != nil {
+			return nil, err
+		}
+		it.index = index
+	}
+
+	for {
+		if it.block == nil {
+			_, value, err := it.index.next()
+			if err != nil || value == nil {
+				return nil, err
+			}
+			handle, _, err := decodeBlockHandle(value)
+			if err != nil {
+				return nil, err
+			}
+			data, err := readBlock(it.table.file, handle)
+			if err != nil {
+				return nil, err
+			}
+			if it.block, err = newBlockIterator(data); err != nil {
+				return nil, err
+			}
+		}
+
+		key, value, err := it.block.next()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			it.block = nil
+			continue
+		}
+
+		userKey, seq, kind, err := parseInternalKey(key)
+		if err != nil {
+			return nil, err
+		}
+		// Versions of a key are ordered newest first; skip the older ones
+		if it.lastKey != nil && bytes.Equal(userKey, it.lastKey) {
+			continue
+		}
+		it.lastKey = append(it.lastKey[:0], userKey...)
+
+		if seq > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: %d", ErrSeqOutOfRange, seq)
+		}
+		entry := &common.Entry{Seq: uint64(seq), Key: bytes.Clone(userKey)}
+		switch kind {
+		case typeValue:
+			entry.Type = common.EntryTypePut
+			entry.Value = bytes.Clone(value)
+		case typeDeletion:
+			entry.Type = common.EntryTypeDelete
+		default:
+			return nil, fmt.Errorf("%w: %d", ErrUnknownKeyType, kind)
+		}
+		return entry, nil
+	}
+}
+
+// Transcode rewrites t as an amethyst SSTable on w, keeping each key's
+// newest version along with its sequence number.
+func Transcode(t Table, w io.Writer, fpr float64) (*sstable.WriteResult, error) {
+	// A first pass sizes the bloom filter
+	var count uint32
+	iter := t.Iterator()
+	for {
+		entry, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		count++
+	}
+	return sstable.WriteSSTable(w, t.Iterator(), count, fpr, nil, nil, nil)
+}
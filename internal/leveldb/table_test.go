@@ -0,0 +1,208 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func internalKey(user string, seq uint64, kind uint8) []byte {
+	key := []byte(user)
+	return binary.LittleEndian.AppendUint64(key, seq<<8|uint64(kind))
+}
+
+// encodeBlock prefix-compresses each key against the previous one and
+// appends a single restart point.
+func encodeBlock(kvs ...[]byte) []byte {
+	var buf, prev []byte
+	for i := 0; i < len(kvs); i += 2 {
+		key, value := kvs[i], kvs[i+1]
+		shared := 0
+		for shared < len(key) && shared < len(prev) && key[shared] == prev[shared] {
+			shared++
+		}
+		buf = binary.AppendUvarint(buf, uint64(shared))
+		buf = binary.AppendUvarint(buf, uint64(len(key)-shared))
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, key[shared:]...)
+		buf = append(buf, value...)
+		prev = key
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	return binary.LittleEndian.AppendUint32(buf, 1)
+}
+
+// snappyLiterals encodes data as snappy literal runs without any copies.
+func snappyLiterals(data []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), 256)
+		buf = append(buf, 60<<2, byte(n-1))
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
+
+// tableBuilder assembles a table in memory, block by block.
+type tableBuilder struct {
+	buf bytes.Buffer
+}
+
+func (b *tableBuilder) writeBlock(data []byte, compression byte) []byte {
+	if compression == snappyCompression {
+		data = snappyLiterals(data)
+	}
+	handle := binary.AppendUvarint(nil, uint64(b.buf.Len()))
+	handle = binary.AppendUvarint(handle, uint64(len(data)))
+
+	crc := common.NewChecksum()
+	crc.Write(data)
+	crc.Write([]byte{compression})
+	sum := crc.Sum32()
+	masked := (sum>>15 | sum<<17) + 0xa282ead8
+
+	b.buf.Write(data)
+	b.buf.WriteByte(compression)
+	b.buf.Write(binary.LittleEndian.AppendUint32(nil, masked))
+	return handle
+}
+
+// buildTable writes a two-block table. rocksDBVersion < 0 selects the
+// legacy LevelDB footer.
+func buildTable(t *testing.T, rocksDBVersion int) []byte {
+	t.Helper()
+	var b tableBuilder
+
+	first := b.writeBlock(encodeBlock(
+		internalKey("apple", 5, typeValue), []byte("new"),
+		internalKey("apple", 3, typeValue), []byte("old"),
+		internalKey("apricot", 4, typeDeletion), nil,
+	), noCompression)
+	second := b.writeBlock(encodeBlock(
+		internalKey("cherry", 6, typeValue), bytes.Repeat([]byte("r"), 300),
+	), snappyCompression)
+	meta := b.writeBlock(encodeBlock(), noCompression)
+	index := b.writeBlock(encodeBlock(
+		internalKey("apricot", 4, typeDeletion), first,
+		internalKey("cherry", 6, typeValue), second,
+	), noCompression)
+
+	handles := make([]byte, maxHandlesSize)
+	copy(handles, append(meta, index...))
+	if rocksDBVersion < 0 {
+		b.buf.Write(handles)
+		b.buf.Write(binary.LittleEndian.AppendUint64(nil, levelDBMagic))
+	} else {
+		b.buf.WriteByte(rocksDBChecksumCRC32C)
+		b.buf.Write(handles)
+		b.buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(rocksDBVersion)))
+		b.buf.Write(binary.LittleEndian.AppendUint64(nil, rocksDBMagic))
+	}
+	return b.buf.Bytes()
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "000005.ldb")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func readAll(t *testing.T, table Table) ([]*common.Entry, error) {
+	t.Helper()
+	var entries []*common.Entry
+	iter := table.Iterator()
+	for {
+		entry, err := iter.Next()
+		if err != nil || entry == nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	expected := []*common.Entry{
+		{Type: common.EntryTypePut, Seq: 5, Key: []byte("apple"), Value: []byte("new")},
+		{Type: common.EntryTypeDelete, Seq: 4, Key: []byte("apricot")},
+		{Type: common.EntryTypePut, Seq: 6, Key: []byte("cherry"), Value: bytes.Repeat([]byte("r"), 300)},
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		corrupt bool
+		openErr error
+		readErr error
+	}{
+		{"LevelDB", -1, false, nil, nil},
+		{"RocksDBVersion2", 2, false, nil, nil},
+		{"RocksDBVersion5", 5, false, ErrUnsupported, nil},
+		{"CorruptBlock", -1, true, nil, ErrChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildTable(t, tt.version)
+			if tt.corrupt {
+				data[10] ^= 0xff
+			}
+
+			table, err := OpenTable(writeFile(t, data))
+			if tt.openErr != nil {
+				require.ErrorIs(t, err, tt.openErr)
+				return
+			}
+			require.NoError(t, err)
+			defer table.Close()
+
+			entries, err := readAll(t, table)
+			if tt.readErr != nil {
+				require.ErrorIs(t, err, tt.readErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, entries)
+		})
+	}
+}
+
+func TestOpenTableBadMagic(t *testing.T) {
+	_, err := OpenTable(writeFile(t, make([]byte, 64)))
+	require.ErrorIs(t, err, ErrBadMagic)
+}
+
+func TestTranscode(t *testing.T) {
+	table, err := OpenTable(writeFile(t, buildTable(t, -1)))
+	require.NoError(t, err)
+	defer table.Close()
+
+	path := filepath.Join(t.TempDir(), "0.sst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	result, err := Transcode(table, f, 0.01)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, uint32(3), result.EntryCount)
+
+	converted, err := sstable.OpenSSTable(vfs.Default, path, 0, nil)
+	require.NoError(t, err)
+	defer converted.Close()
+
+	entry, err := converted.Get([]byte("apple"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), entry.Value)
+	require.Equal(t, uint64(5), entry.Seq)
+
+	entry, err = converted.Get([]byte("apricot"))
+	require.NoError(t, err)
+	require.Equal(t, common.EntryTypeDelete, entry.Type)
+}
@@ -0,0 +1,182 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"amethyst/internal/common"
+	"amethyst/internal/compression"
+)
+
+const (
+	// targetBlockSize is the uncompressed size at which a data block is
+	// cut, as in LevelDB's default options.
+	targetBlockSize = 4096
+	// restartInterval is how many keys share a restart point in data blocks.
+	restartInterval = 16
+)
+
+// blockBuilder prefix-compresses entries into a block, starting a restart
+// point, which stores its key in full, every interval entries.
+type blockBuilder struct {
+	interval int
+	buf      []byte
+	restarts []uint32
+	count    int
+	lastKey  []byte
+}
+
+func (b *blockBuilder) add(key, value []byte) {
+	shared := 0
+	if b.count%b.interval == 0 {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+	} else {
+		for shared < len(key) && shared < len(b.lastKey) && key[shared] == b.lastKey[shared] {
+			shared++
+		}
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(value)))
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+	b.lastKey = append(b.lastKey[:0], key...)
+	b.count++
+}
+
+// finish appends the restart array and returns the block, then resets b.
+// An empty block still holds one restart point, as LevelDB writes it.
+func (b *blockBuilder) finish() []byte {
+	if len(b.restarts) == 0 {
+		b.restarts = append(b.restarts, 0)
+	}
+	block := b.buf
+	for _, r := range b.restarts {
+		block = binary.LittleEndian.AppendUint32(block, r)
+	}
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(b.restarts)))
+
+	b.buf, b.restarts, b.count = nil, b.restarts[:0], 0
+	return block
+}
+
+type tableWriter struct {
+	w       io.Writer
+	offset  uint64
+	data    blockBuilder
+	index   blockBuilder
+	lastKey []byte
+	started bool
+	closed  bool
+}
+
+var _ TableWriter = (*tableWriter)(nil)
+
+// NewTableWriter returns a TableWriter producing a LevelDB-format table on w.
+func NewTableWriter(w io.Writer) TableWriter {
+	return &tableWriter{
+		w:     w,
+		data:  blockBuilder{interval: restartInterval},
+		index: blockBuilder{interval: 1},
+	}
+}
+
+func (t *tableWriter) Write(entry *common.Entry) error {
+	var kind uint8
+	switch entry.Type {
+	case common.EntryTypePut:
+		kind = typeValue
+	case common.EntryTypeDelete:
+		kind = typeDeletion
+	default:
+		return fmt.Errorf("%w: entry type %d for %q", ErrUnsupported, entry.Type, entry.Key)
+	}
+	if t.started && bytes.Compare(entry.Key, t.lastKey) <= 0 {
+		return fmt.Errorf("key %q does not follow %q", entry.Key, t.lastKey)
+	}
+	t.started = true
+	t.lastKey = append(t.lastKey[:0], entry.Key...)
+
+	key := binary.LittleEndian.AppendUint64(bytes.Clone(entry.Key), uint64(entry.Seq)<<8|uint64(kind))
+	var value []byte
+	if kind == typeValue {
+		value = entry.Value
+	}
+	t.data.add(key, value)
+
+	if len(t.data.buf) >= targetBlockSize {
+		return t.flushData()
+	}
+	return nil
+}
+
+// flushData writes the pending data block and indexes it under its last
+// key, which sorts at or after every key in it and before the next block's.
+func (t *tableWriter) flushData() error {
+	lastKey := bytes.Clone(t.data.lastKey)
+	handle, err := t.writeBlock(t.data.finish(), true)
+	if err != nil {
+		return err
+	}
+	t.index.add(lastKey, handle)
+	return nil
+}
+
+func (t *tableWriter) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	if t.data.count > 0 {
+		if err := t.flushData(); err != nil {
+			return err
+		}
+	}
+	// No filters or properties, so the metaindex block is empty
+	metaindex, err := t.writeBlock((&blockBuilder{interval: 1}).finish(), false)
+	if err != nil {
+		return err
+	}
+	index, err := t.writeBlock(t.index.finish(), false)
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 0, legacyFooterSize)
+	footer = append(footer, metaindex...)
+	footer = append(footer, index...)
+	footer = footer[:maxHandlesSize]
+	footer = binary.LittleEndian.AppendUint64(footer, levelDBMagic)
+	_, err = t.w.Write(footer)
+	return err
+}
+
+// writeBlock writes block with its trailer, snappy-compressed if compress is
+// set and that saves at least an eighth, and returns its encoded handle.
+func (t *tableWriter) writeBlock(block []byte, compress bool) ([]byte, error) {
+	kind := byte(noCompression)
+	if compress {
+		if compressed, err := compression.Snappy.Encode(block); err == nil && len(compressed) < len(block)-len(block)/8 {
+			block, kind = compressed, snappyCompression
+		}
+	}
+
+	crc := common.NewChecksum()
+	crc.Write(block)
+	crc.Write([]byte{kind})
+	trailer := append([]byte{kind}, binary.LittleEndian.AppendUint32(nil, maskCRC(crc.Sum32()))...)
+
+	handle := binary.AppendUvarint(nil, t.offset)
+	handle = binary.AppendUvarint(handle, uint64(len(block)))
+	for _, part := range [][]byte{block, trailer} {
+		n, err := t.w.Write(part)
+		t.offset += uint64(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return handle, nil
+}
@@ -0,0 +1,74 @@
+package leveldb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableWriterRoundTrip(t *testing.T) {
+	var many []*common.Entry
+	for i := 0; i < 2000; i++ {
+		entry := &common.Entry{Type: common.EntryTypePut, Seq: uint64(i + 1), Key: []byte(fmt.Sprintf("key%05d", i)), Value: bytes.Repeat([]byte{byte(i)}, 50)}
+		if i%7 == 0 {
+			entry.Type, entry.Value = common.EntryTypeDelete, nil
+		}
+		many = append(many, entry)
+	}
+
+	tests := []struct {
+		name    string
+		entries []*common.Entry
+	}{
+		{"empty", nil},
+		{"single", []*common.Entry{{Type: common.EntryTypePut, Seq: 9, Key: []byte("k"), Value: []byte("v")}}},
+		{"many blocks", many},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewTableWriter(&buf)
+			for _, entry := range tt.entries {
+				require.NoError(t, w.Write(entry))
+			}
+			require.NoError(t, w.Close())
+
+			table, err := OpenTable(writeFile(t, buf.Bytes()))
+			require.NoError(t, err)
+			defer table.Close()
+			entries, err := readAll(t, table)
+			require.NoError(t, err)
+			require.Equal(t, tt.entries, entries)
+		})
+	}
+}
+
+func TestTableWriterRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []*common.Entry
+	}{
+		{"unsorted", []*common.Entry{
+			{Type: common.EntryTypePut, Key: []byte("b"), Value: []byte("v")},
+			{Type: common.EntryTypePut, Key: []byte("a"), Value: []byte("v")},
+		}},
+		{"blob reference", []*common.Entry{
+			{Type: common.EntryTypeBlobRef, Key: []byte("a"), Value: []byte("ref")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewTableWriter(&bytes.Buffer{})
+			var err error
+			for _, entry := range tt.entries {
+				if err = w.Write(entry); err != nil {
+					break
+				}
+			}
+			require.Error(t, err)
+		})
+	}
+}
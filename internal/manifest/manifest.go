@@ -1,15 +1,19 @@
 package manifest
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"slices"
 	"sync"
 
 	"amethyst/internal/block_cache"
 	"amethyst/internal/common"
 	"amethyst/internal/sstable"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/vfs"
 )
 
 // FileMetadata tracks metadata for a single SSTable file.
@@ -17,14 +21,52 @@ type FileMetadata struct {
 	FileNo      common.FileNo
 	SmallestKey []byte
 	LargestKey  []byte
+	Size        uint64 // file size in bytes
+	Checksum    uint32 // CRC32C of the whole file; 0 if not recorded
+
+	// PrefixExtractor names the extractor whose prefixes are in the table's
+	// bloom filter; empty if none are.
+	PrefixExtractor string `json:",omitempty"`
+
+	// Entries and Tombstones count the table's entries and the deletes among
+	// them; both are 0 for tables written before they were recorded.
+	Entries    uint32 `json:",omitempty"`
+	Tombstones uint32 `json:",omitempty"`
+
+	// RangeDels counts the table's range tombstones, which the key range
+	// spans as well.
+	RangeDels uint32 `json:",omitempty"`
+
+	// MaxSeq is the highest sequence number in the table; 0 for tables
+	// written before it was recorded.
+	MaxSeq uint64 `json:",omitempty"`
+
+	// BlobFiles lists the blob files the table's blob references point into.
+	BlobFiles []common.FileNo `json:",omitempty"`
+
+	// KeySizes and ValueSizes are the table's key and value length
+	// distributions, recorded as it was written.
+	KeySizes   sstable.SizeHistogram `json:",omitempty"`
+	ValueSizes sstable.SizeHistogram `json:",omitempty"`
+}
+
+// TombstoneRatio returns the share of the table's entries that are deletes.
+func (fm *FileMetadata) TombstoneRatio() float64 {
+	if fm.Entries == 0 {
+		return 0
+	}
+	return float64(fm.Tombstones) / float64(fm.Entries)
 }
 
 // Version represents an immutable snapshot of the LSM tree structure.
 type Version struct {
-	// Current WAL being written
+	// Oldest WAL holding writes not yet flushed to a table. Recovery
+	// replays it and every later WAL below NextWALNumber.
 	CurrentWAL common.FileNo
 
-	// Levels[0] = L0 tables, Levels[1] = L1 tables, etc.
+	// Levels[0] = L0 tables, Levels[1] = L1 tables, etc. L0 tables are in
+	// the order they were flushed; the non-overlapping tables of L1+ are
+	// sorted by smallest key.
 	Levels [][]FileMetadata
 
 	// Next file number to allocate for new WAL
@@ -32,48 +74,133 @@ type Version struct {
 
 	// Next file number to allocate for new SSTable
 	NextSSTableNumber common.FileNo
+
+	// BlobFiles lists the live blob files, oldest first. They share the
+	// SSTable number space.
+	BlobFiles []common.FileNo `json:",omitempty"`
+
+	// LastSeq is the highest sequence number committed when the version was
+	// flushed, so recovery never reissues one even after every write that
+	// held it was compacted away and its WAL deleted.
+	LastSeq uint64 `json:",omitempty"`
+}
+
+// FileFor returns the only table of level (>= 1) whose key range may
+// contain key, found by binary search.
+func (v *Version) FileFor(level int, key []byte) (FileMetadata, bool) {
+	files := v.Levels[level]
+	i, _ := slices.BinarySearchFunc(files, key, func(fm FileMetadata, key []byte) int {
+		return bytes.Compare(fm.LargestKey, key)
+	})
+	if i == len(files) || bytes.Compare(files[i].SmallestKey, key) > 0 {
+		return FileMetadata{}, false
+	}
+	return files[i], true
+}
+
+// sortLevels puts L0 in MaxSeq order, oldest first, which is the order
+// flushes add tables in but not necessarily ingested ones, and the tables of
+// each of L1+ in smallest key order.
+func (v *Version) sortLevels() {
+	if len(v.Levels) > 0 {
+		slices.SortStableFunc(v.Levels[0], func(a, b FileMetadata) int {
+			return cmp.Compare(a.MaxSeq, b.MaxSeq)
+		})
+	}
+	for _, files := range v.Levels[min(1, len(v.Levels)):] {
+		slices.SortFunc(files, func(a, b FileMetadata) int {
+			return bytes.Compare(a.SmallestKey, b.SmallestKey)
+		})
+	}
+}
+
+// LiveWALs returns the WALs recovery replays, oldest first.
+func (v *Version) LiveWALs() []common.FileNo {
+	var nums []common.FileNo
+	for num := v.CurrentWAL; num < v.NextWALNumber; num++ {
+		nums = append(nums, num)
+	}
+	return nums
+}
+
+// MaxSeq returns the highest sequence number recorded for any table, so
+// recovery never reissues one that tables already hold.
+func (v *Version) MaxSeq() uint64 {
+	var seq uint64
+	for _, files := range v.Levels {
+		for _, fm := range files {
+			seq = max(seq, fm.MaxSeq)
+		}
+	}
+	return seq
 }
 
 // Manifest tracks the structural state of the LSM tree with snapshot isolation.
-//
-// TODO: Version and SSTable lifecycle management
-// Currently, old Versions are not explicitly cleaned up and SSTable handles stay open
-// indefinitely in tableCache. This works for now but will eventually cause issues:
-//
-// 1. Memory leaks: Old Version objects accumulate (Go GC handles this, but still wasteful)
-// 2. File descriptor leaks: SSTables removed by compaction stay open forever
-// 3. Disk space leaks: Can't delete obsolete SST files while handles are open
-//
-// Solutions to implement later:
-// - Manual reference counting on Versions (like RocksDB's Version::Ref/Unref)
-// - Track which SSTables are referenced by live Versions
-// - Close and delete SSTable files when no Version references them
-// - Add DB.Close() to explicitly release all resources
+// Readers pin the versions they use with Ref/Unref, and DeleteTable holds back
+// tables a pinned version still lists.
 type Manifest struct {
 	mu sync.RWMutex
 
+	// fs holds the MANIFEST and SSTable files
+	fs vfs.FS
+
 	// Current version (latest state)
 	current *Version
 
-	// Table cache: shared pool of open SSTable handles
-	tableCache map[common.FileNo]sstable.SSTable
-
-	// Block cache: shared across all SSTables
-	blockCache block_cache.BlockCache
+	// Table cache: pool of open SSTable handles, possibly shared with other databases
+	tableCache table_cache.TableCache
 
 	// Path manager for all database files
 	paths *common.PathManager
+
+	// verifyChecksums checks each table against its recorded checksum when
+	// the table cache first opens it
+	verifyChecksums bool
+
+	// pins counts the readers holding each version. Tables deleted while a
+	// pinned version still lists them wait in obsolete, open and on disk,
+	// until the last such pin is released.
+	pins     map[*Version]int
+	obsolete []tableRef
+
+	// deletionsDisabled counts DisableFileDeletions calls not yet matched by
+	// EnableFileDeletions. While positive, every deleted table waits in
+	// obsolete.
+	deletionsDisabled int
+
+	// lastSeq is the highest sequence number committed so far, persisted
+	// as Version.LastSeq by the next Flush.
+	lastSeq uint64
+
+	// onTableDeleted, if set, is called after each table file is removed
+	onTableDeleted func(level int, fileNo common.FileNo, size int64)
+
+	logger common.Logger
+}
+
+type tableRef struct {
+	level  int
+	fileNo common.FileNo
 }
 
-// NewManifest creates a new manifest with the given number of levels.
+// NewManifest creates a new manifest on the OS filesystem with the given
+// number of levels and a private table cache.
 func NewManifest(paths *common.PathManager, numLevels int) *Manifest {
+	return NewManifestWithTableCache(vfs.Default, paths, numLevels, table_cache.NewTableCache(vfs.Default, block_cache.NewBlockCache(block_cache.DefaultCapacity), table_cache.DefaultMaxOpenFiles))
+}
+
+// NewManifestWithTableCache creates a new manifest on fsys that opens SSTables
+// through tableCache, which may be shared with other manifests.
+func NewManifestWithTableCache(fsys vfs.FS, paths *common.PathManager, numLevels int, tableCache table_cache.TableCache) *Manifest {
 	return &Manifest{
+		fs: fsys,
 		current: &Version{
 			Levels: make([][]FileMetadata, numLevels),
 		},
-		tableCache: make(map[common.FileNo]sstable.SSTable),
-		blockCache: block_cache.NewBlockCache(),
+		tableCache: tableCache,
 		paths:      paths,
+		pins:       make(map[*Version]int),
+		logger:     common.DefaultLogger,
 	}
 }
 
@@ -84,29 +211,214 @@ func (m *Manifest) Current() *Version {
 	return m.current
 }
 
+// Ref returns the current version pinned for reading. Every table it lists
+// stays readable until the matching Unref, even if compaction deletes it.
+func (m *Manifest) Ref() *Version {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pins[m.current]++
+	return m.current
+}
+
+// Unref releases a version pinned by Ref, closing and removing any deleted
+// tables that no other pinned version still lists.
+func (m *Manifest) Unref(v *Version) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pins[v]--; m.pins[v] <= 0 {
+		delete(m.pins, v)
+	}
+	m.removeObsolete()
+}
+
+// removeObsolete closes and removes the deleted tables that may go now.
+// Must be called with m.mu held.
+func (m *Manifest) removeObsolete() {
+	if m.deletionsDisabled > 0 {
+		return
+	}
+	remaining := m.obsolete[:0]
+	for _, ref := range m.obsolete {
+		if m.pinned(ref) {
+			remaining = append(remaining, ref)
+			continue
+		}
+		if err := m.removeTable(ref); err != nil {
+			m.logger.Log(common.LevelError, "failed to delete table", "level", ref.level, "file", ref.fileNo, "err", err)
+		}
+	}
+	m.obsolete = remaining
+}
+
+// DisableFileDeletions holds back the removal of deleted tables until a
+// matching EnableFileDeletions. Calls nest.
+func (m *Manifest) DisableFileDeletions() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletionsDisabled++
+}
+
+// EnableFileDeletions undoes one DisableFileDeletions. Once none remain, the
+// tables held back are removed unless a pinned version still lists them.
+// Extra calls are ignored.
+func (m *Manifest) EnableFileDeletions() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deletionsDisabled > 0 {
+		m.deletionsDisabled--
+	}
+	m.removeObsolete()
+}
+
+// FileDeletionsDisabled reports whether DisableFileDeletions is in effect.
+func (m *Manifest) FileDeletionsDisabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.deletionsDisabled > 0
+}
+
+// ObsoleteTables returns how many deleted tables are waiting for pinned
+// versions to be released.
+func (m *Manifest) ObsoleteTables() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.obsolete)
+}
+
+// removeTable closes a table's handle and removes its file.
+func (m *Manifest) removeTable(ref tableRef) error {
+	path := m.paths.SSTablePath(ref.level, ref.fileNo)
+	if err := m.tableCache.Evict(path); err != nil {
+		return err
+	}
+	if m.onTableDeleted == nil {
+		return m.fs.Remove(path)
+	}
+	var size int64
+	if info, err := m.fs.Stat(path); err == nil {
+		size = info.Size()
+	}
+	if err := m.fs.Remove(path); err != nil {
+		return err
+	}
+	m.onTableDeleted(ref.level, ref.fileNo, size)
+	return nil
+}
+
+// pinned reports whether any pinned version lists the table.
+// Must be called with m.mu held.
+func (m *Manifest) pinned(ref tableRef) bool {
+	for v := range m.pins {
+		if ref.level >= len(v.Levels) {
+			continue
+		}
+		for _, fm := range v.Levels[ref.level] {
+			if fm.FileNo == ref.fileNo {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // LoadVersion replaces the current version with the provided one (used during recovery).
 func (m *Manifest) LoadVersion(v *Version) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.current = v
+	m.lastSeq = max(m.lastSeq, v.LastSeq)
+}
+
+// SetLastSeq records seq as committed. It only ever advances, and is
+// persisted by the next Flush.
+func (m *Manifest) SetLastSeq(seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSeq = max(m.lastSeq, seq)
 }
 
-// SetWAL sets the current WAL and increments NextWALNumber.
+// LastSeq returns the highest sequence number recorded by SetLastSeq or
+// loaded from a flushed version.
+func (m *Manifest) LastSeq() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastSeq
+}
+
+// SetWAL sets the oldest live WAL, advancing NextWALNumber past it if
+// needed.
 func (m *Manifest) SetWAL(num common.FileNo) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	newVersion := m.deepCopy(m.current)
 	newVersion.CurrentWAL = num
-	newVersion.NextWALNumber = num + 1
+	newVersion.NextWALNumber = max(newVersion.NextWALNumber, num+1)
 	m.current = newVersion
 }
 
+// NewWALNumber reserves the next WAL number, making the WAL live alongside
+// the older ones until SetWAL moves past it. The reservation is persisted by
+// the next Flush.
+func (m *Manifest) NewWALNumber() common.FileNo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newVersion := m.deepCopy(m.current)
+	num := newVersion.NextWALNumber
+	newVersion.NextWALNumber++
+	m.current = newVersion
+	return num
+}
+
+// NewSSTableNumber reserves the next SSTable file number so concurrent
+// flushes and compactions never write the same file. The reservation is
+// persisted by the next Flush.
+func (m *Manifest) NewSSTableNumber() common.FileNo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newVersion := m.deepCopy(m.current)
+	fileNo := newVersion.NextSSTableNumber
+	newVersion.NextSSTableNumber++
+	m.current = newVersion
+	return fileNo
+}
+
+// SetVerifyChecksums enables checking tables against their recorded checksums
+// as they are opened.
+func (m *Manifest) SetVerifyChecksums(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verifyChecksums = enabled
+}
+
+// SetLogger sets the logger the manifest reports failures to.
+func (m *Manifest) SetLogger(l common.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = l
+}
+
+// SetTableDeletedHook sets a function called with the level, number and
+// size of each table file after it is removed, sometimes with the
+// manifest's lock held. Must be called before any table is deleted.
+func (m *Manifest) SetTableDeletedHook(fn func(level int, fileNo common.FileNo, size int64)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onTableDeleted = fn
+}
+
 // CompactionEdit describes an atomic change to the manifest.
 type CompactionEdit struct {
 	// SSTables to add/remove per level
 	AddSSTables    map[int][]FileMetadata
 	DeleteSSTables map[int]map[common.FileNo]struct{}
+
+	// Blob files to add/remove
+	AddBlobFiles    []common.FileNo
+	DeleteBlobFiles map[common.FileNo]struct{}
 }
 
 // Apply atomically applies a compaction edit, creating a new version.
@@ -141,16 +453,59 @@ func (m *Manifest) Apply(edit *CompactionEdit) {
 	if maxSSTable >= newVersion.NextSSTableNumber {
 		newVersion.NextSSTableNumber = maxSSTable + 1
 	}
+	newVersion.sortLevels()
+
+	// Apply blob file changes
+	if len(edit.DeleteBlobFiles) > 0 {
+		newVersion.BlobFiles = slices.DeleteFunc(newVersion.BlobFiles, func(fileNo common.FileNo) bool {
+			_, deleted := edit.DeleteBlobFiles[fileNo]
+			return deleted
+		})
+	}
+	newVersion.BlobFiles = append(newVersion.BlobFiles, edit.AddBlobFiles...)
 
 	m.current = newVersion
 }
 
+// UnreferencedBlobFiles returns the live blob files that no table of the
+// current version or of any pinned version points into. Their values have
+// all been rewritten or dropped, so they can be deleted.
+func (m *Manifest) UnreferencedBlobFiles() []common.FileNo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	referenced := make(map[common.FileNo]struct{})
+	mark := func(v *Version) {
+		for _, fileMetas := range v.Levels {
+			for _, fm := range fileMetas {
+				for _, fileNo := range fm.BlobFiles {
+					referenced[fileNo] = struct{}{}
+				}
+			}
+		}
+	}
+	mark(m.current)
+	for v := range m.pins {
+		mark(v)
+	}
+
+	var unreferenced []common.FileNo
+	for _, fileNo := range m.current.BlobFiles {
+		if _, ok := referenced[fileNo]; !ok {
+			unreferenced = append(unreferenced, fileNo)
+		}
+	}
+	return unreferenced
+}
+
 func (m *Manifest) deepCopy(v *Version) *Version {
 	newVersion := &Version{
 		CurrentWAL:        v.CurrentWAL,
 		Levels:            make([][]FileMetadata, len(v.Levels)),
 		NextWALNumber:     v.NextWALNumber,
 		NextSSTableNumber: v.NextSSTableNumber,
+		BlobFiles:         slices.Clone(v.BlobFiles),
+		LastSeq:           v.LastSeq,
 	}
 	for i := range v.Levels {
 		newVersion.Levels[i] = make([]FileMetadata, len(v.Levels[i]))
@@ -161,24 +516,81 @@ func (m *Manifest) deepCopy(v *Version) *Version {
 
 // GetTable returns the SSTable for the given file number, opening it if not cached.
 func (m *Manifest) GetTable(fileNo common.FileNo, level int) (sstable.SSTable, error) {
+	return m.tableCache.Get(m.paths.SSTablePath(level, fileNo), m.checksum(fileNo, level))
+}
+
+// CachedTable returns the SSTable for the given file number only if the table
+// cache already has it open.
+func (m *Manifest) CachedTable(fileNo common.FileNo, level int) (sstable.SSTable, bool) {
+	return m.tableCache.Lookup(m.paths.SSTablePath(level, fileNo))
+}
+
+// checksum returns the recorded checksum of a table when verification is
+// enabled, or 0 to skip verification.
+func (m *Manifest) checksum(fileNo common.FileNo, level int) uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.verifyChecksums || level >= len(m.current.Levels) {
+		return 0
+	}
+	for _, fm := range m.current.Levels[level] {
+		if fm.FileNo == fileNo {
+			return fm.Checksum
+		}
+	}
+	return 0
+}
+
+// DeleteTable closes an obsolete SSTable's handle and removes its file. If a
+// pinned version still lists the table, both are deferred until the last
+// such version is released; while file deletions are disabled, until they
+// are enabled again. Callers must only delete files that the
+// persisted manifest no longer references.
+func (m *Manifest) DeleteTable(fileNo common.FileNo, level int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if already open
-	if table, ok := m.tableCache[fileNo]; ok {
-		return table, nil
+	ref := tableRef{level: level, fileNo: fileNo}
+	if m.pinned(ref) || m.deletionsDisabled > 0 {
+		m.obsolete = append(m.obsolete, ref)
+		return nil
 	}
+	return m.removeTable(ref)
+}
 
-	// Open the SSTable file
-	path := m.paths.SSTablePath(level, fileNo)
-	table, err := sstable.OpenSSTable(path, fileNo, m.blockCache)
-	if err != nil {
-		return nil, err
+// Close evicts every table in the current version from the table cache and
+// removes deleted tables still held for pinned versions, or only evicts them
+// while file deletions are disabled. The table cache may be shared, so only
+// this manifest's tables are released.
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	v := m.current
+	obsolete := m.obsolete
+	keep := m.deletionsDisabled > 0
+	m.obsolete = nil
+	m.mu.Unlock()
+
+	var firstErr error
+	for level, fileMetas := range v.Levels {
+		for _, fm := range fileMetas {
+			if err := m.tableCache.Evict(m.paths.SSTablePath(level, fm.FileNo)); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
-
-	// Cache it
-	m.tableCache[fileNo] = table
-	return table, nil
+	for _, ref := range obsolete {
+		var err error
+		if keep {
+			err = m.tableCache.Evict(m.paths.SSTablePath(ref.level, ref.fileNo))
+		} else {
+			err = m.removeTable(ref)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // WriteManifest serializes a Version to JSON.
@@ -194,6 +606,8 @@ func ReadManifest(r io.Reader) (*Version, error) {
 	if err := json.NewDecoder(r).Decode(&v); err != nil {
 		return nil, err
 	}
+	// Manifests written before L1+ were kept sorted
+	v.sortLevels()
 	return &v, nil
 }
 
@@ -201,33 +615,38 @@ func ReadManifest(r io.Reader) (*Version, error) {
 func (m *Manifest) Flush() error {
 	m.mu.RLock()
 	v := m.current
+	if m.lastSeq > v.LastSeq {
+		flushed := *v
+		flushed.LastSeq = m.lastSeq
+		v = &flushed
+	}
 	m.mu.RUnlock()
 
 	// Atomic write: write to temp file, then rename
 	manifestPath := m.paths.ManifestPath()
 	tmpPath := manifestPath + ".tmp"
-	f, err := os.Create(tmpPath)
+	f, err := m.fs.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
 	}
 
 	if err := WriteManifest(f, v); err != nil {
 		f.Close()
-		os.Remove(tmpPath)
+		m.fs.Remove(tmpPath)
 		return err
 	}
 
 	if err := f.Sync(); err != nil {
 		f.Close()
-		os.Remove(tmpPath)
+		m.fs.Remove(tmpPath)
 		return err
 	}
 
 	if err := f.Close(); err != nil {
-		os.Remove(tmpPath)
+		m.fs.Remove(tmpPath)
 		return err
 	}
 
 	// Atomic rename
-	return os.Rename(tmpPath, manifestPath)
+	return m.fs.Rename(tmpPath, manifestPath)
 }
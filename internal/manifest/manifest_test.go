@@ -3,7 +3,10 @@ package manifest
 import (
 	"testing"
 
+	"amethyst/internal/block_cache"
 	"amethyst/internal/common"
+	"amethyst/internal/table_cache"
+	"amethyst/internal/vfs"
 
 	"github.com/stretchr/testify/require"
 )
@@ -207,3 +210,73 @@ func TestNextSSTableNumberPreservation(t *testing.T) {
 	require.Equal(t, 0, len(v.Levels[0]))
 	require.Equal(t, common.FileNo(201), v.NextSSTableNumber)
 }
+
+func TestFileFor(t *testing.T) {
+	paths := common.NewPathManager("test_data")
+	m := NewManifest(paths, 7)
+
+	// Added out of order, the level is kept sorted by smallest key
+	m.Apply(&CompactionEdit{
+		AddSSTables: map[int][]FileMetadata{
+			1: {
+				{FileNo: 3, SmallestKey: []byte("m"), LargestKey: []byte("p")},
+				{FileNo: 1, SmallestKey: []byte("a"), LargestKey: []byte("c")},
+				{FileNo: 2, SmallestKey: []byte("e"), LargestKey: []byte("h")},
+			},
+		},
+	})
+	v := m.Current()
+	require.Equal(t, common.FileNo(1), v.Levels[1][0].FileNo)
+	require.Equal(t, common.FileNo(2), v.Levels[1][1].FileNo)
+	require.Equal(t, common.FileNo(3), v.Levels[1][2].FileNo)
+
+	tests := []struct {
+		key    string
+		fileNo common.FileNo
+		found  bool
+	}{
+		{"a", 1, true},
+		{"b", 1, true},
+		{"c", 1, true},
+		{"d", 0, false},
+		{"h", 2, true},
+		{"n", 3, true},
+		{"0", 0, false},
+		{"z", 0, false},
+	}
+	for _, tt := range tests {
+		fm, ok := v.FileFor(1, []byte(tt.key))
+		require.Equal(t, tt.found, ok, tt.key)
+		require.Equal(t, tt.fileNo, fm.FileNo, tt.key)
+	}
+
+	_, ok := v.FileFor(2, []byte("a"))
+	require.False(t, ok)
+}
+
+func TestLastSeqPersisted(t *testing.T) {
+	fsys := vfs.NewMemFS()
+	paths := common.NewPathManager("db")
+	require.NoError(t, fsys.MkdirAll("db", 0755))
+	newManifest := func() *Manifest {
+		return NewManifestWithTableCache(fsys, paths, 7, table_cache.NewTableCache(fsys, block_cache.NewBlockCache(block_cache.DefaultCapacity), table_cache.DefaultMaxOpenFiles))
+	}
+
+	m := newManifest()
+	m.SetLastSeq(42)
+	m.SetLastSeq(7) // never moves backwards
+	require.Equal(t, uint64(42), m.LastSeq())
+	require.Zero(t, m.Current().LastSeq, "flushed versions carry it, not the current one")
+	require.NoError(t, m.Flush())
+
+	f, err := fsys.Open(paths.ManifestPath())
+	require.NoError(t, err)
+	v, err := ReadManifest(f)
+	f.Close()
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), v.LastSeq)
+
+	reopened := newManifest()
+	reopened.LoadVersion(v)
+	require.Equal(t, uint64(42), reopened.LastSeq())
+}
@@ -0,0 +1,64 @@
+package memtable
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// bloomSeed hashes the keys of every memtable bloom filter. Memtable filters
+// are never stored, so any seed will do.
+var bloomSeed = maphash.MakeSeed()
+
+// bloom is a bloom filter that keys may be added to concurrently with
+// lookups. Its bits are set with atomic ORs, so a lookup sees every key
+// whose Add returned before it started.
+type bloom struct {
+	words  []atomic.Uint64
+	mask   uint64 // bits - 1; the number of bits is a power of two
+	hashes int
+}
+
+// newBloom returns a filter sized for about n keys at bitsPerKey bits each.
+func newBloom(n int, bitsPerKey float64) *bloom {
+	bits := uint64(64)
+	for float64(bits) < float64(n)*bitsPerKey {
+		bits <<= 1
+	}
+	// k = ln(2) * bits/key minimizes the false positive rate
+	hashes := int(math.Round(bitsPerKey * math.Ln2))
+	return &bloom{
+		words:  make([]atomic.Uint64, bits/64),
+		mask:   bits - 1,
+		hashes: min(max(hashes, 1), 30),
+	}
+}
+
+// Add records key in the filter.
+func (b *bloom) Add(key []byte) {
+	h1, h2 := bloomHashes(key)
+	for i := range b.hashes {
+		bit := (h1 + uint64(i)*h2) & b.mask
+		b.words[bit/64].Or(1 << (bit % 64))
+	}
+}
+
+// MayContain returns false if key was definitely never added.
+func (b *bloom) MayContain(key []byte) bool {
+	h1, h2 := bloomHashes(key)
+	for i := range b.hashes {
+		bit := (h1 + uint64(i)*h2) & b.mask
+		if b.words[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the two hashes that double hashing combines into a
+// key's probe positions. The second is odd, so probes cycle through every
+// bit of a power-of-two filter.
+func bloomHashes(key []byte) (uint64, uint64) {
+	h := maphash.Bytes(bloomSeed, key)
+	return h, (h>>32 | h<<32) | 1
+}
@@ -0,0 +1,67 @@
+package memtable
+
+import (
+	"fmt"
+	"testing"
+
+	"amethyst/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	tests := []struct {
+		bitsPerKey float64
+		maxRate    float64
+	}{
+		{4, 0.2},
+		{10, 0.02},
+		{16, 0.002},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("bits=%v", tt.bitsPerKey), func(t *testing.T) {
+			const n = 10000
+			b := newBloom(n, tt.bitsPerKey)
+			for i := range n {
+				b.Add([]byte(fmt.Sprintf("key%d", i)))
+			}
+			for i := range n {
+				require.True(t, b.MayContain([]byte(fmt.Sprintf("key%d", i))), "no false negatives")
+			}
+
+			falsePositives := 0
+			for i := range n {
+				if b.MayContain([]byte(fmt.Sprintf("other%d", i))) {
+					falsePositives++
+				}
+			}
+			require.Less(t, float64(falsePositives)/n, tt.maxRate)
+		})
+	}
+}
+
+func TestSkiplistBloomSkipsAbsentKeys(t *testing.T) {
+	mt := NewSkiplistMemtableWithBloom(100, 10).(*skiplistMemtableImpl)
+	for i := range 100 {
+		mt.Put([]byte(fmt.Sprintf("key%d", i)), []byte("v"))
+	}
+	mt.Apply(&common.Entry{Type: common.EntryTypePut, Seq: 500, Key: []byte("applied"), Value: []byte("v")})
+
+	for i := range 100 {
+		_, ok := mt.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.True(t, ok)
+	}
+	_, ok := mt.Get([]byte("applied"))
+	require.True(t, ok, "applied keys are added to the filter")
+
+	rejected := 0
+	for i := range 1000 {
+		if !mt.bloom.MayContain([]byte(fmt.Sprintf("missing%d", i))) {
+			rejected++
+		}
+		_, ok := mt.Get([]byte(fmt.Sprintf("missing%d", i)))
+		require.False(t, ok)
+	}
+	require.Greater(t, rejected, 950)
+
+	require.Nil(t, NewSkiplistMemtableWithBloom(100, 0).(*skiplistMemtableImpl).bloom)
+}
@@ -1,6 +1,7 @@
 package memtable
 
 import (
+	"bytes"
 	"sort"
 
 	"amethyst/internal/common"
@@ -8,8 +9,10 @@ import (
 
 // mapMemtableImpl is the baseline Go map-backed implementation.
 type mapMemtableImpl struct {
-	items map[string]*common.Entry
-	next  uint32
+	items     map[string]*common.Entry
+	rangeDels common.RangeTombstones
+	next      uint64
+	size      int
 }
 
 var _ Memtable = (*mapMemtableImpl)(nil)
@@ -24,20 +27,71 @@ func NewMapMemtable() Memtable {
 // Put records or overwrites a key/value pair using the provided key and value.
 func (m *mapMemtableImpl) Put(key, value []byte) {
 	m.next++
-	m.items[string(key)] = &common.Entry{
+	m.set(string(key), &common.Entry{
 		Type:  common.EntryTypePut,
 		Seq:   m.next,
 		Value: value,
-	}
+	})
 }
 
 // Delete installs a tombstone for the given key.
 func (m *mapMemtableImpl) Delete(key []byte) {
 	m.next++
-	m.items[string(key)] = &common.Entry{
+	m.set(string(key), &common.Entry{
 		Type: common.EntryTypeDelete,
 		Seq:  m.next,
+	})
+}
+
+// DeleteRange installs a range tombstone for the keys in [start, end).
+func (m *mapMemtableImpl) DeleteRange(start, end []byte) {
+	m.next++
+	m.addRangeDel(&common.Entry{
+		Type:  common.EntryTypeRangeDelete,
+		Seq:   m.next,
+		Key:   start,
+		Value: end,
+	})
+}
+
+// Apply records a committed entry, preserving the sequence number assigned by
+// the DB so that flushed SSTables carry globally ordered seqs.
+func (m *mapMemtableImpl) Apply(entry *common.Entry) {
+	if entry.Seq > m.next {
+		m.next = entry.Seq
+	}
+	if entry.Type == common.EntryTypeRangeDelete {
+		m.addRangeDel(&common.Entry{
+			Type:      entry.Type,
+			Seq:       entry.Seq,
+			Timestamp: entry.Timestamp,
+			Key:       entry.Key,
+			Value:     entry.Value,
+		})
+		return
 	}
+	m.set(string(entry.Key), &common.Entry{
+		Type:      entry.Type,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Value:     entry.Value,
+	})
+}
+
+// set stores entry under key, keeping the size estimate current.
+func (m *mapMemtableImpl) set(key string, entry *common.Entry) {
+	if old, ok := m.items[key]; ok {
+		m.size -= len(key) + len(old.Value)
+	}
+	m.items[key] = entry
+	m.size += len(key) + len(entry.Value)
+}
+
+// addRangeDel stores a range tombstone, keeping the size estimate current.
+func (m *mapMemtableImpl) addRangeDel(entry *common.Entry) {
+	m.rangeDels = append(m.rangeDels, entry)
+	m.size += len(entry.Key) + len(entry.Value)
 }
 
 // Get returns the most recent entry for key, if any.
@@ -48,10 +102,12 @@ func (m *mapMemtableImpl) Get(key []byte) (*common.Entry, bool) {
 	}
 	// Clone the entry with the key included
 	return &common.Entry{
-		Type:  entry.Type,
-		Seq:   entry.Seq,
-		Key:   key,
-		Value: entry.Value,
+		Type:      entry.Type,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Key:       key,
+		Value:     entry.Value,
 	}, true
 }
 
@@ -71,9 +127,19 @@ func (m *mapMemtableImpl) Iterator() common.EntryIterator {
 	return &memtableIterator{entries: entries}
 }
 
-// Len returns the number of entries in the memtable.
+// RangeTombstones returns the range tombstones in the order they were added.
+func (m *mapMemtableImpl) RangeTombstones() common.RangeTombstones {
+	return m.rangeDels[:len(m.rangeDels):len(m.rangeDels)]
+}
+
+// Len returns the number of entries and range tombstones in the memtable.
 func (m *mapMemtableImpl) Len() int {
-	return len(m.items)
+	return len(m.items) + len(m.rangeDels)
+}
+
+// Size returns the combined length of every key and value held.
+func (m *mapMemtableImpl) Size() int {
+	return m.size
 }
 
 type memtableIterator struct {
@@ -90,14 +156,25 @@ func (it *memtableIterator) Next() (*common.Entry, error) {
 	return entry, nil
 }
 
+// Seek skips to the first remaining entry whose key is at least key.
+func (it *memtableIterator) Seek(key []byte) error {
+	rest := it.entries[it.index:]
+	it.index += sort.Search(len(rest), func(i int) bool {
+		return bytes.Compare(rest[i].Key, key) >= 0
+	})
+	return nil
+}
+
 func cloneIteratorEntry(src *common.Entry, key string) *common.Entry {
 	if src == nil {
 		return nil
 	}
 	return &common.Entry{
-		Type:  src.Type,
-		Seq:   src.Seq,
-		Key:   []byte(key),
-		Value: src.Value,
+		Type:      src.Type,
+		Seq:       src.Seq,
+		Timestamp: src.Timestamp,
+		ExpiresAt: src.ExpiresAt,
+		Key:       []byte(key),
+		Value:     src.Value,
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"amethyst/internal/common"
+	"amethyst/internal/iterator"
 	"amethyst/internal/memtable"
 	"github.com/stretchr/testify/require"
 )
@@ -63,7 +64,7 @@ func TestBulkPutGetDelete(t *testing.T) {
 
 	const n = 32
 	expected := make(map[string]*common.Entry, 3*n)
-	var nextSeq uint32
+	var nextSeq uint64
 
 	// Write first n keys that will remain as puts.
 	for i := 0; i < n; i++ {
@@ -179,3 +180,110 @@ func TestBulkPutGetDelete(t *testing.T) {
 	}
 	require.Equal(t, 3*n, count)
 }
+
+func TestIteratorSeek(t *testing.T) {
+	for name, newMemtable := range map[string]func() memtable.Memtable{
+		"map":      memtable.NewMapMemtable,
+		"skiplist": memtable.NewSkiplistMemtable,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mt := newMemtable()
+			for _, key := range []string{"a", "c", "e", "g"} {
+				mt.Put([]byte(key), []byte(key))
+			}
+
+			it := mt.Iterator()
+			require.NoError(t, it.(iterator.Seeker).Seek([]byte("b")))
+			entry, err := it.Next()
+			require.NoError(t, err)
+			require.Equal(t, "c", string(entry.Key))
+
+			// Seeking to a passed key stays put; seeking past the end exhausts
+			require.NoError(t, it.(iterator.Seeker).Seek([]byte("a")))
+			entry, err = it.Next()
+			require.NoError(t, err)
+			require.Equal(t, "e", string(entry.Key))
+			require.NoError(t, it.(iterator.Seeker).Seek([]byte("z")))
+			entry, err = it.Next()
+			require.NoError(t, err)
+			require.Nil(t, entry)
+		})
+	}
+}
+
+func TestApplyPreservesSeq(t *testing.T) {
+	mt := memtable.NewMapMemtable()
+
+	mt.Apply(&common.Entry{Type: common.EntryTypePut, Seq: 41, Key: []byte("a"), Value: []byte("v")})
+	mt.Apply(&common.Entry{Type: common.EntryTypeDelete, Seq: 42, Key: []byte("b")})
+
+	entry, ok := mt.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, uint64(41), entry.Seq)
+	require.Equal(t, []byte("v"), entry.Value)
+
+	entry, ok = mt.Get([]byte("b"))
+	require.True(t, ok)
+	require.Equal(t, common.EntryTypeDelete, entry.Type)
+	require.Equal(t, uint64(42), entry.Seq)
+
+	// Local puts continue after the highest applied seq
+	mt.Put([]byte("c"), []byte("w"))
+	entry, ok = mt.Get([]byte("c"))
+	require.True(t, ok)
+	require.Equal(t, uint64(43), entry.Seq)
+}
+
+func TestSize(t *testing.T) {
+	mt := memtable.NewMapMemtable()
+	require.Equal(t, 0, mt.Size())
+
+	mt.Put([]byte("key"), []byte("value"))
+	require.Equal(t, 8, mt.Size())
+
+	// Overwrites replace the old value's bytes rather than adding to them
+	mt.Put([]byte("key"), []byte("v"))
+	require.Equal(t, 4, mt.Size())
+
+	mt.Delete([]byte("key"))
+	require.Equal(t, 3, mt.Size())
+
+	mt.Apply(&common.Entry{Type: common.EntryTypePut, Seq: 10, Key: []byte("other"), Value: []byte("xy")})
+	require.Equal(t, 10, mt.Size())
+}
+
+func TestRangeTombstones(t *testing.T) {
+	mt := memtable.NewMapMemtable()
+	mt.Put([]byte("b"), []byte("v"))
+	mt.DeleteRange([]byte("a"), []byte("c"))
+	mt.Apply(&common.Entry{Type: common.EntryTypeRangeDelete, Seq: 10, Key: []byte("x"), Value: []byte("z")})
+
+	// Tombstones are held apart from point entries, which they leave alone
+	entry, ok := mt.Get([]byte("b"))
+	require.True(t, ok)
+	require.Equal(t, common.EntryTypePut, entry.Type)
+	require.Equal(t, 3, mt.Len())
+	require.Equal(t, 2+4, mt.Size())
+
+	tombstones := mt.RangeTombstones()
+	require.Len(t, tombstones, 2)
+	require.Equal(t, uint64(2), tombstones[0].Seq)
+	require.Equal(t, uint64(10), tombstones[1].Seq)
+
+	tests := []struct {
+		key     string
+		seq     uint64
+		covered bool
+	}{
+		{"b", 1, true},
+		{"b", 2, false},
+		{"a", 0, true},
+		{"c", 0, false},
+		{"y", 9, true},
+		{"z", 0, false},
+	}
+	for _, tt := range tests {
+		covered := tombstones.Covering([]byte(tt.key), tt.seq) != nil
+		require.Equal(t, tt.covered, covered, "%s@%d", tt.key, tt.seq)
+	}
+}
@@ -6,7 +6,19 @@ import "amethyst/internal/common"
 type Memtable interface {
 	Put(key, value []byte)
 	Delete(key []byte)
+	// DeleteRange installs a range tombstone for the keys in [start, end).
+	DeleteRange(start, end []byte)
+	// Apply records a committed entry as-is, keeping its sequence number.
+	Apply(entry *common.Entry)
 	Get(key []byte) (*common.Entry, bool)
+	// Iterator returns an iterator over the entries that can also Seek, as
+	// iterator.Seeker describes.
 	Iterator() common.EntryIterator
+	// RangeTombstones returns the range tombstones held, which Get and
+	// Iterator don't apply.
+	RangeTombstones() common.RangeTombstones
+	// Len counts point entries and range tombstones.
 	Len() int
+	// Size approximates the memory held by keys and values, in bytes.
+	Size() int
 }
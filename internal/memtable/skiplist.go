@@ -0,0 +1,288 @@
+package memtable
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"amethyst/internal/common"
+)
+
+const (
+	// skiplistMaxHeight bounds the levels of a skiplist node. With a 1 in 4
+	// chance of each extra level it indexes well past 4^12 keys.
+	skiplistMaxHeight = 12
+
+	// skiplistBranching is the inverse chance of a node reaching the next
+	// level.
+	skiplistBranching = 4
+)
+
+// skipNode holds one key and its newest entry. The key and the links to
+// its successors are set before the node is published and never change
+// afterwards, except that a link only ever moves to a newly inserted node.
+type skipNode struct {
+	key   []byte
+	entry atomic.Pointer[common.Entry] // Key left unset; replaced whole on overwrite
+	next  []atomic.Pointer[skipNode]   // one per level the node is on
+}
+
+// skiplistMemtableImpl keeps entries in a lock-free skiplist (Herlihy et
+// al., "A Simple Optimistic Skiplist Algorithm", without deletion). Inserts
+// link a node level by level with compare-and-swap, bottom up, so any number
+// of writers can insert at once, and reads walk the links without locking.
+// A key is in the memtable once its level 0 link is in place; the upper
+// levels only speed up the search.
+type skiplistMemtableImpl struct {
+	head   *skipNode
+	height atomic.Int32 // levels in use; searches start at the top one
+	next   atomic.Uint64
+	count  atomic.Int64
+	size   atomic.Int64
+	bloom  *bloom // every key inserted; nil if the memtable has no filter
+
+	rangeMu   sync.Mutex // serializes range tombstone writers
+	rangeDels atomic.Pointer[common.RangeTombstones]
+}
+
+var _ Memtable = (*skiplistMemtableImpl)(nil)
+
+// NewSkiplistMemtable returns a memtable that is safe for concurrent use:
+// writers may insert in parallel, and reads never block on them. Each key
+// holds only its newest entry, as in NewMapMemtable.
+func NewSkiplistMemtable() Memtable {
+	m := &skiplistMemtableImpl{
+		head: &skipNode{next: make([]atomic.Pointer[skipNode], skiplistMaxHeight)},
+	}
+	m.height.Store(1)
+	m.rangeDels.Store(&common.RangeTombstones{})
+	return m
+}
+
+// NewSkiplistMemtableWithBloom is like NewSkiplistMemtable but also keeps a
+// bloom filter of the keys, sized for about expectedKeys keys at bitsPerKey
+// bits each, so Get answers for most absent keys without searching the
+// skiplist. The filter's false positive rate rises as the memtable grows
+// past expectedKeys. A bitsPerKey of 0 or less keeps no filter.
+func NewSkiplistMemtableWithBloom(expectedKeys int, bitsPerKey float64) Memtable {
+	m := NewSkiplistMemtable().(*skiplistMemtableImpl)
+	if bitsPerKey > 0 {
+		m.bloom = newBloom(expectedKeys, bitsPerKey)
+	}
+	return m
+}
+
+// Put records or overwrites a key/value pair using the provided key and value.
+func (m *skiplistMemtableImpl) Put(key, value []byte) {
+	m.set(key, &common.Entry{
+		Type:  common.EntryTypePut,
+		Seq:   m.next.Add(1),
+		Value: value,
+	})
+}
+
+// Delete installs a tombstone for the given key.
+func (m *skiplistMemtableImpl) Delete(key []byte) {
+	m.set(key, &common.Entry{
+		Type: common.EntryTypeDelete,
+		Seq:  m.next.Add(1),
+	})
+}
+
+// DeleteRange installs a range tombstone for the keys in [start, end).
+func (m *skiplistMemtableImpl) DeleteRange(start, end []byte) {
+	m.addRangeDel(&common.Entry{
+		Type:  common.EntryTypeRangeDelete,
+		Seq:   m.next.Add(1),
+		Key:   start,
+		Value: end,
+	})
+}
+
+// Apply records a committed entry, preserving the sequence number assigned by
+// the DB so that flushed SSTables carry globally ordered seqs. Entries for
+// the same key may be applied concurrently in any order; the one with the
+// highest sequence number is kept.
+func (m *skiplistMemtableImpl) Apply(entry *common.Entry) {
+	for next := m.next.Load(); entry.Seq > next && !m.next.CompareAndSwap(next, entry.Seq); {
+		next = m.next.Load()
+	}
+	if entry.Type == common.EntryTypeRangeDelete {
+		m.addRangeDel(&common.Entry{
+			Type:      entry.Type,
+			Seq:       entry.Seq,
+			Timestamp: entry.Timestamp,
+			Key:       entry.Key,
+			Value:     entry.Value,
+		})
+		return
+	}
+	m.set(entry.Key, &common.Entry{
+		Type:      entry.Type,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Value:     entry.Value,
+	})
+}
+
+// set stores entry under key, inserting a node for key if it has none.
+func (m *skiplistMemtableImpl) set(key []byte, entry *common.Entry) {
+	var prev, next [skiplistMaxHeight]*skipNode
+	if found := m.findSplice(key, &prev, &next); found != nil {
+		m.replace(found, entry)
+		return
+	}
+
+	height := randomHeight()
+	node := &skipNode{key: bytes.Clone(key), next: make([]atomic.Pointer[skipNode], height)}
+	node.entry.Store(entry)
+	if m.bloom != nil {
+		// Before the node is linked, so a Get that finds it passes the filter
+		m.bloom.Add(key)
+	}
+	for h := m.height.Load(); int32(height) > h && !m.height.CompareAndSwap(h, int32(height)); {
+		h = m.height.Load()
+	}
+
+	for level := range height {
+		for {
+			node.next[level].Store(next[level])
+			if prev[level].next[level].CompareAndSwap(next[level], node) {
+				break
+			}
+			// Another node was linked in between; search again from prev
+			prev[level], next[level] = m.findSpliceForLevel(key, level, prev[level])
+			if level == 0 && next[0] != nil && bytes.Equal(next[0].key, key) {
+				// A concurrent writer inserted the key first
+				m.replace(next[0], entry)
+				return
+			}
+		}
+	}
+	m.count.Add(1)
+	m.size.Add(int64(len(key) + len(entry.Value)))
+}
+
+// replace makes entry node's newest entry unless it already holds a newer
+// one, keeping the size estimate current.
+func (m *skiplistMemtableImpl) replace(node *skipNode, entry *common.Entry) {
+	for {
+		old := node.entry.Load()
+		if old.Seq > entry.Seq {
+			return
+		}
+		if node.entry.CompareAndSwap(old, entry) {
+			m.size.Add(int64(len(entry.Value) - len(old.Value)))
+			return
+		}
+	}
+}
+
+// findSplice fills prev and next, at every level, with the nodes key falls
+// between, and returns the node holding key if there is one.
+func (m *skiplistMemtableImpl) findSplice(key []byte, prev, next *[skiplistMaxHeight]*skipNode) *skipNode {
+	before := m.head
+	for level := skiplistMaxHeight - 1; level >= 0; level-- {
+		prev[level], next[level] = m.findSpliceForLevel(key, level, before)
+		before = prev[level]
+	}
+	if next[0] != nil && bytes.Equal(next[0].key, key) {
+		return next[0]
+	}
+	return nil
+}
+
+// findSpliceForLevel walks level from before, which must sort before key,
+// and returns the last node before key and the first at or after it.
+func (m *skiplistMemtableImpl) findSpliceForLevel(key []byte, level int, before *skipNode) (*skipNode, *skipNode) {
+	for {
+		after := before.next[level].Load()
+		if after == nil || bytes.Compare(after.key, key) >= 0 {
+			return before, after
+		}
+		before = after
+	}
+}
+
+// find returns the node holding key, or nil.
+func (m *skiplistMemtableImpl) find(key []byte) *skipNode {
+	before := m.head
+	for level := int(m.height.Load()) - 1; level >= 0; level-- {
+		var after *skipNode
+		before, after = m.findSpliceForLevel(key, level, before)
+		if level == 0 && after != nil && bytes.Equal(after.key, key) {
+			return after
+		}
+	}
+	return nil
+}
+
+// addRangeDel stores a range tombstone, keeping the size estimate current.
+// Readers keep the slice they loaded, which appends never disturb.
+func (m *skiplistMemtableImpl) addRangeDel(entry *common.Entry) {
+	m.rangeMu.Lock()
+	defer m.rangeMu.Unlock()
+
+	rangeDels := append(*m.rangeDels.Load(), entry)
+	m.rangeDels.Store(&rangeDels)
+	m.size.Add(int64(len(entry.Key) + len(entry.Value)))
+}
+
+// Get returns the most recent entry for key, if any.
+func (m *skiplistMemtableImpl) Get(key []byte) (*common.Entry, bool) {
+	if m.bloom != nil && !m.bloom.MayContain(key) {
+		return nil, false
+	}
+	node := m.find(key)
+	if node == nil {
+		return nil, false
+	}
+	entry := node.entry.Load()
+	// Clone the entry with the key included
+	return &common.Entry{
+		Type:      entry.Type,
+		Seq:       entry.Seq,
+		Timestamp: entry.Timestamp,
+		ExpiresAt: entry.ExpiresAt,
+		Key:       key,
+		Value:     entry.Value,
+	}, true
+}
+
+// Iterator returns a snapshot iterator over the current entries. Writes
+// made while it is being created may or may not be included.
+func (m *skiplistMemtableImpl) Iterator() common.EntryIterator {
+	entries := make([]*common.Entry, 0, m.count.Load())
+	for node := m.head.next[0].Load(); node != nil; node = node.next[0].Load() {
+		entries = append(entries, cloneIteratorEntry(node.entry.Load(), string(node.key)))
+	}
+	return &memtableIterator{entries: entries}
+}
+
+// RangeTombstones returns the range tombstones in the order they were added.
+func (m *skiplistMemtableImpl) RangeTombstones() common.RangeTombstones {
+	rangeDels := *m.rangeDels.Load()
+	return rangeDels[:len(rangeDels):len(rangeDels)]
+}
+
+// Len returns the number of entries and range tombstones in the memtable.
+func (m *skiplistMemtableImpl) Len() int {
+	return int(m.count.Load()) + len(*m.rangeDels.Load())
+}
+
+// Size returns the combined length of every key and value held.
+func (m *skiplistMemtableImpl) Size() int {
+	return int(m.size.Load())
+}
+
+// randomHeight picks a new node's height, each level above the first with
+// a 1 in skiplistBranching chance.
+func randomHeight() int {
+	height := 1
+	for height < skiplistMaxHeight && rand.Uint32()%skiplistBranching == 0 {
+		height++
+	}
+	return height
+}
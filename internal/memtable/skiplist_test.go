@@ -0,0 +1,142 @@
+package memtable_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/memtable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkiplistMatchesMap(t *testing.T) {
+	skiplist, reference := memtable.NewSkiplistMemtable(), memtable.NewMapMemtable()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 5000 {
+		key := []byte(fmt.Sprintf("key%04d", rng.IntN(1000)))
+		switch rng.IntN(10) {
+		case 0:
+			skiplist.Delete(key)
+			reference.Delete(key)
+		case 1:
+			entry := &common.Entry{Type: common.EntryTypePut, Seq: uint64(10000 + i), Timestamp: int64(i), Key: key, Value: []byte("applied")}
+			skiplist.Apply(entry)
+			reference.Apply(entry)
+		default:
+			value := []byte(fmt.Sprintf("v%d", i))
+			skiplist.Put(key, value)
+			reference.Put(key, value)
+		}
+	}
+	skiplist.DeleteRange([]byte("key0100"), []byte("key0200"))
+	reference.DeleteRange([]byte("key0100"), []byte("key0200"))
+
+	require.Equal(t, reference.Len(), skiplist.Len())
+	require.Equal(t, reference.Size(), skiplist.Size())
+	require.Equal(t, reference.RangeTombstones(), skiplist.RangeTombstones())
+	for i := range 1100 {
+		key := []byte(fmt.Sprintf("key%04d", i))
+		want, wantOK := reference.Get(key)
+		got, ok := skiplist.Get(key)
+		require.Equal(t, wantOK, ok, "key %s", key)
+		require.Equal(t, want, got, "key %s", key)
+	}
+
+	var want []*common.Entry
+	it := reference.Iterator()
+	for entry, err := it.Next(); entry != nil; entry, err = it.Next() {
+		require.NoError(t, err)
+		want = append(want, entry)
+	}
+	common.RequireMatchesIterator(t, skiplist.Iterator(), want)
+}
+
+func TestSkiplistApplyKeepsNewest(t *testing.T) {
+	mt := memtable.NewSkiplistMemtable()
+	mt.Apply(&common.Entry{Type: common.EntryTypePut, Seq: 5, Key: []byte("a"), Value: []byte("new")})
+	mt.Apply(&common.Entry{Type: common.EntryTypePut, Seq: 3, Key: []byte("a"), Value: []byte("older")})
+
+	// An entry applied late doesn't overwrite a newer one
+	entry, ok := mt.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, uint64(5), entry.Seq)
+	require.Equal(t, []byte("new"), entry.Value)
+	require.Equal(t, 1+3, mt.Size())
+
+	mt.Put([]byte("b"), []byte("v"))
+	entry, ok = mt.Get([]byte("b"))
+	require.True(t, ok)
+	require.Equal(t, uint64(6), entry.Seq)
+}
+
+func TestSkiplistConcurrentWriters(t *testing.T) {
+	const writers, perWriter = 8, 500
+	mt := memtable.NewSkiplistMemtable()
+
+	// Writers overlap on keys and apply their seqs out of order; readers
+	// run alongside them
+	var wg sync.WaitGroup
+	var badRead atomic.Bool
+	done := make(chan struct{})
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if entry, ok := mt.Get([]byte("key0000")); ok && len(entry.Value) != 1 {
+					badRead.Store(true)
+				}
+				mt.Iterator()
+			}
+		}()
+	}
+	var writersWG sync.WaitGroup
+	for w := range writers {
+		writersWG.Add(1)
+		go func() {
+			defer writersWG.Done()
+			for i := range perWriter {
+				mt.Apply(&common.Entry{
+					Type:  common.EntryTypePut,
+					Seq:   uint64(i*writers + w + 1),
+					Key:   []byte(fmt.Sprintf("key%04d", i)),
+					Value: []byte{byte(w)},
+				})
+				if i%100 == 0 {
+					mt.DeleteRange([]byte("a"), []byte("b"))
+				}
+			}
+		}()
+	}
+	writersWG.Wait()
+	close(done)
+	wg.Wait()
+	require.False(t, badRead.Load())
+
+	require.Equal(t, perWriter+writers*perWriter/100, mt.Len())
+	require.Equal(t, perWriter*(len("key0000")+1)+writers*perWriter/100*2, mt.Size())
+	var prev []byte
+	it := mt.Iterator()
+	for i := 0; ; i++ {
+		entry, err := it.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			require.Equal(t, perWriter, i)
+			break
+		}
+		require.Greater(t, string(entry.Key), string(prev))
+		prev = entry.Key
+
+		// The last writer's entry has the highest seq for every key
+		require.Equal(t, uint64(i*writers+writers), entry.Seq)
+		require.Equal(t, []byte{writers - 1}, entry.Value)
+	}
+}
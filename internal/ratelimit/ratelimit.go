@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// refillsPerSecond sets the burst size: a tenth of a second's bytes may be
+// written at once after the limiter has been idle.
+const refillsPerSecond = 10
+
+// tokenBucket is a Limiter that accrues bytesPerSec tokens each second, up
+// to a burst. A request larger than the tokens available takes them all
+// the same, going into debt, and sleeps until the debt is repaid, so large
+// writes are paced rather than refused and later callers queue behind them.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+var _ Limiter = (*tokenBucket)(nil)
+
+// NewLimiter returns a Limiter allowing bytesPerSec bytes per second, which
+// must be positive.
+func NewLimiter(bytesPerSec int64) Limiter {
+	return newTokenBucket(bytesPerSec, time.Now, time.Sleep)
+}
+
+func newTokenBucket(bytesPerSec int64, now func() time.Time, sleep func(time.Duration)) *tokenBucket {
+	burst := float64(bytesPerSec) / refillsPerSecond
+	return &tokenBucket{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: burst,
+		last:   now(),
+		now:    now,
+		sleep:  sleep,
+	}
+}
+
+func (b *tokenBucket) Wait(n int) {
+	b.mu.Lock()
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if wait > 0 {
+		b.sleep(wait)
+	}
+}
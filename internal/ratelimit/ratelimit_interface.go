@@ -0,0 +1,8 @@
+package ratelimit
+
+// Limiter paces I/O to a sustained number of bytes per second. It is safe
+// for concurrent use, and callers share its budget.
+type Limiter interface {
+	// Wait blocks until n more bytes may be written.
+	Wait(n int)
+}
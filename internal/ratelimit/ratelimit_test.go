@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []int           // bytes per Wait, issued back to back
+		idle   time.Duration   // clock advance before the last write
+		sleeps []time.Duration // sleep requested by each Wait
+	}{
+		{"burst is free", []int{100}, 0, []time.Duration{0}},
+		{"past the burst waits", []int{100, 100}, 0, []time.Duration{0, 100 * time.Millisecond}},
+		{"large write goes into debt", []int{1100}, 0, []time.Duration{time.Second}},
+		{"debt delays the next writer", []int{1100, 100}, 0, []time.Duration{time.Second, 1100 * time.Millisecond}},
+		{"idle time refills", []int{200, 100}, 200 * time.Millisecond, []time.Duration{100 * time.Millisecond, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := time.Unix(0, 0)
+			var slept time.Duration
+			b := newTokenBucket(1000,
+				func() time.Time { return clock },
+				func(d time.Duration) { slept = d },
+			)
+			for i, n := range tt.writes {
+				if i == len(tt.writes)-1 {
+					clock = clock.Add(tt.idle)
+				}
+				slept = 0
+				b.Wait(n)
+				require.InDelta(t, tt.sleeps[i], slept, float64(time.Microsecond), "write %d", i)
+			}
+		})
+	}
+}
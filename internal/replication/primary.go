@@ -0,0 +1,247 @@
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+)
+
+// Primary serves a database's commits to replicas.
+type Primary struct {
+	db     *db.DB
+	logger common.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	closeCh   chan struct{}
+	wg        sync.WaitGroup // connection handlers
+}
+
+// NewPrimary returns a Primary for d, which must have been opened with a
+// replication backlog.
+func NewPrimary(d *db.DB) (*Primary, error) {
+	if d.Opts.ReplicationBacklog <= 0 {
+		return nil, db.ErrNoBacklog
+	}
+	return &Primary{
+		db:        d,
+		logger:    common.WithPrefix(d.Logger(), "replication"),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		closeCh:   make(chan struct{}),
+	}, nil
+}
+
+// Serve accepts replica connections on l, handling each in its own
+// goroutine, until l fails or the Primary is closed. It closes l on return,
+// and returns nil if the Primary was closed.
+func (p *Primary) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	p.listeners[l] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, l)
+		p.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-p.closeCh:
+				return nil
+			default:
+				return err
+			}
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		p.conns[conn] = struct{}{}
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		go func() {
+			defer p.wg.Done()
+			if err := p.handle(conn); err != nil {
+				p.logger.Log(common.LevelWarn, "replica connection failed", "addr", conn.RemoteAddr(), "err", err)
+			}
+			p.mu.Lock()
+			delete(p.conns, conn)
+			p.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops every Serve and drops every replica connection. The database
+// is left open.
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closeCh)
+	for l := range p.listeners {
+		l.Close()
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return nil
+}
+
+// handle answers a replica's hello with the commits it is missing, or with
+// a checkpoint if they are no longer in the backlog.
+func (p *Primary) handle(conn net.Conn) error {
+	hasData, seq, err := readHello(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(conn)
+
+	if hasData {
+		_, _, err := p.db.CommitsSince(seq)
+		if err == nil {
+			if _, err := common.WriteUint8(w, msgStream); err != nil {
+				return err
+			}
+			return p.stream(w, seq)
+		}
+		if !errors.Is(err, db.ErrNotInBacklog) {
+			return err
+		}
+	}
+	if _, err := common.WriteUint8(w, msgSnapshot); err != nil {
+		return err
+	}
+	return p.sendSnapshot(w)
+}
+
+// stream sends the commits after seq as they are made, until the
+// connection fails or the Primary is closed. A replica that can't keep up
+// with the backlog is dropped, and bootstraps again when it reconnects.
+func (p *Primary) stream(w *bufio.Writer, seq uint64) error {
+	for {
+		entries, more, err := p.db.CommitsSince(seq)
+		if err != nil {
+			return err
+		}
+		for len(entries) > 0 {
+			n := min(len(entries), maxEntriesPerMessage)
+			if err := writeEntries(w, entries[:n]); err != nil {
+				return err
+			}
+			seq = entries[n-1].Seq
+			entries = entries[n:]
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-more:
+		case <-p.closeCh:
+			return nil
+		}
+	}
+}
+
+// sendSnapshot checkpoints the database and sends every file of the
+// checkpoint.
+func (p *Primary) sendSnapshot(w *bufio.Writer) error {
+	fsys := p.db.FS()
+	snapshotDir := p.db.Paths().SnapshotDir()
+	if err := fsys.MkdirAll(snapshotDir, 0755); err != nil {
+		return err
+	}
+	dir := filepath.Join(snapshotDir, fmt.Sprintf("%019d", time.Now().UnixNano()))
+	if err := p.db.Checkpoint(dir); err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", err)
+	}
+	defer fsys.RemoveAll(dir)
+
+	if err := sendTree(fsys, w, dir, ""); err != nil {
+		return err
+	}
+	if _, err := common.WriteUint8(w, msgSnapshotEnd); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// sendTree sends every file under root/rel as a msgFile, naming each by
+// its path relative to root.
+func sendTree(fsys vfs.FS, w io.Writer, root, rel string) error {
+	entries, err := fsys.ReadDir(filepath.Join(root, rel))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := filepath.Join(rel, entry.Name())
+		if entry.IsDir() {
+			err = sendTree(fsys, w, root, name)
+		} else {
+			err = sendFile(fsys, w, root, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendFile(fsys vfs.FS, w io.Writer, root, name string) error {
+	f, err := fsys.Open(filepath.Join(root, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.ToSlash(name)
+	if _, err := common.WriteUint8(w, msgFile); err != nil {
+		return err
+	}
+	if _, err := common.WriteUint32(w, uint32(len(path))); err != nil {
+		return err
+	}
+	if _, err := common.WriteBytes(w, []byte(path)); err != nil {
+		return err
+	}
+	if _, err := common.WriteUint64(w, uint64(stat.Size())); err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, f, stat.Size())
+	return err
+}
@@ -0,0 +1,286 @@
+package replication
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/db"
+	"amethyst/internal/vfs"
+)
+
+// reconnectDelay is how long a Replica waits before reconnecting after its
+// connection to the primary fails.
+const reconnectDelay = 100 * time.Millisecond
+
+// Replica follows a primary, applying its commits to a local database that
+// serves reads.
+type Replica struct {
+	addr   string
+	dir    string
+	fs     vfs.FS // the database's filesystem, taken from its Env
+	opts   []db.Option
+	logger common.Logger
+
+	mu   sync.RWMutex
+	db   *db.DB // nil until bootstrapped
+	conn net.Conn
+
+	closed  bool
+	closeCh chan struct{}
+	done    chan struct{}
+}
+
+// StartReplica opens the database opts describe, if it exists, and starts
+// following the primary at addr in the background. The database is
+// bootstrapped from the primary first if it doesn't exist yet.
+func StartReplica(addr string, opts ...db.Option) (*Replica, error) {
+	o := db.DefaultOptions
+	for _, fn := range opts {
+		fn(&o)
+	}
+	logger := o.Logger
+	if logger == nil {
+		logger = common.DefaultLogger
+	}
+	fsys := vfs.Default
+	if o.Env != nil {
+		fsys = o.Env.FS
+	}
+	r := &Replica{
+		addr:    addr,
+		dir:     o.DBPath,
+		fs:      fsys,
+		opts:    opts,
+		logger:  common.WithPrefix(logger, "replication"),
+		closeCh: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if _, err := r.fs.Stat(common.NewPathManager(r.dir).ManifestPath()); err == nil {
+		d, err := db.Open(opts...)
+		if err != nil {
+			return nil, err
+		}
+		r.db = d
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// DB returns the replica's database, or nil if it hasn't been bootstrapped
+// yet. Reads only: the replica takes no writes but the primary's. A replica
+// that falls further behind than the primary's backlog is bootstrapped
+// again, which closes the database DB returned and opens a new one.
+func (r *Replica) DB() *db.DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db
+}
+
+// Close stops following the primary and closes the database.
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.closeCh)
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mu.Unlock()
+	<-r.done
+
+	if r.db != nil {
+		return r.db.Close()
+	}
+	return nil
+}
+
+// run follows the primary, reconnecting after each failure, until Close.
+func (r *Replica) run() {
+	defer close(r.done)
+	for {
+		err := r.follow()
+		select {
+		case <-r.closeCh:
+			return
+		default:
+		}
+		if err == nil {
+			// Bootstrapped; reconnect to stream from the checkpoint
+			continue
+		}
+		r.logger.Log(common.LevelWarn, "following primary failed", "addr", r.addr, "err", err)
+		select {
+		case <-r.closeCh:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// follow makes one connection to the primary and reads from it until it
+// fails or, after a bootstrap, the primary hangs up.
+func (r *Replica) follow() error {
+	conn, err := net.Dial("tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.conn = conn
+	d := r.db
+	r.mu.Unlock()
+
+	var seq uint64
+	if d != nil {
+		seq = d.LastSeq()
+	}
+	if err := writeHello(conn, d != nil, seq); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	msg, err := common.ReadUint8(br)
+	if err != nil {
+		return err
+	}
+	switch msg {
+	case msgStream:
+		return r.apply(d, br)
+	case msgSnapshot:
+		return r.bootstrap(br)
+	default:
+		return fmt.Errorf("%w: unexpected message %d", ErrProtocol, msg)
+	}
+}
+
+// apply commits the entries the primary streams to d.
+func (r *Replica) apply(d *db.DB, br *bufio.Reader) error {
+	for {
+		msg, err := common.ReadUint8(br)
+		if err != nil {
+			return err
+		}
+		if msg != msgEntries {
+			return fmt.Errorf("%w: unexpected message %d", ErrProtocol, msg)
+		}
+		entries, err := readEntries(br)
+		if err != nil {
+			return err
+		}
+		if err := d.ApplyReplicated(entries, db.DefaultWriteOptions); err != nil {
+			return fmt.Errorf("failed to apply commits: %w", err)
+		}
+	}
+}
+
+// bootstrap receives the primary's checkpoint into a staging directory
+// next to the database's, then replaces the database with it.
+func (r *Replica) bootstrap(br *bufio.Reader) error {
+	fsys := r.fs
+	staging := r.dir + ".bootstrap"
+	if err := fsys.RemoveAll(staging); err != nil {
+		return err
+	}
+	defer fsys.RemoveAll(staging)
+
+	for done := false; !done; {
+		msg, err := common.ReadUint8(br)
+		if err != nil {
+			return err
+		}
+		switch msg {
+		case msgFile:
+			err = receiveFile(fsys, br, staging)
+		case msgSnapshotEnd:
+			done = true
+		default:
+			err = fmt.Errorf("%w: unexpected message %d", ErrProtocol, msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	if r.db != nil {
+		if err := r.db.Close(); err != nil {
+			r.logger.Log(common.LevelError, "failed to close database", "err", err)
+		}
+		r.db = nil
+	}
+	if err := fsys.RemoveAll(r.dir); err != nil {
+		return err
+	}
+	if err := fsys.Rename(staging, r.dir); err != nil {
+		return err
+	}
+	if err := vfs.SyncDir(fsys, filepath.Dir(r.dir)); err != nil {
+		return err
+	}
+	d, err := db.Open(r.opts...)
+	if err != nil {
+		return fmt.Errorf("failed to open bootstrapped database: %w", err)
+	}
+	r.db = d
+	r.logger.Log(common.LevelInfo, "bootstrapped from primary", "addr", r.addr, "seq", d.LastSeq())
+	return nil
+}
+
+// receiveFile reads the body of a msgFile into a file under dir, syncing
+// it.
+func receiveFile(fsys vfs.FS, br *bufio.Reader, dir string) error {
+	n, err := common.ReadUint32(br)
+	if err != nil {
+		return err
+	}
+	name, err := common.ReadBytes(br, uint64(n))
+	if err != nil {
+		return err
+	}
+	path := filepath.FromSlash(string(name))
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("%w: file %q is outside the database", ErrProtocol, name)
+	}
+	size, err := common.ReadUint64(br)
+	if err != nil {
+		return err
+	}
+
+	path = filepath.Join(dir, path)
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := fsys.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, br, int64(size)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,122 @@
+// Package replication keeps replica databases in step with a primary over
+// the network. A Primary streams every committed entry, with its sequence
+// number, from the database's replication backlog (see
+// db.Options.ReplicationBacklog); a Replica applies them to its own database
+// with DB.ApplyReplicated, so it holds the same data under the same
+// sequence numbers.
+//
+// A replica with no database yet, or one further behind than the primary's
+// backlog reaches, first bootstraps from a checkpoint the primary takes and
+// sends file by file, then streams the commits made since.
+//
+// Each connection starts with the replica's hello:
+//
+//	version  uint8   protocolVersion
+//	hasData  uint8   1 if the replica has a database to resume
+//	seq      uint64  the replica's LastSeq
+//
+// The primary replies with msgStream, followed by msgEntries messages for as
+// long as the connection lasts, or with msgSnapshot, followed by a msgFile
+// per checkpoint file, then msgSnapshotEnd, after which it hangs up and the
+// replica reconnects to stream.
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"amethyst/internal/common"
+)
+
+const protocolVersion = 1
+
+// Messages a primary sends.
+const (
+	msgStream      uint8 = iota + 1 // reply to hello: commits follow
+	msgSnapshot                     // reply to hello: a checkpoint follows
+	msgFile                         // uint32 path length, path, uint64 size, contents
+	msgSnapshotEnd                  // the checkpoint is complete
+	msgEntries                      // uint32 count, then that many entries
+)
+
+// maxEntriesPerMessage bounds the entries sent in one msgEntries, so a
+// replica far behind applies its backlog in batches of moderate size.
+const maxEntriesPerMessage = 1024
+
+// ErrProtocol is returned when a peer sends something the protocol doesn't
+// allow.
+var ErrProtocol = errors.New("replication: protocol error")
+
+func writeHello(w io.Writer, hasData bool, seq uint64) error {
+	flag := uint8(0)
+	if hasData {
+		flag = 1
+	}
+	if _, err := common.WriteUint8(w, protocolVersion); err != nil {
+		return err
+	}
+	if _, err := common.WriteUint8(w, flag); err != nil {
+		return err
+	}
+	_, err := common.WriteUint64(w, seq)
+	return err
+}
+
+func readHello(r io.Reader) (bool, uint64, error) {
+	version, err := common.ReadUint8(r)
+	if err != nil {
+		return false, 0, err
+	}
+	if version != protocolVersion {
+		return false, 0, fmt.Errorf("%w: unsupported version %d", ErrProtocol, version)
+	}
+	flag, err := common.ReadUint8(r)
+	if err != nil {
+		return false, 0, err
+	}
+	seq, err := common.ReadUint64(r)
+	if err != nil {
+		return false, 0, err
+	}
+	return flag == 1, seq, nil
+}
+
+func writeEntries(w io.Writer, entries []*common.Entry) error {
+	if _, err := common.WriteUint8(w, msgEntries); err != nil {
+		return err
+	}
+	if _, err := common.WriteUint32(w, uint32(len(entries))); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := common.WriteEntry(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEntries reads the body of a msgEntries.
+func readEntries(r *bufio.Reader) ([]*common.Entry, error) {
+	n, err := common.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxEntriesPerMessage {
+		return nil, fmt.Errorf("%w: %d entries in one message", ErrProtocol, n)
+	}
+	entries := make([]*common.Entry, 0, n)
+	for range n {
+		entry, err := common.ReadEntry(r)
+		if err == nil && entry == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
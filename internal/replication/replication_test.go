@@ -0,0 +1,147 @@
+package replication_test
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"amethyst/internal/db"
+	"amethyst/internal/replication"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// startPrimary opens a primary database with the given backlog and serves
+// it on a local port. opts are applied after the defaults it sets.
+func startPrimary(t *testing.T, backlog int, opts ...db.Option) (*db.DB, string) {
+	d, err := db.Open(append([]db.Option{
+		db.WithDBPath(t.TempDir()),
+		db.WithMemtableFlushThreshold(16),
+		db.WithReplicationBacklog(backlog),
+	}, opts...)...)
+	require.NoError(t, err)
+	p, err := replication.NewPrimary(d)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go p.Serve(l)
+	t.Cleanup(func() {
+		p.Close()
+		d.Close()
+	})
+	return d, l.Addr().String()
+}
+
+// waitForReplica waits until r has applied every commit of primary.
+func waitForReplica(t *testing.T, r *replication.Replica, primary *db.DB) {
+	require.Eventually(t, func() bool {
+		d := r.DB()
+		return d != nil && d.LastSeq() == primary.LastSeq()
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+// requireValues checks that keys from through to-1 hold value in d.
+func requireValues(t *testing.T, d *db.DB, from, to int, value string) {
+	for i := from; i < to; i++ {
+		got, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, value, string(got))
+	}
+}
+
+func TestReplicaFollowsPrimary(t *testing.T) {
+	primary, addr := startPrimary(t, 1000)
+	for i := range 50 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("old")))
+	}
+
+	// A new replica bootstraps from a checkpoint, then streams
+	dir := filepath.Join(t.TempDir(), "replica")
+	r, err := replication.StartReplica(addr, db.WithDBPath(dir))
+	require.NoError(t, err)
+	waitForReplica(t, r, primary)
+	requireValues(t, r.DB(), 0, 50, "old")
+
+	for i := range 100 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("new")))
+	}
+	require.NoError(t, primary.Delete([]byte("key000")))
+	require.NoError(t, primary.DeleteRange([]byte("key090"), []byte("key100")))
+	waitForReplica(t, r, primary)
+	replica := r.DB()
+	requireValues(t, replica, 1, 90, "new")
+	for _, key := range []string{"key000", "key095"} {
+		_, err := replica.Get([]byte(key))
+		require.ErrorIs(t, err, db.ErrNotFound)
+	}
+	primaryEntry, err := primary.GetEntry([]byte("key050"))
+	require.NoError(t, err)
+	replicaEntry, err := replica.GetEntry([]byte("key050"))
+	require.NoError(t, err)
+	require.Equal(t, primaryEntry, replicaEntry)
+	require.NoError(t, r.Close())
+
+	// A restarted replica resumes from where it stopped
+	for i := range 10 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("resumed")))
+	}
+	r, err = replication.StartReplica(addr, db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer r.Close()
+	require.NotNil(t, r.DB())
+	waitForReplica(t, r, primary)
+	requireValues(t, r.DB(), 0, 10, "resumed")
+}
+
+func TestReplicaBootstrapsAgainWhenBehind(t *testing.T) {
+	primary, addr := startPrimary(t, 8)
+	dir := filepath.Join(t.TempDir(), "replica")
+	r, err := replication.StartReplica(addr, db.WithDBPath(dir))
+	require.NoError(t, err)
+	waitForReplica(t, r, primary)
+	require.NoError(t, r.Close())
+
+	// The commits made while the replica was away overflow the backlog
+	for i := range 100 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("v")))
+	}
+	r, err = replication.StartReplica(addr, db.WithDBPath(dir))
+	require.NoError(t, err)
+	defer r.Close()
+	waitForReplica(t, r, primary)
+	requireValues(t, r.DB(), 0, 100, "v")
+}
+
+func TestReplicationOnMemFS(t *testing.T) {
+	// Neither side touches the OS filesystem, so the snapshot must be read
+	// and written through each database's own
+	primary, addr := startPrimary(t, 1000, db.WithEnv(db.NewEnvWithFS(vfs.NewMemFS())), db.WithDBPath("/primary"))
+	for i := range 50 {
+		require.NoError(t, primary.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("v")))
+	}
+
+	replicaFS := vfs.NewMemFS()
+	opts := []db.Option{db.WithEnv(db.NewEnvWithFS(replicaFS)), db.WithDBPath("/replica")}
+	r, err := replication.StartReplica(addr, opts...)
+	require.NoError(t, err)
+	waitForReplica(t, r, primary)
+	requireValues(t, r.DB(), 0, 50, "v")
+	require.NoError(t, r.Close())
+
+	// A restarted replica finds its database on the same filesystem
+	r, err = replication.StartReplica(addr, opts...)
+	require.NoError(t, err)
+	defer r.Close()
+	require.NotNil(t, r.DB())
+	requireValues(t, r.DB(), 0, 50, "v")
+}
+
+func TestNewPrimaryNeedsBacklog(t *testing.T) {
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+	_, err = replication.NewPrimary(d)
+	require.ErrorIs(t, err, db.ErrNoBacklog)
+}
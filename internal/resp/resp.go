@@ -0,0 +1,182 @@
+// Package resp speaks RESP2, the Redis serialization protocol, so that
+// existing Redis clients can talk to an amethyst server.
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrProtocol is returned for input that isn't a well-formed command. The
+// connection can't be resynchronized afterwards and should be closed.
+var ErrProtocol = errors.New("resp: protocol error")
+
+// maxBulkLen bounds a single argument, as Redis's proto-max-bulk-len does.
+const maxBulkLen = 512 << 20
+
+// maxArgs bounds the number of arguments of one command.
+const maxArgs = 1 << 20
+
+// Reader reads commands sent by a client.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading commands from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadCommand reads the next command and returns its arguments, the first
+// being the command name. Clients send commands as arrays of bulk strings;
+// inline commands, a line of space-separated words as typed into telnet,
+// are accepted too. Returns io.EOF once the client closes the connection
+// between commands.
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '*' {
+			if args := bytes.Fields(line); len(args) > 0 {
+				return args, nil
+			}
+			continue
+		}
+
+		n, err := parseLength(line[1:], maxArgs)
+		if err != nil {
+			return nil, err
+		}
+		args := make([][]byte, 0, n)
+		for len(args) < n {
+			arg, err := r.readBulk()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		if n > 0 {
+			return args, nil
+		}
+	}
+}
+
+// readBulk reads one $<len>\r\n<data>\r\n bulk string.
+func (r *Reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected bulk string, got %q", ErrProtocol, line)
+	}
+	n, err := parseLength(line[1:], maxBulkLen)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", ErrProtocol)
+	}
+	return buf[:n], nil
+}
+
+// readLine reads a line, without its \r\n or \n ending.
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("%w: line too long", ErrProtocol)
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	return bytes.Clone(line), nil
+}
+
+// parseLength parses an array or bulk string length in [0, limit].
+func parseLength(b []byte, limit int) (int, error) {
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 || n > limit {
+		return 0, fmt.Errorf("%w: invalid length %q", ErrProtocol, b)
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Writer writes replies to a client. Replies are buffered until Flush.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer writing replies to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteSimpleString writes a status reply such as OK. s must not contain
+// line breaks.
+func (w *Writer) WriteSimpleString(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+// WriteError writes an error reply. By convention msg starts with an
+// upper-case error code, e.g. "ERR" or "WRONGTYPE". Line breaks are replaced
+// by spaces, since the reply must fit on one line.
+func (w *Writer) WriteError(msg string) {
+	msg = string(bytes.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, []byte(msg)))
+	w.w.WriteString("-" + msg + "\r\n")
+}
+
+// WriteInteger writes an integer reply.
+func (w *Writer) WriteInteger(n int64) {
+	w.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// WriteBulk writes a bulk string reply, or the null reply if b is nil.
+func (w *Writer) WriteBulk(b []byte) {
+	if b == nil {
+		w.w.WriteString("$-1\r\n")
+		return
+	}
+	w.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// WriteArray writes the header of an array reply of n elements, which the
+// caller writes next.
+func (w *Writer) WriteArray(n int) {
+	w.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// Flush sends the buffered replies.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,82 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected [][]string
+		err      error
+	}{
+		{"array", "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", [][]string{{"GET", "key"}}, io.EOF},
+		{"binary-safe", "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$4\r\na\r\nb\r\n", [][]string{{"SET", "k", "a\r\nb"}}, io.EOF},
+		{"empty argument", "*2\r\n$3\r\nGET\r\n$0\r\n\r\n", [][]string{{"GET", ""}}, io.EOF},
+		{"inline", "SET k  v\r\nPING\n", [][]string{{"SET", "k", "v"}, {"PING"}}, io.EOF},
+		{"blank lines and empty arrays", "\r\n*0\r\nPING\r\n", [][]string{{"PING"}}, io.EOF},
+		{"pipelined", "*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPING\r\n", [][]string{{"PING"}, {"PING"}}, io.EOF},
+		{"truncated bulk", "*1\r\n$4\r\nPI", nil, io.ErrUnexpectedEOF},
+		{"truncated array", "*2\r\n$4\r\nPING\r\n", nil, io.ErrUnexpectedEOF},
+		{"bad length", "*x\r\n", nil, ErrProtocol},
+		{"negative length", "*1\r\n$-1\r\n", nil, ErrProtocol},
+		{"missing CRLF", "*1\r\n$4\r\nPINGxx", nil, ErrProtocol},
+		{"not a bulk string", "*1\r\n:4\r\n", nil, ErrProtocol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.input))
+			var commands [][]string
+			for {
+				args, err := r.ReadCommand()
+				if err != nil {
+					require.ErrorIs(t, err, tt.err)
+					break
+				}
+				var command []string
+				for _, arg := range args {
+					command = append(command, string(arg))
+				}
+				commands = append(commands, command)
+			}
+			require.Equal(t, tt.expected, commands)
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(w *Writer)
+		expected string
+	}{
+		{"simple string", func(w *Writer) { w.WriteSimpleString("OK") }, "+OK\r\n"},
+		{"error", func(w *Writer) { w.WriteError("ERR bad\r\nthing") }, "-ERR bad  thing\r\n"},
+		{"integer", func(w *Writer) { w.WriteInteger(-2) }, ":-2\r\n"},
+		{"bulk", func(w *Writer) { w.WriteBulk([]byte("a\r\nb")) }, "$4\r\na\r\nb\r\n"},
+		{"empty bulk", func(w *Writer) { w.WriteBulk([]byte{}) }, "$0\r\n\r\n"},
+		{"null bulk", func(w *Writer) { w.WriteBulk(nil) }, "$-1\r\n"},
+		{"array", func(w *Writer) {
+			w.WriteArray(2)
+			w.WriteBulk([]byte("0"))
+			w.WriteArray(0)
+		}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			tt.write(w)
+			require.NoError(t, w.Flush())
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"amethyst/internal/common"
+)
+
+// group runs jobs on a parent Scheduler shared with others while tracking
+// its own apart from theirs, so each user of a shared pool can wait for and
+// cancel just its jobs.
+type group struct {
+	parent Scheduler
+	logger common.Logger
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queued  int
+	running int
+	closed  bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ Scheduler = (*group)(nil)
+
+// NewGroup returns a Scheduler running jobs on parent. Its Wait waits for
+// its own jobs only, and its Close cancels them, waits for the running ones
+// and skips the queued ones, leaving parent open. Failed jobs are logged to
+// logger. parent must outlive the group's jobs.
+func NewGroup(parent Scheduler, logger common.Logger) Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &group{parent: parent, logger: logger, ctx: ctx, cancel: cancel}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *group) Schedule(t JobType, job Job) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return ErrClosed
+	}
+	g.queued++
+	g.mu.Unlock()
+
+	err := g.parent.Schedule(t, func(ctx context.Context) error {
+		g.run(ctx, t, job)
+		return nil
+	})
+	if err != nil {
+		g.mu.Lock()
+		g.queued--
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	}
+	return err
+}
+
+// run runs job unless the group was closed while it was queued. It is
+// cancelled when either the parent or the group is closed.
+func (g *group) run(ctx context.Context, t JobType, job Job) {
+	g.mu.Lock()
+	g.queued--
+	if g.closed {
+		g.cond.Broadcast()
+		g.mu.Unlock()
+		return
+	}
+	g.running++
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(g.ctx, cancel)
+	if err := job(ctx); err != nil && ctx.Err() == nil {
+		g.logger.Log(common.LevelError, "background job failed", "job", t, "err", err)
+	}
+	stop()
+	cancel()
+
+	g.mu.Lock()
+	g.running--
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
+
+func (g *group) Wait() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for (g.queued > 0 || g.running > 0) && !g.closed {
+		g.cond.Wait()
+	}
+}
+
+func (g *group) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	g.cancel()
+	g.cond.Broadcast()
+	for g.running > 0 {
+		g.cond.Wait()
+	}
+}
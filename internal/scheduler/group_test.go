@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"amethyst/internal/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupsShareParent(t *testing.T) {
+	s := NewScheduler(2, nil, common.DiscardLogger)
+	defer s.Close()
+	a := NewGroup(s, common.DiscardLogger)
+	b := NewGroup(s, common.DiscardLogger)
+
+	// b's job runs until b is closed
+	started := make(chan struct{})
+	require.NoError(t, b.Schedule(JobCompaction, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	<-started
+
+	// a waits only for its own jobs
+	var ran atomic.Bool
+	require.NoError(t, a.Schedule(JobFlush, func(ctx context.Context) error {
+		ran.Store(true)
+		return nil
+	}))
+	a.Wait()
+	require.True(t, ran.Load())
+
+	// Closing b cancels its job and leaves a and the parent open
+	b.Close()
+	require.ErrorIs(t, b.Schedule(JobFlush, func(ctx context.Context) error { return nil }), ErrClosed)
+	ran.Store(false)
+	require.NoError(t, a.Schedule(JobFlush, func(ctx context.Context) error {
+		ran.Store(true)
+		return nil
+	}))
+	a.Wait()
+	require.True(t, ran.Load())
+	a.Close()
+}
+
+func TestGroupCloseSkipsQueuedJobs(t *testing.T) {
+	s := NewScheduler(1, nil, common.DiscardLogger)
+	defer s.Close()
+	busy := NewGroup(s, common.DiscardLogger)
+	g := NewGroup(s, common.DiscardLogger)
+
+	release := make(chan struct{})
+	require.NoError(t, busy.Schedule(JobFlush, func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+	var ran atomic.Bool
+	require.NoError(t, g.Schedule(JobFlush, func(ctx context.Context) error {
+		ran.Store(true)
+		return nil
+	}))
+
+	// The queued job holds up neither Close nor, once closed, Wait
+	g.Close()
+	g.Wait()
+	close(release)
+	s.Wait()
+	require.False(t, ran.Load())
+	busy.Close()
+}
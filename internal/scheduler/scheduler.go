@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+
+	"amethyst/internal/common"
+)
+
+// poolScheduler runs jobs on a fixed set of workers. Each job type has its own
+// FIFO queue and concurrency limit; a free worker takes the first job of the
+// highest-priority type that is under its limit.
+type poolScheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  [numJobTypes][]Job
+	running [numJobTypes]int
+	limits  [numJobTypes]int
+	closed  bool
+	logger  common.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ Scheduler = (*poolScheduler)(nil)
+
+// NewScheduler starts workers goroutines. limits caps how many jobs of each
+// type run at once; types missing from limits may use every worker. Jobs
+// that fail are logged to logger.
+func NewScheduler(workers int, limits map[JobType]int, logger common.Logger) Scheduler {
+	workers = max(workers, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &poolScheduler{ctx: ctx, cancel: cancel, logger: logger}
+	s.cond = sync.NewCond(&s.mu)
+	for t := range s.limits {
+		s.limits[t] = workers
+		if limit, ok := limits[JobType(t)]; ok {
+			s.limits[t] = max(limit, 1)
+		}
+	}
+
+	s.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	return s
+}
+
+func (s *poolScheduler) Schedule(t JobType, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.queues[t] = append(s.queues[t], job)
+	s.cond.Broadcast()
+	return nil
+}
+
+// next blocks until a job may run and claims it. Returns false once closed.
+// Must be called with s.mu held.
+func (s *poolScheduler) next() (JobType, Job, bool) {
+	for {
+		if s.closed {
+			return 0, nil, false
+		}
+		for t := range s.queues {
+			if len(s.queues[t]) > 0 && s.running[t] < s.limits[t] {
+				job := s.queues[t][0]
+				s.queues[t] = s.queues[t][1:]
+				s.running[t]++
+				return JobType(t), job, true
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *poolScheduler) worker() {
+	defer s.wg.Done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		t, job, ok := s.next()
+		if !ok {
+			return
+		}
+
+		s.mu.Unlock()
+		if err := job(s.ctx); err != nil && s.ctx.Err() == nil {
+			s.logger.Log(common.LevelError, "background job failed", "job", t, "err", err)
+		}
+		s.mu.Lock()
+
+		s.running[t]--
+		s.cond.Broadcast()
+	}
+}
+
+// idle reports whether nothing is queued or running.
+// Must be called with s.mu held.
+func (s *poolScheduler) idle() bool {
+	for t := range s.queues {
+		if len(s.queues[t]) > 0 || s.running[t] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *poolScheduler) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.idle() && !s.closed {
+		s.cond.Wait()
+	}
+}
+
+func (s *poolScheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for t := range s.queues {
+		s.queues[t] = nil
+	}
+	s.cancel()
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned when scheduling on a closed scheduler.
+var ErrClosed = errors.New("scheduler: closed")
+
+// JobType classifies background work. Lower values run first when workers
+// are scarce.
+type JobType int
+
+const (
+	JobFlush JobType = iota
+	JobCompaction
+	numJobTypes
+)
+
+func (t JobType) String() string {
+	switch t {
+	case JobFlush:
+		return "flush"
+	case JobCompaction:
+		return "compaction"
+	default:
+		return "unknown"
+	}
+}
+
+// Job is a unit of background work. Jobs should return promptly once ctx is
+// cancelled.
+type Job func(ctx context.Context) error
+
+// Scheduler runs background jobs on a bounded worker pool.
+type Scheduler interface {
+	// Schedule queues job to run. Fails with ErrClosed after Close.
+	Schedule(t JobType, job Job) error
+
+	// Wait blocks until no jobs are queued or running.
+	Wait()
+
+	// Close cancels running jobs, drops queued ones, and waits for the
+	// workers to exit.
+	Close()
+}
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"amethyst/internal/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushesRunBeforeCompactions(t *testing.T) {
+	s := NewScheduler(1, nil, common.DiscardLogger)
+	defer s.Close()
+
+	// Hold the only worker while jobs queue up behind it
+	release := make(chan struct{})
+	require.NoError(t, s.Schedule(JobCompaction, func(ctx context.Context) error {
+		<-release
+		return nil
+	}))
+
+	var mu sync.Mutex
+	var order []JobType
+	record := func(t JobType) Job {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			order = append(order, t)
+			mu.Unlock()
+			return nil
+		}
+	}
+	require.NoError(t, s.Schedule(JobCompaction, record(JobCompaction)))
+	require.NoError(t, s.Schedule(JobFlush, record(JobFlush)))
+	require.NoError(t, s.Schedule(JobCompaction, record(JobCompaction)))
+	require.NoError(t, s.Schedule(JobFlush, record(JobFlush)))
+
+	close(release)
+	s.Wait()
+	require.Equal(t, []JobType{JobFlush, JobFlush, JobCompaction, JobCompaction}, order)
+}
+
+func TestPerTypeLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		limit   int
+		want    int32
+	}{
+		{"limit below workers", 4, 1, 1},
+		{"limit of two", 4, 2, 2},
+		{"workers below limit", 2, 8, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.workers, map[JobType]int{JobCompaction: tt.limit}, common.DiscardLogger)
+			defer s.Close()
+
+			var running, peak atomic.Int32
+			for i := 0; i < 10; i++ {
+				require.NoError(t, s.Schedule(JobCompaction, func(ctx context.Context) error {
+					n := running.Add(1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					running.Add(-1)
+					return nil
+				}))
+			}
+
+			s.Wait()
+			require.Equal(t, tt.want, peak.Load())
+		})
+	}
+}
+
+func TestCloseCancelsJobs(t *testing.T) {
+	s := NewScheduler(1, nil, common.DiscardLogger)
+
+	started := make(chan struct{})
+	var cancelled atomic.Bool
+	require.NoError(t, s.Schedule(JobCompaction, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		cancelled.Store(true)
+		return ctx.Err()
+	}))
+
+	var queuedRan atomic.Bool
+	require.NoError(t, s.Schedule(JobCompaction, func(ctx context.Context) error {
+		queuedRan.Store(true)
+		return nil
+	}))
+
+	<-started
+	s.Close()
+	require.True(t, cancelled.Load(), "running job sees cancellation")
+	require.False(t, queuedRan.Load(), "queued jobs are dropped")
+	require.ErrorIs(t, s.Schedule(JobFlush, func(ctx context.Context) error { return nil }), ErrClosed)
+
+	s.Close() // idempotent
+}
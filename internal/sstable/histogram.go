@@ -0,0 +1,44 @@
+package sstable
+
+import "math/bits"
+
+// SizeHistogram counts sizes in power-of-two buckets: bucket 0 holds size 0
+// and bucket i >= 1 holds sizes in [2^(i-1), 2^i). Trailing empty buckets
+// are not stored.
+type SizeHistogram []uint32
+
+// Add counts one size.
+func (h *SizeHistogram) Add(size int) {
+	i := bits.Len(uint(size))
+	for len(*h) <= i {
+		*h = append(*h, 0)
+	}
+	(*h)[i]++
+}
+
+// Merge adds the counts of other.
+func (h *SizeHistogram) Merge(other SizeHistogram) {
+	for len(*h) < len(other) {
+		*h = append(*h, 0)
+	}
+	for i, n := range other {
+		(*h)[i] += n
+	}
+}
+
+// Count returns the number of sizes counted.
+func (h SizeHistogram) Count() int {
+	total := 0
+	for _, n := range h {
+		total += int(n)
+	}
+	return total
+}
+
+// BucketBounds returns the smallest and largest size bucket i holds.
+func BucketBounds(i int) (lo, hi int) {
+	if i == 0 {
+		return 0, 0
+	}
+	return 1 << (i - 1), 1<<i - 1
+}
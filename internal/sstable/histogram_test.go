@@ -0,0 +1,45 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []int
+		want  SizeHistogram
+	}{
+		{"Empty", nil, nil},
+		{"Zero", []int{0}, SizeHistogram{1}},
+		{"PowersOfTwo", []int{1, 2, 3, 4, 7, 8}, SizeHistogram{0, 1, 2, 2, 1}},
+		{"Large", []int{1000}, SizeHistogram{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h SizeHistogram
+			for _, size := range tt.sizes {
+				h.Add(size)
+			}
+			require.Equal(t, tt.want, h)
+			require.Equal(t, len(tt.sizes), h.Count())
+
+			for i := range h {
+				lo, hi := BucketBounds(i)
+				for _, size := range tt.sizes {
+					if size >= lo && size <= hi {
+						require.NotZero(t, h[i])
+					}
+				}
+			}
+		})
+	}
+
+	var merged SizeHistogram
+	merged.Merge(SizeHistogram{1, 2})
+	merged.Merge(SizeHistogram{0, 1, 0, 4})
+	require.Equal(t, SizeHistogram{1, 3, 0, 4}, merged)
+}
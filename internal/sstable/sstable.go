@@ -1,16 +1,21 @@
 package sstable
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"os"
+	"sync"
+	"time"
 
 	"amethyst/internal/block"
 	"amethyst/internal/block_cache"
 	"amethyst/internal/common"
+	"amethyst/internal/compression"
 	"amethyst/internal/filter"
+	"amethyst/internal/vfs"
 )
 
 // SSTable File Layout:
@@ -23,20 +28,78 @@ import (
 //                 │       ...      │
 //                 ├────────────────┤
 //                 │  Data Block N  │  up to block.BLOCK_SIZE entries
+// rangeDelOffset->├────────────────┤
+//                 │ Range Del Block│  range tombstones, then their CRC32C; absent if none
 // filterOffset -> ├────────────────┤
-//                 │  Filter Block  │  bloom filter
+//                 │  Filter Block  │  filter.Type, then the filter and its CRC32C; absent for filter.None
+//                 ├────────────────┤
+//                 │Index Partitions│  for a partitioned index, each followed by its CRC32C; absent otherwise
 //  indexOffset -> ├────────────────┤
-//                 │  Index Block   │  array of {firstKey, blockOffset} entries
+//                 │  Index Block   │  array of {firstKey, blockOffset} entries, then their CRC32C
+// propsOffset ->  ├────────────────┤
+//                 │Properties Block│  see Properties, then its CRC32C
 // footerOffset -> ├────────────────┤
-//                 │     Footer     │  footer: {filterOffset, indexOffset}
+//                 │     Footer     │  footer: {filterOffset, indexOffset, entryCount, rangeDelOffset, propertiesOffset, version, magic}
+//                 └────────────────┘
+//
+// The footer's FormatVersion says how the blocks are encoded. FormatFixed
+// tables have a legacy footer without the version and magic number, and
+// tables before FormatProperties have no properties block or offset.
+// Tables before FormatFilterPolicy always have a bloom filter, stored
+// without its type.
+//
+// Data Block Layout:
+//
+//                 ┌────────────────┐
+//                 │    Payload     │  a restart block, encoded by the block's codec
+//                 ├────────────────┤
+//                 │   Codec Type   │  1 byte: compression.Type
+//                 ├────────────────┤
+//                 │    Checksum    │  4 bytes: CRC32C of payload and codec type
 //                 └────────────────┘
 
+// checksumSize is the size of the CRC32C ending every block.
+const checksumSize = 4
+
+// blockTrailerSize is the number of bytes following each block's payload.
+const blockTrailerSize = 1 + checksumSize
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskChecksum scrambles a block's CRC before it is stored. The CRC of data
+// followed by its own unmasked CRC is the same for any data, which would
+// blind the whole-file checksum to everything but the footer.
+func maskChecksum(crc uint32) uint32 {
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// minCompressionSavings is the fraction of a block's size compression must
+// save for the block to be stored compressed; blocks that barely shrink
+// aren't worth decompressing on every read.
+const minCompressionSavings = 8 // 1/8 = 12.5%
+
 // WriteResult contains metadata from writing an SSTable.
 type WriteResult struct {
 	BytesWritten uint32
 	SmallestKey  []byte
 	LargestKey   []byte
 	EntryCount   uint32
+
+	// RangeDelCount is the number of range tombstones, which aren't counted
+	// in EntryCount. The key range spans them too, up to the end key of the
+	// last one even though that end is exclusive.
+	RangeDelCount uint32
+
+	// MaxSeq is the highest sequence number among entries and tombstones.
+	MaxSeq uint64
+
+	// TombstoneCount is the number of deletes among the entries.
+	TombstoneCount uint32
+
+	// KeySizes and ValueSizes are the distributions of key and value lengths;
+	// tombstones have no value and aren't counted in ValueSizes.
+	KeySizes   SizeHistogram
+	ValueSizes SizeHistogram
 }
 
 // WriteSSTable writes a complete SSTable from a stream of sorted entries.
@@ -44,27 +107,34 @@ type WriteResult struct {
 // entries: iterator providing sorted entries to write
 // sizeHint: expected number of entries (for bloom filter sizing)
 // fpr: bloom filter false positive rate (e.g., 0.01 for 1%)
+// prefix: if non-nil, key prefixes are added to the bloom filter as well
+// codec: compresses data blocks; nil stores them uncompressed
+// rangeDels: range tombstones, stored in a block of their own
 // Returns metadata about the written SSTable.
 func WriteSSTable(
 	w io.Writer,
 	entries common.EntryIterator,
 	sizeHint uint32,
 	fpr float64,
+	prefix common.PrefixExtractor,
+	codec compression.Codec,
+	rangeDels common.RangeTombstones,
 ) (*WriteResult, error) {
-	var offset uint32
-	var indexEntries []IndexEntry
-	var blockEntryCount int
-	var totalEntryCount uint32
-	var blockStartOffset uint32
-	var firstBlockKey []byte
-	var smallestKey []byte
-	var largestKeyRef []byte
-
-	// Create bloom filter
-	k, m := filter.OptimalBloomFilterParams(sizeHint, fpr)
-	bloomFilter := filter.NewBloomFilter(k, m)
-
-	// Stream data blocks
+	return WriteSSTableWithPolicy(w, entries, sizeHint, bloomPolicy(fpr), prefix, codec, rangeDels)
+}
+
+// WriteSSTableWithPolicy is like WriteSSTable but filters the table's keys
+// with policy rather than a bloom filter; nil builds no filter.
+func WriteSSTableWithPolicy(
+	w io.Writer,
+	entries common.EntryIterator,
+	sizeHint uint32,
+	policy filter.Policy,
+	prefix common.PrefixExtractor,
+	codec compression.Codec,
+	rangeDels common.RangeTombstones,
+) (*WriteResult, error) {
+	b := NewBuilderWithPolicy(w, sizeHint, policy, prefix, codec)
 	for {
 		entry, err := entries.Next()
 		if err != nil {
@@ -73,269 +143,896 @@ func WriteSSTable(
 		if entry == nil {
 			break // End of stream
 		}
-
-		if totalEntryCount == 0 {
-			smallestKey = bytes.Clone(entry.Key)
+		if err := b.Add(entry); err != nil {
+			return nil, err
 		}
-		largestKeyRef = entry.Key
+	}
+	return b.Finish(rangeDels)
+}
 
-		// Add to bloom filter
-		bloomFilter.Add(entry.Key)
+// bloomPolicy returns the bloom filter policy with a false positive rate of
+// fpr.
+func bloomPolicy(fpr float64) filter.Policy {
+	return filter.NewBloomPolicy(filter.BloomBitsPerKey(fpr))
+}
 
-		// Start new block: record offset and first key
-		if blockEntryCount == 0 {
-			blockStartOffset = offset
-			firstBlockKey = make([]byte, len(entry.Key))
-			copy(firstBlockKey, entry.Key)
-		}
+// Builder writes an SSTable one entry at a time, for callers that push
+// entries rather than hand over an iterator. Entries must be added in
+// sorted order without duplicates; the builder doesn't check.
+type Builder struct {
+	w      io.Writer
+	prefix common.PrefixExtractor
+	codec  compression.Codec
 
-		// Write entry to output
-		n, err := common.WriteEntry(w, entry)
-		if err != nil {
-			return nil, err
-		}
-		offset += uint32(n)
-		blockEntryCount++
-		totalEntryCount++
+	offset           uint32
+	indexEntries     []IndexEntry
+	blockBuf         bytes.Buffer  // data block entries, before FormatRestarts
+	blockBuilder     block.Builder // data block entries, from FormatRestarts
+	blockEntryCount  int
+	totalEntryCount  uint32
+	tombstoneCount   uint32
+	keySizes         SizeHistogram
+	valueSizes       SizeHistogram
+	blockStartOffset uint32
+	firstBlockKey    []byte
+	smallestKey      []byte
+	largestKey       []byte
+	minSeq           uint64
+	maxSeq           uint64
+	rawDataSize      uint64
+	filterPolicy     filter.Policy
+	filter           filter.Builder
+	version          FormatVersion
+	partitionSize    int
+}
 
-		// Create index entry when block is full
-		if blockEntryCount >= block.BLOCK_SIZE {
-			indexEntry := IndexEntry{
-				BlockOffset: blockStartOffset,
-				Key:         firstBlockKey,
-			}
-			indexEntries = append(indexEntries, indexEntry)
-			blockEntryCount = 0
-			firstBlockKey = nil
+// NewBuilder starts an SSTable written to w. The parameters are as for
+// WriteSSTable.
+func NewBuilder(w io.Writer, sizeHint uint32, fpr float64, prefix common.PrefixExtractor, codec compression.Codec) *Builder {
+	return NewBuilderWithPolicy(w, sizeHint, bloomPolicy(fpr), prefix, codec)
+}
+
+// NewBuilderWithPolicy starts an SSTable written to w. The parameters are
+// as for WriteSSTableWithPolicy.
+func NewBuilderWithPolicy(w io.Writer, sizeHint uint32, policy filter.Policy, prefix common.PrefixExtractor, codec compression.Codec) *Builder {
+	if policy == nil {
+		policy = filter.None
+	}
+	// Create filter, with room for a prefix per key
+	sizeHint = max(sizeHint, 1)
+	if prefix != nil {
+		sizeHint *= 2
+	}
+	return &Builder{
+		w:             w,
+		prefix:        prefix,
+		codec:         codec,
+		filterPolicy:  policy,
+		filter:        policy.NewBuilder(sizeHint),
+		version:       CurrentFormat,
+		partitionSize: INDEX_PARTITION_SIZE,
+	}
+}
+
+// Add appends entry, writing out a data block each time one fills up. The
+// builder keeps no reference to entry.
+func (b *Builder) Add(entry *common.Entry) error {
+	if b.totalEntryCount == 0 {
+		b.smallestKey = bytes.Clone(entry.Key)
+		b.minSeq = entry.Seq
+	}
+	b.largestKey = append(b.largestKey[:0], entry.Key...)
+	b.minSeq = min(b.minSeq, entry.Seq)
+	b.maxSeq = max(b.maxSeq, entry.Seq)
+	b.keySizes.Add(len(entry.Key))
+	if entry.Type == common.EntryTypeDelete {
+		b.tombstoneCount++
+	} else {
+		b.valueSizes.Add(len(entry.Value))
+	}
+
+	// Add to filter
+	b.filter.Add(entry.Key)
+	if b.prefix != nil {
+		if p, ok := b.prefix.Prefix(entry.Key); ok {
+			b.filter.Add(p)
 		}
 	}
 
+	// Start new block: record offset and first key
+	if b.blockEntryCount == 0 {
+		b.blockStartOffset = b.offset
+		b.firstBlockKey = bytes.Clone(entry.Key)
+	}
+
+	// Buffer entry until its block is complete
+	if b.version >= FormatRestarts {
+		b.blockBuilder.Add(entry)
+	} else if _, err := common.WriteEntryFormat(&b.blockBuf, entry, b.version.EntryFormat()); err != nil {
+		return err
+	}
+	b.blockEntryCount++
+	b.totalEntryCount++
+
+	// Write block and create index entry when block is full
+	if b.blockEntryCount >= block.BLOCK_SIZE {
+		return b.flushBlock()
+	}
+	return nil
+}
+
+// flushBlock writes the buffered data block and indexes it.
+func (b *Builder) flushBlock() error {
+	data := b.blockBuf.Bytes()
+	if b.version >= FormatRestarts {
+		data = b.blockBuilder.Finish()
+	}
+	n, err := writeBlock(b.w, data, b.codec)
+	if err != nil {
+		return err
+	}
+	b.offset += uint32(n)
+	b.rawDataSize += uint64(len(data))
+	b.blockBuf.Reset()
+
+	b.indexEntries = append(b.indexEntries, IndexEntry{
+		BlockOffset: b.blockStartOffset,
+		Key:         b.firstBlockKey,
+	})
+	b.blockEntryCount = 0
+	b.firstBlockKey = nil
+	return nil
+}
+
+// Finish writes the last partial block, rangeDels, the filter, the index,
+// and the footer, and returns metadata about the written SSTable.
+func (b *Builder) Finish(rangeDels common.RangeTombstones) (*WriteResult, error) {
 	// Handle last partial block
-	if blockEntryCount > 0 {
-		indexEntry := IndexEntry{
-			BlockOffset: blockStartOffset,
-			Key:         firstBlockKey,
+	if b.blockEntryCount > 0 {
+		if err := b.flushBlock(); err != nil {
+			return nil, err
 		}
-		indexEntries = append(indexEntries, indexEntry)
+	}
+	smallestKey, largestKey := b.smallestKey, b.largestKey
+	if b.totalEntryCount == 0 {
+		largestKey = nil
 	}
 
-	// Clone largest key now that iteration is complete
-	largestKey := bytes.Clone(largestKeyRef)
+	// Write range deletion block, widening the key range to cover it
+	rangeDelOffset := b.offset
+	var metaBuf bytes.Buffer
+	for i, t := range rangeDels {
+		if i == 0 && b.totalEntryCount == 0 {
+			b.minSeq = t.Seq
+		}
+		if smallestKey == nil || bytes.Compare(t.Key, smallestKey) < 0 {
+			smallestKey = bytes.Clone(t.Key)
+		}
+		if largestKey == nil || bytes.Compare(t.Value, largestKey) > 0 {
+			largestKey = bytes.Clone(t.Value)
+		}
+		b.minSeq = min(b.minSeq, t.Seq)
+		b.maxSeq = max(b.maxSeq, t.Seq)
+		if _, err := common.WriteEntryFormat(&metaBuf, t, b.version.EntryFormat()); err != nil {
+			return nil, err
+		}
+	}
+	if len(rangeDels) > 0 {
+		n, err := writeChecksummed(b.w, metaBuf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		b.offset += uint32(n)
+	}
 
-	// Write filter block
-	filterOffset := offset
-	n, err := filter.WriteBloomFilter(w, bloomFilter)
+	// Write filter block, led by its type from FormatFilterPolicy on
+	filterOffset := b.offset
+	filterData, err := b.filter.Finish()
 	if err != nil {
 		return nil, err
 	}
-	offset += uint32(n)
+	if b.version < FormatFilterPolicy && b.filterPolicy.Type() != filter.BloomType {
+		return nil, fmt.Errorf("sstable: format %d tables only store bloom filters", b.version)
+	}
+	if len(filterData) > 0 {
+		if b.version >= FormatFilterPolicy {
+			filterData = append([]byte{byte(b.filterPolicy.Type())}, filterData...)
+		}
+		n, err := writeChecksummed(b.w, filterData)
+		if err != nil {
+			return nil, err
+		}
+		b.offset += uint32(n)
+	}
 
 	// Write index block
-	indexOffset := offset
-	index := &Index{Entries: indexEntries}
-	n, err = WriteIndex(w, index)
+	indexOffset, err := b.writeIndex(rangeDelOffset)
 	if err != nil {
 		return nil, err
 	}
-	offset += uint32(n)
+
+	// Write properties block
+	propertiesOffset := b.offset
+	if b.version >= FormatProperties {
+		codec := compression.NoneType
+		if b.codec != nil {
+			codec = b.codec.Type()
+		}
+		metaBuf.Reset()
+		if _, err := WriteProperties(&metaBuf, &Properties{
+			EntryCount:     b.totalEntryCount,
+			TombstoneCount: b.tombstoneCount,
+			RangeDelCount:  uint32(len(rangeDels)),
+			RawDataSize:    b.rawDataSize,
+			DataSize:       uint64(rangeDelOffset),
+			MinSeq:         b.minSeq,
+			MaxSeq:         b.maxSeq,
+			CreatedAt:      time.Now().UnixNano(),
+			Codec:          codec,
+		}); err != nil {
+			return nil, err
+		}
+		n, err := writeChecksummed(b.w, metaBuf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		b.offset += uint32(n)
+	}
 
 	// Write footer
 	footer := &Footer{
-		FilterOffset: filterOffset,
-		IndexOffset:  indexOffset,
-		EntryCount:   totalEntryCount,
+		FilterOffset:     filterOffset,
+		IndexOffset:      indexOffset,
+		EntryCount:       b.totalEntryCount,
+		RangeDelOffset:   rangeDelOffset,
+		PropertiesOffset: propertiesOffset,
+		Version:          b.version,
 	}
-	n, err = WriteFooter(w, footer)
+	n, err := WriteFooter(b.w, footer)
 	if err != nil {
 		return nil, err
 	}
-	offset += uint32(n)
+	b.offset += uint32(n)
 
 	return &WriteResult{
-		BytesWritten: offset,
+		BytesWritten: b.offset,
 		SmallestKey:  smallestKey,
 		LargestKey:   largestKey,
-		EntryCount:   totalEntryCount,
+		EntryCount:   b.totalEntryCount,
+
+		RangeDelCount: uint32(len(rangeDels)),
+		MaxSeq:        b.maxSeq,
+
+		TombstoneCount: b.tombstoneCount,
+		KeySizes:       b.keySizes,
+		ValueSizes:     b.valueSizes,
 	}, nil
 }
 
+// writeIndex writes the index of the data blocks, which end at dataEnd, and
+// returns the offset of the index block. An index of more than
+// partitionSize entries is written as partitions ahead of a top-level index
+// block locating them.
+func (b *Builder) writeIndex(dataEnd uint32) (uint32, error) {
+	var buf bytes.Buffer
+	switch {
+	case b.version < FormatPartitionedIndex:
+		if _, err := WriteIndex(&buf, &Index{Entries: b.indexEntries}); err != nil {
+			return 0, err
+		}
+	case len(b.indexEntries) <= b.partitionSize:
+		buf.WriteByte(indexFlat)
+		if _, err := WriteIndex(&buf, &Index{Entries: b.indexEntries}); err != nil {
+			return 0, err
+		}
+	default:
+		var top Index
+		for start := 0; start < len(b.indexEntries); start += b.partitionSize {
+			end := min(start+b.partitionSize, len(b.indexEntries))
+			partition := &IndexPartition{Index: Index{Entries: b.indexEntries[start:end]}, DataEnd: dataEnd}
+			if end < len(b.indexEntries) {
+				partition.DataEnd = b.indexEntries[end].BlockOffset
+			}
+			top.Entries = append(top.Entries, IndexEntry{BlockOffset: b.offset, Key: b.indexEntries[start].Key})
+
+			buf.Reset()
+			if _, err := WriteIndexPartition(&buf, partition); err != nil {
+				return 0, err
+			}
+			n, err := writeChecksummed(b.w, buf.Bytes())
+			if err != nil {
+				return 0, err
+			}
+			b.offset += uint32(n)
+		}
+		buf.Reset()
+		buf.WriteByte(indexPartitioned)
+		if _, err := WriteIndex(&buf, &top); err != nil {
+			return 0, err
+		}
+	}
+
+	indexOffset := b.offset
+	n, err := writeChecksummed(b.w, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	b.offset += uint32(n)
+	return indexOffset, nil
+}
+
+// writeBlock writes one data block, compressed with codec if that saves
+// enough space, followed by the type of codec used and the checksum.
+func writeBlock(w io.Writer, data []byte, codec compression.Codec) (int, error) {
+	payload, codecType := data, compression.NoneType
+	if codec != nil && codec.Type() != compression.NoneType {
+		compressed, err := codec.Encode(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to compress block with %s: %w", codec.Name(), err)
+		}
+		if len(compressed) <= len(data)-len(data)/minCompressionSavings {
+			payload, codecType = compressed, codec.Type()
+		}
+	}
+
+	return writeChecksummed(w, append(payload[:len(payload):len(payload)], byte(codecType)))
+}
+
+// writeChecksummed writes data followed by its CRC32C.
+func writeChecksummed(w io.Writer, data []byte) (int, error) {
+	n, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	m, err := common.WriteUint32(w, maskChecksum(crc32.Checksum(data, castagnoli)))
+	return n + m, err
+}
+
+// verifyChecksum checks the CRC32C ending raw, a block read from disk, and
+// returns the block without it. what names the block in errors.
+func verifyChecksum(raw []byte, what string) ([]byte, error) {
+	if len(raw) < checksumSize {
+		return nil, fmt.Errorf("%w: %s is truncated", ErrCorruption, what)
+	}
+	data, stored := raw[:len(raw)-checksumSize], binary.LittleEndian.Uint32(raw[len(raw)-checksumSize:])
+	if actual := maskChecksum(crc32.Checksum(data, castagnoli)); actual != stored {
+		return nil, fmt.Errorf("%w: %s checksum is %08x, expected %08x", ErrCorruption, what, actual, stored)
+	}
+	return data, nil
+}
+
 // sstableImpl provides random access to entries in an SSTable file.
 type sstableImpl struct {
-	file       *os.File
+	fs         vfs.FS
+	mu         sync.RWMutex // guards file and mapped against Close during a read
+	file       vfs.File
+	mapped     []byte // the whole file, if memory-mapped
 	path       string // File path (stored for error messages)
 	fileNo     common.FileNo
 	footer     *Footer
-	filter     filter.Filter
-	index      *Index
+	filter     filter.Reader
+	properties *Properties // nil before FormatProperties
+	index      *Index      // nil if the index is partitioned
+	partitions *Index      // top level of a partitioned index; nil if it isn't
+	rangeDels  common.RangeTombstones
 	blockCache block_cache.BlockCache
+	logger     common.Logger
 }
 
 var _ SSTable = (*sstableImpl)(nil)
 
-// loadSSTableMetadata reads and parses the footer, filter, and index from an open SSTable file.
-func loadSSTableMetadata(f *os.File) (*Footer, filter.Filter, *Index, error) {
+// loadSSTableMetadata reads and parses the footer, properties, filter, and
+// index, or the top level of a partitioned index, from an open SSTable file
+// into s.
+func loadSSTableMetadata(f vfs.File, s *sstableImpl) error {
 	// Get file size
 	stat, err := f.Stat()
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
 	fileSize := stat.Size()
 
-	if fileSize < FOOTER_SIZE {
-		return nil, nil, nil, io.ErrUnexpectedEOF
-	}
-
 	// Read footer from end of file
-	footerOffset := fileSize - FOOTER_SIZE
-	footerData := make([]byte, FOOTER_SIZE)
-	if _, err := f.ReadAt(footerData, footerOffset); err != nil {
-		return nil, nil, nil, err
-	}
-
-	footer, err := ReadFooter(bytes.NewReader(footerData))
+	footer, err := ReadFooterAt(f, fileSize)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
+	footerOffset := fileSize - int64(footer.Size())
 
-	// Read filter block
-	filterSize := int64(footer.IndexOffset) - int64(footer.FilterOffset)
-	var bloomFilter filter.Filter
-	if filterSize > 0 {
-		filterData := make([]byte, filterSize)
-		if _, err := f.ReadAt(filterData, int64(footer.FilterOffset)); err != nil {
-			return nil, nil, nil, err
+	// Read properties block
+	indexEnd := footerOffset
+	var properties *Properties
+	if footer.Version >= FormatProperties {
+		indexEnd = int64(footer.PropertiesOffset)
+		if footerOffset-indexEnd < checksumSize {
+			return io.ErrUnexpectedEOF
+		}
+		rawProperties := make([]byte, footerOffset-indexEnd)
+		if _, err := f.ReadAt(rawProperties, indexEnd); err != nil {
+			return err
 		}
-		bloomFilter, err = filter.ReadBloomFilter(bytes.NewReader(filterData))
+		propertiesData, err := verifyChecksum(rawProperties, "properties block")
 		if err != nil {
-			return nil, nil, nil, err
+			return err
+		}
+		if properties, err = ReadProperties(propertiesData); err != nil {
+			return err
 		}
 	}
 
 	// Read index block
-	indexSize := footerOffset - int64(footer.IndexOffset)
+	indexSize := indexEnd - int64(footer.IndexOffset)
 	if indexSize <= 0 {
-		return nil, nil, nil, io.ErrUnexpectedEOF
+		return io.ErrUnexpectedEOF
 	}
 
-	indexData := make([]byte, indexSize)
-	if _, err := f.ReadAt(indexData, int64(footer.IndexOffset)); err != nil {
-		return nil, nil, nil, err
+	rawIndex := make([]byte, indexSize)
+	if _, err := f.ReadAt(rawIndex, int64(footer.IndexOffset)); err != nil {
+		return err
+	}
+	indexData, err := verifyChecksum(rawIndex, "index block")
+	if err != nil {
+		return err
 	}
 
-	index, err := ReadIndex(bytes.NewReader(indexData))
+	index, partitions, err := readIndexBlock(indexData, footer.Version)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
 
-	return footer, bloomFilter, index, nil
+	// Read filter block, which ends where the index, or its first
+	// partition, begins
+	filterEnd := footer.IndexOffset
+	if partitions != nil && len(partitions.Entries) > 0 {
+		filterEnd = partitions.Entries[0].BlockOffset
+	}
+	filterSize := int64(filterEnd) - int64(footer.FilterOffset)
+	var tableFilter filter.Reader
+	if filterSize > 0 {
+		rawFilter := make([]byte, filterSize)
+		if _, err := f.ReadAt(rawFilter, int64(footer.FilterOffset)); err != nil {
+			return err
+		}
+		filterData, err := verifyChecksum(rawFilter, "filter block")
+		if err != nil {
+			return err
+		}
+		if tableFilter, err = readFilter(filterData, footer.Version, s.logger); err != nil {
+			return err
+		}
+	}
+
+	s.footer, s.properties, s.filter, s.index, s.partitions = footer, properties, tableFilter, index, partitions
+	return nil
 }
 
-// OpenSSTable opens an SSTable file and loads its footer and index into memory.
+// readFilter parses the filter block of a table of the given version. A
+// filter of a type that isn't registered is skipped, with a warning to
+// logger, so the table can still be read without it.
+func readFilter(data []byte, version FormatVersion, logger common.Logger) (filter.Reader, error) {
+	if version < FormatFilterPolicy {
+		return filter.ReadBloomFilter(bytes.NewReader(data))
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: filter block is empty", ErrCorruption)
+	}
+	policy, err := filter.Lookup(filter.Type(data[0]))
+	if errors.Is(err, filter.ErrUnknownPolicy) {
+		logger.Log(common.LevelWarn, "sstable: reading without filter", "err", err)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return policy.Read(data[1:])
+}
+
+// OpenSSTable opens an SSTable file and loads its footer and index into
+// memory. Only the top level of a partitioned index is loaded; its
+// partitions are read as lookups need them.
 func OpenSSTable(
+	fsys vfs.FS,
 	path string,
 	fileNo common.FileNo,
 	blockCache block_cache.BlockCache,
 ) (*sstableImpl, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open %s: %w", path, err)
-	}
+	return OpenSSTableWithOptions(fsys, path, fileNo, blockCache, OpenOptions{})
+}
 
-	footer, filter, index, err := loadSSTableMetadata(f)
+// OpenSSTableWithOptions is like OpenSSTable but opens the table as opts
+// specify.
+func OpenSSTableWithOptions(
+	fsys vfs.FS,
+	path string,
+	fileNo common.FileNo,
+	blockCache block_cache.BlockCache,
+	opts OpenOptions,
+) (*sstableImpl, error) {
+	f, err := fsys.Open(path)
 	if err != nil {
-		f.Close()
-		return nil, fmt.Errorf("failed to load metadata from %s: %w", path, err)
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
 	}
 
-	return &sstableImpl{
+	s := &sstableImpl{
+		fs:         fsys,
 		file:       f,
 		path:       path,
 		fileNo:     fileNo,
-		footer:     footer,
-		filter:     filter,
-		index:      index,
 		blockCache: blockCache,
-	}, nil
+		logger:     opts.logger(),
+	}
+	if err := loadSSTableMetadata(f, s); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load metadata from %s: %w", path, err)
+	}
+	if s.rangeDels, err = loadRangeDels(f, s.footer); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load range deletions from %s: %w", path, err)
+	}
+	if opts.Mmap {
+		s.mmap()
+	}
+	return s, nil
+}
+
+// mmap maps the table's file for reads, leaving them to go through the file
+// where that isn't possible.
+func (s *sstableImpl) mmap() {
+	stat, err := s.file.Stat()
+	if err == nil {
+		s.mapped, err = vfs.Mmap(s.file, stat.Size())
+	}
+	if err != nil && !errors.Is(err, vfs.ErrUnsupported) {
+		s.logger.Log(common.LevelWarn, "sstable: failed to mmap, reading through the file", "path", s.path, "err", err)
+	}
+}
+
+// loadRangeDels reads and verifies the range deletion block, if any.
+func loadRangeDels(f vfs.File, footer *Footer) (common.RangeTombstones, error) {
+	size := int64(footer.FilterOffset) - int64(footer.RangeDelOffset)
+	if size <= 0 {
+		return nil, nil
+	}
+	raw := make([]byte, size)
+	if _, err := f.ReadAt(raw, int64(footer.RangeDelOffset)); err != nil {
+		return nil, err
+	}
+	data, err := verifyChecksum(raw, "range deletion block")
+	if err != nil {
+		return nil, err
+	}
+
+	var rangeDels common.RangeTombstones
+	r := bytes.NewReader(data)
+	for {
+		t, err := common.ReadEntryFormat(r, footer.Version.EntryFormat())
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return rangeDels, nil
+		}
+		rangeDels = append(rangeDels, t)
+	}
+}
+
+// RangeTombstones returns the table's range tombstones, held in memory since
+// the table was opened.
+func (s *sstableImpl) RangeTombstones() common.RangeTombstones {
+	return s.rangeDels
+}
+
+// MayContainPrefix reports whether any key with the given prefix might be in
+// the table. It is only meaningful if the table was written with the
+// extractor that produced prefix.
+func (s *sstableImpl) MayContainPrefix(prefix []byte) bool {
+	return s.filter == nil || s.filter.MayContain(prefix)
 }
 
 // Get looks up the entry for the given key.
 // Returns ErrNotFound if the key does not exist.
 func (s *sstableImpl) Get(key []byte) (*common.Entry, error) {
+	return s.get(key, DefaultReadOptions, false)
+}
+
+// GetWithOptions looks up the entry for the given key, reading as opts
+// specify.
+func (s *sstableImpl) GetWithOptions(key []byte, opts ReadOptions) (*common.Entry, error) {
+	return s.get(key, opts, false)
+}
+
+// GetCached looks up the entry for the given key without reading from disk.
+// Returns ErrNotCached if the block that might hold the key isn't cached.
+func (s *sstableImpl) GetCached(key []byte) (*common.Entry, error) {
+	return s.get(key, DefaultReadOptions, true)
+}
+
+func (s *sstableImpl) get(key []byte, opts ReadOptions, cacheOnly bool) (*common.Entry, error) {
 	// Check bloom filter first to skip disk read if key definitely not present
 	if s.filter != nil && !s.filter.MayContain(key) {
-		common.Logf("      filter rejected key\n")
+		if s.logger.Enabled(common.LevelDebug) {
+			s.logger.Log(common.LevelDebug, "sstable: filter rejected key", "path", s.path, "key", key)
+		}
 		return nil, ErrNotFound
 	}
 
-	// Find which block might contain this key
-	blockOffset, found := s.index.FindBlockOffset(key)
+	h, err := s.findBlock(key, opts, cacheOnly)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := s.loadBlock(h, opts, cacheOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	// Search within the block
+	entry, found := blk.Get(key)
 	if !found {
 		return nil, ErrNotFound
 	}
+	return entry, nil
+}
 
-	// Find the block index in the index entries
-	blockIdx := -1
-	for i, entry := range s.index.Entries {
-		if entry.BlockOffset == blockOffset {
-			blockIdx = i
-			break
+// MultiGet looks up keys, which must be sorted, loading each block they fall
+// in once. The result holds each key's entry, or nil where it isn't found.
+func (s *sstableImpl) MultiGet(keys [][]byte, opts ReadOptions) ([]*common.Entry, error) {
+	entries := make([]*common.Entry, len(keys))
+	var blk block.Block
+	var loaded blockHandle
+	for i, key := range keys {
+		if s.filter != nil && !s.filter.MayContain(key) {
+			continue
+		}
+		h, err := s.findBlock(key, opts, false)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blk == nil || h != loaded {
+			if blk, err = s.loadBlock(h, opts, false); err != nil {
+				return nil, err
+			}
+			loaded = h
+		}
+		if entry, found := blk.Get(key); found {
+			entries[i] = entry
 		}
 	}
+	return entries, nil
+}
+
+// blockHandle locates a block in the table's file.
+type blockHandle struct {
+	offset uint32
+	end    uint32
+}
 
-	if blockIdx == -1 {
-		return nil, io.ErrUnexpectedEOF
+// findBlock returns the only data block that may hold key, or ErrNotFound if
+// key sorts before the table's first key. For a partitioned index it loads
+// the partition covering key as loadPartition does.
+func (s *sstableImpl) findBlock(key []byte, opts ReadOptions, cacheOnly bool) (blockHandle, error) {
+	if s.partitions == nil {
+		i, found := s.index.search(key)
+		if !found {
+			return blockHandle{}, ErrNotFound
+		}
+		return s.index.handle(i, s.footer.RangeDelOffset), nil
 	}
 
-	// Try to get block from cache
-	var blk block.Block
-	blockNo := common.BlockNo(blockIdx)
+	p, found := s.partitions.search(key)
+	if !found {
+		return blockHandle{}, ErrNotFound
+	}
+	partition, err := s.loadPartition(p, opts, cacheOnly)
+	if err != nil {
+		return blockHandle{}, err
+	}
+	i, found := partition.search(key)
+	if !found {
+		return blockHandle{}, ErrNotFound
+	}
+	return partition.handle(i, partition.DataEnd), nil
+}
 
+// loadPartition returns index partition p, from the block cache if it is
+// there and otherwise from disk, or ErrNotCached if cacheOnly. Partitions
+// are always verified, since a corrupt one would misdirect every lookup
+// through it.
+func (s *sstableImpl) loadPartition(p int, opts ReadOptions, cacheOnly bool) (*IndexPartition, error) {
+	h := s.partitions.handle(p, s.footer.IndexOffset)
+	blockNo := common.BlockNo(h.offset)
 	if s.blockCache != nil {
-		if cachedBlock, ok := s.blockCache.Get(s.fileNo, blockNo); ok {
-			blk = cachedBlock
+		if cached, ok := s.blockCache.Get(s.fileNo, blockNo); ok {
+			if partition, ok := cached.(*IndexPartition); ok {
+				return partition, nil
+			}
 		}
 	}
+	if cacheOnly {
+		return nil, ErrNotCached
+	}
 
-	// Cache miss or no cache - read from disk
-	if blk == nil {
-		// Determine block size (read until next block or filter block)
-		var blockEnd uint32
-		if blockIdx+1 < len(s.index.Entries) {
-			blockEnd = s.index.Entries[blockIdx+1].BlockOffset
-		} else {
-			blockEnd = s.footer.FilterOffset
+	var partition *IndexPartition
+	err := s.withFile(func(f vfs.File) error {
+		raw, err := s.readRaw(f, h, "index partition")
+		if err != nil {
+			return err
 		}
+		data, err := verifyChecksum(raw, fmt.Sprintf("index partition at %d of %s", h.offset, s.path))
+		if err != nil {
+			return err
+		}
+		// Parsing copies the keys, so the partition doesn't alias a mapping
+		if partition, err = ReadIndexPartition(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to parse index partition at %d from %s: %w", h.offset, s.path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.blockCache != nil && opts.FillCache {
+		s.blockCache.Put(s.fileNo, blockNo, partition)
+	}
+	return partition, nil
+}
 
-		blockSize := blockEnd - blockOffset
-		blockData := make([]byte, blockSize)
-		if _, err := s.file.ReadAt(blockData, int64(blockOffset)); err != nil {
-			return nil, fmt.Errorf("failed to read block %d at offset %d from %s: %w", blockIdx, blockOffset, s.path, err)
+// loadBlock returns data block h parsed, from the block cache if it is there
+// and otherwise from disk, or ErrNotCached if cacheOnly. Blocks are cached
+// by offset.
+func (s *sstableImpl) loadBlock(h blockHandle, opts ReadOptions, cacheOnly bool) (block.Block, error) {
+	blockNo := common.BlockNo(h.offset)
+	if s.blockCache != nil {
+		if cached, ok := s.blockCache.Get(s.fileNo, blockNo); ok {
+			if blk, ok := cached.(block.Block); ok {
+				return blk, nil
+			}
 		}
+	}
+	if cacheOnly {
+		return nil, ErrNotCached
+	}
 
-		// Parse block
-		var err error
-		blk, err = block.NewBlock(blockData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse block %d from %s: %w", blockIdx, s.path, err)
+	var blockData []byte
+	err := s.withFile(func(f vfs.File) (err error) {
+		blockData, err = s.readBlock(f, h, opts.VerifyChecksums)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	blk, err := s.newBlock(blockData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse block at %d from %s: %w", h.offset, s.path, err)
+	}
+	if s.blockCache != nil && opts.FillCache {
+		s.blockCache.Put(s.fileNo, blockNo, blk)
+	}
+	return blk, nil
+}
+
+// withFile calls fn with the table's file handle. Once the table is closed,
+// e.g. evicted from the table cache while a lookup was in flight, fn gets a
+// handle of its own instead.
+func (s *sstableImpl) withFile(fn func(f vfs.File) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.file != nil {
+		return fn(s.file)
+	}
+	f, err := s.fs.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// readRaw reads block h, trailer included, from f, or slices it from the
+// table's mapping if it has one. The caller must hold s.mu and be done with
+// the block before releasing it.
+func (s *sstableImpl) readRaw(f io.ReaderAt, h blockHandle, what string) ([]byte, error) {
+	if h.end < h.offset+checksumSize {
+		return nil, fmt.Errorf("%s at %d of %s is truncated: %w", what, h.offset, s.path, io.ErrUnexpectedEOF)
+	}
+	if s.mapped != nil {
+		if int(h.end) > len(s.mapped) {
+			return nil, fmt.Errorf("failed to read %s at offset %d from %s: %w", what, h.offset, s.path, io.ErrUnexpectedEOF)
 		}
+		return s.mapped[h.offset:h.end], nil
+	}
+	raw := make([]byte, h.end-h.offset)
+	if _, err := f.ReadAt(raw, int64(h.offset)); err != nil {
+		return nil, fmt.Errorf("failed to read %s at offset %d from %s: %w", what, h.offset, s.path, err)
+	}
+	return raw, nil
+}
+
+// readBlock reads data block h as readRaw does and returns its decompressed
+// entries, checking the block's checksum first if verify is set. The entries
+// never alias the table's mapping.
+func (s *sstableImpl) readBlock(f io.ReaderAt, h blockHandle, verify bool) ([]byte, error) {
+	if h.end < h.offset+blockTrailerSize {
+		return nil, fmt.Errorf("block at %d of %s is truncated: %w", h.offset, s.path, io.ErrUnexpectedEOF)
+	}
+	raw, err := s.readRaw(f, h, "block")
+	if err != nil {
+		return nil, err
+	}
 
-		// Cache the parsed block if cache is available
-		if s.blockCache != nil {
-			s.blockCache.Put(s.fileNo, blockNo, blk)
+	contents := raw[:len(raw)-checksumSize]
+	if verify {
+		if contents, err = verifyChecksum(raw, fmt.Sprintf("block at %d of %s", h.offset, s.path)); err != nil {
+			return nil, err
 		}
 	}
+	payload, codecType := contents[:len(contents)-1], compression.Type(contents[len(contents)-1])
+	data, err := compression.Decode(codecType, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress block at %d from %s: %w", h.offset, s.path, err)
+	}
+	if s.mapped != nil && codecType == compression.NoneType {
+		// Uncompressed blocks are decoded in place, and outlive the mapping
+		// once cached
+		data = bytes.Clone(data)
+	}
+	return data, nil
+}
 
-	// Search within the block
-	entry, found := blk.Get(key)
-	if !found {
-		return nil, ErrNotFound
+// newBlock parses data block data for lookups, as the table's format
+// requires.
+func (s *sstableImpl) newBlock(data []byte) (block.Block, error) {
+	if s.footer.Version >= FormatRestarts {
+		return block.NewRestartBlock(data)
 	}
-	return entry, nil
+	return block.NewBlock(data, s.footer.Version.EntryFormat())
+}
+
+// blockEntries returns the entries of data block data in order, each
+// decoded afresh for the caller.
+func (s *sstableImpl) blockEntries(data []byte) (common.EntryIterator, error) {
+	if s.footer.Version >= FormatRestarts {
+		return block.NewRestartIterator(data)
+	}
+	return &plainBlockIterator{reader: bytes.NewReader(data), format: s.footer.Version.EntryFormat()}, nil
+}
+
+// plainBlockIterator reads the entries of a data block written before
+// FormatRestarts.
+type plainBlockIterator struct {
+	reader *bytes.Reader
+	format common.EntryFormat
+}
+
+func (it *plainBlockIterator) Next() (*common.Entry, error) {
+	return common.ReadEntryFormat(it.reader, it.format)
 }
 
-// GetIndex returns the index entries (first key of each block).
+// GetIndex returns the index entries (first key of each block). For a
+// partitioned index it reads every partition; one that can't be read is
+// logged and left out.
 func (s *sstableImpl) GetIndex() *Index {
-	return s.index
+	if s.partitions == nil {
+		return s.index
+	}
+	index := &Index{}
+	for p := range s.partitions.Entries {
+		partition, err := s.loadPartition(p, ReadOptions{VerifyChecksums: true}, false)
+		if err != nil {
+			s.logger.Log(common.LevelWarn, "sstable: failed to load index partition", "path", s.path, "partition", p, "err", err)
+			continue
+		}
+		index.Entries = append(index.Entries, partition.Entries...)
+	}
+	return index
+}
+
+// Properties returns the properties recorded when the table was written, or
+// nil if its format predates them.
+func (s *sstableImpl) Properties() *Properties {
+	return s.properties
 }
 
 // Len returns the total number of entries in the SSTable.
@@ -344,36 +1041,75 @@ func (s *sstableImpl) Len() int {
 	return int(s.footer.EntryCount)
 }
 
-// Close releases the underlying file handle.
+// Close releases the underlying file handle and any mapping of the file.
+// Lookups still work afterwards, opening the file for each block they read.
 func (s *sstableImpl) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.file == nil {
 		return nil
 	}
-	err := s.file.Close()
+	var err error
+	if s.mapped != nil {
+		err = vfs.Munmap(s.mapped)
+		s.mapped = nil
+	}
+	err = errors.Join(err, s.file.Close())
 	s.file = nil
 	return err
 }
 
-// Iterator returns an iterator that sequentially scans all entries in the SSTable.
+// Iterator returns an iterator that sequentially scans all entries in the
+// SSTable. It verifies every block but leaves the block cache alone, so
+// compactions and other full-table reads don't displace cached blocks, and
+// reads DefaultReadaheadSize bytes at a time.
 func (s *sstableImpl) Iterator() common.EntryIterator {
+	return s.IteratorWithOptions(ReadOptions{VerifyChecksums: true, ReadaheadSize: DefaultReadaheadSize})
+}
+
+// IteratorWithOptions is like Iterator but reads blocks as opts specify.
+// Blocks are read from disk unless PinBlocks is set and they are cached;
+// with FillCache they are also parsed and added to the block cache for
+// later lookups.
+func (s *sstableImpl) IteratorWithOptions(opts ReadOptions) common.EntryIterator {
 	// Open a separate file handle for iteration
-	f, err := os.Open(s.path)
+	f, err := s.fs.Open(s.path)
 	if err != nil {
 		// Return an iterator that immediately fails
 		return &sstableIterator{err: err}
 	}
 
-	return &sstableIterator{
+	it := &sstableIterator{
+		table:  s,
 		file:   f,
-		reader: bufio.NewReader(io.LimitReader(f, int64(s.footer.FilterOffset))),
+		opts:   opts,
+		reader: f,
+	}
+	if opts.ReadaheadSize > 0 {
+		// Only a hint; the readahead buffer works without it
+		vfs.AdviseSequential(f)
+		it.reader = &readaheadReader{f: f, size: opts.ReadaheadSize, limit: int64(s.footer.RangeDelOffset)}
 	}
+	return it
 }
 
-// sstableIterator provides sequential access to all entries in an SSTable.
+// sstableIterator provides sequential access to all entries in an SSTable,
+// decoding one data block at a time.
 type sstableIterator struct {
-	file   *os.File
-	reader *bufio.Reader
-	err    error // Initialization error
+	table         *sstableImpl
+	file          vfs.File
+	opts          ReadOptions
+	reader        io.ReaderAt          // file, through the readahead buffer if there is one
+	index         *Index               // Index, or current partition, of the blocks being read
+	dataEnd       uint32               // End of the last block in index
+	nextBlock     int                  // Position in index of the next block to load
+	nextPartition int                  // Next partition to load, for a partitioned index
+	entries       common.EntryIterator // Entries of the current block
+	pinned        bool                 // Whether the current block is pinned in the block cache
+	pinnedBlock   common.BlockNo       // Block to unpin when the iterator moves on
+	pending       *common.Entry        // Entry Seek stopped at, for Next to return
+	err           error                // Initialization error
 }
 
 var _ common.EntryIterator = (*sstableIterator)(nil)
@@ -385,34 +1121,219 @@ func (it *sstableIterator) Next() (*common.Entry, error) {
 		return nil, it.err
 	}
 
+	if entry := it.pending; entry != nil {
+		it.pending = nil
+		return entry, nil
+	}
 	if it.file == nil {
 		return nil, nil // Already closed
 	}
 
-	// Read next entry sequentially
-	entry, err := common.ReadEntry(it.reader)
-	if err != nil {
-		// EOF or read error
-		it.Close()
-		return nil, err
+	upper := it.opts.UpperBound
+	for {
+		// Load the next block once the current one is exhausted
+		if it.entries == nil {
+			if err := it.advanceIndex(); err != nil {
+				it.Close()
+				return nil, err
+			}
+			if it.index == nil || it.nextBlock >= len(it.index.Entries) {
+				// End of entries
+				it.Close()
+				return nil, nil
+			}
+			if upper != nil && bytes.Compare(it.index.Entries[it.nextBlock].Key, upper) >= 0 {
+				// The rest of the table is past the upper bound
+				it.Close()
+				return nil, nil
+			}
+			if err := it.loadBlock(it.index.handle(it.nextBlock, it.dataEnd)); err != nil {
+				it.Close()
+				return nil, err
+			}
+			it.nextBlock++
+		}
+
+		entry, err := it.entries.Next()
+		if err != nil {
+			// Read error
+			it.Close()
+			return nil, err
+		}
+		if entry != nil {
+			if upper != nil && bytes.Compare(entry.Key, upper) >= 0 {
+				it.Close()
+				return nil, nil
+			}
+			return entry, nil
+		}
+		it.entries = nil
 	}
+}
 
-	if entry == nil {
-		// End of entries
+// Seek positions the iterator so that Next returns the first remaining
+// entry whose key is at least key. It jumps to the block that may hold key
+// using the index, so the blocks before it aren't read.
+func (it *sstableIterator) Seek(key []byte) error {
+	if it.err != nil {
+		return it.err
+	}
+	if it.pending != nil {
+		if bytes.Compare(it.pending.Key, key) >= 0 {
+			return nil
+		}
+		it.pending = nil
+	}
+	if it.file == nil {
+		return nil
+	}
+	if err := it.seekBlock(key); err != nil {
 		it.Close()
-		return nil, nil
+		return err
 	}
 
-	return entry, nil
+	// Read past the earlier entries of the block reached
+	for {
+		entry, err := it.Next()
+		if err != nil || entry == nil {
+			return err
+		}
+		if bytes.Compare(entry.Key, key) >= 0 {
+			it.pending = entry
+			return nil
+		}
+	}
+}
+
+// seekBlock moves the iterator to the start of the data block that may hold
+// key, unless it is already at or past that block.
+func (it *sstableIterator) seekBlock(key []byte) error {
+	t := it.table
+	if t.partitions != nil {
+		p, _ := t.partitions.search(key)
+		if p < it.nextPartition-1 {
+			return nil
+		}
+		if p >= it.nextPartition {
+			it.unpin()
+			it.index, it.nextPartition, it.entries = nil, p, nil
+		}
+	}
+	if it.entries == nil {
+		if err := it.advanceIndex(); err != nil {
+			return err
+		}
+	}
+	if it.index == nil {
+		return nil
+	}
+	if i, _ := it.index.search(key); i >= it.nextBlock {
+		it.unpin()
+		it.nextBlock, it.entries = i, nil
+	}
+	return nil
+}
+
+// loadBlock positions the iterator at the start of data block h, releasing
+// any pin on the block it was on.
+func (it *sstableIterator) loadBlock(h blockHandle) error {
+	it.unpin()
+	t, blockNo := it.table, common.BlockNo(h.offset)
+	pin := it.opts.PinBlocks && t.blockCache != nil
+	if pin {
+		// The block may be evicted between Get and Pin, in which case it is
+		// read from disk like any other miss
+		if cached, ok := t.blockCache.Get(t.fileNo, blockNo); ok {
+			if blk, ok := cached.(block.Block); ok && t.blockCache.Pin(t.fileNo, blockNo) {
+				it.entries, it.pinned, it.pinnedBlock = blk.Iterator(), true, blockNo
+				return nil
+			}
+		}
+	}
+
+	t.mu.RLock()
+	data, err := t.readBlock(it.reader, h, it.opts.VerifyChecksums)
+	t.mu.RUnlock()
+	if err == nil {
+		it.entries, err = t.blockEntries(data)
+	}
+	if err != nil {
+		return err
+	}
+	if it.opts.FillCache && t.blockCache != nil {
+		if blk, err := t.newBlock(data); err == nil {
+			t.blockCache.Put(t.fileNo, blockNo, blk)
+			if pin && t.blockCache.Pin(t.fileNo, blockNo) {
+				it.pinned, it.pinnedBlock = true, blockNo
+			}
+		}
+	}
+	return nil
+}
+
+// unpin releases the iterator's pin on its current block, if it has one.
+func (it *sstableIterator) unpin() {
+	if it.pinned {
+		it.table.blockCache.Unpin(it.table.fileNo, it.pinnedBlock)
+		it.pinned = false
+	}
+}
+
+// advanceIndex moves to the table's index, or to its next partition once
+// the blocks of the current one are read.
+func (it *sstableIterator) advanceIndex() error {
+	t := it.table
+	if t.partitions == nil {
+		it.index, it.dataEnd = t.index, t.footer.RangeDelOffset
+		return nil
+	}
+	for (it.index == nil || it.nextBlock >= len(it.index.Entries)) && it.nextPartition < len(t.partitions.Entries) {
+		partition, err := t.loadPartition(it.nextPartition, it.opts, false)
+		if err != nil {
+			return err
+		}
+		it.index, it.dataEnd, it.nextBlock = &partition.Index, partition.DataEnd, 0
+		it.nextPartition++
+	}
+	return nil
+}
+
+// readaheadReader serves reads of the data blocks from a buffer it fills
+// size bytes at a time, so a scan reads the file in a few large sequential
+// reads rather than one per block.
+type readaheadReader struct {
+	f     vfs.File
+	size  int
+	limit int64  // end of the data blocks; nothing past it is read ahead
+	buf   []byte // file contents from off
+	off   int64
+}
+
+func (r *readaheadReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < r.off || off+int64(len(p)) > r.off+int64(len(r.buf)) {
+		n := max(int64(r.size), int64(len(p)))
+		n = min(n, max(r.limit-off, int64(len(p))))
+		if int64(cap(r.buf)) < n {
+			r.buf = make([]byte, n)
+		}
+		r.buf = r.buf[:n]
+		m, err := r.f.ReadAt(r.buf, off)
+		r.buf, r.off = r.buf[:m], off
+		if m < len(p) {
+			return copy(p, r.buf), err
+		}
+	}
+	return copy(p, r.buf[off-r.off:]), nil
 }
 
-// Close releases the underlying file handle.
+// Close releases the underlying file handle and any pinned block.
 func (it *sstableIterator) Close() error {
+	it.unpin()
 	if it.file == nil {
 		return nil
 	}
 	err := it.file.Close()
 	it.file = nil
-	it.reader = nil
+	it.entries = nil
 	return err
 }
@@ -1,6 +1,9 @@
 package sstable
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
 
 	"amethyst/internal/common"
@@ -9,44 +12,171 @@ import (
 const (
 	// FOOTER_SIZE is the size of the footer in bytes.
 	// footerOffset = len(sstable) - FOOTER_SIZE
-	FOOTER_SIZE = 12
+	FOOTER_SIZE = 28
+
+	// UNPROPERTIED_FOOTER_SIZE is the size of the footer of tables from
+	// FormatVarint through FormatPartitionedIndex, which lacks the
+	// properties offset.
+	UNPROPERTIED_FOOTER_SIZE = 24
+
+	// LEGACY_FOOTER_SIZE is the size of the footer of FormatFixed tables,
+	// which lacks the format version and magic number.
+	LEGACY_FOOTER_SIZE = 16
+
+	// footerMagic ends every footer but legacy ones.
+	footerMagic uint32 = 0xa3e7c6d1
+)
+
+// FormatVersion identifies how a table's blocks are encoded.
+type FormatVersion uint32
+
+const (
+	// FormatFixed tables store plain sequences of common.EntryFormatFixed
+	// entries and end in a legacy footer.
+	FormatFixed FormatVersion = 1
+	// FormatVarint tables store plain sequences of common.EntryFormatVarint
+	// entries.
+	FormatVarint FormatVersion = 2
+	// FormatRestarts tables store data blocks as block restart blocks,
+	// which prefix-compress keys and can be searched without parsing every
+	// entry. Range tombstones are still EntryFormatVarint entries.
+	FormatRestarts FormatVersion = 3
+	// FormatPartitionedIndex tables may split a large index into
+	// partitions; see INDEX_PARTITION_SIZE.
+	FormatPartitionedIndex FormatVersion = 4
+	// FormatProperties tables end in a properties block; see Properties.
+	FormatProperties FormatVersion = 5
+	// FormatFilterPolicy tables start their filter block with the
+	// filter.Type that built it, and omit it for filter.None. Earlier
+	// tables always have a bloom filter.
+	FormatFilterPolicy FormatVersion = 6
+
+	// CurrentFormat is the format Builder writes.
+	CurrentFormat = FormatFilterPolicy
 )
 
-// Footer is the last 12 bytes of the SSTable file.
+// EntryFormat returns the encoding of the entries the table stores whole,
+// which is all of them but those in the data blocks of FormatRestarts
+// tables.
+func (v FormatVersion) EntryFormat() common.EntryFormat {
+	if v == FormatFixed {
+		return common.EntryFormatFixed
+	}
+	return common.EntryFormatVarint
+}
+
+// Footer is the last FOOTER_SIZE bytes of the SSTable file, or the last
+// LEGACY_FOOTER_SIZE bytes of a FormatFixed one.
 type Footer struct {
-	FilterOffset uint32 // Offset where filter block starts (4 bytes)
-	IndexOffset  uint32 // Offset where index block starts (4 bytes)
-	EntryCount   uint32 // Total number of entries in the SSTable (4 bytes)
+	FilterOffset   uint32 // Offset where filter block starts (4 bytes)
+	IndexOffset    uint32 // Offset where index block starts (4 bytes)
+	EntryCount     uint32 // Total number of entries in the SSTable (4 bytes)
+	RangeDelOffset uint32 // Offset where range deletion block starts (4 bytes)
+
+	// PropertiesOffset is where the properties block starts (4 bytes). It
+	// is stored from FormatProperties on.
+	PropertiesOffset uint32
+
+	// Version is the table's format (4 bytes), followed by footerMagic
+	// (4 bytes). Neither is stored for FormatFixed.
+	Version FormatVersion
+}
+
+// Size returns the number of bytes the footer takes at the end of the file.
+func (f *Footer) Size() int {
+	switch {
+	case f.Version == FormatFixed:
+		return LEGACY_FOOTER_SIZE
+	case f.Version < FormatProperties:
+		return UNPROPERTIED_FOOTER_SIZE
+	}
+	return FOOTER_SIZE
 }
 
 // WriteFooter writes the footer to the given writer.
 // Returns the number of bytes written.
 func WriteFooter(w io.Writer, f *Footer) (int, error) {
-	total := 0
-
-	n, err := common.WriteUint32(w, f.FilterOffset)
-	total += n
-	if err != nil {
-		return total, err
+	buf := make([]byte, 0, FOOTER_SIZE)
+	buf = binary.LittleEndian.AppendUint32(buf, f.FilterOffset)
+	buf = binary.LittleEndian.AppendUint32(buf, f.IndexOffset)
+	buf = binary.LittleEndian.AppendUint32(buf, f.EntryCount)
+	buf = binary.LittleEndian.AppendUint32(buf, f.RangeDelOffset)
+	if f.Version >= FormatProperties {
+		buf = binary.LittleEndian.AppendUint32(buf, f.PropertiesOffset)
+	}
+	if f.Version != FormatFixed {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(f.Version))
+		buf = binary.LittleEndian.AppendUint32(buf, footerMagic)
 	}
+	return w.Write(buf)
+}
 
-	n, err = common.WriteUint32(w, f.IndexOffset)
-	total += n
+// ReadFooter reads a versioned footer, which must be all that is left in
+// the reader: FOOTER_SIZE bytes, or UNPROPERTIED_FOOTER_SIZE for tables
+// before FormatProperties.
+func ReadFooter(r io.Reader) (*Footer, error) {
+	footer, err := readLegacyFooter(r)
 	if err != nil {
-		return total, err
+		return nil, err
 	}
-
-	n, err = common.WriteUint32(w, f.EntryCount)
-	total += n
+	rest, err := io.ReadAll(r)
 	if err != nil {
-		return total, err
+		return nil, err
+	}
+	if len(rest) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	trailer := rest[len(rest)-8:]
+	if magic := binary.LittleEndian.Uint32(trailer[4:]); magic != footerMagic {
+		return nil, fmt.Errorf("%w: footer magic is %08x, expected %08x", ErrCorruption, magic, footerMagic)
+	}
+	footer.Version = FormatVersion(binary.LittleEndian.Uint32(trailer))
+	if footer.Version <= FormatFixed || footer.Version > CurrentFormat {
+		return nil, fmt.Errorf("%w: unknown format version %d", ErrCorruption, footer.Version)
+	}
+	if LEGACY_FOOTER_SIZE+len(rest) != footer.Size() {
+		return nil, fmt.Errorf("%w: %d byte footer for format version %d", ErrCorruption, LEGACY_FOOTER_SIZE+len(rest), footer.Version)
+	}
+	if footer.Version >= FormatProperties {
+		footer.PropertiesOffset = binary.LittleEndian.Uint32(rest)
 	}
+	return footer, nil
+}
 
-	return total, nil
+// ReadFooterAt reads the footer ending a table of the given size, which may
+// be a legacy one. The version and magic number ending a versioned footer
+// say how large it is.
+func ReadFooterAt(r io.ReaderAt, size int64) (*Footer, error) {
+	if size >= UNPROPERTIED_FOOTER_SIZE {
+		var trailer [8]byte
+		if _, err := r.ReadAt(trailer[:], size-8); err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(trailer[4:]) == footerMagic {
+			footer := Footer{Version: FormatVersion(binary.LittleEndian.Uint32(trailer[:]))}
+			footerSize := int64(footer.Size())
+			if size < footerSize {
+				return nil, io.ErrUnexpectedEOF
+			}
+			data := make([]byte, footerSize)
+			if _, err := r.ReadAt(data, size-footerSize); err != nil {
+				return nil, err
+			}
+			return ReadFooter(bytes.NewReader(data))
+		}
+	}
+	if size < LEGACY_FOOTER_SIZE {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, LEGACY_FOOTER_SIZE)
+	if _, err := r.ReadAt(data, size-LEGACY_FOOTER_SIZE); err != nil {
+		return nil, err
+	}
+	return readLegacyFooter(bytes.NewReader(data))
 }
 
-// ReadFooter reads a footer from the reader.
-func ReadFooter(r io.Reader) (*Footer, error) {
+// readLegacyFooter reads the fields every footer starts with.
+func readLegacyFooter(r io.Reader) (*Footer, error) {
 	filterOffset, err := common.ReadUint32(r)
 	if err != nil {
 		return nil, err
@@ -59,9 +189,15 @@ func ReadFooter(r io.Reader) (*Footer, error) {
 	if err != nil {
 		return nil, err
 	}
+	rangeDelOffset, err := common.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
 	return &Footer{
-		FilterOffset: filterOffset,
-		IndexOffset:  indexOffset,
-		EntryCount:   entryCount,
+		FilterOffset:   filterOffset,
+		IndexOffset:    indexOffset,
+		EntryCount:     entryCount,
+		RangeDelOffset: rangeDelOffset,
+		Version:        FormatFixed,
 	}, nil
 }
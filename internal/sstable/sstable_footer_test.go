@@ -15,8 +15,22 @@ func TestFooterEncodeDecode(t *testing.T) {
 		{
 			name: "Basic footer",
 			footer: Footer{
-				FilterOffset: 1000,
-				IndexOffset:  2000,
+				FilterOffset:   1000,
+				IndexOffset:    2000,
+				EntryCount:     30,
+				RangeDelOffset: 900,
+				Version:        CurrentFormat,
+			},
+		},
+		{
+			name: "Properties offset",
+			footer: Footer{
+				FilterOffset:     1000,
+				IndexOffset:      2000,
+				EntryCount:       30,
+				RangeDelOffset:   900,
+				PropertiesOffset: 2500,
+				Version:          CurrentFormat,
 			},
 		},
 		{
@@ -24,13 +38,16 @@ func TestFooterEncodeDecode(t *testing.T) {
 			footer: Footer{
 				FilterOffset: 0,
 				IndexOffset:  0,
+				Version:      CurrentFormat,
 			},
 		},
 		{
 			name: "Large offsets",
 			footer: Footer{
-				FilterOffset: 0xFFFFFFFF,
-				IndexOffset:  0xFFFFFFFE,
+				FilterOffset:   0xFFFFFFFF,
+				IndexOffset:    0xFFFFFFFE,
+				RangeDelOffset: 0xFFFFFFFD,
+				Version:        CurrentFormat,
 			},
 		},
 	}
@@ -50,6 +67,53 @@ func TestFooterEncodeDecode(t *testing.T) {
 			require.NotNil(t, decoded)
 			require.Equal(t, tt.footer.FilterOffset, decoded.FilterOffset)
 			require.Equal(t, tt.footer.IndexOffset, decoded.IndexOffset)
+			require.Equal(t, tt.footer.EntryCount, decoded.EntryCount)
+			require.Equal(t, tt.footer.RangeDelOffset, decoded.RangeDelOffset)
+			require.Equal(t, tt.footer.PropertiesOffset, decoded.PropertiesOffset)
+			require.Equal(t, tt.footer.Version, decoded.Version)
 		})
 	}
 }
+
+func TestReadFooterAtLegacy(t *testing.T) {
+	footer := Footer{FilterOffset: 10, IndexOffset: 20, EntryCount: 3, RangeDelOffset: 5, Version: FormatFixed}
+	var buf bytes.Buffer
+	buf.WriteString("table contents")
+	n, err := WriteFooter(&buf, &footer)
+	require.NoError(t, err)
+	require.Equal(t, LEGACY_FOOTER_SIZE, n)
+
+	decoded, err := ReadFooterAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, footer, *decoded)
+	require.Equal(t, LEGACY_FOOTER_SIZE, decoded.Size())
+
+	// A current footer is recognized by its magic number
+	footer.Version = CurrentFormat
+	buf.Reset()
+	buf.WriteString("table contents")
+	_, err = WriteFooter(&buf, &footer)
+	require.NoError(t, err)
+	decoded, err = ReadFooterAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, footer, *decoded)
+	require.Equal(t, FOOTER_SIZE, decoded.Size())
+}
+
+func TestReadFooterAtUnpropertied(t *testing.T) {
+	footer := Footer{FilterOffset: 10, IndexOffset: 20, EntryCount: 3, RangeDelOffset: 5, Version: FormatPartitionedIndex}
+	var buf bytes.Buffer
+	buf.WriteString("table contents")
+	n, err := WriteFooter(&buf, &footer)
+	require.NoError(t, err)
+	require.Equal(t, UNPROPERTIED_FOOTER_SIZE, n)
+
+	decoded, err := ReadFooterAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, footer, *decoded)
+	require.Equal(t, UNPROPERTIED_FOOTER_SIZE, decoded.Size())
+
+	// A footer whose length doesn't match its version is rejected
+	_, err = ReadFooter(bytes.NewReader(buf.Bytes()[buf.Len()-FOOTER_SIZE:]))
+	require.ErrorIs(t, err, ErrCorruption)
+}
@@ -2,11 +2,20 @@ package sstable
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	"amethyst/internal/common"
 )
 
+// INDEX_PARTITION_SIZE is the most entries a table's index holds in one
+// block. Tables with more data blocks than this get a partitioned index: the
+// index is split into partitions of this many entries, and a top-level
+// index, the only part read when the table is opened, locates each
+// partition by its first key. Lookups then load just the partition they
+// need, through the block cache.
+const INDEX_PARTITION_SIZE = 128
+
 // Index Block Layout:
 //
 // ┌──────────────────┐
@@ -21,6 +30,19 @@ import (
 // │  IndexEntry N-1  │
 // └──────────────────┘
 //
+// From FormatPartitionedIndex, the index block starts with a byte saying
+// whether it is the whole index (indexFlat) or the top level of a
+// partitioned one (indexPartitioned), whose entries give the offsets of the
+// partitions rather than of data blocks.
+//
+// Index Partition Layout:
+//
+// ┌──────────────────┐
+// │      Index       │  as above, without the kind byte
+// ├──────────────────┤
+// │     dataEnd      │  uint32 - end offset of the partition's last data block
+// └──────────────────┘
+//
 // IndexEntry Layout:
 //
 // ┌──────────────────┐
@@ -94,6 +116,16 @@ type Index struct {
 // Returns the offset of the block where entries[i].Key <= key < entries[i+1].Key.
 // Returns (0, false) if the key is before the first block's first key.
 func (idx *Index) FindBlockOffset(key []byte) (uint32, bool) {
+	i, ok := idx.search(key)
+	if !ok {
+		return 0, false
+	}
+	return idx.Entries[i].BlockOffset, true
+}
+
+// search returns the position of the entry for the block that may contain
+// key, or false if key is before the first block's first key.
+func (idx *Index) search(key []byte) (int, bool) {
 	if len(idx.Entries) == 0 {
 		return 0, false
 	}
@@ -117,7 +149,17 @@ func (idx *Index) FindBlockOffset(key []byte) (uint32, bool) {
 
 	// left is now the first entry with Key > key
 	// We want the entry before it
-	return idx.Entries[left-1].BlockOffset, true
+	return left - 1, true
+}
+
+// handle returns the location of the block of entry i, which runs up to the
+// next entry's block, or to end after the last one.
+func (idx *Index) handle(i int, end uint32) blockHandle {
+	h := blockHandle{offset: idx.Entries[i].BlockOffset, end: end}
+	if i+1 < len(idx.Entries) {
+		h.end = idx.Entries[i+1].BlockOffset
+	}
+	return h
 }
 
 // WriteIndex writes the entire index block to a writer.
@@ -158,3 +200,77 @@ func ReadIndex(r io.Reader) (*Index, error) {
 	}
 	return &Index{Entries: entries}, nil
 }
+
+// Kinds of index block, from FormatPartitionedIndex.
+const (
+	indexFlat        byte = 0
+	indexPartitioned byte = 1
+)
+
+// indexEntryOverhead approximates the memory a parsed index entry holds
+// beyond its key.
+const indexEntryOverhead = 40
+
+// IndexPartition is one partition of a partitioned index.
+type IndexPartition struct {
+	Index
+	DataEnd uint32 // End offset of the last data block the partition indexes
+}
+
+// Size returns the approximate memory held by the partition, so it can be
+// kept in the block cache.
+func (p *IndexPartition) Size() int {
+	size := 0
+	for _, e := range p.Entries {
+		size += indexEntryOverhead + len(e.Key)
+	}
+	return size
+}
+
+// WriteIndexPartition writes an index partition to a writer.
+// Returns the number of bytes written.
+func WriteIndexPartition(w io.Writer, p *IndexPartition) (int, error) {
+	n, err := WriteIndex(w, &p.Index)
+	if err != nil {
+		return n, err
+	}
+	m, err := common.WriteUint32(w, p.DataEnd)
+	return n + m, err
+}
+
+// ReadIndexPartition reads an index partition from a reader.
+func ReadIndexPartition(r io.Reader) (*IndexPartition, error) {
+	idx, err := ReadIndex(r)
+	if err != nil {
+		return nil, err
+	}
+	dataEnd, err := common.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexPartition{Index: *idx, DataEnd: dataEnd}, nil
+}
+
+// readIndexBlock parses the index block of a table in format version,
+// returning either the whole index or the top level of a partitioned one.
+func readIndexBlock(data []byte, version FormatVersion) (index, partitions *Index, err error) {
+	if version < FormatPartitionedIndex {
+		index, err = ReadIndex(bytes.NewReader(data))
+		return index, nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: index block is empty", ErrCorruption)
+	}
+	idx, err := ReadIndex(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch data[0] {
+	case indexFlat:
+		return idx, nil, nil
+	case indexPartitioned:
+		return nil, idx, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown index kind %d", ErrCorruption, data[0])
+	}
+}
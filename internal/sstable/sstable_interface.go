@@ -6,7 +6,61 @@ import (
 	"amethyst/internal/common"
 )
 
-var ErrNotFound = errors.New("key not found")
+var (
+	ErrNotFound = errors.New("key not found")
+	// ErrNotCached is returned by GetCached when answering needs a disk read.
+	ErrNotCached = errors.New("sstable: block not cached")
+	// ErrCorruption is returned when a block fails its checksum.
+	ErrCorruption = errors.New("sstable: corruption")
+)
+
+// ReadOptions control how a read treats the data blocks it loads.
+type ReadOptions struct {
+	// FillCache adds blocks read from disk to the block cache.
+	FillCache bool
+	// VerifyChecksums checks blocks read from disk against their checksums.
+	VerifyChecksums bool
+	// ReadaheadSize, when positive, has iterators read data blocks from disk
+	// this many bytes at a time, and tells the operating system the file is
+	// read sequentially, so full-table scans aren't bound by a read per
+	// block. Point lookups ignore it.
+	ReadaheadSize int
+	// PinBlocks has iterators read data blocks through the block cache and
+	// pin the one they are positioned on, so it isn't evicted and read again
+	// mid-scan. The pin is released when the iterator moves to the next
+	// block or is closed. Point lookups ignore it.
+	PinBlocks bool
+	// UpperBound, when set, ends iteration at the first key at or past it,
+	// so iterators read no block that starts beyond it. Point lookups
+	// ignore it.
+	UpperBound []byte
+}
+
+// DefaultReadaheadSize is the readahead of Iterator.
+const DefaultReadaheadSize = 256 << 10
+
+// DefaultReadOptions caches and verifies every block read.
+var DefaultReadOptions = ReadOptions{FillCache: true, VerifyChecksums: true}
+
+// OpenOptions control how a table is opened.
+type OpenOptions struct {
+	// Mmap memory-maps the table, so blocks are read without a system call
+	// and compressed ones without a copy. It suits read-heavy workloads
+	// whose data fits in the page cache. Tables are read through the file
+	// where mapping isn't possible.
+	Mmap bool
+
+	// Logger receives the table's warnings and lookup traces; nil logs to
+	// common.DefaultLogger.
+	Logger common.Logger
+}
+
+func (o OpenOptions) logger() common.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return common.DefaultLogger
+}
 
 // SSTable provides read access to a sorted string table file.
 type SSTable interface {
@@ -14,12 +68,41 @@ type SSTable interface {
 	// Returns ErrNotFound if the key does not exist.
 	Get(key []byte) (*common.Entry, error)
 
+	// GetWithOptions is like Get but reads as opts specify.
+	GetWithOptions(key []byte, opts ReadOptions) (*common.Entry, error)
+
+	// MultiGet looks up keys, which must be sorted, reading each block they
+	// fall in once. The result holds each key's entry, or nil where the key
+	// isn't in the table.
+	MultiGet(keys [][]byte, opts ReadOptions) ([]*common.Entry, error)
+
+	// GetCached is like Get but answers only from the filter, the index, and
+	// the block cache, returning ErrNotCached where Get would read a block.
+	GetCached(key []byte) (*common.Entry, error)
+
+	// MayContainPrefix returns false if no key with the given prefix is in
+	// the table. Only valid for prefixes from the extractor the table was
+	// written with.
+	MayContainPrefix(prefix []byte) bool
+
 	// Iterator returns an iterator over all entries in the table.
 	Iterator() common.EntryIterator
 
+	// IteratorWithOptions is like Iterator but reads as opts specify. Both
+	// return iterators that can also Seek, as iterator.Seeker describes.
+	IteratorWithOptions(opts ReadOptions) common.EntryIterator
+
+	// RangeTombstones returns the table's range tombstones. Get and Iterator
+	// return point entries only and don't apply them.
+	RangeTombstones() common.RangeTombstones
+
 	// GetIndex returns the index structure.
 	GetIndex() *Index
 
+	// Properties returns the properties recorded when the table was
+	// written, or nil for tables written before FormatProperties.
+	Properties() *Properties
+
 	// Len returns the total number of entries in the SSTable.
 	// This value is cached in the footer for fast lookup.
 	Len() int
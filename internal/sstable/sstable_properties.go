@@ -0,0 +1,103 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"amethyst/internal/compression"
+)
+
+// Properties Block Layout:
+//
+// ┌──────────────────┐
+// │    entryCount    │  uint32 - point entries, tombstones included
+// ├──────────────────┤
+// │  tombstoneCount  │  uint32 - deletes among the entries
+// ├──────────────────┤
+// │  rangeDelCount   │  uint32
+// ├──────────────────┤
+// │   rawDataSize    │  uint64 - data block payloads before compression
+// ├──────────────────┤
+// │     dataSize     │  uint64 - data blocks as stored, trailers included
+// ├──────────────────┤
+// │      minSeq      │  uint64
+// ├──────────────────┤
+// │      maxSeq      │  uint64
+// ├──────────────────┤
+// │    createdAt     │  int64 - Unix nanoseconds
+// ├──────────────────┤
+// │      codec       │  uint8 - compression.Type the data blocks were written with
+// └──────────────────┘
+//
+// The block is followed by its CRC32C, like every block but the data blocks.
+
+// propertiesSize is the size of an encoded properties block, without its
+// checksum.
+const propertiesSize = 3*4 + 5*8 + 1
+
+// Properties describe a table as it was written, so compaction heuristics
+// and tooling needn't scan it. Tables before FormatProperties have none.
+type Properties struct {
+	EntryCount     uint32
+	TombstoneCount uint32
+	RangeDelCount  uint32
+
+	// RawDataSize is the size of the data blocks before compression, and
+	// DataSize their size in the file.
+	RawDataSize uint64
+	DataSize    uint64
+
+	// MinSeq and MaxSeq bound the sequence numbers of the entries and range
+	// tombstones; both are 0 for an empty table.
+	MinSeq uint64
+	MaxSeq uint64
+
+	CreatedAt int64 // Unix nanoseconds
+	Codec     compression.Type
+}
+
+// CodecName returns the name of the table's codec, or its number if the
+// codec isn't registered.
+func (p *Properties) CodecName() string {
+	codec, err := compression.Lookup(p.Codec)
+	if err != nil {
+		return fmt.Sprintf("unknown(%d)", p.Codec)
+	}
+	return codec.Name()
+}
+
+// WriteProperties writes a properties block to the given writer.
+// Returns the number of bytes written.
+func WriteProperties(w io.Writer, p *Properties) (int, error) {
+	buf := make([]byte, 0, propertiesSize)
+	buf = binary.LittleEndian.AppendUint32(buf, p.EntryCount)
+	buf = binary.LittleEndian.AppendUint32(buf, p.TombstoneCount)
+	buf = binary.LittleEndian.AppendUint32(buf, p.RangeDelCount)
+	buf = binary.LittleEndian.AppendUint64(buf, p.RawDataSize)
+	buf = binary.LittleEndian.AppendUint64(buf, p.DataSize)
+	buf = binary.LittleEndian.AppendUint64(buf, p.MinSeq)
+	buf = binary.LittleEndian.AppendUint64(buf, p.MaxSeq)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(p.CreatedAt))
+	buf = append(buf, uint8(p.Codec))
+	return w.Write(buf)
+}
+
+// ReadProperties parses a properties block.
+func ReadProperties(data []byte) (*Properties, error) {
+	if len(data) != propertiesSize {
+		return nil, fmt.Errorf("%w: properties block is %d bytes, expected %d", ErrCorruption, len(data), propertiesSize)
+	}
+	le := binary.LittleEndian
+	return &Properties{
+		EntryCount:     le.Uint32(data[0:]),
+		TombstoneCount: le.Uint32(data[4:]),
+		RangeDelCount:  le.Uint32(data[8:]),
+		RawDataSize:    le.Uint64(data[12:]),
+		DataSize:       le.Uint64(data[20:]),
+		MinSeq:         le.Uint64(data[28:]),
+		MaxSeq:         le.Uint64(data[36:]),
+		CreatedAt:      int64(le.Uint64(data[44:])),
+		Codec:          compression.Type(data[52]),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package sstable
+
+import (
+	"bytes"
+	"testing"
+
+	"amethyst/internal/compression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropertiesEncodeDecode(t *testing.T) {
+	props := &Properties{
+		EntryCount:     100,
+		TombstoneCount: 4,
+		RangeDelCount:  2,
+		RawDataSize:    1 << 33,
+		DataSize:       12345,
+		MinSeq:         17,
+		MaxSeq:         1 << 40,
+		CreatedAt:      1700000000123456789,
+		Codec:          compression.ZlibType,
+	}
+	var buf bytes.Buffer
+	n, err := WriteProperties(&buf, props)
+	require.NoError(t, err)
+	require.Equal(t, propertiesSize, n)
+
+	decoded, err := ReadProperties(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, props, decoded)
+	require.Equal(t, "zlib", decoded.CodecName())
+
+	_, err = ReadProperties(buf.Bytes()[:n-1])
+	require.ErrorIs(t, err, ErrCorruption)
+
+	decoded.Codec = 200
+	require.Equal(t, "unknown(200)", decoded.CodecName())
+}
@@ -2,11 +2,19 @@ package sstable
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"testing"
+	"time"
 
 	"amethyst/internal/block"
+	"amethyst/internal/block_cache"
 	"amethyst/internal/common"
+	"amethyst/internal/compression"
+	"amethyst/internal/filter"
+	"amethyst/internal/vfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -30,19 +38,23 @@ func TestWriteSSTable(t *testing.T) {
 	entries := []*common.Entry{
 		{Type: common.EntryTypePut, Seq: 1, Key: []byte("apple"), Value: []byte("red")},
 		{Type: common.EntryTypePut, Seq: 2, Key: []byte("banana"), Value: []byte("yellow")},
-		{Type: common.EntryTypePut, Seq: 3, Key: []byte("cherry"), Value: []byte("red")},
+		{Type: common.EntryTypeDelete, Seq: 3, Key: []byte("cherry")},
 	}
 
 	iter := &testIterator{entries: entries}
 	var buf bytes.Buffer
 
 	// Write SSTable
-	result, err := WriteSSTable(&buf, iter, 100, 0.01)
+	result, err := WriteSSTable(&buf, iter, 100, 0.01, nil, nil, nil)
 	require.NoError(t, err)
 	require.Greater(t, result.BytesWritten, uint32(0))
 	require.Equal(t, result.BytesWritten, uint32(buf.Len()))
 	require.Equal(t, []byte("apple"), result.SmallestKey)
 	require.Equal(t, []byte("cherry"), result.LargestKey)
+	require.Equal(t, uint32(3), result.EntryCount)
+	require.Equal(t, uint32(1), result.TombstoneCount)
+	require.Equal(t, SizeHistogram{0, 0, 0, 3}, result.KeySizes)
+	require.Equal(t, SizeHistogram{0, 0, 1, 1}, result.ValueSizes)
 
 	// Read and verify footer (last FOOTER_SIZE bytes)
 	data := buf.Bytes()
@@ -57,9 +69,10 @@ func TestWriteSSTable(t *testing.T) {
 
 	// Read and verify index
 	indexData := data[footer.IndexOffset : len(data)-FOOTER_SIZE]
-	index, err := ReadIndex(bytes.NewReader(indexData))
+	index, partitions, err := readIndexBlock(indexData, footer.Version)
 	require.NoError(t, err)
 	require.NotNil(t, index)
+	require.Nil(t, partitions)
 	require.Equal(t, 1, len(index.Entries)) // Should have 1 block (3 entries < BLOCK_SIZE)
 	require.Equal(t, uint32(0), index.Entries[0].BlockOffset)
 	require.Equal(t, []byte("apple"), index.Entries[0].Key)
@@ -79,12 +92,12 @@ func TestSSTableReaderBasic(t *testing.T) {
 	require.NoError(t, err)
 
 	iter := &testIterator{entries: entries}
-	_, err = WriteSSTable(f, iter, 100, 0.01)
+	_, err = WriteSSTable(f, iter, 100, 0.01, nil, nil, nil)
 	require.NoError(t, err)
 	require.NoError(t, f.Close())
 
 	// Open SSTable for reading
-	reader, err := OpenSSTable(tmpFile, common.FileNo(1), nil)
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
 	require.NoError(t, err)
 	defer reader.Close()
 
@@ -127,7 +140,7 @@ func TestSSTableReaderMultipleBlocks(t *testing.T) {
 		key := []byte{byte(i / 256), byte(i % 256)} // 2-byte key
 		entries[i] = &common.Entry{
 			Type:  common.EntryTypePut,
-			Seq:   uint32(i + 1),
+			Seq:   uint64(i + 1),
 			Key:   key,
 			Value: []byte{byte(i)},
 		}
@@ -139,12 +152,12 @@ func TestSSTableReaderMultipleBlocks(t *testing.T) {
 	require.NoError(t, err)
 
 	iter := &testIterator{entries: entries}
-	_, err = WriteSSTable(f, iter, 100, 0.01)
+	_, err = WriteSSTable(f, iter, 100, 0.01, nil, nil, nil)
 	require.NoError(t, err)
 	require.NoError(t, f.Close())
 
 	// Open SSTable for reading
-	reader, err := OpenSSTable(tmpFile, common.FileNo(1), nil)
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
 	require.NoError(t, err)
 	defer reader.Close()
 
@@ -176,12 +189,12 @@ func TestSSTableReaderTombstone(t *testing.T) {
 	require.NoError(t, err)
 
 	iter := &testIterator{entries: entries}
-	_, err = WriteSSTable(f, iter, 100, 0.01)
+	_, err = WriteSSTable(f, iter, 100, 0.01, nil, nil, nil)
 	require.NoError(t, err)
 	require.NoError(t, f.Close())
 
 	// Open SSTable for reading
-	reader, err := OpenSSTable(tmpFile, common.FileNo(1), nil)
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
 	require.NoError(t, err)
 	defer reader.Close()
 
@@ -190,7 +203,7 @@ func TestSSTableReaderTombstone(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, entry)
 	require.Equal(t, common.EntryTypeDelete, entry.Type)
-	require.Equal(t, uint32(2), entry.Seq)
+	require.Equal(t, uint64(2), entry.Seq)
 }
 
 func TestSSTableIterator(t *testing.T) {
@@ -201,7 +214,7 @@ func TestSSTableIterator(t *testing.T) {
 		key := []byte{byte(i / 256), byte(i % 256)}
 		entries[i] = &common.Entry{
 			Type:  common.EntryTypePut,
-			Seq:   uint32(i + 1),
+			Seq:   uint64(i + 1),
 			Key:   key,
 			Value: []byte{byte(i)},
 		}
@@ -213,12 +226,12 @@ func TestSSTableIterator(t *testing.T) {
 	require.NoError(t, err)
 
 	iter := &testIterator{entries: entries}
-	_, err = WriteSSTable(f, iter, 100, 0.01)
+	_, err = WriteSSTable(f, iter, 100, 0.01, nil, nil, nil)
 	require.NoError(t, err)
 	require.NoError(t, f.Close())
 
 	// Open SSTable for reading
-	reader, err := OpenSSTable(tmpFile, common.FileNo(1), nil)
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
 	require.NoError(t, err)
 	defer reader.Close()
 
@@ -229,3 +242,929 @@ func TestSSTableIterator(t *testing.T) {
 	resultIter := reader.Iterator()
 	common.RequireMatchesIterator(t, resultIter, entries)
 }
+
+func TestSSTablePrefixFilter(t *testing.T) {
+	entries := []*common.Entry{
+		{Type: common.EntryTypePut, Seq: 1, Key: []byte("order:1"), Value: []byte("a")},
+		{Type: common.EntryTypePut, Seq: 2, Key: []byte("user:1"), Value: []byte("b")},
+		{Type: common.EntryTypePut, Seq: 3, Key: []byte("user:2"), Value: []byte("c")},
+	}
+
+	tmpFile := t.TempDir() + "/test_prefix.sst"
+	f, err := os.Create(tmpFile)
+	require.NoError(t, err)
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, 3, 0.0001, common.NewDelimitedPrefixExtractor(':'), nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	tests := []struct {
+		prefix   string
+		expected bool
+	}{
+		{"user:", true},
+		{"order:", true},
+		{"invoice:", false},
+		{"users:", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			require.Equal(t, tt.expected, reader.MayContainPrefix([]byte(tt.prefix)))
+		})
+	}
+
+	// Whole keys are still in the filter
+	entry, err := reader.Get([]byte("user:2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("c"), entry.Value)
+}
+
+func TestSSTableFilterSkipsBlocks(t *testing.T) {
+	var entries []*common.Entry
+	for i := 0; i < 50; i += 2 {
+		entries = append(entries, &common.Entry{Type: common.EntryTypePut, Seq: uint64(i), Key: []byte(fmt.Sprintf("key%03d", i)), Value: []byte("v")})
+	}
+
+	tmpFile := t.TempDir() + "/test_filter.sst"
+	f, err := os.Create(tmpFile)
+	require.NoError(t, err)
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, uint32(len(entries)), 0.0001, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Less(t, reader.footer.FilterOffset, reader.footer.IndexOffset, "filter block must be persisted")
+
+	// With nothing cached, a key the filter admits needs a block read, while
+	// absent keys inside the table's range are rejected without one
+	_, err = reader.GetCached([]byte("key010"))
+	require.ErrorIs(t, err, ErrNotCached)
+	for i := 1; i < 50; i += 2 {
+		_, err := reader.GetCached([]byte(fmt.Sprintf("key%03d", i)))
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+}
+
+func TestSSTableCompression(t *testing.T) {
+	var entries []*common.Entry
+	for i := 0; i < block.BLOCK_SIZE*3+5; i++ {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%05d", i)),
+			Value: bytes.Repeat([]byte(fmt.Sprintf("value%d ", i%5)), 8),
+		})
+	}
+
+	write := func(path string, codec compression.Codec) uint32 {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		result, err := WriteSSTable(f, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, codec, nil)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return result.BytesWritten
+	}
+
+	dir := t.TempDir()
+	uncompressed := write(dir+"/none.sst", nil)
+
+	tests := []struct {
+		name  string
+		codec compression.Codec
+	}{
+		{"None", compression.None},
+		{"Snappy", compression.Snappy},
+		{"Zlib", compression.Zlib},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := dir + "/" + tt.codec.Name() + ".sst"
+			size := write(path, tt.codec)
+			if tt.codec == compression.None {
+				require.Equal(t, uncompressed, size)
+			} else {
+				require.Less(t, size, uncompressed/2)
+			}
+
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			for _, expected := range entries {
+				entry, err := reader.Get(expected.Key)
+				require.NoError(t, err)
+				require.Equal(t, expected.Value, entry.Value)
+			}
+
+			iter := reader.Iterator()
+			for _, expected := range entries {
+				entry, err := iter.Next()
+				require.NoError(t, err)
+				require.Equal(t, expected.Key, entry.Key)
+				require.Equal(t, expected.Value, entry.Value)
+			}
+			entry, err := iter.Next()
+			require.NoError(t, err)
+			require.Nil(t, entry)
+		})
+	}
+}
+
+func TestSSTableIncompressibleBlocksStoredRaw(t *testing.T) {
+	// Values with no repetition don't shrink, so blocks are stored as-is
+	rng := rand.New(rand.NewPCG(1, 2))
+	var entries []*common.Entry
+	for i := 0; i < 10; i++ {
+		value := make([]byte, 256)
+		for j := range value {
+			value[j] = byte(rng.Uint32())
+		}
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("k%d", i)),
+			Value: value,
+		})
+	}
+
+	var plain, snappy bytes.Buffer
+	_, err := WriteSSTable(&plain, &testIterator{entries: entries}, 10, 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	_, err = WriteSSTable(&snappy, &testIterator{entries: entries}, 10, 0.01, nil, compression.Snappy, nil)
+	require.NoError(t, err)
+
+	// The tables differ only in their properties, which record the codec
+	footer, err := ReadFooterAt(bytes.NewReader(plain.Bytes()), int64(plain.Len()))
+	require.NoError(t, err)
+	require.Equal(t, plain.Bytes()[:footer.PropertiesOffset], snappy.Bytes()[:footer.PropertiesOffset])
+}
+
+func TestSSTableBlockChecksums(t *testing.T) {
+	var entries []*common.Entry
+	for i := 0; i < block.BLOCK_SIZE*2; i++ {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%04d", i)),
+		})
+	}
+	var buf bytes.Buffer
+	_, err := WriteSSTable(&buf, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	data := buf.Bytes()
+	footer, err := ReadFooter(bytes.NewReader(data[len(data)-FOOTER_SIZE:]))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		offset   uint32
+		openFail bool
+	}{
+		{"DataBlock", 10, false},
+		{"DataBlockTrailer", footer.FilterOffset - 1, false},
+		{"FilterBlock", footer.FilterOffset + 1, true},
+		{"IndexBlock", footer.IndexOffset + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := bytes.Clone(data)
+			damaged[tt.offset] ^= 0x01
+			path := t.TempDir() + "/test.sst"
+			require.NoError(t, os.WriteFile(path, damaged, 0644))
+
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+			if tt.openFail {
+				require.ErrorIs(t, err, ErrCorruption)
+				return
+			}
+			require.NoError(t, err)
+			defer reader.Close()
+
+			// Get reads the damaged block, or the last one for trailer damage
+			key := entries[0].Key
+			if tt.offset > footer.FilterOffset-blockTrailerSize {
+				key = entries[len(entries)-1].Key
+			}
+			_, err = reader.Get(key)
+			require.ErrorIs(t, err, ErrCorruption)
+
+			iter := reader.Iterator()
+			for {
+				entry, err := iter.Next()
+				if err != nil {
+					require.ErrorIs(t, err, ErrCorruption)
+					break
+				}
+				require.NotNil(t, entry, "iteration ended without reporting the damage")
+			}
+		})
+	}
+}
+
+func TestSSTableReadOptions(t *testing.T) {
+	var entries []*common.Entry
+	for i := 0; i < block.BLOCK_SIZE*2; i++ {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%04d", i)),
+		})
+	}
+	var buf bytes.Buffer
+	_, err := WriteSSTable(&buf, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	data := buf.Bytes()
+	footer, err := ReadFooter(bytes.NewReader(data[len(data)-FOOTER_SIZE:]))
+	require.NoError(t, err)
+
+	// Damage only the stored checksum of the last block
+	data[footer.FilterOffset-1] ^= 0x01
+	path := t.TempDir() + "/test.sst"
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	lastKey := entries[len(entries)-1].Key
+
+	tests := []struct {
+		name       string
+		opts       ReadOptions
+		wantErr    error
+		wantCached int
+	}{
+		{"Default", DefaultReadOptions, ErrCorruption, 1},
+		{"NoVerify", ReadOptions{FillCache: true}, nil, 2},
+		{"NoFillCache", ReadOptions{}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := block_cache.NewBlockCache(block_cache.DefaultCapacity)
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			_, err = reader.GetWithOptions(lastKey, tt.opts)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			count := 0
+			iter := reader.IteratorWithOptions(tt.opts)
+			for {
+				entry, err := iter.Next()
+				if tt.wantErr != nil && err != nil {
+					require.ErrorIs(t, err, tt.wantErr)
+					break
+				}
+				require.NoError(t, err)
+				if entry == nil {
+					break
+				}
+				count++
+			}
+			if tt.wantErr == nil {
+				require.Equal(t, len(entries), count)
+			}
+
+			// Only the intact blocks the reads loaded are cached
+			cached := 0
+			for _, e := range reader.GetIndex().Entries {
+				if _, ok := cache.Get(common.FileNo(1), common.BlockNo(e.BlockOffset)); ok {
+					cached++
+				}
+			}
+			require.Equal(t, tt.wantCached, cached)
+		})
+	}
+}
+
+func TestSSTableIteratorPinBlocks(t *testing.T) {
+	entries := make([]*common.Entry, block.BLOCK_SIZE*3)
+	for i := range entries {
+		entries[i] = &common.Entry{Type: common.EntryTypePut, Seq: uint64(i + 1), Key: []byte(fmt.Sprintf("key%04d", i)), Value: []byte("value")}
+	}
+	path := t.TempDir() + "/test.sst"
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	opts := ReadOptions{FillCache: true, VerifyChecksums: true, PinBlocks: true}
+
+	// A scan of cached blocks reads them from the cache
+	cache := block_cache.NewBlockCache(block_cache.DefaultCapacity)
+	reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+	require.NoError(t, err)
+	common.RequireMatchesIterator(t, reader.IteratorWithOptions(opts), entries)
+	hits := cache.Stats().Hits
+	common.RequireMatchesIterator(t, reader.IteratorWithOptions(opts), entries)
+	require.Equal(t, hits+3, cache.Stats().Hits)
+	blockSize := cache.Usage() / 3
+	require.NoError(t, reader.Close())
+
+	// With room for only one block, the block under an open iterator
+	// survives reads of the others until the iterator is closed
+	cache = block_cache.NewBlockCache(blockSize * 3 / 2)
+	reader, err = OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+	require.NoError(t, err)
+	defer reader.Close()
+	first := common.BlockNo(reader.GetIndex().Entries[0].BlockOffset)
+
+	iter := reader.IteratorWithOptions(opts)
+	entry, err := iter.Next()
+	require.NoError(t, err)
+	require.Equal(t, entries[0].Key, entry.Key)
+	_, err = reader.Get(entries[len(entries)-1].Key)
+	require.NoError(t, err)
+	_, ok := cache.Get(common.FileNo(1), first)
+	require.True(t, ok, "pinned block should stay cached")
+
+	require.NoError(t, iter.(io.Closer).Close())
+	_, err = reader.Get(entries[block.BLOCK_SIZE].Key)
+	require.NoError(t, err)
+	_, ok = cache.Get(common.FileNo(1), first)
+	require.False(t, ok, "unpinned block should be evictable")
+}
+
+func TestSSTableRangeTombstones(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []*common.Entry
+		rangeDels common.RangeTombstones
+		smallest  string
+		largest   string
+		maxSeq    uint64
+	}{
+		{
+			name: "tombstones widen the key range",
+			entries: []*common.Entry{
+				{Type: common.EntryTypePut, Seq: 1, Key: []byte("c"), Value: []byte("v")},
+				{Type: common.EntryTypePut, Seq: 2, Key: []byte("d"), Value: []byte("v")},
+			},
+			rangeDels: common.RangeTombstones{
+				{Type: common.EntryTypeRangeDelete, Seq: 3, Key: []byte("a"), Value: []byte("b")},
+				{Type: common.EntryTypeRangeDelete, Seq: 4, Key: []byte("c"), Value: []byte("x")},
+			},
+			smallest: "a",
+			largest:  "x",
+			maxSeq:   4,
+		},
+		{
+			name: "tombstones only",
+			rangeDels: common.RangeTombstones{
+				{Type: common.EntryTypeRangeDelete, Seq: 7, Key: []byte("k"), Value: []byte("m")},
+			},
+			smallest: "k",
+			largest:  "m",
+			maxSeq:   7,
+		},
+		{
+			name: "no tombstones",
+			entries: []*common.Entry{
+				{Type: common.EntryTypePut, Seq: 5, Key: []byte("c"), Value: []byte("v")},
+			},
+			smallest: "c",
+			largest:  "c",
+			maxSeq:   5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile := t.TempDir() + "/test_range_del.sst"
+			f, err := os.Create(tmpFile)
+			require.NoError(t, err)
+			result, err := WriteSSTable(f, &testIterator{entries: tt.entries}, 10, 0.01, nil, nil, tt.rangeDels)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			require.Equal(t, []byte(tt.smallest), result.SmallestKey)
+			require.Equal(t, []byte(tt.largest), result.LargestKey)
+			require.Equal(t, uint32(len(tt.entries)), result.EntryCount)
+			require.Equal(t, uint32(len(tt.rangeDels)), result.RangeDelCount)
+			require.Equal(t, tt.maxSeq, result.MaxSeq)
+
+			reader, err := OpenSSTable(vfs.Default, tmpFile, common.FileNo(1), nil)
+			require.NoError(t, err)
+			defer reader.Close()
+			require.Equal(t, tt.rangeDels, reader.RangeTombstones())
+
+			// Point lookups read past the range deletion block unharmed
+			for _, want := range tt.entries {
+				entry, err := reader.Get(want.Key)
+				require.NoError(t, err)
+				require.Equal(t, want.Value, entry.Value)
+			}
+		})
+	}
+}
+
+func TestSSTableLegacyFormats(t *testing.T) {
+	entries := make([]*common.Entry, 0, 2*block.BLOCK_SIZE)
+	for i := range 2 * block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+	rangeDels := common.RangeTombstones{
+		{Type: common.EntryTypeRangeDelete, Seq: 1000, Key: []byte("key9000"), Value: []byte("key9999")},
+	}
+
+	for _, version := range []FormatVersion{FormatFixed, FormatVarint, FormatRestarts, FormatPartitionedIndex} {
+		t.Run(fmt.Sprintf("version=%d", version), func(t *testing.T) {
+			// Write the table as it was before later formats
+			path := t.TempDir() + "/legacy.sst"
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			b := NewBuilder(f, uint32(len(entries)), 0.01, nil, nil)
+			b.version = version
+			for _, e := range entries {
+				require.NoError(t, b.Add(e))
+			}
+			_, err = b.Finish(rangeDels)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			cache := block_cache.NewBlockCache(1 << 20)
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+			require.NoError(t, err)
+			defer reader.Close()
+			require.Equal(t, version, reader.footer.Version)
+			require.Equal(t, rangeDels, reader.RangeTombstones())
+			require.Nil(t, reader.Properties())
+
+			for _, key := range []string{"key0000", "key0077", "key0127"} {
+				entry, err := reader.Get([]byte(key))
+				require.NoError(t, err)
+				require.Equal(t, key, string(entry.Key))
+			}
+			entry, err := reader.Get([]byte("key0077"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("value77"), entry.Value)
+			require.Equal(t, uint64(78), entry.Seq)
+			_, err = reader.Get([]byte("key0077a"))
+			require.ErrorIs(t, err, ErrNotFound)
+
+			iter := reader.Iterator()
+			for _, want := range entries {
+				got, err := iter.Next()
+				require.NoError(t, err)
+				require.Equal(t, want, got)
+			}
+			got, err := iter.Next()
+			require.NoError(t, err)
+			require.Nil(t, got)
+		})
+	}
+}
+
+func TestSSTableRestartBlocksAreSmaller(t *testing.T) {
+	var entries []*common.Entry
+	for i := range block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("users/0000000000/sessions/%08d", i)),
+			Value: []byte("v"),
+		})
+	}
+	size := func(version FormatVersion) int {
+		var buf bytes.Buffer
+		b := NewBuilder(&buf, uint32(len(entries)), 0.01, nil, nil)
+		b.version = version
+		for _, e := range entries {
+			require.NoError(t, b.Add(e))
+		}
+		_, err := b.Finish(nil)
+		require.NoError(t, err)
+		return buf.Len()
+	}
+	require.Less(t, size(FormatRestarts), size(FormatVarint)*2/3)
+}
+
+func TestSSTablePartitionedIndex(t *testing.T) {
+	entries := make([]*common.Entry, 0, 8*block.BLOCK_SIZE)
+	for i := range 8 * block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+	rangeDels := common.RangeTombstones{
+		{Type: common.EntryTypeRangeDelete, Seq: 5000, Key: []byte("key9000"), Value: []byte("key9999")},
+	}
+
+	// Three blocks per partition, so the last partition is short
+	path := t.TempDir() + "/partitioned.sst"
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	b := NewBuilder(f, uint32(len(entries)), 0.01, nil, nil)
+	b.partitionSize = 3
+	for _, e := range entries {
+		require.NoError(t, b.Add(e))
+	}
+	_, err = b.Finish(rangeDels)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	cache := block_cache.NewBlockCache(1 << 20)
+	reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Nil(t, reader.index)
+	require.Len(t, reader.partitions.Entries, 3)
+	require.Equal(t, rangeDels, reader.RangeTombstones())
+
+	// Until a lookup loads it, the partition covering a key isn't cached
+	_, err = reader.GetCached([]byte("key0000"))
+	require.ErrorIs(t, err, ErrNotCached)
+	for _, i := range []int{0, 77, 191, 192, 400, len(entries) - 1} {
+		entry, err := reader.Get(entries[i].Key)
+		require.NoError(t, err)
+		require.Equal(t, entries[i], entry)
+	}
+	entry, err := reader.GetCached([]byte("key0000"))
+	require.NoError(t, err)
+	require.Equal(t, entries[0], entry)
+	_, ok := cache.Get(common.FileNo(1), common.BlockNo(reader.partitions.Entries[0].BlockOffset))
+	require.True(t, ok)
+	_, err = reader.Get([]byte("key0077a"))
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = reader.Get([]byte("a"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	multi, err := reader.MultiGet([][]byte{[]byte("key0001"), []byte("key0191"), []byte("key0192"), []byte("zzz")}, DefaultReadOptions)
+	require.NoError(t, err)
+	require.Equal(t, []*common.Entry{entries[1], entries[191], entries[192], nil}, multi)
+
+	index := reader.GetIndex()
+	require.Len(t, index.Entries, 8)
+	for i, e := range index.Entries {
+		require.Equal(t, entries[i*block.BLOCK_SIZE].Key, e.Key)
+	}
+
+	iter := reader.Iterator()
+	for _, want := range entries {
+		got, err := iter.Next()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	got, err := iter.Next()
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestSSTableIteratorSeek(t *testing.T) {
+	entries := make([]*common.Entry, 0, 8*block.BLOCK_SIZE)
+	for i := range 8 * block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+
+	for _, partitionSize := range []int{0, 3} {
+		t.Run(fmt.Sprintf("partitions of %d", partitionSize), func(t *testing.T) {
+			path := t.TempDir() + "/seek.sst"
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			b := NewBuilder(f, uint32(len(entries)), 0.01, nil, nil)
+			if partitionSize > 0 {
+				b.partitionSize = partitionSize
+			}
+			for _, e := range entries {
+				require.NoError(t, b.Add(e))
+			}
+			_, err = b.Finish(nil)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			cache := block_cache.NewBlockCache(1 << 20)
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), cache)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			// Seeking skips the blocks before the key without reading them
+			target := 6*block.BLOCK_SIZE + 5
+			iter := reader.IteratorWithOptions(ReadOptions{FillCache: true, UpperBound: entries[target+10].Key})
+			defer iter.(io.Closer).Close()
+			require.NoError(t, iter.(*sstableIterator).Seek([]byte(fmt.Sprintf("key%04da", target-1))))
+			for _, e := range reader.GetIndex().Entries[:6] {
+				_, ok := cache.Get(common.FileNo(1), common.BlockNo(e.BlockOffset))
+				require.False(t, ok, "block at %d was read", e.BlockOffset)
+			}
+
+			// Iteration resumes at the key and ends at the upper bound
+			common.RequireMatchesIterator(t, iter, entries[target:target+10])
+
+			// Seeking within the current block or backwards reads forward
+			iter = reader.Iterator()
+			defer iter.(io.Closer).Close()
+			require.NoError(t, iter.(*sstableIterator).Seek(entries[3].Key))
+			require.NoError(t, iter.(*sstableIterator).Seek(entries[5].Key))
+			require.NoError(t, iter.(*sstableIterator).Seek(entries[0].Key))
+			got, err := iter.Next()
+			require.NoError(t, err)
+			require.Equal(t, entries[5], got)
+			require.NoError(t, iter.(*sstableIterator).Seek(entries[len(entries)-1].Key))
+			common.RequireMatchesIterator(t, iter, entries[len(entries)-1:])
+			require.NoError(t, iter.(*sstableIterator).Seek([]byte("zzz")))
+			got, err = iter.Next()
+			require.NoError(t, err)
+			require.Nil(t, got)
+		})
+	}
+}
+
+func TestSSTableProperties(t *testing.T) {
+	entries := []*common.Entry{
+		{Type: common.EntryTypePut, Seq: 7, Key: []byte("apple"), Value: bytes.Repeat([]byte("red"), 100)},
+		{Type: common.EntryTypeDelete, Seq: 3, Key: []byte("banana")},
+		{Type: common.EntryTypePut, Seq: 5, Key: []byte("cherry"), Value: bytes.Repeat([]byte("dark"), 100)},
+	}
+	rangeDels := common.RangeTombstones{
+		{Type: common.EntryTypeRangeDelete, Seq: 9, Key: []byte("d"), Value: []byte("f")},
+	}
+
+	path := t.TempDir() + "/props.sst"
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	before := time.Now().UnixNano()
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, 3, 0.01, nil, compression.Snappy, rangeDels)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	props := reader.Properties()
+	require.NotNil(t, props)
+	require.Equal(t, uint32(3), props.EntryCount)
+	require.Equal(t, uint32(1), props.TombstoneCount)
+	require.Equal(t, uint32(1), props.RangeDelCount)
+	require.Equal(t, uint64(3), props.MinSeq)
+	require.Equal(t, uint64(9), props.MaxSeq)
+	require.Equal(t, uint64(reader.footer.RangeDelOffset), props.DataSize)
+	require.Less(t, props.DataSize, props.RawDataSize, "repetitive values should compress")
+	require.GreaterOrEqual(t, props.CreatedAt, before)
+	require.LessOrEqual(t, props.CreatedAt, time.Now().UnixNano())
+	require.Equal(t, compression.SnappyType, props.Codec)
+	require.Equal(t, "snappy", props.CodecName())
+
+	// The index still reads correctly ahead of the properties block
+	entry, err := reader.Get([]byte("cherry"))
+	require.NoError(t, err)
+	require.Equal(t, entries[2], entry)
+}
+
+func TestSSTableFilterPolicies(t *testing.T) {
+	entries := make([]*common.Entry, 0, 1000)
+	for i := range 1000 {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+
+	for _, policy := range []filter.Policy{filter.None, filter.NewBloomPolicy(10), filter.NewRibbonPolicy(10)} {
+		t.Run(policy.Name(), func(t *testing.T) {
+			path := t.TempDir() + "/filter.sst"
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			_, err = WriteSSTableWithPolicy(f, &testIterator{entries: entries}, uint32(len(entries)), policy, nil, nil, nil)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+			require.NoError(t, err)
+			defer reader.Close()
+			if policy == filter.None {
+				require.Nil(t, reader.filter)
+				require.Equal(t, reader.footer.FilterOffset, reader.footer.IndexOffset, "no filter block")
+			} else {
+				require.NotNil(t, reader.filter)
+			}
+
+			for _, e := range entries {
+				entry, err := reader.Get(e.Key)
+				require.NoError(t, err)
+				require.Equal(t, e.Value, entry.Value)
+			}
+
+			// Filters reject most absent keys without reading a block
+			rejected := 0
+			for i := range 1000 {
+				key := []byte(fmt.Sprintf("other%04d", i))
+				if reader.filter != nil && !reader.filter.MayContain(key) {
+					rejected++
+				}
+				_, err := reader.Get(key)
+				require.ErrorIs(t, err, ErrNotFound)
+			}
+			if policy != filter.None {
+				require.Greater(t, rejected, 900)
+			}
+		})
+	}
+}
+
+func TestSSTableFilterPolicyLegacyFormat(t *testing.T) {
+	// Tables before FormatFilterPolicy store only untyped bloom filters
+	path := t.TempDir() + "/legacy.sst"
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	b := NewBuilder(f, 1, 0.01, nil, nil)
+	b.version = FormatProperties
+	require.NoError(t, b.Add(&common.Entry{Type: common.EntryTypePut, Key: []byte("key"), Value: []byte("value")}))
+	_, err = b.Finish(nil)
+	require.NoError(t, err)
+
+	reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.True(t, reader.filter.MayContain([]byte("key")))
+	require.False(t, reader.filter.MayContain([]byte("absent")))
+
+	b = NewBuilderWithPolicy(io.Discard, 1, filter.NewRibbonPolicy(10), nil, nil)
+	b.version = FormatProperties
+	require.NoError(t, b.Add(&common.Entry{Type: common.EntryTypePut, Key: []byte("key"), Value: []byte("value")}))
+	_, err = b.Finish(nil)
+	require.Error(t, err)
+}
+
+func TestSSTableUnknownFilterType(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := WriteSSTableWithPolicy(&buf, &testIterator{entries: []*common.Entry{
+		{Type: common.EntryTypePut, Key: []byte("key"), Value: []byte("value")},
+	}}, 1, unknownPolicy{filter.NewBloomPolicy(10)}, nil, nil, nil)
+	require.NoError(t, err)
+
+	// The table reads as if it had no filter
+	path := t.TempDir() + "/unknown.sst"
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	reader, err := OpenSSTable(vfs.Default, path, common.FileNo(1), nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Nil(t, reader.filter)
+	entry, err := reader.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), entry.Value)
+}
+
+// unknownPolicy builds filters under a type no policy is registered for.
+type unknownPolicy struct {
+	filter.Policy
+}
+
+func (unknownPolicy) Type() filter.Type { return 200 }
+
+func TestSSTableMmap(t *testing.T) {
+	entries := make([]*common.Entry, 0, 3*block.BLOCK_SIZE)
+	for i := range 3 * block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%04d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+
+	for _, codec := range []compression.Codec{nil, compression.Snappy} {
+		t.Run(fmt.Sprintf("codec=%v", codec), func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := WriteSSTable(&buf, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, codec, nil)
+			require.NoError(t, err)
+			path := t.TempDir() + "/mmap.sst"
+			require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+
+			cache := block_cache.NewBlockCache(1 << 20)
+			reader, err := OpenSSTableWithOptions(vfs.Default, path, common.FileNo(1), cache, OpenOptions{Mmap: true})
+			require.NoError(t, err)
+			require.NotNil(t, reader.mapped)
+
+			for _, i := range []int{0, 100, len(entries) - 1} {
+				entry, err := reader.Get(entries[i].Key)
+				require.NoError(t, err)
+				require.Equal(t, entries[i], entry)
+			}
+			iter := reader.Iterator()
+			for _, want := range entries {
+				got, err := iter.Next()
+				require.NoError(t, err)
+				require.Equal(t, want, got)
+			}
+
+			// Cached blocks and lookups outlive the mapping
+			require.NoError(t, reader.Close())
+			require.Nil(t, reader.mapped)
+			entry, err := reader.GetCached(entries[100].Key)
+			require.NoError(t, err)
+			require.Equal(t, entries[100], entry)
+			entry, err = reader.Get(entries[len(entries)/2].Key)
+			require.NoError(t, err)
+			require.Equal(t, entries[len(entries)/2], entry)
+		})
+	}
+
+	// Files that can't be mapped are read through the file
+	fsys := vfs.NewMemFS()
+	f, err := fsys.Create("mem.sst")
+	require.NoError(t, err)
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	reader, err := OpenSSTableWithOptions(fsys, "mem.sst", common.FileNo(1), nil, OpenOptions{Mmap: true})
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Nil(t, reader.mapped)
+	entry, err := reader.Get(entries[7].Key)
+	require.NoError(t, err)
+	require.Equal(t, entries[7], entry)
+}
+
+// countingFS counts the reads made through the files it opens.
+type countingFS struct {
+	vfs.FS
+	reads *int
+}
+
+func (c countingFS) Open(name string) (vfs.File, error) {
+	f, err := c.FS.Open(name)
+	return countingFile{File: f, reads: c.reads}, err
+}
+
+type countingFile struct {
+	vfs.File
+	reads *int
+}
+
+func (f countingFile) ReadAt(p []byte, off int64) (int, error) {
+	*f.reads++
+	return f.File.ReadAt(p, off)
+}
+
+func TestSSTableReadahead(t *testing.T) {
+	entries := make([]*common.Entry, 0, 20*block.BLOCK_SIZE)
+	for i := range 20 * block.BLOCK_SIZE {
+		entries = append(entries, &common.Entry{
+			Type:  common.EntryTypePut,
+			Seq:   uint64(i + 1),
+			Key:   []byte(fmt.Sprintf("key%05d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		})
+	}
+	mem := vfs.NewMemFS()
+	f, err := mem.Create("scan.sst")
+	require.NoError(t, err)
+	_, err = WriteSSTable(f, &testIterator{entries: entries}, uint32(len(entries)), 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	tests := []struct {
+		name      string
+		readahead int
+		wantReads int
+	}{
+		{"BlockByBlock", 0, 20},
+		{"SmallerThanBlock", 100, 20},
+		{"Default", DefaultReadaheadSize, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reads := 0
+			reader, err := OpenSSTable(countingFS{FS: mem, reads: &reads}, "scan.sst", common.FileNo(1), nil)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			reads = 0
+			iter := reader.IteratorWithOptions(ReadOptions{VerifyChecksums: true, ReadaheadSize: tt.readahead})
+			for _, want := range entries {
+				got, err := iter.Next()
+				require.NoError(t, err)
+				require.Equal(t, want, got)
+			}
+			got, err := iter.Next()
+			require.NoError(t, err)
+			require.Nil(t, got)
+			require.Equal(t, tt.wantReads, reads)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package table_cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+)
+
+// DefaultMaxOpenFiles is the table cache limit used when none is configured.
+const DefaultMaxOpenFiles = 1000
+
+type cachedTable struct {
+	path  string
+	table sstable.SSTable
+}
+
+// tableCacheImpl keeps up to maxOpen tables open, closing the least recently
+// used one to make room for another.
+type tableCacheImpl struct {
+	mu         sync.Mutex
+	fs         vfs.FS
+	maxOpen    int
+	tables     map[string]*list.Element
+	order      *list.List // front is most recently used
+	blockCache block_cache.BlockCache
+	openOpts   sstable.OpenOptions
+	stats      Stats
+
+	// nextID hands out cache-unique IDs. Tables are opened with this ID in place
+	// of their file number so block cache keys never collide between databases
+	// that share the same block cache.
+	nextID common.FileNo
+}
+
+var _ TableCache = (*tableCacheImpl)(nil)
+
+// NewTableCache creates a table cache that opens tables from fsys, keeping at
+// most maxOpenFiles of them open, and shares blockCache between them. A limit
+// of 0 or less keeps every table open.
+func NewTableCache(fsys vfs.FS, blockCache block_cache.BlockCache, maxOpenFiles int) TableCache {
+	return NewTableCacheWithOptions(fsys, blockCache, maxOpenFiles, sstable.OpenOptions{})
+}
+
+// NewTableCacheWithOptions is like NewTableCache but opens tables as opts
+// specify.
+func NewTableCacheWithOptions(fsys vfs.FS, blockCache block_cache.BlockCache, maxOpenFiles int, opts sstable.OpenOptions) TableCache {
+	if opts.Logger == nil {
+		opts.Logger = common.DefaultLogger
+	}
+	return &tableCacheImpl{
+		fs:         fsys,
+		maxOpen:    maxOpenFiles,
+		tables:     make(map[string]*list.Element),
+		order:      list.New(),
+		blockCache: blockCache,
+		openOpts:   opts,
+	}
+}
+
+func (c *tableCacheImpl) Get(path string, checksum uint32) (sstable.SSTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.tables[path]; ok {
+		c.stats.Hits++
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cachedTable).table, nil
+	}
+	c.stats.Misses++
+
+	if checksum != 0 {
+		actual, err := c.checksum(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s: %w", path, err)
+		}
+		if actual != checksum {
+			return nil, fmt.Errorf("%w: %s is %08x, expected %08x", ErrChecksumMismatch, path, actual, checksum)
+		}
+	}
+
+	table, err := sstable.OpenSSTableWithOptions(c.fs, path, c.nextID, c.blockCache, c.openOpts)
+	if err != nil {
+		return nil, err
+	}
+	c.nextID++
+
+	c.tables[path] = c.order.PushFront(&cachedTable{path: path, table: table})
+	c.stats.Inserts++
+	for c.maxOpen > 0 && c.order.Len() > c.maxOpen {
+		c.stats.Evictions++
+		// The evicted table keeps serving readers that already hold it
+		evicted := c.order.Back().Value.(*cachedTable).path
+		if err := c.remove(c.order.Back()); err != nil {
+			c.openOpts.Logger.Log(common.LevelWarn, "failed to close evicted table", "path", evicted, "err", err)
+		}
+	}
+	return table, nil
+}
+
+func (c *tableCacheImpl) Lookup(path string) (sstable.SSTable, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.tables[path]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedTable).table, true
+}
+
+func (c *tableCacheImpl) checksum(path string) (uint32, error) {
+	f, err := c.fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return common.Checksum(f)
+}
+
+func (c *tableCacheImpl) Evict(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.tables[path]
+	if !ok {
+		return nil
+	}
+	return c.remove(elem)
+}
+
+// remove closes and forgets the table at elem.
+// Must be called with c.mu held.
+func (c *tableCacheImpl) remove(elem *list.Element) error {
+	cached := c.order.Remove(elem).(*cachedTable)
+	delete(c.tables, cached.path)
+	return cached.table.Close()
+}
+
+func (c *tableCacheImpl) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tables)
+}
+
+func (c *tableCacheImpl) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,56 @@
+package table_cache
+
+import (
+	"errors"
+
+	"amethyst/internal/sstable"
+)
+
+// ErrChecksumMismatch reports a table whose contents don't match the checksum
+// recorded when it was written.
+var ErrChecksumMismatch = errors.New("table_cache: checksum mismatch")
+
+// TableCache provides a shared pool of open SSTable handles, keyed by file path
+// so that tables from several databases can live in one cache. Once the pool
+// is full, opening another table closes the least recently used one.
+type TableCache interface {
+	// Get returns the open table at path, opening it on first use. A non-zero
+	// checksum is compared against the file's CRC32C when it is first opened,
+	// failing with ErrChecksumMismatch on a difference.
+	Get(path string, checksum uint32) (sstable.SSTable, error)
+
+	// Lookup returns the table at path only if it is already open.
+	Lookup(path string) (sstable.SSTable, bool)
+
+	// Evict closes and forgets the table at path. No-op if it is not open.
+	Evict(path string) error
+
+	// Len returns the number of open tables.
+	Len() int
+
+	// Stats returns the cache's counters since it was created.
+	Stats() Stats
+}
+
+// Stats counts table cache lookups and changes.
+type Stats struct {
+	// Hits and Misses count the lookups by Get and Lookup that found the
+	// table open and that didn't.
+	Hits   uint64
+	Misses uint64
+
+	// Inserts counts the tables opened, and Evictions those closed to make
+	// room for others. Evictions close behind Inserts mean the open tables
+	// churn, and a larger limit would save reopening them.
+	Inserts   uint64
+	Evictions uint64
+}
+
+// HitRate returns the share of lookups that found their table open, or 0
+// before any lookup.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
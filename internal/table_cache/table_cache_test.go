@@ -0,0 +1,175 @@
+package table_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/block_cache"
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+	"amethyst/internal/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceIterator struct {
+	entries []*common.Entry
+	index   int
+}
+
+func (it *sliceIterator) Next() (*common.Entry, error) {
+	if it.index >= len(it.entries) {
+		return nil, nil
+	}
+	entry := it.entries[it.index]
+	it.index++
+	return entry, nil
+}
+
+func writeTable(t *testing.T, path string, key, value string) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	iter := &sliceIterator{entries: []*common.Entry{
+		{Type: common.EntryTypePut, Seq: 1, Key: []byte(key), Value: []byte(value)},
+	}}
+	_, err = sstable.WriteSSTable(f, iter, 1, 0.01, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestTableCacheGetAndEvict(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.sst")
+	pathB := filepath.Join(dir, "b.sst")
+	writeTable(t, pathA, "k", "a")
+	writeTable(t, pathB, "k", "b")
+
+	cache := NewTableCache(vfs.Default, block_cache.NewBlockCache(block_cache.DefaultCapacity), DefaultMaxOpenFiles)
+
+	tableA, err := cache.Get(pathA, 0)
+	require.NoError(t, err)
+	again, err := cache.Get(pathA, 0)
+	require.NoError(t, err)
+	require.Same(t, tableA, again, "second Get should return the cached handle")
+
+	tableB, err := cache.Get(pathB, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Len())
+
+	// Same key in different files must resolve to each file's own value
+	entry, err := tableA.Get([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), entry.Value)
+	entry, err = tableB.Get([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("b"), entry.Value)
+
+	require.NoError(t, cache.Evict(pathA))
+	require.Equal(t, 1, cache.Len())
+	require.NoError(t, cache.Evict(pathA), "evicting an absent table is a no-op")
+}
+
+func TestTableCacheMissingFile(t *testing.T) {
+	cache := NewTableCache(vfs.Default, nil, DefaultMaxOpenFiles)
+	_, err := cache.Get(filepath.Join(t.TempDir(), "missing.sst"), 0)
+	require.Error(t, err)
+	require.Equal(t, 0, cache.Len())
+}
+
+func TestTableCacheChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.sst")
+	writeTable(t, path, "k", "a")
+	actual, err := common.ChecksumFile(vfs.Default, path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		checksum uint32
+		wantErr  bool
+	}{
+		{"unverified", 0, false},
+		{"match", actual, false},
+		{"mismatch", actual + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewTableCache(vfs.Default, nil, DefaultMaxOpenFiles)
+			_, err := cache.Get(path, tt.checksum)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrChecksumMismatch)
+				require.Equal(t, 0, cache.Len())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, cache.Len())
+		})
+	}
+}
+
+func TestTableCacheMaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name+".sst")
+		writeTable(t, path, "k", name)
+		paths = append(paths, path)
+	}
+
+	cache := NewTableCache(vfs.Default, nil, 2)
+	tableA, err := cache.Get(paths[0], 0)
+	require.NoError(t, err)
+	_, err = cache.Get(paths[1], 0)
+	require.NoError(t, err)
+
+	// Touching a leaves b as the least recently used, so c displaces it
+	_, ok := cache.Lookup(paths[0])
+	require.True(t, ok)
+	_, err = cache.Get(paths[2], 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Len())
+
+	tests := []struct {
+		path string
+		open bool
+	}{
+		{paths[0], true},
+		{paths[1], false},
+		{paths[2], true},
+	}
+	for _, tt := range tests {
+		_, ok := cache.Lookup(tt.path)
+		require.Equal(t, tt.open, ok, tt.path)
+	}
+
+	// A handle evicted out from under its reader still serves lookups
+	require.NoError(t, cache.Evict(paths[0]))
+	entry, err := tableA.Get([]byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), entry.Value)
+}
+
+func TestTableCacheStats(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, name+".sst")
+		writeTable(t, path, "k", name)
+		paths = append(paths, path)
+	}
+
+	cache := NewTableCache(vfs.Default, nil, 2)
+	for _, path := range []string{paths[0], paths[0], paths[1], paths[2]} {
+		_, err := cache.Get(path, 0)
+		require.NoError(t, err)
+	}
+	_, ok := cache.Lookup(paths[0])
+	require.False(t, ok, "a was evicted to open c")
+
+	// Evict drops a table without counting as an eviction
+	require.NoError(t, cache.Evict(paths[1]))
+	stats := cache.Stats()
+	require.Equal(t, Stats{Hits: 1, Misses: 4, Inserts: 3, Evictions: 1}, stats)
+	require.InDelta(t, 0.2, stats.HitRate(), 1e-9)
+}
@@ -0,0 +1,118 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// directAlignment is the alignment O_DIRECT requires of the offset,
+	// length, and memory of each write.
+	directAlignment = 4096
+
+	// directBufferSize is how much a direct I/O file gathers before writing.
+	directBufferSize = 1 << 20
+)
+
+// directFS opens the files it creates with O_DIRECT.
+type directFS struct {
+	FS
+}
+
+// NewDirectIOFS returns fsys with files made through Create written with
+// O_DIRECT, bypassing the operating system's page cache, so large background
+// writes don't evict the pages foreground reads depend on. Writes are
+// gathered into aligned buffers, so such files must be written
+// sequentially; reads and seeks through them aren't supported.
+//
+// Filesystems that refuse O_DIRECT, such as tmpfs, get ordinary files, and
+// on platforms without it fsys is returned unchanged.
+func NewDirectIOFS(fsys FS) FS {
+	if oDirect == 0 {
+		return fsys
+	}
+	return &directFS{FS: fsys}
+}
+
+func (d *directFS) Create(name string) (File, error) {
+	f, err := d.FS.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC|oDirect, 0666)
+	if errors.Is(err, syscall.EINVAL) {
+		return d.FS.Create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &directFile{File: f, buf: alignedBuffer(directBufferSize)}, nil
+}
+
+// directFile writes in aligned blocks of directBufferSize. A partial block
+// is written padded to the alignment, then truncated, whenever the file is
+// synced or closed, and rewritten in full once it fills.
+type directFile struct {
+	File
+	buf []byte // bytes from off not yet written as a full block
+	n   int    // length of buf in use
+	off int64  // file offset of buf[0], a multiple of directAlignment
+}
+
+func (f *directFile) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c := copy(f.buf[f.n:], p)
+		f.n += c
+		p = p[c:]
+		written += c
+		if f.n == len(f.buf) {
+			if err := f.writeAt(f.buf); err != nil {
+				return written, err
+			}
+			f.off += int64(len(f.buf))
+			f.n = 0
+		}
+	}
+	return written, nil
+}
+
+// flush writes the partial block, padded to the alignment, and truncates
+// the padding off again.
+func (f *directFile) flush() error {
+	if f.n == 0 {
+		return nil
+	}
+	padded := (f.n + directAlignment - 1) &^ (directAlignment - 1)
+	clear(f.buf[f.n:padded])
+	if err := f.writeAt(f.buf[:padded]); err != nil {
+		return err
+	}
+	return f.File.Truncate(f.off + int64(f.n))
+}
+
+func (f *directFile) writeAt(b []byte) error {
+	if _, err := f.File.Seek(f.off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := f.File.Write(b)
+	return err
+}
+
+func (f *directFile) Sync() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *directFile) Close() error {
+	return errors.Join(f.flush(), f.File.Close())
+}
+
+// alignedBuffer returns a buffer of size bytes whose memory starts on a
+// directAlignment boundary.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directAlignment)
+	shift := -int(uintptr(unsafe.Pointer(&buf[0]))) & (directAlignment - 1)
+	return buf[shift : shift+size : shift+size]
+}
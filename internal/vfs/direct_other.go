@@ -0,0 +1,6 @@
+//go:build !linux
+
+package vfs
+
+// oDirect is 0 where the platform has no O_DIRECT.
+const oDirect = 0
@@ -0,0 +1,13 @@
+package vfs
+
+// AdviseSequential tells the operating system that f will be read
+// sequentially, so it can read further ahead and drop pages sooner. It is
+// only a hint: files without a file descriptor, and platforms without
+// fadvise, return ErrUnsupported and are read as before.
+func AdviseSequential(f File) error {
+	fd, ok := f.(fdFile)
+	if !ok {
+		return ErrUnsupported
+	}
+	return adviseSequential(fd.Fd())
+}
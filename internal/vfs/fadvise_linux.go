@@ -0,0 +1,7 @@
+package vfs
+
+import "golang.org/x/sys/unix"
+
+func adviseSequential(fd uintptr) error {
+	return unix.Fadvise(int(fd), 0, 0, unix.FADV_SEQUENTIAL)
+}
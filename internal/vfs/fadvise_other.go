@@ -0,0 +1,7 @@
+//go:build !linux
+
+package vfs
+
+func adviseSequential(fd uintptr) error {
+	return ErrUnsupported
+}
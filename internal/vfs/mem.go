@@ -0,0 +1,455 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNotEmpty = errors.New("directory not empty")
+
+// memFS keeps every file in memory. Nothing survives the process, which makes
+// it suited to hermetic tests.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+	dirs  map[string]struct{}
+}
+
+// memNode holds a file's contents, shared by every link to it.
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+var _ FS = (*memFS)(nil)
+
+// NewMemFS returns an empty in-memory FS.
+func NewMemFS() FS {
+	return &memFS{
+		files: make(map[string]*memNode),
+		dirs:  make(map[string]struct{}),
+	}
+}
+
+// isDir reports whether path is a directory. The roots always exist.
+// Must be called with m.mu held.
+func (m *memFS) isDir(path string) bool {
+	if path == "." || path == string(filepath.Separator) {
+		return true
+	}
+	_, ok := m.dirs[path]
+	return ok
+}
+
+func (m *memFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := filepath.Clean(name)
+	node, ok := m.files[path]
+	switch {
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok:
+		if m.isDir(path) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if !m.isDir(filepath.Dir(path)) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		node = &memNode{modTime: time.Now()}
+		m.files[path] = node
+	}
+
+	access := flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	f := &memFile{
+		name:   name,
+		node:   node,
+		read:   access != os.O_WRONLY,
+		write:  access != os.O_RDONLY,
+		append: flag&os.O_APPEND != 0,
+	}
+	if flag&os.O_TRUNC != 0 && f.write {
+		node.mu.Lock()
+		node.data = nil
+		node.modTime = time.Now()
+		node.mu.Unlock()
+	}
+	return f, nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := filepath.Clean(name)
+	if _, ok := m.files[path]; ok {
+		delete(m.files, path)
+		return nil
+	}
+	if !m.isDir(path) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if len(m.children(path)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.dirs, path)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := filepath.Clean(name)
+	prefix := path + string(filepath.Separator)
+	for p := range m.files {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(m.files, p)
+		}
+	}
+	for p := range m.dirs {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(m.dirs, p)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, dst := filepath.Clean(oldpath), filepath.Clean(newpath)
+	if m.isDir(src) {
+		if err := m.renameDir(src, dst); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+		}
+		return nil
+	}
+	node, ok := m.files[src]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if !m.isDir(filepath.Dir(dst)) || m.isDir(dst) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, src)
+	m.files[dst] = node
+	return nil
+}
+
+// renameDir moves the directory src and everything under it to dst, which
+// must not exist or be an empty directory, as rename(2) does.
+// Must be called with m.mu held.
+func (m *memFS) renameDir(src, dst string) error {
+	sep := string(filepath.Separator)
+	switch {
+	case src == dst:
+		return nil
+	case !m.isDir(filepath.Dir(dst)):
+		return fs.ErrNotExist
+	case strings.HasPrefix(dst, src+sep):
+		return fs.ErrInvalid
+	case m.files[dst] != nil:
+		return fs.ErrExist
+	case m.isDir(dst) && len(m.children(dst)) > 0:
+		return errNotEmpty
+	}
+
+	moved := func(p string) (string, bool) {
+		if p == src {
+			return dst, true
+		}
+		if rest, ok := strings.CutPrefix(p, src+sep); ok {
+			return filepath.Join(dst, rest), true
+		}
+		return "", false
+	}
+	for p, node := range m.files {
+		if q, ok := moved(p); ok {
+			delete(m.files, p)
+			m.files[q] = node
+		}
+	}
+	for p := range m.dirs {
+		if q, ok := moved(p); ok {
+			delete(m.dirs, p)
+			m.dirs[q] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, dst := filepath.Clean(oldname), filepath.Clean(newname)
+	node, ok := m.files[src]
+	if !ok || !m.isDir(filepath.Dir(dst)) {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, exists := m.files[dst]; exists || m.isDir(dst) {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	m.files[dst] = node
+	return nil
+}
+
+func (m *memFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path := filepath.Clean(name); !m.isDir(path); path = filepath.Dir(path) {
+		if _, ok := m.files[path]; ok {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		m.dirs[path] = struct{}{}
+	}
+	return nil
+}
+
+// children returns the names directly inside dir.
+// Must be called with m.mu held.
+func (m *memFS) children(dir string) []string {
+	var names []string
+	for p := range m.dirs {
+		if p != dir && filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	for p := range m.files {
+		if filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir := filepath.Clean(name)
+	if !m.isDir(dir) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for _, child := range m.children(dir) {
+		entries = append(entries, fs.FileInfoToDirEntry(m.stat(filepath.Join(dir, child))))
+	}
+	return entries, nil
+}
+
+// stat returns info for an existing file or directory, or nil.
+// Must be called with m.mu held.
+func (m *memFS) stat(path string) fs.FileInfo {
+	if node, ok := m.files[path]; ok {
+		return node.info(filepath.Base(path))
+	}
+	if m.isDir(path) {
+		return &memFileInfo{name: filepath.Base(path), dir: true}
+	}
+	return nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := m.stat(filepath.Clean(name))
+	if info == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+func (m *memFS) SyncDir(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.isDir(filepath.Clean(path)) {
+		return &fs.PathError{Op: "sync", Path: path, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return &memFileInfo{name: name, size: int64(len(n.data)), modTime: n.modTime}
+}
+
+// memFile is an open handle with its own offset into a memNode.
+type memFile struct {
+	name   string
+	node   *memNode
+	pos    int64
+	read   bool
+	write  bool
+	append bool
+	closed bool
+}
+
+var _ File = (*memFile)(nil)
+
+func (f *memFile) check(op string, allowed bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if !allowed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if err := f.check("read", f.read); err != nil {
+		return 0, err
+	}
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", f.read); err != nil {
+		return 0, err
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if err := f.check("write", f.write); err != nil {
+		return 0, err
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	if f.append {
+		f.pos = int64(len(f.node.data))
+	}
+	if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.pos:], p)
+	f.pos += int64(len(p))
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", true); err != nil {
+		return 0, err
+	}
+	f.node.mu.RLock()
+	size := int64(len(f.node.data))
+	f.node.mu.RUnlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	if err := f.check("truncate", f.write); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	return f.check("sync", true)
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	if err := f.check("stat", true); err != nil {
+		return nil, err
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Close() error {
+	if err := f.check("close", true); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.dir }
+func (i *memFileInfo) Sys() any           { return nil }
+
+func (i *memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,27 @@
+package vfs
+
+// fdFile is implemented by files backed by an operating system file
+// descriptor, such as those of the OS filesystem.
+type fdFile interface {
+	Fd() uintptr
+}
+
+// Mmap maps the first size bytes of f into memory, read-only. The mapping
+// stays valid after f is closed, until it is passed to Munmap; touching it
+// afterwards crashes the process.
+//
+// It returns ErrUnsupported for files without a file descriptor, such as
+// those of NewMemFS, and on platforms without mmap, where callers should
+// read through the file instead.
+func Mmap(f File, size int64) ([]byte, error) {
+	fd, ok := f.(fdFile)
+	if !ok || size <= 0 {
+		return nil, ErrUnsupported
+	}
+	return mmap(fd.Fd(), size)
+}
+
+// Munmap releases a mapping returned by Mmap.
+func Munmap(data []byte) error {
+	return munmap(data)
+}
@@ -0,0 +1,11 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package vfs
+
+func mmap(fd uintptr, size int64) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func munmap(data []byte) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,24 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package vfs
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+)
+
+func mmap(fd uintptr, size int64) ([]byte, error) {
+	if size > math.MaxInt {
+		return nil, fmt.Errorf("mmap: %d bytes is too large to map", size)
+	}
+	data, err := syscall.Mmap(int(fd), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mmap: %w", err)
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
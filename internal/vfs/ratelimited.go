@@ -0,0 +1,49 @@
+package vfs
+
+import (
+	"io/fs"
+
+	"amethyst/internal/ratelimit"
+)
+
+// rateLimitedFS paces writes to the files it creates or opens for writing.
+type rateLimitedFS struct {
+	FS
+	limiter ratelimit.Limiter
+}
+
+// NewRateLimitedFS returns fsys with every write to files opened through
+// Create and OpenFile first waiting on limiter. A nil limiter returns fsys
+// unchanged.
+func NewRateLimitedFS(fsys FS, limiter ratelimit.Limiter) FS {
+	if limiter == nil {
+		return fsys
+	}
+	return &rateLimitedFS{FS: fsys, limiter: limiter}
+}
+
+func (r *rateLimitedFS) Create(name string) (File, error) {
+	f, err := r.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedFile{File: f, limiter: r.limiter}, nil
+}
+
+func (r *rateLimitedFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := r.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedFile{File: f, limiter: r.limiter}, nil
+}
+
+type rateLimitedFile struct {
+	File
+	limiter ratelimit.Limiter
+}
+
+func (f *rateLimitedFile) Write(p []byte) (int, error) {
+	f.limiter.Wait(len(p))
+	return f.File.Write(p)
+}
@@ -0,0 +1,63 @@
+package vfs
+
+import "io/fs"
+
+// syncingFS wraps the files it creates or opens for writing in syncingFile.
+type syncingFS struct {
+	FS
+	bytesPerSync int64
+}
+
+// NewSyncingFS returns fsys with files opened through Create and OpenFile
+// synced after every bytesPerSync bytes written. Writing back dirty pages as
+// a large file grows keeps the final Sync from stalling on all of them at
+// once. bytesPerSync <= 0 returns fsys unchanged.
+func NewSyncingFS(fsys FS, bytesPerSync int64) FS {
+	if bytesPerSync <= 0 {
+		return fsys
+	}
+	return &syncingFS{FS: fsys, bytesPerSync: bytesPerSync}
+}
+
+func (s *syncingFS) Create(name string) (File, error) {
+	f, err := s.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &syncingFile{File: f, bytesPerSync: s.bytesPerSync}, nil
+}
+
+func (s *syncingFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := s.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &syncingFile{File: f, bytesPerSync: s.bytesPerSync}, nil
+}
+
+// syncingFile syncs once bytesPerSync bytes have been written since the
+// last sync.
+type syncingFile struct {
+	File
+	bytesPerSync int64
+	unsynced     int64
+}
+
+func (f *syncingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.unsynced += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if f.unsynced >= f.bytesPerSync {
+		if err := f.Sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *syncingFile) Sync() error {
+	f.unsynced = 0
+	return f.File.Sync()
+}
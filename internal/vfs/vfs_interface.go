@@ -0,0 +1,68 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	// Seek sets the offset of the next Read or Write, which a file opened
+	// with O_APPEND ignores.
+	io.Seeker
+
+	// Sync makes the file's contents durable.
+	Sync() error
+	// Truncate changes the size of the file, discarding data past size or
+	// extending it with zeros.
+	Truncate(size int64) error
+	Stat() (fs.FileInfo, error)
+	// Name returns the path the file was opened with.
+	Name() string
+}
+
+// ErrUnsupported is returned by optional operations a backend can't provide.
+var ErrUnsupported = errors.ErrUnsupported
+
+// FS is the filesystem the storage engine reads and writes through. Its
+// methods mirror their counterparts in package os.
+//
+// Backends for constrained targets (browser storage, flash) may return
+// ErrUnsupported from Link and SyncDir; the engine copies instead of linking
+// and skips directory syncs.
+type FS interface {
+	Create(name string) (File, error)
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+	// Link makes newname refer to the same file as oldname.
+	Link(oldname, newname string) error
+
+	MkdirAll(path string, perm fs.FileMode) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+
+	// SyncDir makes creations, renames, and removals within a directory
+	// durable.
+	SyncDir(path string) error
+}
+
+// Default is the operating system's filesystem.
+var Default = NewOSFS()
+
+// SyncDir calls fsys.SyncDir, treating ErrUnsupported as success: a backend
+// without directory metadata has nothing to make durable.
+func SyncDir(fsys FS, path string) error {
+	if err := fsys.SyncDir(path); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
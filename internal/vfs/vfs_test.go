@@ -0,0 +1,276 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys FS
+	}{
+		{"OS", NewOSFS()},
+		{"Mem", NewMemFS()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := tt.fsys
+			dir := filepath.Join(t.TempDir(), "a", "b")
+			require.NoError(t, fsys.MkdirAll(dir, 0755))
+
+			// Files can't be created in missing directories
+			_, err := fsys.Create(filepath.Join(dir, "missing", "x"))
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			path := filepath.Join(dir, "file")
+			f, err := fsys.Create(path)
+			require.NoError(t, err)
+			_, err = f.Write([]byte("hello"))
+			require.NoError(t, err)
+			require.NoError(t, f.Sync())
+			require.NoError(t, f.Close())
+
+			// Appends land at the end regardless of the handle's offset
+			f, err = fsys.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			require.NoError(t, err)
+			_, err = f.Write([]byte(" world"))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			f, err = fsys.Open(path)
+			require.NoError(t, err)
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.Equal(t, "hello world", string(data))
+			buf := make([]byte, 5)
+			n, err := f.ReadAt(buf, 6)
+			require.NoError(t, err)
+			require.Equal(t, "world", string(buf[:n]))
+			_, err = f.Write([]byte("x"))
+			require.Error(t, err)
+			info, err := f.Stat()
+			require.NoError(t, err)
+			require.Equal(t, int64(11), info.Size())
+			require.NoError(t, f.Close())
+
+			// Links share contents; renames move them
+			linked := filepath.Join(dir, "linked")
+			require.NoError(t, fsys.Link(path, linked))
+			renamed := filepath.Join(dir, "renamed")
+			require.NoError(t, fsys.Rename(path, renamed))
+			_, err = fsys.Stat(path)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			info, err = fsys.Stat(linked)
+			require.NoError(t, err)
+			require.Equal(t, int64(11), info.Size())
+
+			entries, err := fsys.ReadDir(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			require.Equal(t, []string{"linked", "renamed"}, names)
+			require.NoError(t, fsys.SyncDir(dir))
+
+			// Directories move with everything under them
+			sub := filepath.Join(dir, "sub")
+			require.NoError(t, fsys.MkdirAll(filepath.Join(sub, "nested"), 0755))
+			f, err = fsys.Create(filepath.Join(sub, "nested", "file"))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			require.Error(t, fsys.Rename(sub, filepath.Join(sub, "nested", "inside")))
+			require.Error(t, fsys.Rename(sub, filepath.Join(dir, "missing", "sub")))
+			moved := filepath.Join(dir, "moved")
+			require.NoError(t, fsys.Rename(sub, moved))
+			_, err = fsys.Stat(sub)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			info, err = fsys.Stat(filepath.Join(moved, "nested", "file"))
+			require.NoError(t, err)
+			require.Zero(t, info.Size())
+			require.NoError(t, fsys.RemoveAll(moved))
+
+			require.Error(t, fsys.Remove(dir))
+			require.NoError(t, fsys.Remove(linked))
+			require.NoError(t, fsys.RemoveAll(filepath.Dir(dir)))
+			_, err = fsys.Stat(dir)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
+
+// countingFile counts Syncs reaching the underlying file.
+type countingFile struct {
+	File
+	syncs *int
+}
+
+func (f countingFile) Sync() error {
+	*f.syncs++
+	return f.File.Sync()
+}
+
+type countingFS struct {
+	FS
+	syncs int
+}
+
+func (c *countingFS) Create(name string) (File, error) {
+	f, err := c.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return countingFile{File: f, syncs: &c.syncs}, nil
+}
+
+func TestSyncingFS(t *testing.T) {
+	tests := []struct {
+		name         string
+		bytesPerSync int64
+		writes       []int
+		syncs        int
+	}{
+		{"Disabled", 0, []int{100, 100}, 0},
+		{"BelowThreshold", 64, []int{10, 20, 30}, 0},
+		{"EveryThreshold", 64, []int{40, 40, 40, 40}, 2},
+		{"LargeWrite", 64, []int{200}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counting := &countingFS{FS: NewMemFS()}
+			fsys := NewSyncingFS(counting, tt.bytesPerSync)
+
+			dir := t.TempDir()
+			require.NoError(t, counting.MkdirAll(dir, 0755))
+			f, err := fsys.Create(filepath.Join(dir, "file"))
+			require.NoError(t, err)
+			for _, n := range tt.writes {
+				_, err := f.Write(make([]byte, n))
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.syncs, counting.syncs)
+			require.NoError(t, f.Close())
+		})
+	}
+}
+
+// recordingLimiter records the sizes it is asked to wait for.
+type recordingLimiter struct {
+	waits []int
+}
+
+func (l *recordingLimiter) Wait(n int) {
+	l.waits = append(l.waits, n)
+}
+
+func TestRateLimitedFS(t *testing.T) {
+	memFS := NewMemFS()
+	require.Equal(t, memFS, NewRateLimitedFS(memFS, nil))
+
+	limiter := &recordingLimiter{}
+	fsys := NewRateLimitedFS(memFS, limiter)
+	dir := t.TempDir()
+	require.NoError(t, memFS.MkdirAll(dir, 0755))
+
+	tests := []struct {
+		name string
+		open func(name string) (File, error)
+	}{
+		{"Create", fsys.Create},
+		{"OpenFile", func(name string) (File, error) {
+			return fsys.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter.waits = nil
+			f, err := tt.open(filepath.Join(dir, tt.name))
+			require.NoError(t, err)
+			for _, n := range []int{10, 300} {
+				_, err := f.Write(make([]byte, n))
+				require.NoError(t, err)
+			}
+			require.NoError(t, f.Close())
+			require.Equal(t, []int{10, 300}, limiter.waits)
+		})
+	}
+}
+
+func TestMmap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	require.NoError(t, os.WriteFile(path, []byte("mapped contents"), 0644))
+	f, err := Default.Open(path)
+	require.NoError(t, err)
+	data, err := Mmap(f, 15)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// The mapping outlives the file
+	require.Equal(t, "mapped contents", string(data))
+	require.NoError(t, Munmap(data))
+
+	mem := NewMemFS()
+	mf, err := mem.Create("f")
+	require.NoError(t, err)
+	defer mf.Close()
+	_, err = mf.Write([]byte("x"))
+	require.NoError(t, err)
+	_, err = Mmap(mf, 1)
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestDirectIOFS(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys FS
+	}{
+		{"OS", NewOSFS()},
+		{"Mem", NewMemFS()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := NewDirectIOFS(tt.fsys)
+			dir := t.TempDir()
+			require.NoError(t, fsys.MkdirAll(dir, 0755))
+			path := filepath.Join(dir, "direct")
+			f, err := fsys.Create(path)
+			require.NoError(t, err)
+
+			// Odd-sized writes straddle the alignment and the buffer, with
+			// syncs leaving partial blocks to be rewritten
+			var want []byte
+			for i := range 700 {
+				chunk := make([]byte, 3001+i)
+				for j := range chunk {
+					chunk[j] = byte(i + j)
+				}
+				n, err := f.Write(chunk)
+				require.NoError(t, err)
+				require.Equal(t, len(chunk), n)
+				want = append(want, chunk...)
+				if i%250 == 0 {
+					require.NoError(t, f.Sync())
+				}
+			}
+			require.NoError(t, f.Sync())
+			require.NoError(t, f.Close())
+
+			r, err := tt.fsys.Open(path)
+			require.NoError(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, len(want), len(got))
+			require.Equal(t, want, got)
+		})
+	}
+}
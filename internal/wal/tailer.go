@@ -0,0 +1,75 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"amethyst/internal/common"
+	"amethyst/internal/vfs"
+)
+
+// Tailer reads a log that another process may still be appending to,
+// returning on each call the records completed since the last.
+type Tailer struct {
+	fs     vfs.FS
+	path   string
+	offset int64 // end of the last complete record read
+}
+
+// NewTailer returns a Tailer that reads the log at path from its start.
+func NewTailer(fsys vfs.FS, path string) *Tailer {
+	return &Tailer{fs: fsys, path: path}
+}
+
+// ReadNew returns the entries of the records appended since the previous
+// call, in log order. A record still being written at the end of the log
+// is left for a later call, as are preallocated zeros; a damaged record
+// before the end fails with ErrCorruptRecord, returned along with the
+// entries of the records before it.
+func (t *Tailer) ReadNew() ([]*common.Entry, error) {
+	f, err := t.fs.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", t.path, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	it := &walIterator{
+		file:    f,
+		reader:  bufio.NewReader(f),
+		size:    stat.Size(),
+		offset:  t.offset,
+		payload: bytes.NewReader(nil),
+	}
+	defer it.Close()
+
+	var entries []*common.Entry
+	for {
+		more, err := it.nextRecord()
+		if errors.Is(err, ErrTornWrite) || (err == nil && !more) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		var batch []*common.Entry
+		for it.payload.Len() > 0 {
+			entry, err := common.ReadEntryFormat(it.payload, it.format)
+			if err != nil || entry == nil {
+				return entries, fmt.Errorf("%w at offset %d: %v", ErrCorruptRecord, it.recordStart, err)
+			}
+			batch = append(batch, entry)
+		}
+		entries = append(entries, batch...)
+		t.offset = it.offset
+	}
+}
@@ -0,0 +1,67 @@
+package wal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/common"
+	"amethyst/internal/vfs"
+	"amethyst/internal/wal"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	log, err := wal.CreatePreallocatedWAL(vfs.Default, path, 4096)
+	require.NoError(t, err)
+	defer log.Close()
+
+	tailer := wal.NewTailer(vfs.Default, path)
+	entries, err := tailer.ReadNew()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	batch1 := []*common.Entry{
+		{Type: common.EntryTypePut, Seq: 1, Key: []byte("a"), Value: []byte("A")},
+		{Type: common.EntryTypeDelete, Seq: 2, Key: []byte("b")},
+	}
+	batch2 := []*common.Entry{{Type: common.EntryTypePut, Seq: 3, Key: []byte("c"), Value: []byte("C")}}
+	require.NoError(t, log.WriteEntry(batch1))
+	entries, err = tailer.ReadNew()
+	require.NoError(t, err)
+	require.Equal(t, batch1, entries)
+
+	// Each call returns only the records appended since the last
+	entries, err = tailer.ReadNew()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.NoError(t, log.WriteEntry(batch2))
+	entries, err = tailer.ReadNew()
+	require.NoError(t, err)
+	require.Equal(t, batch2, entries)
+}
+
+func TestTailerWaitsForTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	log, err := wal.CreateWAL(vfs.Default, path)
+	require.NoError(t, err)
+	batch := []*common.Entry{{Type: common.EntryTypePut, Seq: 1, Key: []byte("a"), Value: []byte("A")}}
+	require.NoError(t, log.WriteEntry(batch))
+	require.NoError(t, log.Close())
+	full, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// A record caught halfway through its write is read once it's complete
+	require.NoError(t, os.WriteFile(path, full[:len(full)-2], 0o644))
+	tailer := wal.NewTailer(vfs.Default, path)
+	entries, err := tailer.ReadNew()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, os.WriteFile(path, full, 0o644))
+	entries, err = tailer.ReadNew()
+	require.NoError(t, err)
+	require.Equal(t, batch, entries)
+}
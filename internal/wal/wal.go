@@ -2,38 +2,200 @@ package wal
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 
 	"amethyst/internal/common"
+	"amethyst/internal/vfs"
 )
 
+// WAL File Layout:
+//
+//   ┌────────────────┐
+//   │    Record 0    │  one batch
+//   ├────────────────┤
+//   │       ...      │
+//   ├────────────────┤
+//   │    Record N    │
+//   └────────────────┘
+//
+// Record Layout:
+//
+//   ┌────────────────┐
+//   │    Checksum    │  4 bytes: CRC32C of the payload
+//   ├────────────────┤
+//   │     Length     │  4 bytes: payload length; the top bit is set if the
+//   │                │  entries are in common.EntryFormatVarint rather than
+//   │                │  EntryFormatFixed
+//   ├────────────────┤
+//   │    Payload     │  the batch's entries
+//   └────────────────┘
+
+// recordHeaderSize is the size of the checksum and length preceding each
+// record's payload.
+const recordHeaderSize = 8
+
+// recordVarintFlag marks, in a record's length, a payload of entries in
+// common.EntryFormatVarint. Logs written before that format have no records
+// with it set, and records with and without it can share a log, since a log
+// from before the upgrade is appended to when it is reopened.
+const recordVarintFlag = 1 << 31
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 // walImpl appends entries to a single file on disk.
 type walImpl struct {
-	file *os.File
+	fs   vfs.FS
+	file vfs.File
 }
 
 var _ WAL = (*walImpl)(nil)
 
 // OpenWAL opens an existing WAL file for appending (used during recovery).
-func OpenWAL(path string) (*walImpl, error) {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+// A torn record at the end of the log is truncated, and appends follow the
+// last complete record, overwriting any zeros preallocated past it. The
+// truncation is logged to logger.
+func OpenWAL(fsys vfs.FS, path string, logger common.Logger) (*walImpl, error) {
+	f, err := fsys.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	l := &walImpl{fs: fsys, file: f}
+	if err := l.seekToEnd(logger); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to recover %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// seekToEnd positions the log for appending after its last complete record,
+// first cutting the log back to that record if it ends in a torn one.
+func (l *walImpl) seekToEnd(logger common.Logger) error {
+	iter, err := l.Iterator()
+	if err != nil {
+		return err
+	}
+	it := iter.(*walIterator)
+	defer it.Close()
+
+	for {
+		entry, err := it.Next()
+		if errors.Is(err, ErrTornWrite) {
+			logger.Log(common.LevelWarn, "truncating torn write", "path", l.file.Name(), "offset", it.recordStart)
+			if err := l.file.Truncate(it.recordStart); err != nil {
+				return err
+			}
+			if err := l.file.Sync(); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			// Other corruption is left for replay to report; appends go
+			// after it as they always have
+			_, err := l.file.Seek(0, io.SeekEnd)
+			return err
+		}
+		if entry == nil {
+			break
+		}
+	}
+	_, err = l.file.Seek(it.recordStart, io.SeekStart)
+	return err
+}
+
+// OpenWALReadOnly opens an existing WAL file for reading only. Writes to the
+// returned log fail.
+func OpenWALReadOnly(fsys vfs.FS, path string) (*walImpl, error) {
+	f, err := fsys.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open %s: %w", path, err)
 	}
-	return &walImpl{file: f}, nil
+	return &walImpl{fs: fsys, file: f}, nil
 }
 
 // CreateWAL creates a new WAL file, truncating if it exists (used during rotation).
-func CreateWAL(path string) (*walImpl, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+func CreateWAL(fsys vfs.FS, path string) (*walImpl, error) {
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create %s: %w", path, err)
 	}
-	return &walImpl{file: f}, nil
+	return &walImpl{fs: fsys, file: f}, nil
+}
+
+// CreatePreallocatedWAL is like CreateWAL but first fills the file with size
+// bytes of zeros and syncs it, so appends up to that size overwrite space
+// the filesystem has already allocated: syncing them needn't commit block
+// allocations or a new file size to the filesystem journal. Replay takes
+// the zeros past the last record for the end of the log. A size of 0
+// preallocates nothing.
+func CreatePreallocatedWAL(fsys vfs.FS, path string, size int64) (*walImpl, error) {
+	l, err := CreateWAL(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.zeroFill(size); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to preallocate %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// RecycleWAL starts a new, empty WAL at path in the file of the obsolete log
+// at oldPath, which is renamed to path. Its old records are overwritten with
+// zeros, so none is replayed as part of the new log, along with up to size
+// bytes past them, as CreatePreallocatedWAL does. Reusing a file whose
+// blocks are already allocated spares the new log the allocation costs
+// CreateWAL pays on every append.
+func RecycleWAL(fsys vfs.FS, oldPath, path string, size int64) (*walImpl, error) {
+	if err := fsys.Rename(oldPath, path); err != nil {
+		return nil, fmt.Errorf("failed to recycle %s: %w", oldPath, err)
+	}
+	f, err := fsys.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	l := &walImpl{fs: fsys, file: f}
+	stat, err := f.Stat()
+	if err == nil {
+		err = l.zeroFill(max(size, stat.Size()))
+	}
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to recycle %s: %w", oldPath, err)
+	}
+	return l, nil
+}
+
+// zeroFill writes size bytes of zeros from the start of the log, syncs
+// them, and rewinds so appends start at the beginning.
+func (l *walImpl) zeroFill(size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	zeros := make([]byte, min(size, zeroFillChunk))
+	for written := int64(0); written < size; {
+		n, err := l.file.Write(zeros[:min(size-written, int64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		written += int64(n)
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	_, err := l.file.Seek(0, io.SeekStart)
+	return err
 }
 
+// zeroFillChunk is the size of the writes zeroFill makes.
+const zeroFillChunk = 1 << 20
+
 // Close releases the underlying file handle.
 func (l *walImpl) Close() error {
 	if l.file == nil {
@@ -44,35 +206,71 @@ func (l *walImpl) Close() error {
 	return err
 }
 
-// WriteEntry persists the provided batch. Entries are written sequentially.
+// WriteEntry persists the provided batch as a single record, so recovery
+// replays either all of it or none of it.
 func (l *walImpl) WriteEntry(batch []*common.Entry) error {
 	if len(batch) == 0 {
 		return nil
 	}
+	if err := l.Append(batch); err != nil {
+		return err
+	}
+	return l.Sync()
+}
+
+// Append writes batch as a single record, leaving it to the OS to write
+// back until the next Sync.
+func (l *walImpl) Append(batch []*common.Entry) error {
+	if len(batch) == 0 {
+		return nil
+	}
 
 	if l.file == nil {
 		return errors.New("wal: log is closed")
 	}
 
+	var record bytes.Buffer
+	record.Write(make([]byte, recordHeaderSize))
 	for _, e := range batch {
-		if _, err := common.WriteEntry(l.file, e); err != nil {
+		if _, err := common.WriteEntryFormat(&record, e, common.EntryFormatVarint); err != nil {
 			return err
 		}
 	}
+
+	data := record.Bytes()
+	payload := data[recordHeaderSize:]
+	binary.LittleEndian.PutUint32(data[0:4], crc32.Checksum(payload, castagnoli))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(payload))|recordVarintFlag)
+	_, err := l.file.Write(data)
+	return err
+}
+
+// Sync flushes every appended record to stable storage.
+func (l *walImpl) Sync() error {
+	if l.file == nil {
+		return errors.New("wal: log is closed")
+	}
 	return l.file.Sync()
 }
 
 // Iterator returns a streaming iterator over all log entries.
 // The iterator will automatically close the underlying file when exhausted.
 func (l *walImpl) Iterator() (common.EntryIterator, error) {
-	f, err := os.Open(l.file.Name())
+	f, err := l.fs.Open(l.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
 	return &walIterator{
-		file:   f,
-		reader: bufio.NewReader(f),
+		file:    f,
+		reader:  bufio.NewReader(f),
+		size:    stat.Size(),
+		payload: bytes.NewReader(nil),
 	}, nil
 }
 
@@ -97,8 +295,14 @@ func (l *walImpl) Len() int {
 }
 
 type walIterator struct {
-	file   *os.File
+	file   vfs.File
 	reader *bufio.Reader
+	size   int64 // File size when the iterator was opened
+
+	recordStart int64         // Offset of the current record
+	offset      int64         // Offset of the next record
+	payload     *bytes.Reader // Entries of the current record not yet returned
+	format      common.EntryFormat
 }
 
 var _ common.EntryIterator = (*walIterator)(nil)
@@ -108,22 +312,100 @@ func (it *walIterator) Next() (*common.Entry, error) {
 		return nil, nil // Already closed
 	}
 
-	entry, err := common.ReadEntry(it.reader)
-	if err != nil {
-		// Error during decode - close and return error
-		it.Close()
-		return nil, err
+	if it.payload.Len() == 0 {
+		more, err := it.nextRecord()
+		if err != nil || !more {
+			// Error or clean end of stream - close resources
+			it.Close()
+			return nil, err
+		}
 	}
 
-	if entry == nil {
-		// Clean end of stream - close resources
+	entry, err := common.ReadEntryFormat(it.payload, it.format)
+	if err != nil || entry == nil {
+		// The record passed its checksum, so it was written this way
 		it.Close()
-		return nil, nil
+		return nil, fmt.Errorf("%w at offset %d: %v", ErrCorruptRecord, it.recordStart, err)
 	}
-
 	return entry, nil
 }
 
+// nextRecord reads and verifies the next record into it.payload. Returns
+// false at the end of the log.
+func (it *walIterator) nextRecord() (bool, error) {
+	it.recordStart = it.offset
+
+	var header [recordHeaderSize]byte
+	if n, err := io.ReadFull(it.reader, header[:]); err == io.EOF || (err == io.ErrUnexpectedEOF && isZero(header[:n])) {
+		return false, nil
+	} else if err == io.ErrUnexpectedEOF {
+		return false, fmt.Errorf("%w: header at offset %d is incomplete", ErrTornWrite, it.recordStart)
+	} else if err != nil {
+		return false, err
+	}
+
+	checksum := binary.LittleEndian.Uint32(header[0:4])
+	length := int64(binary.LittleEndian.Uint32(header[4:8]))
+	format := common.EntryFormatFixed
+	if length&recordVarintFlag != 0 {
+		length &^= recordVarintFlag
+		format = common.EntryFormatVarint
+	}
+	end := it.recordStart + recordHeaderSize + length
+	if end > it.size {
+		return false, fmt.Errorf("%w: record at offset %d runs past the end of the log", ErrTornWrite, it.recordStart)
+	}
+
+	// Zeros from a record boundary to the end of the file are preallocated
+	// space, or what a crash may leave in place of a record that was never
+	// synced; either way the log ends there
+	if isZero(header[:]) && it.restIsZero() {
+		return false, nil
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(it.reader, payload); err != nil {
+		return false, err
+	}
+	// Batches are never empty, so an empty record is as bad as a failed
+	// checksum
+	if length == 0 || crc32.Checksum(payload, castagnoli) != checksum {
+		// Only the last record can be torn, though preallocated zeros may
+		// follow it; damage elsewhere is corruption
+		if end == it.size || it.restIsZero() {
+			return false, fmt.Errorf("%w: record at offset %d fails its checksum", ErrTornWrite, it.recordStart)
+		}
+		return false, fmt.Errorf("%w at offset %d: checksum mismatch", ErrCorruptRecord, it.recordStart)
+	}
+
+	it.offset = end
+	it.payload.Reset(payload)
+	it.format = format
+	return true, nil
+}
+
+// restIsZero reports whether the rest of the log holds only zeros.
+func (it *walIterator) restIsZero() bool {
+	for {
+		b, err := it.reader.ReadByte()
+		if err != nil {
+			return err == io.EOF
+		}
+		if b != 0 {
+			return false
+		}
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Close releases the underlying file handle.
 // Safe to call multiple times.
 func (it *walIterator) Close() error {
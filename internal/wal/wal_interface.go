@@ -1,11 +1,32 @@
 package wal
 
-import "amethyst/internal/common"
+import (
+	"errors"
+
+	"amethyst/internal/common"
+)
+
+var (
+	// ErrTornWrite is returned when the log ends in a record that was only
+	// partly written, as a crash mid-append leaves it. Opening the log for
+	// appending truncates such a record.
+	ErrTornWrite = errors.New("wal: torn write at end of log")
+	// ErrCorruptRecord is returned for a record that fails its checksum or
+	// doesn't decode but is followed by more of the log.
+	ErrCorruptRecord = errors.New("wal: corrupt record")
+)
 
 // WAL defines the minimal contract required by the DB layer to persist
 // and recover write operations.
 type WAL interface {
+	// WriteEntry appends batch as one record and syncs it.
 	WriteEntry(batch []*common.Entry) error
+	// Append appends batch as one record without syncing it. Records are
+	// durable once a later Sync or WriteEntry returns; a crash before then
+	// may lose a suffix of them, but never a record without those before it.
+	Append(batch []*common.Entry) error
+	// Sync makes every appended record durable.
+	Sync() error
 	Iterator() (common.EntryIterator, error)
 	Len() int
 	Close() error
@@ -1,11 +1,16 @@
 package wal_test
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"amethyst/internal/common"
+	"amethyst/internal/vfs"
 	"amethyst/internal/wal"
 
 	"github.com/stretchr/testify/require"
@@ -15,7 +20,7 @@ func TestAppendAndIterate(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "log.wal")
 
-	log, err := wal.CreateWAL(path)
+	log, err := wal.CreateWAL(vfs.Default, path)
 	require.NoError(t, err)
 	defer log.Close()
 
@@ -45,7 +50,7 @@ func TestPersistsAcrossOpen(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "log.wal")
 
-	log, err := wal.CreateWAL(path)
+	log, err := wal.CreateWAL(vfs.Default, path)
 	require.NoError(t, err)
 
 	batch1 := []*common.Entry{
@@ -59,7 +64,7 @@ func TestPersistsAcrossOpen(t *testing.T) {
 	require.NoError(t, log.WriteEntry(batch1))
 	require.NoError(t, log.Close())
 
-	log, err = wal.OpenWAL(path)
+	log, err = wal.OpenWAL(vfs.Default, path, common.DiscardLogger)
 	require.NoError(t, err)
 	defer log.Close()
 
@@ -83,7 +88,7 @@ func TestBulkAppendBatches(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "log.wal")
 
-	log, err := wal.CreateWAL(path)
+	log, err := wal.CreateWAL(vfs.Default, path)
 	require.NoError(t, err)
 	defer log.Close()
 
@@ -93,7 +98,7 @@ func TestBulkAppendBatches(t *testing.T) {
 	)
 
 	expected := make([]*common.Entry, 0, batches*perBatch)
-	seq := uint32(1)
+	seq := uint64(1)
 
 	for batch := 0; batch < batches; batch++ {
 		current := make([]*common.Entry, 0, perBatch)
@@ -116,3 +121,200 @@ func TestBulkAppendBatches(t *testing.T) {
 
 	common.RequireMatchesIterator(t, iter, expected)
 }
+
+func TestDamagedRecords(t *testing.T) {
+	batches := [][]*common.Entry{
+		{{Type: common.EntryTypePut, Seq: 1, Key: []byte("a"), Value: []byte("A")}},
+		{{Type: common.EntryTypePut, Seq: 2, Key: []byte("b"), Value: []byte("B")}},
+	}
+
+	tests := []struct {
+		name    string
+		damage  func(data []byte, second int) []byte
+		wantErr error
+		// kept is how many batches survive, counting from the first
+		kept int
+	}{
+		{
+			name:    "TruncatedHeader",
+			damage:  func(data []byte, second int) []byte { return data[:second+3] },
+			wantErr: wal.ErrTornWrite,
+			kept:    1,
+		},
+		{
+			name:    "TruncatedPayload",
+			damage:  func(data []byte, second int) []byte { return data[:len(data)-1] },
+			wantErr: wal.ErrTornWrite,
+			kept:    1,
+		},
+		{
+			name: "LastRecordChecksum",
+			damage: func(data []byte, second int) []byte {
+				data[len(data)-1] ^= 0xff
+				return data
+			},
+			wantErr: wal.ErrTornWrite,
+			kept:    1,
+		},
+		{
+			name: "TornRecordBeforeZeros",
+			damage: func(data []byte, second int) []byte {
+				data[len(data)-1] ^= 0xff
+				return append(data, make([]byte, 100)...)
+			},
+			wantErr: wal.ErrTornWrite,
+			kept:    1,
+		},
+		{
+			// Zeros at a record boundary end the log cleanly, as they do
+			// in a preallocated one
+			name: "ZeroedTail",
+			damage: func(data []byte, second int) []byte {
+				clear(data[second:])
+				return append(data, make([]byte, 100)...)
+			},
+			wantErr: nil,
+			kept:    1,
+		},
+		{
+			name: "FirstRecordChecksum",
+			damage: func(data []byte, second int) []byte {
+				data[second-1] ^= 0xff
+				return data
+			},
+			wantErr: wal.ErrCorruptRecord,
+			kept:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log.wal")
+			log, err := wal.CreateWAL(vfs.Default, path)
+			require.NoError(t, err)
+			require.NoError(t, log.WriteEntry(batches[0]))
+			stat, err := os.Stat(path)
+			require.NoError(t, err)
+			require.NoError(t, log.WriteEntry(batches[1]))
+			require.NoError(t, log.Close())
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			damaged := tt.damage(data, int(stat.Size()))
+			require.NoError(t, os.WriteFile(path, damaged, 0644))
+
+			// Reading reports the damage after the intact records
+			log, err = wal.OpenWALReadOnly(vfs.Default, path)
+			require.NoError(t, err)
+			iter, err := log.Iterator()
+			require.NoError(t, err)
+			for _, batch := range batches[:tt.kept] {
+				entry, err := iter.Next()
+				require.NoError(t, err)
+				require.Equal(t, batch[0].Key, entry.Key)
+			}
+			entry, err := iter.Next()
+			require.Nil(t, entry)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.NoError(t, log.Close())
+
+			// Opening for append truncates a torn write and leaves
+			// corruption elsewhere in place
+			log, err = wal.OpenWAL(vfs.Default, path, common.DiscardLogger)
+			require.NoError(t, err)
+			defer log.Close()
+			reopened, err := os.Stat(path)
+			require.NoError(t, err)
+			if tt.wantErr == wal.ErrTornWrite {
+				require.Equal(t, stat.Size(), reopened.Size())
+			} else {
+				require.Equal(t, int64(len(damaged)), reopened.Size())
+			}
+			require.Equal(t, tt.kept, log.Len())
+		})
+	}
+}
+
+func TestPreallocatedWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+	log, err := wal.CreatePreallocatedWAL(vfs.Default, path, 4096)
+	require.NoError(t, err)
+
+	batch1 := []*common.Entry{{Type: common.EntryTypePut, Seq: 1, Key: []byte("a"), Value: []byte("A")}}
+	batch2 := []*common.Entry{{Type: common.EntryTypePut, Seq: 2, Key: []byte("b"), Value: []byte("B")}}
+	require.NoError(t, log.WriteEntry(batch1))
+	require.NoError(t, log.Close())
+
+	// Appends overwrite the preallocated zeros without growing the file
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), stat.Size())
+
+	log, err = wal.OpenWAL(vfs.Default, path, common.DiscardLogger)
+	require.NoError(t, err)
+	defer log.Close()
+	require.NoError(t, log.WriteEntry(batch2))
+	stat, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(4096), stat.Size())
+
+	iter, err := log.Iterator()
+	require.NoError(t, err)
+	common.RequireMatchesIterator(t, iter, append(batch1, batch2...))
+}
+
+func TestRecycleWAL(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, path := filepath.Join(dir, "1.log"), filepath.Join(dir, "2.log")
+
+	old, err := wal.CreateWAL(vfs.Default, oldPath)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, old.WriteEntry([]*common.Entry{{Type: common.EntryTypePut, Seq: uint64(i), Key: []byte(fmt.Sprintf("old%d", i))}}))
+	}
+	require.NoError(t, old.Close())
+	oldStat, err := os.Stat(oldPath)
+	require.NoError(t, err)
+
+	log, err := wal.RecycleWAL(vfs.Default, oldPath, path, 0)
+	require.NoError(t, err)
+	defer log.Close()
+	_, err = os.Stat(oldPath)
+	require.True(t, os.IsNotExist(err))
+
+	// None of the old log's records survive into the new one
+	batch := []*common.Entry{{Type: common.EntryTypePut, Seq: 100, Key: []byte("new"), Value: []byte("v")}}
+	require.NoError(t, log.WriteEntry(batch))
+	iter, err := log.Iterator()
+	require.NoError(t, err)
+	common.RequireMatchesIterator(t, iter, batch)
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, oldStat.Size(), stat.Size())
+}
+
+func TestLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.wal")
+
+	// A record as logs held them before varint entries: no flag in the
+	// length, entries in the fixed format
+	old := &common.Entry{Type: common.EntryTypePut, Seq: 1, Key: []byte("old"), Value: []byte("v1")}
+	var payload bytes.Buffer
+	_, err := common.WriteEntryFormat(&payload, old, common.EntryFormatFixed)
+	require.NoError(t, err)
+	record := binary.LittleEndian.AppendUint32(nil, crc32.Checksum(payload.Bytes(), crc32.MakeTable(crc32.Castagnoli)))
+	record = binary.LittleEndian.AppendUint32(record, uint32(payload.Len()))
+	require.NoError(t, os.WriteFile(path, append(record, payload.Bytes()...), 0o644))
+
+	// Reopened after the upgrade, the log mixes both formats
+	log, err := wal.OpenWAL(vfs.Default, path, common.DiscardLogger)
+	require.NoError(t, err)
+	defer log.Close()
+	current := &common.Entry{Type: common.EntryTypePut, Seq: 1 << 40, Key: []byte("new"), Value: []byte("v2")}
+	require.NoError(t, log.WriteEntry([]*common.Entry{current}))
+
+	iter, err := log.Iterator()
+	require.NoError(t, err)
+	common.RequireMatchesIterator(t, iter, []*common.Entry{old, current})
+}
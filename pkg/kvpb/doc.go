@@ -0,0 +1,6 @@
+// Package kvpb holds the protobuf messages and gRPC stubs of the KV service
+// defined in kv.proto, which cmd/grpcd serves. Clients in other languages
+// generate their own stubs from kv.proto.
+package kvpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kv.proto
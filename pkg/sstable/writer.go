@@ -0,0 +1,75 @@
+// Package sstable builds SSTables outside a running database, so offline
+// pipelines such as MapReduce jobs can prepare data for DB.IngestSSTable.
+// The Writer API is stable: methods may be added, but existing ones keep
+// their signatures and behavior.
+package sstable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"amethyst/internal/common"
+	"amethyst/internal/sstable"
+)
+
+// ErrFinished is returned by a Writer used after Finish.
+var ErrFinished = errors.New("sstable: writer already finished")
+
+// bloomFilterFPR is the false positive rate of the tables' bloom filters.
+// Ingestion rewrites tables with the database's own filter settings, so
+// this only matters for reading the file directly.
+const bloomFilterFPR = 0.01
+
+// Writer writes a single SSTable. Keys must be added in strictly increasing
+// order. A Writer is not safe for concurrent use.
+type Writer struct {
+	builder  *sstable.Builder
+	lastKey  []byte
+	entries  int
+	finished bool
+}
+
+// NewWriter starts an SSTable written to w. expectedEntries sizes the
+// table's bloom filter; more entries may be added at the cost of more false
+// positives. The caller closes w after Finish.
+func NewWriter(w io.Writer, expectedEntries int) *Writer {
+	return &Writer{
+		builder: sstable.NewBuilder(w, uint32(max(expectedEntries, 0)), bloomFilterFPR, nil, nil),
+	}
+}
+
+// Add writes key with value. key must sort after every key added before it.
+func (w *Writer) Add(key, value []byte) error {
+	if w.finished {
+		return ErrFinished
+	}
+	if w.entries > 0 && bytes.Compare(key, w.lastKey) <= 0 {
+		return fmt.Errorf("sstable: key %q does not follow %q", key, w.lastKey)
+	}
+
+	entry := &common.Entry{
+		Type:      common.EntryTypePut,
+		Timestamp: time.Now().UnixNano(),
+		Key:       key,
+		Value:     value,
+	}
+	if err := w.builder.Add(entry); err != nil {
+		return err
+	}
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.entries++
+	return nil
+}
+
+// Finish writes the rest of the table. The Writer can't be used afterwards.
+func (w *Writer) Finish() error {
+	if w.finished {
+		return ErrFinished
+	}
+	w.finished = true
+	_, err := w.builder.Finish(nil)
+	return err
+}
@@ -0,0 +1,61 @@
+package sstable_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"amethyst/internal/db"
+	"amethyst/pkg/sstable"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterIngest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offline.sst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := sstable.NewWriter(f, 100)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.Add([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	require.NoError(t, w.Finish())
+	require.NoError(t, f.Close())
+
+	d, err := db.Open(db.WithDBPath(t.TempDir()))
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.IngestSSTable(path))
+
+	for i := 0; i < 100; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("v%d", i)), value)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+	}{
+		{"decreasing key", []string{"b", "a"}},
+		{"duplicate key", []string{"a", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := sstable.NewWriter(&bytes.Buffer{}, len(tt.keys))
+			last := len(tt.keys) - 1
+			for _, key := range tt.keys[:last] {
+				require.NoError(t, w.Add([]byte(key), nil))
+			}
+			require.Error(t, w.Add([]byte(tt.keys[last]), nil))
+		})
+	}
+
+	w := sstable.NewWriter(&bytes.Buffer{}, 0)
+	require.NoError(t, w.Finish())
+	require.ErrorIs(t, w.Add([]byte("a"), nil), sstable.ErrFinished)
+	require.ErrorIs(t, w.Finish(), sstable.ErrFinished)
+}